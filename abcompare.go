@@ -0,0 +1,126 @@
+package main
+
+import (
+	_ "embed"
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"bilizir-demo/sysfont"
+)
+
+//go:embed shaders/diff.kage
+var diffShaderSrc []byte
+
+// diffGain amplifies differences in the A/B difference view
+const diffGain = 4
+
+// ABMode selects how two implementations of an effect are compared
+type ABMode int
+
+const (
+	ABOff  ABMode = iota
+	ABWipe        // A left of the wipe line, B right of it
+	ABDiff        // Amplified per-pixel difference between A and B
+)
+
+// abPair is an effect with two implementations that can be compared
+type abPair struct {
+	name   string
+	labels [2]string
+	use    func(g *Game, b bool) // Selects implementation B when b is true
+	usesB  func(g *Game) bool    // Reports the implementation in use
+}
+
+// abPairs lists the effects with alternative implementations
+var abPairs = []abPair{
+	{
+		name:   "scroller",
+		labels: [2]string{"CPU", "GPU"},
+		use:    func(g *Game, b bool) { g.scroller.UseGPU = b },
+		usesB:  func(g *Game) bool { return g.scroller.UseGPU },
+	},
+	{
+		name:   "cubes",
+		labels: [2]string{"per face", "batched"},
+		use:    func(g *Game, b bool) { g.cubes.PerFace = !b },
+		usesB:  func(g *Game) bool { return !g.cubes.PerFace },
+	},
+}
+
+// ABCompare renders the demo twice, once per implementation, to check
+// visual parity during performance rewrites. B cycles the mode, Shift+B
+// the effect compared; the mouse moves the wipe line.
+type ABCompare struct {
+	mode    ABMode
+	pair    int
+	wipe    float64 // Wipe position, 0 to 1 across the frame
+	buffers [2]*ebiten.Image
+	shader  *ebiten.Shader
+}
+
+// cycle switches to the next comparison mode
+func (ab *ABCompare) cycle() {
+	ab.mode = (ab.mode + 1) % 3
+	ab.wipe = 0.5
+}
+
+// updateWipe follows the mouse while it is over the window
+func (ab *ABCompare) updateWipe(frameWidth int) {
+	x, _ := ebiten.CursorPosition()
+	if x > 0 && x < frameWidth {
+		ab.wipe = float64(x) / float64(frameWidth)
+	}
+}
+
+// buffer returns the i-th offscreen buffer, sized like dst
+func (ab *ABCompare) buffer(i int, dst *ebiten.Image) *ebiten.Image {
+	b := ab.buffers[i]
+	if b == nil || b.Bounds().Size() != dst.Bounds().Size() {
+		if b != nil {
+			b.Deallocate()
+		}
+		b = ebiten.NewImage(dst.Bounds().Dx(), dst.Bounds().Dy())
+		ab.buffers[i] = b
+	}
+	return b
+}
+
+// drawCompared renders both implementations and composites them onto dst
+func (g *Game) drawCompared(dst *ebiten.Image) {
+	ab := &g.ab
+	pair := abPairs[ab.pair]
+
+	// Render with each implementation, then restore the user's choice
+	saved := pair.usesB(g)
+	for i := range 2 {
+		pair.use(g, i == 1)
+		g.drawDemo(ab.buffer(i, dst))
+	}
+	pair.use(g, saved)
+
+	a, b := ab.buffers[0], ab.buffers[1]
+	w, h := dst.Bounds().Dx(), dst.Bounds().Dy()
+
+	switch {
+	case ab.mode == ABDiff && ab.shader != nil:
+		op := &ebiten.DrawRectShaderOptions{}
+		op.Images[0] = a
+		op.Images[1] = b
+		op.Uniforms = map[string]any{"Gain": float32(diffGain)}
+		dst.DrawRectShader(w, h, ab.shader, op)
+		sysfont.Printf(dst, 8, 8, sysfont.Style{}, "A/B DIFF %s: %s vs %s", pair.name, pair.labels[0], pair.labels[1])
+
+	default:
+		wx := int(ab.wipe * float64(w))
+		dst.DrawImage(a, nil)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(float64(wx), 0)
+		dst.DrawImage(b.SubImage(image.Rect(wx, 0, w, h)).(*ebiten.Image), op)
+		vector.StrokeLine(dst, float32(wx), 0, float32(wx), float32(h), 1, color.White, false)
+		sysfont.Print(dst, "A: "+pair.labels[0], wx-8, 8, sysfont.Style{Align: sysfont.Right})
+		sysfont.Print(dst, "B: "+pair.labels[1], wx+8, 8, sysfont.Style{})
+	}
+}
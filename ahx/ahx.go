@@ -0,0 +1,360 @@
+// Package ahx loads and plays AHX and HivelyTracker songs, the softsynth
+// chip music of the Amiga. Instruments hold no samples: each note plays a
+// short triangle, sawtooth, square or noise waveform, filtered and
+// reshaped from frame to frame by the instrument's performance list.
+// Both formats load into the same Song and share the replay, a port of
+// the HivelyTracker replayer.
+package ahx
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrFormat is returned for data that is not an AHX or HVL song
+var ErrFormat = errors.New("ahx: not an AHX or HVL song")
+
+// Format is the tracker a song was written with
+type Format int
+
+const (
+	FormatAHX Format = iota // AHX, 4 channels
+	FormatHVL               // HivelyTracker, 4 to 16 channels
+)
+
+// String returns the file extension of the format, in capitals
+func (f Format) String() string {
+	return [...]string{"AHX", "HVL"}[f]
+}
+
+// Limits of the formats
+const (
+	maxChannels = 16
+	maxNote     = 60 // Notes run from C-1 (1) to B-5 (60)
+	ahxPanGain  = 84 // Mixing gain of AHX songs, in percent
+	ahxStereo   = 2  // Stereo separation of AHX songs, from 0 (mono) to 4
+	ahxEntry    = 4  // Size of a performance list entry
+	hvlEntry    = 5
+	emptyStep   = 0x3f // First byte of an empty HVL step, stored alone
+	instrHeader = 22
+)
+
+// Step is the note and the two effects of a channel on a row. AHX steps
+// have one effect.
+type Step struct {
+	Note       int // 1 to 60, 0 for none
+	Instrument int // From 1, 0 for none
+	FX         int
+	FXParam    int
+	FXb        int
+	FXbParam   int
+}
+
+// Position is a row of the song: the track each channel plays, and the
+// semitones its notes are transposed by
+type Position struct {
+	Track     [maxChannels]int
+	Transpose [maxChannels]int
+}
+
+// Envelope is the ADSR volume envelope of an instrument, in frames and
+// volumes from 0 to 64
+type Envelope struct {
+	AFrames, AVolume int
+	DFrames, DVolume int
+	SFrames          int
+	RFrames, RVolume int
+}
+
+// Entry is a line of a performance list: an optional waveform and note,
+// and two commands
+type Entry struct {
+	Note     int
+	Fixed    bool // The note is not transposed by the track note
+	Waveform int  // 1 triangle, 2 sawtooth, 3 square, 4 noise, 0 to keep
+	FX       [2]int
+	FXParam  [2]int
+}
+
+// Instrument is a softsynth voice setting, driven frame by frame by its
+// performance list
+type Instrument struct {
+	Name       string
+	Volume     int
+	WaveLength int // Waveform length, 4 << WaveLength samples
+	Envelope   Envelope
+
+	FilterLower, FilterUpper, FilterSpeed int
+	SquareLower, SquareUpper, SquareSpeed int
+	VibratoDelay, VibratoDepth            int
+	VibratoSpeed                          int
+	HardCutRelease                        bool
+	HardCutFrames                         int
+
+	Speed int // Frames per performance list entry
+	List  []Entry
+}
+
+// Song is a decoded AHX or HVL song
+type Song struct {
+	Format      Format
+	Version     int
+	Title       string
+	Channels    int
+	Restart     int
+	TrackLength int // Rows per track
+	SpeedMult   int // Frames per 50Hz frame
+	Gain        int // Mixing gain, 256 for full
+	Stereo      int // Stereo separation, 0 (mono) to 4
+	Subsongs    []int
+	Positions   []Position
+	Tracks      [][]Step
+	Instruments []Instrument // From instrument 1
+}
+
+// Is reports whether data is an AHX or HVL song
+func Is(data []byte) bool {
+	if len(data) < 14 {
+		return false
+	}
+	id := string(data[:3])
+	return (id == "THX" || id == "HVL") && data[3] < 2
+}
+
+// Parse decodes an AHX or HVL song
+func Parse(data []byte) (*Song, error) {
+	if !Is(data) {
+		return nil, ErrFormat
+	}
+	hvl := data[0] == 'H'
+	s := &Song{
+		Format:      FormatAHX,
+		Version:     int(data[3]),
+		Channels:    4,
+		Restart:     int(data[8])<<8 | int(data[9]),
+		TrackLength: int(data[10]),
+		SpeedMult:   int(data[6]>>5&3) + 1,
+		Gain:        ahxPanGain * 256 / 100,
+		Stereo:      ahxStereo,
+	}
+	numPositions := int(data[6]&0x0f)<<8 | int(data[7])
+	numTracks, numInstruments, numSubsongs := int(data[11]), int(data[12]), int(data[13])
+	noTrack0 := data[6]&0x80 != 0
+	pos := 14
+	if hvl {
+		if len(data) < 16 {
+			return nil, errors.New("ahx: truncated header")
+		}
+		s.Format = FormatHVL
+		s.Channels = int(data[8]>>2) + 4
+		s.Restart = int(data[8]&3)<<8 | int(data[9])
+		s.Gain = int(data[14]) << 8 / 100
+		s.Stereo = min(int(data[15]), 4)
+		pos = 16
+	}
+	if s.Channels > maxChannels {
+		return nil, errors.New("ahx: too many channels")
+	}
+	if numPositions == 0 || s.TrackLength == 0 {
+		return nil, errors.New("ahx: empty song")
+	}
+	if s.Restart >= numPositions {
+		s.Restart = 0
+	}
+
+	r := reader{data: data, pos: pos}
+	for range numSubsongs {
+		s.Subsongs = append(s.Subsongs, r.u16())
+	}
+	for range numPositions {
+		var p Position
+		for c := range s.Channels {
+			p.Track[c] = r.u8()
+			p.Transpose[c] = int(int8(r.u8()))
+		}
+		s.Positions = append(s.Positions, p)
+	}
+	for t := 0; t <= numTracks; t++ {
+		track := make([]Step, s.TrackLength)
+		s.Tracks = append(s.Tracks, track)
+		if t == 0 && noTrack0 {
+			continue
+		}
+		for i := range track {
+			if hvl {
+				track[i] = r.hvlStep()
+			} else {
+				track[i] = r.ahxStep()
+			}
+		}
+	}
+	for range numInstruments {
+		s.Instruments = append(s.Instruments, r.instrument(hvl, s.Version))
+	}
+	if r.short {
+		return nil, errors.New("ahx: truncated song")
+	}
+	for i, p := range s.Positions {
+		for c := range s.Channels {
+			if p.Track[c] > numTracks {
+				s.Positions[i].Track[c] = 0
+			}
+		}
+	}
+
+	// The names follow: the title, then the instrument names
+	names := r.pos
+	if off := int(data[4])<<8 | int(data[5]); off > 0 && off < len(data) {
+		names = off
+	}
+	r = reader{data: data, pos: names}
+	s.Title = r.name()
+	for i := range s.Instruments {
+		s.Instruments[i].Name = r.name()
+	}
+	return s, nil
+}
+
+// reader reads the fields of a song, noting when the data runs short
+// instead of failing on each read
+type reader struct {
+	data  []byte
+	pos   int
+	short bool
+}
+
+// u8 reads a byte
+func (r *reader) u8() int {
+	if r.pos >= len(r.data) {
+		r.short = true
+		return 0
+	}
+	r.pos++
+	return int(r.data[r.pos-1])
+}
+
+// u16 reads a big-endian 16-bit value
+func (r *reader) u16() int {
+	return r.u8()<<8 | r.u8()
+}
+
+// bytes reads n bytes, zeros past the end of the data
+func (r *reader) bytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(r.u8())
+	}
+	return b
+}
+
+// name reads a zero-terminated string
+func (r *reader) name() string {
+	if r.pos >= len(r.data) {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(r.data[r.pos:]), "\x00")
+	r.pos += len(s) + 1
+	return strings.TrimSpace(s)
+}
+
+// ahxStep reads a 3-byte AHX step: a 6-bit note, a 6-bit instrument and
+// an effect
+func (r *reader) ahxStep() Step {
+	b := r.bytes(3)
+	return Step{
+		Note:       int(b[0] >> 2 & 0x3f),
+		Instrument: int(b[0]&3)<<4 | int(b[1]>>4),
+		FX:         int(b[1] & 0x0f),
+		FXParam:    int(b[2]),
+	}
+}
+
+// hvlStep reads an HVL step, a single byte when empty, else a note, an
+// instrument and two effects
+func (r *reader) hvlStep() Step {
+	if r.pos < len(r.data) && r.data[r.pos] == emptyStep {
+		r.pos++
+		return Step{}
+	}
+	b := r.bytes(5)
+	return Step{
+		Note:       int(b[0]),
+		Instrument: int(b[1]),
+		FX:         int(b[2] >> 4),
+		FXParam:    int(b[3]),
+		FXb:        int(b[2] & 0x0f),
+		FXbParam:   int(b[4]),
+	}
+}
+
+// instrument reads an instrument header and its performance list
+func (r *reader) instrument(hvl bool, version int) Instrument {
+	h := r.bytes(instrHeader)
+	ins := Instrument{
+		Volume:     int(h[0]),
+		WaveLength: int(h[1] & 7),
+		Envelope: Envelope{
+			AFrames: int(h[2]), AVolume: int(h[3]),
+			DFrames: int(h[4]), DVolume: int(h[5]),
+			SFrames: int(h[6]),
+			RFrames: int(h[7]), RVolume: int(h[8]),
+		},
+		FilterSpeed:    int(h[1]>>3&0x1f) | int(h[12]>>2&0x20),
+		FilterLower:    int(h[12] & 0x7f),
+		FilterUpper:    int(h[19] & 0x3f),
+		VibratoDelay:   int(h[13]),
+		HardCutFrames:  int(h[14] >> 4 & 7),
+		HardCutRelease: h[14]&0x80 != 0,
+		VibratoDepth:   int(h[14] & 0x0f),
+		VibratoSpeed:   int(h[15]),
+		SquareLower:    int(h[16]),
+		SquareUpper:    int(h[17]),
+		SquareSpeed:    int(h[18]),
+		Speed:          int(h[20]),
+	}
+	ins.WaveLength = min(ins.WaveLength, 5)
+	for range int(h[21]) {
+		if hvl {
+			ins.List = append(ins.List, hvlEntryOf(r.bytes(hvlEntry)))
+		} else {
+			ins.List = append(ins.List, ahxEntryOf(r.bytes(ahxEntry), version))
+		}
+	}
+	return ins
+}
+
+// ahxCommands maps the 3-bit performance list commands of AHX to the
+// HVL ones: 6 and 7 are volume (C) and speed (F)
+var ahxCommands = [8]int{0, 1, 2, 3, 4, 5, 12, 15}
+
+// ahxEntryOf decodes a 4-byte AHX performance list entry
+func ahxEntryOf(b []byte, version int) Entry {
+	e := Entry{
+		FX:       [2]int{ahxCommands[b[0]>>2&7], ahxCommands[b[0]>>5&7]},
+		Waveform: int(b[0]<<1&6) | int(b[1]>>7),
+		Fixed:    b[1]>>6&1 != 0,
+		Note:     int(b[1] & 0x3f),
+		FXParam:  [2]int{int(b[2]), int(b[3])},
+	}
+	// Songs of the first version had no filters: their filter toggles
+	// are left out, as AHX does
+	if version == 0 {
+		for i := range e.FX {
+			if e.FX[i] == 4 && e.FXParam[i]&0xf0 != 0 {
+				e.FXParam[i] &= 0x0f
+			}
+		}
+	}
+	return e
+}
+
+// hvlEntryOf decodes a 5-byte HVL performance list entry
+func hvlEntryOf(b []byte) Entry {
+	return Entry{
+		FX:       [2]int{int(b[0] & 0x0f), int(b[1] >> 3 & 0x0f)},
+		Waveform: int(b[1] & 7),
+		Fixed:    b[2]>>6&1 != 0,
+		Note:     int(b[2] & 0x3f),
+		FXParam:  [2]int{int(b[3]), int(b[4])},
+	}
+}
@@ -0,0 +1,1073 @@
+package ahx
+
+import (
+	"slices"
+	"time"
+)
+
+const (
+	frameRate   = 50                // Replay frames per second, times SpeedMult
+	paulaClock  = 3546897.0         // PAL Paula clock, in periods per second
+	bufferLen   = 0x280             // Voice buffer, in samples
+	bufferFixed = bufferLen << 16   // Voice buffer in 16.16 positions
+	noOverride  = 1000              // Transpose override unset
+	minPeriod   = 0x0071            // Period of B-5
+	maxPeriod   = 0x0d60            // Period of C-1
+	maxDuration = 30 * time.Minute  // Longest song measured
+	filterMid   = unfilteredSet + 1 // Filter position of the unfiltered set
+	waveSquare  = 2                 // Waveforms, from 0
+	waveNoise   = 3
+)
+
+// periods are the Amiga periods of the notes, from C-1 (1) to B-5 (60)
+var periods = [maxNote + 1]int{
+	0x0000, 0x0D60, 0x0CA0, 0x0BE8, 0x0B40, 0x0A98, 0x0A00, 0x0970,
+	0x08E8, 0x0868, 0x07F0, 0x0780, 0x0714, 0x06B0, 0x0650, 0x05F4,
+	0x05A0, 0x054C, 0x0500, 0x04B8, 0x0474, 0x0434, 0x03F8, 0x03C0,
+	0x038A, 0x0358, 0x0328, 0x02FA, 0x02D0, 0x02A6, 0x0280, 0x025C,
+	0x023A, 0x021A, 0x01FC, 0x01E0, 0x01C5, 0x01AC, 0x0194, 0x017D,
+	0x0168, 0x0153, 0x0140, 0x012E, 0x011D, 0x010D, 0x00FE, 0x00F0,
+	0x00E2, 0x00D6, 0x00CA, 0x00BE, 0x00B4, 0x00AA, 0x00A0, 0x0097,
+	0x008F, 0x0087, 0x007F, 0x0078, 0x0071,
+}
+
+// vibratoTable is the sine of vibratos, over 64 steps
+var vibratoTable = [64]int{
+	0, 24, 49, 74, 97, 120, 141, 161, 180, 197, 212, 224, 235, 244, 250, 253, 255,
+	253, 250, 244, 235, 224, 212, 197, 180, 161, 141, 120, 97, 74, 49, 24,
+	0, -24, -49, -74, -97, -120, -141, -161, -180, -197, -212, -224, -235, -244, -250, -253, -255,
+	-253, -250, -244, -235, -224, -212, -197, -180, -161, -141, -120, -97, -74, -49, -24,
+}
+
+// notePeriod returns the period of a note, clamped to the table
+func notePeriod(note int) int {
+	return periods[min(max(note, 0), maxNote)]
+}
+
+// voice is the state of one channel
+type voice struct {
+	num                int
+	track, transpose   int
+	nextTrack          int
+	overrideTranspose  int
+	ins                *Instrument
+	trackPeriod        int // Note of the track, before transposing
+	instrPeriod        int // Note of the performance list
+	fixedNote          bool
+	trackMasterVolume  int
+	noteMaxVolume      int
+	perfSubVolume      int
+	adsrVolume         int // Volume times 256
+	adsr               Envelope
+	volumeSlideUp      int
+	volumeSlideDown    int
+	hardCut            int
+	hardCutRelease     bool
+	hardCutReleaseF    int
+	noteCutOn          bool
+	noteCutWait        int
+	noteDelayOn        bool
+	noteDelayWait      int
+	pan, setPan        int
+	panLeft, panRight  int
+	periodSlideSpeed   int
+	periodSlidePeriod  int
+	periodSlideLimit   int
+	periodSlideOn      bool
+	periodSlideLimited bool
+	perfSlideSpeed     int
+	perfSlidePeriod    int
+	perfSlideOn        bool
+	vibratoDelay       int
+	vibratoDepth       int
+	vibratoSpeed       int
+	vibratoCurrent     int
+	vibratoPeriod      int
+	plantPeriod        bool
+
+	// Performance list
+	perfOn      bool
+	perfCurrent int
+	perfSpeed   int
+	perfWait    int
+
+	// Waveform, square modulation and filter sweep
+	waveform, waveLength      int
+	newWaveform               bool
+	squareOn, squareInit      bool
+	squareSlidingIn           bool
+	squareLower, squareUpper  int
+	squarePos, squareSign     int
+	squareWait                int
+	plantSquare, ignoreSquare bool
+	filterOn, filterInit      bool
+	filterSlidingIn           bool
+	filterLower, filterUpper  int
+	filterPos, filterSign     int
+	filterSpeed, filterWait   int
+	ignoreFilter              int
+	squareBuffer              [0x80]int8
+	source                    []int8
+	noiseRandom               uint32
+
+	// Ring modulation by a second waveform
+	ringSource         []int8
+	ringNewWaveform    bool
+	ringWaveform       int
+	ringPlantPeriod    bool
+	ringBasePeriod     int
+	ringFixedPeriod    bool
+	ringAudioPeriod    int
+	ringBuffer         [bufferLen + 1]int8
+	ringMix            []int8
+	ringPos, ringDelta uint32
+
+	// Mixer input, set at the end of each frame
+	audioPeriod, audioVolume int
+	volume                   int
+	buffer                   [bufferLen + 1]int8
+	mix                      []int8
+	pos, delta               uint32
+}
+
+// RowTime is a row played in one pass through the song, and when it
+// starts
+type RowTime struct {
+	Time     time.Duration
+	Position int  // Song position
+	Row      int  // Row in the tracks of the position
+	Start    bool // The first row played at this position
+
+	// Instruments of the notes the row starts, from 1, each once
+	Instruments []int
+}
+
+// Player renders a song as 16-bit samples
+type Player struct {
+	Song *Song
+
+	rate      int
+	voices    []voice
+	tempo     int
+	posNr     int
+	noteNr    int
+	posJump   int
+	jumpNote  int
+	patBreak  bool
+	stepWait  int
+	newPos    bool
+	songEnd   bool
+	frameLeft float64 // Samples left in the current frame
+
+	duration time.Duration
+	rows     []RowTime
+	scratch  []int16
+}
+
+// NewPlayer parses a song and prepares it to play from the start of its
+// main subsong
+func NewPlayer(data []byte, sampleRate int) (*Player, error) {
+	s, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	genTables()
+	p := &Player{Song: s, rate: sampleRate}
+	p.duration, p.rows = measure(s)
+	p.Reset()
+	return p, nil
+}
+
+// Reset rewinds to the start of the song
+func (p *Player) Reset() {
+	p.restart()
+	p.frameLeft = 0
+}
+
+// restart starts the song over from its first position
+func (p *Player) restart() {
+	s := p.Song
+	p.posNr, p.noteNr, p.posJump, p.jumpNote = 0, 0, 0, 0
+	p.patBreak, p.songEnd = false, false
+	p.tempo, p.stepWait, p.newPos = 6, 0, true
+
+	left, right := stereoPans[s.Stereo][0], stereoPans[s.Stereo][1]
+	p.voices = make([]voice, s.Channels)
+	for i := range p.voices {
+		v := &p.voices[i]
+		v.num = i
+		v.delta = 1
+		v.overrideTranspose = noOverride
+		v.noiseRandom = bufferLen
+		v.trackMasterVolume = 0x40
+		v.mix = v.buffer[:]
+		// Channels are panned left, right, right, left
+		v.pan = left
+		if i%4 == 1 || i%4 == 2 {
+			v.pan = right
+		}
+		v.setPan = v.pan
+		v.panLeft, v.panRight = panLeft[v.pan], panRight[v.pan]
+	}
+}
+
+// Duration returns the length of one pass through the song, up to where
+// it loops
+func (p *Player) Duration() time.Duration {
+	return p.duration
+}
+
+// Position returns the song position and the row being played
+func (p *Player) Position() (position, row int) {
+	return p.posNr, p.noteNr
+}
+
+// Rows returns the rows of one pass through the song, in playing order.
+// The slice is shared and must not be modified.
+func (p *Player) Rows() []RowTime {
+	return p.rows
+}
+
+// frameSamples returns the length of a replay frame, in samples
+func (p *Player) frameSamples() float64 {
+	return float64(p.rate) / frameRate / float64(p.Song.SpeedMult)
+}
+
+// Render fills buf with interleaved stereo samples. The song loops.
+func (p *Player) Render(buf []int16) {
+	for i := 0; i+1 < len(buf); i += 2 {
+		if p.frameLeft <= 0 {
+			p.playFrame()
+			p.frameLeft += p.frameSamples()
+		}
+		p.frameLeft--
+		buf[i], buf[i+1] = p.mix()
+	}
+}
+
+// Compute renders n mono samples into buf, for offline analysis
+func (p *Player) Compute(buf []int16, n int) bool {
+	if len(p.scratch) < n*2 {
+		p.scratch = make([]int16, n*2)
+	}
+	p.Render(p.scratch[:n*2])
+	for i := 0; i < n; i++ {
+		buf[i] = int16((int(p.scratch[i*2]) + int(p.scratch[i*2+1])) / 2)
+	}
+	return true
+}
+
+// Skip advances playback by d without mixing. The voices keep their
+// place in their waveforms, so playback resumes as if it had played.
+func (p *Player) Skip(d time.Duration) {
+	samples := d.Seconds() * float64(p.rate)
+	for samples > 0 {
+		if p.frameLeft <= 0 {
+			p.playFrame()
+			p.frameLeft += p.frameSamples()
+		}
+		n := min(p.frameLeft, samples)
+		p.frameLeft -= n
+		samples -= n
+		for i := range p.voices {
+			v := &p.voices[i]
+			v.pos = uint32((uint64(v.pos) + uint64(n*float64(v.delta))) % bufferFixed)
+			if v.ringMix != nil {
+				v.ringPos = uint32((uint64(v.ringPos) + uint64(n*float64(v.ringDelta))) % bufferFixed)
+			}
+		}
+	}
+}
+
+// mix returns the next stereo sample of the voices
+func (p *Player) mix() (l, r int16) {
+	a, b := 0, 0
+	for i := range p.voices {
+		v := &p.voices[i]
+		if v.pos >= bufferFixed {
+			v.pos -= bufferFixed
+		}
+		s := int(v.mix[v.pos>>16])
+		if v.ringMix != nil {
+			if v.ringPos >= bufferFixed {
+				v.ringPos -= bufferFixed
+			}
+			s = s * int(v.ringMix[v.ringPos>>16]) >> 7
+			v.ringPos += v.ringDelta
+		}
+		j := s * v.volume
+		a += j * v.panLeft >> 7
+		b += j * v.panRight >> 7
+		v.pos += v.delta
+	}
+	a = a * p.Song.Gain >> 8
+	b = b * p.Song.Gain >> 8
+	return int16(min(max(a, -32768), 32767)), int16(min(max(b, -32768), 32767))
+}
+
+// playFrame runs the replay for a frame: the steps of a new row, then the
+// frame effects and the performance lists of every voice
+func (p *Player) playFrame() {
+	s := p.Song
+	if p.tempo == 0 {
+		// Speed 0 stops the song; start it over
+		p.restart()
+	}
+	if p.stepWait <= 0 {
+		if p.newPos {
+			next := (p.posNr + 1) % len(s.Positions)
+			for i := range p.voices {
+				v := &p.voices[i]
+				v.track = s.Positions[p.posNr].Track[i]
+				v.transpose = s.Positions[p.posNr].Transpose[i]
+				v.nextTrack = s.Positions[next].Track[i]
+			}
+			p.newPos = false
+		}
+		for i := range p.voices {
+			p.processStep(&p.voices[i])
+		}
+		p.stepWait = p.tempo
+	}
+
+	for i := range p.voices {
+		p.processFrame(&p.voices[i])
+	}
+
+	if p.tempo > 0 {
+		p.stepWait--
+		if p.stepWait <= 0 {
+			p.nextRow()
+		}
+	}
+
+	for i := range p.voices {
+		p.setAudio(&p.voices[i])
+	}
+}
+
+// nextRow moves to the next row, following jumps and breaks
+func (p *Player) nextRow() {
+	s := p.Song
+	if !p.patBreak {
+		p.noteNr++
+		if p.noteNr >= s.TrackLength {
+			p.posJump = p.posNr + 1
+			p.jumpNote = 0
+			p.patBreak = true
+		}
+	}
+	if p.patBreak {
+		p.patBreak = false
+		p.posNr, p.noteNr = p.posJump, p.jumpNote
+		if p.posNr >= len(s.Positions) {
+			p.songEnd = true
+			p.posNr = s.Restart
+		}
+		if p.noteNr >= s.TrackLength {
+			p.noteNr = 0
+		}
+		p.posJump, p.jumpNote = 0, 0
+		p.newPos = true
+	}
+}
+
+// step returns the step of a voice's track at a row
+func (p *Player) step(track, row int) Step {
+	t := p.Song.Tracks[track]
+	if row >= len(t) {
+		return Step{}
+	}
+	return t[row]
+}
+
+// processStep starts the step of the current row on a voice: its
+// instrument, its note and its effects
+func (p *Player) processStep(v *voice) {
+	s := p.Song
+	v.volumeSlideUp, v.volumeSlideDown = 0, 0
+	st := p.step(s.Positions[p.posNr].Track[v.num], p.noteNr)
+	note, instr := st.Note, st.Instrument
+
+	// A note delay holds the whole step back
+	delayed := false
+	for i, fx := range [2][2]int{{st.FX, st.FXParam}, {st.FXb, st.FXbParam}} {
+		if fx[0] != 0xe || fx[1]&0xf0 != 0xd0 || i == 1 && delayed {
+			continue
+		}
+		if v.noteDelayOn {
+			v.noteDelayOn = false
+			delayed = true
+			continue
+		}
+		if fx[1]&0x0f < p.tempo {
+			v.noteDelayWait = fx[1] & 0x0f
+			if v.noteDelayWait > 0 {
+				v.noteDelayOn = true
+				return
+			}
+		}
+	}
+
+	if note != 0 {
+		v.overrideTranspose = noOverride
+	}
+	p.stepEffect1(v, st.FX, st.FXParam)
+	p.stepEffect1(v, st.FXb, st.FXbParam)
+
+	if instr > 0 && instr <= len(s.Instruments) {
+		p.startInstrument(v, &s.Instruments[instr-1])
+	}
+	v.periodSlideOn = false
+
+	p.stepEffect2(v, st.FX, st.FXParam, &note)
+	p.stepEffect2(v, st.FXb, st.FXbParam, &note)
+	if note != 0 {
+		v.trackPeriod = note
+		v.plantPeriod = true
+	}
+
+	p.stepEffect3(v, st.FX, st.FXParam)
+	p.stepEffect3(v, st.FXb, st.FXbParam)
+}
+
+// startInstrument sets a voice up to play an instrument from the start of
+// its envelope and performance list
+func (p *Player) startInstrument(v *voice, ins *Instrument) {
+	v.pan = v.setPan
+	v.panLeft, v.panRight = panLeft[v.pan], panRight[v.pan]
+	v.periodSlideSpeed, v.periodSlidePeriod, v.periodSlideLimit = 0, 0, 0
+
+	v.perfSubVolume = 0x40
+	v.adsrVolume = 0
+	v.ins = ins
+	v.pos = 0
+
+	// Envelope slopes, in volume times 256 per frame
+	e := ins.Envelope
+	v.adsr = Envelope{AFrames: e.AFrames, DFrames: e.DFrames, SFrames: e.SFrames, RFrames: e.RFrames}
+	v.adsr.AVolume = slope(e.AVolume, 0, e.AFrames)
+	v.adsr.DVolume = slope(e.DVolume, e.AVolume, e.DFrames)
+	v.adsr.RVolume = slope(e.RVolume, e.DVolume, e.RFrames)
+
+	v.waveLength = ins.WaveLength
+	v.noteMaxVolume = ins.Volume
+	v.vibratoCurrent = 0
+	v.vibratoDelay = ins.VibratoDelay
+	v.vibratoDepth = ins.VibratoDepth
+	v.vibratoSpeed = ins.VibratoSpeed
+	v.vibratoPeriod = 0
+	v.hardCutRelease = ins.HardCutRelease
+	v.hardCut = ins.HardCutFrames
+
+	v.ignoreSquare, v.squareSlidingIn = false, false
+	v.squareWait, v.squareOn = 0, false
+	lower := ins.SquareLower >> (5 - v.waveLength)
+	upper := ins.SquareUpper >> (5 - v.waveLength)
+	v.squareLower, v.squareUpper = min(lower, upper), max(lower, upper)
+
+	v.ignoreFilter, v.filterWait, v.filterOn = 0, 0, false
+	v.filterSlidingIn = false
+	v.filterSpeed = ins.FilterSpeed
+	v.filterLower = min(ins.FilterLower, ins.FilterUpper)
+	v.filterUpper = max(ins.FilterLower, ins.FilterUpper)
+	v.filterPos = filterMid
+
+	v.perfWait, v.perfCurrent = 0, 0
+	v.perfSpeed = ins.Speed
+	v.perfOn = true
+
+	v.ringMix = nil
+	v.ringPos = 0
+	v.ringPlantPeriod = false
+	v.ringNewWaveform = false
+}
+
+// slope returns the change per frame of an envelope section going from
+// one volume to another, times 256; a section without frames jumps
+func slope(to, from, frames int) int {
+	if frames == 0 {
+		return to * 256
+	}
+	return (to - from) * 256 / frames
+}
+
+// stepEffect1 applies the effects acting on the song position, the
+// volume slides and the panning, before the instrument starts
+func (p *Player) stepEffect1(v *voice, fx, param int) {
+	switch fx {
+	case 0x0: // Position jump, hundreds
+		if param&0x0f > 0 && param&0x0f <= 9 {
+			p.posJump = param & 0x0f
+		}
+	case 0x5, 0xa: // Volume slide, with tone portamento for 5
+		v.volumeSlideDown = param & 0x0f
+		v.volumeSlideUp = param >> 4
+	case 0x7: // Panning
+		v.pan = (param + 128) & 0xff
+		v.setPan = v.pan
+		v.panLeft, v.panRight = panLeft[v.pan], panRight[v.pan]
+	case 0xb: // Position jump
+		p.posJump = p.posJump*100 + param&0x0f + (param>>4)*10
+		p.patBreak = true
+		if p.posJump <= p.posNr {
+			p.songEnd = true
+		}
+	case 0xd: // Pattern break
+		p.posJump = p.posNr + 1
+		p.jumpNote = param&0x0f + (param>>4)*10
+		p.patBreak = true
+		if p.jumpNote > p.Song.TrackLength {
+			p.jumpNote = 0
+		}
+	case 0xe:
+		if param>>4 == 0xc && param&0x0f < p.tempo { // Note cut
+			v.noteCutWait = param & 0x0f
+			if v.noteCutWait > 0 {
+				v.noteCutOn = true
+				v.hardCutRelease = false
+			}
+		}
+	case 0xf: // Speed
+		p.tempo = param
+		if param == 0 {
+			p.songEnd = true
+		}
+	}
+}
+
+// stepEffect2 applies the square offset and the tone portamentos, which
+// glide to the note instead of starting it
+func (p *Player) stepEffect2(v *voice, fx, param int, note *int) {
+	switch fx {
+	case 0x9: // Square offset
+		v.squarePos = param >> (5 - v.waveLength)
+		v.ignoreSquare = true
+	case 0x3, 0x5: // Tone portamento, with volume slide for 5
+		if fx == 0x3 && param != 0 {
+			v.periodSlideSpeed = param
+		}
+		if *note != 0 {
+			diff := notePeriod(v.trackPeriod) - notePeriod(*note)
+			if diff+v.periodSlidePeriod != 0 {
+				v.periodSlideLimit = -diff
+			}
+		}
+		v.periodSlideOn = true
+		v.periodSlideLimited = true
+		*note = 0
+	}
+}
+
+// stepEffect3 applies the portamentos, the filter override, the volumes
+// and the fine effects
+func (p *Player) stepEffect3(v *voice, fx, param int) {
+	switch fx {
+	case 0x1: // Portamento up
+		v.periodSlideSpeed = -param
+		v.periodSlideOn, v.periodSlideLimited = true, false
+	case 0x2: // Portamento down
+		v.periodSlideSpeed = param
+		v.periodSlideOn, v.periodSlideLimited = true, false
+	case 0x4: // Filter override
+		switch {
+		case param == 0 || param == 0x40 || param > 0x7f:
+		case param < 0x40:
+			v.ignoreFilter = param
+		default:
+			v.filterPos = param - 0x40
+		}
+	case 0xc: // Volume: note, then all tracks, then this track
+		p.setVolume(v, param, func(vol int) {
+			for i := range p.voices {
+				p.voices[i].trackMasterVolume = vol
+			}
+		})
+	case 0xe:
+		x := param & 0x0f
+		switch param >> 4 {
+		case 0x1: // Fine slide up
+			v.periodSlidePeriod -= x
+			v.plantPeriod = true
+		case 0x2: // Fine slide down
+			v.periodSlidePeriod += x
+			v.plantPeriod = true
+		case 0x4: // Vibrato depth
+			v.vibratoDepth = x
+		case 0xa: // Fine volume up
+			v.noteMaxVolume = min(v.noteMaxVolume+x, 0x40)
+		case 0xb: // Fine volume down
+			v.noteMaxVolume = max(v.noteMaxVolume-x, 0)
+		case 0xf: // Keep the transpose of the position for the notes
+			if p.Song.Version >= 1 && x == 1 {
+				v.overrideTranspose = v.transpose
+			}
+		}
+	}
+}
+
+// setVolume applies a volume command: 0 to 0x40 sets the note volume,
+// 0x50 to 0x90 the second volume through set, and 0xa0 to 0xe0 the
+// track master volume
+func (p *Player) setVolume(v *voice, param int, set func(int)) {
+	switch {
+	case param <= 0x40:
+		v.noteMaxVolume = param
+	case param >= 0x50 && param <= 0x90:
+		set(param - 0x50)
+	case param >= 0xa0 && param <= 0xe0:
+		v.trackMasterVolume = param - 0xa0
+	}
+}
+
+// processFrame runs a frame of a voice: delays and cuts, the envelope,
+// slides and vibrato, the performance list, then the waveform and the
+// period and volume the mixer plays
+func (p *Player) processFrame(v *voice) {
+	s := p.Song
+	if v.noteDelayOn {
+		if v.noteDelayWait <= 0 {
+			p.processStep(v)
+		} else {
+			v.noteDelayWait--
+		}
+	}
+
+	// A hard cut ends the note a few frames before the next instrument
+	if v.hardCut > 0 {
+		var next Step
+		if p.noteNr+1 < s.TrackLength {
+			next = p.step(v.track, p.noteNr+1)
+		} else {
+			next = p.step(v.nextTrack, 0)
+		}
+		if next.Instrument != 0 {
+			d := max(p.tempo-v.hardCut, 0)
+			if !v.noteCutOn {
+				v.noteCutOn = true
+				v.noteCutWait = d
+				v.hardCutReleaseF = p.tempo - d
+			}
+			v.hardCut = 0
+		}
+	}
+	if v.noteCutOn {
+		if v.noteCutWait <= 0 {
+			v.noteCutOn = false
+			if v.hardCutRelease && v.ins != nil && v.hardCutReleaseF > 0 {
+				v.adsr.RVolume = -(v.adsrVolume - v.ins.Envelope.RVolume<<8) / v.hardCutReleaseF
+				v.adsr.RFrames = v.hardCutReleaseF
+				v.adsr.AFrames, v.adsr.DFrames, v.adsr.SFrames = 0, 0, 0
+			} else {
+				v.noteMaxVolume = 0
+			}
+		} else {
+			v.noteCutWait--
+		}
+	}
+
+	p.envelope(v)
+
+	v.noteMaxVolume = min(max(v.noteMaxVolume+v.volumeSlideUp-v.volumeSlideDown, 0), 0x40)
+
+	if v.periodSlideOn {
+		if v.periodSlideLimited {
+			d0 := v.periodSlidePeriod - v.periodSlideLimit
+			d2 := v.periodSlideSpeed
+			if d0 > 0 {
+				d2 = -d2
+			}
+			if d0 != 0 {
+				if (d0+d2)^d0 >= 0 {
+					v.periodSlidePeriod += d2
+				} else {
+					v.periodSlidePeriod = v.periodSlideLimit
+				}
+				v.plantPeriod = true
+			}
+		} else {
+			v.periodSlidePeriod += v.periodSlideSpeed
+			v.plantPeriod = true
+		}
+	}
+
+	if v.vibratoDepth > 0 {
+		if v.vibratoDelay <= 0 {
+			v.vibratoPeriod = vibratoTable[v.vibratoCurrent] * v.vibratoDepth >> 7
+			v.plantPeriod = true
+			v.vibratoCurrent = (v.vibratoCurrent + v.vibratoSpeed) & 0x3f
+		} else {
+			v.vibratoDelay--
+		}
+	}
+
+	p.performance(v)
+
+	if v.perfSlideOn {
+		v.perfSlidePeriod -= v.perfSlideSpeed
+		if v.perfSlidePeriod != 0 {
+			v.plantPeriod = true
+		}
+	}
+
+	if v.waveform == waveSquare && v.squareOn && v.ins != nil {
+		v.squareWait--
+		if v.squareWait <= 0 {
+			v.squarePos, v.squareSign, v.squareInit, v.squareSlidingIn = sweep(v.squarePos, v.squareLower, v.squareUpper, v.squareSign, v.squareInit, v.squareSlidingIn, 1)
+			v.plantSquare = true
+			v.squareWait = v.ins.SquareSpeed
+		}
+	}
+
+	if v.filterOn {
+		v.filterWait--
+		if v.filterWait <= 0 {
+			steps := 1
+			if v.filterSpeed < 4 {
+				steps = 5 - v.filterSpeed
+			}
+			v.filterPos, v.filterSign, v.filterInit, v.filterSlidingIn = sweep(v.filterPos, v.filterLower, v.filterUpper, v.filterSign, v.filterInit, v.filterSlidingIn, steps)
+			v.filterPos = min(max(v.filterPos, 1), 63)
+			v.newWaveform = true
+			v.filterWait = max(v.filterSpeed-3, 1)
+		}
+	}
+
+	if v.waveform == waveSquare || v.plantSquare {
+		v.calcSquare()
+	}
+	if v.waveform == waveNoise {
+		v.newWaveform = true
+	}
+
+	if v.ringNewWaveform {
+		v.ringWaveform = min(v.ringWaveform, 1)
+		v.ringSource = waveform(v.ringWaveform, filterMid, v.waveLength)
+	}
+	if v.newWaveform {
+		v.source = v.waveformSource()
+	}
+
+	if v.ringSource != nil {
+		v.ringAudioPeriod = v.period(v.ringBasePeriod, v.ringFixedPeriod)
+	}
+	v.audioPeriod = v.period(v.instrPeriod, v.fixedNote)
+	vol := (v.adsrVolume >> 8) * v.noteMaxVolume >> 6
+	vol = vol * v.perfSubVolume >> 6
+	v.audioVolume = vol * v.trackMasterVolume >> 6
+}
+
+// envelope advances the ADSR envelope of a voice by a frame
+func (p *Player) envelope(v *voice) {
+	a, e := &v.adsr, Envelope{}
+	if v.ins != nil {
+		e = v.ins.Envelope
+	}
+	switch {
+	case a.AFrames > 0:
+		v.adsrVolume += a.AVolume
+		if a.AFrames--; a.AFrames <= 0 {
+			v.adsrVolume = e.AVolume << 8
+		}
+	case a.DFrames > 0:
+		v.adsrVolume += a.DVolume
+		if a.DFrames--; a.DFrames <= 0 {
+			v.adsrVolume = e.DVolume << 8
+		}
+	case a.SFrames > 0:
+		a.SFrames--
+	case a.RFrames > 0:
+		v.adsrVolume += a.RVolume
+		if a.RFrames--; a.RFrames <= 0 {
+			v.adsrVolume = e.RVolume << 8
+		}
+	}
+}
+
+// sweep moves the square width or the filter cutoff of a voice by steps
+// between its limits, turning back at each of them. Starting outside the
+// limits, it first slides in.
+func sweep(pos, lower, upper, sign int, init, slidingIn bool, steps int) (int, int, bool, bool) {
+	if init {
+		init = false
+		switch {
+		case pos <= lower:
+			slidingIn, sign = true, 1
+		case pos >= upper:
+			slidingIn, sign = true, -1
+		}
+	}
+	for range steps {
+		if pos == lower || pos == upper {
+			if slidingIn {
+				slidingIn = false
+			} else {
+				sign = -sign
+			}
+		}
+		pos += sign
+	}
+	return pos, sign, init, slidingIn
+}
+
+// performance runs the performance list of the voice's instrument: every
+// perfSpeed frames, the next entry changes the waveform and the note and
+// runs its two commands
+func (p *Player) performance(v *voice) {
+	if !v.perfOn {
+		return
+	}
+	if v.ins == nil || v.perfCurrent >= len(v.ins.List) {
+		if v.perfWait > 0 {
+			v.perfWait--
+		} else {
+			v.perfSlideSpeed = 0
+		}
+		return
+	}
+	// The wait counts down as a signed byte
+	overflow := v.perfWait == 128
+	v.perfWait--
+	if !overflow && int8(v.perfWait) > 0 {
+		return
+	}
+
+	e := v.ins.List[v.perfCurrent]
+	v.perfCurrent++
+	v.perfWait = v.perfSpeed
+	if e.Waveform > 0 && e.Waveform <= 4 {
+		v.waveform = e.Waveform - 1
+		v.newWaveform = true
+		v.perfSlideSpeed, v.perfSlidePeriod = 0, 0
+	}
+	v.perfSlideOn = false
+	for i := range e.FX {
+		p.perfCommand(v, e.FX[i], e.FXParam[i])
+	}
+	if e.Note != 0 {
+		v.instrPeriod = e.Note
+		v.plantPeriod = true
+		v.fixedNote = e.Fixed
+	}
+}
+
+// perfCommand runs a command of a performance list entry
+func (p *Player) perfCommand(v *voice, fx, param int) {
+	switch fx {
+	case 0x0: // Filter position
+		if param > 0 && param < 0x40 {
+			if v.ignoreFilter != 0 {
+				v.filterPos, v.ignoreFilter = v.ignoreFilter, 0
+			} else {
+				v.filterPos = param
+			}
+			v.newWaveform = true
+		}
+	case 0x1: // Slide up
+		v.perfSlideSpeed, v.perfSlideOn = param, true
+	case 0x2: // Slide down
+		v.perfSlideSpeed, v.perfSlideOn = -param, true
+	case 0x3: // Square width
+		if !v.ignoreSquare {
+			v.squarePos = param >> (5 - v.waveLength)
+		} else {
+			v.ignoreSquare = false
+		}
+	case 0x4: // Toggle the square and filter sweeps
+		if param == 0 || param&0x0f != 0 {
+			v.squareOn = !v.squareOn
+			v.squareInit = v.squareOn
+			v.squareSign = 1
+			if param&0x0f == 0x0f {
+				v.squareSign = -1
+			}
+		}
+		if param&0xf0 != 0 {
+			v.filterOn = !v.filterOn
+			v.filterInit = v.filterOn
+			v.filterSign = 1
+			if param&0xf0 == 0xf0 {
+				v.filterSign = -1
+			}
+		}
+	case 0x5: // Jump
+		v.perfCurrent = param
+	case 0x7, 0x8: // Ring modulation by a triangle or a sawtooth
+		switch {
+		case param >= 1 && param <= 0x3c:
+			v.ringBasePeriod, v.ringFixedPeriod = param, true
+		case param >= 0x81 && param <= 0xbc:
+			v.ringBasePeriod, v.ringFixedPeriod = param-0x80, false
+		default:
+			v.ringBasePeriod, v.ringFixedPeriod = 0, false
+			v.ringNewWaveform = false
+			v.ringSource, v.ringMix = nil, nil
+			return
+		}
+		v.ringWaveform = fx - 0x7
+		v.ringNewWaveform = true
+		v.ringPlantPeriod = true
+	case 0x9: // Panning
+		v.pan = (param + 128) & 0xff
+		v.panLeft, v.panRight = panLeft[v.pan], panRight[v.pan]
+	case 0xc: // Volume: note, then performance, then track
+		p.setVolume(v, param, func(vol int) { v.perfSubVolume = vol })
+	case 0xf: // Speed
+		v.perfSpeed, v.perfWait = param, param
+	}
+}
+
+// calcSquare builds the square of the voice's width and wave length, from
+// the squares filtered at its filter position
+func (v *voice) calcSquare() {
+	set := waves[(v.filterPos-1)*setSize+squaresOffset:]
+	x := v.squarePos << (5 - v.waveLength)
+	if x > 0x20 {
+		x = 0x40 - x
+	}
+	src := 0
+	if x > 0 {
+		src = (x - 1) << 7
+	}
+	delta := 32 >> v.waveLength
+	for i := range 4 << v.waveLength {
+		v.squareBuffer[i] = set[src]
+		src += delta
+	}
+	v.newWaveform = true
+	v.waveform = waveSquare
+	v.plantSquare = false
+}
+
+// waveform returns a triangle (0) or a sawtooth (1) of a wave length at a
+// filter position
+func waveform(w, filter, length int) []int8 {
+	off := triangleOffset
+	if w == 1 {
+		off = sawtoothOffset
+	}
+	off += (filter-1)*setSize + lengthOffsets[length]
+	return waves[off : off+4<<length]
+}
+
+// waveformSource returns the waveform the voice plays; noise starts at a
+// new random place each frame
+func (v *voice) waveformSource() []int8 {
+	switch v.waveform {
+	case waveSquare:
+		return v.squareBuffer[:4<<v.waveLength]
+	case waveNoise:
+		off := (v.filterPos-1)*setSize + noiseOffset + int(v.noiseRandom&(2*bufferLen-1)&^1)
+		v.noiseRandom += 2239384
+		v.noiseRandom = (((v.noiseRandom>>8 | v.noiseRandom<<24) + 782323) ^ 75) - 6735
+		return waves[off : off+bufferLen]
+	}
+	return waveform(v.waveform, v.filterPos, v.waveLength)
+}
+
+// period returns the Amiga period of a note of the performance list or of
+// the ring modulation, transposed by the track note unless fixed, with
+// the slides and the vibrato
+func (v *voice) period(note int, fixed bool) int {
+	if !fixed {
+		transpose := v.transpose
+		if v.overrideTranspose != noOverride {
+			transpose = v.overrideTranspose
+		}
+		note += transpose + v.trackPeriod - 1
+	}
+	period := notePeriod(note)
+	if !fixed {
+		period += v.periodSlidePeriod
+	}
+	period += v.perfSlidePeriod + v.vibratoPeriod
+	return min(max(period, minPeriod), maxPeriod)
+}
+
+// setAudio hands the period, volume and waveform of the frame to the
+// mixer
+func (p *Player) setAudio(v *voice) {
+	v.volume = v.audioVolume
+	if v.plantPeriod {
+		v.plantPeriod = false
+		v.delta = p.delta(v.audioPeriod)
+	}
+	if v.newWaveform {
+		if v.waveform == waveNoise {
+			copy(v.buffer[:bufferLen], v.source)
+		} else {
+			fill(v.buffer[:bufferLen], v.source)
+		}
+		v.buffer[bufferLen] = v.buffer[0]
+		v.mix = v.buffer[:]
+	}
+	if v.ringPlantPeriod {
+		v.ringPlantPeriod = false
+		v.ringDelta = p.delta(v.ringAudioPeriod)
+	}
+	if v.ringNewWaveform && v.ringSource != nil {
+		fill(v.ringBuffer[:bufferLen], v.ringSource)
+		v.ringBuffer[bufferLen] = v.ringBuffer[0]
+		v.ringMix = v.ringBuffer[:]
+	}
+}
+
+// delta returns the 16.16 step through the voice buffer of a period
+func (p *Player) delta(period int) uint32 {
+	d := uint32(paulaClock * 65536 / float64(period) / float64(p.rate))
+	if d > bufferFixed {
+		d -= bufferFixed
+	}
+	return max(d, 1)
+}
+
+// fill repeats a waveform over buf
+func fill(buf, wave []int8) {
+	for i := 0; i < len(buf); i += len(wave) {
+		copy(buf[i:], wave)
+	}
+}
+
+// measure plays the song without mixing until it loops, and returns how
+// long that took with the rows played on the way
+func measure(s *Song) (time.Duration, []RowTime) {
+	p := &Player{Song: s, rate: 44100}
+	p.Reset()
+
+	var rows []RowTime
+	frames := 0
+	maxFrames := int(maxDuration.Seconds()) * frameRate * s.SpeedMult
+	entered := true
+	for frames < maxFrames && !(p.songEnd && (p.newPos || p.tempo == 0)) {
+		if p.stepWait <= 0 {
+			rows = append(rows, RowTime{
+				Time:        time.Duration(frames) * time.Second / time.Duration(frameRate*s.SpeedMult),
+				Position:    p.posNr,
+				Row:         p.noteNr,
+				Start:       entered,
+				Instruments: p.started(),
+			})
+			entered = false
+		}
+		p.playFrame()
+		frames++
+		entered = entered || p.newPos
+	}
+	return time.Duration(frames) * time.Second / time.Duration(frameRate*s.SpeedMult), rows
+}
+
+// started returns the instruments of the notes the current row starts.
+// Tone portamentos glide to their note instead of starting it.
+func (p *Player) started() []int {
+	var ins []int
+	for c := range p.voices {
+		st := p.step(p.Song.Positions[p.posNr].Track[c], p.noteNr)
+		if st.Instrument == 0 || st.FX == 0x3 || st.FX == 0x5 || st.FXb == 0x3 || st.FXb == 0x5 {
+			continue
+		}
+		if !slices.Contains(ins, st.Instrument) {
+			ins = append(ins, st.Instrument)
+		}
+	}
+	return ins
+}
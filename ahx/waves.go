@@ -0,0 +1,198 @@
+package ahx
+
+import (
+	"math"
+	"sync"
+)
+
+// The waveforms are generated once, as HivelyTracker does: triangles and
+// sawtooths of 4 to 128 samples, 32 squares of 128 samples from the
+// narrowest pulse to a square, and white noise. The set is stored
+// unfiltered, then through 31 low-pass and 31 high-pass filters of rising
+// cutoff; filter position 32 is the unfiltered set, 1 to 31 the low-pass
+// ones and 33 to 63 the high-pass ones.
+const (
+	noiseLen = 0x280 * 3
+	setSize  = 0xfc + 0xfc + 0x80*0x20 + noiseLen // One filtered set
+
+	triangleOffset = 0
+	sawtoothOffset = 0xfc
+	squaresOffset  = 0xfc + 0xfc
+	noiseOffset    = squaresOffset + 0x80*0x20
+
+	unfilteredSet = 31 // Sets 0 to 30 are low-pass, 32 to 62 high-pass
+	numSets       = 63
+)
+
+// lengthOffsets are the offsets of the triangles and sawtooths of each
+// wave length in their series
+var lengthOffsets = [6]int{0x00, 0x04, 0x04 + 0x08, 0x04 + 0x08 + 0x10, 0x04 + 0x08 + 0x10 + 0x20, 0x04 + 0x08 + 0x10 + 0x20 + 0x40}
+
+// waves holds every filtered set, generated on first use
+var (
+	waves     []int8
+	wavesOnce sync.Once
+)
+
+// Stereo panning gains, the left and right sides of a quarter sine
+var panLeft, panRight [256]int
+
+// stereoPans are the positions of left and right channels for each
+// stereo separation
+var stereoPans = [5][2]int{{128, 128}, {96, 160}, {64, 193}, {32, 225}, {0, 255}}
+
+// genTables fills the waveform and panning tables, once
+func genTables() {
+	wavesOnce.Do(fillTables)
+}
+
+// fillTables generates the waveforms and the panning gains
+func fillTables() {
+	for i := range 256 {
+		a := float64(i) * math.Pi / 2 / 256
+		panLeft[i] = int(math.Cos(a) * 255)
+		panRight[i] = int(math.Sin(a) * 255)
+	}
+	panLeft[255], panRight[0] = 0, 0
+
+	waves = make([]int8, setSize*numSets)
+	set := waves[unfilteredSet*setSize : (unfilteredSet+1)*setSize]
+	for i, n := 0, 4; n <= 0x80; i, n = i+1, n*2 {
+		genTriangle(set[triangleOffset+lengthOffsets[i]:][:n])
+		genSawtooth(set[sawtoothOffset+lengthOffsets[i]:][:n])
+	}
+	genSquares(set[squaresOffset:noiseOffset])
+	genNoise(set[noiseOffset:])
+	genFilters(set)
+}
+
+// genSawtooth fills buf with a rising ramp
+func genSawtooth(buf []int8) {
+	add := 256 / (len(buf) - 1)
+	v := -128
+	for i := range buf {
+		buf[i] = int8(v)
+		v += add
+	}
+}
+
+// genTriangle fills buf with a triangle starting from 0: up a quarter,
+// down to the middle, and the mirror of the first half
+func genTriangle(buf []int8) {
+	quarter := len(buf) / 4
+	step := 128 / quarter
+	i, v := 0, 0
+	for range quarter {
+		buf[i] = int8(v)
+		i++
+		v += step
+	}
+	buf[i] = 0x7f
+	i++
+	if quarter != 1 {
+		v = 128
+		for range quarter - 1 {
+			v -= step
+			buf[i] = int8(v)
+			i++
+		}
+	}
+	src := i - len(buf)/2
+	for range quarter * 2 {
+		c := buf[src]
+		src++
+		if c == 0x7f {
+			c = -128
+		} else {
+			c = -c
+		}
+		buf[i] = c
+		i++
+	}
+}
+
+// genSquares fills buf with 32 pulses of 128 samples, from the narrowest
+// to a square
+func genSquares(buf []int8) {
+	i := 0
+	for w := 1; w <= 0x20; w++ {
+		for range (0x40 - w) * 2 {
+			buf[i] = -128
+			i++
+		}
+		for range w * 2 {
+			buf[i] = 0x7f
+			i++
+		}
+	}
+}
+
+// genNoise fills buf with the pseudo-random noise of AHX, samples at the
+// extremes or taken from the generator
+func genNoise(buf []int8) {
+	ays := uint32(0x41595321)
+	for i := range buf {
+		s := int8(ays)
+		if ays&0x100 != 0 {
+			s = -128
+			if int16(ays) >= 0 {
+				s = 0x7f
+			}
+		}
+		buf[i] = s
+
+		ays = ays>>5 | ays<<27
+		ays = ays&0xffffff00 | (ays&0xff ^ 0x9a)
+		bx := uint16(ays)
+		ays = ays<<2 | ays>>30
+		ax := uint16(ays)
+		bx += ax
+		ax ^= bx
+		ays = ays&0xffff0000 | uint32(ax)
+		ays = ays>>3 | ays<<29
+	}
+}
+
+// waveLengths are the lengths of the 45 waveforms of a set, in order
+func waveLengths() []int {
+	var n []int
+	for range 2 {
+		for l := 4; l <= 0x80; l *= 2 {
+			n = append(n, l)
+		}
+	}
+	for range 0x20 {
+		n = append(n, 0x80)
+	}
+	return append(n, noiseLen)
+}
+
+// genFilters runs every waveform of the unfiltered set through a state
+// variable filter at 31 cutoffs, the low-pass output making a low-pass
+// set and the high-pass output a high-pass one. Each waveform is run
+// through once to settle the filter before it is recorded.
+func genFilters(set []int8) {
+	clip := func(x float64) float64 { return min(max(x, -128), 127) }
+	freq := 8.0
+	for f := range unfilteredSet {
+		low := waves[f*setSize:]
+		high := waves[(unfilteredSet+1+f)*setSize:]
+		fre := freq * 1.25 / 100
+		start := 0
+		for _, n := range waveLengths() {
+			var mid, lo, hi float64
+			for pass := range 2 {
+				for i := start; i < start+n; i++ {
+					hi = clip(float64(set[i]) - mid - lo)
+					mid = clip(mid + hi*fre)
+					lo = clip(lo + mid*fre)
+					if pass == 1 {
+						low[i], high[i] = int8(lo), int8(hi)
+					}
+				}
+			}
+			start += n
+		}
+		freq += 3
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"bilizir-demo/ahx"
+	"bilizir-demo/mod"
+)
+
+// AHXPlayer plays an AHX or HivelyTracker song for Ebiten audio
+type AHXPlayer struct {
+	playbackState
+
+	player     *ahx.Player
+	sampleRate int
+	buffer     []int16
+	position   int64 // Samples played since the start of the song
+	loop       bool
+
+	// Rows of one pass through the song, as tracker syncs see them: the
+	// song positions stand for the patterns
+	rows []mod.RowTime
+}
+
+// NewAHXPlayer loads a song and starts its main subsong from the start
+func NewAHXPlayer(data []byte, sampleRate int, loop bool) (*AHXPlayer, error) {
+	player, err := ahx.NewPlayer(data, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AHX song: %w", err)
+	}
+
+	s := player.Song
+	log.Printf("%v: %q, %d channels, %d positions, %v", s.Format, s.Title, s.Channels, len(s.Positions), player.Duration().Round(time.Second))
+	rows := make([]mod.RowTime, len(player.Rows()))
+	for i, r := range player.Rows() {
+		rows[i] = mod.RowTime{Time: r.Time, Order: r.Position, Pattern: r.Position, Row: r.Row, Start: r.Start, Instruments: r.Instruments}
+	}
+	return &AHXPlayer{
+		player:        player,
+		rows:          rows,
+		sampleRate:    sampleRate,
+		buffer:        make([]int16, 8192),
+		loop:          loop,
+		playbackState: playbackState{volume: 0.5},
+	}, nil
+}
+
+// Read implements io.Reader for audio streaming
+func (m *AHXPlayer) Read(p []byte) (n int, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastRead = time.Now()
+	samplesNeeded := len(p) / 4
+	n = samplesNeeded * 4
+
+	// Output silence while paused, keeping the audio stream alive
+	if m.paused {
+		clear(p[:n])
+		return n, nil
+	}
+
+	// The song loops by itself; stop after one pass otherwise
+	if !m.loop {
+		left := int64(m.player.Duration().Seconds()*float64(m.sampleRate)) - m.position
+		if left <= 0 {
+			return 0, io.EOF
+		}
+		samplesNeeded = int(min(int64(samplesNeeded), left))
+		n = samplesNeeded * 4
+	}
+
+	for done := 0; done < samplesNeeded; {
+		chunk := min(samplesNeeded-done, len(m.buffer)/2)
+		m.player.Render(m.buffer[:chunk*2])
+
+		for i, v := range m.buffer[:chunk*2] {
+			sample := int16(float64(v) * m.volume)
+			o := done*4 + i*2
+			p[o], p[o+1] = byte(sample), byte(sample>>8)
+		}
+		done += chunk
+		m.position += int64(chunk)
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker; offsets are in bytes of 16-bit stereo
+func (m *AHXPlayer) Seek(offset int64, whence int) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = m.position*4 + offset
+	case io.SeekEnd:
+		pos = int64(m.player.Duration().Seconds()*float64(m.sampleRate))*4 + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	m.seek(max(pos, 0) / 4)
+	return m.position * 4, nil
+}
+
+// SeekTime moves playback to the given time in the song
+func (m *AHXPlayer) SeekTime(t time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if t < 0 {
+		return
+	}
+	m.seek(int64(t.Seconds() * float64(m.sampleRate)))
+}
+
+// seek moves to a sample position, replaying the song from its start
+// when going backwards
+func (m *AHXPlayer) seek(sample int64) {
+	from := m.position
+	if sample < from {
+		m.player.Reset()
+		from = 0
+	}
+	m.player.Skip(time.Duration(sample-from) * time.Second / time.Duration(m.sampleRate))
+	m.position = sample
+}
+
+// MusicPosition returns the current time in the song
+func (m *AHXPlayer) MusicPosition() time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pos := time.Duration(m.position) * time.Second / time.Duration(m.sampleRate)
+	if d := m.player.Duration(); d > 0 && m.loop {
+		pos %= d
+	}
+	return pos
+}
+
+// Duration returns the length of one pass through the song
+func (m *AHXPlayer) Duration() time.Duration {
+	return m.player.Duration()
+}
+
+// Info returns the song title; songs do not name their author
+func (m *AHXPlayer) Info() TuneInfo {
+	return TuneInfo{Format: m.player.Song.Format.String(), Title: m.player.Song.Title}
+}
+
+// RowsBetween returns the rows starting after from and up to to, times
+// in the song. The song loops, so from after to wraps around its end.
+func (m *AHXPlayer) RowsBetween(from, to time.Duration) []mod.RowTime {
+	rows := m.rows
+	d := m.player.Duration()
+	if d <= 0 || len(rows) == 0 {
+		return nil
+	}
+	from, to = from%d, to%d
+	after := func(t time.Duration) int {
+		return sort.Search(len(rows), func(i int) bool { return rows[i].Time > t })
+	}
+	i, j := after(from), after(to)
+	if from <= to {
+		return rows[i:j]
+	}
+	return append(append([]mod.RowTime(nil), rows[i:]...), rows[:j]...)
+}
+
+// Close releases resources
+func (m *AHXPlayer) Close() error {
+	return nil
+}
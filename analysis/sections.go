@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// SectionOptions tunes the section boundary detection
+type SectionOptions struct {
+	Context time.Duration // Span compared on each side of a candidate
+	MinGap  time.Duration // Shortest section the detector will suggest
+	Max     int           // Maximum number of boundaries, 0 for no limit
+}
+
+// DefaultSectionOptions suits intros with sections of 8 seconds or more
+var DefaultSectionOptions = SectionOptions{
+	Context: 2 * time.Second,
+	MinGap:  8 * time.Second,
+	Max:     12,
+}
+
+// Sections detects significant changes in the tune, such as pattern
+// changes and drops, and returns them in chronological order. A change
+// is scored by how much the mean energy after a point differs from the
+// mean energy before it.
+func Sections(w *Waveform, opts SectionOptions) []time.Duration {
+	n := len(w.Energy)
+	span := int(opts.Context / w.Window)
+	gap := int(opts.MinGap / w.Window)
+	if span <= 0 || n <= 2*span {
+		return nil
+	}
+
+	// Prefix sums make each before/after mean O(1)
+	prefix := make([]float64, n+1)
+	for i, e := range w.Energy {
+		prefix[i+1] = prefix[i] + float64(e)
+	}
+	mean := func(from, to int) float64 {
+		return (prefix[to] - prefix[from]) / float64(to-from)
+	}
+
+	novelty := make([]float64, n)
+	var sum, sumSq float64
+	for i := span; i < n-span; i++ {
+		v := math.Abs(mean(i, i+span) - mean(i-span, i))
+		novelty[i] = v
+		sum += v
+		sumSq += v * v
+	}
+	count := float64(n - 2*span)
+	avg := sum / count
+	threshold := avg + math.Sqrt(math.Max(sumSq/count-avg*avg, 0))
+
+	// Candidates are local maxima above the threshold
+	type candidate struct {
+		index int
+		score float64
+	}
+	var candidates []candidate
+	for i := span; i < n-span; i++ {
+		v := novelty[i]
+		if v > threshold && v >= novelty[i-1] && v > novelty[i+1] {
+			candidates = append(candidates, candidate{i, v})
+		}
+	}
+
+	// Keep the strongest changes that are far enough from each other
+	sort.Slice(candidates, func(a, b int) bool {
+		return candidates[a].score > candidates[b].score
+	})
+	var picked []int
+	for _, c := range candidates {
+		if opts.Max > 0 && len(picked) >= opts.Max {
+			break
+		}
+		if c.index < gap || n-c.index < gap {
+			continue
+		}
+		near := false
+		for _, p := range picked {
+			if abs(p-c.index) < gap {
+				near = true
+				break
+			}
+		}
+		if !near {
+			picked = append(picked, c.index)
+		}
+	}
+	sort.Ints(picked)
+
+	bounds := make([]time.Duration, len(picked))
+	for i, p := range picked {
+		bounds[i] = time.Duration(p) * w.Window
+	}
+	return bounds
+}
+
+// abs returns the absolute value of v
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
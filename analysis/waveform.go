@@ -0,0 +1,211 @@
+// Package analysis decodes a tune offline to describe its overall shape,
+// for the timeline editor and the scene-change suggestions.
+package analysis
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/olivierh59500/ym-player/pkg/stsound"
+
+	"bilizir-demo/ahx"
+	"bilizir-demo/mod"
+	"bilizir-demo/sndh"
+)
+
+// DefaultWindow is the analysis resolution used by the demo
+const DefaultWindow = 20 * time.Millisecond
+
+// Waveform summarizes a tune, one entry per analysis window
+type Waveform struct {
+	Window time.Duration
+	Peaks  []float32 // Peak absolute amplitude, 0 to 1
+	Energy []float32 // RMS level, 0 to 1
+}
+
+// Duration returns the length of the analyzed audio
+func (w *Waveform) Duration() time.Duration {
+	return time.Duration(len(w.Peaks)) * w.Window
+}
+
+// At returns the index of the window containing t, clamped to the range
+func (w *Waveform) At(t time.Duration) int {
+	i := int(t / w.Window)
+	return min(max(i, 0), len(w.Peaks)-1)
+}
+
+// Decoder renders a tune as mono 16-bit samples
+type Decoder interface {
+	Compute(buf []int16, n int) bool
+}
+
+// Analyze decodes total samples from dec and measures each window
+func Analyze(dec Decoder, total int64, sampleRate int, window time.Duration) (*Waveform, error) {
+	windowSamples := int(int64(window) * int64(sampleRate) / int64(time.Second))
+	if total <= 0 || windowSamples <= 0 {
+		return nil, fmt.Errorf("tune has no measurable length")
+	}
+
+	w := &Waveform{Window: window}
+	buf := make([]int16, windowSamples)
+	for done := int64(0); done < total; done += int64(windowSamples) {
+		if !dec.Compute(buf, windowSamples) {
+			break
+		}
+
+		peak, sum := 0.0, 0.0
+		for _, s := range buf {
+			v := math.Abs(float64(s)) / 32768
+			peak = math.Max(peak, v)
+			sum += v * v
+		}
+		w.Peaks = append(w.Peaks, float32(peak))
+		w.Energy = append(w.Energy, float32(math.Sqrt(sum/float64(windowSamples))))
+	}
+	normalize(w.Peaks)
+	normalize(w.Energy)
+	return w, nil
+}
+
+// AnalyzeYM decodes a whole YM tune once and measures each window
+func AnalyzeYM(data []byte, sampleRate int, window time.Duration) (*Waveform, error) {
+	player := stsound.CreateWithRate(sampleRate)
+	defer player.Destroy()
+
+	if err := player.LoadMemory(data); err != nil {
+		return nil, fmt.Errorf("failed to load YM data: %w", err)
+	}
+	player.SetLoopMode(false)
+
+	total := int64(player.GetInfo().MusicTimeInMs) * int64(sampleRate) / 1000
+	return Analyze(player, total, sampleRate, window)
+}
+
+// AnalyzeSNDH decodes the first subtune of an SNDH tune once and measures
+// each window. The tune must declare its length in a TIME tag.
+func AnalyzeSNDH(data []byte, sampleRate int, window time.Duration) (*Waveform, error) {
+	player, err := sndh.NewPlayer(data, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SNDH data: %w", err)
+	}
+
+	d := player.Duration()
+	if d <= 0 {
+		return nil, fmt.Errorf("SNDH tune does not declare its length")
+	}
+	return Analyze(player, int64(d.Seconds()*float64(sampleRate)), sampleRate, window)
+}
+
+// AnalyzeMOD decodes one pass through a tracker module, MOD, S3M or XM,
+// and measures each window
+func AnalyzeMOD(data []byte, sampleRate int, window time.Duration) (*Waveform, error) {
+	player, err := mod.NewPlayer(data, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module: %w", err)
+	}
+	total := int64(player.Duration().Seconds() * float64(sampleRate))
+	return Analyze(player, total, sampleRate, window)
+}
+
+// AnalyzeAHX decodes one pass through an AHX or HVL song and measures
+// each window
+func AnalyzeAHX(data []byte, sampleRate int, window time.Duration) (*Waveform, error) {
+	player, err := ahx.NewPlayer(data, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AHX song: %w", err)
+	}
+	total := int64(player.Duration().Seconds() * float64(sampleRate))
+	return Analyze(player, total, sampleRate, window)
+}
+
+// AnalyzeTune detects the format of a tune, YM, SNDH, a tracker module or
+// an AHX song, and analyzes it
+func AnalyzeTune(data []byte, sampleRate int, window time.Duration) (*Waveform, error) {
+	if mod.Is(data) {
+		return AnalyzeMOD(data, sampleRate, window)
+	}
+	if ahx.Is(data) {
+		return AnalyzeAHX(data, sampleRate, window)
+	}
+	if sndh.Is(data) {
+		return AnalyzeSNDH(data, sampleRate, window)
+	}
+	return AnalyzeYM(data, sampleRate, window)
+}
+
+// normalize scales values so the largest one is 1
+func normalize(values []float32) {
+	var top float32
+	for _, v := range values {
+		top = max(top, v)
+	}
+	if top == 0 {
+		return
+	}
+	for i := range values {
+		values[i] /= top
+	}
+}
+
+// LoadOrAnalyze returns the waveform of a tune, reusing the copy cached
+// in cacheDir when the same tune was analyzed before. An empty cacheDir
+// disables the cache.
+func LoadOrAnalyze(data []byte, sampleRate int, window time.Duration, cacheDir string) (*Waveform, error) {
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%s-%d-%d.wave", hex.EncodeToString(sum[:8]), sampleRate, window.Milliseconds())
+	path := filepath.Join(cacheDir, name)
+
+	if cacheDir != "" {
+		if w, err := loadWaveform(path); err == nil {
+			return w, nil
+		}
+	}
+
+	w, err := AnalyzeTune(data, sampleRate, window)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cache is an optimization, failing to write it is not an error
+	if cacheDir != "" {
+		_ = saveWaveform(path, w)
+	}
+	return w, nil
+}
+
+// loadWaveform reads a cached waveform
+func loadWaveform(path string) (*Waveform, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	w := &Waveform{}
+	if err := gob.NewDecoder(f).Decode(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// saveWaveform writes a waveform to the cache
+func saveWaveform(path string, w *Waveform) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(f).Encode(w); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// audioFilter is a preset of the filter chain YM tunes go through before
+// the audio device: a high-pass that blocks the DC offset the chip output
+// carries, a low-pass, a bass boost and a reverb. The zero value leaves
+// the samples alone.
+type audioFilter struct {
+	HighPass float64 // Cutoff of the DC blocker in Hz, 0 for none
+	LowPass  float64 // Cutoff of the two-pole low-pass in Hz, 0 for none
+	Bass     float64 // Gain of the band below bassCutoff added back, 0 for none
+	Reverb   float64 // Level of the reverb mixed in, 0 for none
+}
+
+// audioFilters are the presets of -audio-filter
+var audioFilters = map[string]audioFilter{
+	// The chip as emulated, bright and square
+	"raw": {},
+	// The small speaker of the SC1224 monitor most STs played through:
+	// no deep bass, the highs rolled off, in a room
+	"st-speaker": {HighPass: 180, LowPass: 4500, Reverb: 0.12},
+	// A big hi-fi: the bass pushed up, the hiss of the square waves softened
+	"mega-bass": {HighPass: 20, LowPass: 12000, Bass: 1.5},
+}
+
+// ymFilter is the filter chain preset of YM tunes
+var ymFilter audioFilter
+
+// bassCutoff is the top of the band the bass boost raises, in Hz
+const bassCutoff = 150
+
+// reverbDelays are the delays of the comb filters of the reverb, in
+// milliseconds; the right channel uses slightly longer ones so the tail
+// spreads across the stereo field
+var reverbDelays = [4]float64{29.7, 37.1, 41.1, 43.7}
+
+// reverbSpread is how much longer the delays of the right channel are
+const reverbSpread = 1.023
+
+// reverbFeedback is how much of each comb filter feeds back, the length
+// of the tail
+const reverbFeedback = 0.7
+
+// audioFilterNames returns the names of the presets, for messages
+func audioFilterNames() string {
+	names := make([]string, 0, len(audioFilters))
+	for name := range audioFilters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// audioFilterPreset returns the preset of a name
+func audioFilterPreset(name string) (audioFilter, error) {
+	f, ok := audioFilters[name]
+	if !ok {
+		return audioFilter{}, fmt.Errorf("unknown audio filter %q, expected %s", name, audioFilterNames())
+	}
+	return f, nil
+}
+
+// filterChain runs a preset over interleaved stereo samples, keeping the
+// state of each channel from one buffer to the next
+type filterChain struct {
+	f        audioFilter
+	hp       float64 // Pole of the DC blocker
+	lp       float64 // Coefficient of each low-pass pole
+	bass     float64 // Coefficient of the bass band pole
+	channels [2]filterState
+}
+
+// filterState is the state of the filter chain for one channel
+type filterState struct {
+	hpIn, hpOut float64
+	lp1, lp2    float64
+	bass        float64
+	combs       [len(reverbDelays)]struct {
+		line []float64
+		pos  int
+	}
+}
+
+// newFilterChain sets up a preset at a sample rate, nil when the preset
+// leaves the samples alone
+func newFilterChain(f audioFilter, sampleRate int) *filterChain {
+	if f == (audioFilter{}) {
+		return nil
+	}
+	pole := func(cutoff float64) float64 {
+		return math.Exp(-2 * math.Pi * cutoff / float64(sampleRate))
+	}
+	c := &filterChain{f: f, hp: pole(f.HighPass), lp: 1 - pole(f.LowPass), bass: 1 - pole(bassCutoff)}
+	if f.Reverb > 0 {
+		for ch := range c.channels {
+			for i, d := range reverbDelays {
+				if ch == 1 {
+					d *= reverbSpread
+				}
+				c.channels[ch].combs[i].line = make([]float64, int(d*float64(sampleRate)/1000))
+			}
+		}
+	}
+	return c
+}
+
+// process filters interleaved stereo samples in place. The samples are
+// left unclipped, for the 16-bit output to clip them once at the end.
+func (c *filterChain) process(samples []float32) {
+	for i, v := range samples {
+		s := &c.channels[i&1]
+		x := float64(v)
+
+		if c.f.HighPass > 0 {
+			s.hpOut = x - s.hpIn + c.hp*s.hpOut
+			s.hpIn = x
+			x = s.hpOut
+		}
+		if c.f.Bass > 0 {
+			s.bass += c.bass * (x - s.bass)
+			x += c.f.Bass * s.bass
+		}
+		if c.f.LowPass > 0 {
+			s.lp1 += c.lp * (x - s.lp1)
+			s.lp2 += c.lp * (s.lp1 - s.lp2)
+			x = s.lp2
+		}
+		if c.f.Reverb > 0 {
+			var wet float64
+			for j := range s.combs {
+				comb := &s.combs[j]
+				out := comb.line[comb.pos]
+				comb.line[comb.pos] = x + out*reverbFeedback
+				comb.pos = (comb.pos + 1) % len(comb.line)
+				wet += out
+			}
+			x += c.f.Reverb * wet / float64(len(s.combs))
+		}
+		samples[i] = float32(x)
+	}
+}
+
+// clampSample rounds a sample to 16 bits, clipping it
+func clampSample(v float64) int16 {
+	return int16(min(max(math.Round(v), -32768), 32767))
+}
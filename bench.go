@@ -0,0 +1,84 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Frames skipped, then timed, for each cube path in the benchmark
+const (
+	benchWarmup = 60
+	benchFrames = 300
+)
+
+// cubeBench times the per-face and batched cube paths against each
+// other with many cubes on screen, for the -bench-cubes flag. Frames are
+// not synchronized with the display, so the frame time is the cost of
+// the path, GPU included.
+type cubeBench struct {
+	count  int
+	path   int // 0 per face, 1 batched
+	frames int
+	start  time.Time
+	inDraw time.Duration // CPU time spent in Cubes.Draw
+	done   bool
+}
+
+var benchPaths = [2]string{"per face", "batched"}
+
+// startCubeBench switches the game to benchmarking count cubes
+func (g *Game) startCubeBench(count int) {
+	g.bench = &cubeBench{count: count}
+	if err := g.params.Set("cubes.count", float64(count)); err != nil {
+		log.Fatal(err)
+	}
+	ebiten.SetVsyncEnabled(false)
+}
+
+// update advances the cubes; it returns ebiten.Termination once both
+// paths are measured
+func (b *cubeBench) update(g *Game) error {
+	if b.done {
+		return ebiten.Termination
+	}
+	g.cubes.Update(vblSeconds)
+	return nil
+}
+
+// draw renders the cubes alone with the path being measured
+func (b *cubeBench) draw(g *Game, screen *ebiten.Image) {
+	if b.done {
+		return
+	}
+	g.cubes.PerFace = b.path == 0
+	screen.Fill(color.Black)
+
+	t := time.Now()
+	g.cubes.Draw(screen)
+	if b.frames >= benchWarmup {
+		b.inDraw += time.Since(t)
+	}
+
+	b.frames++
+	switch b.frames {
+	case benchWarmup:
+		b.start = time.Now()
+	case benchWarmup + benchFrames:
+		elapsed := time.Since(b.start)
+		log.Printf("%d cubes, %s: %.2f ms/frame, %.2f ms in Draw",
+			b.count, benchPaths[b.path],
+			msPerFrame(elapsed), msPerFrame(b.inDraw))
+		b.path++
+		b.frames = 0
+		b.inDraw = 0
+		b.done = b.path == len(benchPaths)
+	}
+}
+
+// msPerFrame returns the average milliseconds per benchmark frame
+func msPerFrame(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond) / benchFrames
+}
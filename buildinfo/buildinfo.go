@@ -0,0 +1,85 @@
+// Package buildinfo identifies the exact build of the demo, so bug
+// reports can reference it.
+//
+// The values can be stamped at link time:
+//
+//	go build -ldflags "-X bilizir-demo/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	    -X bilizir-demo/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without ldflags, the VCS information recorded by the Go toolchain is
+// used when available.
+package buildinfo
+
+import (
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Set with -ldflags "-X"; empty values fall back to the Go build info
+var (
+	Commit  string
+	Date    string
+	Version = "dev"
+)
+
+// Info describes a build
+type Info struct {
+	Version string
+	Commit  string // Short commit hash, "unknown" when not recorded
+	Date    string // Build or commit date, empty when not recorded
+	Dirty   bool   // Built from a modified working tree
+}
+
+// Get returns the information for the running binary
+func Get() Info {
+	return get()
+}
+
+// get computes the build information once
+var get = sync.OnceValue(func() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				info.Dirty = s.Value == "true"
+			}
+		}
+	}
+
+	if len(info.Commit) > 7 {
+		info.Commit = info.Commit[:7]
+	}
+	if info.Commit == "" {
+		info.Commit = "unknown"
+	}
+	return info
+})
+
+// Short returns a compact identifier such as "dev-1a2b3c4+dirty"
+func (i Info) Short() string {
+	s := i.Version + "-" + i.Commit
+	if i.Dirty {
+		s += "+dirty"
+	}
+	return s
+}
+
+// String returns the full description including the date
+func (i Info) String() string {
+	parts := []string{i.Short()}
+	if i.Date != "" {
+		parts = append(parts, i.Date)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/binary"
+	"image/color"
+	"log"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"bilizir-demo/sysfont"
+)
+
+// Latency calibration: a metronome blips calibrationBeat apart and the
+// viewer taps along. The median delay from the blips to the taps is the
+// audio output latency, which the scene clock is delayed by.
+const (
+	calibrationBeat = 700 * time.Millisecond
+	calibrationTaps = 8
+
+	// Taps further than this from a blip are ignored; a little early is
+	// accepted, as people anticipate the beat
+	maxLatency   = 400 * time.Millisecond
+	maxEarlyTap  = 100 * time.Millisecond
+	blipDuration = 40 * time.Millisecond
+	blipPitch    = 1000 // Hz
+)
+
+// Calibration is the latency calibration screen
+type Calibration struct {
+	blip     *audio.Player
+	lastBlip time.Time // When the last blip was started
+	nextBlip time.Time
+	delays   []time.Duration
+}
+
+// newCalibration prepares the metronome blip
+func newCalibration(ctx *audio.Context) *Calibration {
+	return &Calibration{
+		blip:     ctx.NewPlayerFromBytes(blipSamples(ctx.SampleRate())),
+		nextBlip: time.Now().Add(calibrationBeat),
+	}
+}
+
+// blipSamples renders a short decaying sine as 16-bit stereo PCM
+func blipSamples(rate int) []byte {
+	n := int(blipDuration.Seconds() * float64(rate))
+	buf := make([]byte, 4*n)
+	for i := range n {
+		t := float64(i) / float64(rate)
+		env := math.Exp(-t / blipDuration.Seconds() * 5)
+		v := int16(math.Sin(2*math.Pi*blipPitch*t) * env * 0.6 * math.MaxInt16)
+		binary.LittleEndian.PutUint16(buf[4*i:], uint16(v))
+		binary.LittleEndian.PutUint16(buf[4*i+2:], uint16(v))
+	}
+	return buf
+}
+
+// Update plays the metronome and records the taps. It returns the
+// measured latency and true once enough taps are in.
+func (c *Calibration) Update() (time.Duration, bool) {
+	now := time.Now()
+	if !now.Before(c.nextBlip) {
+		if err := c.blip.Rewind(); err == nil {
+			c.blip.Play()
+		}
+		c.lastBlip = now
+		c.nextBlip = now.Add(calibrationBeat)
+	}
+
+	enter := inpututil.IsKeyJustPressed(ebiten.KeyEnter) && !ebiten.IsKeyPressed(ebiten.KeyAlt) // Alt+Enter is fullscreen
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) || enter {
+		// Match the tap with the blip it follows, or the one coming
+		delay := now.Sub(c.lastBlip)
+		if early := now.Sub(c.nextBlip); -early < maxEarlyTap {
+			delay = early
+		}
+		if !c.lastBlip.IsZero() && delay > -maxEarlyTap && delay < maxLatency {
+			c.delays = append(c.delays, delay)
+		}
+	}
+	if len(c.delays) < calibrationTaps {
+		return 0, false
+	}
+
+	slices.Sort(c.delays)
+	return max(c.delays[len(c.delays)/2], 0), true
+}
+
+// Close releases the blip player
+func (c *Calibration) Close() {
+	c.blip.Close()
+}
+
+// Draw shows the instructions; nothing flashes with the blips, so the
+// taps follow the sound alone
+func (c *Calibration) Draw(screen *ebiten.Image) {
+	screen.Fill(color.Black)
+	x, y := screen.Bounds().Dx()/2, screen.Bounds().Dy()/2-30
+	centered := sysfont.Style{Align: sysfont.Center}
+	sysfont.Print(screen, "AUDIO LATENCY CALIBRATION", x, y-10, sysfont.Style{Align: sysfont.Center, Scale: 2})
+	sysfont.Printf(screen, x, y+20, centered, "Press SPACE on each blip you hear (%d/%d)", len(c.delays), calibrationTaps)
+	sysfont.Print(screen, "Esc to skip, C to calibrate again later", x, y+40, centered)
+}
+
+// startCalibration pauses the demo and opens the calibration screen
+func (g *Game) startCalibration() {
+	if g.audioContext == nil || g.calibration != nil {
+		return
+	}
+	if g.music != nil {
+		g.music.Pause()
+	}
+	g.calibration = newCalibration(g.audioContext)
+}
+
+// updateCalibration runs the calibration screen, and applies and saves
+// the latency once measured
+func (g *Game) updateCalibration() {
+	latency, done := g.calibration.Update()
+	skipped := inpututil.IsKeyJustPressed(ebiten.KeyEscape)
+	if !done && !skipped {
+		return
+	}
+
+	g.calibration.Close()
+	g.calibration = nil
+	g.calibrated = true
+	if g.music != nil && !g.paused {
+		g.music.Resume()
+	}
+	if done {
+		g.latency = latency
+		log.Printf("Audio latency: %d ms", latency.Milliseconds())
+	}
+	if err := saveSettings(g.currentSettings()); err != nil {
+		log.Printf("Failed to save settings: %v", err)
+	}
+}
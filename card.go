@@ -0,0 +1,138 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"image"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"bilizir-demo/buildinfo"
+	"bilizir-demo/record"
+)
+
+//go:embed templates/card.html
+var cardTemplate string
+
+// cardFPS is the frame rate of demo card clips: GIF delays count in
+// hundredths of a second, so every frame lasts the same at 25 fps
+const cardFPS = 25
+
+// cardClip is the name of the clip next to the page of a demo card
+const cardClip = "card.gif"
+
+// demoCard writes a demo card for the -card flag: a web page presenting
+// the demo with a looping GIF of a segment of it, its title, its group
+// and the credits of the tune, to post a release with. The page and the
+// clip make a folder that needs nothing else.
+type demoCard struct {
+	title string
+	group string
+
+	dir  string
+	from time.Duration
+	tune TuneInfo
+	clip record.GIF
+	size image.Point
+}
+
+// cardPage is what the page template of a demo card is filled with
+type cardPage struct {
+	Title, Group  string
+	Tune          TuneInfo
+	Summary       string
+	Clip          string
+	Width, Height int
+	Seconds       string
+	From          string
+	Version       string
+	Date          string
+}
+
+// begin notes where the clip starts and the tune it plays
+func (c *demoCard) begin(e *videoExport, g *Game) error {
+	c.dir = e.dir
+	c.from = time.Duration(e.skip) * time.Second / time.Duration(e.fps)
+	if g.music != nil {
+		c.tune = g.music.Info()
+	}
+	return nil
+}
+
+// audio leaves the tune out: GIFs are silent
+func (c *demoCard) audio(p []byte) error {
+	return nil
+}
+
+// frame adds a frame to the clip
+func (c *demoCard) frame(n int, img *image.RGBA) error {
+	c.clip.Add(img, 100/cardFPS)
+	c.size = img.Bounds().Size()
+	return nil
+}
+
+// finish writes the clip and the page
+func (c *demoCard) finish(e *videoExport) error {
+	if err := writeGIF(filepath.Join(c.dir, cardClip), &c.clip); err != nil {
+		return err
+	}
+	page := cardPage{
+		Title:   c.title,
+		Group:   c.group,
+		Tune:    c.tune,
+		Summary: c.summary(),
+		Clip:    cardClip,
+		Width:   c.size.X,
+		Height:  c.size.Y,
+		Seconds: fmt.Sprintf("%.1f", float64(e.drawn-e.skip)/float64(e.fps)),
+		From:    formatDuration(c.from),
+		Version: buildinfo.Get().Short(),
+		Date:    time.Now().Format("2006-01-02"),
+	}
+	tmpl, err := template.New("card").Parse(cardTemplate)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(c.dir, "index.html")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(f, page); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Demo card written to %s in %s", path, time.Since(e.start).Round(time.Second))
+	return nil
+}
+
+// summary describes the demo and its tune in a line, for link previews
+func (c *demoCard) summary() string {
+	s := c.title
+	if c.group != "" {
+		s += " by " + c.group
+	}
+	var music []string
+	if c.tune.Title != "" {
+		music = append(music, c.tune.Title)
+	}
+	if c.tune.Author != "" {
+		music = append(music, "by "+c.tune.Author)
+	}
+	if len(music) > 0 {
+		s += ", music: " + strings.Join(music, " ")
+	}
+	return s
+}
+
+// formatDuration formats a time into the demo as minutes and seconds
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	// clockSlew is the fraction of its drift from the audio the demo
+	// clock corrects at each reading, smoothing over the chunks the audio
+	// device reads the tune in
+	clockSlew = 0.1
+
+	// clockSnap is the largest drift slewed away; the clock jumps to the
+	// audio beyond it, as after a seek or when the audio starts late
+	clockSnap = 250 * time.Millisecond
+)
+
+// demoClock is the master clock of the demo timeline. While the tune
+// plays it follows the audio position, so the visuals cannot drift from
+// the music however long the demo runs. Without audio, while it is
+// stalled or before the browser lets it start, the clock carries on from
+// where the tune was on the monotonic wall clock.
+type demoClock struct {
+	scene   time.Duration // Position on the demo script timeline
+	elapsed time.Duration // Running time, which never jumps back, for animations and PAL ticks
+	wall    time.Time     // When the clock was last read, zero when held
+	audio   bool          // Whether the last reading followed the audio
+}
+
+// advance reads the clock at now. heard is the audio position heard, when
+// live; length is the length of the looping tune, 0 without one.
+func (c *demoClock) advance(now time.Time, heard time.Duration, live bool, length time.Duration) {
+	var step time.Duration
+	if !c.wall.IsZero() {
+		step = max(now.Sub(c.wall), 0)
+	}
+	c.wall = now
+	scene := c.scene + step
+
+	if live {
+		drift := heard - scene
+		if length > 0 {
+			// The shortest way around the loop
+			drift = wrapDuration(drift+length/2, length) - length/2
+		}
+		if !c.audio || drift.Abs() > clockSnap {
+			scene = heard
+		} else {
+			correction := time.Duration(float64(drift) * clockSlew)
+			scene += correction
+			step = max(step+correction, 0)
+		}
+	}
+	c.audio = live
+	c.elapsed += step
+
+	if length > 0 {
+		scene = wrapDuration(scene, length)
+	}
+	c.scene = scene
+}
+
+// hold stops the clock until the next reading, so a pause or a hidden
+// page is not caught up on
+func (c *demoClock) hold() {
+	c.wall = time.Time{}
+}
+
+// seek jumps the timeline to t
+func (c *demoClock) seek(t time.Duration) {
+	c.scene = t
+}
+
+// wrapDuration keeps d within [0, length)
+func wrapDuration(d, length time.Duration) time.Duration {
+	d %= length
+	if d < 0 {
+		d += length
+	}
+	return d
+}
+
+// audioLive reports whether the audio position can drive the clock: the
+// tune is playing and the audio device is reading it
+func (g *Game) audioLive() bool {
+	if g.music == nil || g.audioPlayer == nil || g.music.Paused() || !g.audioPlayer.IsPlaying() {
+		return false
+	}
+	last := g.music.LastRead()
+	return !last.IsZero() && time.Since(last) < audioStallTimeout
+}
+
+// heardPosition returns the position in the tune heard: the decoded
+// position less the audio output latency
+func (g *Game) heardPosition() time.Duration {
+	t := g.musicPosition() - g.latency
+	if t < 0 {
+		// Still hearing the end of the tune before it looped
+		t = max(t+g.musicLength(), 0)
+	}
+	return t
+}
+
+// updateClock reads the demo clock; it is called once per running update
+func (g *Game) updateClock() {
+	g.clock.advance(time.Now(), g.heardPosition(), g.audioLive(), g.musicLength())
+}
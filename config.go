@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"bilizir-demo/effects"
+)
+
+// defaultConfigPath is the configuration file read when present
+const defaultConfigPath = "bilizir.toml"
+
+// demoConfig re-skins the intro without recompiling: the message, the
+// music, the fonts, the speeds, the volume, the effect parameters and the
+// colors. It is read from bilizir.toml, or the file given with -config,
+// in TOML or, when its name ends in .json, JSON:
+//
+//	music = "tunes/mytune.sndh"
+//	message = "HELLO FROM THE CONFIG FILE...   "
+//	fallback_fonts = ["fonts/NotoSansJP-Bold.otf"]
+//	scroller = "sine"
+//	volume = 0.7
+//	stereo = "abc"
+//	stereo_width = 0.5
+//	audio_filter = "st-speaker"
+//	speed = 1.2
+//	endless = true
+//	safe_area = 5
+//
+//	[params]
+//	scroll.speed = 6
+//	copper.speed1 = 5
+//
+//	[colors]
+//	copper = "ste"
+//	scroller = "#ffd060"
+//	sky = ["#081040", "#6030a0", "#f07040", "#ffd060"]
+//
+// Paths are relative to the file. The command line flags win over it.
+type demoConfig struct {
+	Music      string         `json:"music"`          // Tune file, YM, SNDH, MOD, S3M, XM, AHX or HVL
+	Scrolltext string         `json:"scrolltext"`     // File or http(s) URL of the scroll message
+	Message    string         `json:"message"`        // Scroll message, without a scrolltext
+	Fonts      []string       `json:"fonts"`          // Font descriptors of ^F2 and on
+	Fallback   []string       `json:"fallback_fonts"` // TrueType or OpenType fonts for the characters the fonts lack
+	Scroller   string         `json:"scroller"`       // Scroller style of the scenes naming none
+	Volume     *float64       `json:"volume"`         // Starting volume, 0 to 1
+	Stereo     string         `json:"stereo"`         // Placement of the YM voices, abc, acb or mono, like -stereo
+	StereoWide *float64       `json:"stereo_width"`   // How far the side YM voices are panned, 0 to 1, like -stereo-width
+	Filter     string         `json:"audio_filter"`   // Filter chain of YM tunes, raw, st-speaker or mega-bass, like -audio-filter
+	Speed      float64        `json:"speed"`          // Animation speed, 0.5 to 2
+	Endless    bool           `json:"endless"`        // Endless mode after the demo script, like -endless
+	SafeArea   float64        `json:"safe_area"`      // Percentage of each side kept clear for overscan, like -safe-area
+	Params     map[string]any `json:"params"`         // Effect parameters, nested at the dots
+	Colors     configColors   `json:"colors"`
+}
+
+// configColors are the colors of a demoConfig
+type configColors struct {
+	Copper   string   `json:"copper"`   // image, st, ste or full, as -copper-colors
+	Scroller string   `json:"scroller"` // #rrggbb tint of the scrolltext
+	Sky      []string `json:"sky"`      // #rrggbb stops of the sky behind the "rasters" scene
+}
+
+// loadConfig reads the configuration file at path. A missing file is
+// no configuration, unless it was asked for; so is a file system that
+// cannot be read, as in the browser, where reading fails with ENOSYS.
+func loadConfig(path string, required bool) (*demoConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && (errors.Is(err, fs.ErrNotExist) || errors.Is(err, errors.ErrUnsupported)) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		table, err := parseTOML(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(table); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	c := &demoConfig{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Paths are relative to the file
+	dir := filepath.Dir(path)
+	relative := func(p *string) {
+		if *p != "" && !filepath.IsAbs(*p) && !strings.Contains(*p, "://") {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	relative(&c.Music)
+	relative(&c.Scrolltext)
+	for i := range c.Fonts {
+		relative(&c.Fonts[i])
+	}
+	for i := range c.Fallback {
+		relative(&c.Fallback[i])
+	}
+	return c, nil
+}
+
+// fillFlags gives the flags not set on the command line their value from
+// the configuration
+func (c *demoConfig) fillFlags(set map[string]bool, music, scrolltext, fonts, fallbackFonts, copperColors, stereo, audioFilter *string) {
+	fill := func(name string, flag *string, value string) {
+		if value != "" && !set[name] {
+			*flag = value
+		}
+	}
+	fill("music", music, c.Music)
+	fill("scrolltext", scrolltext, c.Scrolltext)
+	fill("fonts", fonts, strings.Join(c.Fonts, ","))
+	fill("fallback-fonts", fallbackFonts, strings.Join(c.Fallback, ","))
+	fill("copper-colors", copperColors, c.Colors.Copper)
+	fill("stereo", stereo, c.Stereo)
+	fill("audio-filter", audioFilter, c.Filter)
+}
+
+// apply sets up the game with the rest of the configuration, before the
+// scrolltext is loaded
+func (c *demoConfig) apply(g *Game) error {
+	if c.Scroller != "" {
+		g.scroller.SelectScroller(c.Scroller)
+	}
+	if c.Volume != nil {
+		v := min(max(*c.Volume, 0), 1)
+		g.launch.volume = &v
+	}
+	if c.Speed != 0 {
+		g.speedMultiplier = min(max(c.Speed, 0.5), 2)
+	}
+	if c.Endless && g.filler == nil {
+		g.filler = NewScreenFiller()
+	}
+	if c.SafeArea < 0 || c.SafeArea > maxSafeInset*100 {
+		return fmt.Errorf("safe_area must be between 0 and %.0f", maxSafeInset*100)
+	}
+	g.safeInset = c.SafeArea / 100
+
+	params := map[string]float64{}
+	if err := flattenParams("", c.Params, params); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.params.Set(name, params[name]); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Colors.Sky) > 0 {
+		stops := make([]color.RGBA, len(c.Colors.Sky))
+		for i, s := range c.Colors.Sky {
+			var err error
+			if stops[i], err = parseHexColor(s); err != nil {
+				return fmt.Errorf("sky color: %w", err)
+			}
+		}
+		g.rasters.Register("sky", effects.SkyGradient(stops...))
+	}
+	if c.Colors.Scroller != "" {
+		if _, err := parseHexColor(c.Colors.Scroller); err != nil {
+			return fmt.Errorf("scroller color: %w", err)
+		}
+		// The color control code tints the message from its start
+		g.scrolltext.prefix = "{color:" + c.Colors.Scroller + "}"
+	}
+	message := c.Message
+	if message == "" && g.scrolltext.prefix != "" {
+		message = effects.DefaultMessage
+	}
+	if message != "" {
+		g.scroller.Text = g.scrolltext.prefix + message
+	}
+	return nil
+}
+
+// flattenParams collects the parameters of a table nested at the dots of
+// their names, as TOML reads "scroll.speed = 6", under their full names
+func flattenParams(prefix string, table map[string]any, params map[string]float64) error {
+	for key, v := range table {
+		name := prefix + key
+		switch v := v.(type) {
+		case float64:
+			params[name] = v
+		case map[string]any:
+			if err := flattenParams(name+".", v, params); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("parameter %s is not a number", name)
+		}
+	}
+	return nil
+}
+
+// parseHexColor reads a #rrggbb color
+func parseHexColor(s string) (color.RGBA, error) {
+	rgb, err := strconv.ParseUint(strings.TrimPrefix(s, "#"), 16, 32)
+	if !strings.HasPrefix(s, "#") || len(s) != 7 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	return color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 0xff}, nil
+}
+
+// parseTOML reads the subset of TOML configuration files are written in:
+// tables, bare, quoted and dotted keys, and strings, numbers, booleans
+// and arrays of them, each on one line, with comments. Numbers are read
+// as float64, like JSON numbers.
+func parseTOML(data []byte) (map[string]any, error) {
+	root := map[string]any{}
+	table := root
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: arrays of tables are not supported", n+1)
+			}
+			end := strings.IndexByte(line, ']')
+			if end < 0 || !isTOMLComment(line[end+1:]) {
+				return nil, fmt.Errorf("line %d: expected \"[table]\"", n+1)
+			}
+			keys, err := parseTOMLKey(line[1:end])
+			if err == nil {
+				table, err = tomlTable(root, keys)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+			continue
+		}
+
+		keys, rest, err := parseTOMLAssignment(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		value, rest, err := parseTOMLValue(rest)
+		if err == nil && !isTOMLComment(rest) {
+			err = fmt.Errorf("unexpected %q after the value", strings.TrimSpace(rest))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		t, err := tomlTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		key := keys[len(keys)-1]
+		if _, ok := t[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", n+1, key)
+		}
+		t[key] = value
+	}
+	return root, nil
+}
+
+// isTOMLComment reports whether s is blank or a comment
+func isTOMLComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// tomlTable returns the table at the keys under root, creating it
+func tomlTable(root map[string]any, keys []string) (map[string]any, error) {
+	t := root
+	for _, k := range keys {
+		switch v := t[k].(type) {
+		case nil:
+			sub := map[string]any{}
+			t[k] = sub
+			t = sub
+		case map[string]any:
+			t = v
+		default:
+			return nil, fmt.Errorf("%s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+// parseTOMLAssignment splits "key = value" into the parts of the key and
+// the text of the value
+func parseTOMLAssignment(line string) ([]string, string, error) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			keys, err := parseTOMLKey(line[:i])
+			return keys, line[i+1:], err
+		}
+	}
+	return nil, "", errors.New("expected \"key = value\"")
+}
+
+// parseTOMLKey splits a key at its dots into bare or quoted parts
+func parseTOMLKey(s string) ([]string, error) {
+	var keys []string
+	for {
+		s = strings.TrimSpace(s)
+		var key string
+		switch {
+		case s == "":
+			return nil, errors.New("missing key")
+		case s[0] == '"' || s[0] == '\'':
+			v, rest, err := parseTOMLString(s)
+			if err != nil {
+				return nil, err
+			}
+			key, s = v, rest
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+			})
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid key %q", s)
+			}
+			key, s = s[:end], s[end:]
+		}
+		keys = append(keys, key)
+
+		s = strings.TrimSpace(s)
+		if s == "" {
+			return keys, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key near %q", s)
+		}
+		s = s[1:]
+	}
+}
+
+// parseTOMLValue reads the value at the start of s and returns it with
+// the text after it
+func parseTOMLValue(s string) (any, string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "":
+		return nil, "", errors.New("missing value")
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return nil, "", errors.New("multi-line strings are not supported")
+	case s[0] == '"' || s[0] == '\'':
+		return parseTOMLString(s)
+	case s[0] == '[':
+		var values []any
+		s = s[1:]
+		for {
+			s = strings.TrimSpace(s)
+			if strings.HasPrefix(s, "]") {
+				return values, s[1:], nil
+			}
+			v, rest, err := parseTOMLValue(s)
+			if err != nil {
+				return nil, "", err
+			}
+			values = append(values, v)
+			s = strings.TrimSpace(rest)
+			switch {
+			case strings.HasPrefix(s, ","):
+				s = s[1:]
+			case !strings.HasPrefix(s, "]"):
+				return nil, "", errors.New("expected \",\" or \"]\" in the array")
+			}
+		}
+	}
+
+	end := strings.IndexAny(s, " \t,]#")
+	if end < 0 {
+		end = len(s)
+	}
+	word, rest := s[:end], s[end:]
+	switch word {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	v, err := strconv.ParseFloat(strings.ReplaceAll(word, "_", ""), 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid value %q", word)
+	}
+	return v, rest, nil
+}
+
+// parseTOMLString reads the basic ("...", with escapes) or literal
+// ('...') string at the start of s and returns it with the text after it
+func parseTOMLString(s string) (string, string, error) {
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", errors.New("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return v, s[i+1:], nil
+		}
+	}
+	return "", "", errors.New("unterminated string")
+}
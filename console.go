@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"strings"
+
+	"bilizir-demo/buildinfo"
+	"bilizir-demo/sysfont"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// TweakConsole is the dev overlay for adjusting demo parameters.
+// Up/Down select a parameter, Left/Right change it, Ctrl+Z undoes and
+// Ctrl+Y (or Ctrl+Shift+Z) redoes; the history is shared with the
+// timeline editor.
+type TweakConsole struct {
+	open     bool
+	selected int
+	status   string
+}
+
+// Update handles console input; it does nothing while the console is closed
+func (c *TweakConsole) Update(g *Game) {
+	if !c.open {
+		return
+	}
+
+	list := g.params.List()
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		c.selected = (c.selected + len(list) - 1) % len(list)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		c.selected = (c.selected + 1) % len(list)
+	}
+
+	p := list[c.selected]
+	step := 0.0
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		step = p.Step
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		step = -p.Step
+	}
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		step *= 10
+	}
+	if step != 0 {
+		to := p.clamp(p.Value + step)
+		if to != p.Value {
+			g.history.Run(&setParamCommand{params: g.params, name: p.Name, from: p.Value, to: to})
+			c.status = ""
+		}
+	}
+
+}
+
+// handleHistoryKeys undoes or redoes dev tool edits on Ctrl+Z / Ctrl+Y
+func (g *Game) handleHistoryKeys() {
+	if !ctrlPressed() {
+		return
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyZ) && !ebiten.IsKeyPressed(ebiten.KeyShift) {
+		if cmd, ok := g.history.Undo(); ok {
+			g.console.status = "undo " + cmd.Describe()
+		}
+	} else if inpututil.IsKeyJustPressed(ebiten.KeyY) || inpututil.IsKeyJustPressed(ebiten.KeyZ) {
+		if cmd, ok := g.history.Redo(); ok {
+			g.console.status = "redo " + cmd.Describe()
+		}
+	}
+}
+
+// ctrlPressed reports whether a Control (or macOS Command) key is held
+func ctrlPressed() bool {
+	return ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+}
+
+// Draw renders the parameter list over the frame
+func (c *TweakConsole) Draw(screen *ebiten.Image, params *Params) {
+	if !c.open {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("TWEAK CONSOLE  (Ctrl+Z undo, Ctrl+Y redo)\n")
+	b.WriteString("build " + buildinfo.Get().String() + "\n\n")
+	for i, p := range params.List() {
+		cursor := "  "
+		if i == c.selected {
+			cursor = "> "
+		}
+		fmt.Fprintf(&b, "%s%-18s %8.3f\n", cursor, p.Name, p.Value)
+	}
+	if c.status != "" {
+		fmt.Fprintf(&b, "\n%s\n", c.status)
+	}
+
+	w, h := sysfont.Measure(b.String(), sysfont.Style{})
+	vector.DrawFilledRect(screen, 4, 4, float32(w+12), float32(h+12), color.RGBA{0, 0, 0, 0xc0}, false)
+	sysfont.Print(screen, b.String(), 10, 10, sysfont.Style{})
+}
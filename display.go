@@ -0,0 +1,127 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"bilizir-demo/sysfont"
+)
+
+//go:embed shaders/display.kage
+var displayShaderSrc []byte
+
+// displayNoteTime is how long the settings stay on screen after a change
+const displayNoteTime = 2 * time.Second
+
+// DisplaySettings adjust the output for the screen or projector the demo
+// runs on, where the dark copper gradients can be hard to see
+type DisplaySettings struct {
+	Gamma      float64 `json:"gamma"`      // 1 is neutral, higher lifts dark tones
+	Brightness float64 `json:"brightness"` // Offset added to each channel
+	Contrast   float64 `json:"contrast"`   // Scale around mid grey
+}
+
+// defaultDisplay leaves the output untouched
+var defaultDisplay = DisplaySettings{Gamma: 1, Brightness: 0, Contrast: 1}
+
+// clamp limits the settings to usable ranges
+func (d DisplaySettings) clamp() DisplaySettings {
+	d.Gamma = min(max(d.Gamma, 0.5), 2.5)
+	d.Brightness = min(max(d.Brightness, -0.5), 0.5)
+	d.Contrast = min(max(d.Contrast, 0.5), 2)
+	return d
+}
+
+// String returns the settings as shown on screen
+func (d DisplaySettings) String() string {
+	return fmt.Sprintf("Gamma %.2f  Brightness %+.2f  Contrast %.2f", d.Gamma, d.Brightness, d.Contrast)
+}
+
+// loadDisplaySettings reads the saved settings, the defaults when there
+// are none
+func loadDisplaySettings() DisplaySettings {
+	d := defaultDisplay
+	if err := loadJSON("display.json", &d); err != nil {
+		return defaultDisplay
+	}
+	return d.clamp()
+}
+
+// saveDisplaySettings writes the settings to the user config directory
+func saveDisplaySettings(d DisplaySettings) error {
+	return saveJSON("display.json", d)
+}
+
+// initDisplayPass registers the display adjustment pass, last on the post
+// chain so it applies to the final frame
+func (g *Game) initDisplayPass() error {
+	pass, err := g.post.Add("display", displayShaderSrc, func() map[string]any {
+		return map[string]any{
+			"Gamma":      float32(g.display.Gamma),
+			"Brightness": float32(g.display.Brightness),
+			"Contrast":   float32(g.display.Contrast),
+		}
+	})
+	if err != nil {
+		return err
+	}
+	g.displayPass = pass
+	g.displayPass.Enabled = g.display != defaultDisplay
+	return nil
+}
+
+// setDisplay applies new display settings, shows them and saves them
+func (g *Game) setDisplay(d DisplaySettings) {
+	g.display = d.clamp()
+	if g.displayPass != nil {
+		g.displayPass.Enabled = g.display != defaultDisplay
+	}
+	g.displayNoteUntil = time.Now().Add(displayNoteTime)
+
+	if err := saveDisplaySettings(g.display); err != nil {
+		g.displayNote = "not saved: " + err.Error()
+		return
+	}
+	g.displayNote = ""
+}
+
+// handleDisplayKeys adjusts the display settings: [ ] brightness,
+// ; ' contrast, , . gamma, \ resets
+func (g *Game) handleDisplayKeys() {
+	d := g.display
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyBracketLeft):
+		d.Brightness -= 0.02
+	case inpututil.IsKeyJustPressed(ebiten.KeyBracketRight):
+		d.Brightness += 0.02
+	case inpututil.IsKeyJustPressed(ebiten.KeySemicolon):
+		d.Contrast -= 0.05
+	case inpututil.IsKeyJustPressed(ebiten.KeyQuote):
+		d.Contrast += 0.05
+	case inpututil.IsKeyJustPressed(ebiten.KeyComma):
+		d.Gamma -= 0.05
+	case inpututil.IsKeyJustPressed(ebiten.KeyPeriod):
+		d.Gamma += 0.05
+	case inpututil.IsKeyJustPressed(ebiten.KeyBackslash):
+		d = defaultDisplay
+	default:
+		return
+	}
+	g.setDisplay(d)
+}
+
+// drawDisplayNote shows the display settings for a moment after a change
+func (g *Game) drawDisplayNote(screen *ebiten.Image) {
+	if time.Now().After(g.displayNoteUntil) {
+		return
+	}
+	msg := g.display.String()
+	if g.displayNote != "" {
+		msg += " (" + g.displayNote + ")"
+	}
+	sysfont.Print(screen, msg, 8, screen.Bounds().Dy()-48, sysfont.Style{})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// toastShown is how long a toast stays up, and toastFade how long it
+	// takes to fade out
+	toastShown = 4 * time.Second
+	toastFade  = 400 * time.Millisecond
+)
+
+// toast is a short message in the top left corner, fading out by
+// itself
+type toast struct {
+	text string
+	from time.Time
+}
+
+// showToast brings up a toast, replacing the one up
+func (g *Game) showToast(format string, args ...any) {
+	g.toast = toast{text: fmt.Sprintf(format, args...), from: time.Now()}
+}
+
+// drawToast draws the toast up, if any
+func (g *Game) drawToast(screen *ebiten.Image) {
+	t := &g.toast
+	if t.text == "" {
+		return
+	}
+	left := toastShown - time.Since(t.from)
+	if left <= 0 {
+		t.text = ""
+		return
+	}
+	lines := []string{t.text}
+	safe := safeRect(screen.Bounds().Size(), g.safeInset)
+	alpha := left.Seconds() / toastFade.Seconds()
+	g.overlays.panel.Draw(screen, safe.Min.X+overlayMargin, safe.Min.Y+overlayMargin, alpha, "", lines...)
+}
+
+// updateDroppedTune plays a tune dropped onto the window in place of the
+// soundtrack. Of several files dropped, the first tune is played.
+func (g *Game) updateDroppedTune() {
+	files := ebiten.DroppedFiles()
+	if files == nil {
+		return
+	}
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		g.showToast("Cannot read the dropped files: %v", err)
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !isTuneFile(e.Name()) {
+			continue
+		}
+		data, err := fs.ReadFile(files, e.Name())
+		if err == nil {
+			err = g.swapMusic(data)
+		}
+		if err != nil {
+			log.Printf("Failed to play %s: %v", e.Name(), err)
+			g.showToast("Cannot play %s: %v", e.Name(), err)
+			return
+		}
+		g.showToast("Playing %s", e.Name())
+		return
+	}
+	if len(entries) > 0 {
+		g.showToast("%s is not a tune", entries[0].Name())
+	}
+}
+
+// swapMusic replaces the soundtrack, scene tunes and playlist included,
+// with the tune in data, played from its start at the volume set. The
+// timeline editor analyzes the new tune.
+func (g *Game) swapMusic(data []byte) error {
+	p, err := NewMusicPlayer(data, sampleRate, true)
+	if err != nil {
+		return err
+	}
+	old := g.music
+	if old != nil {
+		p.SetVolume(old.GetVolume())
+	}
+	if g.paused {
+		p.Pause()
+	}
+
+	g.music = p
+	if g.audioPlayer == nil {
+		g.audioPlayer, err = g.newAudioPlayer()
+		if err == nil {
+			g.audioPlayer.Play()
+		}
+	} else {
+		err = g.recreateAudioPlayer()
+	}
+	if err != nil {
+		g.music = old
+		p.Close()
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+
+	musicData = data
+	g.startMusicAnalysis(data)
+	g.clock.seek(g.heardPosition())
+	g.showNowPlaying()
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"bilizir-demo/record"
+)
+
+// dumpMusic renders the tune offline into a WAV file for the -dump-music
+// flag, through the same player, sample rate and volume as the demo, as
+// fast as the machine goes. One loop is the tune to its end; more play it
+// again from its loop point, each ending when the tune jumps back.
+func dumpMusic(path string, data []byte, loops int, volume float64) error {
+	player, err := NewMusicPlayer(data, sampleRate, loops > 1)
+	if err != nil {
+		return err
+	}
+	defer player.Close()
+	player.SetVolume(volume)
+	length := player.Duration()
+	if length <= 0 {
+		return errors.New("the tune declares no length to dump")
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	wav, err := record.NewWAV(f, sampleRate, 2)
+	if err != nil {
+		return err
+	}
+
+	// Rendered a VBL at a time, so a loop ends within a frame of its end.
+	// A tune that never jumps back is cut after a loop more than asked for.
+	start := time.Now()
+	chunk := make([]byte, sampleRate/50*4)
+	limit := int64(loops+1) * int64(length.Seconds()*sampleRate)
+	var samples int64
+	last, played := time.Duration(0), 0
+	for samples < limit {
+		n, err := player.Read(chunk)
+		if _, werr := wav.Write(chunk[:n]); werr != nil {
+			return werr
+		}
+		samples += int64(n / 4)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		pos := player.MusicPosition()
+		if pos < last {
+			if played++; played == loops {
+				break
+			}
+		}
+		last = pos
+	}
+	if err := wav.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	d := time.Duration(samples) * time.Second / sampleRate
+	log.Printf("Dumped %d:%02d of the tune to %s in %s", int(d.Minutes()), int(d.Seconds())%60, path, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"bilizir-demo/effects"
+)
+
+// EffectMask selects the parts drawn, one bit per part in the order of
+// Game.parts. Parts masked out keep moving, so they pick up where they
+// would be when shown again.
+type EffectMask uint32
+
+const (
+	EffectCopper EffectMask = 1 << iota
+	EffectLogo
+	EffectCubes
+	EffectScroller
+	EffectMeter
+	EffectObjects
+	EffectStars
+	EffectTunnel
+	EffectFire
+	EffectDissolve
+	EffectReveal
+	EffectBalls
+	EffectRasters
+	EffectWaterfall
+	EffectRaymarch
+	EffectScope
+
+	AllEffects EffectMask = 1<<iota - 1
+)
+
+// effectNames name the bits of EffectMask, in order
+var effectNames = []string{
+	"copper bars", "logo", "cubes", "scroller", "chip meter", "3D objects", "starfield", "tunnel",
+	"fire", "logo dissolve", "reveal", "vector balls", "rasters", "waterfall", "raymarching",
+	"oscilloscope",
+}
+
+// effectKeys toggle the first parts of EffectMask, with Ctrl held since
+// F1 and F5 open the help and the timeline editor
+var effectKeys = []ebiten.Key{
+	ebiten.KeyF1, ebiten.KeyF2, ebiten.KeyF3, ebiten.KeyF4,
+	ebiten.KeyF5, ebiten.KeyF6, ebiten.KeyF7, ebiten.KeyF8,
+}
+
+// handleEffectKeys toggles the parts on Ctrl+F1 to Ctrl+F8
+func (g *Game) handleEffectKeys() {
+	if !ebiten.IsKeyPressed(ebiten.KeyControl) {
+		return
+	}
+	for i, key := range effectKeys {
+		if inpututil.IsKeyJustPressed(key) {
+			g.toggleEffect(EffectMask(1) << i)
+		}
+	}
+}
+
+// toggleEffect shows or hides the parts of a mask
+func (g *Game) toggleEffect(m EffectMask) {
+	g.Effects ^= m
+	for i, name := range effectNames {
+		if m&(1<<i) == 0 {
+			continue
+		}
+		state := "off"
+		if g.Effects&(1<<i) != 0 {
+			state = "on"
+		}
+		log.Printf("Effect %s: %s", name, state)
+	}
+}
+
+// drawShown draws the parts not masked out of Effects in order onto dst
+func (g *Game) drawShown(dst *ebiten.Image, parts []effects.Effect) {
+	for _, p := range parts {
+		if g.Effects&g.partBits[p] != 0 {
+			start := time.Now()
+			p.Draw(dst)
+			g.profile.measurePart(p, start)
+		}
+	}
+}
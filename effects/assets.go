@@ -0,0 +1,35 @@
+package effects
+
+import (
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// LoadImage decodes an image asset into an Ebiten image
+func LoadImage(assets fs.FS, path string) (*ebiten.Image, error) {
+	img, err := DecodeImage(assets, path)
+	if err != nil {
+		return nil, err
+	}
+	return ebiten.NewImageFromImage(img), nil
+}
+
+// DecodeImage decodes an image asset, for effects reading its pixels on
+// the CPU
+func DecodeImage(assets fs.FS, path string) (image.Image, error) {
+	f, err := assets.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", path, err)
+	}
+	return img, nil
+}
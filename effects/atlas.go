@@ -0,0 +1,184 @@
+package effects
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/fs"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Names of the images in the demo atlas
+const (
+	AtlasWhite = "white"                // 3x3 white block, for flat colored triangles
+	AtlasBall  = "ball"                 // Vector ball sprite
+	AtlasFont  = "assets/soap-font.png" // Scroll font
+)
+
+// atlasPadding is the transparent gap around each image, so filtering
+// never samples a neighbor
+const atlasPadding = 2
+
+// atlasMaxSize is the largest atlas side, well within what GPUs accept
+const atlasMaxSize = 4096
+
+// Atlas is a single source image holding many small images, so parts
+// drawing them bind one texture and their triangles can be batched
+// together. The space below the images packed when it is built stays free
+// for images inserted while the demo runs.
+type Atlas struct {
+	image   *ebiten.Image
+	regions map[string]image.Rectangle
+	shelf   shelfPacker // Where inserted images go
+}
+
+// shelfPacker places images left to right on shelves, a shelf as tall as
+// its tallest image, the next shelf below it
+type shelfPacker struct {
+	x, y, height int
+}
+
+// place returns where an image of size s goes on shelves across width,
+// and moves past it
+func (p *shelfPacker) place(s image.Point, width int) image.Point {
+	if p.x+s.X+atlasPadding > width {
+		p.x, p.y, p.height = atlasPadding, p.y+p.height+atlasPadding, 0
+	}
+	at := image.Pt(p.x, p.y)
+	p.x += s.X + atlasPadding
+	p.height = max(p.height, s.Y)
+	return at
+}
+
+// bottom returns the height the shelves take
+func (p *shelfPacker) bottom() int {
+	return p.y + p.height + atlasPadding
+}
+
+// Image returns the named image as a sub-image of the atlas, or nil when
+// the atlas does not hold it. Sub-images keep the atlas coordinates, so
+// source rectangles are offset by their Bounds().Min.
+func (a *Atlas) Image(name string) *ebiten.Image {
+	if a == nil {
+		return nil
+	}
+	r, ok := a.regions[name]
+	if !ok {
+		return nil
+	}
+	return a.image.SubImage(r).(*ebiten.Image)
+}
+
+// Insert copies an image into the free space of the atlas and returns it
+// as a sub-image, or nil when the atlas is full
+func (a *Atlas) Insert(img *image.RGBA) *ebiten.Image {
+	if a == nil {
+		return nil
+	}
+	s := img.Bounds().Size()
+	b := a.image.Bounds()
+	shelf := a.shelf
+	at := shelf.place(s, b.Dx())
+	if shelf.bottom() > b.Dy() {
+		return nil
+	}
+	a.shelf = shelf
+	sub := a.image.SubImage(image.Rectangle{at, at.Add(s)}).(*ebiten.Image)
+	sub.WritePixels(img.Pix)
+	return sub
+}
+
+// AtlasBuilder collects images to pack into an atlas
+type AtlasBuilder struct {
+	names  []string
+	images []image.Image
+}
+
+// Add queues an image under a name; adding a name again replaces it
+func (b *AtlasBuilder) Add(name string, img image.Image) {
+	for i, n := range b.names {
+		if n == name {
+			b.images[i] = img
+			return
+		}
+	}
+	b.names = append(b.names, name)
+	b.images = append(b.images, img)
+}
+
+// Build packs the images on shelves, tallest first, into the narrowest
+// power of two atlas they fit in, and uploads it. The atlas is made square
+// when it fits, the space left free for images inserted later.
+func (b *AtlasBuilder) Build() (*Atlas, error) {
+	order := make([]int, len(b.images))
+	area, widest := 0, 0
+	for i, img := range b.images {
+		order[i] = i
+		s := img.Bounds().Size().Add(image.Pt(atlasPadding, atlasPadding))
+		area += s.X * s.Y
+		widest = max(widest, s.X)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return b.images[order[i]].Bounds().Dy() > b.images[order[j]].Bounds().Dy()
+	})
+
+	width := 64
+	for width < widest+atlasPadding || width*width < area {
+		width *= 2
+	}
+	for ; width <= atlasMaxSize; width *= 2 {
+		regions, shelf := b.pack(order, width)
+		if shelf.bottom() > atlasMaxSize {
+			continue
+		}
+		pixels := image.NewRGBA(image.Rect(0, 0, width, max(width, shelf.bottom())))
+		for i, name := range b.names {
+			r := regions[name]
+			draw.Draw(pixels, r, b.images[i], b.images[i].Bounds().Min, draw.Src)
+		}
+		return &Atlas{image: ebiten.NewImageFromImage(pixels), regions: regions, shelf: shelf}, nil
+	}
+	return nil, fmt.Errorf("atlas images do not fit in %dx%d", atlasMaxSize, atlasMaxSize)
+}
+
+// pack places the images in order on shelves across width, and returns
+// their regions and the shelves as they are left
+func (b *AtlasBuilder) pack(order []int, width int) (map[string]image.Rectangle, shelfPacker) {
+	regions := make(map[string]image.Rectangle, len(order))
+	shelf := shelfPacker{x: atlasPadding, y: atlasPadding}
+	for _, i := range order {
+		s := b.images[i].Bounds().Size()
+		at := shelf.place(s, width)
+		regions[b.names[i]] = image.Rectangle{at, at.Add(s)}
+	}
+	return regions, shelf
+}
+
+// NewDemoAtlas packs the small images of the demo parts: the white block
+// of flat triangles, the vector ball sprite and the scroll font
+func NewDemoAtlas(assets fs.FS) (*Atlas, error) {
+	var b AtlasBuilder
+	white := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	draw.Draw(white, white.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	b.Add(AtlasWhite, white)
+	b.Add(AtlasBall, ballSprite(vectorBallSprite, vectorBallColor))
+
+	font, err := loadSoapFont(assets)
+	if err != nil {
+		return nil, err
+	}
+	b.Add(AtlasFont, font)
+	return b.Build()
+}
+
+// UseAtlas makes the flat colored triangles of every part sample the
+// white block of the atlas, so they share its source image
+func UseAtlas(a *Atlas) {
+	if img := a.Image(AtlasWhite); img != nil {
+		r := img.Bounds()
+		whiteImage = img.SubImage(image.Rect(r.Min.X+1, r.Min.Y+1, r.Min.X+2, r.Min.Y+2)).(*ebiten.Image)
+	}
+}
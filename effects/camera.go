@@ -0,0 +1,160 @@
+package effects
+
+import "math"
+
+// Camera is a viewpoint on a 3D part: the eye, the point it looks at, the
+// roll around the line of sight and the zoom of the lens. Positions are
+// in units of the viewing distance of the part, around the center of its
+// scene, x right, y down and z away, so the same camera frames every part
+// alike: an eye at (0, 0, -1) looking at the origin is the fixed
+// viewpoint. The zero Camera is that viewpoint.
+type Camera struct {
+	Eye    [3]float64
+	Target [3]float64
+	Roll   float64 // Radians around the line of sight
+	Zoom   float64 // Magnification, 1 when zero
+}
+
+// Filmed is implemented by 3D parts the demo script directs with camera
+// shots
+type Filmed interface {
+	// Film sets the camera of the shot playing; ok is false between
+	// shots, when the part shows its fixed viewpoint
+	Film(cam Camera, ok bool)
+}
+
+// Camera shots of the demo script
+const (
+	ShotOrbit   = "orbit"    // Circles around the target
+	ShotDollyIn = "dolly-in" // Moves straight towards the target
+	ShotFlyby   = "flyby"    // Passes the target along a line, watching it
+)
+
+// ShotCamera returns the camera of a shot at the current time, reading
+// its parameters from param, which returns the value keyed for the
+// current time or, when the shot does not set it, the value of the
+// default keys def at that time. Distances are in viewing distances and
+// angles in degrees:
+//
+//   - orbit: the eye circles the target at distance (1), height above it
+//     (0), angle degrees around the vertical axis (0 to 360)
+//   - dolly-in: the eye moves from distance 2.5 to 0.8 at height 0 and
+//     angle 0
+//   - flyby: the eye travels from x -1.5 to 1.5, at y -0.3 and z -0.8
+//
+// Every shot looks at tx, ty, tz (the origin), rolled by roll (0) and
+// zoomed by zoom (1). ok is false for unknown kinds.
+func ShotCamera(kind string, param func(name string, def ...float64) float64) (cam Camera, ok bool) {
+	rad := math.Pi / 180
+	cam.Target = [3]float64{param("tx"), param("ty"), param("tz")}
+	cam.Roll = param("roll") * rad
+	cam.Zoom = param("zoom", 1)
+
+	around := func(distance, angle []float64) {
+		a := param("angle", angle...) * rad
+		d := param("distance", distance...)
+		cam.Eye = [3]float64{
+			cam.Target[0] + d*math.Sin(a),
+			cam.Target[1] - param("height"),
+			cam.Target[2] - d*math.Cos(a),
+		}
+	}
+	switch kind {
+	case ShotOrbit:
+		around([]float64{1}, []float64{0, 360})
+	case ShotDollyIn:
+		around([]float64{2.5, 0.8}, []float64{0})
+	case ShotFlyby:
+		cam.Eye = [3]float64{param("x", -1.5, 1.5), param("y", -0.3), param("z", -0.8)}
+	default:
+		return Camera{}, false
+	}
+	return cam, true
+}
+
+// cameraView transforms the scene of a part into the view of a camera
+type cameraView struct {
+	on     bool
+	orient Quat          // Turns the scene as the camera sees it
+	m      [3][3]float64 // Matrix of orient
+	eye    [3]float64    // In pixels
+	focal  float64       // Viewing distance of the part, in pixels
+	zoom   float64
+}
+
+// view returns the view of the camera for a part viewed from focal
+// pixels away. Looking straight down, the bottom of the picture is
+// towards +z, and looking straight up, towards -z.
+func (c Camera) view(focal float64) cameraView {
+	v := cameraView{orient: IdentityQuat, focal: focal, zoom: 1}
+	if c.Zoom > 0 {
+		v.zoom = c.Zoom
+	}
+	forward := sub(c.Target, c.Eye)
+	n := math.Sqrt(dot(forward, forward))
+	if n == 0 {
+		// The zero camera, or an eye on its target: the fixed viewpoint
+		v.on = v.zoom != 1
+		v.m = IdentityQuat.Matrix()
+		v.eye = [3]float64{0, 0, -focal}
+		return v
+	}
+	v.on = true
+	forward = scale3(forward, 1/n)
+	down := sub([3]float64{0, 1, 0}, scale3(forward, forward[1]))
+	if l := math.Sqrt(dot(down, down)); l > 1e-6 {
+		down = scale3(down, 1/l)
+	} else {
+		down = [3]float64{0, 0, math.Copysign(1, forward[1])}
+	}
+	right := cross(down, forward)
+
+	// Roll turns the eye around the line of sight
+	s, co := math.Sin(c.Roll), math.Cos(c.Roll)
+	right, down = sub(scale3(right, co), scale3(down, s)), add3(scale3(down, co), scale3(right, s))
+
+	v.m = [3][3]float64{right, down, forward}
+	v.orient = matrixQuat(v.m)
+	v.eye = scale3(c.Eye, focal)
+	return v
+}
+
+// point returns a scene point in the view space of the part: x right and
+// y down on screen, z away from the projection plane, focal pixels in
+// front of the eye
+func (v *cameraView) point(p [3]float64) [3]float64 {
+	if !v.on {
+		return p
+	}
+	q := rotate(&v.m, sub(p, v.eye))
+	q[2] -= v.focal
+	return q
+}
+
+// matrixQuat returns the rotation of a rotation matrix, rows first
+func matrixQuat(m [3][3]float64) Quat {
+	var q Quat
+	switch tr := m[0][0] + m[1][1] + m[2][2]; {
+	case tr > 0:
+		s := 2 * math.Sqrt(tr+1)
+		q = Quat{s / 4, (m[2][1] - m[1][2]) / s, (m[0][2] - m[2][0]) / s, (m[1][0] - m[0][1]) / s}
+	case m[0][0] > m[1][1] && m[0][0] > m[2][2]:
+		s := 2 * math.Sqrt(1+m[0][0]-m[1][1]-m[2][2])
+		q = Quat{(m[2][1] - m[1][2]) / s, s / 4, (m[0][1] + m[1][0]) / s, (m[0][2] + m[2][0]) / s}
+	case m[1][1] > m[2][2]:
+		s := 2 * math.Sqrt(1+m[1][1]-m[0][0]-m[2][2])
+		q = Quat{(m[0][2] - m[2][0]) / s, (m[0][1] + m[1][0]) / s, s / 4, (m[1][2] + m[2][1]) / s}
+	default:
+		s := 2 * math.Sqrt(1+m[2][2]-m[0][0]-m[1][1])
+		q = Quat{(m[1][0] - m[0][1]) / s, (m[0][2] + m[2][0]) / s, (m[1][2] + m[2][1]) / s, s / 4}
+	}
+	return q.Normalize()
+}
+
+func add3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func scale3(a [3]float64, k float64) [3]float64 {
+	return [3]float64{a[0] * k, a[1] * k, a[2] * k}
+}
@@ -0,0 +1,113 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// Spectrum bands, spread on a log scale over the range of chip tunes
+const (
+	meterBands   = 16
+	meterLowFreq = 50.0
+	meterTopFreq = 5000.0
+)
+
+// Voice is the state of one sound chip voice, as read from the chip
+// registers rather than measured from the audio
+type Voice struct {
+	Level     float64 // Volume, 0 to 1
+	Frequency float64 // Tone frequency in Hz, 0 when the tone is off
+	Noise     bool    // Noise mixed into the voice
+}
+
+// ChipMeter draws VU meters and spectrum bars driven by the sound chip
+// registers, the way demos traditionally synced to the music
+type ChipMeter struct {
+	// Voices returns the voices of the playing tune; nil or returning nil
+	// lets the bars fall silent
+	Voices func() []Voice
+
+	ctx    *Context
+	layout Layout
+	vu     []float64
+	bands  [meterBands]float64
+}
+
+// Init keeps the layout; the meter has no resources to allocate
+func (m *ChipMeter) Init(ctx *Context) error {
+	m.ctx = ctx
+	m.layout = ctx.Layout()
+	return nil
+}
+
+// Update samples the voices and lets the bars fall back
+func (m *ChipMeter) Update(dt float64) {
+	decay := m.ctx.Param("meter.decay", 0.03) * frames(dt)
+
+	var voices []Voice
+	if m.Voices != nil {
+		voices = m.Voices()
+	}
+	if len(m.vu) != len(voices) {
+		m.vu = make([]float64, len(voices))
+	}
+
+	for i := range m.vu {
+		m.vu[i] = math.Max(m.vu[i]-decay, 0)
+	}
+	for i := range m.bands {
+		m.bands[i] = math.Max(m.bands[i]-decay, 0)
+	}
+
+	for i, v := range voices {
+		m.vu[i] = math.Max(m.vu[i], v.Level)
+		if v.Frequency > 0 {
+			b := meterBand(v.Frequency)
+			m.bands[b] = math.Max(m.bands[b], v.Level)
+		}
+		// Noise has no pitch, it lights the top of the spectrum
+		if v.Noise {
+			for b := meterBands - 4; b < meterBands; b++ {
+				m.bands[b] = math.Max(m.bands[b], v.Level*0.6)
+			}
+		}
+	}
+}
+
+// meterBand returns the spectrum band of a frequency
+func meterBand(freq float64) int {
+	b := int(math.Log(freq/meterLowFreq) / math.Log(meterTopFreq/meterLowFreq) * meterBands)
+	return min(max(b, 0), meterBands-1)
+}
+
+// Draw draws the spectrum bars in the middle of the screen and one VU
+// meter per voice below them
+func (m *ChipMeter) Draw(screen *ebiten.Image) {
+	w, h := float32(m.layout.Width), float32(m.layout.Height)
+
+	// Spectrum bars, growing up from a baseline
+	left, right := w*0.15, w*0.85
+	base, top := h*0.62, h*0.22
+	step := (right - left) / meterBands
+	for i, level := range m.bands {
+		bh := (base - top) * float32(level)
+		x := left + float32(i)*step
+		vector.DrawFilledRect(screen, x+1, base-bh, step-2, bh, meterColor(level), false)
+	}
+
+	// VU meters, one horizontal bar per voice
+	barH := max(h*0.012, 2)
+	for i, level := range m.vu {
+		y := base + barH*float32(2+i*2)
+		vector.DrawFilledRect(screen, left, y, (right-left)*float32(level), barH, meterColor(level), false)
+	}
+}
+
+// meterColor shades a bar from the demo's magenta to white as it peaks
+func meterColor(level float64) color.RGBA {
+	t := uint8(math.Min(level, 1) * 200)
+	return color.RGBA{R: 255, G: t / 2, B: 128 + t/2, A: 255}
+}
@@ -0,0 +1,248 @@
+package effects
+
+import (
+	"image"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Copper bar defaults, matching the sine table of the original JavaScript
+// intro: two periods of a 260 pixel swing over 1024 entries
+const (
+	copperTableSize = 1024
+	copperAmplitude = 260
+	copperFrequency = 2
+	copperMargin    = 68 // Left offset of the two summed waves, in half pixels
+	copperThickness = 2  // Lines from one bar to the next
+)
+
+// CopperBars draws the animated copper bars: one 2-line slice of the
+// palette image per screen line pair, stretched down to the bottom of the
+// screen and moved by two combined sine waves. The zero value draws the
+// bars of the intro; the setters let other intros reuse the engine with
+// their own waves and palette, loaded or generated. The count, spacing,
+// waves and speeds are parameters too (copper.count, copper.thickness,
+// copper.amplitude, copper.frequency, copper.speed1 and 2, copper.spread1
+// and 2), so scenes can tune them from the demo script; the setters give
+// their defaults.
+type CopperBars struct {
+	ctx       *Context
+	layout    Layout
+	bars      *ebiten.Image
+	amplitude float64    // Swing of each wave, 0 for copperAmplitude
+	frequency float64    // Periods per table, 0 for copperFrequency
+	count     int        // Bars drawn, 0 to fill the screen
+	sine      []int      // Generated from amplitude and frequency when nil
+	sineWave  [2]float64 // Amplitude and frequency the table was generated for
+	cnt       float64
+	cnt2      float64
+
+	// Generated palette, when set instead of an image, and the hue
+	// rotation it cycles through, and was last rendered with
+	generated *CopperPalette
+	hue       float64
+	drawnHue  float64
+}
+
+// Init loads the bars image, unless a palette was set
+func (c *CopperBars) Init(ctx *Context) error {
+	c.ctx = ctx
+	c.layout = ctx.Layout()
+
+	if c.bars == nil && c.generated == nil {
+		bars, err := LoadImage(ctx.Assets, "assets/bars.png")
+		if err != nil {
+			return err
+		}
+		c.bars = bars
+	}
+	return nil
+}
+
+// SetAmplitude sets how far each of the two waves swings the bars, in
+// half pixels at 800x600; 0 restores the default
+func (c *CopperBars) SetAmplitude(a float64) {
+	c.amplitude = math.Max(a, 0)
+	c.sine = nil
+}
+
+// SetFrequency sets how many periods of the waves fit in the sine table.
+// Whole numbers keep the waves seamless; 0 restores the default.
+func (c *CopperBars) SetFrequency(f float64) {
+	c.frequency = math.Max(f, 0)
+	c.sine = nil
+}
+
+// SetBarCount sets how many bars are drawn down from the top of the
+// screen, copper.thickness lines apart; 0 fills the screen
+func (c *CopperBars) SetBarCount(n int) {
+	c.count = max(n, 0)
+}
+
+// SetPalette replaces the bars image. Each 2-line slice is the colors of
+// one bar, cycled down the screen.
+func (c *CopperBars) SetPalette(img *ebiten.Image) {
+	c.bars = img
+	c.generated = nil
+}
+
+// SetGeneratedPalette generates the bars from p instead of an image. The
+// hues cycle by the copper.cycle parameter, in degrees per frame.
+func (c *CopperBars) SetGeneratedPalette(p CopperPalette) {
+	c.generated = &p
+	c.bars = nil
+}
+
+// renderPalette renders the generated palette into the bars image when
+// the hues turned since the last frame
+func (c *CopperBars) renderPalette() {
+	if c.bars != nil && c.hue == c.drawnHue {
+		return
+	}
+	img := c.generated.Render(c.hue)
+	if c.bars == nil || c.bars.Bounds() != img.Bounds() {
+		c.bars = ebiten.NewImage(img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	c.bars.WritePixels(img.Pix)
+	c.drawnHue = c.hue
+}
+
+// sineTable returns the table of the waves, generating it after a change
+// of their amplitude or frequency
+func (c *CopperBars) sineTable() []int {
+	amplitude, frequency := c.amplitude, c.frequency
+	if amplitude == 0 {
+		amplitude = copperAmplitude
+	}
+	if frequency == 0 {
+		frequency = copperFrequency
+	}
+	amplitude = math.Max(c.ctx.Param("copper.amplitude", amplitude), 0)
+	frequency = math.Max(c.ctx.Param("copper.frequency", frequency), 0)
+	if c.sine != nil && c.sineWave == [2]float64{amplitude, frequency} {
+		return c.sine
+	}
+	c.sineWave = [2]float64{amplitude, frequency}
+	if c.sine == nil {
+		c.sine = make([]int, copperTableSize)
+	}
+	fillCopperSine(c.sine, amplitude, frequency)
+	return c.sine
+}
+
+// CopperSine returns the table of the copper waves for an amplitude and
+// a frequency: copperTableSize entries from 0 to twice the amplitude. Two
+// entries summed with CopperMargin and halved give the left edge of a
+// bar, in pixels of a 400-pixel-wide screen.
+func CopperSine(amplitude, frequency float64) []int {
+	sine := make([]int, copperTableSize)
+	fillCopperSine(sine, amplitude, frequency)
+	return sine
+}
+
+// CopperMargin is the left offset of the two summed copper waves, in
+// half pixels
+const CopperMargin = copperMargin
+
+// fillCopperSine fills a table of the copper waves
+func fillCopperSine(sine []int, amplitude, frequency float64) {
+	for i := range sine {
+		s := math.Sin(2 * math.Pi * frequency * float64(i) / copperTableSize)
+		sine[i] = int(math.Round(amplitude * (1 + s)))
+	}
+}
+
+// GeneratedPalette returns the palette the bars are generated from, false
+// when they come from an image
+func (c *CopperBars) GeneratedPalette() (CopperPalette, bool) {
+	if c.generated == nil {
+		return CopperPalette{}, false
+	}
+	return *c.generated, true
+}
+
+// Prepare builds the sine table and the generated palette
+func (c *CopperBars) Prepare() {
+	c.sineTable()
+	if c.generated != nil {
+		c.renderPalette()
+	}
+}
+
+// Update advances the two sine waves
+func (c *CopperBars) Update(dt float64) {
+	f := frames(dt)
+	c.cnt = wrapSine(c.cnt + c.ctx.Param("copper.speed1", 3)*f)
+	c.cnt2 = wrapSine(c.cnt2 + c.ctx.Param("copper.speed2", -5)*f)
+	if c.generated != nil {
+		c.hue = math.Mod(c.hue+c.ctx.Param("copper.cycle", 0)*f, 360)
+	}
+}
+
+// Rewind runs the sine waves and the color cycle backwards
+func (c *CopperBars) Rewind(dt float64) {
+	c.Update(-dt)
+}
+
+// wrapSine keeps a sine table position within [0, copperTableSize)
+func wrapSine(v float64) float64 {
+	v = math.Mod(v, copperTableSize)
+	if v < 0 {
+		v += copperTableSize
+	}
+	return v
+}
+
+// Draw draws the copper bars
+func (c *CopperBars) Draw(screen *ebiten.Image) {
+	if c.generated != nil {
+		c.renderPalette()
+	}
+	if c.bars == nil {
+		return
+	}
+	barsWidth, barsHeight := c.bars.Bounds().Dx(), c.bars.Bounds().Dy()
+	slices := barsHeight / 2
+	if slices == 0 {
+		return
+	}
+
+	l := c.layout
+	sine := c.sineTable()
+	spread1 := int(math.Round(c.ctx.Param("copper.spread1", 7)))
+	spread2 := int(math.Round(c.ctx.Param("copper.spread2", 10)))
+	cnt, cnt2 := int(c.cnt), int(c.cnt2)
+	thickness := max(int(math.Round(c.ctx.Param("copper.thickness", copperThickness))), 1)
+	count := int(math.Round(c.ctx.Param("copper.count", float64(c.count))))
+	if count <= 0 {
+		count = (l.Height + thickness - 1) / thickness
+	}
+
+	origin := c.bars.Bounds().Min
+	for i := range count {
+		// Calculate sine positions
+		val := sine[(cnt+i*spread1)%copperTableSize]
+		val += sine[(cnt2+i*spread2)%copperTableSize]
+		val += copperMargin
+
+		// Position and size
+		xPos := float64(val>>1) * l.ScaleX
+		yPos := i * thickness
+		height := l.Height - yPos
+		if height <= 0 {
+			break
+		}
+
+		// Source rectangle: 2 pixels high from the palette, cycling
+		// through its bars
+		cc := origin.Y + i%slices*2
+		srcRect := image.Rect(origin.X, cc, origin.X+barsWidth, cc+2)
+
+		// Scale to stretch the 2 pixels to fill the height
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(l.ScaleX, float64(height)/2)
+		op.GeoM.Translate(xPos, float64(yPos))
+		screen.DrawImage(c.bars.SubImage(srcRect).(*ebiten.Image), op)
+	}
+}
@@ -0,0 +1,87 @@
+package effects
+
+import (
+	"image"
+	"math"
+)
+
+// CopperPalette generates the copper bar strips from code instead of
+// the bars image: each bar is a ramp of a single hue across the strip,
+// dark at the edges and full at the center, like those of bars.png
+type CopperPalette struct {
+	Bars   int     // Number of bars, 10 when zero
+	Width  int     // Width of the strips in pixels, 46 when zero
+	Hue    float64 // Hue of the first bar in degrees
+	Step   float64 // Hue between consecutive bars in degrees, 360/Bars when zero
+	Levels int     // Levels per channel: 8 for the ST's 512 colors, 16 for the STE's 4096, 0 for full color
+}
+
+// copperRampFloor is the brightness at the edges of the generated strips
+const copperRampFloor = 0.27
+
+// Render draws the strips, 2 lines per bar, with the hues turned by
+// shift degrees
+func (p CopperPalette) Render(shift float64) *image.RGBA {
+	bars, width, step := p.Bars, p.Width, p.Step
+	if bars <= 0 {
+		bars = 10
+	}
+	if width <= 0 {
+		width = 46
+	}
+	if step == 0 {
+		step = 360 / float64(bars)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, bars*2))
+	for b := range bars {
+		hue := p.Hue + shift + step*float64(b)
+		for x := range width {
+			// Triangle ramp peaking at the center of the strip
+			t := 1 - math.Abs(2*(float64(x)+0.5)/float64(width)-1)
+			r, g, bl := hueRGB(hue, copperRampFloor+(1-copperRampFloor)*t)
+			i := img.PixOffset(x, b*2)
+			img.Pix[i] = p.quantize(r)
+			img.Pix[i+1] = p.quantize(g)
+			img.Pix[i+2] = p.quantize(bl)
+			img.Pix[i+3] = 0xff
+			copy(img.Pix[img.PixOffset(x, b*2+1):], img.Pix[i:i+4])
+		}
+	}
+	return img
+}
+
+// quantize rounds a channel in [0, 1] to the palette levels
+func (p CopperPalette) quantize(v float64) uint8 {
+	if p.Levels > 1 {
+		steps := float64(p.Levels - 1)
+		v = math.Round(v*steps) / steps
+	}
+	return uint8(math.Round(v * 255))
+}
+
+// hueRGB converts a fully saturated hue in degrees and a brightness to
+// RGB channels in [0, 1]
+func hueRGB(hue, value float64) (r, g, b float64) {
+	h := math.Mod(hue, 360)
+	if h < 0 {
+		h += 360
+	}
+	h /= 60
+	x := 1 - math.Abs(math.Mod(h, 2)-1)
+	switch int(h) {
+	case 0:
+		r, g, b = 1, x, 0
+	case 1:
+		r, g, b = x, 1, 0
+	case 2:
+		r, g, b = 0, 1, x
+	case 3:
+		r, g, b = 0, x, 1
+	case 4:
+		r, g, b = x, 0, 1
+	default:
+		r, g, b = 1, 0, x
+	}
+	return r * value, g * value, b * value
+}
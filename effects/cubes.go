@@ -0,0 +1,361 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// NbCubes is the default number of cubes flying around, see the
+// cubes.count parameter
+const NbCubes = 12
+
+// Define face colors (pink/magenta tones)
+var cubeFaceColors = []color.RGBA{
+	{255, 80, 160, 255},  // Hot pink
+	{255, 120, 200, 255}, // Light pink
+	{200, 60, 140, 255},  // Dark pink
+	{255, 100, 180, 255}, // Medium pink
+	{220, 80, 160, 255},  // Rose
+	{255, 140, 200, 255}, // Pale pink
+}
+
+// Cube3D represents a rotating 3D cube
+type Cube3D struct {
+	orient Quat
+	size   float64
+}
+
+// NewCube3D creates a new 3D cube
+func NewCube3D(size float64) *Cube3D {
+	return &Cube3D{
+		orient: IdentityQuat,
+		size:   size,
+	}
+}
+
+// Rotate turns the cube further by small angles around X, Y and Z
+func (c *Cube3D) Rotate(dx, dy, dz float64) {
+	c.orient = EulerQuat(dx, dy, dz).Mul(c.orient).Normalize()
+}
+
+// SetOrientation sets the cube orientation
+func (c *Cube3D) SetOrientation(q Quat) {
+	c.orient = q
+}
+
+// Orientation returns the cube orientation
+func (c *Cube3D) Orientation() Quat {
+	return c.orient
+}
+
+// Bound returns the radius of a circle around the cube center containing
+// its projection, whatever its rotation
+func (c *Cube3D) Bound() float64 {
+	r := c.size * math.Sqrt(3) / 2
+	return r * 200 / (200 - r)
+}
+
+// Project3D projects 3D coordinates to 2D
+func project3D(x, y, z float64) (float64, float64) {
+	// Simple perspective projection
+	perspective := 200.0
+	factor := perspective / (perspective + z)
+	return x * factor, y * factor
+}
+
+// Draw draws the 3D cube at the specified position. Faces turned away
+// from the camera are culled, so the visible ones never overlap and need
+// no sorting, and each is shaded by the light according to its angle.
+func (c *Cube3D) Draw(screen *ebiten.Image, centerX, centerY float64) {
+	// Rotate and project the corners
+	m := c.orient.Matrix()
+	var rotated [8][3]float64
+	var projected [8][2]float64
+	for i, v := range cubeCorners {
+		rotated[i] = rotate(&m, [3]float64{v[0] * c.size, v[1] * c.size, v[2] * c.size})
+		px, py := project3D(rotated[i][0], rotated[i][1], rotated[i][2])
+		projected[i] = [2]float64{centerX + px, centerY + py}
+	}
+
+	cam := [3]float64{0, 0, -200}
+	points := make([]float64, 0, 8)
+	for fi, face := range cubeFaces {
+		a := rotated[face[0]]
+		n := cross(sub(rotated[face[1]], a), sub(rotated[face[2]], a))
+		if dot(n, sub(a, cam)) >= 0 {
+			continue
+		}
+		faceColor := shadeFace(cubeFaceColors[fi], n, false)
+
+		points = points[:0]
+		for _, vi := range face {
+			points = append(points, projected[vi][0], projected[vi][1])
+		}
+
+		// Draw filled polygon
+		drawPolygon(screen, points, faceColor)
+
+		// Draw edges with darker color for better visibility
+		edgeColor := color.RGBA{
+			faceColor.R * 3 / 4,
+			faceColor.G * 3 / 4,
+			faceColor.B * 3 / 4,
+			255,
+		}
+		for i := 0; i < 4; i++ {
+			j := (i + 1) % 4
+			vector.StrokeLine(screen,
+				float32(points[i*2]), float32(points[i*2+1]),
+				float32(points[j*2]), float32(points[j*2+1]),
+				1, edgeColor, false)
+		}
+	}
+}
+
+// shadeFace lights a face color from the direction of its normal n, with
+// the diffuse light banded for the toon style
+func shadeFace(clr color.RGBA, n [3]float64, toon bool) color.RGBA {
+	diffuse := 0.0
+	if l := math.Sqrt(dot(n, n)); l > 0 {
+		diffuse = math.Max(0, dot(n, lightDir)/l)
+	}
+	if toon {
+		diffuse = toonBand(diffuse)
+	}
+	light := lightAmbient + lightDiffuse*diffuse
+	return color.RGBA{uint8(float64(clr.R) * light), uint8(float64(clr.G) * light), uint8(float64(clr.B) * light), clr.A}
+}
+
+// Vertex and index buffers reused by drawPolygon
+var (
+	polygonVertices []ebiten.Vertex
+	polygonIndices  []uint16
+)
+
+// drawPolygon draws a filled convex polygon, given as x, y pairs, as a
+// triangle fan in a single DrawTriangles call. The edges are shared
+// exactly between triangles, so there are no gaps at fractional
+// coordinates.
+func drawPolygon(screen *ebiten.Image, points []float64, fillColor color.Color) {
+	n := len(points) / 2
+	if n < 3 {
+		return
+	}
+
+	// Colors are premultiplied, as color.Color returns them
+	r, g, b, a := fillColor.RGBA()
+	cr, cg, cb, ca := float32(r)/0xffff, float32(g)/0xffff, float32(b)/0xffff, float32(a)/0xffff
+
+	src := whiteImage.Bounds().Min
+	polygonVertices = polygonVertices[:0]
+	polygonIndices = polygonIndices[:0]
+	for i := range n {
+		polygonVertices = append(polygonVertices, ebiten.Vertex{
+			DstX:   float32(points[i*2]),
+			DstY:   float32(points[i*2+1]),
+			SrcX:   float32(src.X),
+			SrcY:   float32(src.Y),
+			ColorR: cr,
+			ColorG: cg,
+			ColorB: cb,
+			ColorA: ca,
+		})
+	}
+	for i := 1; i+1 < n; i++ {
+		polygonIndices = append(polygonIndices, 0, uint16(i), uint16(i+1))
+	}
+
+	op := &ebiten.DrawTrianglesOptions{ColorScaleMode: ebiten.ColorScaleModePremultipliedAlpha}
+	screen.DrawTriangles(polygonVertices, polygonIndices, whiteImage, op)
+}
+
+// tumbleBlend is how fast the cubes hand over between free spin and
+// the script orientation, per frame: half a second
+const tumbleBlend = 1.0 / 30
+
+// Cubes flies rotating 3D cubes along Lissajous paths. All cubes are
+// transformed on the CPU into one vertex buffer and drawn in a single
+// call; PerFace switches back to drawing each cube face by face.
+type Cubes struct {
+	Speed   float64 // Animation speed multiplier, 1 when zero
+	PerFace bool
+
+	ctx       *Context
+	layout    Layout
+	cubes     []*Cube3D
+	spritePos []float64
+	bounce    float64 // Jump on "beat" syncs, from 1 down to 0
+	batch     cubeBatch
+
+	// Orientation choreographed by the demo script, and how far the
+	// cubes have turned from their free spin to it, 0 to 1
+	tumble    Quat
+	tumbleOn  bool
+	tumbleMix float64
+
+	// Blend of the cubes between shapes, led by "morph-<shape>" syncs
+	morph cubeMorph
+
+	// Camera of the shot directing the cubes; the cubes fly on the plane
+	// of the screen, which the camera looks at
+	camera Camera
+}
+
+// Init creates the cubes with different initial rotations
+func (c *Cubes) Init(ctx *Context) error {
+	c.ctx = ctx
+	c.layout = ctx.Layout()
+	if c.morph == (cubeMorph{}) {
+		c.morph.weights[0], c.morph.t = 1, 1
+	}
+
+	for _, cube := range c.cubes {
+		cube.size = c.layout.CubeSize
+	}
+	c.resize(int(ctx.Param("cubes.count", NbCubes)))
+	return nil
+}
+
+// resize adds or removes cubes; new cubes continue the initial pattern
+func (c *Cubes) resize(n int) {
+	n = max(n, 0)
+	if n < len(c.cubes) {
+		c.cubes = c.cubes[:n]
+		c.spritePos = c.spritePos[:n]
+		return
+	}
+	for i := len(c.cubes); i < n; i++ {
+		cube := NewCube3D(c.layout.CubeSize) // 20 pixel size cubes at 800x600
+		cube.orient = EulerQuat(float64(i)*0.3, float64(i)*0.5, float64(i)*0.2)
+		c.cubes = append(c.cubes, cube)
+		c.spritePos = append(c.spritePos, float64(0.15)*float64(i+1))
+	}
+}
+
+// Update moves and rotates the cubes
+func (c *Cubes) Update(dt float64) {
+	f := frames(dt) * speed(c.Speed)
+	move := c.ctx.Param("cubes.speed", 0.04) * f
+	spin := c.ctx.Param("cubes.spin", 1) * f
+
+	c.bounce = math.Max(c.bounce-0.08*f, 0)
+	if c.tumbleOn {
+		c.tumbleMix = math.Min(c.tumbleMix+tumbleBlend*f, 1)
+	} else {
+		c.tumbleMix = math.Max(c.tumbleMix-tumbleBlend*f, 0)
+	}
+	c.resize(int(c.ctx.Param("cubes.count", NbCubes)))
+	c.morph.update(dt*speed(c.Speed), c.ctx.Param("cubes.morph", 1.5))
+
+	c.travel(move, spin)
+}
+
+// travel moves the cubes along their path and spins them, backwards for
+// negative steps
+func (c *Cubes) travel(move, spin float64) {
+	for i := range c.cubes {
+		c.spritePos[i] += move
+
+		// Update cube rotations
+		c.cubes[i].Rotate(
+			0.02*spin*(1+float64(i)*0.1),
+			0.03*spin*(1+float64(i)*0.15),
+			0.01*spin*(1+float64(i)*0.05),
+		)
+	}
+}
+
+// Rewind moves the cubes back along their path and unwinds their spin;
+// the bounce, the tumble blend and the morph hold still
+func (c *Cubes) Rewind(dt float64) {
+	f := frames(dt) * speed(c.Speed)
+	c.travel(-c.ctx.Param("cubes.speed", 0.04)*f, -c.ctx.Param("cubes.spin", 1)*f)
+}
+
+// Tumble implements Tumbler: while the script has keys, the cubes turn
+// from their free spin to the keyed orientation, and back when it ends
+func (c *Cubes) Tumble(q Quat, ok bool) {
+	c.tumble, c.tumbleOn = q, ok
+}
+
+// Film implements Filmed
+func (c *Cubes) Film(cam Camera, ok bool) {
+	c.camera = cam
+}
+
+// SetStyle implements Styled; the toon style only applies to the
+// batched path
+func (c *Cubes) SetStyle(name string) {
+	c.batch.toon = name == StyleToon
+}
+
+// Sync makes the cubes jump on each beat, and morph into the shape named
+// by "morph-<shape>" syncs: cube, sphere, pyramid or cloud
+func (c *Cubes) Sync(name string) {
+	if name == "beat" {
+		c.bounce = 1
+	}
+	if shape, ok := morphSync(name); ok {
+		c.morph.start(shape)
+	}
+}
+
+// Draw draws the rotating 3D cubes
+func (c *Cubes) Draw(screen *ebiten.Image) {
+	l := c.layout
+	jump := math.Sin(c.bounce*math.Pi) * 24 * l.ScaleY
+	view := c.camera.view(200 * l.ScaleY)
+	cx, cy := float64(l.Width)/2, float64(l.Height)/2
+	c.batch.begin(screen)
+	for i, cube := range c.cubes {
+		halfW := (float64(l.Width) - 40*l.ScaleX) / 2
+		xPos := halfW + (halfW * math.Sin(c.spritePos[i]))
+		yPos := (186+(84*math.Cos(c.spritePos[i]*2.5)))*l.ScaleY - jump
+
+		// Through a camera, each cube is moved to where its center is
+		// seen, and turned and scaled as seen from there
+		size := 1.0
+		if view.on {
+			p := view.point([3]float64{xPos - cx, yPos - cy, 0})
+			d := view.focal + p[2]
+			if d <= 1 {
+				continue
+			}
+			size = view.zoom * view.focal / d
+			xPos, yPos = cx+p[0]*size, cy+p[1]*size
+		}
+
+		// Cubes entirely off screen skip the rotation math; the cloud
+		// spreads wider than the cube
+		bound := cube.Bound() * size
+		if !c.morph.plain() {
+			bound *= 1.5
+		}
+		if offScreen(xPos, yPos, bound, l.Width, l.Height) {
+			continue
+		}
+
+		if c.tumbleMix > 0 || view.on {
+			// Draw a copy so the free spin goes on underneath
+			t := c.tumbleMix * c.tumbleMix * (3 - 2*c.tumbleMix)
+			shown := *cube
+			shown.orient = view.orient.Mul(Slerp(cube.orient, c.tumble, t))
+			shown.size *= size
+			cube = &shown
+		}
+
+		// Draw the 3D cube; morphed shapes are always batched
+		switch {
+		case !c.morph.plain():
+			c.batch.addMorphed(cube, &c.morph, xPos, yPos)
+		case c.PerFace:
+			cube.Draw(screen, xPos, yPos)
+		default:
+			c.batch.add(cube, xPos, yPos)
+		}
+	}
+	c.batch.flush()
+}
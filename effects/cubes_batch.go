@@ -0,0 +1,141 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Cube corners, bit 0 selecting +x, bit 1 +y and bit 2 +z
+var cubeCorners = func() [8][3]float64 {
+	var c [8][3]float64
+	for i := range c {
+		for axis := range 3 {
+			c[i][axis] = -0.5
+			if i&(1<<axis) != 0 {
+				c[i][axis] = 0.5
+			}
+		}
+	}
+	return c
+}()
+
+// cubeFaces lists the faces of the batched cubes wound outwards, in the
+// order of cubeFaceColors: z-, z+, y-, y+, x-, x+
+var cubeFaces = [6][4]int{
+	{0, 2, 3, 1},
+	{4, 5, 7, 6},
+	{0, 1, 5, 4},
+	{2, 6, 7, 3},
+	{0, 4, 6, 2},
+	{1, 3, 7, 5},
+}
+
+// Edges are drawn as quads this wide, thicker in toon mode
+const (
+	cubeEdgeWidth = 1
+	toonEdgeWidth = 2
+)
+
+// cubeBatch collects the triangles of many cubes so they are submitted
+// in a single DrawTriangles call instead of one draw per face line
+type cubeBatch struct {
+	toon     bool // Cel shading: banded lighting and black outlines
+	dst      *ebiten.Image
+	vertices []ebiten.Vertex
+	indices  []uint16
+	morphed  []morphedQuad // Quads of the morphed cube being added
+}
+
+// begin starts collecting cubes drawn onto dst
+func (b *cubeBatch) begin(dst *ebiten.Image) {
+	b.dst = dst
+	b.vertices = b.vertices[:0]
+	b.indices = b.indices[:0]
+}
+
+// flush draws the collected triangles
+func (b *cubeBatch) flush() {
+	if len(b.indices) > 0 {
+		b.dst.DrawTriangles(b.vertices, b.indices, whiteImage, nil)
+	}
+	b.vertices = b.vertices[:0]
+	b.indices = b.indices[:0]
+}
+
+// add transforms a cube and appends its visible faces and their edges.
+// A cube is convex, so culling the faces turned away from the camera
+// leaves faces that never overlap and need no sorting.
+func (b *cubeBatch) add(c *Cube3D, centerX, centerY float64) {
+	// At most 3 faces with 4 edges each are visible
+	if len(b.vertices)+3*(4+4*4) > math.MaxUint16 {
+		b.flush()
+	}
+
+	m := c.orient.Matrix()
+	var rotated [8][3]float64
+	var projected [8][2]float32
+	for i, v := range cubeCorners {
+		rotated[i] = rotate(&m, [3]float64{v[0] * c.size, v[1] * c.size, v[2] * c.size})
+		px, py := project3D(rotated[i][0], rotated[i][1], rotated[i][2])
+		projected[i] = [2]float32{float32(centerX + px), float32(centerY + py)}
+	}
+
+	cam := [3]float64{0, 0, -200}
+	for fi, face := range cubeFaces {
+		a := rotated[face[0]]
+		n := cross(sub(rotated[face[1]], a), sub(rotated[face[2]], a))
+		if dot(n, sub(a, cam)) >= 0 {
+			continue
+		}
+
+		clr := shadeFace(cubeFaceColors[fi], n, b.toon)
+		base := uint16(len(b.vertices))
+		for _, vi := range face {
+			b.appendVertex(projected[vi][0], projected[vi][1], clr)
+		}
+		b.indices = append(b.indices, base, base+1, base+2, base, base+2, base+3)
+
+		// Darker edges for better visibility, as the per-face path, or
+		// ink lines in toon mode
+		edge, width := color.RGBA{clr.R * 3 / 4, clr.G * 3 / 4, clr.B * 3 / 4, 255}, float32(cubeEdgeWidth)
+		if b.toon {
+			edge, width = color.RGBA{0, 0, 0, 255}, toonEdgeWidth
+		}
+		for i := range 4 {
+			p, q := projected[face[i]], projected[face[(i+1)%4]]
+			b.appendLine(p, q, width, edge)
+		}
+	}
+}
+
+// appendLine appends a line from p to q as a thin quad
+func (b *cubeBatch) appendLine(p, q [2]float32, width float32, clr color.RGBA) {
+	dx, dy := q[0]-p[0], q[1]-p[1]
+	l := float32(math.Hypot(float64(dx), float64(dy)))
+	if l == 0 {
+		return
+	}
+	nx, ny := -dy/l*width/2, dx/l*width/2
+	base := uint16(len(b.vertices))
+	b.appendVertex(p[0]+nx, p[1]+ny, clr)
+	b.appendVertex(q[0]+nx, q[1]+ny, clr)
+	b.appendVertex(q[0]-nx, q[1]-ny, clr)
+	b.appendVertex(p[0]-nx, p[1]-ny, clr)
+	b.indices = append(b.indices, base, base+1, base+2, base, base+2, base+3)
+}
+
+func (b *cubeBatch) appendVertex(x, y float32, clr color.RGBA) {
+	src := whiteImage.Bounds().Min
+	b.vertices = append(b.vertices, ebiten.Vertex{
+		DstX:   x,
+		DstY:   y,
+		SrcX:   float32(src.X),
+		SrcY:   float32(src.Y),
+		ColorR: float32(clr.R) / 255,
+		ColorG: float32(clr.G) / 255,
+		ColorB: float32(clr.B) / 255,
+		ColorA: float32(clr.A) / 255,
+	})
+}
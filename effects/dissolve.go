@@ -0,0 +1,165 @@
+package effects
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Logo pixels sampled into one particle, at 800x600
+const dissolveStep = 3
+
+// Dissolve phases
+const (
+	dissolveHeld       = iota // The logo stands assembled
+	dissolveDispersing        // Particles blow away with the wind
+	dissolveAssembling        // Particles fly back home
+)
+
+// Free-running cycle durations, in seconds, and how long after a script
+// trigger the cycle stays under script control
+const (
+	dissolveHold       = 3.0
+	dissolveDisperse   = 3.5
+	dissolveReassemble = 3.0
+	dissolveTimeout    = 10.0
+)
+
+// LogoDissolve samples the opaque pixels of the logo into particles,
+// which blow away under wind and gravity and then fly back to reassemble
+// the logo. It cycles on its own, or follows the "dissolve" and
+// "assemble" syncs of the demo script.
+type LogoDissolve struct {
+	ctx       *Context
+	layout    Layout
+	rng       *rand.Rand
+	logo      image.Image
+	home      [][2]float64 // Particle positions in the logo, at 800x600
+	parts     Particles
+	phase     int
+	elapsed   float64 // Seconds in the current phase
+	sinceSync float64
+	synced    bool
+}
+
+// Init samples the logo into particles on the first call, and places
+// them for the frame size
+func (d *LogoDissolve) Init(ctx *Context) error {
+	d.ctx = ctx
+	d.layout = ctx.Layout()
+	if d.logo != nil {
+		return nil
+	}
+
+	logo, err := DecodeImage(ctx.Assets, "assets/logo.png")
+	if err != nil {
+		return err
+	}
+	d.logo = logo
+	d.rng = rand.New(rand.NewSource(1))
+
+	// Centered on the screen at 800x600
+	b := logo.Bounds()
+	ox, oy := float64(RefWidth-b.Dx())/2, float64(RefHeight-b.Dy())/2
+	for y := b.Min.Y; y < b.Max.Y; y += dissolveStep {
+		for x := b.Min.X; x < b.Max.X; x += dissolveStep {
+			c := color.RGBAModel.Convert(logo.At(x, y)).(color.RGBA)
+			if c.A < 0x80 {
+				continue
+			}
+			// Straight colors; the particles are drawn opaque
+			c.R, c.G, c.B = unpremultiply(c.R, c.A), unpremultiply(c.G, c.A), unpremultiply(c.B, c.A)
+			c.A = 0xff
+			d.home = append(d.home, [2]float64{ox + float64(x-b.Min.X), oy + float64(y-b.Min.Y)})
+			d.parts.List = append(d.parts.List, Particle{Color: c})
+		}
+	}
+	d.gather()
+	return nil
+}
+
+func unpremultiply(v, a uint8) uint8 {
+	return uint8(min(int(v)*255/int(a), 255))
+}
+
+// gather puts every particle back home, at rest
+func (d *LogoDissolve) gather() {
+	for i := range d.parts.List {
+		p := &d.parts.List[i]
+		p.X, p.Y = d.home[i][0], d.home[i][1]
+		p.VX, p.VY = 0, 0
+	}
+}
+
+// setPhase switches phase, kicking the particles when they disperse
+func (d *LogoDissolve) setPhase(phase int) {
+	if phase == dissolveDispersing {
+		for i := range d.parts.List {
+			p := &d.parts.List[i]
+			p.VX = d.rng.Float64()*4 - 2
+			p.VY = d.rng.Float64()*4 - 3
+		}
+	}
+	d.phase = phase
+	d.elapsed = 0
+}
+
+// Update moves the particles, and runs the free cycle when the script
+// is not driving the effect
+func (d *LogoDissolve) Update(dt float64) {
+	f := frames(dt)
+	d.elapsed += dt
+	if d.synced {
+		d.sinceSync += dt
+		d.synced = d.sinceSync < dissolveTimeout
+	} else {
+		switch {
+		case d.phase == dissolveHeld && d.elapsed >= dissolveHold:
+			d.setPhase(dissolveDispersing)
+		case d.phase == dissolveDispersing && d.elapsed >= dissolveDisperse:
+			d.setPhase(dissolveAssembling)
+		case d.phase == dissolveAssembling && d.elapsed >= dissolveReassemble:
+			d.setPhase(dissolveHeld)
+			d.gather()
+		}
+	}
+
+	switch d.phase {
+	case dissolveDispersing:
+		d.parts.Step(d.ctx.Param("particles.wind", 0.05), d.ctx.Param("particles.gravity", 0.03), 0.02, f)
+	case dissolveAssembling:
+		// Spring home, critically damped enough to settle in time
+		k := math.Min(1, 0.0015*f*(1+d.elapsed*3))
+		for i := range d.parts.List {
+			p := &d.parts.List[i]
+			p.VX = (p.VX + (d.home[i][0]-p.X)*k) * math.Pow(0.9, f)
+			p.VY = (p.VY + (d.home[i][1]-p.Y)*k) * math.Pow(0.9, f)
+			p.X += p.VX * f
+			p.Y += p.VY * f
+		}
+	}
+}
+
+// Sync implements Syncer: "dissolve" blows the logo away, "assemble"
+// brings it back
+func (d *LogoDissolve) Sync(name string) {
+	switch name {
+	case "dissolve":
+		d.setPhase(dissolveDispersing)
+	case "assemble":
+		d.setPhase(dissolveAssembling)
+	default:
+		return
+	}
+	d.synced = true
+	d.sinceSync = 0
+}
+
+// Draw renders the particles, positions scaled from 800x600
+func (d *LogoDissolve) Draw(screen *ebiten.Image) {
+	l := d.layout
+	d.parts.Draw(screen, math.Max(dissolveStep*l.ScaleY, 1), l.ScaleX, l.ScaleY)
+}
@@ -0,0 +1,122 @@
+// Package effects defines the interface shared by every demo part, so
+// intros can be composed from independent, reusable effects, and provides
+// the classic parts of the Bilizir intro: copper bars, the logo sine
+// movement, the rotating cubes and the TCB-style text scroller.
+package effects
+
+import (
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// FrameRate is the frame rate effect animation constants are tuned for.
+// Rates such as "3 steps" are per frame at this rate, and are scaled by
+// the dt passed to Update.
+const FrameRate = 60
+
+// Params gives effects read access to live-tweakable parameters
+type Params interface {
+	// Value returns the named parameter and whether it exists
+	Value(name string) (float64, bool)
+}
+
+// Context carries what an effect needs to set itself up
+type Context struct {
+	// Size of the frame the effect draws into
+	Width  int
+	Height int
+
+	// SafeInset is the fraction of the width and height on each side the
+	// critical parts keep clear of, for projectors cropping the edges
+	SafeInset float64
+
+	// Assets gives read access to the demo's embedded assets
+	Assets fs.FS
+
+	// Params holds tweakable parameters; it may be nil
+	Params Params
+
+	// Atlas holds small images shared between effects; it may be nil
+	Atlas *Atlas
+
+	// Glyphs renders the characters the bitmap fonts lack; it may be nil
+	Glyphs *GlyphFallback
+}
+
+// Param returns the named parameter, or def when it is not available
+func (c *Context) Param(name string, def float64) float64 {
+	if c == nil || c.Params == nil {
+		return def
+	}
+	if v, ok := c.Params.Value(name); ok {
+		return v
+	}
+	return def
+}
+
+// Layout returns the effect constants for the context frame size and
+// safe area
+func (c *Context) Layout() Layout {
+	return NewLayout(c.Width, c.Height).Inset(c.SafeInset)
+}
+
+// Effect is a self-contained demo part
+type Effect interface {
+	// Init allocates resources; it is called before the first Update, and
+	// again when the frame size changes, in which case the effect keeps
+	// its animation state
+	Init(ctx *Context) error
+
+	// Update advances the effect by dt seconds
+	Update(dt float64)
+
+	// Draw renders the effect onto dst
+	Draw(dst *ebiten.Image)
+}
+
+// Syncer is implemented by effects that follow the music sync events of
+// the demo script, such as the "beat" sync
+type Syncer interface {
+	// Sync is called when the named sync event fires
+	Sync(name string)
+}
+
+// Tumbler is implemented by effects whose orientation can be
+// choreographed with keyframes in the demo script
+type Tumbler interface {
+	// Tumble sets the orientation designed for the current time; ok is
+	// false when the script has no keys for the effect
+	Tumble(q Quat, ok bool)
+}
+
+// Styled is implemented by parts with alternative visual styles, which
+// scenes of the demo script select by name
+type Styled interface {
+	// SetStyle selects the named style before the part is drawn; an
+	// empty or unknown name selects the default style
+	SetStyle(name string)
+}
+
+// Preparer is implemented by parts building buffers or tables on their
+// first draw, so they can be built ahead of the scene showing them
+type Preparer interface {
+	// Prepare builds what the next draw would
+	Prepare()
+}
+
+// Rewinder is implemented by parts whose motion can run backwards, for
+// the rewind of the demo; the other parts hold still while it rewinds
+type Rewinder interface {
+	// Rewind steps the part back by dt seconds, retracing its motion
+	Rewind(dt float64)
+}
+
+// StyleToon is the cel-shaded style of the 3D parts: banded lighting and
+// ink outlines
+const StyleToon = "toon"
+
+// frames converts dt seconds to a number of frames at FrameRate
+func frames(dt float64) float64 {
+	return dt * FrameRate
+}
@@ -0,0 +1,177 @@
+package effects
+
+import (
+	"image"
+	"image/color"
+	"io/fs"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// GlyphFallback is the fallback chain of the text: the characters a
+// bitmap font lacks are rendered from TrueType or OpenType fonts, by the
+// first of the chain that has them. The chain ends with Go Bold, which
+// covers Latin, Greek and Cyrillic; fonts for other scripts go before it.
+// Each glyph is rendered once, at the cell size it is asked for, and
+// cached in the atlas. Characters no font has are drawn as the box of the
+// bitmap font.
+type GlyphFallback struct {
+	fonts  []*opentype.Font
+	atlas  *Atlas
+	buf    sfnt.Buffer
+	glyphs map[fallbackKey]*ebiten.Image // nil for characters no font has
+}
+
+// fallbackKey is a glyph rendered by the fallback chain
+type fallbackKey struct {
+	ch   rune
+	w, h int
+	font *BitmapFont // Font the glyph is colored like, nil for white
+}
+
+// NewGlyphFallback creates the fallback chain of fonts, in order, then Go
+// Bold, caching the glyphs in atlas. The atlas may be nil.
+func NewGlyphFallback(atlas *Atlas, fonts ...*opentype.Font) (*GlyphFallback, error) {
+	builtin, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return &GlyphFallback{
+		fonts:  append(fonts, builtin),
+		atlas:  atlas,
+		glyphs: map[fallbackKey]*ebiten.Image{},
+	}, nil
+}
+
+// LoadFallbackFont reads a TrueType or OpenType font for the fallback
+// chain
+func LoadFallbackFont(fsys fs.FS, name string) (*opentype.Font, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return opentype.Parse(data)
+}
+
+// Glyph returns a character rendered white in a w x h cell, false when no
+// font of the chain has it
+func (f *GlyphFallback) Glyph(ch rune, w, h int) (*ebiten.Image, bool) {
+	return f.glyph(fallbackKey{ch: ch, w: w, h: h})
+}
+
+// FontGlyph returns a character rendered in a cell of a bitmap font and
+// colored like its glyphs, row by row, false when no font of the chain
+// has it
+func (f *GlyphFallback) FontGlyph(bf *BitmapFont, ch rune) (*ebiten.Image, bool) {
+	return f.glyph(fallbackKey{ch: ch, w: bf.CharWidth, h: bf.CharHeight, font: bf})
+}
+
+// glyph returns a glyph from the cache, rendering it the first time
+func (f *GlyphFallback) glyph(k fallbackKey) (*ebiten.Image, bool) {
+	if f == nil {
+		return nil, false
+	}
+	if img, ok := f.glyphs[k]; ok {
+		return img, img != nil
+	}
+	var img *ebiten.Image
+	if mask := f.render(k.ch, k.w, k.h); mask != nil {
+		var rows []color.RGBA
+		if k.font != nil {
+			rows = k.font.rowColors()
+		}
+		pixels := colorGlyph(mask, rows)
+		if img = f.atlas.Insert(pixels); img == nil {
+			img = ebiten.NewImageFromImage(pixels)
+		}
+	}
+	f.glyphs[k] = img
+	return img, img != nil
+}
+
+// fallbackCapHeight is the height of the capitals of fallback glyphs, as
+// a fraction of the cell height: bitmap fonts of scrollers are mostly
+// capitals filling their cells, so the capitals are sized alike, leaving
+// a little room for descenders and accents
+const fallbackCapHeight = 0.7
+
+// render draws the coverage of a character in a w x h cell with the first
+// font of the chain that has it, nil when none does. The glyph is sized
+// for the capitals of its font to fill most of the cell height, or its
+// ascent and descent the whole height when it gives no capital height,
+// smaller when it would be wider than the cell. The capitals are centered
+// in the cell.
+func (f *GlyphFallback) render(ch rune, w, h int) *image.Alpha {
+	for _, ff := range f.fonts {
+		i, err := ff.GlyphIndex(&f.buf, ch)
+		if err != nil || i == 0 {
+			continue
+		}
+		m, err := ff.Metrics(&f.buf, fixed.I(h), font.HintingNone)
+		if err != nil || m.Ascent+m.Descent <= 0 {
+			continue
+		}
+		size := float64(h) * float64(fixed.I(h)) / float64(m.Ascent+m.Descent)
+		if m.CapHeight > 0 {
+			size = fallbackCapHeight * float64(h) * float64(fixed.I(h)) / float64(m.CapHeight)
+		}
+		adv, err := ff.GlyphAdvance(&f.buf, i, fixed.Int26_6(size*64), font.HintingNone)
+		if err != nil {
+			continue
+		}
+		if a := float64(adv) / 64; a > float64(w) {
+			size *= float64(w) / a
+		}
+
+		face, err := opentype.NewFace(ff, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			continue
+		}
+		fm := face.Metrics()
+		baseline := (fixed.I(h)-fm.Ascent-fm.Descent)/2 + fm.Ascent
+		if fm.CapHeight > 0 {
+			baseline = (fixed.I(h) + fm.CapHeight) / 2
+		}
+		adv, _ = face.GlyphAdvance(ch)
+		mask := image.NewAlpha(image.Rect(0, 0, w, h))
+		d := font.Drawer{
+			Dst:  mask,
+			Src:  image.Opaque,
+			Face: face,
+			Dot:  fixed.Point26_6{X: (fixed.I(w) - adv) / 2, Y: baseline},
+		}
+		d.DrawString(string(ch))
+		face.Close()
+		return mask
+	}
+	return nil
+}
+
+// colorGlyph colors the coverage of a glyph with the colors of its rows,
+// white without
+func colorGlyph(mask *image.Alpha, rows []color.RGBA) *image.RGBA {
+	b := mask.Bounds()
+	img := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		c := color.RGBA{0xff, 0xff, 0xff, 0xff}
+		if y < len(rows) {
+			c = rows[y]
+		}
+		for x := b.Min.X; x < b.Max.X; x++ {
+			a := uint16(mask.AlphaAt(x, y).A)
+			// Premultiplied
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(uint16(c.R) * a / 255),
+				uint8(uint16(c.G) * a / 255),
+				uint8(uint16(c.B) * a / 255),
+				uint8(a),
+			})
+		}
+	}
+	return img
+}
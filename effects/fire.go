@@ -0,0 +1,251 @@
+package effects
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed shaders/haze.kage
+var hazeShaderSrc []byte
+
+// Fire buffer resolution relative to the frame: one heat cell covers
+// fireCell x fireCell pixels, over the bottom fireShare of the screen
+const (
+	fireCell  = 4
+	fireShare = 1.0 / 3
+)
+
+// The heat haze covers the fire and as much again above it; its noise
+// rises hazeRise pixels per second at 800x600, in blotches of hazeBlotch
+// pixels
+const (
+	hazeShare  = 2 * fireShare
+	hazeRise   = 60
+	hazeBlotch = 24
+)
+
+// firePalette maps heat to color: black, red, orange, yellow, then
+// white. Cool cells are transparent so the fire can sit over other parts.
+var firePalette = func() [256][4]byte {
+	var p [256][4]byte
+	for i := range p {
+		h := float64(i) / 255
+		r := math.Min(h*3, 1)
+		g := math.Min(math.Max(h*3-1, 0), 1)
+		b := math.Min(math.Max(h*3-2, 0), 1)
+		a := math.Min(h*4, 1)
+		// Premultiplied, as Ebiten images are
+		p[i] = [4]byte{byte(r * a * 255), byte(g * a * 255), byte(b * a * 255), byte(a * 255)}
+	}
+	return p
+}()
+
+// Fire is the classic demoscene flame: the bottom row of a heat buffer
+// is fed with random hot spots, and every step each cell takes the
+// average of the cells below it minus some cooling, so the heat rises
+// and fades. The wind leans the flames sideways. A heat haze above the
+// flames wobbles the layers behind them.
+type Fire struct {
+	ctx    *Context
+	layout Layout
+	rng    *rand.Rand
+	w, h   int
+	heat   []uint8
+	next   []uint8
+	pixels []byte
+	frame  *ebiten.Image
+	steps  float64 // Fractional steps carried between updates
+
+	// Heat haze: the layers behind, copied before the flames are drawn,
+	// are displaced by a scrolling tileable noise
+	hazeShader *ebiten.Shader
+	hazeNoise  *ebiten.Image
+	hazeBehind *ebiten.Image
+	hazeTime   float64 // Seconds, for the noise scroll
+}
+
+// Init sizes the heat buffer for the frame
+func (f *Fire) Init(ctx *Context) error {
+	f.ctx = ctx
+	f.layout = ctx.Layout()
+	if f.rng == nil {
+		f.rng = rand.New(rand.NewSource(1))
+	}
+	f.w = max(f.layout.Width/fireCell, 3)
+	f.h = max(int(float64(f.layout.Height)*fireShare)/fireCell, 2)
+	f.heat = make([]uint8, f.w*f.h)
+	f.next = make([]uint8, f.w*f.h)
+	f.pixels = make([]byte, 4*f.w*f.h)
+	if f.frame != nil {
+		f.frame.Deallocate()
+	}
+	f.frame = ebiten.NewImage(f.w, f.h)
+
+	if f.hazeShader == nil {
+		shader, err := ebiten.NewShader(hazeShaderSrc)
+		if err != nil {
+			return fmt.Errorf("failed to compile haze shader: %w", err)
+		}
+		f.hazeShader = shader
+	}
+	for _, img := range []*ebiten.Image{f.hazeNoise, f.hazeBehind} {
+		if img != nil {
+			img.Deallocate()
+		}
+	}
+	hw, hh := f.layout.Width, max(int(float64(f.layout.Height)*hazeShare), 1)
+	f.hazeNoise = ebiten.NewImageFromImage(hazeNoise(hw, hh, hazeBlotch*f.layout.ScaleY, f.rng))
+	f.hazeBehind = ebiten.NewImage(hw, hh)
+	return nil
+}
+
+// hazeNoise renders two channels of value noise, red and green, that
+// tile across the edges of a w x h image
+func hazeNoise(w, h int, blotch float64, rng *rand.Rand) *image.RGBA {
+	gw, gh := max(int(float64(w)/blotch), 1), max(int(float64(h)/blotch), 1)
+	var grids [2][]float64
+	for c := range grids {
+		grids[c] = make([]float64, gw*gh)
+		for i := range grids[c] {
+			grids[c][i] = rng.Float64()
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)*float64(gw)/float64(w), float64(y)*float64(gh)/float64(h)
+			ix, iy := int(fx), int(fy)
+			tx, ty := smooth(fx-float64(ix)), smooth(fy-float64(iy))
+			var v [2]uint8
+			for c, grid := range grids {
+				// The grid wraps around, so the noise tiles
+				at := func(i, j int) float64 { return grid[(j%gh)*gw+i%gw] }
+				top := at(ix, iy)*(1-tx) + at(ix+1, iy)*tx
+				bottom := at(ix, iy+1)*(1-tx) + at(ix+1, iy+1)*tx
+				v[c] = uint8((top*(1-ty) + bottom*ty) * 255)
+			}
+			img.SetRGBA(x, y, color.RGBA{v[0], v[1], 128, 255})
+		}
+	}
+	return img
+}
+
+// Update runs one fire step per frame at FrameRate
+func (f *Fire) Update(dt float64) {
+	f.hazeTime += dt
+	f.steps += frames(dt)
+	for ; f.steps >= 1; f.steps-- {
+		f.step()
+	}
+}
+
+// step feeds the bottom row and propagates the heat one row up
+func (f *Fire) step() {
+	intensity := f.ctx.Param("fire.intensity", 1)
+	wind := f.ctx.Param("fire.wind", 0)
+	w, h := f.w, f.h
+
+	// Hot spots on the bottom row, more and hotter with intensity
+	bottom := f.heat[(h-1)*w:]
+	for x := range bottom {
+		if f.rng.Float64() < 0.5*intensity {
+			bottom[x] = uint8(min(255, 200+f.rng.Intn(56)))
+		} else {
+			bottom[x] = uint8(float64(bottom[x]) * 0.6)
+		}
+	}
+
+	// The flames must reach the top of the buffer at full intensity
+	cooling := 6 * 32 / float64(h) / math.Max(intensity, 0.1)
+	lean, leanChance := 1, math.Min(math.Abs(wind)/2, 1)
+	if wind < 0 {
+		lean = -1
+	}
+	for y := 0; y < h-1; y++ {
+		for x := 0; x < w; x++ {
+			// Sample the cells below, shifted against the wind
+			sx := x
+			if f.rng.Float64() < leanChance {
+				sx -= lean
+			}
+			below := (y + 1) * w
+			sum := int(f.heat[below+wrapIndex(sx-1, w)]) +
+				int(f.heat[below+wrapIndex(sx, w)]) +
+				int(f.heat[below+wrapIndex(sx+1, w)])
+			if y+2 < h {
+				sum += int(f.heat[below+w+wrapIndex(sx, w)])
+			} else {
+				sum += int(f.heat[below+wrapIndex(sx, w)])
+			}
+			v := float64(sum)/4 - cooling*f.rng.Float64()*2
+			f.next[y*w+x] = uint8(math.Max(v, 0))
+		}
+	}
+	copy(f.next[(h-1)*w:], bottom)
+	f.heat, f.next = f.next, f.heat
+}
+
+// wrapIndex wraps x into [0, n)
+func wrapIndex(x, n int) int {
+	if x < 0 {
+		return x + n
+	}
+	if x >= n {
+		return x - n
+	}
+	return x
+}
+
+// Draw wobbles the layers behind through the heat haze, then scales the
+// fire up over the bottom of the screen
+func (f *Fire) Draw(screen *ebiten.Image) {
+	f.drawHaze(screen)
+
+	for i, v := range f.heat {
+		copy(f.pixels[4*i:4*i+4], firePalette[v][:])
+	}
+	f.frame.WritePixels(f.pixels)
+
+	l := f.layout
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(l.Width)/float64(f.w), fireCell)
+	op.GeoM.Translate(0, float64(l.Height-f.h*fireCell))
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(f.frame, op)
+}
+
+// drawHaze displaces what is already drawn above the bottom of the
+// screen, fire.haze pixels at most at 800x600
+func (f *Fire) drawHaze(screen *ebiten.Image) {
+	amount := f.ctx.Param("fire.haze", 3) * f.layout.ScaleY
+	if amount <= 0 {
+		return
+	}
+	b := f.hazeBehind.Bounds()
+	top := f.layout.Height - b.Dy()
+	f.hazeBehind.Clear()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(0, float64(-top))
+	f.hazeBehind.DrawImage(screen, op)
+
+	// The noise rises, and drifts with the wind
+	rise := f.hazeTime * hazeRise * f.layout.ScaleY
+	drift := -f.hazeTime * f.ctx.Param("fire.wind", 0) * hazeRise / 2 * f.layout.ScaleX
+	sop := &ebiten.DrawRectShaderOptions{}
+	sop.GeoM.Translate(0, float64(top))
+	sop.Images[0] = f.hazeBehind
+	sop.Images[1] = f.hazeNoise
+	sop.Uniforms = map[string]any{
+		"Amount": float32(amount),
+		"Offset": []float32{float32(math.Mod(drift, float64(b.Dx()))), float32(math.Mod(rise, float64(b.Dy())))},
+	}
+	sop.Blend = ebiten.BlendCopy
+	screen.DrawRectShader(b.Dx(), b.Dy(), f.hazeShader, sop)
+}
@@ -0,0 +1,396 @@
+package effects
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// BitmapFont is a font drawn in a grid of equal cells, read left to right
+// and top to bottom through its character map
+type BitmapFont struct {
+	Image      *ebiten.Image
+	CharWidth  int
+	CharHeight int
+	Chars      FontMap
+
+	fallback *ebiten.Image
+	rows     []color.RGBA // Colors of the rows of the cells, for rowColors
+}
+
+// Glyph returns the image of a character, false for characters the font
+// cannot show
+func (f *BitmapFont) Glyph(ch rune) (*ebiten.Image, bool) {
+	i, ok := f.Chars.Index(ch)
+	if !ok {
+		return nil, false
+	}
+	b := f.Image.Bounds()
+	perRow := max(b.Dx()/f.CharWidth, 1)
+	x := b.Min.X + i%perRow*f.CharWidth
+	y := b.Min.Y + i/perRow*f.CharHeight
+	return f.Image.SubImage(image.Rect(x, y, x+f.CharWidth, y+f.CharHeight)).(*ebiten.Image), true
+}
+
+// Fallback returns the glyph drawn for characters the font cannot show: a
+// hollow box filling most of a cell, built on first use
+func (f *BitmapFont) Fallback() *ebiten.Image {
+	if f.fallback == nil {
+		f.fallback = newFallbackGlyph(f.CharWidth, f.CharHeight)
+	}
+	return f.fallback
+}
+
+// rowColors returns the color of each row of the cells of the font, the
+// average of the pixels of its glyphs on that row, read on first use. Rows
+// no glyph covers take the average of the whole font.
+func (f *BitmapFont) rowColors() []color.RGBA {
+	if f.rows != nil {
+		return f.rows
+	}
+	b := f.Image.Bounds()
+	pix := make([]byte, 4*b.Dx()*b.Dy())
+	f.Image.ReadPixels(pix)
+
+	// Sums of the premultiplied channels, alpha last, per row and overall
+	sums := make([][4]int, f.CharHeight+1)
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			p := pix[4*(y*b.Dx()+x):]
+			for c := range 4 {
+				sums[y%f.CharHeight][c] += int(p[c])
+				sums[f.CharHeight][c] += int(p[c])
+			}
+		}
+	}
+	average := func(s [4]int) color.RGBA {
+		if s[3] == 0 {
+			return color.RGBA{0xff, 0xff, 0xff, 0xff}
+		}
+		return color.RGBA{uint8(s[0] * 255 / s[3]), uint8(s[1] * 255 / s[3]), uint8(s[2] * 255 / s[3]), 0xff}
+	}
+	f.rows = make([]color.RGBA, f.CharHeight)
+	for y := range f.rows {
+		s := sums[y]
+		if s[3] == 0 {
+			s = sums[f.CharHeight]
+		}
+		f.rows[y] = average(s)
+	}
+	return f.rows
+}
+
+// fallbackColor is the color of the box of missing characters
+var fallbackColor = color.RGBA{0xc0, 0xc0, 0xc0, 0xff}
+
+// newFallbackGlyph draws the box of missing characters in a w x h cell,
+// inset by an eighth of the cell and outlined a sixteenth of it thick
+func newFallbackGlyph(w, h int) *ebiten.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	box := image.Rect(w/8, h/8, w-w/8, h-h/8)
+	t := max(h/16, 1)
+	draw.Draw(img, box, image.NewUniform(fallbackColor), image.Point{}, draw.Src)
+	draw.Draw(img, box.Inset(t), image.Transparent, image.Point{}, draw.Src)
+	return ebiten.NewImageFromImage(img)
+}
+
+// LoadBitmapFont reads a font from its descriptor, which names the image
+// of the font, relative to the descriptor, its cell size and the
+// characters of each row of cells, spaces marking empty cells:
+//
+//	# 8x8 font, 16 characters per row
+//	image topaz.png
+//	cell 8 8
+//	row ABCDEFGHIJKLMNOP
+//	row QRSTUVWXYZ0123 !
+//
+// Lines starting with '#' are comments.
+func LoadBitmapFont(fsys fs.FS, name string) (*BitmapFont, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	var imagePath string
+	var w, h int
+	var rows []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text := sc.Text()
+		if strings.HasPrefix(text, "#") || strings.TrimSpace(text) == "" {
+			continue
+		}
+		if row, ok := strings.CutPrefix(text, "row "); ok {
+			rows = append(rows, row)
+			continue
+		}
+		fields := strings.Fields(text)
+		switch {
+		case fields[0] == "image" && len(fields) == 2:
+			imagePath = path.Join(path.Dir(name), fields[1])
+		case fields[0] == "cell" && len(fields) == 3:
+			w, err = strconv.Atoi(fields[1])
+			if err == nil {
+				h, err = strconv.Atoi(fields[2])
+			}
+			if err != nil || w < 1 || h < 1 {
+				return nil, fmt.Errorf("%s:%d: invalid cell size", name, line)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: expected \"image <path>\", \"cell <width> <height>\" or \"row <characters>\"", name, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if imagePath == "" || w == 0 || len(rows) == 0 {
+		return nil, fmt.Errorf("%s: a font needs an image, a cell size and rows", name)
+	}
+
+	img, err := DecodeImage(fsys, imagePath)
+	if err != nil {
+		return nil, err
+	}
+	return &BitmapFont{
+		Image:      ebiten.NewImageFromImage(img),
+		CharWidth:  w,
+		CharHeight: h,
+		Chars:      NewFontMap(max(img.Bounds().Dx()/w, 1), rows...),
+	}, nil
+}
+
+// FontMap maps characters to the cells of a bitmap font, numbered left to
+// right and top to bottom. Characters missing from the map are looked up
+// again uppercased, then folded to the letter or mark they are written
+// with, so fonts without lowercase or accents still show them.
+type FontMap map[rune]int
+
+// NewFontMap builds the map of a font with perRow cells per row from the
+// characters of each row, in order; spaces mark empty cells
+func NewFontMap(perRow int, rows ...string) FontMap {
+	m := FontMap{}
+	for r, row := range rows {
+		for i, ch := range []rune(row) {
+			if ch != ' ' {
+				m[ch] = r*perRow + i
+			}
+		}
+	}
+	return m
+}
+
+// Index returns the cell of a character, false for characters the font
+// cannot show
+func (m FontMap) Index(ch rune) (int, bool) {
+	for _, c := range [...]rune{ch, unicode.ToUpper(ch), charFolds[ch], charFolds[unicode.ToUpper(ch)]} {
+		if i, ok := m[c]; ok && c != 0 {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// charFolds maps accented letters and typographic marks to the plain
+// character written in their place
+var charFolds = newCharFolds(map[rune]string{
+	'A':  "ÀÁÂÃÄÅĀĂĄ",
+	'C':  "ÇĆĈĊČ",
+	'D':  "ĎĐ",
+	'E':  "ÈÉÊËĒĔĖĘĚ",
+	'G':  "ĜĞĠĢ",
+	'I':  "ÌÍÎÏĨĪĬĮİ",
+	'N':  "ÑŃŅŇ",
+	'O':  "ÒÓÔÕÖØŌŎŐ",
+	'R':  "ŔŖŘ",
+	'S':  "ŚŜŞŠ",
+	'T':  "ŢŤ",
+	'U':  "ÙÚÛÜŨŪŬŮŰŲ",
+	'Y':  "ÝŸŶ",
+	'Z':  "ŹŻŽ",
+	'\'': "‘’`´",
+	'-':  "‐‑‒–—",
+	'.':  "…",
+	'(':  "[{<",
+	')':  "]}>",
+	',':  ";",
+})
+
+// newCharFolds inverts the table of characters folded to each character
+func newCharFolds(folds map[rune]string) map[rune]rune {
+	m := map[rune]rune{}
+	for to, from := range folds {
+		for _, ch := range from {
+			m[ch] = to
+		}
+	}
+	return m
+}
+
+// soapFontChars lays out the soap font as NewSoapFont completes it: the
+// rows of the bitmap, then the punctuation and accented capitals composed
+// from its glyphs into the free cells
+var soapFontChars = []string{
+	"ABCDEFGHIJ",
+	"KLMNOPQRST",
+	"UVWXYZ0123",
+	"456789(),.",
+	"!?:'-/ÀÂÄÉ",
+	"ÈÊËÎÏÔÖÙÛÜ",
+	"Ç",
+}
+
+// SoapFontMap is the character map of the soap font
+var SoapFontMap = NewFontMap(10, soapFontChars...)
+
+// soapCell is the size of the soap font cells
+const soapCell = 32
+
+// glyphPiece draws part of a glyph into a cell of a composed glyph,
+// scaled from the source rectangle to the destination rectangle and
+// sheared, the top shifted right by shear pixels per row
+type glyphPiece struct {
+	src   rune
+	from  image.Rectangle // In the source cell
+	to    image.Rectangle // In the composed cell
+	shear float64
+}
+
+// Pieces of the soap font the missing glyphs are composed from
+var (
+	soapDot   = image.Rect(10, 14, 22, 30) // The full stop
+	soapStem  = image.Rect(9, 2, 23, 23)   // The stroke of the exclamation mark
+	soapPoint = image.Rect(9, 23, 23, 32)  // The dot of the exclamation mark
+	soapComma = image.Rect(8, 14, 24, 32)  // The comma
+)
+
+// soapPunctuation composes the punctuation the soap font lacks
+var soapPunctuation = map[rune][]glyphPiece{
+	'?': {
+		{'2', image.Rect(0, 0, 32, 18), image.Rect(2, 0, 30, 17), 0},
+		{'!', image.Rect(9, 12, 23, 23), image.Rect(10, 16, 22, 23), 0},
+		{'!', soapPoint, image.Rect(9, 23, 23, 32), 0},
+	},
+	':':  {{'.', soapDot, image.Rect(11, 4, 21, 17), 0}, {'.', soapDot, image.Rect(11, 18, 21, 31), 0}},
+	'\'': {{',', soapComma, image.Rect(10, 0, 22, 14), 0}},
+	'-':  {{'.', soapDot, image.Rect(5, 12, 27, 22), 0}},
+	'/':  {{'!', soapStem, image.Rect(4, 0, 16, 32), 0.5}},
+}
+
+// Combining marks of the accented capitals
+const (
+	accentAcute      = '\u0301'
+	accentGrave      = '\u0300'
+	accentCircumflex = '\u0302'
+	accentDiaeresis  = '\u0308'
+	accentCedilla    = '\u0327'
+)
+
+// soapAccents are the marks drawn over the squashed capitals
+var soapAccents = map[rune][]glyphPiece{
+	accentAcute:      {{'.', soapDot, image.Rect(12, 0, 18, 7), 0.8}},
+	accentGrave:      {{'.', soapDot, image.Rect(14, 0, 20, 7), -0.8}},
+	accentCircumflex: {{'.', soapDot, image.Rect(9, 1, 15, 7), 1}, {'.', soapDot, image.Rect(17, 1, 23, 7), -1}},
+	accentDiaeresis:  {{'.', soapDot, image.Rect(8, 1, 14, 7), 0}, {'.', soapDot, image.Rect(18, 1, 24, 7), 0}},
+	accentCedilla:    {{',', soapComma, image.Rect(11, 24, 21, 32), 0}},
+}
+
+// soapAccented are the accented capitals of the completed soap font, as
+// their letter and mark
+var soapAccented = map[rune][2]rune{
+	'À': {'A', accentGrave}, 'Â': {'A', accentCircumflex}, 'Ä': {'A', accentDiaeresis},
+	'É': {'E', accentAcute}, 'È': {'E', accentGrave}, 'Ê': {'E', accentCircumflex}, 'Ë': {'E', accentDiaeresis},
+	'Î': {'I', accentCircumflex}, 'Ï': {'I', accentDiaeresis},
+	'Ô': {'O', accentCircumflex}, 'Ö': {'O', accentDiaeresis},
+	'Ù': {'U', accentGrave}, 'Û': {'U', accentCircumflex}, 'Ü': {'U', accentDiaeresis},
+	'Ç': {'C', accentCedilla},
+}
+
+// NewSoapFont completes the soap font bitmap: the question mark, colon,
+// apostrophe, dash and slash, and the accented capitals of French, are
+// composed from pieces of its glyphs into the free cells, as laid out by
+// SoapFontMap
+func NewSoapFont(src image.Image) *image.RGBA {
+	sb := src.Bounds()
+	font := image.NewRGBA(image.Rect(0, 0, sb.Dx(), len(soapFontChars)*soapCell))
+	draw.Draw(font, sb.Sub(sb.Min), src, sb.Min, draw.Src)
+
+	cell := func(ch rune) image.Point {
+		i := SoapFontMap[ch]
+		return image.Pt(i%10*soapCell, i/10*soapCell)
+	}
+	glyph := func(ch rune) image.Rectangle {
+		return image.Rectangle{cell(ch), cell(ch).Add(image.Pt(soapCell, soapCell))}
+	}
+	compose := func(ch rune, pieces []glyphPiece) {
+		for _, p := range pieces {
+			drawPiece(font, cell(ch), src, sb.Min.Add(cell(p.src)), p)
+		}
+	}
+	for _, row := range soapFontChars[4:] {
+		for _, ch := range row {
+			// The free cells hold stray pixels of the glyphs above
+			draw.Draw(font, glyph(ch), image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	for ch, pieces := range soapPunctuation {
+		compose(ch, pieces)
+	}
+	for ch, parts := range soapAccented {
+		// The capital is squashed below its accent, or above its cedilla
+		to := image.Rect(0, 8, soapCell, soapCell)
+		if parts[1] == accentCedilla {
+			to = image.Rect(0, 0, soapCell, 25)
+		}
+		compose(ch, []glyphPiece{{parts[0], image.Rect(0, 0, soapCell, soapCell), to, 0}})
+		compose(ch, soapAccents[parts[1]])
+	}
+	return font
+}
+
+// drawPiece draws a glyph piece over the cell of dst at at, from the cell
+// of src at from, sampling the nearest source pixel
+func drawPiece(dst *image.RGBA, at image.Point, src image.Image, from image.Point, p glyphPiece) {
+	fw, fh := float64(p.from.Dx()), float64(p.from.Dy())
+	tw, th := float64(p.to.Dx()), float64(p.to.Dy())
+	for y := p.to.Min.Y; y < p.to.Max.Y; y++ {
+		shift := p.shear * float64(p.to.Max.Y-1-y)
+		for x := 0; x < soapCell; x++ {
+			u := (float64(x) - float64(p.to.Min.X) - shift) * fw / tw
+			v := (float64(y-p.to.Min.Y) + 0.5) * fh / th
+			if u < 0 || u >= fw {
+				continue
+			}
+			c := color.RGBAModel.Convert(src.At(from.X+p.from.Min.X+int(u), from.Y+p.from.Min.Y+int(v))).(color.RGBA)
+			if c.A == 0 {
+				continue
+			}
+			d := dst.RGBAAt(at.X+x, at.Y+y)
+			// Over, premultiplied
+			k := 255 - uint16(c.A)
+			dst.SetRGBA(at.X+x, at.Y+y, color.RGBA{
+				c.R + uint8(uint16(d.R)*k/255),
+				c.G + uint8(uint16(d.G)*k/255),
+				c.B + uint8(uint16(d.B)*k/255),
+				c.A + uint8(uint16(d.A)*k/255),
+			})
+		}
+	}
+}
+
+// loadSoapFont decodes and completes the soap font
+func loadSoapFont(assets fs.FS) (image.Image, error) {
+	img, err := DecodeImage(assets, AtlasFont)
+	if err != nil {
+		return nil, err
+	}
+	return NewSoapFont(img), nil
+}
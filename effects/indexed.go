@@ -0,0 +1,147 @@
+package effects
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed shaders/indexed.kage
+var indexedShaderSrc []byte
+
+// indexedShader resolves the indices of every surface, compiled on first
+// use
+var indexedShader *ebiten.Shader
+
+// IndexedSurface is an 8-bit indexed-color buffer with a 256-color
+// palette, like the screens of the ST and the Amiga. The palette is
+// uploaded as a 256x1 texture and the indices resolved through it in a
+// shader when the surface is drawn, so changing or cycling palette
+// entries recolors every pixel using them at no cost: waterfalls flowing
+// and outlines glowing without touching a pixel.
+type IndexedSurface struct {
+	Palette [256]color.RGBA // Straight alpha; entry 0 is transparent by default
+
+	w, h     int
+	pix      []uint8
+	dirty    bool // Indices changed since the last upload
+	indices  *ebiten.Image
+	palette  *ebiten.Image
+	upload   []byte
+	vertices [4]ebiten.Vertex
+}
+
+// NewIndexedSurface allocates a w x h surface, every pixel index 0
+func NewIndexedSurface(w, h int) (*IndexedSurface, error) {
+	if indexedShader == nil {
+		shader, err := ebiten.NewShader(indexedShaderSrc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile indexed color shader: %w", err)
+		}
+		indexedShader = shader
+	}
+	return &IndexedSurface{
+		w:       w,
+		h:       h,
+		pix:     make([]uint8, w*h),
+		dirty:   true,
+		indices: ebiten.NewImage(w, h),
+		palette: ebiten.NewImage(256, 1),
+		upload:  make([]byte, 4*w*h),
+	}, nil
+}
+
+// Bounds returns the size of the surface
+func (s *IndexedSurface) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.w, s.h)
+}
+
+// Set sets the color index of a pixel; pixels outside are ignored
+func (s *IndexedSurface) Set(x, y int, index uint8) {
+	if x < 0 || y < 0 || x >= s.w || y >= s.h {
+		return
+	}
+	s.pix[y*s.w+x] = index
+	s.dirty = true
+}
+
+// At returns the color index of a pixel, 0 outside
+func (s *IndexedSurface) At(x, y int) uint8 {
+	if x < 0 || y < 0 || x >= s.w || y >= s.h {
+		return 0
+	}
+	return s.pix[y*s.w+x]
+}
+
+// Fill sets every pixel to index
+func (s *IndexedSurface) Fill(index uint8) {
+	for i := range s.pix {
+		s.pix[i] = index
+	}
+	s.dirty = true
+}
+
+// Cycle rotates the palette entries first to last, inclusive, by steps:
+// with 1, each entry takes the color of the one before it and first takes
+// the color of last
+func (s *IndexedSurface) Cycle(first, last, steps int) {
+	n := last - first + 1
+	if first < 0 || last > 255 || n < 2 {
+		return
+	}
+	steps = (steps%n + n) % n
+	if steps == 0 {
+		return
+	}
+	var ring [256]color.RGBA
+	copy(ring[:n], s.Palette[first:last+1])
+	for i := range n {
+		s.Palette[first+(i+steps)%n] = ring[i]
+	}
+}
+
+// Draw uploads the indices when changed, and the palette, and draws the
+// surface onto dst transformed by geoM
+func (s *IndexedSurface) Draw(dst *ebiten.Image, geoM ebiten.GeoM) {
+	if s.dirty {
+		for i, index := range s.pix {
+			s.upload[4*i] = index
+			s.upload[4*i+3] = 0xff
+		}
+		s.indices.WritePixels(s.upload)
+		s.dirty = false
+	}
+
+	var pal [4 * 256]byte
+	for i, c := range s.Palette {
+		// Premultiplied, as images hold them
+		a := uint16(c.A)
+		pal[4*i] = uint8(uint16(c.R) * a / 255)
+		pal[4*i+1] = uint8(uint16(c.G) * a / 255)
+		pal[4*i+2] = uint8(uint16(c.B) * a / 255)
+		pal[4*i+3] = c.A
+	}
+	s.palette.WritePixels(pal[:])
+
+	for i, c := range [4][2]int{{0, 0}, {s.w, 0}, {0, s.h}, {s.w, s.h}} {
+		x, y := geoM.Apply(float64(c[0]), float64(c[1]))
+		s.vertices[i] = ebiten.Vertex{
+			DstX: float32(x), DstY: float32(y),
+			SrcX: float32(c[0]), SrcY: float32(c[1]),
+			ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1,
+		}
+	}
+	op := &ebiten.DrawTrianglesShaderOptions{}
+	op.Images[0] = s.indices
+	op.Images[1] = s.palette
+	dst.DrawTrianglesShader(s.vertices[:], []uint16{0, 1, 2, 1, 2, 3}, indexedShader, op)
+}
+
+// Deallocate releases the images of the surface
+func (s *IndexedSurface) Deallocate() {
+	s.indices.Deallocate()
+	s.palette.Deallocate()
+}
@@ -0,0 +1,98 @@
+package effects
+
+import (
+	"image"
+	"math"
+)
+
+// Reference resolution the effect constants were tuned for
+const (
+	RefWidth  = 800
+	RefHeight = 600
+)
+
+// Scroller deformation parameters at the reference resolution, shared by
+// the CPU and GPU paths (see Layout for the per-resolution values)
+const (
+	scrollSpeed       = 4.0
+	scrollLines       = 32 // 2-pixel lines deformed horizontally
+	scrollColumnWidth = 16 // Width of the vertically waving columns
+	scrollWaveAmp     = 35.0
+	scrollWaveFreq    = 0.1
+)
+
+// Layout holds the internal rendering resolution and the effect constants
+// derived from it. Effects read their sizes from the layout rather than
+// from the 800x600 reference constants so they adapt to the low-res mode.
+type Layout struct {
+	Width  int
+	Height int
+
+	// Scale factors relative to the 800x600 reference resolution
+	ScaleX float64
+	ScaleY float64
+
+	CopperBars int // One bar every 2 lines down the screen
+	CubeSize   float64
+
+	FontScale         float64 // Scroll font magnification, 2x at 800x600
+	ScrollHeight      int
+	ScrollLineHeight  int
+	ScrollColumnWidth int
+	ScrollWaveAmp     float64
+	ScrollBaseY       float64
+	ScrollSpeed       float64
+
+	// Safe is the area the logo and the scroller keep within, the whole
+	// frame unless inset for overscan
+	Safe image.Rectangle
+}
+
+// NewLayout derives the effect constants for a width x height frame
+func NewLayout(width, height int) Layout {
+	sx := float64(width) / RefWidth
+	sy := float64(height) / RefHeight
+
+	// The font only scales by whole steps to keep pixels crisp
+	fontScale := math.Max(1, math.Round(2*sx))
+	lineHeight := int(fontScale)
+	scrollH := scrollLines * lineHeight
+	amp := scrollWaveAmp * sy
+
+	return Layout{
+		Width:             width,
+		Height:            height,
+		ScaleX:            sx,
+		ScaleY:            sy,
+		CopperBars:        height / 2,
+		CubeSize:          20 * math.Min(sx, sy),
+		FontScale:         fontScale,
+		ScrollHeight:      scrollH,
+		ScrollLineHeight:  lineHeight,
+		ScrollColumnWidth: scrollColumnWidth * lineHeight / 2,
+		ScrollWaveAmp:     amp,
+		ScrollBaseY:       float64(height) - 2*amp - float64(scrollH) - 6*sy,
+		ScrollSpeed:       scrollSpeed * fontScale / 2,
+		Safe:              image.Rect(0, 0, width, height),
+	}
+}
+
+// Inset returns the layout with its safe area inset by a fraction of the
+// width and height on each side, the scroller raised to clear its bottom
+// edge. The scroller still runs the full width, entering and leaving the
+// screen at the sides.
+func (l Layout) Inset(f float64) Layout {
+	if f <= 0 {
+		return l
+	}
+	dx, dy := int(math.Round(float64(l.Width)*f)), int(math.Round(float64(l.Height)*f))
+	l.Safe = image.Rect(dx, dy, l.Width-dx, l.Height-dy)
+	bottom := float64(l.Safe.Max.Y) - 6*l.ScaleY
+	l.ScrollBaseY = math.Min(l.ScrollBaseY, bottom-2*l.ScrollWaveAmp-float64(l.ScrollHeight))
+	return l
+}
+
+// CharWidth returns the on-screen width of a scroll font character
+func (l Layout) CharWidth() float64 {
+	return 32 * l.FontScale
+}
@@ -0,0 +1,114 @@
+package effects
+
+import (
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// LogoSine moves the DMA logo from side to side on a sine curve
+type LogoSine struct {
+	Speed float64 // Animation speed multiplier, 1 when zero
+
+	ctx    *Context
+	layout Layout
+	logo   *ebiten.Image
+	pos    float64
+
+	// On "beat" syncs the logo swings to the other side of the screen
+	// instead of free-running
+	target    float64 // Swing position eased to while synced
+	sinceBeat float64 // Seconds since the last beat
+	synced    bool
+}
+
+// beatTimeout is how long without a beat before free-running resumes
+const beatTimeout = 2.0
+
+// Init loads the logo image
+func (l *LogoSine) Init(ctx *Context) error {
+	l.ctx = ctx
+	l.layout = ctx.Layout()
+
+	if l.logo == nil {
+		logo, err := LoadImage(ctx.Assets, "assets/logo.png")
+		if err != nil {
+			return err
+		}
+		l.logo = logo
+	}
+	return nil
+}
+
+// Update advances the logo along its sine curve, or eases it towards
+// the side it swings to on the beat
+func (l *LogoSine) Update(dt float64) {
+	if l.synced {
+		l.sinceBeat += dt
+		l.synced = l.sinceBeat < beatTimeout
+		l.pos += (l.target - l.pos) * math.Min(1, 0.15*speed(l.Speed)*frames(dt))
+		return
+	}
+	l.pos += l.ctx.Param("logo.speed", 0.05) * speed(l.Speed) * frames(dt)
+}
+
+// Rewind runs the free sine backwards; a logo swinging to the beats holds
+// still
+func (l *LogoSine) Rewind(dt float64) {
+	if !l.synced {
+		l.pos -= l.ctx.Param("logo.speed", 0.05) * speed(l.Speed) * frames(dt)
+	}
+}
+
+// Sync swings the logo to the next side of the screen on each beat
+func (l *LogoSine) Sync(name string) {
+	if name != "beat" {
+		return
+	}
+	from := l.pos
+	if l.synced {
+		from = l.target
+	}
+	// Sides are the extremes of the sine, at pi/2 + k*pi
+	l.target = math.Pi/2 + (math.Floor((from-math.Pi/2)/math.Pi)+1)*math.Pi
+	l.sinceBeat = 0
+	l.synced = true
+}
+
+// Draw draws the logo at the top of the safe area
+func (l *LogoSine) Draw(screen *ebiten.Image) {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(l.layout.ScaleX, l.layout.ScaleX)
+	op.GeoM.Translate(l.left(), float64(l.layout.Safe.Min.Y))
+	screen.DrawImage(l.logo, op)
+}
+
+// left returns the x position of the logo on screen, swinging across the
+// safe area
+func (l *LogoSine) left() float64 {
+	safe := l.layout.Safe
+	wl := float64(l.logo.Bounds().Dx()) * l.layout.ScaleX
+	room := float64(safe.Dx()) - wl
+	return float64(safe.Min.X) + room/2 + math.Sin(l.pos)*room/2
+}
+
+// Center returns the center of the logo as fractions of the screen size,
+// for effects following it
+func (l *LogoSine) Center() (x, y float64) {
+	if l.logo == nil {
+		return 0.5, 0
+	}
+	b := l.logo.Bounds()
+	lay := l.layout
+	x = (l.left() + float64(b.Dx())*lay.ScaleX/2) / float64(lay.Width)
+	y = (float64(lay.Safe.Min.Y) + float64(b.Dy())*lay.ScaleX/2) / float64(lay.Height)
+	return x, y
+}
+
+// speed returns a speed multiplier, treating zero as the default of 1
+func speed(s float64) float64 {
+	if s == 0 {
+		return 1
+	}
+	return s
+}
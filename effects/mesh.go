@@ -0,0 +1,312 @@
+package effects
+
+import (
+	"image"
+	"math"
+	"sort"
+)
+
+// Mesh is a polygon mesh. Faces are convex polygons listing vertex
+// indices in an order such that the cross product of their first two
+// edges points out of the mesh; the renderer relies on it to cull faces
+// turned away from the camera.
+type Mesh struct {
+	Vertices [][3]float64
+	Faces    [][]int
+
+	// UVs are the texture coordinates of each face corner, 0 to 1, in
+	// the same shape as Faces. Faces without UVs map the texture to
+	// their corners.
+	UVs [][][2]float32
+
+	// LODs are reduced versions of the mesh, see AddLOD
+	LODs []LOD
+
+	radius float64 // Bounding radius, computed on first use
+}
+
+// LOD is a reduced version of a mesh, drawn instead of it when the
+// object covers at most MaxRadius pixels on screen
+type LOD struct {
+	MaxRadius float64
+	Mesh      *Mesh
+}
+
+// AddLOD registers a reduced version of m used up to maxRadius projected
+// pixels, and returns m so levels can be chained after a generator
+func (m *Mesh) AddLOD(maxRadius float64, lower *Mesh) *Mesh {
+	m.LODs = append(m.LODs, LOD{MaxRadius: maxRadius, Mesh: lower})
+	return m
+}
+
+// Radius returns the distance from the origin to the farthest vertex
+func (m *Mesh) Radius() float64 {
+	if m.radius == 0 {
+		for _, v := range m.Vertices {
+			m.radius = math.Max(m.radius, math.Sqrt(v[0]*v[0]+v[1]*v[1]+v[2]*v[2]))
+		}
+	}
+	return m.radius
+}
+
+// Level returns the mesh to draw for an object covering radius pixels on
+// screen: the coarsest level allowed at that size, or m itself
+func (m *Mesh) Level(radius float64) *Mesh {
+	level, best := m, math.Inf(1)
+	for _, l := range m.LODs {
+		if radius <= l.MaxRadius && l.MaxRadius < best {
+			level, best = l.Mesh, l.MaxRadius
+		}
+	}
+	return level
+}
+
+// addQuad adds a quad centered on c spanning ±u and ±v; its outward
+// normal is u × v
+func (m *Mesh) addQuad(c, u, v [3]float64, uv [4][2]float32) {
+	base := len(m.Vertices)
+	for _, s := range [4][2]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+		m.Vertices = append(m.Vertices, [3]float64{
+			c[0] + s[0]*u[0] + s[1]*v[0],
+			c[1] + s[0]*u[1] + s[1]*v[1],
+			c[2] + s[0]*u[2] + s[1]*v[2],
+		})
+	}
+	m.Faces = append(m.Faces, []int{base, base + 1, base + 2, base + 3})
+	m.UVs = append(m.UVs, uv[:])
+}
+
+// boxSides selects the sides of a box added by addBox
+type boxSides uint8
+
+const (
+	sideLeft boxSides = 1 << iota
+	sideRight
+	sideTop
+	sideBottom
+	sideFront // Towards the camera, -z
+	sideBack
+
+	allSides = sideLeft | sideRight | sideTop | sideBottom | sideFront | sideBack
+)
+
+// cornerUVs maps a whole texture onto a quad
+var cornerUVs = [4][2]float32{{0, 0}, {1, 0}, {1, 1}, {0, 1}}
+
+// addBox adds the selected sides of an axis-aligned box. Front and back
+// sides get the given UVs, the other sides the whole texture.
+func (m *Mesh) addBox(lo, hi [3]float64, sides boxSides, frontUV, backUV [4][2]float32) {
+	c := [3]float64{(lo[0] + hi[0]) / 2, (lo[1] + hi[1]) / 2, (lo[2] + hi[2]) / 2}
+	h := [3]float64{(hi[0] - lo[0]) / 2, (hi[1] - lo[1]) / 2, (hi[2] - lo[2]) / 2}
+	x := [3]float64{h[0], 0, 0}
+	y := [3]float64{0, h[1], 0}
+	z := [3]float64{0, 0, h[2]}
+	at := func(axis int, sign float64) [3]float64 {
+		p := c
+		p[axis] += sign * h[axis]
+		return p
+	}
+
+	if sides&sideRight != 0 {
+		m.addQuad(at(0, 1), y, z, cornerUVs)
+	}
+	if sides&sideLeft != 0 {
+		m.addQuad(at(0, -1), z, y, cornerUVs)
+	}
+	if sides&sideBottom != 0 {
+		m.addQuad(at(1, 1), z, x, cornerUVs)
+	}
+	if sides&sideTop != 0 {
+		m.addQuad(at(1, -1), x, z, cornerUVs)
+	}
+	if sides&sideBack != 0 {
+		m.addQuad(at(2, 1), x, y, backUV)
+	}
+	if sides&sideFront != 0 {
+		m.addQuad(at(2, -1), y, x, frontUV)
+	}
+}
+
+// CubeMesh returns a cube of the given edge length centered on the origin
+func CubeMesh(size float64) *Mesh {
+	m := &Mesh{}
+	h := size / 2
+	m.addBox([3]float64{-h, -h, -h}, [3]float64{h, h, h}, allSides, cornerUVs, cornerUVs)
+	return m
+}
+
+// DodecahedronMesh returns a regular dodecahedron centered on the origin,
+// its corners at the given radius
+func DodecahedronMesh(radius float64) *Mesh {
+	phi := (1 + math.Sqrt(5)) / 2
+	m := &Mesh{}
+	for _, x := range []float64{-1, 1} {
+		for _, y := range []float64{-1, 1} {
+			for _, z := range []float64{-1, 1} {
+				m.Vertices = append(m.Vertices, [3]float64{x, y, z})
+			}
+			// Cyclic permutations of (0, ±1/φ, ±φ)
+			m.Vertices = append(m.Vertices,
+				[3]float64{0, x / phi, y * phi},
+				[3]float64{x / phi, y * phi, 0},
+				[3]float64{x * phi, 0, y / phi})
+		}
+	}
+	k := radius / math.Sqrt(3)
+	for i, v := range m.Vertices {
+		m.Vertices[i] = [3]float64{v[0] * k, v[1] * k, v[2] * k}
+	}
+
+	// The face centers point at the corners of an icosahedron; each face
+	// gathers the 5 corners nearest its center, ordered counter-clockwise
+	// seen from outside
+	for _, a := range []float64{-1, 1} {
+		for _, b := range []float64{-1, 1} {
+			for _, n := range [][3]float64{{0, a * phi, b}, {a * phi, b, 0}, {a, 0, b * phi}} {
+				m.Faces = append(m.Faces, facingCorners(m.Vertices, n, 5))
+			}
+		}
+	}
+	return m
+}
+
+// facingCorners returns the count vertices furthest along the direction
+// n, in counter-clockwise order around it
+func facingCorners(vertices [][3]float64, n [3]float64, count int) []int {
+	idx := make([]int, len(vertices))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		return dot(vertices[idx[i]], n) > dot(vertices[idx[j]], n)
+	})
+	idx = idx[:count]
+
+	// Angles in a basis u, v of the face plane with u × v along n
+	u := sub(vertices[idx[0]], [3]float64{})
+	u = cross(n, cross(u, n))
+	v := cross(n, u)
+	angle := func(i int) float64 {
+		p := vertices[i]
+		return math.Atan2(dot(p, v), dot(p, u))
+	}
+	sort.Slice(idx, func(i, j int) bool {
+		return angle(idx[i]) < angle(idx[j])
+	})
+	return idx
+}
+
+// TorusMesh returns a torus lying in the XZ plane, with the given ring
+// and tube radii, split into rings x sides quads
+func TorusMesh(ring, tube float64, rings, sides int) *Mesh {
+	m := &Mesh{}
+	for i := 0; i < rings; i++ {
+		u := 2 * math.Pi * float64(i) / float64(rings)
+		for j := 0; j < sides; j++ {
+			v := 2 * math.Pi * float64(j) / float64(sides)
+			r := ring + tube*math.Cos(v)
+			m.Vertices = append(m.Vertices, [3]float64{r * math.Cos(u), tube * math.Sin(v), r * math.Sin(u)})
+		}
+	}
+
+	at := func(i, j int) int {
+		return (i%rings)*sides + j%sides
+	}
+	for i := 0; i < rings; i++ {
+		for j := 0; j < sides; j++ {
+			m.Faces = append(m.Faces, []int{at(i, j), at(i, j+1), at(i+1, j+1), at(i+1, j)})
+
+			u0, u1 := float32(i)/float32(rings), float32(i+1)/float32(rings)
+			v0, v1 := float32(j)/float32(sides), float32(j+1)/float32(sides)
+			m.UVs = append(m.UVs, [][2]float32{{u0, v0}, {u0, v1}, {u1, v1}, {u1, v0}})
+		}
+	}
+	return m
+}
+
+// ExtrudeMesh turns the opaque parts of an image into a slab of the
+// given depth, centered on the origin, one unit per pixel. The image is
+// sampled in cells of cell x cell pixels, a cell being solid when most of
+// its pixels are opaque. Front and back faces map the image, so a
+// textured material shows it on the slab.
+func ExtrudeMesh(img image.Image, cell int, depth float64) *Mesh {
+	b := img.Bounds()
+	cols, rows := b.Dx()/cell, b.Dy()/cell
+	solid := make([]bool, cols*rows)
+	for cy := 0; cy < rows; cy++ {
+		for cx := 0; cx < cols; cx++ {
+			opaque := 0
+			for y := 0; y < cell; y++ {
+				for x := 0; x < cell; x++ {
+					if _, _, _, a := img.At(b.Min.X+cx*cell+x, b.Min.Y+cy*cell+y).RGBA(); a >= 0x8000 {
+						opaque++
+					}
+				}
+			}
+			solid[cy*cols+cx] = opaque*2 > cell*cell
+		}
+	}
+	at := func(cx, cy int) bool {
+		return cx >= 0 && cy >= 0 && cx < cols && cy < rows && solid[cy*cols+cx]
+	}
+
+	m := &Mesh{}
+	w, h := float64(cols*cell), float64(rows*cell)
+	cs := float64(cell)
+	for cy := 0; cy < rows; cy++ {
+		for cx := 0; cx < cols; cx++ {
+			if !at(cx, cy) {
+				continue
+			}
+
+			// Front and back cover the whole run of solid cells; the
+			// sides are only where the slab has an edge
+			sides := boxSides(0)
+			if !at(cx-1, cy) {
+				sides |= sideLeft
+			}
+			if !at(cx, cy-1) {
+				sides |= sideTop
+			}
+			if !at(cx, cy+1) {
+				sides |= sideBottom
+			}
+			end := cx
+			for at(end+1, cy) {
+				end++
+			}
+			if at(cx-1, cy) {
+				// Inside a run, front and back are added by its first cell
+				if !at(cx+1, cy) {
+					sides |= sideRight
+				}
+				m.addBox(
+					[3]float64{float64(cx)*cs - w/2, float64(cy)*cs - h/2, -depth / 2},
+					[3]float64{float64(cx+1)*cs - w/2, float64(cy+1)*cs - h/2, depth / 2},
+					sides, cornerUVs, cornerUVs)
+				continue
+			}
+			if end == cx {
+				sides |= sideRight
+			}
+
+			// The run's front and back faces, with image coordinates
+			u0, u1 := float32(cx*cell)/float32(b.Dx()), float32((end+1)*cell)/float32(b.Dx())
+			v0, v1 := float32(cy*cell)/float32(b.Dy()), float32((cy+1)*cell)/float32(b.Dy())
+			// Front corners follow addQuad with u=y, v=x
+			front := [4][2]float32{{u0, v0}, {u0, v1}, {u1, v1}, {u1, v0}}
+			back := [4][2]float32{{u0, v0}, {u1, v0}, {u1, v1}, {u0, v1}}
+			m.addBox(
+				[3]float64{float64(cx)*cs - w/2, float64(cy)*cs - h/2, -depth / 2},
+				[3]float64{float64(end+1)*cs - w/2, float64(cy+1)*cs - h/2, depth / 2},
+				sideFront|sideBack, front, back)
+			if sides != 0 {
+				m.addBox(
+					[3]float64{float64(cx)*cs - w/2, float64(cy)*cs - h/2, -depth / 2},
+					[3]float64{float64(cx+1)*cs - w/2, float64(cy+1)*cs - h/2, depth / 2},
+					sides, cornerUVs, cornerUVs)
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,235 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Shapes the cubes morph between, named by "morph-<shape>" syncs
+const (
+	ShapeCube    = "cube"
+	ShapeSphere  = "sphere"
+	ShapePyramid = "pyramid"
+	ShapeCloud   = "cloud" // The faces shrunk to scattered specks
+)
+
+var morphShapes = []string{ShapeCube, ShapeSphere, ShapePyramid, ShapeCloud}
+
+// morphGrid is how many quads each cube face is split into across, so
+// the faces can bend into the other shapes
+const morphGrid = 3
+
+// morphQuad is a piece of a cube face, its corners on the unit cube
+type morphQuad struct {
+	face    int // Index into cubeFaces and cubeFaceColors
+	corners [4][3]float64
+	center  [3]float64
+	scatter [3]float64 // Where the quad flies to in the cloud
+	outline [4]bool    // Sides of the quad on the edge of its face
+}
+
+// morphQuads splits the cube faces, keeping their outward winding
+var morphQuads = func() []morphQuad {
+	rng := rand.New(rand.NewSource(3))
+	var quads []morphQuad
+	for fi, face := range cubeFaces {
+		a, b, d := cubeCorners[face[0]], cubeCorners[face[1]], cubeCorners[face[3]]
+		at := func(i, j int) [3]float64 {
+			u, v := float64(i)/morphGrid, float64(j)/morphGrid
+			var p [3]float64
+			for k := range p {
+				p[k] = a[k] + (b[k]-a[k])*u + (d[k]-a[k])*v
+			}
+			return p
+		}
+		for j := 0; j < morphGrid; j++ {
+			for i := 0; i < morphGrid; i++ {
+				q := morphQuad{
+					face:    fi,
+					corners: [4][3]float64{at(i, j), at(i+1, j), at(i+1, j+1), at(i, j+1)},
+					outline: [4]bool{j == 0, i == morphGrid-1, j == morphGrid-1, i == 0},
+				}
+				for _, c := range q.corners {
+					for k := range q.center {
+						q.center[k] += c[k] / 4
+					}
+				}
+				// Uniform in a ball of radius 1.2
+				for {
+					s := [3]float64{rng.Float64()*2 - 1, rng.Float64()*2 - 1, rng.Float64()*2 - 1}
+					if dot(s, s) <= 1 {
+						q.scatter = [3]float64{s[0] * 1.2, s[1] * 1.2, s[2] * 1.2}
+						break
+					}
+				}
+				quads = append(quads, q)
+			}
+		}
+	}
+	return quads
+}()
+
+// morphPoint places corner p of quad q, on the unit cube, on the given
+// shape
+func morphPoint(shape int, q *morphQuad, p [3]float64) [3]float64 {
+	switch morphShapes[shape] {
+	case ShapeSphere:
+		// About the volume of the cube
+		k := 0.62 / math.Sqrt(dot(p, p))
+		return [3]float64{p[0] * k, p[1] * k, p[2] * k}
+	case ShapePyramid:
+		// The top face shrinks to the apex, the bottom face is the base
+		w := p[1] + 0.5
+		return [3]float64{p[0] * w, p[1], p[2] * w}
+	case ShapeCloud:
+		const speck = 0.15
+		return [3]float64{
+			q.scatter[0] + (p[0]-q.center[0])*speck,
+			q.scatter[1] + (p[1]-q.center[1])*speck,
+			q.scatter[2] + (p[2]-q.center[2])*speck,
+		}
+	}
+	return p
+}
+
+// cubeMorph is the blend of the cubes between the shapes: a weight per
+// shape, summing to 1, gliding from where they were to a single shape
+type cubeMorph struct {
+	weights [4]float64
+	from    [4]float64
+	target  int
+	t       float64 // Progress of the glide, 0 to 1
+}
+
+// start glides from the current blend to the named shape, and reports
+// whether the shape exists
+func (m *cubeMorph) start(shape string) bool {
+	for i, s := range morphShapes {
+		if s == shape {
+			m.from, m.target, m.t = m.weights, i, 0
+			return true
+		}
+	}
+	return false
+}
+
+// update advances the glide, which lasts duration seconds
+func (m *cubeMorph) update(dt, duration float64) {
+	if m.t >= 1 {
+		return
+	}
+	m.t = math.Min(m.t+dt/math.Max(duration, 0.01), 1)
+	s := smooth(m.t)
+	for i := range m.weights {
+		to := 0.0
+		if i == m.target {
+			to = 1
+		}
+		m.weights[i] = m.from[i]*(1-s) + to*s
+	}
+}
+
+// plain reports whether the cubes are plain cubes
+func (m *cubeMorph) plain() bool {
+	return m.weights[0] == 1
+}
+
+// at blends corner p of quad q between the shapes
+func (m *cubeMorph) at(q *morphQuad, p [3]float64) [3]float64 {
+	var r [3]float64
+	for i, w := range m.weights {
+		if w == 0 {
+			continue
+		}
+		s := morphPoint(i, q, p)
+		r = [3]float64{r[0] + s[0]*w, r[1] + s[1]*w, r[2] + s[2]*w}
+	}
+	return r
+}
+
+// morphSync returns the shape named by a "morph-<shape>" sync
+func morphSync(name string) (string, bool) {
+	return strings.CutPrefix(name, "morph-")
+}
+
+// morphedQuad is a quad of a morphed cube, transformed and ready to draw
+type morphedQuad struct {
+	quad      *morphQuad
+	projected [4][2]float32
+	normal    [3]float64
+	depth     float64
+}
+
+// addMorphed appends a cube bent by the morph. While the shapes are
+// convex, culling the back faces is enough, as for plain cubes; once the
+// faces scatter into the cloud they are drawn from both sides, sorted
+// back to front, and lose their outlines.
+func (b *cubeBatch) addMorphed(c *Cube3D, m *cubeMorph, centerX, centerY float64) {
+	// Every quad with its outline sides
+	if len(b.vertices)+len(morphQuads)*4*3 > math.MaxUint16 {
+		b.flush()
+	}
+
+	rot := c.orient.Matrix()
+	cloud := m.weights[3]
+	cam := [3]float64{0, 0, -200}
+	b.morphed = b.morphed[:0]
+	for qi := range morphQuads {
+		q := &morphQuads[qi]
+		mq := morphedQuad{quad: q}
+		var rotated [4][3]float64
+		for k, p := range q.corners {
+			v := m.at(q, p)
+			rotated[k] = rotate(&rot, [3]float64{v[0] * c.size, v[1] * c.size, v[2] * c.size})
+			px, py := project3D(rotated[k][0], rotated[k][1], rotated[k][2])
+			mq.projected[k] = [2]float32{float32(centerX + px), float32(centerY + py)}
+			mq.depth += rotated[k][2] / 4
+		}
+
+		a := rotated[0]
+		n := cross(sub(rotated[1], a), sub(rotated[2], a))
+		if dot(n, n) == 0 {
+			// Collapsed at the apex of the pyramid
+			n = cross(sub(rotated[2], a), sub(rotated[3], a))
+		}
+		facing := dot(n, sub(a, cam))
+		if facing >= 0 && cloud <= 0.5 {
+			continue
+		}
+		if facing > 0 {
+			n = [3]float64{-n[0], -n[1], -n[2]}
+		}
+		mq.normal = n
+		b.morphed = append(b.morphed, mq)
+	}
+	if cloud > 0.5 {
+		sort.Slice(b.morphed, func(i, j int) bool {
+			return b.morphed[i].depth > b.morphed[j].depth
+		})
+	}
+
+	for _, mq := range b.morphed {
+		clr := shadeFace(cubeFaceColors[mq.quad.face], mq.normal, b.toon)
+		base := uint16(len(b.vertices))
+		for _, p := range mq.projected {
+			b.appendVertex(p[0], p[1], clr)
+		}
+		b.indices = append(b.indices, base, base+1, base+2, base, base+2, base+3)
+
+		if cloud > 0.5 {
+			continue
+		}
+		edge, width := color.RGBA{clr.R * 3 / 4, clr.G * 3 / 4, clr.B * 3 / 4, 255}, float32(cubeEdgeWidth)
+		if b.toon {
+			edge, width = color.RGBA{0, 0, 0, 255}, toonEdgeWidth
+		}
+		for k, on := range mq.quad.outline {
+			if on {
+				b.appendLine(mq.projected[k], mq.projected[(k+1)%4], width, edge)
+			}
+		}
+	}
+}
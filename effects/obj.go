@@ -0,0 +1,130 @@
+package effects
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// LoadMesh reads a Wavefront OBJ mesh asset, see ParseOBJ
+func LoadMesh(assets fs.FS, path string) (*Mesh, error) {
+	f, err := assets.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	m, err := ParseOBJ(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// ParseOBJ reads the vertices, texture coordinates and faces of a
+// Wavefront OBJ file, one unit per pixel; normals, groups and materials
+// are ignored. OBJ meshes are y up with counter-clockwise front faces, so
+// they are turned to the y down, z away space of the renderer, keeping
+// their faces outward. Faces must be convex, triangulate them on export
+// otherwise.
+func ParseOBJ(r io.Reader) (*Mesh, error) {
+	m := &Mesh{}
+	var uvs [][2]float32
+	textured := false
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "v":
+			p, err := parseFloats(fields[1:], 3)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			m.Vertices = append(m.Vertices, [3]float64{p[0], -p[1], -p[2]})
+		case "vt":
+			p, err := parseFloats(fields[1:], 2)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			uvs = append(uvs, [2]float32{float32(p[0]), float32(1 - p[1])})
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: face with less than 3 vertices", line)
+			}
+			face := make([]int, 0, len(fields)-1)
+			faceUVs := make([][2]float32, 0, len(fields)-1)
+			for _, corner := range fields[1:] {
+				// v, v/vt, v/vt/vn or v//vn, indices from 1 or negative
+				// from the end
+				parts := strings.Split(corner, "/")
+				vi, err := objIndex(parts[0], len(m.Vertices))
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				face = append(face, vi)
+				uv := cornerUVs[len(faceUVs)%4]
+				if len(parts) > 1 && parts[1] != "" {
+					ti, err := objIndex(parts[1], len(uvs))
+					if err != nil {
+						return nil, fmt.Errorf("line %d: %w", line, err)
+					}
+					uv = uvs[ti]
+					textured = true
+				}
+				faceUVs = append(faceUVs, uv)
+			}
+			m.Faces = append(m.Faces, face)
+			m.UVs = append(m.UVs, faceUVs)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.Faces) == 0 {
+		return nil, fmt.Errorf("no faces")
+	}
+	if !textured {
+		m.UVs = nil
+	}
+	return m, nil
+}
+
+// parseFloats parses the first n fields as numbers
+func parseFloats(fields []string, n int) ([]float64, error) {
+	if len(fields) < n {
+		return nil, fmt.Errorf("expected %d coordinates", n)
+	}
+	p := make([]float64, n)
+	for i := range p {
+		var err error
+		if p[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", fields[i])
+		}
+	}
+	return p, nil
+}
+
+// objIndex converts an OBJ index, counted from 1 or negative from the
+// end of the n elements read so far, to a slice index
+func objIndex(s string, n int) (int, error) {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid index %q", s)
+	}
+	if i < 0 {
+		i += n + 1
+	}
+	if i < 1 || i > n {
+		return 0, fmt.Errorf("index %s out of range", s)
+	}
+	return i - 1, nil
+}
@@ -0,0 +1,183 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Motion binds the animation of a 3D object
+type Motion struct {
+	Spin   [3]float64 // Rotation around X, Y and Z, radians per frame
+	Orbit  [3]float64 // Amplitude of the path around the object position
+	Rate   [3]float64 // Frequency of the path on each axis, radians per frame
+	Phase  float64    // Offset along the path, radians
+	Bounce float64    // Jump height on "beat" syncs
+}
+
+// Object3D is a mesh placed in a 3D scene. Sizes and positions are in
+// pixels at 800x600, around the center of the screen, z pointing away.
+type Object3D struct {
+	Name     string
+	Mesh     *Mesh
+	Material Material
+	Scale    float64 // 1 when zero
+	Position [3]float64
+	Orient   Quat // Current orientation, turned by Motion.Spin
+	Motion   Motion
+}
+
+// Objects3D shows several 3D objects, each with its own material and
+// motion, through one depth-sorted renderer. Without Objects it shows a
+// flat shaded cube, a glenz torus, an additive glenz dodecahedron and an
+// extrusion of the logo. Meshes can also be loaded from OBJ assets with
+// LoadMesh.
+type Objects3D struct {
+	Speed   float64 // Animation speed multiplier, 1 when zero
+	Objects []*Object3D
+
+	ctx      *Context
+	layout   Layout
+	renderer Renderer3D
+	t        float64 // Frames elapsed, for the orbits
+	bounce   float64 // Jump on "beat" syncs, from 1 down to 0
+}
+
+// Init builds the default objects on the first call
+func (o *Objects3D) Init(ctx *Context) error {
+	o.ctx = ctx
+	o.layout = ctx.Layout()
+	if o.Objects != nil {
+		return nil
+	}
+
+	logo, err := DecodeImage(ctx.Assets, "assets/logo.png")
+	if err != nil {
+		return err
+	}
+	o.Objects = []*Object3D{
+		{
+			Name:     "cube",
+			Mesh:     CubeMesh(90),
+			Material: Material{Kind: MaterialFlat, Color: color.RGBA{255, 80, 160, 255}},
+			Position: [3]float64{-220, 70, 40},
+			Motion: Motion{
+				Spin:   [3]float64{0.02, 0.03, 0.01},
+				Orbit:  [3]float64{60, 40, 80},
+				Rate:   [3]float64{0.011, 0.023, 0.017},
+				Bounce: 30,
+			},
+		},
+		{
+			Name: "torus",
+			Mesh: TorusMesh(70, 26, 24, 12).
+				AddLOD(48, TorusMesh(70, 26, 12, 6)).
+				AddLOD(20, TorusMesh(70, 26, 8, 4)),
+			Material: Material{
+				Kind:   MaterialGlenz,
+				Color:  color.RGBA{255, 120, 200, 255},
+				Color2: color.RGBA{120, 60, 220, 255},
+			},
+			Position: [3]float64{220, 70, 40},
+			Motion: Motion{
+				Spin:   [3]float64{0.015, 0.025, 0.005},
+				Orbit:  [3]float64{60, 40, 80},
+				Rate:   [3]float64{0.011, 0.023, 0.017},
+				Phase:  math.Pi,
+				Bounce: 30,
+			},
+		},
+		{
+			Name: "dodecahedron",
+			Mesh: DodecahedronMesh(55),
+			Material: Material{
+				Kind:     MaterialGlenz,
+				Color:    color.RGBA{150, 90, 255, 255},
+				Color2:   color.RGBA{40, 160, 255, 255},
+				Alpha:    0.6,
+				Additive: true,
+			},
+			Position: [3]float64{0, 150, 100},
+			Motion: Motion{
+				Spin:   [3]float64{0.025, 0.01, 0.02},
+				Orbit:  [3]float64{120, 0, 40},
+				Rate:   [3]float64{0.013, 0, 0.026},
+				Bounce: 30,
+			},
+		},
+		{
+			Name:     "logo",
+			Mesh:     ExtrudeMesh(logo, 8, 32).AddLOD(100, ExtrudeMesh(logo, 16, 32)),
+			Material: Material{Kind: MaterialTextured, Color: color.RGBA{255, 255, 255, 255}, Texture: ebiten.NewImageFromImage(logo)},
+			Scale:    0.8,
+			Position: [3]float64{0, -150, 60},
+			Motion: Motion{
+				Spin:  [3]float64{0, 0.02, 0},
+				Orbit: [3]float64{0, 10, 0},
+				Rate:  [3]float64{0, 0.05, 0},
+			},
+		},
+	}
+	return nil
+}
+
+// Update spins the objects and moves them along their paths
+func (o *Objects3D) Update(dt float64) {
+	f := frames(dt) * speed(o.Speed)
+	o.t += f
+	o.bounce = math.Max(o.bounce-0.08*f, 0)
+	for _, obj := range o.Objects {
+		s := obj.Motion.Spin
+		obj.Orient = EulerQuat(s[0]*f, s[1]*f, s[2]*f).Mul(obj.Orient).Normalize()
+	}
+}
+
+// Rewind moves the objects back along their paths and unwinds their spin
+func (o *Objects3D) Rewind(dt float64) {
+	f := frames(dt) * speed(o.Speed)
+	o.t -= f
+	for _, obj := range o.Objects {
+		s := obj.Motion.Spin
+		obj.Orient = EulerQuat(-s[0]*f, -s[1]*f, -s[2]*f).Mul(obj.Orient).Normalize()
+	}
+}
+
+// Sync makes the objects jump on each beat
+func (o *Objects3D) Sync(name string) {
+	if name == "beat" {
+		o.bounce = 1
+	}
+}
+
+// Film implements Filmed
+func (o *Objects3D) Film(cam Camera, ok bool) {
+	o.renderer.Camera = cam
+}
+
+// SetStyle implements Styled
+func (o *Objects3D) SetStyle(name string) {
+	o.renderer.Toon = name == StyleToon
+}
+
+// Draw renders all objects together, so they overlap face by face
+func (o *Objects3D) Draw(screen *ebiten.Image) {
+	l := o.layout
+	o.renderer.Begin(l)
+	jump := math.Sin(o.bounce * math.Pi)
+	for _, obj := range o.Objects {
+		m := obj.Motion
+		var pos [3]float64
+		for i := range pos {
+			pos[i] = obj.Position[i] + m.Orbit[i]*math.Sin(o.t*m.Rate[i]+m.Phase)
+		}
+		pos[1] -= jump * m.Bounce
+		scale := obj.Scale
+		if scale == 0 {
+			scale = 1
+		}
+		o.renderer.Add(obj.Mesh, obj.Material, obj.Orient, scale*l.ScaleY,
+			[3]float64{pos[0] * l.ScaleX, pos[1] * l.ScaleY, pos[2] * l.ScaleY})
+	}
+	o.renderer.Draw(screen)
+}
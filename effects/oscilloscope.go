@@ -0,0 +1,106 @@
+package effects
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// scopeWindow is how many samples the trace spans, about 23ms at 44.1kHz.
+// Twice as many are fetched, the trace starting on a rising zero crossing
+// of the first half so the waveform stands still on screen.
+const scopeWindow = 1024
+
+// scopeGlow are the strokes drawn on top of each other for the trace, the
+// wide faint ones making the glow around the thin bright core
+var scopeGlow = []struct {
+	width float32
+	alpha float32
+}{
+	{9, 0.08}, {5, 0.16}, {2.5, 0.4}, {1, 1},
+}
+
+// Oscilloscope draws the waveform of the sound being played as a glowing
+// trace across the screen, the way a scope wired to the audio output of
+// the machine would show it
+type Oscilloscope struct {
+	// Samples fills dst with the latest mono samples played, oldest
+	// first, from -1 to 1; nil draws a flat line
+	Samples func(dst []float32)
+
+	ctx      *Context
+	layout   Layout
+	samples  []float32
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// Init keeps the layout; the scope has no resources to allocate
+func (o *Oscilloscope) Init(ctx *Context) error {
+	o.ctx = ctx
+	o.layout = ctx.Layout()
+	o.samples = make([]float32, 2*scopeWindow)
+	return nil
+}
+
+// Update fetches the latest samples
+func (o *Oscilloscope) Update(dt float64) {
+	if o.Samples != nil {
+		o.Samples(o.samples)
+	} else {
+		clear(o.samples)
+	}
+}
+
+// trigger returns where the trace starts: the first rising zero crossing
+// in the first half of the samples, else their start
+func (o *Oscilloscope) trigger() int {
+	for i := 1; i < scopeWindow; i++ {
+		if o.samples[i-1] < 0 && o.samples[i] >= 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// Draw strokes the trace through the middle of the screen, scaled by the
+// scope.gain parameter
+func (o *Oscilloscope) Draw(screen *ebiten.Image) {
+	w, h := float32(o.layout.Width), float32(o.layout.Height)
+	gain := float32(o.ctx.Param("scope.gain", 1.5))
+	mid, amp := h*0.5, h*0.3*gain
+
+	var path vector.Path
+	start := o.trigger()
+	for i, v := range o.samples[start : start+scopeWindow] {
+		x := w * float32(i) / (scopeWindow - 1)
+		y := mid - amp*min(max(v, -1.5), 1.5)
+		if i == 0 {
+			path.MoveTo(x, y)
+		} else {
+			path.LineTo(x, y)
+		}
+	}
+
+	trace := color.RGBA{96, 255, 160, 255}
+	src := whiteImage.Bounds().Min
+	op := &ebiten.DrawTrianglesOptions{ColorScaleMode: ebiten.ColorScaleModePremultipliedAlpha, Blend: ebiten.BlendLighter}
+	for _, g := range scopeGlow {
+		o.vertices, o.indices = path.AppendVerticesAndIndicesForStroke(o.vertices[:0], o.indices[:0], &vector.StrokeOptions{
+			Width:    g.width,
+			LineJoin: vector.LineJoinBevel,
+		})
+
+		// Colors are premultiplied, the faint strokes adding up to the glow
+		for i := range o.vertices {
+			v := &o.vertices[i]
+			v.SrcX, v.SrcY = float32(src.X), float32(src.Y)
+			v.ColorR = float32(trace.R) / 255 * g.alpha
+			v.ColorG = float32(trace.G) / 255 * g.alpha
+			v.ColorB = float32(trace.B) / 255 * g.alpha
+			v.ColorA = g.alpha
+		}
+		screen.DrawTriangles(o.vertices, o.indices, whiteImage, op)
+	}
+}
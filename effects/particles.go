@@ -0,0 +1,73 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Particle is a colored square point mass
+type Particle struct {
+	X, Y   float64
+	VX, VY float64
+	Color  color.RGBA
+}
+
+// Particles is a simple particle system: point masses moved by a uniform
+// acceleration with drag, drawn as squares in as few DrawTriangles calls
+// as the vertex index range allows
+type Particles struct {
+	List []Particle
+
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// Step moves the particles by f frames under the acceleration ax, ay,
+// per frame squared, losing the drag fraction of their speed per frame
+func (ps *Particles) Step(ax, ay, drag, f float64) {
+	keep := math.Pow(1-drag, f)
+	for i := range ps.List {
+		p := &ps.List[i]
+		p.VX = (p.VX + ax*f) * keep
+		p.VY = (p.VY + ay*f) * keep
+		p.X += p.VX * f
+		p.Y += p.VY * f
+	}
+}
+
+// Draw renders the particles as size x size squares, their positions
+// scaled by sx, sy
+func (ps *Particles) Draw(dst *ebiten.Image, size, sx, sy float64) {
+	src := whiteImage.Bounds().Min
+	s := float32(size)
+	ps.vertices = ps.vertices[:0]
+	ps.indices = ps.indices[:0]
+	for _, p := range ps.List {
+		if len(ps.vertices)+4 > math.MaxUint16 {
+			dst.DrawTriangles(ps.vertices, ps.indices, whiteImage, nil)
+			ps.vertices = ps.vertices[:0]
+			ps.indices = ps.indices[:0]
+		}
+		x, y := float32(p.X*sx), float32(p.Y*sy)
+		r, g, b, a := float32(p.Color.R)/255, float32(p.Color.G)/255, float32(p.Color.B)/255, float32(p.Color.A)/255
+		base := uint16(len(ps.vertices))
+		for _, c := range [4][2]float32{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+			ps.vertices = append(ps.vertices, ebiten.Vertex{
+				DstX:   x + c[0]*s,
+				DstY:   y + c[1]*s,
+				SrcX:   float32(src.X),
+				SrcY:   float32(src.Y),
+				ColorR: r,
+				ColorG: g,
+				ColorB: b,
+				ColorA: a,
+			})
+		}
+		ps.indices = append(ps.indices, base, base+1, base+2, base, base+2, base+3)
+	}
+	if len(ps.indices) > 0 {
+		dst.DrawTriangles(ps.vertices, ps.indices, whiteImage, nil)
+	}
+}
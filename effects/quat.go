@@ -0,0 +1,92 @@
+package effects
+
+import "math"
+
+// Quat is a rotation quaternion. Unlike Euler angles, orientations
+// compose and interpolate without gimbal lock.
+type Quat struct {
+	W, X, Y, Z float64
+}
+
+// IdentityQuat is no rotation
+var IdentityQuat = Quat{W: 1}
+
+// AxisAngle returns the rotation by angle radians around a unit axis
+func AxisAngle(axis [3]float64, angle float64) Quat {
+	s := math.Sin(angle / 2)
+	return Quat{math.Cos(angle / 2), axis[0] * s, axis[1] * s, axis[2] * s}
+}
+
+// EulerQuat returns the rotation around X, then Y, then Z, in radians,
+// the order the Euler angles of the cubes were applied in
+func EulerQuat(x, y, z float64) Quat {
+	qx := AxisAngle([3]float64{1, 0, 0}, x)
+	qy := AxisAngle([3]float64{0, 1, 0}, y)
+	qz := AxisAngle([3]float64{0, 0, 1}, z)
+	return qz.Mul(qy).Mul(qx)
+}
+
+// Mul returns the rotation applying r, then q
+func (q Quat) Mul(r Quat) Quat {
+	return Quat{
+		q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+		q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+	}
+}
+
+// Normalize returns q scaled to unit length, correcting the drift of
+// repeated multiplications
+func (q Quat) Normalize() Quat {
+	n := math.Sqrt(q.W*q.W + q.X*q.X + q.Y*q.Y + q.Z*q.Z)
+	if n == 0 {
+		return IdentityQuat
+	}
+	return Quat{q.W / n, q.X / n, q.Y / n, q.Z / n}
+}
+
+// Matrix returns the rotation matrix of a unit quaternion, rows first,
+// to rotate many vertices cheaply
+func (q Quat) Matrix() [3][3]float64 {
+	w, x, y, z := q.W, q.X, q.Y, q.Z
+	return [3][3]float64{
+		{1 - 2*(y*y+z*z), 2 * (x*y - w*z), 2 * (x*z + w*y)},
+		{2 * (x*y + w*z), 1 - 2*(x*x+z*z), 2 * (y*z - w*x)},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), 1 - 2*(x*x+y*y)},
+	}
+}
+
+// rotate applies a rotation matrix to v
+func rotate(m *[3][3]float64, v [3]float64) [3]float64 {
+	return [3]float64{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// Slerp interpolates between two orientations at constant angular speed,
+// t going from 0 (a) to 1 (b), along the shortest arc
+func Slerp(a, b Quat, t float64) Quat {
+	d := a.W*b.W + a.X*b.X + a.Y*b.Y + a.Z*b.Z
+	if d < 0 {
+		b = Quat{-b.W, -b.X, -b.Y, -b.Z}
+		d = -d
+	}
+
+	wa, wb := 1-t, t
+	if d < 0.9995 {
+		// Nearly equal orientations fall back to a normalized lerp
+		theta := math.Acos(d)
+		s := math.Sin(theta)
+		wa = math.Sin((1-t)*theta) / s
+		wb = math.Sin(t*theta) / s
+	}
+	return Quat{
+		wa*a.W + wb*b.W,
+		wa*a.X + wb*b.X,
+		wa*a.Y + wb*b.Y,
+		wa*a.Z + wb*b.Z,
+	}.Normalize()
+}
@@ -0,0 +1,126 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// rasterFlashDecay is how much of a flash fades per frame
+const rasterFlashDecay = 0.06
+
+// RasterFunc sets the background color of a scanline: it is given the
+// line, the number of lines and the color set by the callbacks before it,
+// and returns the line color, like a raster interrupt writing the
+// background color register
+type RasterFunc func(line, lines int, below color.RGBA) color.RGBA
+
+// rasterEntry is a callback registered under a name
+type rasterEntry struct {
+	name string
+	fn   RasterFunc
+}
+
+// Rasters emulates the raster interrupts of the ST and the copper lists
+// of the Amiga: parts register callbacks setting the background color of
+// each scanline, and the lines are drawn behind every other layer of the
+// scenes showing the rasters. "flash" syncs flash the lines to white.
+type Rasters struct {
+	layout Layout
+	funcs  []rasterEntry
+	strip  *ebiten.Image // One pixel per scanline, stretched across
+	pixels []byte
+	flash  float64 // Level of the last flash, 1 down to 0
+}
+
+// Init allocates the scanline strip
+func (r *Rasters) Init(ctx *Context) error {
+	r.layout = ctx.Layout()
+	if r.strip != nil {
+		r.strip.Deallocate()
+	}
+	r.strip = ebiten.NewImage(1, r.layout.Height)
+	r.pixels = make([]byte, 4*r.layout.Height)
+	return nil
+}
+
+// Register adds a callback run after those registered before it, or
+// replaces the callback registered under the same name
+func (r *Rasters) Register(name string, fn RasterFunc) {
+	for i := range r.funcs {
+		if r.funcs[i].name == name {
+			r.funcs[i].fn = fn
+			return
+		}
+	}
+	r.funcs = append(r.funcs, rasterEntry{name, fn})
+}
+
+// Unregister removes the named callback
+func (r *Rasters) Unregister(name string) {
+	for i := range r.funcs {
+		if r.funcs[i].name == name {
+			r.funcs = append(r.funcs[:i], r.funcs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Update fades the flash
+func (r *Rasters) Update(dt float64) {
+	r.flash = math.Max(r.flash-rasterFlashDecay*frames(dt), 0)
+}
+
+// Sync flashes the lines on "flash" syncs
+func (r *Rasters) Sync(name string) {
+	if name == "flash" {
+		r.flash = 1
+	}
+}
+
+// Draw runs the callbacks for every scanline, from black, and fills the
+// screen with the lines
+func (r *Rasters) Draw(screen *ebiten.Image) {
+	lines := r.layout.Height
+	for y := range lines {
+		c := color.RGBA{0, 0, 0, 255}
+		for _, e := range r.funcs {
+			c = e.fn(y, lines, c)
+		}
+		if r.flash > 0 {
+			c = lerpRGBA(c, color.RGBA{255, 255, 255, 255}, r.flash)
+		}
+		p := r.pixels[4*y : 4*y+4]
+		p[0], p[1], p[2], p[3] = c.R, c.G, c.B, c.A
+	}
+	r.strip.WritePixels(r.pixels)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(r.layout.Width), 1)
+	screen.DrawImage(r.strip, op)
+}
+
+// SkyGradient returns a raster callback blending the given colors evenly
+// from the top of the screen to the bottom
+func SkyGradient(stops ...color.RGBA) RasterFunc {
+	return func(line, lines int, below color.RGBA) color.RGBA {
+		if len(stops) == 0 {
+			return below
+		}
+		if len(stops) == 1 || lines < 2 {
+			return stops[0]
+		}
+		t := float64(line) / float64(lines-1) * float64(len(stops)-1)
+		i := min(int(t), len(stops)-2)
+		return lerpRGBA(stops[i], stops[i+1], t-float64(i))
+	}
+}
+
+// lerpRGBA blends a towards b by t, from 0 to 1
+func lerpRGBA(a, b color.RGBA, t float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
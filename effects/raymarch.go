@@ -0,0 +1,134 @@
+package effects
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed shaders/raymarch.kage
+var raymarchShaderSrc []byte
+
+// Raymarch timing: the beat pulse fades in a third of a second at 60
+// frames per second, and the shapes morph in a second and a half
+const (
+	raymarchPulseDecay = 0.05
+	raymarchMorph      = 1.5
+)
+
+// Raymarch is a fully GPU part: a Kage shader (shaders/raymarch.kage)
+// marches a ray per pixel through a distance field, a twisting rounded
+// box melted into a torus, or a Menger sponge, and shades the surface it
+// hits. The shader is driven by uniforms following the music syncs:
+// "beat" swells and brightens the shapes, "drop" morphs between the
+// twisting shapes and the sponge, and "flash" shifts the colors a third
+// around the palette. The field is marched at raymarch.resolution of the
+// frame and scaled up.
+type Raymarch struct {
+	Speed float64 // Animation speed multiplier, 1 when zero
+
+	ctx    *Context
+	layout Layout
+	shader *ebiten.Shader
+	frame  *ebiten.Image
+
+	t     float64 // Seconds elapsed
+	pulse float64 // Beat pulse, 1 down to 0
+	shape float64 // 0 for the twisting shapes, 1 for the sponge
+	goal  float64 // Shape morphed to
+	hue   float64 // Palette shift, in turns, eased towards hueTo
+	hueTo float64
+}
+
+// Init compiles the shader on the first call
+func (r *Raymarch) Init(ctx *Context) error {
+	r.ctx = ctx
+	r.layout = ctx.Layout()
+	if r.shader == nil {
+		shader, err := ebiten.NewShader(raymarchShaderSrc)
+		if err != nil {
+			return fmt.Errorf("failed to compile raymarch shader: %w", err)
+		}
+		r.shader = shader
+	}
+	return nil
+}
+
+// Update advances the motion and fades the syncs
+func (r *Raymarch) Update(dt float64) {
+	dt *= speed(r.Speed)
+	r.t += dt
+	r.pulse = math.Max(r.pulse-raymarchPulseDecay*frames(dt), 0)
+
+	step := dt / raymarchMorph
+	if r.shape < r.goal {
+		r.shape = math.Min(r.shape+step, r.goal)
+	} else {
+		r.shape = math.Max(r.shape-step, r.goal)
+	}
+	r.hue += (r.hueTo - r.hue) * math.Min(3*dt, 1)
+}
+
+// Rewind runs the motion backwards; the syncs hold still
+func (r *Raymarch) Rewind(dt float64) {
+	r.t -= dt * speed(r.Speed)
+}
+
+// Sync swells the shapes on "beat", morphs them on "drop" and shifts
+// their colors on "flash"
+func (r *Raymarch) Sync(name string) {
+	switch name {
+	case "beat":
+		r.pulse = 1
+	case "drop":
+		r.goal = 1 - r.goal
+	case "flash":
+		r.hueTo += 1.0 / 3
+	}
+}
+
+// Prepare draws the field once, so the shader is ready on the GPU
+func (r *Raymarch) Prepare() {
+	if r.shader != nil {
+		r.march()
+	}
+}
+
+// march renders the field into the frame, reallocated when the
+// resolution changes
+func (r *Raymarch) march() {
+	res := math.Min(math.Max(r.ctx.Param("raymarch.resolution", 0.5), 0.25), 1)
+	w := max(int(float64(r.layout.Width)*res), 1)
+	h := max(int(float64(r.layout.Height)*res), 1)
+	if r.frame == nil || r.frame.Bounds().Dx() != w || r.frame.Bounds().Dy() != h {
+		if r.frame != nil {
+			r.frame.Deallocate()
+		}
+		r.frame = ebiten.NewImage(w, h)
+	}
+
+	smooth := r.shape * r.shape * (3 - 2*r.shape)
+	op := &ebiten.DrawRectShaderOptions{}
+	op.Uniforms = map[string]any{
+		"Time":       float32(r.t),
+		"Resolution": []float32{float32(w), float32(h)},
+		"Twist":      float32(r.ctx.Param("raymarch.twist", 1.2)),
+		"Pulse":      float32(r.pulse),
+		"Shape":      float32(smooth),
+		"Hue":        float32(math.Mod(r.hue, 1)),
+	}
+	op.Blend = ebiten.BlendCopy
+	r.frame.DrawRectShader(w, h, r.shader, op)
+}
+
+// Draw marches the field and scales it up to the screen
+func (r *Raymarch) Draw(screen *ebiten.Image) {
+	r.march()
+	b := r.frame.Bounds()
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(r.layout.Width)/float64(b.Dx()), float64(r.layout.Height)/float64(b.Dy()))
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(r.frame, op)
+}
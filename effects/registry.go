@@ -0,0 +1,75 @@
+package effects
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDuration is used when a manifest does not set a duration
+const DefaultDuration = 10 * time.Second
+
+// Manifest describes a contributed screen
+type Manifest struct {
+	Name     string
+	Author   string
+	Duration time.Duration // Preferred time on screen
+	Assets   []string      // Asset paths the screen needs, e.g. "assets/logo.png"
+}
+
+// Screen is a registered effect together with its manifest
+type Screen struct {
+	Manifest Manifest
+	New      func() Effect
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Screen{}
+)
+
+// Register makes a screen available to the demo. It is meant to be
+// called from the init function of the contributing package, so a blank
+// import is all it takes to add a screen. It panics on a duplicate name.
+func Register(m Manifest, newEffect func() Effect) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if m.Name == "" {
+		panic("effects: Register with an empty screen name")
+	}
+	if _, dup := registry[m.Name]; dup {
+		panic(fmt.Sprintf("effects: Register called twice for screen %q", m.Name))
+	}
+	if m.Duration <= 0 {
+		m.Duration = DefaultDuration
+	}
+	registry[m.Name] = Screen{Manifest: m, New: newEffect}
+}
+
+// Screens returns all registered screens sorted by name
+func Screens() []Screen {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	screens := make([]Screen, 0, len(registry))
+	for _, s := range registry {
+		screens = append(screens, s)
+	}
+	sort.Slice(screens, func(i, j int) bool {
+		return screens[i].Manifest.Name < screens[j].Manifest.Name
+	})
+	return screens
+}
+
+// CheckAssets reports the first required asset missing from assets
+func (m Manifest) CheckAssets(assets fs.FS) error {
+	for _, name := range m.Assets {
+		if _, err := fs.Stat(assets, name); err != nil {
+			return fmt.Errorf("screen %q needs asset %s: %w", m.Name, name, err)
+		}
+	}
+	return nil
+}
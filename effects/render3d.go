@@ -0,0 +1,330 @@
+package effects
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// MaterialKind selects how the faces of an object are filled
+type MaterialKind int
+
+const (
+	MaterialFlat     MaterialKind = iota // Single shaded color
+	MaterialTextured                     // Shaded texture, tinted by Color
+	MaterialGlenz                        // See-through, two alternating colors
+)
+
+// Material is the look of a 3D object
+type Material struct {
+	Kind    MaterialKind
+	Color   color.RGBA    // Flat color, texture tint, or first glenz color
+	Color2  color.RGBA    // Second glenz color
+	Texture *ebiten.Image // For MaterialTextured
+	Alpha   float64       // Glenz opacity, 0.55 when zero
+
+	// Additive makes glenz faces add their light to what is behind
+	// instead of blending over it, so overlaps glow brighter
+	Additive bool
+}
+
+// Glenz faces are not shaded, so both sides read as glass
+const defaultGlenzAlpha = 0.55
+
+// Shading: ambient light plus diffuse light from the top left, towards
+// the camera
+const (
+	lightAmbient = 0.35
+	lightDiffuse = 0.65
+)
+
+var lightDir = func() [3]float64 {
+	v := [3]float64{-0.4, -0.6, -1}
+	n := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	return [3]float64{v[0] / n, v[1] / n, v[2] / n}
+}()
+
+// Cel shading: outline width in pixels at 800x600, and the diffuse light
+// bands
+const toonOutline = 3
+
+var toonBands = []struct{ below, level float64 }{
+	{0.25, 0.1},
+	{0.65, 0.55},
+	{2, 1},
+}
+
+// toonBand quantizes a diffuse light level, 0 to 1, to its band
+func toonBand(diffuse float64) float64 {
+	for _, b := range toonBands {
+		if diffuse < b.below {
+			return b.level
+		}
+	}
+	return 1
+}
+
+// whiteImage is the source of flat colored triangles; sampling its
+// center pixel avoids bleeding from the edges
+var whiteImage = func() *ebiten.Image {
+	img := ebiten.NewImage(3, 3)
+	img.Fill(color.White)
+	return img.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+}()
+
+// renderFace is a transformed face waiting to be drawn
+type renderFace struct {
+	points []int // Indices into Renderer3D.points
+	uvs    [][2]float32
+	depth  float64
+	clr    [4]float32 // Vertex color, straight alpha
+	src    *ebiten.Image
+	blend  ebiten.Blend
+}
+
+// Renderer3D draws the faces of several objects together, sorted back to
+// front, so objects crossing each other overlap correctly face by face.
+// Call Begin, Add each object, then Draw.
+type Renderer3D struct {
+	// Toon selects cel shading: lighting quantized to a few bands, and
+	// black silhouette outlines around solid objects
+	Toon bool
+
+	// Camera views the objects from a camera shot; the zero Camera is the
+	// fixed viewpoint
+	Camera Camera
+
+	view        cameraView
+	perspective float64
+	width       int
+	height      int
+	points      [][3]float64 // View space: x right, y down, z away from the camera
+	faces       []renderFace
+	order       []*renderFace
+	vertices    []ebiten.Vertex
+	indices     []uint16
+}
+
+// Begin starts a frame. The perspective is scaled from the 200 pixels
+// the cubes use at 800x600.
+func (r *Renderer3D) Begin(l Layout) {
+	r.perspective = 200 * l.ScaleY
+	r.width, r.height = l.Width, l.Height
+	r.view = r.Camera.view(r.perspective)
+	r.points = r.points[:0]
+	r.faces = r.faces[:0]
+}
+
+// Add queues the faces of a mesh rotated by orient, scaled and moved to
+// pos, in scene pixels, seen from the camera. Meshes with LODs are swapped for the level
+// matching their size on screen before any vertex is transformed, and
+// objects entirely behind the camera or off screen are skipped.
+func (r *Renderer3D) Add(m *Mesh, mat Material, orient Quat, scale float64, pos [3]float64) {
+	if r.view.on {
+		pos = r.view.point(pos)
+		orient = r.view.orient.Mul(orient)
+	}
+	radius := m.Radius() * scale
+	if pos[2]+radius <= 1-r.perspective {
+		return
+	}
+	// The projection of the bounding sphere is within the circle of its
+	// nearest point; closer to the camera it cannot be bounded this way
+	if near := r.perspective + pos[2] - radius; near > 0 {
+		f := r.view.zoom * r.perspective / near
+		cx, cy := float64(r.width)/2, float64(r.height)/2
+		if offScreen(cx+pos[0]*f, cy+pos[1]*f, radius*f, r.width, r.height) {
+			return
+		}
+	}
+
+	projected := radius * r.view.zoom // Bounding radius on screen
+	if d := r.perspective + pos[2]; d > 0 {
+		projected = radius * r.view.zoom * r.perspective / d
+	}
+	m = m.Level(projected)
+
+	base := len(r.points)
+	rot := orient.Matrix()
+	for _, v := range m.Vertices {
+		p := rotate(&rot, [3]float64{v[0] * scale, v[1] * scale, v[2] * scale})
+		r.points = append(r.points, [3]float64{p[0] + pos[0], p[1] + pos[1], p[2] + pos[2]})
+	}
+
+	// Toon outlines use the inverted hull trick: the back faces of a
+	// slightly inflated copy are drawn in black behind the object, and
+	// show around its silhouette
+	outline := r.Toon && mat.Kind != MaterialGlenz && projected > 0
+	hull := len(r.points)
+	if outline {
+		k := 1 + toonOutline*r.perspective/200/projected
+		for _, p := range r.points[base:hull] {
+			r.points = append(r.points, [3]float64{
+				pos[0] + (p[0]-pos[0])*k,
+				pos[1] + (p[1]-pos[1])*k,
+				pos[2] + (p[2]-pos[2])*k,
+			})
+		}
+	}
+
+	alpha := mat.Alpha
+	if alpha == 0 {
+		alpha = defaultGlenzAlpha
+	}
+	cam := [3]float64{0, 0, -r.perspective}
+	for i, face := range m.Faces {
+		if len(face) < 3 {
+			continue
+		}
+		a, b, c := r.points[base+face[0]], r.points[base+face[1]], r.points[base+face[2]]
+		n := cross(sub(b, a), sub(c, a))
+
+		f := renderFace{points: make([]int, len(face))}
+		depth := 0.0
+		behind := false
+		for k, vi := range face {
+			f.points[k] = base + vi
+			depth += r.points[base+vi][2]
+			behind = behind || r.points[base+vi][2] <= 1-r.perspective
+		}
+		if behind {
+			continue
+		}
+		f.depth = depth / float64(len(face))
+		if i < len(m.UVs) {
+			f.uvs = m.UVs[i]
+		}
+
+		switch mat.Kind {
+		case MaterialGlenz:
+			clr := mat.Color
+			if i%2 == 1 {
+				clr = mat.Color2
+			}
+			f.clr = vertexColor(clr, 1, alpha)
+			f.src = whiteImage
+			if mat.Additive {
+				f.blend = ebiten.BlendLighter
+			}
+		default:
+			// Faces turned away from the camera are hidden by the front,
+			// except as outlines
+			if dot(n, sub(a, cam)) >= 0 {
+				if !outline {
+					continue
+				}
+				depth := 0.0
+				for k := range f.points {
+					f.points[k] += hull - base
+					depth += r.points[f.points[k]][2]
+				}
+				f.depth = depth / float64(len(f.points))
+				f.uvs = nil
+				f.clr = [4]float32{0, 0, 0, 1}
+				f.src = whiteImage
+				break
+			}
+			diffuse := 0.0
+			if l := math.Sqrt(dot(n, n)); l > 0 {
+				diffuse = math.Max(0, dot(n, lightDir)/l)
+			}
+			if r.Toon {
+				diffuse = toonBand(diffuse)
+			}
+			f.clr = vertexColor(mat.Color, lightAmbient+lightDiffuse*diffuse, 1)
+			f.src = whiteImage
+			if mat.Kind == MaterialTextured && mat.Texture != nil {
+				f.src = mat.Texture
+			}
+		}
+		r.faces = append(r.faces, f)
+	}
+}
+
+// Draw renders the queued faces onto dst, centered on it
+func (r *Renderer3D) Draw(dst *ebiten.Image) {
+	r.order = r.order[:0]
+	for i := range r.faces {
+		r.order = append(r.order, &r.faces[i])
+	}
+	sort.SliceStable(r.order, func(i, j int) bool {
+		return r.order[i].depth > r.order[j].depth
+	})
+
+	cx, cy := float64(dst.Bounds().Dx())/2, float64(dst.Bounds().Dy())/2
+	var src *ebiten.Image
+	var blend ebiten.Blend
+	flush := func() {
+		if len(r.indices) > 0 {
+			dst.DrawTriangles(r.vertices, r.indices, src, &ebiten.DrawTrianglesOptions{Blend: blend})
+		}
+		r.vertices = r.vertices[:0]
+		r.indices = r.indices[:0]
+	}
+
+	for _, f := range r.order {
+		// Consecutive faces sharing a source and blending are drawn in
+		// one call
+		if f.src != src || f.blend != blend || len(r.vertices)+len(f.points) > math.MaxUint16 {
+			flush()
+			src, blend = f.src, f.blend
+		}
+		b := src.Bounds()
+		base := uint16(len(r.vertices))
+		for k, pi := range f.points {
+			p := r.points[pi]
+			s := r.view.zoom * r.perspective / (r.perspective + p[2])
+			uv := cornerUVs[k%4]
+			if k < len(f.uvs) {
+				uv = f.uvs[k]
+			}
+			r.vertices = append(r.vertices, ebiten.Vertex{
+				DstX:   float32(cx + p[0]*s),
+				DstY:   float32(cy + p[1]*s),
+				SrcX:   float32(b.Min.X) + uv[0]*float32(b.Dx()),
+				SrcY:   float32(b.Min.Y) + uv[1]*float32(b.Dy()),
+				ColorR: f.clr[0],
+				ColorG: f.clr[1],
+				ColorB: f.clr[2],
+				ColorA: f.clr[3],
+			})
+		}
+		// Convex faces are drawn as triangle fans
+		for k := 1; k+1 < len(f.points); k++ {
+			r.indices = append(r.indices, base, base+uint16(k), base+uint16(k+1))
+		}
+	}
+	flush()
+}
+
+// offScreen reports whether a circle of radius r around x, y lies
+// entirely outside a w x h screen
+func offScreen(x, y, r float64, w, h int) bool {
+	return x+r < 0 || y+r < 0 || x-r > float64(w) || y-r > float64(h)
+}
+
+// vertexColor returns a vertex color for c lit by light, with opacity.
+// DrawTriangles takes vertex colors with straight alpha by default.
+func vertexColor(c color.RGBA, light, alpha float64) [4]float32 {
+	return [4]float32{
+		float32(float64(c.R) / 255 * light),
+		float32(float64(c.G) / 255 * light),
+		float32(float64(c.B) / 255 * light),
+		float32(float64(c.A) / 255 * alpha),
+	}
+}
+
+func sub(a, b [3]float64) [3]float64 {
+	return [3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]}
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
@@ -0,0 +1,261 @@
+package effects
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"math"
+	"math/rand"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed shaders/reveal.kage
+var revealShaderSrc []byte
+
+// Built-in reveal masks
+const (
+	MaskIris  = "iris"  // A circle opening from the center
+	MaskSweep = "sweep" // A diagonal wipe from the top left
+	MaskNoise = "noise" // A blotchy dissolve
+)
+
+// revealSoftness is the width of the reveal edge, in mask levels
+const revealSoftness = 0.08
+
+// maskKey identifies a mask rendered at a size
+type maskKey struct {
+	name string
+	w, h int
+}
+
+// Revealer draws images through animated grayscale masks: as the
+// threshold goes from 0 to 1, the darkest parts of the mask show the
+// image first and the brightest last. Masks are the built-in iris, sweep
+// and noise, or grayscale PNG assets given by path, stretched to the
+// image drawn.
+type Revealer struct {
+	assets fs.FS
+	shader *ebiten.Shader
+	masks  map[maskKey]*ebiten.Image
+}
+
+// NewRevealer compiles the reveal shader; assets holds the mask images
+// referenced by path
+func NewRevealer(assets fs.FS) (*Revealer, error) {
+	shader, err := ebiten.NewShader(revealShaderSrc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile reveal shader: %w", err)
+	}
+	return &Revealer{assets: assets, shader: shader, masks: map[maskKey]*ebiten.Image{}}, nil
+}
+
+// IsMask reports whether name is a built-in mask or a mask image path
+func IsMask(name string) bool {
+	switch name {
+	case MaskIris, MaskSweep, MaskNoise:
+		return true
+	}
+	return strings.HasSuffix(name, ".png")
+}
+
+// Mask returns the named mask at the given size, rendering it on first
+// use
+func (r *Revealer) Mask(name string, w, h int) (*ebiten.Image, error) {
+	key := maskKey{name, w, h}
+	if m, ok := r.masks[key]; ok {
+		return m, nil
+	}
+
+	var m *ebiten.Image
+	switch name {
+	case MaskIris, MaskSweep, MaskNoise:
+		m = ebiten.NewImageFromImage(builtinMask(name, w, h))
+	default:
+		if !IsMask(name) {
+			return nil, fmt.Errorf("unknown reveal mask %q", name)
+		}
+		src, err := LoadImage(r.assets, name)
+		if err != nil {
+			return nil, err
+		}
+		m = ebiten.NewImage(w, h)
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(float64(w)/float64(src.Bounds().Dx()), float64(h)/float64(src.Bounds().Dy()))
+		op.Filter = ebiten.FilterLinear
+		m.DrawImage(src, op)
+		src.Deallocate()
+	}
+	r.masks[key] = m
+	return m, nil
+}
+
+// builtinMask renders a built-in mask
+func builtinMask(name string, w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	var noise []float64
+	const cells = 12 // Noise blotches across the width
+	cw := max(float64(w)/cells, 1)
+	gw, gh := int(float64(w)/cw)+2, int(float64(h)/cw)+2
+	if name == MaskNoise {
+		rng := rand.New(rand.NewSource(1))
+		noise = make([]float64, gw*gh)
+		for i := range noise {
+			noise[i] = rng.Float64()
+		}
+	}
+
+	cx, cy := float64(w)/2, float64(h)/2
+	maxDist := math.Hypot(cx, cy)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v float64
+			switch name {
+			case MaskIris:
+				v = math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) / maxDist
+			case MaskSweep:
+				v = (float64(x) + float64(y)) / float64(w+h)
+			case MaskNoise:
+				// Value noise: a random grid, smoothly interpolated, plus
+				// some per-pixel grain
+				fx, fy := float64(x)/cw, float64(y)/cw
+				ix, iy := int(fx), int(fy)
+				tx, ty := smooth(fx-float64(ix)), smooth(fy-float64(iy))
+				at := func(i, j int) float64 { return noise[j*gw+i] }
+				top := at(ix, iy)*(1-tx) + at(ix+1, iy)*tx
+				bottom := at(ix, iy+1)*(1-tx) + at(ix+1, iy+1)*tx
+				v = top*(1-ty) + bottom*ty
+				v = v*0.9 + 0.1*noise[(x*7+y*13)%len(noise)]
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(math.Min(math.Max(v, 0), 1) * 255)})
+		}
+	}
+	return img
+}
+
+// smooth is the smoothstep easing of t in [0, 1]
+func smooth(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+// Draw draws src onto dst through the named mask at the given threshold,
+// 0 hiding it all and 1 showing it all, with op placing it
+func (r *Revealer) Draw(dst, src *ebiten.Image, mask string, threshold float64, op *ebiten.DrawRectShaderOptions) error {
+	b := src.Bounds()
+	m, err := r.Mask(mask, b.Dx(), b.Dy())
+	if err != nil {
+		return err
+	}
+	if op == nil {
+		op = &ebiten.DrawRectShaderOptions{}
+	}
+	op.Images[0] = src
+	op.Images[1] = m
+	op.Uniforms = map[string]any{
+		"Threshold": float32(threshold),
+		"Softness":  float32(revealSoftness),
+	}
+	dst.DrawRectShader(b.Dx(), b.Dy(), r.shader, op)
+	return nil
+}
+
+// RevealImage shows an image in the middle of the screen through a mask
+// that opens, holds, closes and stays closed, in a loop. A "reveal" sync
+// restarts the opening.
+type RevealImage struct {
+	Path  string  // Image asset, the logo when empty
+	Mask  string  // Mask name or image path, iris when empty
+	Cycle float64 // Seconds per step of the loop, 2 when zero
+
+	layout   Layout
+	image    *ebiten.Image
+	revealer *Revealer
+	t        float64 // Seconds into the loop
+}
+
+// Init loads the image and compiles the shader on the first call
+func (r *RevealImage) Init(ctx *Context) error {
+	r.layout = ctx.Layout()
+	if r.image != nil {
+		return nil
+	}
+
+	path := r.Path
+	if path == "" {
+		path = "assets/logo.png"
+	}
+	img, err := LoadImage(ctx.Assets, path)
+	if err != nil {
+		return err
+	}
+	rev, err := NewRevealer(ctx.Assets)
+	if err != nil {
+		return err
+	}
+	// Render the mask now so a bad mask name fails here
+	if _, err := rev.Mask(r.mask(), img.Bounds().Dx(), img.Bounds().Dy()); err != nil {
+		return err
+	}
+	r.image, r.revealer = img, rev
+	return nil
+}
+
+func (r *RevealImage) mask() string {
+	if r.Mask == "" {
+		return MaskIris
+	}
+	return r.Mask
+}
+
+func (r *RevealImage) cycle() float64 {
+	if r.Cycle <= 0 {
+		return 2
+	}
+	return r.Cycle
+}
+
+// Update advances the loop
+func (r *RevealImage) Update(dt float64) {
+	r.t = math.Mod(r.t+dt, 4*r.cycle())
+}
+
+// Rewind runs the loop backwards
+func (r *RevealImage) Rewind(dt float64) {
+	loop := 4 * r.cycle()
+	r.t = math.Mod(math.Mod(r.t-dt, loop)+loop, loop)
+}
+
+// Sync implements Syncer
+func (r *RevealImage) Sync(name string) {
+	if name == "reveal" {
+		r.t = 0
+	}
+}
+
+// threshold returns the mask threshold at the current point of the loop
+func (r *RevealImage) threshold() float64 {
+	step, f := math.Modf(r.t / r.cycle())
+	switch step {
+	case 0:
+		return smooth(f)
+	case 1:
+		return 1
+	case 2:
+		return 1 - smooth(f)
+	}
+	return 0
+}
+
+// Draw shows the image through the mask
+func (r *RevealImage) Draw(screen *ebiten.Image) {
+	l := r.layout
+	b := r.image.Bounds()
+	op := &ebiten.DrawRectShaderOptions{}
+	op.GeoM.Scale(l.ScaleX, l.ScaleX)
+	op.GeoM.Translate((float64(l.Width)-float64(b.Dx())*l.ScaleX)/2, (float64(l.Height)-float64(b.Dy())*l.ScaleX)/2)
+	// The mask was rendered by Init, so this cannot fail
+	_ = r.revealer.Draw(screen, r.image, r.mask(), r.threshold(), op)
+}
@@ -0,0 +1,591 @@
+package effects
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// DefaultMessage is the scrolltext of the original intro
+const DefaultMessage = `      HELLO, BILIZIR FROM DMA IS PROUD TO PRESENT HIS NEW GOLANG/EBITEN INTRO... NOT SO BAD FOR A FEW HOURS OF HARD WORK :)  HI TO ALL MEMBERS OF DMA (COUCOU PHILIPPE ET DIDIER ALORS PAS MAL NON ?), ALL MEMBERS OF THE UNION, ALL DEMOSCENE FANS...   LET'S WRAP...      `
+
+// scrollDeform is the horizontal deformation table of the scroller lines
+var scrollDeform = newScrollDeform()
+
+// ScrollDeform returns a copy of the horizontal deformation table of the
+// scroller: the offset of each line in pixels of the 800x600 frame, read
+// at the frame count plus the line and moved 64 pixels right
+func ScrollDeform() []float64 {
+	return slices.Clone(scrollDeform)
+}
+
+// newScrollDeform builds the scroll deformation wave patterns
+func newScrollDeform() []float64 {
+	table := make([]float64, 0, 1191)
+
+	// First wave pattern
+	stp1 := 7.0 / 180.0 * math.Pi
+	stp2 := 3.0 / 180.0 * math.Pi
+	for i := 0; i < 389; i++ {
+		x := 20*math.Sin(float64(i)*stp1) + 30*math.Cos(float64(i)*stp2)
+		table = append(table, x)
+	}
+
+	// Second wave pattern
+	stp1 = 72.0 / 180.0 * math.Pi
+	for i := 0; i < 120; i++ {
+		x := 4 * math.Sin(float64(i)*stp1)
+		table = append(table, x)
+	}
+
+	// Third wave pattern
+	stp1 = 8.0 / 180.0 * math.Pi
+	for i := 0; i < 68; i++ {
+		x := 40 * math.Sin(float64(i)*stp1)
+		table = append(table, x)
+	}
+
+	// Repeat first pattern
+	stp1 = 7.0 / 180.0 * math.Pi
+	stp2 = 3.0 / 180.0 * math.Pi
+	for i := 0; i < 389; i++ {
+		x := 20*math.Sin(float64(i)*stp1) + 30*math.Cos(float64(i)*stp2)
+		table = append(table, x)
+	}
+
+	// Small wave
+	stp1 = 72.0 / 180.0 * math.Pi
+	for i := 0; i < 36; i++ {
+		x := 4 * math.Sin(float64(i)*stp1)
+		table = append(table, x)
+	}
+
+	// Final wave
+	stp1 = 8.0 / 180.0 * math.Pi
+	for i := 0; i < 189; i++ {
+		x := 30 * math.Sin(float64(i)*stp1)
+		table = append(table, x)
+	}
+
+	return table
+}
+
+// ScrollChar is a character of the scrolltext as shown, with the font it
+// is drawn in
+type ScrollChar struct {
+	Char rune
+	Font int // Index in the fonts of the scroller, 0 for the soap font
+}
+
+// Scroll control code timing, per frame: how fast the waves ease to the
+// scale set by {wave} and how fast a {color:flash} fades
+const (
+	scrollWaveEase   = 0.05
+	scrollFlashDecay = 0.04
+)
+
+// scrollCue is a control code of the scrolltext, written in braces. It
+// acts as the place it was written enters the screen on the right, like
+// the classic scrollers reading their text as it comes in.
+type scrollCue struct {
+	at    int // Index of the character shown after the code
+	apply func(s *TextScroller)
+}
+
+// scrollCueState is what the control codes set, back to the defaults
+// every time the message wraps
+type scrollCueState struct {
+	next    int        // Next cue to act on
+	pause   float64    // Frames left to hold the text
+	speed   float64    // Scroll speed factor
+	wave    float64    // Scale of the waves, eased towards waveTo
+	waveTo  float64    // Scale set by the last {wave}
+	tint    [3]float32 // Color scale of the text
+	rainbow bool       // Cycle the text color through the hues
+	flash   float64    // White flash, 1 down to 0
+}
+
+// reset returns to the defaults, from the first cue
+func (c *scrollCueState) reset() {
+	*c = scrollCueState{speed: 1, wave: 1, waveTo: 1, tint: [3]float32{1, 1, 1}}
+}
+
+// scrollWaves are the named scales of {wave}
+var scrollWaves = map[string]float64{"flat": 0, "small": 0.5, "normal": 1, "big": 2}
+
+// newScrollCue returns the action of a control code, false for unknown
+// codes and invalid values
+func newScrollCue(name, value string) (func(s *TextScroller), bool) {
+	switch name {
+	case "speed":
+		k, err := strconv.ParseFloat(value, 64)
+		if err != nil || k <= 0 {
+			return nil, false
+		}
+		return func(s *TextScroller) { s.cue.speed = k }, true
+	case "pause":
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		return func(s *TextScroller) { s.cue.pause = n }, true
+	case "wave":
+		k, ok := scrollWaves[value]
+		if !ok {
+			var err error
+			if k, err = strconv.ParseFloat(value, 64); err != nil || k < 0 {
+				return nil, false
+			}
+		}
+		return func(s *TextScroller) { s.cue.waveTo = k }, true
+	case "color":
+		switch value {
+		case "flash":
+			return func(s *TextScroller) { s.cue.flash = 1 }, true
+		case "rainbow":
+			return func(s *TextScroller) { s.cue.rainbow = true }, true
+		case "normal":
+			return func(s *TextScroller) {
+				s.cue.rainbow = false
+				s.cue.tint = [3]float32{1, 1, 1}
+			}, true
+		}
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(value, "#"), 16, 32)
+		if !strings.HasPrefix(value, "#") || len(value) != 7 || err != nil {
+			return nil, false
+		}
+		tint := [3]float32{float32(rgb>>16) / 255, float32(rgb>>8&0xff) / 255, float32(rgb&0xff) / 255}
+		return func(s *TextScroller) {
+			s.cue.rainbow = false
+			s.cue.tint = tint
+		}, true
+	}
+	return nil, false
+}
+
+// parseScrollText applies the control codes of a scrolltext and returns
+// the characters shown and the cues. Codes written with a caret apply to
+// the characters after them:
+//
+//	^F<n>  draws the following characters in font n, 1 being the soap font
+//	^^     shows a caret
+//
+// Codes written in braces act as they enter the screen:
+//
+//	{speed:<k>}    scrolls k times as fast from there on
+//	{pause:<n>}    holds the text for n frames, the waves still moving
+//	{wave:<k>}     scales the waves by k: flat (0), small, normal (1) or big
+//	{color:<c>}    flash flashes the text, rainbow cycles its color, a
+//	               #rrggbb color tints it and normal restores it
+//	{{             shows a brace
+//
+// Other carets and braces are shown as written.
+func parseScrollText(text string) ([]ScrollChar, []scrollCue) {
+	runes := []rune(text)
+	chars := make([]ScrollChar, 0, len(runes))
+	var cues []scrollCue
+	font := 0
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '{' && i+1 < len(runes) {
+			if runes[i+1] == '{' {
+				chars = append(chars, ScrollChar{'{', font})
+				i++
+				continue
+			}
+			if end := slices.Index(runes[i+1:], '}'); end >= 0 {
+				name, value, _ := strings.Cut(string(runes[i+1:i+1+end]), ":")
+				if apply, ok := newScrollCue(strings.TrimSpace(name), strings.TrimSpace(value)); ok {
+					cues = append(cues, scrollCue{len(chars), apply})
+					i += end + 1
+					continue
+				}
+			}
+		}
+		if runes[i] == '^' && i+1 < len(runes) {
+			switch next := runes[i+1]; {
+			case next == '^':
+				chars = append(chars, ScrollChar{'^', font})
+				i++
+				continue
+			case next == 'F' && i+2 < len(runes) && runes[i+2] >= '1' && runes[i+2] <= '9':
+				font = int(runes[i+2] - '1')
+				i += 2
+				continue
+			}
+		}
+		chars = append(chars, ScrollChar{runes[i], font})
+	}
+	return chars, cues
+}
+
+// scrollText holds the message and the fonts it is drawn with
+type scrollText struct {
+	text     string       // As written, with its control codes
+	chars    []ScrollChar // As shown
+	cues     []scrollCue
+	fonts    []*BitmapFont
+	fallback *GlyphFallback // Renders the characters the fonts lack; may be nil
+	scale    float64        // Layout font scale
+}
+
+// newScrollText parses a message drawn with fonts
+func newScrollText(text string, fonts []*BitmapFont) *scrollText {
+	chars, cues := parseScrollText(text)
+	return &scrollText{text: text, chars: chars, cues: cues, fonts: fonts}
+}
+
+// glyph returns the font image of a character and the transform drawing
+// it in a character cell of the scroller at the origin, false for spaces.
+// Characters missing from their font are rendered by the fallback fonts,
+// in the colors of the font, and those no fallback font has either are
+// drawn as its fallback box, so they still show where they are. Every
+// font is scaled to the height of the soap font and centered in its cell,
+// so the scroller moves by the same step whatever the font.
+func (s *scrollText) glyph(c ScrollChar) (*ebiten.Image, ebiten.GeoM, bool) {
+	var geoM ebiten.GeoM
+	if len(s.fonts) == 0 || unicode.IsSpace(c.Char) {
+		return nil, geoM, false
+	}
+	font := s.fonts[0]
+	if c.Font >= 0 && c.Font < len(s.fonts) {
+		font = s.fonts[c.Font]
+	}
+	img, ok := font.Glyph(c.Char)
+	if !ok {
+		img, ok = s.fallback.FontGlyph(font, c.Char)
+	}
+	if !ok {
+		img = font.Fallback()
+	}
+	k := soapCell / float64(font.CharHeight) * s.scale
+	geoM.Scale(k, k)
+	geoM.Translate((soapCell*s.scale-float64(font.CharWidth)*k)/2, 0)
+	return img, geoM, true
+}
+
+// drawGlyph draws a single character of the scrolltext at the layout
+// scale
+func (s *scrollText) drawGlyph(dst *ebiten.Image, c ScrollChar, x, y float64) {
+	img, geoM, ok := s.glyph(c)
+	if !ok {
+		return
+	}
+	op := &ebiten.DrawImageOptions{GeoM: geoM}
+	op.GeoM.Translate(x, y)
+	dst.DrawImage(img, op)
+}
+
+// Scroller styles of the TextScroller, selected by the style of the demo
+// script scenes
+const (
+	ScrollerTCB    = "tcb"    // Distorted lines on a vertical wave, the default
+	ScrollerFlat   = "flat"   // Straight across the bottom of the screen
+	ScrollerSine   = "sine"   // Riding a sine wave
+	ScrollerRoll   = "roll"   // Lines of text rolling up a drum
+	ScrollerCircle = "circle" // Around a circle in the middle of the screen
+	ScrollerBounce = "bounce" // Each character bouncing on its own sine wave
+)
+
+// Scroller draws the scrolltext of a TextScroller in one style. The
+// TextScroller keeps the message, the font and the animation clock every
+// style shares, so switching styles carries on from the same place.
+type Scroller interface {
+	// Init allocates the buffers of the style; it is called again when the
+	// frame size changes
+	Init(s *TextScroller) error
+
+	// Draw draws the scrolltext in its current state
+	Draw(screen *ebiten.Image, s *TextScroller)
+}
+
+// TextScroller is the scrolltext part. The message moves right to left
+// through pluggable scroller styles: the TCB-style distorter of the
+// original intro, where each 2-pixel line of text is shifted horizontally
+// by a deformation table and the result is cut into columns following a
+// vertical sine wave, rendered either on the CPU or in a single shader
+// pass, and the flat, sine, roll, circle and bounce scrollers.
+type TextScroller struct {
+	Text   string        // Message, DefaultMessage when empty
+	Fonts  []*BitmapFont // Fonts ^F2, ^F3 and on select, ^F1 being the soap font
+	Speed  float64       // Animation speed multiplier, 1 when zero
+	UseGPU bool          // Render the TCB scroller through the shader path when available
+
+	ctx       *Context
+	layout    Layout
+	text      *scrollText
+	scrollers map[string]Scroller
+	names     []string // Scroller names in the order they cycle
+	selected  string   // Scroller shown when the scene names none
+	style     string   // Scroller named by the scene
+	cue       scrollCueState
+	x         float64
+	vbl       float64 // Frames elapsed, indexes the deformation table
+	phase     float64 // Vertical wave phase
+}
+
+// Init takes the soap font from the atlas, or loads it, and initializes
+// the scrollers for the context size
+func (s *TextScroller) Init(ctx *Context) error {
+	s.ctx = ctx
+	s.layout = ctx.Layout()
+
+	if s.text == nil {
+		font := ctx.Atlas.Image(AtlasFont)
+		if font == nil {
+			img, err := loadSoapFont(ctx.Assets)
+			if err != nil {
+				return err
+			}
+			font = ebiten.NewImageFromImage(img)
+		}
+		text := s.Text
+		if text == "" {
+			text = DefaultMessage
+		}
+		soap := &BitmapFont{Image: font, CharWidth: soapCell, CharHeight: soapCell, Chars: SoapFontMap}
+		s.text = newScrollText(text, append([]*BitmapFont{soap}, s.Fonts...))
+		s.cue.reset()
+	}
+	if s.scrollers == nil {
+		s.scrollers = map[string]Scroller{}
+		if s.selected == "" {
+			s.selected = ScrollerTCB
+		}
+		s.AddScroller(ScrollerTCB, &tcbScroller{})
+		s.AddScroller(ScrollerFlat, &flatScroller{})
+		s.AddScroller(ScrollerSine, &sineScroller{})
+		s.AddScroller(ScrollerRoll, &rollScroller{})
+		s.AddScroller(ScrollerCircle, &circleScroller{})
+		s.AddScroller(ScrollerBounce, &bounceScroller{})
+	}
+	if _, ok := s.scrollers[s.selected]; !ok {
+		return fmt.Errorf("unknown scroller style %q", s.selected)
+	}
+
+	s.text.fallback = ctx.Glyphs
+	s.text.scale = s.layout.FontScale
+	if s.x > float64(s.layout.Width) {
+		s.x = float64(s.layout.Width)
+	}
+	for _, name := range s.names {
+		if err := s.scrollers[name].Init(s); err != nil {
+			return fmt.Errorf("%s scroller: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// SetText replaces the message, DefaultMessage when empty, and restarts it
+// from the right edge of the screen. Before Init it only sets Text.
+func (s *TextScroller) SetText(text string) error {
+	s.Text = text
+	if s.text == nil {
+		return nil
+	}
+	if text == "" {
+		text = DefaultMessage
+	}
+	s.text = newScrollText(text, s.text.fonts)
+	s.text.fallback = s.ctx.Glyphs
+	s.text.scale = s.layout.FontScale
+	s.cue.reset()
+	s.x = float64(s.layout.Width)
+	for _, name := range s.names {
+		if err := s.scrollers[name].Init(s); err != nil {
+			return fmt.Errorf("%s scroller: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// AddScroller registers a scroller style under a name, replacing any
+// registered under the same name. Scrollers added after Init are
+// initialized at the next Init.
+func (s *TextScroller) AddScroller(name string, sc Scroller) {
+	if s.scrollers == nil {
+		s.scrollers = map[string]Scroller{}
+	}
+	if _, ok := s.scrollers[name]; !ok {
+		s.names = append(s.names, name)
+	}
+	s.scrollers[name] = sc
+}
+
+// CycleScroller selects the next scroller style shown in scenes naming
+// none, and returns its name
+func (s *TextScroller) CycleScroller() string {
+	for i, name := range s.names {
+		if name == s.selected {
+			s.selected = s.names[(i+1)%len(s.names)]
+			break
+		}
+	}
+	return s.selected
+}
+
+// SelectScroller selects the scroller style shown in scenes naming none.
+// Before Init it picks the style shown first, which Init checks exists.
+func (s *TextScroller) SelectScroller(name string) {
+	s.selected = name
+}
+
+// SetStyle shows the scroller named by the scene style, or the selected
+// one for other styles
+func (s *TextScroller) SetStyle(name string) {
+	s.style = name
+}
+
+// current returns the scroller to draw with
+func (s *TextScroller) current() Scroller {
+	if sc, ok := s.scrollers[s.style]; ok {
+		return sc
+	}
+	return s.scrollers[s.selected]
+}
+
+// Layout returns the layout the scroller was initialized for
+func (s *TextScroller) Layout() Layout {
+	return s.layout
+}
+
+// ScrollX returns the position of the start of the message: it enters at
+// the width of the frame and moves left
+func (s *TextScroller) ScrollX() float64 {
+	return s.x
+}
+
+// Frames returns the frames elapsed, which the scroller waves follow
+func (s *TextScroller) Frames() float64 {
+	return s.vbl
+}
+
+// Phase returns the phase of the vertical wave, in radians
+func (s *TextScroller) Phase() float64 {
+	return s.phase
+}
+
+// Message returns the scrolltext, as written
+func (s *TextScroller) Message() string {
+	return s.text.text
+}
+
+// Chars returns the characters of the scrolltext, as shown
+func (s *TextScroller) Chars() []ScrollChar {
+	return s.text.chars
+}
+
+// Glyph returns the font image of a character and the transform drawing
+// it in a character cell at the origin, false for characters its font
+// lacks
+func (s *TextScroller) Glyph(c ScrollChar) (*ebiten.Image, ebiten.GeoM, bool) {
+	return s.text.glyph(c)
+}
+
+// Update scrolls the text and advances the deformation
+func (s *TextScroller) Update(dt float64) {
+	f := frames(dt)
+	sp := speed(s.Speed)
+
+	// Scroll step adjusted for the layout font scale, unless a pause
+	// holds the text
+	c := &s.cue
+	if c.pause > 0 {
+		c.pause = math.Max(c.pause-sp*f, 0)
+	} else {
+		step := s.ctx.Param("scroll.speed", scrollSpeed) / scrollSpeed * s.layout.ScrollSpeed
+		s.x -= step * sp * c.speed * f
+	}
+	textWidth := float64(len(s.text.chars)) * s.layout.CharWidth()
+	if s.x < -textWidth {
+		s.x = float64(s.layout.Width)
+		c.reset()
+	}
+
+	// Act on the control codes entering the screen
+	for c.next < len(s.text.cues) {
+		cue := s.text.cues[c.next]
+		if s.x+float64(cue.at)*s.layout.CharWidth() > float64(s.layout.Width) {
+			break
+		}
+		cue.apply(s)
+		c.next++
+	}
+	c.wave += (c.waveTo - c.wave) * math.Min(scrollWaveEase*f, 1)
+	c.flash = math.Max(c.flash-scrollFlashDecay*f, 0)
+
+	s.vbl += f
+	s.phase += s.ctx.Param("scroll.wave_speed", scrollWaveFreq) * sp * f
+}
+
+// Rewind scrolls the text back, as far as the right edge of the screen,
+// and runs the waves backwards. The control codes going back off screen
+// act again when they come back in; what they set holds still.
+func (s *TextScroller) Rewind(dt float64) {
+	f := frames(dt)
+	sp := speed(s.Speed)
+	c := &s.cue
+	if c.pause == 0 {
+		step := s.ctx.Param("scroll.speed", scrollSpeed) / scrollSpeed * s.layout.ScrollSpeed
+		s.x = math.Min(s.x+step*sp*c.speed*f, float64(s.layout.Width))
+	}
+	for c.next > 0 && s.x+float64(s.text.cues[c.next-1].at)*s.layout.CharWidth() > float64(s.layout.Width) {
+		c.next--
+	}
+
+	s.vbl = math.Max(s.vbl-f, 0)
+	s.phase -= s.ctx.Param("scroll.wave_speed", scrollWaveFreq) * sp * f
+}
+
+// lineOffset returns the horizontal deformation of a 2-pixel line
+func (s *TextScroller) lineOffset(y int) float64 {
+	return (scrollDeform[(int(s.vbl)+y)%len(scrollDeform)]*s.cue.wave + 64) * s.layout.FontScale / 2
+}
+
+// columnOffset returns the vertical wave offset of a column
+func (s *TextScroller) columnOffset(x int) float64 {
+	amp := s.layout.ScrollWaveAmp
+	return amp + math.Cos(s.phase+float64(x)*scrollWaveFreq)*amp*s.cue.wave
+}
+
+// WaveScale returns the scale of the waves set by the {wave} control code,
+// 1 by default
+func (s *TextScroller) WaveScale() float64 {
+	return s.cue.wave
+}
+
+// Tint returns the color scale the {color} control codes set on the text
+func (s *TextScroller) Tint() ebiten.ColorScale {
+	c := &s.cue
+	r, g, b := c.tint[0], c.tint[1], c.tint[2]
+	if c.rainbow {
+		hr, hg, hb := hueRGB(s.vbl*4, 1)
+		r, g, b = float32(0.4+0.6*hr), float32(0.4+0.6*hg), float32(0.4+0.6*hb)
+	}
+	k := float32(1 + 2*c.flash)
+	var cs ebiten.ColorScale
+	cs.Scale(r*k, g*k, b*k, 1)
+	return cs
+}
+
+// PlaceGlyphs calls place for each character of the message overlapping
+// a strip of the given width, with its left edge
+func (s *TextScroller) PlaceGlyphs(width int, place func(c ScrollChar, x float64)) {
+	charWidth := s.layout.CharWidth()
+	x := s.x
+	for _, c := range s.text.chars {
+		if x > -charWidth && x < float64(width) {
+			place(c, x)
+		}
+		x += charWidth
+	}
+}
+
+// Draw draws the scrolltext with the scroller of the scene
+func (s *TextScroller) Draw(screen *ebiten.Image) {
+	s.current().Draw(screen, s)
+}
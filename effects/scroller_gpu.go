@@ -0,0 +1,107 @@
+package effects
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed shaders/scroller.kage
+var scrollerShaderSrc []byte
+
+// Strip rows are folded at this width to stay within GPU texture limits.
+// It is a multiple of every layout character width so no glyph straddles
+// two rows.
+const gpuStripRowWidth = 4096
+
+// gpuScroller renders the scrolltext in a single shader pass. The whole
+// message is pre-rendered once into a strip, and the shader applies both
+// the per-line horizontal offsets and the per-column vertical wave.
+type gpuScroller struct {
+	strip      *ebiten.Image
+	shader     *ebiten.Shader
+	stripWidth int
+	layout     Layout
+	offsets    []float32
+	vertices   []ebiten.Vertex
+	indices    []uint16
+}
+
+// newGPUScroller pre-renders the message of st for the given layout and
+// compiles the shader
+func newGPUScroller(st *scrollText, l Layout) (*gpuScroller, error) {
+	shader, err := ebiten.NewShader(scrollerShaderSrc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile scroller shader: %w", err)
+	}
+
+	chars := st.chars
+	charWidth := int(l.CharWidth())
+	stripWidth := len(chars) * charWidth
+	rows := (stripWidth + gpuStripRowWidth - 1) / gpuStripRowWidth
+	if rows == 0 {
+		rows = 1
+	}
+
+	strip := ebiten.NewImage(gpuStripRowWidth, rows*l.ScrollHeight)
+	for i, c := range chars {
+		pos := i * charWidth
+		row := pos / gpuStripRowWidth
+		st.drawGlyph(strip, c, float64(pos%gpuStripRowWidth), float64(row*l.ScrollHeight))
+	}
+
+	return &gpuScroller{
+		strip:      strip,
+		shader:     shader,
+		stripWidth: stripWidth,
+		layout:     l,
+		offsets:    make([]float32, scrollLines),
+		vertices:   make([]ebiten.Vertex, 4),
+		indices:    []uint16{0, 1, 2, 1, 2, 3},
+	}, nil
+}
+
+// Dispose releases the pre-rendered strip
+func (s *gpuScroller) Dispose() {
+	s.strip.Deallocate()
+}
+
+// Draw renders the deformed scroller band onto dst, the vertical wave
+// scaled by waveScale and the text colored by tint
+func (s *gpuScroller) Draw(dst *ebiten.Image, scrollX, wavePhase, waveScale float64, lineOffset func(int) float64, tint ebiten.ColorScale) {
+	for y := range s.offsets {
+		s.offsets[y] = float32(math.Floor(lineOffset(y)))
+	}
+
+	// One quad covering the band the wave can reach
+	l := s.layout
+	amp := l.ScrollWaveAmp
+	x0, y0 := float32(0), float32(l.ScrollBaseY+amp*(1-waveScale))
+	x1, y1 := float32(dst.Bounds().Dx()), float32(l.ScrollBaseY+amp*(1+waveScale)+float64(l.ScrollHeight))
+	sw, sh := float32(s.strip.Bounds().Dx()), float32(s.strip.Bounds().Dy())
+	r, g, b, a := tint.R(), tint.G(), tint.B(), tint.A()
+	s.vertices[0] = ebiten.Vertex{DstX: x0, DstY: y0, SrcX: 0, SrcY: 0, ColorR: r, ColorG: g, ColorB: b, ColorA: a}
+	s.vertices[1] = ebiten.Vertex{DstX: x1, DstY: y0, SrcX: sw, SrcY: 0, ColorR: r, ColorG: g, ColorB: b, ColorA: a}
+	s.vertices[2] = ebiten.Vertex{DstX: x0, DstY: y1, SrcX: 0, SrcY: sh, ColorR: r, ColorG: g, ColorB: b, ColorA: a}
+	s.vertices[3] = ebiten.Vertex{DstX: x1, DstY: y1, SrcX: sw, SrcY: sh, ColorR: r, ColorG: g, ColorB: b, ColorA: a}
+
+	op := &ebiten.DrawTrianglesShaderOptions{}
+	op.Images[0] = s.strip
+	op.Uniforms = map[string]any{
+		"ScrollX":     float32(scrollX),
+		"BaseY":       float32(l.ScrollBaseY),
+		"WavePhase":   float32(wavePhase),
+		"WaveAmp":     float32(amp),
+		"WaveScale":   float32(waveScale),
+		"WaveFreq":    float32(scrollWaveFreq),
+		"ColumnWidth": float32(l.ScrollColumnWidth),
+		"StripWidth":  float32(s.stripWidth),
+		"RowWidth":    float32(gpuStripRowWidth),
+		"RowHeight":   float32(l.ScrollHeight),
+		"LineHeight":  float32(l.ScrollLineHeight),
+		"LineOffsets": s.offsets,
+	}
+	dst.DrawTrianglesShader(s.vertices, s.indices, s.shader, op)
+}
@@ -0,0 +1,247 @@
+package effects
+
+import (
+	"image"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// flatScroller moves the text straight across the scroller band
+type flatScroller struct{}
+
+// Init has nothing to allocate
+func (f *flatScroller) Init(s *TextScroller) error {
+	return nil
+}
+
+// Draw draws the glyphs in the middle of the band
+func (f *flatScroller) Draw(screen *ebiten.Image, s *TextScroller) {
+	y := s.layout.ScrollBaseY + s.layout.ScrollWaveAmp
+	tint := s.Tint()
+	s.PlaceGlyphs(s.layout.Width, func(c ScrollChar, x float64) {
+		if img, geoM, ok := s.text.glyph(c); ok {
+			op := &ebiten.DrawImageOptions{GeoM: geoM, ColorScale: tint}
+			op.GeoM.Translate(x, y)
+			screen.DrawImage(img, op)
+		}
+	})
+}
+
+// sineColumn is the width of the slices of the sine scroller at 800x600
+const sineColumn = 4
+
+// sineScroller draws the text flat into a buffer, then cuts it into thin
+// columns riding a sine wave twice the height of the TCB wave
+type sineScroller struct {
+	buffer *ebiten.Image
+}
+
+// Init reallocates the buffer for the layout
+func (sc *sineScroller) Init(s *TextScroller) error {
+	if sc.buffer != nil {
+		sc.buffer.Deallocate()
+	}
+	sc.buffer = ebiten.NewImage(s.layout.Width, s.layout.ScrollHeight)
+	return nil
+}
+
+// Draw draws the columns, two waves across the screen
+func (sc *sineScroller) Draw(screen *ebiten.Image, s *TextScroller) {
+	l := s.layout
+	sc.buffer.Clear()
+	s.PlaceGlyphs(l.Width, func(c ScrollChar, x float64) {
+		s.text.drawGlyph(sc.buffer, c, x, 0)
+	})
+
+	cw := max(1, int(math.Round(sineColumn*l.ScaleX)))
+	amp := 2 * l.ScrollWaveAmp * s.cue.wave
+	k := 4 * math.Pi / float64(l.Width)
+	tint := s.Tint()
+	for x := 0; x < l.Width; x += cw {
+		op := &ebiten.DrawImageOptions{ColorScale: tint}
+		op.GeoM.Translate(float64(x), l.ScrollBaseY+l.ScrollWaveAmp+amp*math.Sin(2*s.phase+float64(x)*k))
+		screen.DrawImage(sc.buffer.SubImage(image.Rect(x, 0, x+cw, l.ScrollHeight)).(*ebiten.Image), op)
+	}
+}
+
+// rollScroller wraps the message into lines rolling up the front of a
+// drum, squashed and darkened towards its top and bottom. The roll ends
+// as the horizontal scroll wraps, so both styles stay in step.
+type rollScroller struct {
+	lines [][]ScrollChar
+}
+
+// Init word-wraps the message to the width of the screen
+func (r *rollScroller) Init(s *TextScroller) error {
+	cols := max(int(float64(s.layout.Width)/s.layout.CharWidth())-2, 1)
+	r.lines = r.lines[:0]
+	var line []ScrollChar
+	for _, word := range scrollWords(s.text.chars) {
+		switch {
+		case len(line) == 0:
+			line = word
+		case len(line)+1+len(word) <= cols:
+			line = append(append(line, ScrollChar{' ', word[0].Font}), word...)
+		default:
+			r.lines = append(r.lines, line)
+			line = word
+		}
+	}
+	if len(line) > 0 {
+		r.lines = append(r.lines, line)
+	}
+	return nil
+}
+
+// scrollWords splits the characters of a scrolltext at spaces
+func scrollWords(chars []ScrollChar) [][]ScrollChar {
+	var words [][]ScrollChar
+	var word []ScrollChar
+	for _, c := range chars {
+		if c.Char != ' ' {
+			word = append(word, c)
+			continue
+		}
+		if len(word) > 0 {
+			words = append(words, word)
+			word = nil
+		}
+	}
+	if len(word) > 0 {
+		words = append(words, word)
+	}
+	return words
+}
+
+// Draw draws the lines on the visible half of the drum
+func (r *rollScroller) Draw(screen *ebiten.Image, s *TextScroller) {
+	l := s.layout
+	cw := l.CharWidth()
+	lineH := cw
+	radius := 0.3 * float64(l.Height)
+	cy := float64(l.Height) / 2
+
+	// The progress of the horizontal scroll, 0 to 1, rolls the lines from
+	// below the drum to above it
+	textWidth := float64(len(s.text.chars)) * cw
+	progress := (float64(l.Width) - s.x) / (float64(l.Width) + textWidth)
+	rolled := progress * (float64(len(r.lines))*lineH + math.Pi*radius)
+	tint := s.Tint()
+
+	for i, line := range r.lines {
+		a := (float64(i)*lineH + lineH/2 + math.Pi*radius/2 - rolled) / radius
+		if math.Abs(a) >= math.Pi/2 {
+			continue
+		}
+		squash := math.Cos(a)
+		y := cy + radius*math.Sin(a) - lineH*squash/2
+		x := (float64(l.Width) - float64(len(line))*cw) / 2
+		for _, c := range line {
+			if img, geoM, ok := s.text.glyph(c); ok {
+				op := &ebiten.DrawImageOptions{GeoM: geoM, ColorScale: tint}
+				op.GeoM.Scale(1, squash)
+				op.GeoM.Translate(x, y)
+				op.ColorScale.Scale(float32(squash), float32(squash), float32(squash), 1)
+				screen.DrawImage(img, op)
+			}
+			x += cw
+		}
+	}
+}
+
+// circleScroller runs the text around a circle in the middle of the
+// screen, clockwise from the bottom, the tops of the glyphs towards the
+// center
+type circleScroller struct{}
+
+// Init has nothing to allocate
+func (c *circleScroller) Init(s *TextScroller) error {
+	return nil
+}
+
+// Draw draws the glyphs on the circle, rotated along it
+func (c *circleScroller) Draw(screen *ebiten.Image, s *TextScroller) {
+	l := s.layout
+	cw := l.CharWidth()
+	radius := 0.38 * math.Min(float64(l.Width), float64(l.Height))
+	cx, cy := float64(l.Width)/2, float64(l.Height)/2
+	circumference := 2 * math.Pi * radius
+	tint := s.Tint()
+
+	// Glyphs enter at the bottom as they would enter the flat scroller at
+	// the right edge
+	gx := s.x
+	for _, c := range s.text.chars {
+		d := gx - float64(l.Width) + circumference
+		gx += cw
+		if d < 0 || d >= circumference-cw {
+			continue
+		}
+		img, geoM, ok := s.text.glyph(c)
+		if !ok {
+			continue
+		}
+		theta := math.Pi/2 - (d+cw/2)/radius
+		op := &ebiten.DrawImageOptions{GeoM: geoM, ColorScale: tint}
+		op.GeoM.Translate(-cw/2, -cw/2)
+		op.GeoM.Rotate(theta - math.Pi/2)
+		op.GeoM.Translate(cx+radius*math.Cos(theta), cy+radius*math.Sin(theta))
+		op.Filter = ebiten.FilterLinear
+		screen.DrawImage(img, op)
+	}
+}
+
+// Bounce scroller defaults: the height of the bounces at 800x600, their
+// frequency relative to the wave speed, the phase between neighbouring
+// characters in radians and the lean at the top of a bounce in radians
+const (
+	bounceHeight = 60
+	bounceFreq   = 0.5
+	bounceSpread = 0.6
+	bounceTilt   = 0.2
+	bounceSquash = 0.2 // Squash of a character landing, as a fraction of its height
+)
+
+// bounceScroller bounces each character on its own sine wave along the
+// bottom of the screen, leaning from side to side and squashing as it
+// lands: the jelly scroller. The bounces follow scroll.bounce_height,
+// scroll.bounce_freq, scroll.bounce_spread and scroll.bounce_tilt.
+type bounceScroller struct{}
+
+// Init has nothing to allocate
+func (b *bounceScroller) Init(s *TextScroller) error {
+	return nil
+}
+
+// Draw draws the glyphs standing on the bottom of the band
+func (b *bounceScroller) Draw(screen *ebiten.Image, s *TextScroller) {
+	l := s.layout
+	cw := l.CharWidth()
+	floor := l.ScrollBaseY + 2*l.ScrollWaveAmp + float64(l.ScrollHeight)
+	height := s.ctx.Param("scroll.bounce_height", bounceHeight) * l.ScaleY * s.cue.wave
+	freq := s.ctx.Param("scroll.bounce_freq", bounceFreq)
+	spread := s.ctx.Param("scroll.bounce_spread", bounceSpread)
+	tilt := s.ctx.Param("scroll.bounce_tilt", bounceTilt)
+	tint := s.Tint()
+
+	s.PlaceGlyphs(l.Width, func(c ScrollChar, x float64) {
+		img, geoM, ok := s.text.glyph(c)
+		if !ok {
+			return
+		}
+		i := math.Round((x - s.x) / cw)
+		a := s.phase*freq + i*spread
+		lift := math.Abs(math.Sin(a))
+		squash := bounceSquash * math.Pow(1-lift, 8)
+
+		// Squashed and leant about the middle of the bottom of the glyph
+		op := &ebiten.DrawImageOptions{GeoM: geoM, ColorScale: tint}
+		op.GeoM.Translate(-cw/2, -cw)
+		op.GeoM.Scale(1+squash, 1-squash)
+		op.GeoM.Rotate(tilt * math.Cos(a) * lift)
+		op.GeoM.Translate(x+cw/2, floor-height*lift)
+		op.Filter = ebiten.FilterLinear
+		screen.DrawImage(img, op)
+	})
+}
@@ -0,0 +1,92 @@
+package effects
+
+import (
+	"image"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// tcbScroller is the distorter of the original intro: each 2-pixel line
+// of text is shifted horizontally by the deformation table, then the
+// result is cut into columns following a vertical sine wave
+type tcbScroller struct {
+	workBuffer   *ebiten.Image
+	deformBuffer *ebiten.Image
+	gpu          *gpuScroller
+}
+
+// Init reallocates the buffers and the shader path for the layout
+func (t *tcbScroller) Init(s *TextScroller) error {
+	l := s.layout
+	for _, img := range []*ebiten.Image{t.workBuffer, t.deformBuffer} {
+		if img != nil {
+			img.Deallocate()
+		}
+	}
+	t.workBuffer = ebiten.NewImage(l.Width+1024, l.ScrollHeight) // Wider for the 2x deformation
+	t.deformBuffer = ebiten.NewImage(l.Width, l.ScrollHeight)
+
+	if t.gpu != nil {
+		t.gpu.Dispose()
+	}
+	var err error
+	if t.gpu, err = newGPUScroller(s.text, l); err != nil {
+		log.Printf("GPU scroller unavailable: %v", err)
+	}
+	return nil
+}
+
+// Draw draws the deformed scrolltext
+func (t *tcbScroller) Draw(screen *ebiten.Image, s *TextScroller) {
+	if s.UseGPU && t.gpu != nil {
+		t.gpu.Draw(screen, s.x, s.phase, s.cue.wave, s.lineOffset, s.Tint())
+		return
+	}
+
+	l := s.layout
+	st := s.text
+
+	// Clear buffers
+	t.workBuffer.Clear()
+	t.deformBuffer.Clear()
+
+	// Draw text to work buffer with 2x scale
+	s.PlaceGlyphs(t.workBuffer.Bounds().Dx(), func(c ScrollChar, x float64) {
+		st.drawGlyph(t.workBuffer, c, x, 0)
+	})
+
+	// Apply deformation line by line (adjusted for the font scale)
+	lh := l.ScrollLineHeight
+	for y := 0; y < scrollLines; y++ { // Increased from 25 to 32 for larger font
+		offsetX := s.lineOffset(y)
+
+		srcRect := image.Rect(int(offsetX), y*lh, int(offsetX)+l.Width, (y+1)*lh)
+		if srcRect.Min.X < 0 {
+			srcRect.Min.X = 0
+		}
+		if srcRect.Max.X > t.workBuffer.Bounds().Dx() {
+			srcRect.Max.X = t.workBuffer.Bounds().Dx()
+		}
+
+		subImg := t.workBuffer.SubImage(srcRect).(*ebiten.Image)
+
+		dstOp := &ebiten.DrawImageOptions{}
+		dstOp.GeoM.Translate(0, float64(y*lh))
+		t.deformBuffer.DrawImage(subImg, dstOp)
+	}
+
+	// Draw deformed scroll with vertical wave
+	cw := l.ScrollColumnWidth
+	tint := s.Tint()
+	for x := 0; x < l.Width/cw; x++ { // 50 columns at 800px width
+		op := &ebiten.DrawImageOptions{ColorScale: tint}
+		op.GeoM.Translate(float64(x*cw), l.ScrollBaseY+s.columnOffset(x)) // Adjusted Y position for larger text
+
+		subImg := t.deformBuffer.SubImage(
+			image.Rect(x*cw, 0, (x+1)*cw, l.ScrollHeight),
+		).(*ebiten.Image)
+
+		screen.DrawImage(subImg, op)
+	}
+}
@@ -0,0 +1,63 @@
+package effects
+
+import (
+	"image"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// TestScrollTextGlyph checks that the scrolltext is looked up one rune at
+// a time: multi-byte letters find their cell, directly, uppercased or
+// folded, runes outside the map and invalid UTF-8 draw the fallback box,
+// and spaces draw nothing
+func TestScrollTextGlyph(t *testing.T) {
+	font := &BitmapFont{
+		Image:      ebiten.NewImage(32, 16),
+		CharWidth:  8,
+		CharHeight: 8,
+		Chars:      NewFontMap(4, "ABCD", "ÉÇ"),
+	}
+	cell := func(i int) image.Rectangle {
+		return image.Rect(i%4*8, i/4*8, i%4*8+8, i/4*8+8)
+	}
+
+	tests := []struct {
+		name string
+		text string
+		cell int // -1 for the fallback box
+	}{
+		{"ascii", "B", 1},
+		{"multi-byte", "É", 4},
+		{"multi-byte uppercased", "ç", 5},
+		{"multi-byte folded", "Ā", 0},
+		{"outside the map", "Ж", -1},
+		{"invalid UTF-8", "\xff", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScrollText(tt.text, []*BitmapFont{font})
+			if len(s.chars) != 1 {
+				t.Fatalf("%q parsed into %d characters, want 1", tt.text, len(s.chars))
+			}
+			img, _, ok := s.glyph(s.chars[0])
+			if !ok {
+				t.Fatalf("%q draws no glyph", tt.text)
+			}
+			if tt.cell < 0 {
+				if img != font.Fallback() {
+					t.Errorf("%q (%U) is not drawn as the fallback box", tt.text, s.chars[0].Char)
+				}
+				return
+			}
+			if got, want := img.Bounds(), cell(tt.cell); got != want {
+				t.Errorf("%q is drawn from %v, want cell %d at %v", tt.text, got, tt.cell, want)
+			}
+		})
+	}
+
+	s := newScrollText(" ", []*BitmapFont{font})
+	if _, _, ok := s.glyph(s.chars[0]); ok {
+		t.Errorf("a space draws a glyph")
+	}
+}
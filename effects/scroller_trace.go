@@ -0,0 +1,56 @@
+package effects
+
+// ScrollerFrame is the scroller geometry computed for one frame, used to
+// catch regressions in the scroller math
+type ScrollerFrame struct {
+	Frame         int         `json:"frame"`
+	X             float64     `json:"x"`
+	LineOffsets   []float64   `json:"line_offsets"`   // Horizontal shift of each 2-pixel line
+	ColumnOffsets []float64   `json:"column_offsets"` // Vertical wave offset of each column
+	Glyphs        []GlyphSpot `json:"glyphs"`
+}
+
+// GlyphSpot is where a character of the message is drawn in the
+// scroller work buffer
+type GlyphSpot struct {
+	Char  string  `json:"char"`
+	Index int     `json:"index"` // Position in the font, -1 when missing
+	X     float64 `json:"x"`
+}
+
+// TraceScroller runs the scroller math for n frames at FrameRate without
+// drawing and returns the geometry of each frame. It needs no graphics
+// context, so it can run from the command line.
+func TraceScroller(text string, l Layout, params Params, n int) []ScrollerFrame {
+	if text == "" {
+		text = DefaultMessage
+	}
+	s := &TextScroller{
+		ctx:    &Context{Width: l.Width, Height: l.Height, Params: params},
+		layout: l,
+		text:   newScrollText(text, nil),
+	}
+	s.cue.reset()
+
+	// The work buffer is wider than the screen, as in Draw
+	workWidth := l.Width + 1024
+
+	frames := make([]ScrollerFrame, 0, n)
+	for i := 0; i < n; i++ {
+		f := ScrollerFrame{Frame: i, X: s.x}
+		for y := 0; y < scrollLines; y++ {
+			f.LineOffsets = append(f.LineOffsets, s.lineOffset(y))
+		}
+		for x := 0; x < l.Width/l.ScrollColumnWidth; x++ {
+			f.ColumnOffsets = append(f.ColumnOffsets, s.columnOffset(x))
+		}
+		s.PlaceGlyphs(workWidth, func(c ScrollChar, x float64) {
+			index, _ := SoapFontMap.Index(c.Char)
+			f.Glyphs = append(f.Glyphs, GlyphSpot{Char: string(c.Char), Index: index, X: x})
+		})
+		frames = append(frames, f)
+
+		s.Update(1.0 / FrameRate)
+	}
+	return frames
+}
@@ -0,0 +1,145 @@
+package effects
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Starfield flies through dot stars spread over parallax layers: the
+// nearer a layer, the faster and brighter its stars. It makes an
+// alternative background to the copper bars.
+type Starfield struct {
+	Speed  float64 // Animation speed multiplier, 1 when zero
+	Layers int     // Parallax layers, 3 when zero
+
+	ctx      *Context
+	layout   Layout
+	rng      *rand.Rand
+	stars    []star
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// star is a dot in normalized space: x and y in [-1, 1] across the
+// screen at the far plane, z from 1 (far) down to the camera
+type star struct {
+	x, y, z float64
+	layer   int
+}
+
+// Star depth limits; stars closer than starNear are recycled to the back
+const (
+	starNear  = 0.05
+	starFocal = 0.5 // Stars at z = starFocal reach the screen edges
+)
+
+// Init creates the stars on the first call
+func (s *Starfield) Init(ctx *Context) error {
+	s.ctx = ctx
+	s.layout = ctx.Layout()
+	if s.rng == nil {
+		s.rng = rand.New(rand.NewSource(1))
+	}
+	s.resize(int(ctx.Param("stars.count", 300)))
+	return nil
+}
+
+func (s *Starfield) layers() int {
+	if s.Layers <= 0 {
+		return 3
+	}
+	return s.Layers
+}
+
+// resize adds or removes stars; new stars start anywhere in depth so
+// the field does not arrive as one wave
+func (s *Starfield) resize(n int) {
+	n = max(n, 0)
+	if n <= len(s.stars) {
+		s.stars = s.stars[:n]
+		return
+	}
+	for i := len(s.stars); i < n; i++ {
+		st := star{layer: i % s.layers()}
+		s.respawn(&st)
+		st.z = starNear + s.rng.Float64()*(1-starNear)
+		s.stars = append(s.stars, st)
+	}
+}
+
+// respawn moves a star back to the far plane at a random position
+func (s *Starfield) respawn(st *star) {
+	st.x = s.rng.Float64()*2 - 1
+	st.y = s.rng.Float64()*2 - 1
+	st.z = 1
+}
+
+// Update moves the stars towards the camera, each layer at its speed
+func (s *Starfield) Update(dt float64) {
+	s.resize(int(s.ctx.Param("stars.count", 300)))
+	f := frames(dt) * speed(s.Speed) * s.ctx.Param("stars.speed", 1)
+	layers := float64(s.layers())
+	for i := range s.stars {
+		st := &s.stars[i]
+		st.z -= 0.004 * float64(st.layer+1) / layers * f
+		if st.z <= starNear || math.Abs(st.x*starFocal/st.z) > 1 || math.Abs(st.y*starFocal/st.z) > 1 {
+			s.respawn(st)
+		}
+	}
+}
+
+// Rewind moves the stars away from the camera; those passing the far
+// plane come back close by, somewhere on screen
+func (s *Starfield) Rewind(dt float64) {
+	f := frames(dt) * speed(s.Speed) * s.ctx.Param("stars.speed", 1)
+	layers := float64(s.layers())
+	for i := range s.stars {
+		st := &s.stars[i]
+		st.z += 0.004 * float64(st.layer+1) / layers * f
+		if st.z >= 1 {
+			st.z = 2 * starNear
+			st.x = (s.rng.Float64()*2 - 1) * st.z / starFocal
+			st.y = (s.rng.Float64()*2 - 1) * st.z / starFocal
+		}
+	}
+}
+
+// Draw renders the stars as small squares in a single draw call
+func (s *Starfield) Draw(screen *ebiten.Image) {
+	l := s.layout
+	cx, cy := float64(l.Width)/2, float64(l.Height)/2
+	layers := float64(s.layers())
+
+	s.vertices = s.vertices[:0]
+	s.indices = s.indices[:0]
+	for _, st := range s.stars {
+		if len(s.vertices)+4 > math.MaxUint16 {
+			break
+		}
+		x := cx + st.x*starFocal/st.z*cx
+		y := cy + st.y*starFocal/st.z*cy
+
+		// Far layers are dimmer, and stars fade in from the far plane
+		depth := float64(st.layer+1) / layers
+		light := float32((0.3 + 0.7*depth) * math.Min(1, (1-st.z)*4))
+		size := math.Max(1, math.Round((1+depth*(1-st.z)*2)*l.ScaleY))
+
+		base := uint16(len(s.vertices))
+		for _, c := range [4][2]float64{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+			s.vertices = append(s.vertices, ebiten.Vertex{
+				DstX:   float32(x + c[0]*size),
+				DstY:   float32(y + c[1]*size),
+				SrcX:   float32(whiteImage.Bounds().Min.X),
+				SrcY:   float32(whiteImage.Bounds().Min.Y),
+				ColorR: light,
+				ColorG: light,
+				ColorB: light,
+				ColorA: 1,
+			})
+		}
+		s.indices = append(s.indices, base, base+1, base+2, base, base+2, base+3)
+	}
+	screen.DrawTriangles(s.vertices, s.indices, whiteImage, nil)
+}
@@ -0,0 +1,128 @@
+package effects
+
+import (
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Tunnel texture size; both must be powers of two
+const (
+	tunnelTexSize = 256
+	tunnelTexMask = tunnelTexSize - 1
+)
+
+// Tunnel flies down a texture-mapped tunnel. For every pixel, lookup
+// tables precomputed at Init give the texture row (depth) and column
+// (angle) it shows, so each frame is only table lookups written into an
+// image with WritePixels. The tables cover twice the frame in each
+// direction, and the frame pans across them to make the tunnel wind.
+type Tunnel struct {
+	Speed float64 // Animation speed multiplier, 1 when zero
+
+	ctx    *Context
+	layout Layout
+	w, h   int // Frame size, half the layout resolution
+
+	depth  []uint8 // Texture row per table entry
+	angle  []uint8 // Texture column per table entry
+	shade  []uint8 // Darkening towards the far end, 0 to 255
+	tex    []byte  // RGBA texture, tunnelTexSize square
+	pixels []byte
+	frame  *ebiten.Image
+
+	t float64 // Frames elapsed
+}
+
+// Init builds the lookup tables for the frame size and the texture
+func (t *Tunnel) Init(ctx *Context) error {
+	t.ctx = ctx
+	t.layout = ctx.Layout()
+	t.w, t.h = max(t.layout.Width/2, 1), max(t.layout.Height/2, 1)
+
+	tw, th := 2*t.w, 2*t.h
+	t.depth = make([]uint8, tw*th)
+	t.angle = make([]uint8, tw*th)
+	t.shade = make([]uint8, tw*th)
+	radius := 32.0 * float64(t.h) / 150 // Tunnel radius, in frame pixels
+	for y := 0; y < th; y++ {
+		for x := 0; x < tw; x++ {
+			dx, dy := float64(x-t.w), float64(y-t.h)
+			d := math.Max(math.Hypot(dx, dy), 1)
+			i := y*tw + x
+			t.depth[i] = uint8(int(radius*tunnelTexSize/d) & tunnelTexMask)
+			t.angle[i] = uint8(int(tunnelTexSize*(math.Atan2(dy, dx)/(2*math.Pi)+0.5)) & tunnelTexMask)
+			t.shade[i] = uint8(math.Min(d/float64(t.h), 1) * 255)
+		}
+	}
+
+	if t.tex == nil {
+		t.tex = tunnelTexture()
+	}
+	t.pixels = make([]byte, 4*t.w*t.h)
+	if t.frame != nil {
+		t.frame.Deallocate()
+	}
+	t.frame = ebiten.NewImage(t.w, t.h)
+	return nil
+}
+
+// tunnelTexture draws the tunnel wall: an XOR pattern in the pink and
+// purple tones of the intro, with bright seams every 32 texels
+func tunnelTexture() []byte {
+	tex := make([]byte, 4*tunnelTexSize*tunnelTexSize)
+	for y := 0; y < tunnelTexSize; y++ {
+		for x := 0; x < tunnelTexSize; x++ {
+			v := (x ^ y) & 0xff
+			r, g, b := 96+v*5/8, v/4, 128+v/2
+			if x&31 == 0 || y&31 == 0 {
+				r, g, b = 255, 160, 220
+			}
+			i := 4 * (y*tunnelTexSize + x)
+			tex[i], tex[i+1], tex[i+2], tex[i+3] = byte(r), byte(g), byte(b), 0xff
+		}
+	}
+	return tex
+}
+
+// Update moves down the tunnel
+func (t *Tunnel) Update(dt float64) {
+	t.t += frames(dt) * speed(t.Speed) * t.ctx.Param("tunnel.speed", 1)
+}
+
+// Rewind moves back up the tunnel
+func (t *Tunnel) Rewind(dt float64) {
+	t.Update(-dt)
+}
+
+// Draw renders the tunnel at half resolution and scales it up
+func (t *Tunnel) Draw(screen *ebiten.Image) {
+	// Pan the frame across the tables so the tunnel winds
+	ox := t.w/2 + int(float64(t.w)/2*math.Sin(t.t*0.013))
+	oy := t.h/2 + int(float64(t.h)/2*math.Sin(t.t*0.021))
+	move := int(t.t * 2)   // Texels per frame into the tunnel
+	turn := int(t.t * 0.6) // Texels per frame around it
+	tw := 2 * t.w
+
+	for y := 0; y < t.h; y++ {
+		row := (y+oy)*tw + ox
+		out := t.pixels[4*y*t.w:]
+		for x := 0; x < t.w; x++ {
+			i := row + x
+			u := (int(t.angle[i]) + turn) & tunnelTexMask
+			v := (int(t.depth[i]) + move) & tunnelTexMask
+			src := t.tex[4*(v*tunnelTexSize+u):]
+			s := uint16(t.shade[i])
+			out[4*x] = byte(uint16(src[0]) * s / 255)
+			out[4*x+1] = byte(uint16(src[1]) * s / 255)
+			out[4*x+2] = byte(uint16(src[2]) * s / 255)
+			out[4*x+3] = 0xff
+		}
+	}
+	t.frame.WritePixels(t.pixels)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(t.layout.Width)/float64(t.w), float64(t.layout.Height)/float64(t.h))
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(t.frame, op)
+}
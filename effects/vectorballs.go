@@ -0,0 +1,244 @@
+package effects
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Vector balls: vectorBallCount balls in formations of about
+// vectorBallSpan pixels at 800x600, changing every vectorBallHold frames
+// over vectorBallGlide frames
+const (
+	vectorBallCount  = 64
+	vectorBallSpan   = 150
+	vectorBallSize   = 26  // Ball diameter in pixels at the center depth
+	vectorBallFocal  = 400 // Perspective focal length, in pixels
+	vectorBallSprite = 32  // Sprite resolution
+	vectorBallHold   = 360
+	vectorBallGlide  = 90
+)
+
+// vectorBallColor is the color of the ball sprite
+var vectorBallColor = color.RGBA{80, 170, 255, 255}
+
+// vectorBallFormations are the shapes the balls fly in, in units of
+// vectorBallSpan: a 4x4x4 lattice of cube corners, a torus and a spiral
+var vectorBallFormations = func() [][vectorBallCount][3]float64 {
+	var cube, torus, spiral [vectorBallCount][3]float64
+	for i := range vectorBallCount {
+		// 4 x 4 x 4 corners
+		cube[i] = [3]float64{
+			float64(i%4)/1.5 - 1,
+			float64(i/4%4)/1.5 - 1,
+			float64(i/16)/1.5 - 1,
+		}
+
+		// 16 balls around the ring, 4 around the tube
+		u := 2 * math.Pi * float64(i/4) / 16
+		v := 2*math.Pi*float64(i%4)/4 + u/2
+		r := 0.9 + 0.35*math.Cos(v)
+		torus[i] = [3]float64{r * math.Cos(u), 0.35 * math.Sin(v), r * math.Sin(u)}
+
+		// 3 turns from top to bottom
+		t := float64(i) / (vectorBallCount - 1)
+		a := t * 3 * 2 * math.Pi
+		spiral[i] = [3]float64{0.8 * math.Cos(a), t*2 - 1, 0.8 * math.Sin(a)}
+	}
+	return [][vectorBallCount][3]float64{cube, torus, spiral}
+}()
+
+// VectorBalls flies shaded ball sprites through 3D formations, sized by
+// depth and drawn back to front, as in the Union era intros. The balls
+// glide from one formation to the next on their own, or on "formation"
+// syncs.
+type VectorBalls struct {
+	Speed float64 // Animation speed multiplier, 1 when zero
+
+	ctx       *Context
+	layout    Layout
+	sprite    *ebiten.Image
+	orient    Quat
+	formation int     // Formation the balls are in or leaving
+	glide     float64 // Frames into the glide to the next, or -1
+	hold      float64 // Frames in the current formation
+	balls     [vectorBallCount][3]float64
+	order     []int
+	camera    Camera // Of the shot directing the balls
+	vertices  []ebiten.Vertex
+	indices   []uint16
+}
+
+// Init takes the ball sprite from the atlas, or renders it, on the first
+// call
+func (v *VectorBalls) Init(ctx *Context) error {
+	v.ctx = ctx
+	v.layout = ctx.Layout()
+	if v.sprite != nil {
+		return nil
+	}
+	v.sprite = ctx.Atlas.Image(AtlasBall)
+	if v.sprite == nil {
+		v.sprite = ebiten.NewImageFromImage(ballSprite(vectorBallSprite, vectorBallColor))
+	}
+	v.orient = EulerQuat(0.4, 0.3, 0)
+	v.glide = -1
+	return nil
+}
+
+// ballSprite renders a ball of the given color lit from the top left,
+// with a specular highlight and antialiased edges
+func ballSprite(size int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	light := [3]float64{-0.45, -0.55, -0.7}
+	l := math.Sqrt(dot(light, light))
+	light = [3]float64{light[0] / l, light[1] / l, light[2] / l}
+	r := float64(size)/2 - 1 // Keep a transparent border for filtering
+	for y := range size {
+		for x := range size {
+			nx := (float64(x) + 0.5 - float64(size)/2) / r
+			ny := (float64(y) + 0.5 - float64(size)/2) / r
+			d := nx*nx + ny*ny
+			alpha := math.Min(math.Max((1-math.Sqrt(d))*r, 0), 1)
+			if alpha == 0 {
+				continue
+			}
+			// Normal towards the viewer, -z
+			n := [3]float64{nx, ny, -math.Sqrt(math.Max(1-d, 0))}
+			diffuse := math.Max(dot(n, light), 0)
+			spec := math.Pow(diffuse, 24)
+			shade := 0.25 + 0.75*diffuse
+			ch := func(v uint8) uint8 {
+				return uint8(math.Min(float64(v)*shade+255*spec, 255) * alpha)
+			}
+			img.SetRGBA(x, y, color.RGBA{ch(c.R), ch(c.G), ch(c.B), uint8(alpha * 255)})
+		}
+	}
+	return img
+}
+
+// Update turns the formation and glides between formations
+func (v *VectorBalls) Update(dt float64) {
+	f := frames(dt) * speed(v.Speed)
+	spin := v.ctx.Param("balls.spin", 1) * f
+	v.orient = EulerQuat(0.011*spin, 0.017*spin, 0.006*spin).Mul(v.orient).Normalize()
+
+	if v.glide >= 0 {
+		v.glide += f
+		if v.glide >= vectorBallGlide {
+			v.formation = (v.formation + 1) % len(vectorBallFormations)
+			v.glide, v.hold = -1, 0
+		}
+	} else {
+		v.hold += f
+		if v.hold >= vectorBallHold {
+			v.glide = 0
+		}
+	}
+	v.place()
+}
+
+// Rewind unwinds the turn and glides back to the previous formations
+func (v *VectorBalls) Rewind(dt float64) {
+	f := frames(dt) * speed(v.Speed)
+	spin := v.ctx.Param("balls.spin", 1) * f
+	v.orient = EulerQuat(-0.011*spin, -0.017*spin, -0.006*spin).Mul(v.orient).Normalize()
+
+	if v.glide >= 0 {
+		v.glide -= f
+		if v.glide < 0 {
+			v.glide, v.hold = -1, vectorBallHold
+		}
+	} else {
+		v.hold -= f
+		if v.hold < 0 {
+			n := len(vectorBallFormations)
+			v.formation = (v.formation + n - 1) % n
+			v.glide = vectorBallGlide + v.hold
+			v.hold = 0
+		}
+	}
+	v.place()
+}
+
+// place sets the balls between the formation and the next one, as far as
+// the glide has gone
+func (v *VectorBalls) place() {
+	from := &vectorBallFormations[v.formation]
+	to := &vectorBallFormations[(v.formation+1)%len(vectorBallFormations)]
+	t := 0.0
+	if v.glide >= 0 {
+		t = smooth(v.glide / vectorBallGlide)
+	}
+	for i := range v.balls {
+		for k := range 3 {
+			v.balls[i][k] = from[i][k]*(1-t) + to[i][k]*t
+		}
+	}
+}
+
+// Sync starts the glide to the next formation on "formation" syncs
+func (v *VectorBalls) Sync(name string) {
+	if name == "formation" && v.glide < 0 {
+		v.glide = 0
+	}
+}
+
+// Film implements Filmed
+func (v *VectorBalls) Film(cam Camera, ok bool) {
+	v.camera = cam
+}
+
+// Draw renders the balls back to front in a single draw call
+func (v *VectorBalls) Draw(screen *ebiten.Image) {
+	l := v.layout
+	cx, cy := float64(l.Width)/2, float64(l.Height)/2
+	focal := vectorBallFocal * l.ScaleY
+	span := vectorBallSpan * l.ScaleY
+	view := v.camera.view(focal)
+
+	m := v.orient.Matrix()
+	var points [vectorBallCount][3]float64
+	v.order = v.order[:0]
+	for i, b := range v.balls {
+		points[i] = view.point(rotate(&m, [3]float64{b[0] * span, b[1] * span, b[2] * span}))
+		// Balls behind the eye are left out
+		if focal+points[i][2] > 1 {
+			v.order = append(v.order, i)
+		}
+	}
+	sort.Slice(v.order, func(i, j int) bool {
+		return points[v.order[i]][2] > points[v.order[j]][2]
+	})
+
+	src := v.sprite.Bounds()
+	v.vertices = v.vertices[:0]
+	v.indices = v.indices[:0]
+	for _, i := range v.order {
+		p := points[i]
+		s := view.zoom * focal / (focal + p[2])
+		x, y := cx+p[0]*s, cy+p[1]*s
+		half := vectorBallSize * l.ScaleY * s / 2
+
+		// Farther balls are darker
+		light := float32(math.Min(math.Max(0.75-0.3*p[2]/span, 0.35), 1))
+		base := uint16(len(v.vertices))
+		for _, c := range [4][2]float64{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+			v.vertices = append(v.vertices, ebiten.Vertex{
+				DstX:   float32(x + c[0]*half),
+				DstY:   float32(y + c[1]*half),
+				SrcX:   float32(src.Min.X) + float32(c[0]+1)/2*float32(src.Dx()),
+				SrcY:   float32(src.Min.Y) + float32(c[1]+1)/2*float32(src.Dy()),
+				ColorR: light,
+				ColorG: light,
+				ColorB: light,
+				ColorA: 1,
+			})
+		}
+		v.indices = append(v.indices, base, base+1, base+2, base, base+2, base+3)
+	}
+	screen.DrawTriangles(v.vertices, v.indices, v.sprite, &ebiten.DrawTrianglesOptions{Filter: ebiten.FilterLinear})
+}
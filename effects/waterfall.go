@@ -0,0 +1,173 @@
+package effects
+
+import (
+	"image/color"
+	"math"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Palette ranges of the waterfall: static rocks, then ramps of 16 colors
+// cycled to make the water flow and the logo outline glow
+const (
+	waterRock  = 1    // 15 rock shades
+	waterFall  = 16   // Falling water, cycled down
+	waterGlow  = 32   // Logo outline, cycled around
+	waterPool  = 48   // Pool ripples, cycled outwards
+	waterRamp  = 16   // Colors per cycled ramp
+	waterCliff = 0.4  // Top of the cliff, as a fraction of the height
+	waterLevel = 0.82 // Top of the pool, as a fraction of the height
+)
+
+// Waterfall is a pixel art scene animated by palette cycling alone: the
+// water and the glowing outline of the logo are drawn once in an indexed
+// surface, and cycling their palette ranges makes the water run and the
+// outline glow. Index 0 is transparent, so the scene sits over the
+// layers behind, such as the rasters.
+type Waterfall struct {
+	Speed float64 // Cycling speed multiplier, 1 when zero
+
+	ctx     *Context
+	layout  Layout
+	surface *IndexedSurface
+	pixel   float64 // Screen pixels per surface pixel
+	fall    float64 // Frames since the last step of each ramp
+	glow    float64
+	pool    float64
+}
+
+// Init draws the scene into a surface at half the resolution, or the
+// full low resolution
+func (w *Waterfall) Init(ctx *Context) error {
+	w.ctx = ctx
+	w.layout = ctx.Layout()
+	w.pixel = math.Max(1, math.Round(2*w.layout.ScaleY))
+	sw := int(math.Ceil(float64(w.layout.Width) / w.pixel))
+	sh := int(math.Ceil(float64(w.layout.Height) / w.pixel))
+
+	if w.surface != nil {
+		w.surface.Deallocate()
+	}
+	s, err := NewIndexedSurface(sw, sh)
+	if err != nil {
+		return err
+	}
+	w.surface = s
+	w.paint()
+	return w.outlineLogo()
+}
+
+// paint sets the palette and draws the cliff, the fall and the pool
+func (w *Waterfall) paint() {
+	s := w.surface
+	for i := range 15 {
+		v := 0.25 + 0.5*float64(i)/14
+		s.Palette[waterRock+i] = color.RGBA{uint8(120 * v * 1.1), uint8(100 * v), uint8(90 * v), 255}
+	}
+	ramp := func(first int, dark, light color.RGBA, sharpness float64) {
+		for i := range waterRamp {
+			t := math.Pow(0.5+0.5*math.Cos(2*math.Pi*float64(i)/waterRamp), sharpness)
+			s.Palette[first+i] = lerpRGBA(dark, light, t)
+		}
+	}
+	ramp(waterFall, color.RGBA{20, 60, 160, 255}, color.RGBA{220, 240, 255, 255}, 3)
+	ramp(waterGlow, color.RGBA{60, 0, 90, 255}, color.RGBA{255, 240, 160, 255}, 2)
+	ramp(waterPool, color.RGBA{10, 40, 110, 255}, color.RGBA{120, 180, 240, 255}, 4)
+
+	rng := rand.New(rand.NewSource(7))
+	bounds := s.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	streaks := make([]int, sw)
+	for x := range streaks {
+		streaks[x] = rng.Intn(waterRamp)
+	}
+	cliff, pool := int(float64(sh)*waterCliff), int(float64(sh)*waterLevel)
+	for y := range sh {
+		// The fall widens as it drops
+		half := float64(sw) * (0.08 + 0.04*float64(y-cliff)/float64(sh))
+		for x := range sw {
+			dx := math.Abs(float64(x) - float64(sw)/2)
+			switch {
+			case y < cliff:
+				s.Set(x, y, 0)
+			case y >= pool:
+				// Ripples spreading from the foot of the fall
+				ring := int(dx/3+float64(y-pool)*1.5) + streaks[x]/4
+				s.Set(x, y, uint8(waterPool+ring%waterRamp))
+			case dx < half:
+				s.Set(x, y, uint8(waterFall+(y+streaks[x])%waterRamp))
+			default:
+				shade := int(rockNoise(rng)*7) + (y-cliff)*7/max(pool-cliff, 1)
+				s.Set(x, y, uint8(waterRock+min(max(14-shade, 0), 14)))
+			}
+		}
+	}
+}
+
+// rockNoise returns a random rock texture level, 0 to 1
+func rockNoise(rng *rand.Rand) float64 {
+	return (rng.Float64() + rng.Float64()) / 2
+}
+
+// outlineLogo draws the outline of the logo above the cliff, in the glow
+// range, the indices running around it
+func (w *Waterfall) outlineLogo() error {
+	logo, err := DecodeImage(w.ctx.Assets, "assets/logo.png")
+	if err != nil {
+		return err
+	}
+	s := w.surface
+	sw, sh := s.Bounds().Dx(), s.Bounds().Dy()
+	lb := logo.Bounds()
+	// The logo spans 60% of the width, in the sky above the cliff
+	scale := float64(lb.Dx()) / (float64(sw) * 0.6)
+	lw, lh := int(float64(lb.Dx())/scale), int(float64(lb.Dy())/scale)
+	ox, oy := (sw-lw)/2, max((int(float64(sh)*waterCliff)-lh)/2, 0)
+
+	solid := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= lw || y >= lh {
+			return false
+		}
+		_, _, _, a := logo.At(lb.Min.X+int(float64(x)*scale), lb.Min.Y+int(float64(y)*scale)).RGBA()
+		return a > 0x8000
+	}
+	for y := -1; y <= lh; y++ {
+		for x := -1; x <= lw; x++ {
+			if solid(x, y) {
+				continue
+			}
+			if solid(x-1, y) || solid(x+1, y) || solid(x, y-1) || solid(x, y+1) {
+				s.Set(ox+x, oy+y, uint8(waterGlow+((x+y)/2%waterRamp+waterRamp)%waterRamp))
+			}
+		}
+	}
+	return nil
+}
+
+// Update cycles the ramps: the fall fastest, the pool slowest
+func (w *Waterfall) Update(dt float64) {
+	f := frames(dt) * speed(w.Speed) * w.ctx.Param("waterfall.cycle", 1)
+	step := func(elapsed *float64, every float64, first int) {
+		*elapsed += f
+		if n := int(*elapsed / every); n != 0 {
+			*elapsed -= float64(n) * every
+			w.surface.Cycle(first, first+waterRamp-1, n)
+		}
+	}
+	step(&w.fall, 2, waterFall)
+	step(&w.glow, 3, waterGlow)
+	step(&w.pool, 5, waterPool)
+}
+
+// Rewind cycles the ramps the other way, the water climbing back
+func (w *Waterfall) Rewind(dt float64) {
+	w.Update(-dt)
+}
+
+// Draw draws the surface scaled up to the screen
+func (w *Waterfall) Draw(screen *ebiten.Image) {
+	var geoM ebiten.GeoM
+	geoM.Scale(w.pixel, w.pixel)
+	w.surface.Draw(screen, geoM)
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"slices"
+	"time"
+
+	"bilizir-demo/effects"
+	"bilizir-demo/timeline"
+)
+
+// Generated scenes last between these lengths, and cross-fade into each
+// other over a fade between these
+const (
+	fillerMinScene = 10 * time.Second
+	fillerMaxScene = 20 * time.Second
+	fillerMinFade  = time.Second
+	fillerMaxFade  = 3 * time.Second
+)
+
+// The parts generated scenes are composed of, back to front: one
+// background, up to two parts over it and up to two on top, by their
+// names in the define statements of the demo script
+var (
+	fillerBackgrounds = []string{"copper", "stars", "tunnel", "rasters", "raymarch"}
+	fillerMiddles     = []string{"cubes", "objects", "balls", "fire", "waterfall", "meter", "scope", "dissolve", "reveal"}
+	fillerTops        = []string{"logo", "scroller"}
+)
+
+// fillerStyles are the visual styles generated scenes pick from, none
+// being the most common
+var fillerStyles = []string{"", "", "", effects.StyleToon, effects.ScrollerSine, effects.ScrollerRoll, effects.ScrollerCircle, effects.ScrollerBounce}
+
+// fillerReveals are the transitions into generated scenes, a plain
+// cross-fade being the most common
+var fillerReveals = []string{"", "", effects.MaskIris, effects.MaskSweep, effects.MaskNoise, revealPiP}
+
+// fillerWaves are the parameters shaping the wave tables of the parts,
+// and the range generated scenes glide them within
+var fillerWaves = []struct {
+	name   string
+	lo, hi float64
+}{
+	{"copper.speed1", -8, 8},
+	{"copper.speed2", -8, 8},
+	{"copper.spread1", 2, 20},
+	{"copper.spread2", 2, 20},
+	{"copper.cycle", -3, 3},
+	{"scroll.wave_speed", 0.02, 0.3},
+	{"scroll.bounce_height", 20, 120},
+	{"scroll.bounce_freq", 0.2, 1.5},
+	{"scroll.bounce_spread", 0.2, 1.5},
+	{"stars.speed", 0.5, 3},
+	{"tunnel.speed", 0.5, 3},
+	{"mirror.sway", 0, 0.15},
+	{"mirror.spin", -1, 1},
+}
+
+// fillerLook is what a generated scene sets as it comes in: a copper
+// palette and the wave parameters
+type fillerLook struct {
+	palette effects.CopperPalette
+	waves   map[string]float64
+}
+
+// ScreenFiller is the endless mode: once the demo script has played
+// through, it composes new scenes at random from the parts, copper
+// palettes and wave tables, one after the other with a transition, for
+// as long as the demo runs. Its scenes are on their own timeline, the
+// demo running time since it took over, while the music carries on.
+type ScreenFiller struct {
+	rng     *rand.Rand
+	running bool
+	start   time.Duration // Running time the generated timeline starts at
+	last    time.Duration // Scene time at the last update, to see the script end
+	script  timeline.Script
+	looks   map[string]fillerLook // Looks of the scenes not come in yet
+	count   int                   // Scenes generated, to name them
+}
+
+// NewScreenFiller creates the endless mode, taking over once the demo
+// script has played
+func NewScreenFiller() *ScreenFiller {
+	return &ScreenFiller{
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		looks: map[string]fillerLook{},
+		last:  -1,
+	}
+}
+
+// Running reports whether the generated scenes are showing
+func (f *ScreenFiller) Running() bool {
+	return f != nil && f.running
+}
+
+// stopEndless goes back to the demo script, as after a seek; the endless
+// mode takes over again the next time the script ends
+func (g *Game) stopEndless() {
+	f := g.filler
+	if f == nil {
+		return
+	}
+	for _, sc := range f.script.Scenes {
+		delete(g.scenes, sc.Name)
+	}
+	f.running = false
+	f.script.Scenes = nil
+	f.last = -1
+	clear(f.looks)
+}
+
+// toggleEndless switches the endless mode on or off. Switched on, it
+// takes over the next time the demo script ends.
+func (g *Game) toggleEndless() {
+	if g.filler == nil {
+		g.filler = NewScreenFiller()
+		log.Printf("Endless mode on")
+		return
+	}
+	g.stopEndless()
+	g.filler = nil
+	log.Printf("Endless mode off")
+}
+
+// updateEndless takes over from the demo script when it ends, then keeps
+// scenes generated ahead of the running time and brings in their looks
+func (g *Game) updateEndless() {
+	f := g.filler
+	if f == nil {
+		return
+	}
+	if !f.running {
+		now, length := g.sceneTime(), g.script.Length()
+		ended := f.last >= 0 && f.last < length && (now >= length || now < f.last-length/2)
+		f.last = now
+		if !ended && length > 0 {
+			return
+		}
+		f.running = true
+		f.start = g.clock.elapsed
+	}
+	t := f.time(g.clock.elapsed)
+
+	// Drop the scenes played out
+	for len(f.script.Scenes) > 0 && f.script.Scenes[0].End <= t {
+		delete(g.scenes, f.script.Scenes[0].Name)
+		f.script.Scenes = f.script.Scenes[1:]
+	}
+	// Keep the next scene generated before the one playing fades out
+	for len(f.script.Scenes) < 2 {
+		g.addFillerScene()
+	}
+	for _, cue := range f.script.At(t) {
+		if look, ok := f.looks[cue.Scene.Name]; ok {
+			delete(f.looks, cue.Scene.Name)
+			g.applyFillerLook(cue.Scene, look)
+		}
+	}
+}
+
+// time returns the position on the generated timeline at a running time
+func (f *ScreenFiller) time(elapsed time.Duration) time.Duration {
+	return elapsed - f.start
+}
+
+// At returns the generated scenes playing at a running time
+func (f *ScreenFiller) At(elapsed time.Duration) []timeline.Cue {
+	return f.script.At(f.time(elapsed))
+}
+
+// addFillerScene composes the next scene, starting as the last one fades
+// out, and registers its parts
+func (g *Game) addFillerScene() {
+	f := g.filler
+	r := f.rng
+	span := func(lo, hi time.Duration) time.Duration {
+		return lo + time.Duration(r.Int63n(int64(hi-lo)+1))
+	}
+
+	sc := timeline.Scene{
+		Name:   fmt.Sprintf("endless%d", f.count),
+		Fade:   span(fillerMinFade, fillerMaxFade),
+		Style:  fillerStyles[r.Intn(len(fillerStyles))],
+		Reveal: fillerReveals[r.Intn(len(fillerReveals))],
+	}
+	f.count++
+	if n := len(f.script.Scenes); n > 0 {
+		prev := f.script.Scenes[n-1]
+		sc.Start = prev.End - sc.Fade
+	}
+	sc.End = sc.Start + span(fillerMinScene, fillerMaxScene)
+	switch r.Intn(8) {
+	case 0:
+		sc.Mirror = 1
+	case 1:
+		sc.Mirror = 3 + r.Intn(6)
+	}
+	// Picture-in-picture previews grow over the scene before, which has
+	// to play through the whole fade
+	if sc.Reveal == revealPiP && len(f.script.Scenes) == 0 {
+		sc.Reveal = ""
+	}
+
+	names := []string{fillerBackgrounds[r.Intn(len(fillerBackgrounds))]}
+	names = append(names, pick(r, fillerMiddles, r.Intn(3))...)
+	names = append(names, pick(r, fillerTops, r.Intn(3))...)
+	named := g.partNames()
+	parts := make([]effects.Effect, len(names))
+	for i, name := range names {
+		parts[i] = named[name]
+	}
+	g.scenes[sc.Name] = parts
+
+	look := fillerLook{
+		palette: effects.CopperPalette{
+			Bars:   6 + r.Intn(10),
+			Hue:    r.Float64() * 360,
+			Step:   (r.Float64()*2 - 1) * 60,
+			Levels: int(g.paletteMode.levels()),
+		},
+		waves: map[string]float64{},
+	}
+	for _, w := range fillerWaves {
+		look.waves[w.name] = w.lo + r.Float64()*(w.hi-w.lo)
+	}
+	f.looks[sc.Name] = look
+	f.script.Scenes = append(f.script.Scenes, sc)
+}
+
+// pick returns n different names of list at random, in list order
+func pick(r *rand.Rand, list []string, n int) []string {
+	var names []string
+	for _, i := range r.Perm(len(list))[:min(n, len(list))] {
+		names = append(names, list[i])
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return slices.Index(list, a) - slices.Index(list, b)
+	})
+	return names
+}
+
+// applyFillerLook brings in the look of a generated scene as it starts:
+// the wave parameters glide over its fade, and the copper bars take its
+// palette unless the scene it fades from shows them
+func (g *Game) applyFillerLook(sc *timeline.Scene, look fillerLook) {
+	for name, v := range look.waves {
+		g.params.TweenTo(name, v, sc.Fade.Seconds())
+	}
+	for _, cue := range g.filler.script.At(g.filler.time(g.clock.elapsed)) {
+		if cue.Scene.Name != sc.Name && slices.Contains(g.scenes[cue.Scene.Name], effects.Effect(g.copper)) {
+			return
+		}
+	}
+	g.copper.SetGeneratedPalette(look.palette)
+}
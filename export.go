@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"bilizir-demo/effects"
+	"bilizir-demo/record"
+)
+
+// exportSink is what an offline export writes to: the frames captured,
+// in order, and the tune rendered alongside
+type exportSink interface {
+	// begin opens the output once the length of the export is known
+	begin(e *videoExport, g *Game) error
+	// audio takes the samples of the tune for a frame, 16-bit stereo
+	audio(p []byte) error
+	// frame takes the nth frame captured
+	frame(n int, img *image.RGBA) error
+	// finish completes the output after the last frame, or the last one
+	// captured when the export is cut short
+	finish(e *videoExport) error
+}
+
+// videoExport renders the demo offline: it steps the demo a frame at a
+// time at a fixed frame rate, whatever the speed of the machine, and hands
+// each frame and the tune, rendered alongside, to its output. The demo
+// clock follows the frame count instead of the audio device, which is
+// left paused, and the keyboard is ignored. An export starting later in
+// the demo steps through the frames before it without drawing them, so
+// the parts are in the state they would be in live.
+type videoExport struct {
+	dir     string
+	fps     int
+	seconds float64 // Length asked for, 0 for the demo script or the tune
+	from    string  // Seconds into the demo or scene the export starts at, empty for the start
+	width   int     // Width the frames are scaled down to, 0 for the screen's
+	out     exportSink
+	only    map[int]bool // Frames captured, nil for all of them
+
+	skip    int   // Frames stepped before the export starts
+	frames  int   // Frames to render after them
+	frame   int   // Frames stepped
+	drawn   int   // Frames captured, or skipped
+	ticks   int64 // Logic ticks run
+	samples int64 // Sample frames of the tune rendered
+	chunk   []byte
+	small   *ebiten.Image
+	err     error // First error of the output
+	start   time.Time
+	done    bool
+}
+
+// startExport switches the game to rendering the demo offline into the
+// folder of the export. Frames are rendered as fast as the machine goes,
+// so vsync is off and there is one update per frame.
+func (g *Game) startExport(e *videoExport) error {
+	if err := os.MkdirAll(e.dir, 0o755); err != nil {
+		return err
+	}
+	g.export = e
+	ebiten.SetVsyncEnabled(false)
+	ebiten.SetTPS(ebiten.SyncWithFPS)
+	return nil
+}
+
+// begin starts the export once the demo is set up, from the start of the
+// demo at the default volume, leaving out the saved settings
+func (e *videoExport) begin(g *Game) error {
+	from, err := g.exportStart(e.from)
+	if err != nil {
+		return err
+	}
+	length := time.Duration(e.seconds * float64(time.Second))
+	if length == 0 {
+		length = g.script.Length() - from
+	}
+	if length <= 0 {
+		length = g.musicLength() - from
+	}
+	if length <= 0 {
+		return fmt.Errorf("the demo has no script and the tune no length: give the length to record with -record-seconds")
+	}
+	e.skip = int(from * time.Duration(e.fps) / time.Second)
+	e.frames = int(length * time.Duration(e.fps) / time.Second)
+
+	if g.audioPlayer != nil {
+		g.audioPlayer.Pause()
+	}
+	if g.music != nil {
+		g.music.SetVolume(defaultSettings.Volume)
+		if g.launch.volume != nil {
+			g.music.SetVolume(*g.launch.volume)
+		}
+		if g.launch.mute {
+			g.music.SetVolume(0)
+		}
+		g.music.SeekTime(0)
+	}
+	g.clock = demoClock{}
+
+	if err := e.out.begin(e, g); err != nil {
+		return err
+	}
+	e.start = time.Now()
+	log.Printf("Recording %d frames at %d fps into %s", e.frames, e.fps, e.dir)
+	return nil
+}
+
+// exportStart parses where an export starts: a number of seconds into the
+// demo, or the name of a scene of the demo script
+func (g *Game) exportStart(from string) (time.Duration, error) {
+	if from == "" {
+		return 0, nil
+	}
+	for _, sc := range g.script.Scenes {
+		if strings.EqualFold(sc.Name, from) {
+			return sc.Start, nil
+		}
+	}
+	secs, err := strconv.ParseFloat(from, 64)
+	if err != nil || secs < 0 {
+		return 0, fmt.Errorf("start %q is neither a number of seconds nor a scene of the demo script", from)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// update steps the demo to the next frame once the last one is captured,
+// and returns ebiten.Termination once every frame is written. The frames
+// left out, before the start or not asked for, are stepped a second's
+// worth at a time.
+func (e *videoExport) update(g *Game) error {
+	if e.err != nil {
+		return e.err
+	}
+	if e.drawn < e.frame {
+		return nil
+	}
+	if e.frame == e.skip+e.frames {
+		if err := e.finish(); err != nil {
+			return err
+		}
+		return ebiten.Termination
+	}
+
+	for {
+		if err := e.step(g); err != nil {
+			return err
+		}
+		if e.frame > e.skip && (e.only == nil || e.only[e.frame-1-e.skip]) {
+			break
+		}
+		e.drawn = e.frame
+		if e.frame == e.skip+e.frames || e.frame%e.fps == 0 {
+			break
+		}
+	}
+	if n := e.frame - e.skip; n > 0 && n%(10*e.fps) == 0 {
+		log.Printf("Recorded %d of %d frames", n, e.frames)
+	}
+	return nil
+}
+
+// step renders the audio of the next frame and steps the demo to it
+func (e *videoExport) step(g *Game) error {
+	if err := e.writeAudio(g); err != nil {
+		return err
+	}
+	t := time.Duration(e.frame) * time.Second / time.Duration(e.fps)
+	g.clock.elapsed = t
+	g.clock.scene = t
+	if length := g.musicLength(); length > 0 {
+		g.clock.scene = wrapDuration(t, length)
+	}
+	g.params.Update(1 / float64(e.fps))
+
+	// The parts tick at the rate they were tuned for, the first frame
+	// showing the first tick like the live demo
+	n := int64(t*effects.FrameRate/time.Second) + 1 - e.ticks
+	if g.pal.enabled {
+		n = int64(g.ticksDue())
+	}
+	for ; n > 0; n-- {
+		g.tick()
+		e.ticks++
+	}
+	g.warmUpScenes()
+
+	e.frame++
+	return nil
+}
+
+// writeAudio renders the tune through the end of the frame being stepped,
+// silence without a tune
+func (e *videoExport) writeAudio(g *Game) error {
+	due := int64(e.frame+1) * sampleRate / int64(e.fps)
+	size := int(due-e.samples) * 4
+	if cap(e.chunk) < size {
+		e.chunk = make([]byte, size)
+	}
+	chunk := e.chunk[:size]
+	clear(chunk)
+	if g.music != nil {
+		if _, err := io.ReadFull(g.music, chunk); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+	}
+	g.tap.write16(chunk)
+	e.samples = due
+	if e.frame < e.skip {
+		return nil
+	}
+	return e.out.audio(chunk)
+}
+
+// capture hands the frame on screen to the output, once per step, until
+// the export is finished
+func (e *videoExport) capture(screen *ebiten.Image) {
+	if e.drawn == e.frame || e.done || e.err != nil {
+		return
+	}
+	w, h := screen.Bounds().Dx(), screen.Bounds().Dy()
+	if e.width > 0 && e.width < w {
+		w, h = e.width, max(h*e.width/w, 1)
+	}
+	e.err = e.out.frame(e.frame-1-e.skip, readScaled(screen, &e.small, w, h))
+	e.drawn = e.frame
+}
+
+// finish completes the output, once
+func (e *videoExport) finish() error {
+	if e.done || e.start.IsZero() {
+		return nil
+	}
+	e.done = true
+	if err := e.out.finish(e); err != nil {
+		return err
+	}
+	return e.err
+}
+
+// exportFrame is a rendered frame waiting to be written, and its number
+type exportFrame struct {
+	n   int
+	img *image.RGBA
+}
+
+// frameExport writes the frames of an export as numbered PNGs and the tune
+// as a WAV of the same length, for the -record flag, to mux into a video
+// with ffmpeg
+type frameExport struct {
+	dir     string
+	wavFile *os.File
+	wav     *record.WAV
+
+	pngs   chan exportFrame
+	writes sync.WaitGroup
+	failed chan error // First error of the PNG writers
+}
+
+// begin creates the WAV and starts a PNG writer per CPU core
+func (x *frameExport) begin(e *videoExport, g *Game) error {
+	x.dir = e.dir
+	f, err := os.Create(filepath.Join(x.dir, "audio.wav"))
+	if err != nil {
+		return err
+	}
+	if x.wav, err = record.NewWAV(f, sampleRate, 2); err != nil {
+		f.Close()
+		return err
+	}
+	x.wavFile = f
+
+	x.pngs = make(chan exportFrame, runtime.NumCPU())
+	x.failed = make(chan error, 1)
+	for range runtime.NumCPU() {
+		x.writes.Add(1)
+		go x.writePNGs()
+	}
+	return nil
+}
+
+// audio adds the samples to the WAV
+func (x *frameExport) audio(p []byte) error {
+	_, err := x.wav.Write(p)
+	return err
+}
+
+// frame queues a frame to be written, or reports the first error of the
+// writers
+func (x *frameExport) frame(n int, img *image.RGBA) error {
+	select {
+	case err := <-x.failed:
+		return err
+	default:
+	}
+	x.pngs <- exportFrame{n: n, img: img}
+	return nil
+}
+
+// writePNGs writes the queued frames until the queue is closed
+func (x *frameExport) writePNGs() {
+	defer x.writes.Done()
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	for f := range x.pngs {
+		if err := writePNG(&enc, filepath.Join(x.dir, fmt.Sprintf("frame%06d.png", f.n)), f.img); err != nil {
+			select {
+			case x.failed <- err:
+			default:
+			}
+		}
+	}
+}
+
+// writePNG encodes an image to a file
+func writePNG(enc *png.Encoder, path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// finish waits for the frames to be written and completes the WAV
+func (x *frameExport) finish(e *videoExport) error {
+	close(x.pngs)
+	x.writes.Wait()
+	select {
+	case err := <-x.failed:
+		return err
+	default:
+	}
+	if err := x.wav.Close(); err != nil {
+		return err
+	}
+	if err := x.wavFile.Close(); err != nil {
+		return err
+	}
+	log.Printf("Recorded %d frames in %s; mux them with:", e.drawn-e.skip, time.Since(e.start).Round(time.Second))
+	log.Printf("ffmpeg -framerate %d -i %s -i %s -c:v libx264 -pix_fmt yuv420p -c:a aac -shortest demo.mp4",
+		e.fps, filepath.Join(x.dir, "frame%06d.png"), filepath.Join(x.dir, "audio.wav"))
+	return nil
+}
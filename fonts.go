@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"bilizir-demo/effects"
+)
+
+// loadFonts loads the font descriptors at paths, in order, as the fonts
+// the scrolltext switches to with ^F2, ^F3 and on
+func (g *Game) loadFonts(paths []string) error {
+	for _, p := range paths {
+		f, err := effects.LoadBitmapFont(os.DirFS(filepath.Dir(p)), filepath.Base(p))
+		if err != nil {
+			return err
+		}
+		g.scroller.Fonts = append(g.scroller.Fonts, f)
+	}
+	return nil
+}
+
+// loadFallbackFonts loads the TrueType or OpenType fonts at paths, in
+// order, as the fallback chain drawing the characters the bitmap fonts
+// lack, before the built-in Go Bold
+func (g *Game) loadFallbackFonts(paths []string) error {
+	for _, p := range paths {
+		f, err := effects.LoadFallbackFont(os.DirFS(filepath.Dir(p)), filepath.Base(p))
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		g.fallbackFonts = append(g.fallbackFonts, f)
+	}
+	return nil
+}
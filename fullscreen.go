@@ -0,0 +1,70 @@
+package main
+
+import (
+	"image"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// cursorHideDelay is how long the mouse cursor stays up in fullscreen
+// after it last moved
+const cursorHideDelay = 2 * time.Second
+
+// fullscreenState is the window the demo goes back to when leaving
+// fullscreen, and the mouse cursor hidden over the fullscreen demo.
+// The frame keeps its aspect ratio in fullscreen: Ebiten letterboxes the
+// fixed layout, and retro mode centers its integer upscale.
+type fullscreenState struct {
+	windowSize image.Point // Window size before going fullscreen, zero when unknown
+	windowPos  image.Point
+	cursor     image.Point // Cursor position at the last update
+	cursorMove time.Time   // When the cursor last moved
+}
+
+// setFullscreen switches fullscreen on or off, restoring the window size
+// and position it had before when coming back
+func (g *Game) setFullscreen(on bool) {
+	if on == ebiten.IsFullscreen() {
+		return
+	}
+	f := &g.fullscreen
+	if on {
+		w, h := ebiten.WindowSize()
+		x, y := ebiten.WindowPosition()
+		f.windowSize, f.windowPos = image.Pt(w, h), image.Pt(x, y)
+		ebiten.SetFullscreen(true)
+		return
+	}
+	ebiten.SetFullscreen(false)
+	if f.windowSize.X > 0 && f.windowSize.Y > 0 {
+		ebiten.SetWindowSize(f.windowSize.X, f.windowSize.Y)
+		ebiten.SetWindowPosition(f.windowPos.X, f.windowPos.Y)
+	}
+}
+
+// updateFullscreen toggles fullscreen with F11 or Alt+Enter, and hides
+// the cursor over the fullscreen demo once the mouse rests, unless a
+// tool using the mouse is open
+func (g *Game) updateFullscreen() {
+	alt := ebiten.IsKeyPressed(ebiten.KeyAlt)
+	if inpututil.IsKeyJustPressed(ebiten.KeyF11) || alt && inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		g.setFullscreen(!ebiten.IsFullscreen())
+	}
+
+	f := &g.fullscreen
+	x, y := ebiten.CursorPosition()
+	if cursor := image.Pt(x, y); cursor != f.cursor {
+		f.cursor, f.cursorMove = cursor, time.Now()
+	}
+	mouseTools := g.editor.open || g.ab.mode == ABWipe
+	hide := ebiten.IsFullscreen() && !mouseTools && time.Since(f.cursorMove) > cursorHideDelay
+	mode := ebiten.CursorModeVisible
+	if hide {
+		mode = ebiten.CursorModeHidden
+	}
+	if ebiten.CursorMode() != mode {
+		ebiten.SetCursorMode(mode)
+	}
+}
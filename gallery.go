@@ -0,0 +1,91 @@
+package main
+
+import (
+	"log"
+
+	"bilizir-demo/effects"
+	_ "bilizir-demo/screens"
+	"bilizir-demo/sysfont"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Gallery cycles through all contributed screens, showing each one for
+// the duration its manifest prefers
+type Gallery struct {
+	ctx     *effects.Context
+	screens []effects.Screen
+	index   int
+	current effects.Effect
+	elapsed float64
+}
+
+// NewGallery creates a gallery drawing at the size given by ctx
+func NewGallery(ctx *effects.Context) *Gallery {
+	gl := &Gallery{
+		ctx:     ctx,
+		screens: effects.Screens(),
+		index:   -1,
+	}
+	gl.next()
+	return gl
+}
+
+// next starts the following screen, skipping those that fail to set up
+func (gl *Gallery) next() {
+	gl.current = nil
+	gl.elapsed = 0
+
+	for range gl.screens {
+		gl.index = (gl.index + 1) % len(gl.screens)
+		s := gl.screens[gl.index]
+
+		if err := s.Manifest.CheckAssets(gl.ctx.Assets); err != nil {
+			log.Printf("Skipping screen: %v", err)
+			continue
+		}
+		e := s.New()
+		if err := e.Init(gl.ctx); err != nil {
+			log.Printf("Skipping screen %q: %v", s.Manifest.Name, err)
+			continue
+		}
+		gl.current = e
+		return
+	}
+}
+
+// Update advances the current screen and moves on when its time is up
+func (gl *Gallery) Update(dt float64) {
+	if gl.current == nil {
+		return
+	}
+
+	gl.current.Update(dt)
+	gl.elapsed += dt
+	if gl.elapsed >= gl.screens[gl.index].Manifest.Duration.Seconds() {
+		gl.next()
+	}
+}
+
+// Draw renders the current screen with its credits
+func (gl *Gallery) Draw(dst *ebiten.Image) {
+	if gl.current == nil {
+		sysfont.Print(dst, "No contributed screens", 8, 8, sysfont.Style{})
+		return
+	}
+
+	gl.current.Draw(dst)
+
+	m := gl.screens[gl.index].Manifest
+	sysfont.Printf(dst, 8, dst.Bounds().Dy()-16, sysfont.Style{}, "%s by %s", m.Name, m.Author)
+}
+
+// toggleGallery switches between the intro and the screen gallery
+func (g *Game) toggleGallery() {
+	if g.gallery != nil {
+		g.gallery = nil
+		return
+	}
+
+	g.gallery = NewGallery(g.effectContext())
+}
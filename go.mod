@@ -5,6 +5,7 @@ go 1.24.4
 require (
 	github.com/hajimehoshi/ebiten/v2 v2.8.8
 	github.com/olivierh59500/ym-player v0.0.0-20250607015657-bb5818debd02
+	golang.org/x/image v0.25.0
 )
 
 require (
@@ -13,6 +14,7 @@ require (
 	github.com/ebitengine/oto/v3 v3.3.3 // indirect
 	github.com/ebitengine/purego v0.8.0 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
-	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sync v0.12.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
 )
@@ -0,0 +1,70 @@
+package main
+
+// Command is a reversible edit made from one of the dev tools
+type Command interface {
+	Do()
+	Undo()
+	Describe() string
+}
+
+// maxHistory bounds the number of undoable commands kept
+const maxHistory = 256
+
+// History records commands so edits can be undone and redone
+type History struct {
+	undo []Command
+	redo []Command
+}
+
+// Run executes a command and records it, clearing the redo stack
+func (h *History) Run(c Command) {
+	c.Do()
+	h.undo = append(h.undo, c)
+	if len(h.undo) > maxHistory {
+		h.undo = h.undo[1:]
+	}
+	h.redo = h.redo[:0]
+}
+
+// Undo reverts the last command, returning false if there is none
+func (h *History) Undo() (Command, bool) {
+	if len(h.undo) == 0 {
+		return nil, false
+	}
+	c := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+	c.Undo()
+	h.redo = append(h.redo, c)
+	return c, true
+}
+
+// Redo re-applies the last undone command, returning false if there is none
+func (h *History) Redo() (Command, bool) {
+	if len(h.redo) == 0 {
+		return nil, false
+	}
+	c := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+	c.Do()
+	h.undo = append(h.undo, c)
+	return c, true
+}
+
+// setParamCommand changes one parameter value
+type setParamCommand struct {
+	params   *Params
+	name     string
+	from, to float64
+}
+
+func (c *setParamCommand) Do() {
+	_ = c.params.Set(c.name, c.to)
+}
+
+func (c *setParamCommand) Undo() {
+	_ = c.params.Set(c.name, c.from)
+}
+
+func (c *setParamCommand) Describe() string {
+	return c.name
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// idleFrame keeps the last frame on screen while the demo is paused and
+// nothing drawn changes, instead of composing the same frame again. The
+// screen is not cleared between frames, so skipping Draw leaves it as it
+// was, and a paused demo, such as a kiosk left on pause, costs next to no
+// GPU or CPU time.
+type idleFrame struct {
+	shown  bool        // The screen holds the static frame
+	size   image.Point // Size of the screen it was drawn at
+	input  bool        // Input came in during the last update
+	cursor image.Point
+}
+
+// watchInput notes whether keys, mouse buttons, the wheel or the cursor
+// moved during this update, which may change what is drawn
+func (f *idleFrame) watchInput() {
+	x, y := ebiten.CursorPosition()
+	cursor := image.Pt(x, y)
+	wx, wy := ebiten.Wheel()
+	f.input = len(inpututil.AppendJustPressedKeys(nil)) > 0 ||
+		len(inpututil.AppendJustReleasedKeys(nil)) > 0 ||
+		ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) ||
+		inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) ||
+		wx != 0 || wy != 0 || cursor != f.cursor
+	f.cursor = cursor
+}
+
+// frameStatic reports whether the frame drawn now would be the last one
+// drawn again: the demo is paused, no panel or note is fading and no
+// input came in
+func (g *Game) frameStatic() bool {
+	if !g.paused || g.quit.active() || g.profile.open || g.gif.showing() || g.rewind.active || g.idle.input || g.console.open || g.editor.open || g.calibration != nil {
+		return false
+	}
+	now := time.Now()
+	if o := &g.overlays; o.playing != nil && now.Sub(o.playingFrom) < nowPlayingShown {
+		return false
+	}
+	if g.toast.text != "" && now.Sub(g.toast.from) < toastShown {
+		return false
+	}
+	return now.After(g.displayNoteUntil) && !g.watchdog.showing(now)
+}
+
+// keepFrame reports whether the screen can keep the frame drawn last.
+// The first static frame is drawn, the ones after it are skipped.
+func (g *Game) keepFrame(screen *ebiten.Image) bool {
+	f := &g.idle
+	size := screen.Bounds().Size()
+	static := g.frameStatic()
+	keep := static && f.shown && size == f.size
+	f.shown, f.size = static, size
+	return keep
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"bilizir-demo/effects"
+	"bilizir-demo/timeline"
+)
+
+// includeRefLines is the height of the ST low resolution screen the
+// bar count of the include is worked out for
+const includeRefLines = 200
+
+// exportInclude writes the tables and constants of the intro for the
+// -export-include flag, so the remake can serve to prototype an intro
+// for the real machine: the copper sine table, the scroller deformation
+// table, the copper palette as STE color words, the copper and scroller
+// constants at their current values, and the scene times in VBLs. A .h
+// file gets a C header, any other name Devpac-style assembler.
+func (g *Game) exportInclude(path string) error {
+	s, err := timeline.Load(g.scriptPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("demo script: %w", err)
+		}
+		var length time.Duration
+		if p, err := NewMusicPlayer(musicData, sampleRate, false); err == nil {
+			length = p.Duration()
+			p.Close()
+		}
+		s = defaultScript(length)
+	}
+	g.script = s
+	g.setScriptParams()
+
+	bars, err := g.copperPaletteImage()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := newIncludeWriter(f, strings.EqualFold(filepath.Ext(path), ".h"))
+	w.begin()
+
+	w.comment("Timing")
+	w.constant("VBL_RATE", palTickRate)
+
+	param := func(name string) int {
+		return int(math.Round(g.params.Get(name)))
+	}
+	thickness := max(param("copper.thickness"), 1)
+	count := param("copper.count")
+	if count <= 0 {
+		count = (includeRefLines + thickness - 1) / thickness
+	}
+	sine := effects.CopperSine(g.params.Get("copper.amplitude"), g.params.Get("copper.frequency"))
+	w.comment("Copper bars: bar i sits at (sine[(cnt1+i*SPREAD1)%SIZE] + sine[(cnt2+i*SPREAD2)%SIZE] + MARGIN) / 2",
+		"pixels of a 400-pixel-wide screen, cnt1 and cnt2 moving by SPEED1 and SPEED2 a VBL")
+	w.constant("COPPER_TABLE_SIZE", len(sine))
+	w.constant("COPPER_MARGIN", effects.CopperMargin)
+	w.constant("COPPER_SPEED1", param("copper.speed1"))
+	w.constant("COPPER_SPEED2", param("copper.speed2"))
+	w.constant("COPPER_SPREAD1", param("copper.spread1"))
+	w.constant("COPPER_SPREAD2", param("copper.spread2"))
+	w.constant("COPPER_THICKNESS", thickness)
+	w.constant("COPPER_COUNT", count)
+	w.table("copper_sine", sine, false)
+
+	b := bars.Bounds()
+	w.comment("Copper palette: a row of STE color words ($0RGB) for each bar, cycled down the screen")
+	w.constant("COPPER_BARS", b.Dy()/2)
+	w.constant("COPPER_BAR_WIDTH", b.Dx())
+	palette := make([]int, 0, b.Dy()/2*b.Dx())
+	for y := b.Min.Y; y+1 < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			palette = append(palette, steColor(bars.At(x, y)))
+		}
+	}
+	w.table("copper_palette", palette, true)
+
+	deform := effects.ScrollDeform()
+	w.comment("Scroller: each line is offset by scroll_deform[(vbl+line)%SIZE] + 64 pixels of an 800-pixel-wide screen")
+	w.constant("SCROLL_DEFORM_SIZE", len(deform))
+	w.constant("SCROLL_SPEED", param("scroll.speed"))
+	table := make([]int, len(deform))
+	for i, v := range deform {
+		table[i] = int(math.Round(v))
+	}
+	w.table("scroll_deform", table, false)
+
+	w.comment("Scenes of the demo script, start and end in VBLs")
+	w.constant("SCENE_COUNT", len(s.Scenes))
+	for i, sc := range s.Scenes {
+		name := fmt.Sprintf("SCENE%02d_%s", i+1, includeName(sc.Name))
+		w.constant(name+"_START", int(sc.Start.Seconds()*palTickRate))
+		w.constant(name+"_END", int(sc.End.Seconds()*palTickRate))
+	}
+
+	w.end()
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("Include written to %s", path)
+	return nil
+}
+
+// copperPaletteImage returns the strips of the copper bars: generated,
+// or read from the bars image
+func (g *Game) copperPaletteImage() (image.Image, error) {
+	if p, ok := g.copper.GeneratedPalette(); ok {
+		return p.Render(0), nil
+	}
+	f, err := assetFS.Open("assets/bars.png")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// steColor encodes a color as an STE palette word, 4 bits a channel with
+// the lowest bit of each in bit 3, so an ST, reading bits 0 to 2, gets
+// the top three
+func steColor(c interface{ RGBA() (r, g, b, a uint32) }) int {
+	r, g, b, _ := c.RGBA()
+	nibble := func(v uint32) int {
+		n := int(math.Round(float64(v) / 0xffff * 15))
+		return n>>1 | n&1<<3
+	}
+	return nibble(r)<<8 | nibble(g)<<4 | nibble(b)
+}
+
+// includeName makes a scene name a symbol
+func includeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		return "SCENE"
+	}
+	return name
+}
+
+// includeWriter writes constants and word tables as a C header or as
+// assembler source
+type includeWriter struct {
+	*bufio.Writer
+	c bool
+}
+
+// newIncludeWriter writes C when c is set, else assembler
+func newIncludeWriter(w io.Writer, c bool) *includeWriter {
+	return &includeWriter{Writer: bufio.NewWriter(w), c: c}
+}
+
+// begin writes the header of the file
+func (w *includeWriter) begin() {
+	w.comment("Bilizir intro tables and constants, generated by bilizir-demo -export-include")
+	if w.c {
+		w.WriteString("#ifndef BILIZIR_H\n#define BILIZIR_H\n")
+	}
+}
+
+// end writes the footer of the file
+func (w *includeWriter) end() {
+	if w.c {
+		w.WriteString("\n#endif\n")
+	}
+}
+
+// comment writes lines of comment, after a blank line
+func (w *includeWriter) comment(lines ...string) {
+	w.WriteByte('\n')
+	for _, s := range lines {
+		if w.c {
+			fmt.Fprintf(w, "/* %s */\n", s)
+		} else {
+			fmt.Fprintf(w, "; %s\n", s)
+		}
+	}
+}
+
+// constant writes a named constant
+func (w *includeWriter) constant(name string, v int) {
+	if w.c {
+		fmt.Fprintf(w, "#define %s %d\n", name, v)
+	} else {
+		fmt.Fprintf(w, "%s\tequ\t%d\n", name, v)
+	}
+}
+
+// table writes a table of 16-bit words, 16 to a line, in hexadecimal
+// when hex is set
+func (w *includeWriter) table(name string, values []int, hex bool) {
+	if w.c {
+		fmt.Fprintf(w, "static const short %s[%d] = {\n", name, len(values))
+	} else {
+		fmt.Fprintf(w, "%s:\n", name)
+	}
+	for i := 0; i < len(values); i += 16 {
+		line := values[i:min(i+16, len(values))]
+		words := make([]string, len(line))
+		for j, v := range line {
+			switch {
+			case !hex:
+				words[j] = fmt.Sprint(v)
+			case w.c:
+				words[j] = fmt.Sprintf("0x%04x", v)
+			default:
+				words[j] = fmt.Sprintf("$%04x", v)
+			}
+		}
+		if w.c {
+			fmt.Fprintf(w, "\t%s,\n", strings.Join(words, ", "))
+		} else {
+			fmt.Fprintf(w, "\tdc.w\t%s\n", strings.Join(words, ","))
+		}
+	}
+	if w.c {
+		w.WriteString("};\n")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bilizir-demo/effects"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// effectContext returns the context effects are set up with for the
+// current layout
+func (g *Game) effectContext() *effects.Context {
+	return &effects.Context{
+		Width:     g.layout.Width,
+		Height:    g.layout.Height,
+		SafeInset: g.safeInset,
+		Assets:    assetFS,
+		Params:    g.params,
+		Atlas:     g.atlas,
+		Glyphs:    g.glyphs,
+	}
+}
+
+// setLayout switches the internal resolution and rebuilds every
+// resource whose size depends on it
+func (g *Game) setLayout(l effects.Layout) error {
+	g.layout = l
+
+	// Effects keep their animation state across re-initialization
+	ctx := g.effectContext()
+	for _, p := range g.parts {
+		if err := p.Init(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Restart the gallery so screens draw at the new size
+	if g.gallery != nil {
+		g.gallery = nil
+		g.toggleGallery()
+	}
+
+	for _, img := range []*ebiten.Image{g.frame, g.layer} {
+		if img != nil {
+			img.Deallocate()
+		}
+	}
+	g.frame = ebiten.NewImage(l.Width, l.Height)
+	g.layer = ebiten.NewImage(l.Width, l.Height)
+	g.warmed = map[warmKey]bool{}
+	if g.post != nil {
+		g.post.Resize(l.Width, l.Height)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// liveTweenSeconds is how long reloaded values take to settle
+	liveTweenSeconds = 0.5
+
+	// livePollInterval is how often the script file is checked for edits
+	livePollInterval = 250 * time.Millisecond
+)
+
+// LiveScript watches an effect script and applies edits while the demo
+// runs. A script is a list of "name = value" lines; '#' starts a comment.
+//
+//	# slow, wide copper
+//	copper.speed1 = 1
+//	copper.spread1 = 12
+type LiveScript struct {
+	path      string
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+// NewLiveScript watches the script at path
+func NewLiveScript(path string) *LiveScript {
+	return &LiveScript{path: path}
+}
+
+// parseParamScript parses "name = value" lines into assignments
+func parseParamScript(data []byte) (map[string]float64, error) {
+	values := map[string]float64{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected name = value", line)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		values[strings.TrimSpace(name)] = v
+	}
+	return values, sc.Err()
+}
+
+// Poll reloads the script if it changed and tweens the parameters to the
+// new values. A script with errors is ignored so the demo keeps running.
+func (ls *LiveScript) Poll(params *Params) {
+	if time.Since(ls.lastCheck) < livePollInterval {
+		return
+	}
+	ls.lastCheck = time.Now()
+
+	info, err := os.Stat(ls.path)
+	if err != nil || info.ModTime().Equal(ls.modTime) {
+		return
+	}
+	ls.modTime = info.ModTime()
+
+	data, err := os.ReadFile(ls.path)
+	if err != nil {
+		log.Printf("Live script: %v", err)
+		return
+	}
+	values, err := parseParamScript(data)
+	if err != nil {
+		log.Printf("Live script %s: %v", ls.path, err)
+		return
+	}
+
+	for name, v := range values {
+		if err := params.TweenTo(name, v, liveTweenSeconds); err != nil {
+			log.Printf("Live script %s: %v", ls.path, err)
+		}
+	}
+}
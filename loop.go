@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loopRegion is a span of the demo script timeline played over and over,
+// the music seeking back to its start at each pass, so a part can be
+// polished against its exact stretch of music. It is set with -loop, or
+// with I, O and K in the timeline editor.
+type loopRegion struct {
+	spec    string // -loop, resolved once the demo script is loaded
+	on      bool
+	in, out time.Duration
+	scene   string // Scene looped, empty for points set by hand
+	inside  bool   // The playhead reached the region since it was sent back
+}
+
+// String describes the region for the timeline editor and the log
+func (l *loopRegion) String() string {
+	s := fmt.Sprintf("%.1fs-%.1fs", l.in.Seconds(), l.out.Seconds())
+	if l.scene != "" {
+		s = l.scene + " " + s
+	}
+	return s
+}
+
+// parseLoop reads a loop region: the name of a scene of the demo script,
+// or in and out points in seconds, as in "12.5-30"
+func (g *Game) parseLoop(spec string) (in, out time.Duration, scene string, err error) {
+	for _, sc := range g.script.Scenes {
+		if strings.EqualFold(sc.Name, spec) {
+			return sc.Start, sc.End, sc.Name, nil
+		}
+	}
+	a, b, ok := strings.Cut(spec, "-")
+	from, errIn := strconv.ParseFloat(a, 64)
+	to, errOut := strconv.ParseFloat(b, 64)
+	if !ok || errIn != nil || errOut != nil || from < 0 || to <= from {
+		return 0, 0, "", fmt.Errorf("loop %q is neither a scene of the demo script nor in-out seconds like 12.5-30", spec)
+	}
+	return time.Duration(from * float64(time.Second)), time.Duration(to * float64(time.Second)), "", nil
+}
+
+// startLoop loops the region given with -loop, if any, once the demo
+// script is loaded
+func (g *Game) startLoop() error {
+	if g.loop.spec == "" {
+		return nil
+	}
+	in, out, scene, err := g.parseLoop(g.loop.spec)
+	if err != nil {
+		return err
+	}
+	g.setLoop(in, out, scene)
+	return nil
+}
+
+// setLoop loops the timeline from in to out, starting at in
+func (g *Game) setLoop(in, out time.Duration, scene string) {
+	g.loop.in, g.loop.out, g.loop.scene = in, out, scene
+	g.loop.on = out > in
+	g.loop.inside = false
+	if g.loop.on {
+		log.Printf("Looping %s", &g.loop)
+		g.seekMusic(in)
+	}
+}
+
+// clearLoop lets the timeline play on
+func (g *Game) clearLoop() {
+	if g.loop.on {
+		log.Printf("Loop off")
+	}
+	g.loop.on = false
+}
+
+// setLoopPoint moves the in or the out point of the loop to t. Without
+// a loop, the in point starts a new region, looped once its out point is
+// set after it.
+func (g *Game) setLoopPoint(t time.Duration, out bool) {
+	l := &g.loop
+	if out {
+		l.out = t
+	} else {
+		l.in = t
+		if !l.on {
+			l.out = 0
+		}
+	}
+	l.scene = ""
+	if l.out > l.in {
+		if !l.on {
+			g.setLoop(l.in, l.out, "")
+		}
+		return
+	}
+	g.loop.on = false
+}
+
+// toggleSceneLoop loops the scene under the playhead, or ends the loop
+func (g *Game) toggleSceneLoop() {
+	if g.loop.on {
+		g.clearLoop()
+		return
+	}
+	t := g.clock.scene
+	for _, sc := range g.script.Scenes {
+		if t >= sc.Start && t < sc.End {
+			g.setLoop(sc.Start, sc.End, sc.Name)
+			return
+		}
+	}
+}
+
+// updateLoop sends the playhead back to the start of the loop once it
+// leaves the region, past its end or wrapping around with the tune. After
+// a jump back it waits for the playhead to enter the region again, the
+// clock lagging the music by the audio latency.
+func (g *Game) updateLoop() {
+	l := &g.loop
+	if !l.on {
+		return
+	}
+	t := g.clock.scene
+	if t >= l.in && t < l.out {
+		l.inside = true
+		return
+	}
+	if l.inside {
+		l.inside = false
+		g.seekMusic(l.in)
+	}
+}
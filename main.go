@@ -1,61 +1,99 @@
 package main
 
 import (
-	"bytes"
-	_ "embed"
+	"embed"
+	"encoding/binary"
+	"flag"
 	"fmt"
-	"image"
 	"image/color"
-	_ "image/png"
 	"io"
 	"log"
 	"math"
-	"sync"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/audio"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
-	"github.com/hajimehoshi/ebiten/v2/vector"
 	"github.com/olivierh59500/ym-player/pkg/stsound"
+	"golang.org/x/image/font/opentype"
+
+	"bilizir-demo/analysis"
+	"bilizir-demo/buildinfo"
+	"bilizir-demo/effects"
+	"bilizir-demo/sysfont"
+	"bilizir-demo/timeline"
+	"bilizir-demo/ym"
 )
 
-const (
+const sampleRate = 44100
+
+// Size of the rendered frame, 800x600 unless given with -width and -height
+var (
 	screenWidth  = 800
 	screenHeight = 600
-	nbCubes      = 12
-	scrollHeight = 64 // Increased from 50 to 64 for 2x font
-	scrollSpeed  = 4.0
-	sampleRate   = 44100
+)
+
+// Smallest frame accepted, the size of the retro mode
+const (
+	minScreenWidth  = 320
+	minScreenHeight = 200
 )
 
 // Embed all assets
 //
-//go:embed assets/logo.png
-var logoImg []byte
-
-//go:embed assets/bars.png
-var barsImg []byte
-
-//go:embed assets/soap-font.png
-var scrollFontData []byte
-
 //go:embed assets/music.ym
 var musicData []byte
 
-// YMPlayer wraps the YM player for Ebiten audio
+// assetFS exposes the assets to the effects and contributed screens
+//
+//go:embed assets
+var assetFS embed.FS
+
+// YMPlayer wraps the YM player for Ebiten audio. The YM3, YM5 and YM6
+// files most tunes come as play in stereo, each voice panned as set by
+// ymPan; the other YM formats play in mono through StSound. Either way
+// the samples then go through the filter chain set by ymFilter.
 type YMPlayer struct {
-	player       *stsound.StSound
+	playbackState
+
+	stereo       *ym.Player       // nil for the formats played in mono
+	player       *stsound.StSound // Mono player of the other formats
+	filter       *filterChain     // nil for the raw chip sound
+	song         *ym.Song
 	sampleRate   int
-	buffer       []int16
-	mutex        sync.Mutex
+	buffer       []int16   // Mono samples of StSound
+	out          []int16   // Stereo samples of the chips in the last read
+	mix          []float32 // The same after the volume and the filters
 	position     int64
 	totalSamples int64
 	loop         bool
-	volume       float64
 }
 
+// ymPan places the three voices of YM tunes in the stereo field, from -1
+// for the left to 1 for the right
+var ymPan = [3]float64{-0.5, 0, 0.5}
+
 // NewYMPlayer creates a new YM player instance
 func NewYMPlayer(data []byte, sampleRate int, loop bool) (*YMPlayer, error) {
+	if ym.Is(data) {
+		if song, err := ym.Parse(data); err == nil {
+			p := ym.NewPlayer(song, sampleRate)
+			p.SetLoop(loop)
+			p.SetPan(ymPan)
+			return &YMPlayer{
+				stereo:        p,
+				filter:        newFilterChain(ymFilter, sampleRate),
+				song:          song,
+				sampleRate:    sampleRate,
+				totalSamples:  int64(len(song.Frames)) * int64(sampleRate) / int64(song.Rate),
+				loop:          loop,
+				playbackState: playbackState{volume: 0.5},
+			}, nil
+		}
+	}
+
 	player := stsound.CreateWithRate(sampleRate)
 
 	if err := player.LoadMemory(data); err != nil {
@@ -69,23 +107,88 @@ func NewYMPlayer(data []byte, sampleRate int, loop bool) (*YMPlayer, error) {
 	totalSamples := int64(info.MusicTimeInMs) * int64(sampleRate) / 1000
 
 	return &YMPlayer{
-		player:       player,
-		sampleRate:   sampleRate,
-		buffer:       make([]int16, 4096),
-		totalSamples: totalSamples,
-		loop:         loop,
-		volume:       0.5,
+		player:        player,
+		filter:        newFilterChain(ymFilter, sampleRate),
+		sampleRate:    sampleRate,
+		buffer:        make([]int16, 4096),
+		totalSamples:  totalSamples,
+		loop:          loop,
+		playbackState: playbackState{volume: 0.5},
 	}, nil
 }
 
-// Read implements io.Reader for audio streaming
+// Read implements io.Reader for audio streaming, in 16-bit stereo. The
+// samples are rendered into buffers kept from one call to the next, so
+// streaming allocates nothing.
 func (y *YMPlayer) Read(p []byte) (n int, err error) {
 	y.mutex.Lock()
 	defer y.mutex.Unlock()
 
-	samplesNeeded := len(p) / 4
-	outBuffer := make([]int16, samplesNeeded*2)
+	samples, err := y.render(len(p) / 4)
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(p[i*2:], uint16(clampSample(float64(v)*32768)))
+	}
+	return len(samples) * 2, err
+}
+
+// ReadF32 streams like Read in 32-bit float stereo, which the audio
+// device mixes without clipping the samples to 16 bits first
+func (y *YMPlayer) ReadF32(p []byte) (n int, err error) {
+	y.mutex.Lock()
+	defer y.mutex.Unlock()
+
+	samples, err := y.render(len(p) / 8)
+	for i, v := range samples {
+		binary.LittleEndian.PutUint32(p[i*4:], math.Float32bits(v))
+	}
+	return len(samples) * 4, err
+}
 
+// F32 returns the tune as a 32-bit float stream for the audio device
+func (y *YMPlayer) F32() io.ReadSeeker {
+	return floatStream{tune: y, read: y.ReadF32}
+}
+
+// render renders n stereo samples, at full scale 1, with the volume and
+// the filter chain applied. The chips render 16 bits; everything after
+// runs in floating point, with headroom over full scale.
+func (y *YMPlayer) render(n int) ([]float32, error) {
+	y.lastRead = time.Now()
+	if cap(y.out) < n*2 {
+		y.out = make([]int16, n*2)
+		y.mix = make([]float32, n*2)
+	}
+	chip, out := y.out[:n*2], y.mix[:n*2]
+
+	// While paused, feed silence without advancing the tune
+	if y.paused {
+		clear(out)
+		return out, nil
+	}
+
+	var err error
+	if y.stereo != nil {
+		if !y.stereo.Render(chip) {
+			err = io.EOF
+		}
+		y.position += int64(n)
+	} else {
+		err = y.readMono(chip)
+	}
+	volume := float32(y.volume) / 32768
+	for i, v := range chip {
+		out[i] = float32(v) * volume
+	}
+	if y.filter != nil {
+		y.filter.process(out)
+	}
+	return out, err
+}
+
+// readMono renders the formats StSound plays, duplicating its mono
+// samples into both channels
+func (y *YMPlayer) readMono(outBuffer []int16) (err error) {
+	samplesNeeded := len(outBuffer) / 2
 	processed := 0
 	for processed < samplesNeeded {
 		chunkSize := samplesNeeded - processed
@@ -104,7 +207,7 @@ func (y *YMPlayer) Read(p []byte) (n int, err error) {
 		}
 
 		for i := 0; i < chunkSize; i++ {
-			sample := int16(float64(y.buffer[i]) * y.volume)
+			sample := y.buffer[i]
 			outBuffer[(processed+i)*2] = sample
 			outBuffer[(processed+i)*2+1] = sample
 		}
@@ -112,61 +215,114 @@ func (y *YMPlayer) Read(p []byte) (n int, err error) {
 		processed += chunkSize
 		y.position += int64(chunkSize)
 	}
-
-	buf := make([]byte, 0, len(outBuffer)*2)
-	for _, sample := range outBuffer {
-		buf = append(buf, byte(sample), byte(sample>>8))
-	}
-
-	copy(p, buf)
-	n = len(buf)
-	if n > len(p) {
-		n = len(p)
-	}
-
-	return n, err
+	return err
 }
 
-// SetVolume sets the playback volume (0.0 to 1.0)
-func (y *YMPlayer) SetVolume(volume float64) {
+// ChannelState returns the YM2149 voices of the frame being played
+func (y *YMPlayer) ChannelState() [3]ChannelState {
 	y.mutex.Lock()
 	defer y.mutex.Unlock()
-	y.volume = volume
-}
-
-// GetVolume returns the current volume
-func (y *YMPlayer) GetVolume() float64 {
-	y.mutex.Lock()
-	defer y.mutex.Unlock()
-	return y.volume
+	if y.stereo != nil {
+		return ymChannels(y.stereo.Register)
+	}
+	return ymChannels(y.player.GetRegister)
 }
 
-// Seek implements io.Seeker
+// Seek implements io.Seeker; offsets are in bytes of 16-bit stereo
 func (y *YMPlayer) Seek(offset int64, whence int) (int64, error) {
 	y.mutex.Lock()
 	defer y.mutex.Unlock()
 
-	var newPos int64
+	var pos int64
 	switch whence {
 	case io.SeekStart:
-		newPos = offset
+		pos = offset
 	case io.SeekCurrent:
-		newPos = y.position + offset
+		pos = y.position*4 + offset
 	case io.SeekEnd:
-		newPos = y.totalSamples + offset
+		pos = y.totalSamples*4 + offset
 	default:
 		return 0, fmt.Errorf("invalid whence: %d", whence)
 	}
 
-	if newPos < 0 {
-		newPos = 0
+	y.seek(min(max(pos, 0)/4, y.totalSamples))
+	return y.position * 4, nil
+}
+
+// SeekTime moves playback to the given time in the tune
+func (y *YMPlayer) SeekTime(t time.Duration) {
+	y.mutex.Lock()
+	defer y.mutex.Unlock()
+
+	if t < 0 {
+		return
+	}
+	y.seek(int64(t.Seconds() * float64(y.sampleRate)))
+}
+
+// seek moves the chip emulation to a sample position. The stereo player
+// and the StSound formats keeping time jump to the frame; the others are
+// played through to it without output, from the start when going back.
+func (y *YMPlayer) seek(sample int64) {
+	if sample == y.position {
+		return
 	}
-	if newPos > y.totalSamples {
-		newPos = y.totalSamples
+	switch {
+	case y.stereo != nil:
+		y.stereo.Seek(int(sample * int64(y.song.Rate) / int64(y.sampleRate)))
+	case y.player == nil:
+		return
+	case y.player.IsSeekable():
+		y.player.Seek(uint32(sample * 1000 / int64(y.sampleRate)))
+	default:
+		from := y.position
+		if sample < from {
+			y.player.Restart()
+			from = 0
+		}
+		for left := sample - from; left > 0; {
+			chunk := int(min(left, int64(len(y.buffer))))
+			y.player.Compute(y.buffer[:chunk], chunk)
+			left -= int64(chunk)
+		}
 	}
+	y.position = sample
+}
+
+// MusicPosition returns the current time in the tune
+func (y *YMPlayer) MusicPosition() time.Duration {
+	y.mutex.Lock()
+	defer y.mutex.Unlock()
 
-	y.position = newPos
-	return newPos, nil
+	if y.stereo != nil {
+		return y.stereo.Position()
+	}
+	if y.player == nil {
+		return 0
+	}
+	return time.Duration(y.player.GetPos()) * time.Millisecond
+}
+
+// Info returns the song name and author from the YM header
+func (y *YMPlayer) Info() TuneInfo {
+	y.mutex.Lock()
+	defer y.mutex.Unlock()
+
+	info := TuneInfo{Format: "YM"}
+	if y.song != nil {
+		info.Title = strings.TrimSpace(y.song.Title)
+		info.Author = strings.TrimSpace(y.song.Author)
+	} else if y.player != nil {
+		meta := y.player.GetInfo()
+		info.Title = strings.TrimSpace(meta.SongName)
+		info.Author = strings.TrimSpace(meta.SongAuthor)
+	}
+	return info
+}
+
+// Duration returns the length of the tune
+func (y *YMPlayer) Duration() time.Duration {
+	return time.Duration(y.totalSamples) * time.Second / time.Duration(y.sampleRate)
 }
 
 // Close releases resources
@@ -181,287 +337,184 @@ func (y *YMPlayer) Close() error {
 	return nil
 }
 
-// ScrollText manages the scrolling text with deformation effects
-type ScrollText struct {
-	text         string
-	x            float64
-	fontImage    *ebiten.Image
-	charWidth    int
-	charHeight   int
-	charsPerRow  int
-	scrollBuffer *ebiten.Image
-	workBuffer   *ebiten.Image
-	deformBuffer *ebiten.Image
-}
+// Game composes the demo effects, the music and the dev tools
+type Game struct {
+	// Demo effects, drawn in order from back to front
+	copper   *effects.CopperBars
+	logo     *effects.LogoSine
+	cubes    *effects.Cubes
+	scroller *effects.TextScroller  // GPU path toggles with G
+	meter    *effects.ChipMeter     // Driven by the YM registers
+	objects  *effects.Objects3D     // Only shown by the "objects" scene
+	stars    *effects.Starfield     // Background of the "stars" scene
+	tunnel   *effects.Tunnel        // Shown by the "tunnel" scene
+	fire     *effects.Fire          // Backdrop of the "fire" scene
+	dissolve *effects.LogoDissolve  // Logo particles of the "dissolve" scene
+	reveal   *effects.RevealImage   // Logo appearing through a mask
+	balls    *effects.VectorBalls   // Ball sprites in 3D formations
+	rasters  *effects.Rasters       // Scanline colors behind the "rasters" scene
+	falls    *effects.Waterfall     // Palette cycling of the "waterfall" scene
+	march    *effects.Raymarch      // Shader raymarched "raymarch" scene
+	scope    *effects.Oscilloscope  // Waveform of the sound played
+	parts    []effects.Effect       // Every part, kept updated
+	intro    []effects.Effect       // Parts of the full intro
+	atlas    *effects.Atlas         // Small images shared by the parts
+	glyphs   *effects.GlyphFallback // Characters the bitmap fonts lack
+
+	// Fonts of the fallback chain given with -fallback-fonts
+	fallbackFonts []*opentype.Font
+
+	// Parts drawn, toggled with Ctrl+F1 to Ctrl+F8 to isolate layers, and
+	// the bit of each part in the mask
+	Effects  EffectMask
+	partBits map[effects.Effect]EffectMask
+
+	// Parts shown by each scene of the demo script, and the layer fading
+	// scenes are composited through, with an alpha fade or a reveal mask
+	scenes   map[string][]effects.Effect
+	layer    *ebiten.Image
+	revealer *effects.Revealer
+	badMasks map[string]bool  // Reveal masks that failed to load
+	warmed   map[warmKey]bool // Scenes drawn ahead of their start
+	clock    demoClock        // Master clock, following the music
+
+	// Scene time up to which sync events were fired, syncLead ahead of
+	// the scene clock
+	syncTime time.Duration
+	rewind   rewindState
 
-// Cube3D represents a rotating 3D cube
-type Cube3D struct {
-	angleX float64
-	angleY float64
-	angleZ float64
-	size   float64
-}
+	// Audio
+	audioContext *audio.Context
+	audioPlayer  *audio.Player
+	music        MusicPlayer
+	watchdog     audioWatchdog
+	tap          sampleTap // Last samples played, for the oscilloscope
+
+	// Audio output latency the scene clock is delayed by, measured on the
+	// calibration screen (C)
+	latency     time.Duration
+	calibrated  bool
+	calibration *Calibration
 
-// NewCube3D creates a new 3D cube
-func NewCube3D(size float64) *Cube3D {
-	return &Cube3D{
-		size: size,
-	}
-}
+	// Settings given on the command line over the saved ones
+	launch launchOptions
 
-// Rotate updates the cube rotation angles
-func (c *Cube3D) Rotate(dx, dy, dz float64) {
-	c.angleX += dx
-	c.angleY += dy
-	c.angleZ += dz
-}
+	// Last frame kept on screen while paused
+	idle idleFrame
 
-// Project3D projects 3D coordinates to 2D
-func project3D(x, y, z float64) (float64, float64) {
-	// Simple perspective projection
-	perspective := 200.0
-	factor := perspective / (perspective + z)
-	return x * factor, y * factor
-}
+	// Window to return to from fullscreen, and the hidden cursor
+	fullscreen fullscreenState
 
-// Draw draws the 3D cube at the specified position
-func (c *Cube3D) Draw(screen *ebiten.Image, centerX, centerY float64) {
-	// Define cube vertices in 3D space
-	vertices := [][3]float64{
-		{-c.size / 2, -c.size / 2, -c.size / 2}, // 0
-		{c.size / 2, -c.size / 2, -c.size / 2},  // 1
-		{c.size / 2, c.size / 2, -c.size / 2},   // 2
-		{-c.size / 2, c.size / 2, -c.size / 2},  // 3
-		{-c.size / 2, -c.size / 2, c.size / 2},  // 4
-		{c.size / 2, -c.size / 2, c.size / 2},   // 5
-		{c.size / 2, c.size / 2, c.size / 2},    // 6
-		{-c.size / 2, c.size / 2, c.size / 2},   // 7
-	}
-
-	// Define cube faces (indices into vertices array)
-	faces := [][4]int{
-		{0, 1, 2, 3}, // Back
-		{4, 5, 6, 7}, // Front
-		{0, 1, 5, 4}, // Bottom
-		{2, 3, 7, 6}, // Top
-		{0, 3, 7, 4}, // Left
-		{1, 2, 6, 5}, // Right
-	}
-
-	// Define face colors (pink/magenta tones)
-	faceColors := []color.Color{
-		color.RGBA{255, 80, 160, 255},  // Hot pink
-		color.RGBA{255, 120, 200, 255}, // Light pink
-		color.RGBA{200, 60, 140, 255},  // Dark pink
-		color.RGBA{255, 100, 180, 255}, // Medium pink
-		color.RGBA{220, 80, 160, 255},  // Rose
-		color.RGBA{255, 140, 200, 255}, // Pale pink
-	}
-
-	// Rotate vertices
-	rotated := make([][3]float64, len(vertices))
-	for i, v := range vertices {
-		x, y, z := v[0], v[1], v[2]
-
-		// Rotate around X axis
-		cosX, sinX := math.Cos(c.angleX), math.Sin(c.angleX)
-		y1 := y*cosX - z*sinX
-		z1 := y*sinX + z*cosX
-		y, z = y1, z1
-
-		// Rotate around Y axis
-		cosY, sinY := math.Cos(c.angleY), math.Sin(c.angleY)
-		x1 := x*cosY + z*sinY
-		z2 := -x*sinY + z*cosY
-		x, z = x1, z2
-
-		// Rotate around Z axis
-		cosZ, sinZ := math.Cos(c.angleZ), math.Sin(c.angleZ)
-		x2 := x*cosZ - y*sinZ
-		y2 := x*sinZ + y*cosZ
-		x, y = x2, y2
-
-		rotated[i] = [3]float64{x, y, z}
-	}
-
-	// Calculate face depths for sorting
-	type faceDepth struct {
-		index int
-		depth float64
-	}
-	depths := make([]faceDepth, len(faces))
-
-	for i, face := range faces {
-		// Calculate center of face
-		centerZ := 0.0
-		for _, vi := range face {
-			centerZ += rotated[vi][2]
-		}
-		depths[i] = faceDepth{i, centerZ / 4}
-	}
+	// Fade out on the way out with Esc
+	quit quitFade
 
-	// Sort faces by depth (back to front)
-	for i := 0; i < len(depths)-1; i++ {
-		for j := i + 1; j < len(depths); j++ {
-			if depths[i].depth > depths[j].depth {
-				depths[i], depths[j] = depths[j], depths[i]
-			}
-		}
-	}
+	// Endless mode, nil when off
+	filler *ScreenFiller
 
-	// Draw faces
-	for _, fd := range depths {
-		face := faces[fd.index]
-		faceColor := faceColors[fd.index]
+	// Frame profiler overlay (F3)
+	profile profiler
 
-		// Project vertices to 2D
-		points := make([]float64, 0, 8)
-		for _, vi := range face {
-			v := rotated[vi]
-			x2d, y2d := project3D(v[0], v[1], v[2])
-			points = append(points, centerX+x2d, centerY+y2d)
-		}
+	// Animated GIF recording (F9)
+	gif gifRecorder
 
-		// Draw filled polygon
-		drawPolygon(screen, points, faceColor)
+	// Region of the timeline played over and over (-loop)
+	loop loopRegion
 
-		// Draw edges with darker color for better visibility
-		edgeColor := color.RGBA{
-			uint8(faceColor.(color.RGBA).R * 3 / 4),
-			uint8(faceColor.(color.RGBA).G * 3 / 4),
-			uint8(faceColor.(color.RGBA).B * 3 / 4),
-			255,
-		}
-		for i := 0; i < 4; i++ {
-			j := (i + 1) % 4
-			vector.StrokeLine(screen,
-				float32(points[i*2]), float32(points[i*2+1]),
-				float32(points[j*2]), float32(points[j*2+1]),
-				1, edgeColor, false)
-		}
-	}
-}
+	// Offline video export (-record), nil when running live
+	export *videoExport
 
-// drawPolygon draws a filled polygon
-func drawPolygon(screen *ebiten.Image, points []float64, fillColor color.Color) {
-	if len(points) < 6 {
-		return
-	}
+	// Fraction of each side the logo, scroller and now-playing panel keep
+	// clear of for overscan, and whether the safe-area guides are shown (F4)
+	safeInset  float64
+	safeGuides bool
 
-	// Draw as a filled rectangle using vector
-	if len(points) >= 8 {
-		// Find bounding box
-		minX, minY := points[0], points[1]
-		maxX, maxY := points[0], points[1]
-		for i := 2; i < len(points); i += 2 {
-			if points[i] < minX {
-				minX = points[i]
-			}
-			if points[i] > maxX {
-				maxX = points[i]
-			}
-			if points[i+1] < minY {
-				minY = points[i+1]
-			}
-			if points[i+1] > maxY {
-				maxY = points[i+1]
-			}
-		}
+	// Post-processing
+	post        *PostChain
+	frame       *ebiten.Image
+	paletteMode PaletteMode
+	palettePass *PostEffect
+	mirror      int // Mirror fold of the scenes playing, see timeline.Scene
+	mirrorPass  *PostEffect
 
-		// Draw filled quadrilateral as two triangles
-		// Triangle 1: points 0, 1, 2
-		drawTriangle(screen,
-			float32(points[0]), float32(points[1]),
-			float32(points[2]), float32(points[3]),
-			float32(points[4]), float32(points[5]),
-			fillColor)
-
-		// Triangle 2: points 0, 2, 3
-		drawTriangle(screen,
-			float32(points[0]), float32(points[1]),
-			float32(points[4]), float32(points[5]),
-			float32(points[6]), float32(points[7]),
-			fillColor)
-	}
-}
+	// Zoom blur, and its pulse from the last "beat" sync, 1 down to 0
+	zoomBlurPass *PostEffect
+	zoomBlurBeat float64
 
-// drawTriangle draws a filled triangle
-func drawTriangle(screen *ebiten.Image, x1, y1, x2, y2, x3, y3 float32, clr color.Color) {
-	// Draw triangle using lines to fill it
-	// Sort vertices by Y coordinate
-	if y1 > y2 {
-		x1, y1, x2, y2 = x2, y2, x1, y1
-	}
-	if y1 > y3 {
-		x1, y1, x3, y3 = x3, y3, x1, y1
-	}
-	if y2 > y3 {
-		x2, y2, x3, y3 = x3, y3, x2, y2
-	}
+	// Display adjustments for the output device, saved between runs
+	display          DisplaySettings
+	displayPass      *PostEffect
+	displayNote      string // Save error shown with the settings
+	displayNoteUntil time.Time
 
-	// Draw horizontal lines to fill the triangle
-	for y := y1; y <= y3; y++ {
-		var xStart, xEnd float32
+	// Live-tweakable effect parameters and the script editing them
+	params *Params
+	live   *LiveScript
 
-		if y < y2 {
-			// Upper part of triangle
-			if y2-y1 > 0 {
-				t := (y - y1) / (y2 - y1)
-				x12 := x1 + (x2-x1)*t
-				t13 := (y - y1) / (y3 - y1)
-				x13 := x1 + (x3-x1)*t13
-				xStart, xEnd = x12, x13
-			}
-		} else {
-			// Lower part of triangle
-			if y3-y2 > 0 && y3-y1 > 0 {
-				t := (y - y2) / (y3 - y2)
-				x23 := x2 + (x3-x2)*t
-				t13 := (y - y1) / (y3 - y1)
-				x13 := x1 + (x3-x1)*t13
-				xStart, xEnd = x23, x13
-			}
-		}
+	// Dev tools (tweak console toggles with the backquote key, timeline
+	// editor with F5)
+	console TweakConsole
+	editor  TimelineEditor
+	history History
 
-		if xStart > xEnd {
-			xStart, xEnd = xEnd, xStart
-		}
+	// File or URL the scroll message is read from, reloaded with Shift+F5
+	scrolltext scrolltextSource
 
-		vector.StrokeLine(screen, xStart, y, xEnd, y, 1, clr, false)
-	}
-}
+	// Demo script authored in the timeline editor, and the values the
+	// parameters it changes on the timeline hold before their first change
+	script     *timeline.Script
+	scriptPath string
+	paramBase  map[string]float64
 
-// Game represents the main game state
-type Game struct {
-	// Demo assets
-	cubes     [nbCubes]*Cube3D
-	spritePos [nbCubes]float64
-	logo      *ebiten.Image
-	logoPos   float64
-	wl, hl    int
-	bars      *ebiten.Image
-
-	// Copper bars animation
-	copperSin []int
-	cnt       int
-	cnt2      int
-
-	// Scroll integration
-	scrollText *ScrollText
-	scrollX    []float64
-	scrollXMod int
-	vbl        int
-	offsetScr  float64
-	scrollFont *ebiten.Image
+	// Offline analysis of the tune, computed in the background
+	waveform    *analysis.Waveform
+	waveformCh  chan *analysis.Waveform
+	suggestions []time.Duration // Suggested scene boundaries
 
-	// Audio
-	audioContext *audio.Context
-	audioPlayer  *audio.Player
-	ymPlayer     *YMPlayer
+	// Logic timing
+	pal palTiming
+
+	// Display refresh detection and the frame limiter used without vsync
+	refresh refreshState
+
+	// A/B comparison of effect implementations (cycle with B)
+	ab ABCompare
+
+	// Cube path benchmark, replacing the demo when -bench-cubes is set
+	bench *cubeBench
+
+	// Contributed screens gallery (toggle with Tab)
+	gallery *Gallery
+
+	// Internal resolution and retro low-res mode
+	layout      effects.Layout
+	retro       RetroMode
+	retroFrame  *ebiten.Image
+	retroShader *ebiten.Shader
 
 	// Speed control
 	speedMultiplier float64
 
+	// Pause state of the music and the animation (toggle with Space)
+	paused bool
+
+	// Browser tab visibility, the demo pauses while hidden
+	visibility pageVisibility
+
+	// Frosted glass panels: now playing (N), help (H or F1)
+	overlays overlays
+
+	// Short message in the top left corner, like the outcome of a tune
+	// dropped onto the window
+	toast toast
+
+	// Tunes played after the main one, switched with PgUp/PgDn, and what
+	// plays as one ends (cycle with M)
+	playlist     []playlistEntry
+	playlistMode playlistMode
+
+	// Why the demo could not start, shown by the error screen
+	failure error
+
 	// Initialization flag
 	initialized bool
 }
@@ -470,15 +523,44 @@ type Game struct {
 func NewGame() *Game {
 	g := &Game{
 		speedMultiplier: 1.0,
-		cnt:             0,
-		cnt2:            0,
+		layout:          effects.NewLayout(screenWidth, screenHeight),
+		copper:          &effects.CopperBars{},
+		logo:            &effects.LogoSine{},
+		cubes:           &effects.Cubes{},
+		scroller:        &effects.TextScroller{},
+		objects:         &effects.Objects3D{},
+		stars:           &effects.Starfield{},
+		tunnel:          &effects.Tunnel{},
+		fire:            &effects.Fire{},
+		dissolve:        &effects.LogoDissolve{},
+		reveal:          &effects.RevealImage{},
+		balls:           &effects.VectorBalls{},
+		rasters:         &effects.Rasters{},
+		falls:           &effects.Waterfall{},
+		march:           &effects.Raymarch{},
+		display:         loadDisplaySettings(),
+		Effects:         AllEffects,
+	}
+	g.meter = &effects.ChipMeter{Voices: g.chipVoices}
+	g.scope = &effects.Oscilloscope{Samples: g.tap.Samples}
+	g.intro = []effects.Effect{g.copper, g.logo, g.cubes, g.scroller, g.meter}
+	g.parts = []effects.Effect{g.copper, g.logo, g.cubes, g.scroller, g.meter, g.objects, g.stars, g.tunnel, g.fire, g.dissolve, g.reveal, g.balls, g.rasters, g.falls, g.march, g.scope}
+	g.partBits = map[effects.Effect]EffectMask{}
+	for i, p := range g.parts {
+		g.partBits[p] = 1 << i
 	}
+	g.scenes = g.sceneParts()
 
-	// Initialize scroll deformation data
-	g.initScrollX()
+	// A dusk sky behind the "rasters" scene, flashing on "flash" syncs
+	g.rasters.Register("sky", effects.SkyGradient(
+		color.RGBA{8, 16, 64, 255},
+		color.RGBA{96, 48, 160, 255},
+		color.RGBA{240, 112, 64, 255},
+		color.RGBA{255, 208, 96, 255},
+	))
 
-	// Initialize copper bars sine table
-	g.initCopperSin()
+	// Register the tweakable effect parameters
+	g.defineDemoParams()
 
 	// Initialize audio context
 	g.audioContext = audio.NewContext(sampleRate)
@@ -486,295 +568,254 @@ func NewGame() *Game {
 	return g
 }
 
-// initCopperSin initializes the sine table for copper bars animation
-func (g *Game) initCopperSin() {
-	// This is the sine table from the JavaScript code
-	g.copperSin = []int{
-		264, 264, 268, 272, 276, 280, 280, 284, 288, 292, 296, 296, 300, 304, 308, 312, 312, 316, 320, 324, 328, 328, 332, 336, 340, 340, 344, 348, 352, 352, 356, 360, 364, 364, 368, 372, 376, 376, 380, 384, 388, 388, 392, 396, 396, 400, 404, 404, 408, 412, 412, 416, 420, 420, 424, 428, 428, 432, 436, 436, 440, 440, 444, 448, 448, 452, 452, 456, 456, 460, 460, 464, 464, 468, 472, 472, 472, 476, 476, 480, 480, 484, 484, 488, 488, 488, 492, 492, 496, 496, 496, 500, 500, 500, 504, 504, 504, 508, 508, 508, 512, 512, 512, 512, 516, 516, 516, 516, 520, 520, 520, 520, 520, 520, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 520, 520, 520, 520, 520, 520, 516, 516, 516, 516, 512, 512, 512, 512, 508, 508, 508, 508, 504, 504, 504, 500, 500, 500, 496, 496, 492, 492, 492, 488, 488, 484, 484, 480, 480, 480, 476, 476, 472, 472, 468, 468, 464, 464, 460, 456, 456, 452, 452, 448, 448, 444, 444, 440, 436, 436, 432, 428, 428, 424, 424, 420, 416, 416, 412, 408, 408, 404, 400, 400, 396, 392, 388, 388, 384, 380, 380, 376, 372, 368, 368, 364, 360, 356, 356, 352, 348, 344, 344, 340, 336, 332, 328, 328, 324, 320, 316, 316, 312, 308, 304, 300, 300, 296, 292, 288, 284, 284, 280, 276, 272, 268, 264, 264, 264, 260, 256, 252, 252, 248, 244, 240, 236, 236, 232, 228, 224, 220, 220, 216, 212, 208, 204, 204, 200, 196, 192, 192, 188, 184, 180, 176, 176, 172, 168, 164, 164, 160, 156, 152, 152, 148, 144, 144, 140, 136, 132, 132, 128, 124, 124, 120, 116, 116, 112, 108, 108, 104, 100, 100, 96, 96, 92, 88, 88, 84, 84, 80, 76, 76, 72, 72, 68, 68, 64, 64, 60, 60, 56, 56, 52, 52, 48, 48, 44, 44, 40, 40, 40, 36, 36, 32, 32, 32, 28, 28, 28, 24, 24, 24, 20, 20, 20, 16, 16, 16, 16, 12, 12, 12, 12, 12, 8, 8, 8, 8, 8, 8, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 8, 8, 8, 8, 8, 8, 12, 12, 12, 12, 12, 16, 16, 16, 20, 20, 20, 20, 24, 24, 24, 28, 28, 28, 32, 32, 36, 36, 36, 40, 40, 44, 44, 44, 48, 48, 52, 52, 56, 56, 60, 60, 64, 64, 68, 68, 72, 72, 76, 80, 80, 84, 84, 88, 92, 92, 96, 96, 100, 104, 104, 108, 112, 112, 116, 120, 120, 124, 128, 128, 132, 136, 136, 140, 144, 148, 148, 152, 156, 156, 160, 164, 168, 168, 172, 176, 180, 180, 184, 188, 192, 196, 196, 200, 204, 208, 212, 212, 216, 220, 224, 224, 228, 232, 236, 240, 244, 244, 248, 252, 256, 260, 260, 264, 264, 268, 272, 276, 280, 280, 284, 288, 292, 296, 296, 300, 304, 308, 312, 312, 316, 320, 324, 328, 328, 332, 336, 340, 340, 344, 348, 352, 352, 356, 360, 364, 364, 368, 372, 376, 376, 380, 384, 388, 388, 392, 396, 396, 400, 404, 404, 408, 412, 412, 416, 420, 420, 424, 428, 428, 432, 436, 436, 440, 440, 444, 448, 448, 452, 452, 456, 456, 460, 460, 464, 464, 468, 472, 472, 472, 476, 476, 480, 480, 484, 484, 488, 488, 488, 492, 492, 496, 496, 496, 500, 500, 500, 504, 504, 504, 508, 508, 508, 512, 512, 512, 512, 516, 516, 516, 516, 520, 520, 520, 520, 520, 520, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 524, 520, 520, 520, 520, 520, 520, 516, 516, 516, 516, 512, 512, 512, 512, 508, 508, 508, 508, 504, 504, 504, 500, 500, 500, 496, 496, 492, 492, 492, 488, 488, 484, 484, 480, 480, 480, 476, 476, 472, 472, 468, 468, 464, 464, 460, 456, 456, 452, 452, 448, 448, 444, 444, 440, 436, 436, 432, 428, 428, 424, 424, 420, 416, 416, 412, 408, 408, 404, 400, 400, 396, 392, 388, 388, 384, 380, 380, 376, 372, 368, 368, 364, 360, 356, 356, 352, 348, 344, 344, 340, 336, 332, 328, 328, 324, 320, 316, 316, 312, 308, 304, 300, 300, 296, 292, 288, 284, 284, 280, 276, 272, 268, 264, 264, 264, 260, 256, 252, 252, 248, 244, 240, 236, 236, 232, 228, 224, 220, 220, 216, 212, 208, 204, 204, 200, 196, 192, 192, 188, 184, 180, 176, 176, 172, 168, 164, 164, 160, 156, 152, 152, 148, 144, 144, 140, 136, 132, 132, 128, 124, 124, 120, 116, 116, 112, 108, 108, 104, 100, 100, 96, 96, 92, 88, 88, 84, 84, 80, 76, 76, 72, 72, 68, 68, 64, 64, 60, 60, 56, 56, 52, 52, 48, 48, 44, 44, 40, 40, 40, 36, 36, 32, 32, 32, 28, 28, 28, 24, 24, 24, 20, 20, 20, 16, 16, 16, 16, 12, 12, 12, 12, 12, 8, 8, 8, 8, 8, 8, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 8, 8, 8, 8, 8, 8, 12, 12, 12, 12, 12, 16, 16, 16, 20, 20, 20, 20, 24, 24, 24, 28, 28, 28, 32, 32, 36, 36, 36, 40, 40, 44, 44, 44, 48, 48, 52, 52, 56, 56, 60, 60, 64, 64, 68, 68, 72, 72, 76, 80, 80, 84, 84, 88, 92, 92, 96, 96, 100, 104, 104, 108, 112, 112, 116, 120, 120, 124, 128, 128, 132, 136, 136, 140, 144, 148, 148, 152, 156, 156, 160, 164, 168, 168, 172, 176, 180, 180, 184, 188, 192, 196, 196, 200, 204, 208, 212, 212, 216, 220, 224, 224, 228, 232, 236, 240, 244, 244, 248, 252, 256, 260, 260,
-	}
-}
-
-// initScrollX initializes the scroll deformation wave patterns
-func (g *Game) initScrollX() {
-	g.scrollX = make([]float64, 0)
+// loadMusic loads and plays the tune, YM, SNDH, MOD, S3M, XM, AHX or HVL,
+// or the playlist starting with it
+func (g *Game) loadMusic() error {
+	var err error
 
-	// First wave pattern
-	stp1 := 7.0 / 180.0 * math.Pi
-	stp2 := 3.0 / 180.0 * math.Pi
-	for i := 0; i < 389; i++ {
-		x := 20*math.Sin(float64(i)*stp1) + 30*math.Cos(float64(i)*stp2)
-		g.scrollX = append(g.scrollX, x)
+	// Create the player matching the tune format
+	if len(g.playlist) > 0 {
+		entries := append([]playlistEntry{{name: "main tune", data: musicData}}, g.playlist...)
+		g.music, err = NewPlaylist(entries, sampleRate, g.playlistMode)
+	} else {
+		g.music, err = NewMusicPlayer(musicData, sampleRate, true)
 	}
-
-	// Second wave pattern
-	stp1 = 72.0 / 180.0 * math.Pi
-	for i := 0; i < 120; i++ {
-		x := 4 * math.Sin(float64(i)*stp1)
-		g.scrollX = append(g.scrollX, x)
+	if err != nil {
+		return fmt.Errorf("failed to create music player: %w", err)
 	}
 
-	// Third wave pattern
-	stp1 = 8.0 / 180.0 * math.Pi
-	for i := 0; i < 68; i++ {
-		x := 40 * math.Sin(float64(i)*stp1)
-		g.scrollX = append(g.scrollX, x)
+	// Create audio player
+	g.audioPlayer, err = g.newAudioPlayer()
+	if err != nil {
+		g.music.Close()
+		g.music = nil
+		return fmt.Errorf("failed to create audio player: %w", err)
 	}
 
-	// Repeat first pattern
-	stp1 = 7.0 / 180.0 * math.Pi
-	stp2 = 3.0 / 180.0 * math.Pi
-	for i := 0; i < 389; i++ {
-		x := 20*math.Sin(float64(i)*stp1) + 30*math.Cos(float64(i)*stp2)
-		g.scrollX = append(g.scrollX, x)
-	}
+	g.audioPlayer.Play()
+	g.showNowPlaying()
+	return nil
+}
 
-	// Small wave
-	stp1 = 72.0 / 180.0 * math.Pi
-	for i := 0; i < 36; i++ {
-		x := 4 * math.Sin(float64(i)*stp1)
-		g.scrollX = append(g.scrollX, x)
+// Init initializes the game
+func (g *Game) Init() error {
+	if g.initialized {
+		return nil
 	}
 
-	// Final wave
-	stp1 = 8.0 / 180.0 * math.Pi
-	for i := 0; i < 189; i++ {
-		x := 30 * math.Sin(float64(i)*stp1)
-		g.scrollX = append(g.scrollX, x)
+	// The UI panels come first, the error screen draws with them
+	if err := g.overlays.panel.Init(); err != nil {
+		log.Printf("Frosted glass panels unavailable: %v", err)
 	}
 
-	g.scrollXMod = len(g.scrollX)
-}
-
-// loadAssets loads all image assets from embedded data
-func (g *Game) loadAssets() error {
-	var err error
-
-	// Initialize cube positions
-	for i := 0; i < nbCubes; i++ {
-		g.spritePos[i] = float64(0.15) * float64(i+1)
-		// Create cubes with different initial rotations
-		g.cubes[i] = NewCube3D(20) // 20 pixel size cubes
-		g.cubes[i].angleX = float64(i) * 0.3
-		g.cubes[i].angleY = float64(i) * 0.5
-		g.cubes[i].angleZ = float64(i) * 0.2
+	// Set up post-processing passes
+	g.post = NewPostChain(g.layout.Width, g.layout.Height)
+	if err := g.initMirrorPass(); err != nil {
+		log.Printf("Mirror and kaleidoscope unavailable: %v", err)
 	}
-
-	// Load logo
-	img, _, err := image.Decode(bytes.NewReader(logoImg))
-	if err != nil {
-		return fmt.Errorf("failed to load logo image: %v", err)
+	if err := g.initZoomBlurPass(); err != nil {
+		log.Printf("Zoom blur unavailable: %v", err)
 	}
-	g.logo = ebiten.NewImageFromImage(img)
-	g.wl, g.hl = g.logo.Size()
-
-	// Load bars image
-	img, _, err = image.Decode(bytes.NewReader(barsImg))
-	if err != nil {
-		return fmt.Errorf("failed to load bars image: %v", err)
+	if err := g.initPalettePass(); err != nil {
+		log.Printf("Palette emulation unavailable: %v", err)
 	}
-	g.bars = ebiten.NewImageFromImage(img)
-
-	// Load scroll font
-	img, _, err = image.Decode(bytes.NewReader(scrollFontData))
-	if err != nil {
-		return fmt.Errorf("failed to load scroll font: %v", err)
+	if err := g.initDisplayPass(); err != nil {
+		log.Printf("Display adjustments unavailable: %v", err)
 	}
-	g.scrollFont = ebiten.NewImageFromImage(img)
-
-	return nil
-}
-
-// initScrollText initializes the scrolling text with soap font
-func (g *Game) initScrollText() {
-	scrollText := `      HELLO, BILIZIR FROM DMA IS PROUD TO PRESENT HIS NEW GOLANG/EBITEN INTRO... NOT SO BAD FOR A FEW HOURS OF HARD WORK :)  HI TO ALL MEMBERS OF DMA (COUCOU PHILIPPE ET DIDIER ALORS PAS MAL NON ?), ALL MEMBERS OF THE UNION, ALL DEMOSCENE FANS...   LET'S WRAP...      `
-
-	g.scrollText = &ScrollText{
-		text:         scrollText,
-		x:            0,
-		fontImage:    g.scrollFont,
-		charWidth:    32,
-		charHeight:   32,
-		charsPerRow:  10,
-		scrollBuffer: ebiten.NewImage(screenWidth+512, scrollHeight),  // Increased buffer for 2x font
-		workBuffer:   ebiten.NewImage(screenWidth+1024, scrollHeight), // Even larger for 2x deformation
-		deformBuffer: ebiten.NewImage(screenWidth, scrollHeight),
+	if err := g.initRetroShader(); err != nil {
+		log.Printf("Scanline overlay unavailable: %v", err)
 	}
-}
-
-// loadMusic loads and plays the YM music
-func (g *Game) loadMusic() error {
-	var err error
-
-	// Create YM player
-	g.ymPlayer, err = NewYMPlayer(musicData, sampleRate, true)
-	if err != nil {
-		return fmt.Errorf("failed to create YM player: %w", err)
+	if shader, err := ebiten.NewShader(diffShaderSrc); err != nil {
+		log.Printf("A/B difference view unavailable: %v", err)
+	} else {
+		g.ab.shader = shader
 	}
 
-	// Create audio player
-	g.audioPlayer, err = g.audioContext.NewPlayer(g.ymPlayer)
-	if err != nil {
-		g.ymPlayer.Close()
-		g.ymPlayer = nil
-		return fmt.Errorf("failed to create audio player: %w", err)
+	// Reveal masks for scene transitions; scenes fade from black without
+	if r, err := effects.NewRevealer(assetFS); err != nil {
+		log.Printf("Reveal transitions unavailable: %v", err)
+	} else {
+		g.revealer = r
+		g.badMasks = map[string]bool{}
 	}
 
-	g.audioPlayer.Play()
-	return nil
-}
+	// Pack the small images the parts share into one atlas
+	if a, err := effects.NewDemoAtlas(assetFS); err != nil {
+		log.Printf("Texture atlas unavailable: %v", err)
+	} else {
+		g.atlas = a
+		effects.UseAtlas(a)
+	}
 
-// Init initializes the game
-func (g *Game) Init() error {
-	if g.initialized {
-		return nil
+	// Render the characters the bitmap fonts lack from the fallback fonts
+	if gf, err := effects.NewGlyphFallback(g.atlas, g.fallbackFonts...); err != nil {
+		log.Printf("Fallback fonts unavailable: %v", err)
+	} else {
+		g.glyphs = gf
+		sysfont.SetFallback(func(r rune) (*ebiten.Image, bool) {
+			return gf.Glyph(r, sysfont.CharWidth, sysfont.CharHeight)
+		})
 	}
 
-	// Load all assets
-	if err := g.loadAssets(); err != nil {
+	// Set up the effects and the layout-dependent buffers
+	if err := g.setLayout(g.layout); err != nil {
 		return err
 	}
 
-	// Initialize scrolling text
-	g.initScrollText()
-
 	// Load music
 	if err := g.loadMusic(); err != nil {
 		log.Printf("Failed to load music: %v", err)
 		// Continue without music
 	}
 
-	g.initialized = true
-	return nil
-}
+	// Pause with the browser tab when running on the web
+	g.watchVisibility()
 
-// charToFontIndex converts a character to its position in the soap font bitmap
-func charToFontIndex(ch rune) (int, bool) {
-	// Font layout (6 rows of 10 characters):
-	// Row 0: ABCDEFGHIJ
-	// Row 1: KLMNOPQRST
-	// Row 2: UVWXYZ0123
-	// Row 3: 456789(),.
-	// Row 4: ![NA][NA][NA][NA][NA][NA][NA][NA][NA]
-	// Row 5: [NA][NA][NA][NA][NA][NA][NA][NA][NA][NA]
-
-	// Convert to uppercase for case-insensitive matching
-	ch = rune(byte(ch) & ^byte(0x20))
-
-	switch ch {
-	// Row 0: ABCDEFGHIJ
-	case 'A':
-		return 0, true
-	case 'B':
-		return 1, true
-	case 'C':
-		return 2, true
-	case 'D':
-		return 3, true
-	case 'E':
-		return 4, true
-	case 'F':
-		return 5, true
-	case 'G':
-		return 6, true
-	case 'H':
-		return 7, true
-	case 'I':
-		return 8, true
-	case 'J':
-		return 9, true
-	// Row 1: KLMNOPQRST
-	case 'K':
-		return 10, true
-	case 'L':
-		return 11, true
-	case 'M':
-		return 12, true
-	case 'N':
-		return 13, true
-	case 'O':
-		return 14, true
-	case 'P':
-		return 15, true
-	case 'Q':
-		return 16, true
-	case 'R':
-		return 17, true
-	case 'S':
-		return 18, true
-	case 'T':
-		return 19, true
-	// Row 2: UVWXYZ0123
-	case 'U':
-		return 20, true
-	case 'V':
-		return 21, true
-	case 'W':
-		return 22, true
-	case 'X':
-		return 23, true
-	case 'Y':
-		return 24, true
-	case 'Z':
-		return 25, true
-	case '0':
-		return 26, true
-	case '1':
-		return 27, true
-	case '2':
-		return 28, true
-	case '3':
-		return 29, true
-	// Row 3: 456789(),.
-	case '4':
-		return 30, true
-	case '5':
-		return 31, true
-	case '6':
-		return 32, true
-	case '7':
-		return 33, true
-	case '8':
-		return 34, true
-	case '9':
-		return 35, true
-	case '(':
-		return 36, true
-	case ')':
-		return 37, true
-	case ',':
-		return 38, true
-	case '.':
-		return 39, true
-	// Row 4: ![NA][NA][NA][NA][NA][NA][NA][NA][NA]
-	case '!':
-		return 40, true
-	// Treat unknown characters as spaces
-	default:
-		return -1, false
+	// Load the demo script, whose default depends on the music length
+	g.loadScript()
+
+	// Pre-analyze the tune for the timeline editor
+	g.startMusicAnalysis(musicData)
+
+	// Restore the volume, display modes and scene of the last run, or
+	// start recording from the beginning
+	if g.export != nil {
+		if err := g.export.begin(g); err != nil {
+			return err
+		}
+	} else {
+		g.applySettings(loadSettings())
+		if err := g.startLoop(); err != nil {
+			return err
+		}
 	}
+
+	g.initialized = true
+	return nil
 }
 
 // Update updates the game state
 func (g *Game) Update() error {
+	defer g.profile.measureBusy(time.Now())
+
+	// Closing the window saves the settings while the window still exists
+	if ebiten.IsWindowBeingClosed() {
+		if g.export != nil {
+			// Keep the frames recorded so far
+			if err := g.export.finish(); err != nil {
+				log.Printf("Recording: %v", err)
+			}
+			return ebiten.Termination
+		}
+		if g.initialized && g.bench == nil {
+			g.gif.finish()
+			if err := saveSettings(g.currentSettings()); err != nil {
+				log.Printf("Failed to save settings: %v", err)
+			}
+		}
+		return ebiten.Termination
+	}
+	if g.failure != nil {
+		return g.updateFailure()
+	}
 	if !g.initialized {
-		return g.Init()
+		if err := g.Init(); err != nil {
+			g.fail(err)
+		}
+		return nil
+	}
+	if g.bench != nil {
+		return g.bench.update(g)
+	}
+	if g.export != nil {
+		return g.export.update(g)
+	}
+	g.idle.watchInput()
+	g.updateFullscreen()
+	g.gif.update()
+	if g.quit.active() {
+		if err := g.updateQuit(); err != nil {
+			return err
+		}
+	}
+
+	// Nothing advances while the browser tab is hidden
+	if g.handleVisibility() {
+		g.clock.hold()
+		return nil
+	}
+
+	// The calibration screen owns the keyboard while open
+	if g.calibration != nil {
+		g.updateCalibration()
+		g.clock.hold()
+		return nil
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyC) {
+		g.startCalibration()
+		return nil
+	}
+
+	// Esc fades out and quits, unless it closes the help
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) && !g.overlays.help {
+		g.startQuit()
+	}
+	g.updateOverlays()
+
+	// Toggle the tweak console; while open it owns the arrow keys
+	if inpututil.IsKeyJustPressed(ebiten.KeyBackquote) {
+		g.console.open = !g.console.open
+	}
+	g.console.Update(g)
+
+	g.pollMusicAnalysis()
+	g.pollScrolltext()
+	g.updateDroppedTune()
+	g.checkAudio()
+
+	// Toggle the timeline editor, or reload the scrolltext with Shift;
+	// Ctrl+F5 toggles a part
+	if inpututil.IsKeyJustPressed(ebiten.KeyF5) && !ebiten.IsKeyPressed(ebiten.KeyControl) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.reloadScrolltext()
+		} else {
+			g.editor.open = !g.editor.open
+		}
+	}
+	g.editor.Update(g)
+
+	if g.console.open || g.editor.open {
+		g.handleHistoryKeys()
 	}
 
 	// Handle input for volume control
-	if g.ymPlayer != nil {
+	if g.music != nil && !g.console.open {
 		if ebiten.IsKeyPressed(ebiten.KeyUp) {
-			vol := g.ymPlayer.GetVolume() + 0.01
+			vol := g.music.GetVolume() + 0.01
 			if vol > 1.0 {
 				vol = 1.0
 			}
-			g.ymPlayer.SetVolume(vol)
+			g.music.SetVolume(vol)
 		}
 		if ebiten.IsKeyPressed(ebiten.KeyDown) {
-			vol := g.ymPlayer.GetVolume() - 0.01
+			vol := g.music.GetVolume() - 0.01
 			if vol < 0 {
 				vol = 0
 			}
-			g.ymPlayer.SetVolume(vol)
+			g.music.SetVolume(vol)
+		}
+	}
+
+	// Switch track and cycle the playlist mode
+	g.updatePlaylist()
+
+	// Skip 10 seconds back or ahead in the tune, the visuals following
+	if !g.console.open {
+		if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+			g.skipMusic(-skipStep)
+		}
+		if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+			g.skipMusic(skipStep)
 		}
 	}
 
@@ -792,222 +833,254 @@ func (g *Game) Update() error {
 		}
 	}
 
-	// Update copper bars animation
-	g.cnt = (g.cnt + 3) & 0x3ff
-	g.cnt2 = (g.cnt2 - 5) & 0x3ff
-
-	// Update logo position
-	g.logoPos += 0.05 * g.speedMultiplier
+	// Toggle between the CPU and GPU scroller paths
+	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+		g.scroller.UseGPU = !g.scroller.UseGPU
+	}
 
-	// Update ball sprites and cube rotations
-	for i := 0; i < nbCubes; i++ {
-		g.spritePos[i] += 0.04 * g.speedMultiplier
+	// Cycle the scroller style of scenes not naming one
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		log.Printf("Scroller: %s", g.scroller.CycleScroller())
+	}
 
-		// Update cube rotations
-		g.cubes[i].Rotate(
-			0.02*g.speedMultiplier*(1+float64(i)*0.1),
-			0.03*g.speedMultiplier*(1+float64(i)*0.15),
-			0.01*g.speedMultiplier*(1+float64(i)*0.05),
-		)
+	// Cycle palette emulation: full color, ST, STE
+	if inpututil.IsKeyJustPressed(ebiten.KeyP) {
+		g.setPaletteMode((g.paletteMode + 1) % 3)
 	}
 
-	// Update scroll text
-	g.scrollText.x -= scrollSpeed * g.speedMultiplier
-	// Adjusted for 2x font scale
-	textWidth := float64(len(g.scrollText.text) * g.scrollText.charWidth * 2)
-	if g.scrollText.x < -textWidth {
-		g.scrollText.x = float64(screenWidth)
+	// Gamma, brightness and contrast for dim screens and projectors
+	if !g.console.open {
+		g.handleDisplayKeys()
 	}
 
-	// Update animation counters
-	g.vbl++
-	g.offsetScr += 0.1 * g.speedMultiplier
+	// Cycle the A/B comparison mode, or the compared effect with Shift
+	if inpututil.IsKeyJustPressed(ebiten.KeyB) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.ab.pair = (g.ab.pair + 1) % len(abPairs)
+		} else {
+			g.ab.cycle()
+		}
+	}
+	if g.ab.mode == ABWipe {
+		g.ab.updateWipe(g.layout.Width)
+	}
 
-	return nil
-}
+	// Show or hide single parts to isolate layers
+	g.handleEffectKeys()
 
-// drawCopperBars draws the animated copper bars effect
-func (g *Game) drawCopperBars(screen *ebiten.Image) {
-	if g.bars == nil {
-		return
+	// Toggle the frame profiler; Ctrl+F3 toggles a part
+	if inpututil.IsKeyJustPressed(ebiten.KeyF3) && !ebiten.IsKeyPressed(ebiten.KeyControl) {
+		g.toggleProfiler()
 	}
 
-	barsWidth, barsHeight := g.bars.Size()
-	if barsHeight < 20 {
-		return
+	// Toggle the safe-area guides; Ctrl+F4 toggles a part
+	if inpututil.IsKeyJustPressed(ebiten.KeyF4) && !ebiten.IsKeyPressed(ebiten.KeyControl) {
+		g.safeGuides = !g.safeGuides
 	}
 
-	// Draw 210 copper bars (adjusted to fill the screen)
-	cc := 0
-	for i := 0; i < 300; i++ { // Increased from 210 to 300 to fill 600px height
-		// Calculate sine positions
-		val2 := (g.cnt + i*7) & 0x3ff
-		val := g.copperSin[val2]
-		val2 = (g.cnt2 + i*10) & 0x3ff
-		val += g.copperSin[val2]
-		val += 60
-
-		// Position and size
-		xPos := val >> 1
-		yPos := i << 1 // i * 2
-		height := screenHeight - yPos
-
-		if height > 0 && yPos < screenHeight {
-			op := &ebiten.DrawImageOptions{}
-
-			// Source rectangle: 2 pixels high from bars
-			srcRect := image.Rect(0, cc, barsWidth, cc+2)
-			if srcRect.Max.Y > barsHeight {
-				srcRect.Max.Y = barsHeight
-			}
-
-			// Scale to stretch the 2 pixels to fill the height
-			scaleY := float64(height) / 2.0
+	// Toggle the endless mode
+	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+		g.toggleEndless()
+	}
 
-			op.GeoM.Scale(1, scaleY)
-			op.GeoM.Translate(float64(xPos), float64(yPos))
+	// Toggle the contributed screens gallery, Shift+Tab being the music
+	// progress
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) && !ebiten.IsKeyPressed(ebiten.KeyShift) {
+		g.toggleGallery()
+	}
 
-			screen.DrawImage(g.bars.SubImage(srcRect).(*ebiten.Image), op)
-		}
+	// Cycle retro modes: off, 320x200, 320x200 with scanlines
+	if inpututil.IsKeyJustPressed(ebiten.KeyL) {
+		g.setRetroMode((g.retro + 1) % 3)
+	}
 
-		// Cycle through the bars
-		cc += 2
-		if cc >= 20 {
-			cc = 0
+	// Toggle authentic 50Hz PAL timing, or vsync with Shift
+	if inpututil.IsKeyJustPressed(ebiten.KeyV) {
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			g.setVsync(!g.refresh.vsync)
+		} else {
+			g.setPALTiming(!g.pal.enabled)
 		}
 	}
-}
 
-// drawLogo draws the animated DMA logo
-func (g *Game) drawLogo(screen *ebiten.Image) {
-	op := &ebiten.DrawImageOptions{}
-	op.GeoM.Reset()
-	xPos := (float64(screenWidth-g.wl) / 2) + (math.Sin(g.logoPos) * float64(screenWidth-g.wl) / 2)
-	op.GeoM.Translate(xPos, 0)
-	screen.DrawImage(g.logo, op)
-}
+	// Apply live script edits and settle parameter interpolations
+	if g.live != nil {
+		g.live.Poll(g.params)
+	}
+	g.params.Update(1 / float64(ebiten.TPS()))
 
-// drawCubes draws the rotating 3D cubes
-func (g *Game) drawCubes(screen *ebiten.Image) {
-	for i := 0; i < nbCubes; i++ {
-		xPos := float64((screenWidth-40)/2) + (float64((screenWidth-40)/2) * math.Sin(g.spritePos[i]))
-		yPos := 186 + (84 * math.Cos(g.spritePos[i]*2.5))
+	// Pause or resume the music and the animation together
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		g.togglePause()
+	}
+	// Hold R to rewind, even while paused
+	if g.updateRewind() {
+		return nil
+	}
+	if g.paused {
+		g.clock.hold()
+		return nil
+	}
 
-		// Draw the 3D cube
-		g.cubes[i].Draw(screen, xPos, yPos)
+	// Advance the demo by as many logic ticks as are due
+	g.updateClock()
+	g.updateLoop()
+	for n := g.ticksDue(); n > 0; n-- {
+		g.tick()
 	}
-}
+	g.warmUpScenes()
 
-// drawScrollText draws the TCB-style scrolling text with deformation
-func (g *Game) drawScrollText(screen *ebiten.Image) {
-	// Clear buffers
-	g.scrollText.workBuffer.Clear()
-	g.scrollText.deformBuffer.Clear()
-
-	// Scale factor for the font
-	const fontScale = 2.0
-	scaledCharWidth := float64(g.scrollText.charWidth) * fontScale
-
-	// Draw text to work buffer with 2x scale
-	x := g.scrollText.x
-	for _, ch := range g.scrollText.text {
-		if ch == ' ' {
-			x += scaledCharWidth
-			continue
-		}
+	return nil
+}
 
-		// Get character position in font
-		charIndex, found := charToFontIndex(ch)
-		if !found {
-			// Character not in font, treat as space
-			x += scaledCharWidth
-			continue
+// togglePause freezes or resumes both the music and the visuals
+func (g *Game) togglePause() {
+	g.paused = !g.paused
+	if g.music != nil {
+		if g.paused {
+			g.music.Pause()
+		} else {
+			g.music.Resume()
 		}
+	}
+}
 
-		row := charIndex / g.scrollText.charsPerRow
-		col := charIndex % g.scrollText.charsPerRow
-
-		sx := col * g.scrollText.charWidth
-		sy := row * g.scrollText.charHeight
-
-		if x > -scaledCharWidth && x < float64(g.scrollText.workBuffer.Bounds().Dx()) {
-			op := &ebiten.DrawImageOptions{}
-			op.GeoM.Scale(fontScale, fontScale)
-			op.GeoM.Translate(x, 0)
-
-			subImg := g.scrollText.fontImage.SubImage(
-				image.Rect(sx, sy, sx+g.scrollText.charWidth, sy+g.scrollText.charHeight),
-			).(*ebiten.Image)
-
-			g.scrollText.workBuffer.DrawImage(subImg, op)
-		}
+// tick advances all demo animations by one logic step
+func (g *Game) tick() {
+	g.updateEndless()
+	g.updateMirror()
+	g.updateZoomBlur()
 
-		x += scaledCharWidth
+	if g.gallery != nil {
+		g.gallery.Update(g.tickSeconds() * g.speedMultiplier)
+		return
 	}
 
-	// Apply deformation line by line (adjusted for 2x scale)
-	for y := 0; y < 32; y++ { // Increased from 25 to 32 for larger font
-		offsetX := g.scrollX[(g.vbl+y)%g.scrollXMod] + 64
+	g.setSpeeds()
+	g.fireSyncs()
+	g.applyKeys()
+	g.applyShots()
+	if !g.filler.Running() {
+		g.applyParams()
+	}
+	for _, p := range g.parts {
+		start := time.Now()
+		p.Update(vblSeconds)
+		g.profile.measurePart(p, start)
+	}
+}
 
-		// Draw each line with horizontal offset
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Translate(-offsetX, 0)
+// setSpeeds passes the speed control on to the parts. Every part keeps
+// moving while off screen so scenes pick up where the intro is. The
+// copper bars and the scroller deformation run at the VBL rate; the other
+// parts follow the speed control.
+func (g *Game) setSpeeds() {
+	g.logo.Speed = g.speedMultiplier
+	g.cubes.Speed = g.speedMultiplier
+	g.objects.Speed = g.speedMultiplier
+	g.stars.Speed = g.speedMultiplier
+	g.tunnel.Speed = g.speedMultiplier
+	g.balls.Speed = g.speedMultiplier
+	g.falls.Speed = g.speedMultiplier
+	g.march.Speed = g.speedMultiplier
+	g.scroller.Speed = g.speedMultiplier
+}
 
-		srcRect := image.Rect(int(offsetX), y*2, int(offsetX)+screenWidth, (y+1)*2)
-		if srcRect.Min.X < 0 {
-			srcRect.Min.X = 0
-		}
-		if srcRect.Max.X > g.scrollText.workBuffer.Bounds().Dx() {
-			srcRect.Max.X = g.scrollText.workBuffer.Bounds().Dx()
+// Draw draws the entire demo
+func (g *Game) Draw(screen *ebiten.Image) {
+	if g.bench != nil {
+		if g.initialized {
+			g.bench.draw(g, screen)
 		}
-
-		subImg := g.scrollText.workBuffer.SubImage(srcRect).(*ebiten.Image)
-
-		dstOp := &ebiten.DrawImageOptions{}
-		dstOp.GeoM.Translate(0, float64(y*2))
-		g.scrollText.deformBuffer.DrawImage(subImg, dstOp)
+		return
+	}
+	g.refresh.frame()
+	defer g.profile.endFrame(time.Now())
+	if g.failure != nil {
+		g.drawFailure(screen)
+		return
+	}
+	if !g.initialized {
+		return
+	}
+	if g.calibration != nil {
+		g.calibration.Draw(screen)
+		return
+	}
+	if g.keepFrame(screen) {
+		return
 	}
 
-	// Draw deformed scroll with vertical wave
-	for x := 0; x < 50; x++ { // Adjusted for 800px width
-		yOffset := 35 + math.Cos(g.offsetScr+float64(x)*0.1)*35
-
-		op := &ebiten.DrawImageOptions{}
-		op.GeoM.Translate(float64(x*16), float64(screenHeight-140)+yOffset) // Adjusted Y position for larger text
-
-		subImg := g.scrollText.deformBuffer.SubImage(
-			image.Rect(x*16, 0, (x+1)*16, scrollHeight),
-		).(*ebiten.Image)
+	// In retro mode the frame is rendered at low resolution, then upscaled
+	out := screen
+	if g.retro != RetroOff {
+		out = g.retroFrame
+	}
 
-		screen.DrawImage(subImg, op)
+	// Render into an offscreen frame when post effects are active
+	target := out
+	if g.post.Active() {
+		target = g.frame
+	}
+	if g.ab.mode != ABOff && g.gallery == nil {
+		g.drawCompared(target)
+	} else {
+		g.drawDemo(target)
 	}
-}
 
-// Draw draws the entire demo
-func (g *Game) Draw(screen *ebiten.Image) {
-	if !g.initialized {
+	if target != out {
+		start := time.Now()
+		g.post.Apply(out, target)
+		g.profile.measure(profilePost, start)
+	}
+	if out != screen {
+		start := time.Now()
+		g.presentRetro(screen, out)
+		g.profile.measure(profileRetro, start)
+	}
+	g.gif.capture(screen)
+	if g.export != nil {
+		g.export.capture(screen)
 		return
 	}
 
+	// Dev overlays are drawn last, at full resolution
+	start := time.Now()
+	g.editor.Draw(screen, g)
+	g.console.Draw(screen, g.params)
+	g.watchdog.Draw(screen)
+	g.drawDisplayNote(screen)
+	g.drawRefreshWarning(screen)
+	g.drawProfiler(screen)
+	g.drawSafeGuides(screen)
+	g.drawOverlays(screen)
+	g.drawToast(screen)
+	g.gif.draw(screen)
+	g.profile.measure(profileUI, start)
+	g.drawQuitFade(screen)
+}
+
+// drawDemo draws all the demo effects onto screen
+func (g *Game) drawDemo(screen *ebiten.Image) {
 	// Clear screen with black background
 	screen.Fill(color.Black)
 
-	// Draw copper bars first (background)
-	g.drawCopperBars(screen)
-
-	// Draw logo on top
-	g.drawLogo(screen)
-
-	// Draw cubes
-	g.drawCubes(screen)
+	if g.gallery != nil {
+		g.gallery.Draw(screen)
+		return
+	}
 
-	// Draw scrolling text with its deformation effect
-	g.drawScrollText(screen)
+	// Show the parts scheduled by the demo script
+	g.drawScenes(screen)
 }
 
 // Layout returns the game's logical screen size
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return screenWidth, screenHeight
+	// Retro mode upscales by itself, so it draws at the window size
+	if g.retro != RetroOff {
+		return outsideWidth, outsideHeight
+	}
+	return g.layout.Width, g.layout.Height
 }
 
 // Cleanup cleans up resources
@@ -1015,17 +1088,246 @@ func (g *Game) Cleanup() {
 	if g.audioPlayer != nil {
 		g.audioPlayer.Close()
 	}
-	if g.ymPlayer != nil {
-		g.ymPlayer.Close()
+	if g.music != nil {
+		g.music.Close()
 	}
 }
 
 func main() {
-	ebiten.SetWindowSize(screenWidth, screenHeight)
-	ebiten.SetWindowTitle("Bilizir from DMA - the Weird intro")
+	livePath := flag.String("live", "", "effect script to watch and apply live while the demo runs")
+	scriptPath := flag.String("script", "demo.script", "demo script edited by the timeline editor")
+	includePath := flag.String("export-include", "", "write the sine tables, copper palette and timing constants to this file, a C header when it ends in .h, else 68000 assembler, and exit")
+	loopSpec := flag.String("loop", "", "play a region of the timeline over and over, to polish a part: the name of a scene of the demo script, or in-out seconds like 12.5-30")
+	suggestPath := flag.String("suggest", "", "write a demo script suggested from the music structure to this path and exit")
+	packPath := flag.String("export-pack", "", "bundle the demo and its configuration into this folder (or .zip) and exit")
+	packInclude := flag.String("pack-include", "", "comma-separated extra files to add to the pack's assets folder")
+	showVersion := flag.Bool("version", false, "print the build version and exit")
+	vsync := flag.Bool("vsync", true, "synchronize frames with the display refresh; when off an internal limiter paces them")
+	fpsLimit := flag.Float64("fps", 0, "frame rate of the limiter used without vsync (default: the detected refresh rate, else 60)")
+	verifyPath := flag.String("verify-scroller", "", "compare the scroller math against this reference trace (created when missing) and exit")
+	verifyFrames := flag.Int("verify-frames", 300, "number of frames traced by -verify-scroller")
+	musicPath := flag.String("music", "", "tune to play instead of the embedded one (YM, SNDH, MOD, S3M, XM, AHX or HVL)")
+	playlistSpec := flag.String("playlist", "", "comma-separated tunes, or folders of tunes, played after the main one and the embedded playlist, switched with PgUp/PgDn")
+	playlistMode := flag.String("playlist-mode", "all", "what the playlist plays as a track ends: one (the same again), all (the next) or shuffle (another at random)")
+	dumpPath := flag.String("dump-music", "", "render the tune into this WAV file, 44.1kHz 16-bit stereo at the demo's volume, and exit")
+	dumpLoops := flag.Int("dump-loops", 1, "times -dump-music plays the tune, looping from its loop point")
+	recordDir := flag.String("record", "", "render the demo offline into this folder as numbered PNG frames and a WAV of the tune, then exit")
+	recordFPS := flag.Int("record-fps", 60, "frame rate of -record")
+	recordSeconds := flag.Float64("record-seconds", 0, "length rendered by -record (default: the demo script, else the tune)")
+	cardDir := flag.String("card", "", "render a web demo card into this folder, a page with a looping GIF of the demo and its credits, then exit")
+	cardStart := flag.String("card-start", "", "where the clip of -card starts: seconds into the demo, or the name of a scene of the demo script")
+	cardSeconds := flag.Float64("card-seconds", 10, "length of the clip of -card")
+	cardWidth := flag.Int("card-width", 480, "width of the clip of -card in pixels")
+	cardTitle := flag.String("card-title", "Bilizir", "title of the demo on the card")
+	cardGroup := flag.String("card-group", "DMA", "group credited on the card")
+	posterDir := flag.String("poster", "", "render a PNG of each scene of the demo script at its midpoint into this folder, then exit")
+	benchCubes := flag.Int("bench-cubes", 0, "time the per-face and batched cube paths with this many cubes, then exit")
+	scrolltext := flag.String("scrolltext", "", "file or http(s) URL to read the scroll message from, reloaded with Shift+F5")
+	fonts := flag.String("fonts", "", "comma-separated font descriptors the scrolltext switches to with ^F2, ^F3 and on")
+	fallbackFonts := flag.String("fallback-fonts", "", "comma-separated TrueType or OpenType fonts drawing the characters the bitmap fonts lack, tried in order before the built-in Go Bold")
+	copperColors := flag.String("copper-colors", "image", "copper bar colors: image (bars.png), or st, ste or full for gradients generated in that palette")
+	width := flag.Int("width", screenWidth, "width of the rendered frame in pixels")
+	height := flag.Int("height", screenHeight, "height of the rendered frame in pixels")
+	scale := flag.Float64("scale", 1, "size of the window as a multiple of the frame size")
+	fullscreen := flag.Bool("fullscreen", false, "start fullscreen, whatever the saved setting")
+	endless := flag.Bool("endless", false, "once the demo script has played, compose new scenes at random for as long as the demo runs")
+	gifDir := flag.String("gif-dir", ".", "folder the GIF recordings started with F9 are written to")
+	gifFPS := flag.Float64("gif-fps", 25, "frame rate of the GIF recordings")
+	gifScale := flag.Float64("gif-scale", 0.5, "size of the GIF recordings as a fraction of the frame size")
+	gifSeconds := flag.Float64("gif-seconds", 10, "length GIF recordings stop at by themselves; 0 records until F9 is pressed again")
+	safeArea := flag.Float64("safe-area", 0, "percentage of the width and height on each side the logo, scroller and panels keep clear of, for projectors cropping the edges (up to 20)")
+	stereo := flag.String("stereo", "abc", "placement of the three voices of YM tunes: abc (A left, B center, C right), acb (A left, C center, B right) or mono")
+	stereoWidth := flag.Float64("stereo-width", 0.5, "how far toward the sides -stereo pans the side voices, from 0 (center) to 1 (hard left and right)")
+	audioFilter := flag.String("audio-filter", "raw", "filter chain of YM tunes: raw (the chip as emulated), st-speaker (the monitor speaker of the ST) or mega-bass")
+	mute := flag.Bool("mute", false, "start with the music muted; the saved volume is kept")
+	configPath := flag.String("config", defaultConfigPath, "TOML (or .json) file setting the message, music, fonts, speeds, volume, parameters and colors")
+	flag.Parse()
+
+	// The configuration fills in the flags not given
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	config, err := loadConfig(*configPath, set["config"])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config != nil {
+		config.fillFlags(set, musicPath, scrolltext, fonts, fallbackFonts, copperColors, stereo, audioFilter)
+		if config.StereoWide != nil && !set["stereo-width"] {
+			*stereoWidth = *config.StereoWide
+		}
+	}
+
+	if *showVersion {
+		fmt.Println(buildinfo.Get())
+		return
+	}
+
+	if *verifyPath != "" {
+		if err := verifyScroller(*verifyPath, *verifyFrames); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *musicPath != "" {
+		data, err := os.ReadFile(*musicPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		musicData = data
+	}
+
+	if ymPan, err = stereoPan(*stereo, *stereoWidth); err != nil {
+		log.Fatal(err)
+	}
+	if ymFilter, err = audioFilterPreset(*audioFilter); err != nil {
+		log.Fatal(err)
+	}
+
+	if *dumpPath != "" {
+		if *dumpLoops < 1 {
+			log.Fatal("The tune must be dumped at least once")
+		}
+		volume := loadSettings().Volume
+		if config != nil && config.Volume != nil {
+			volume = min(max(*config.Volume, 0), 1)
+		}
+		if err := dumpMusic(*dumpPath, musicData, *dumpLoops, volume); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *packPath != "" {
+		opts := packOptions{scriptPath: *scriptPath, livePath: *livePath}
+		if *packInclude != "" {
+			opts.include = strings.Split(*packInclude, ",")
+		}
+		if err := exportPack(*packPath, opts); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *suggestPath != "" {
+		if err := writeSuggestedScript(*suggestPath); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *width < minScreenWidth || *height < minScreenHeight {
+		log.Fatalf("The frame must be at least %dx%d pixels", minScreenWidth, minScreenHeight)
+	}
+	if *scale <= 0 {
+		log.Fatal("The window scale must be positive")
+	}
+	if *safeArea < 0 || *safeArea > maxSafeInset*100 {
+		log.Fatalf("The safe area must be between 0 and %.0f%%", maxSafeInset*100)
+	}
+	if *gifFPS <= 0 || *gifFPS > 100 {
+		log.Fatal("The GIF frame rate must be above 0 and at most 100")
+	}
+	if *gifScale <= 0 || *gifScale > 1 {
+		log.Fatal("The GIF scale must be above 0 and at most 1")
+	}
+	if *gifSeconds < 0 {
+		log.Fatal("The GIF length cannot be negative")
+	}
+	screenWidth, screenHeight = *width, *height
+
+	ebiten.SetWindowSize(int(float64(screenWidth)**scale), int(float64(screenHeight)**scale))
+	ebiten.SetWindowTitle("Bilizir from DMA - the Weird intro (" + buildinfo.Get().Short() + ")")
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetWindowClosingHandled(true)
+	ebiten.SetScreenClearedEveryFrame(false)
 
 	game := NewGame()
+	game.scriptPath = *scriptPath
+	if game.playlist, err = playlistEntries(*playlistSpec); err != nil {
+		log.Fatal(err)
+	}
+	if game.playlistMode, err = parsePlaylistMode(*playlistMode); err != nil {
+		log.Fatal(err)
+	}
+	game.loop.spec = *loopSpec
+	game.launch = launchOptions{fullscreen: *fullscreen, mute: *mute}
+	game.refresh.limit = *fpsLimit
+	game.gif = gifRecorder{dir: *gifDir, fps: *gifFPS, scale: *gifScale, length: time.Duration(*gifSeconds * float64(time.Second))}
+	game.setVsync(*vsync)
+	if config != nil {
+		if err := config.apply(game); err != nil {
+			log.Fatalf("%s: %v", *configPath, err)
+		}
+	}
+	if set["safe-area"] {
+		game.safeInset = *safeArea / 100
+	}
+	if err := game.setCopperColors(*copperColors); err != nil {
+		log.Fatal(err)
+	}
+	if *fonts != "" {
+		if err := game.loadFonts(strings.Split(*fonts, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *fallbackFonts != "" {
+		if err := game.loadFallbackFonts(strings.Split(*fallbackFonts, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *scrolltext != "" {
+		if err := game.loadScrolltext(*scrolltext); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *includePath != "" {
+		if err := game.exportInclude(*includePath); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *endless {
+		game.filler = NewScreenFiller()
+	}
+	if *benchCubes > 0 {
+		game.startCubeBench(*benchCubes)
+	}
+	exports := 0
+	for _, dir := range []string{*recordDir, *cardDir, *posterDir} {
+		if dir != "" {
+			exports++
+		}
+	}
+	if exports > 1 {
+		log.Fatal("Only one of -record, -card and -poster can be used at a time")
+	}
+	if *recordDir != "" {
+		if *recordFPS <= 0 || *recordSeconds < 0 {
+			log.Fatal("The recording frame rate must be positive and its length cannot be negative")
+		}
+		if err := game.startExport(&videoExport{dir: *recordDir, fps: *recordFPS, seconds: *recordSeconds, out: &frameExport{}}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *cardDir != "" {
+		if *cardSeconds <= 0 || *cardWidth <= 0 {
+			log.Fatal("The length and the width of the demo card clip must be positive")
+		}
+		card := &demoCard{title: *cardTitle, group: *cardGroup}
+		export := &videoExport{dir: *cardDir, fps: cardFPS, seconds: *cardSeconds, from: *cardStart, width: *cardWidth, out: card}
+		if err := game.startExport(export); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *posterDir != "" {
+		if err := game.startExport(&videoExport{dir: *posterDir, fps: posterFPS, out: &posterExport{}}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *livePath != "" {
+		game.live = NewLiveScript(*livePath)
+	}
 
 	// Ensure cleanup on exit
 	defer game.Cleanup()
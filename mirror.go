@@ -0,0 +1,44 @@
+package main
+
+import (
+	_ "embed"
+)
+
+//go:embed shaders/mirror.kage
+var mirrorShaderSrc []byte
+
+// initMirrorPass registers the mirror and kaleidoscope pass, first on the
+// post chain so the palette and display passes apply to the folded frame
+func (g *Game) initMirrorPass() error {
+	pass, err := g.post.Add("mirror", mirrorShaderSrc, func() map[string]any {
+		t := g.clock.elapsed.Seconds()
+		return map[string]any{
+			"Segments": float32(g.mirror),
+			"Axis":     float32(g.params.Get("mirror.axis")),
+			"Sway":     float32(g.params.Get("mirror.sway")),
+			"Phase":    float32(t * 2),
+			"Angle":    float32(t * g.params.Get("mirror.spin")),
+		}
+	})
+	if err != nil {
+		return err
+	}
+	g.mirrorPass = pass
+	return nil
+}
+
+// updateMirror folds the frame as the most visible scene playing asks
+func (g *Game) updateMirror() {
+	g.mirror = 0
+	if g.gallery == nil {
+		alpha := 0.0
+		for _, cue := range g.cues() {
+			if cue.Scene.Mirror > 0 && cue.Alpha > alpha {
+				g.mirror, alpha = cue.Scene.Mirror, cue.Alpha
+			}
+		}
+	}
+	if g.mirrorPass != nil {
+		g.mirrorPass.Enabled = g.mirror > 0
+	}
+}
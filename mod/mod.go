@@ -0,0 +1,321 @@
+// Package mod loads and plays tracker modules: Amiga ProTracker MODs,
+// with 4 to 32 channels, Scream Tracker 3 S3Ms and FastTracker 2 XMs.
+// The three formats load into the same Module, their effects translated
+// to the XM set, and share the replay and the mixer.
+package mod
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerSize = 1084
+	numSamples = 31
+	numRows    = 64 // Rows of MOD and S3M patterns
+)
+
+// ErrFormat is returned for data that is not a module
+var ErrFormat = errors.New("mod: not a MOD, S3M or XM module")
+
+// Format is the tracker a module was written with
+type Format int
+
+const (
+	FormatMOD Format = iota // ProTracker and compatibles
+	FormatS3M               // Scream Tracker 3
+	FormatXM                // FastTracker 2
+)
+
+// String returns the file extension of the format, in capitals
+func (f Format) String() string {
+	return [...]string{"MOD", "S3M", "XM"}[f]
+}
+
+// signatures are the format tags stored at offset 1080 of MODs, with
+// their channel count; "xCHN" and "xxCH" tags give it too
+var signatures = map[string]int{"M.K.": 4, "M!K!": 4, "FLT4": 4, "4CHN": 4, "FLT8": 8, "OCTA": 8, "CD81": 8}
+
+// KeyOff is the key of the notes releasing the instrument: the key off
+// of XM, the note cut of S3M
+const KeyOff = 97
+
+// Sample is a waveform of an instrument, 8-bit data scaled to 16 bits
+type Sample struct {
+	Name      string
+	Data      []int16
+	Volume    int // 0 to 64
+	Pan       int // 0 left to 255 right, -1 to keep the panning of the channel
+	Finetune  int // In 128ths of a semitone
+	RelNote   int // Semitones added to the keys played
+	C2Spd     int // Rate middle C plays at, 8363 Hz when zero
+	Loop      bool
+	PingPong  bool // The loop plays forwards then backwards
+	LoopStart int  // In samples
+	LoopLen   int  // In samples
+}
+
+// looped reports whether the sample repeats its loop section
+func (s *Sample) looped() bool {
+	return s.Loop && s.LoopLen > 0 && s.LoopStart+s.LoopLen <= len(s.Data)
+}
+
+// Envelope shapes the volume or panning of an instrument over the ticks
+// after its note starts, from 0 to 64
+type Envelope struct {
+	Points    []EnvelopePoint
+	On        bool
+	SustainOn bool // Holds at the sustain point until the key is released
+	LoopOn    bool
+	Sustain   int // Point indexes
+	LoopStart int
+	LoopEnd   int
+}
+
+// EnvelopePoint is a point of an envelope
+type EnvelopePoint struct {
+	Tick  int
+	Value int
+}
+
+// Instrument is what the notes play: a sample, or with XM several spread
+// over the keys, with envelopes
+type Instrument struct {
+	Name    string
+	Samples []Sample
+	Keymap  [96]uint8 // Sample of each key, XM
+	Volume  Envelope
+	Panning Envelope
+	Fadeout int // Volume lost per tick after the key is released, out of 65536
+}
+
+// sample returns the sample an instrument plays a key with, nil for none
+func (ins *Instrument) sample(key int) *Sample {
+	i := 0
+	if key >= 1 && key <= len(ins.Keymap) {
+		i = int(ins.Keymap[key-1])
+	}
+	if i >= len(ins.Samples) {
+		return nil
+	}
+	return &ins.Samples[i]
+}
+
+// Note is one channel of one pattern row. Effects are numbered as in XM:
+// 0x0 to 0xf as in ProTracker, then G (0x10) for A to Z.
+type Note struct {
+	Period     int // MOD: Amiga period, 0 for no note
+	Key        int // S3M and XM: semitone from C-0, plus one, 0 for no note, or KeyOff
+	Instrument int // From 1, 0 for none
+	Volume     int // Volume column, coded as in XM, 0 for none
+	Effect     byte
+	Param      byte
+}
+
+// hasNote reports whether the note starts one
+func (n Note) hasNote() bool {
+	return n.Period > 0 || n.Key > 0 && n.Key < KeyOff
+}
+
+// XM effects beyond the ProTracker set, and the S3M ones translated to
+// them
+const (
+	effectGlobalVolume      = 0x10 // Gxx
+	effectGlobalVolumeSlide = 0x11 // Hxy
+	effectKeyOff            = 0x14 // Kxx
+	effectPanSlide          = 0x19 // Pxy
+	effectRetrigger         = 0x1b // Rxy, retrigger with a volume change
+	effectTremor            = 0x1d // Txy
+	effectExtraFine         = 0x21 // X1y up and X2y down
+
+	// Not in XM: the speed and the tempo apart, as S3M sets them, and
+	// the fine vibrato of S3M
+	effectSpeed       = 0x24
+	effectTempo       = 0x25
+	effectFineVibrato = 0x26
+)
+
+// Module is a parsed tracker module
+type Module struct {
+	Format      Format
+	Title       string
+	Channels    int
+	Instruments []Instrument
+	Orders      []int // Pattern played at each song position
+	Restart     int   // Song position played after the last one
+	Patterns    [][]Note
+
+	Linear       bool  // XM linear frequencies, instead of Amiga periods
+	Speed        int   // Ticks per row at the start
+	Tempo        int   // BPM at the start
+	GlobalVolume int   // 0 to 64 at the start
+	Pan          []int // Panning of each channel at the start, 0 to 255
+}
+
+// Is reports whether data looks like a module
+func Is(data []byte) bool {
+	return isXM(data) || isS3M(data) || modChannels(data) > 0
+}
+
+// Parse decodes a module of any of the formats
+func Parse(data []byte) (*Module, error) {
+	switch {
+	case isXM(data):
+		return parseXM(data)
+	case isS3M(data):
+		return parseS3M(data)
+	}
+	return parseMOD(data)
+}
+
+// modChannels returns the channel count of a MOD from its format tag, 0
+// when data is not one
+func modChannels(data []byte) int {
+	if len(data) < headerSize {
+		return 0
+	}
+	sig := string(data[1080:1084])
+	if n, ok := signatures[sig]; ok {
+		return n
+	}
+	var digits string
+	switch {
+	case strings.HasSuffix(sig, "CHN"):
+		digits = sig[:1]
+	case strings.HasSuffix(sig, "CH"):
+		digits = sig[:2]
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 || n > 32 {
+		return 0
+	}
+	return n
+}
+
+// parseMOD decodes a ProTracker module. Truncated sample data is
+// tolerated, as many modules in the wild are cut short.
+func parseMOD(data []byte) (*Module, error) {
+	channels := modChannels(data)
+	if channels == 0 {
+		return nil, ErrFormat
+	}
+
+	m := &Module{
+		Format:       FormatMOD,
+		Title:        cString(data[:20]),
+		Channels:     channels,
+		Instruments:  make([]Instrument, numSamples),
+		Speed:        defaultSpeed,
+		Tempo:        defaultTempo,
+		GlobalVolume: 64,
+	}
+	for i := range channels {
+		// The Amiga LRRL layout, softened so each side keeps a quarter of
+		// the opposite channels, as on headphones it is harsh
+		m.Pan = append(m.Pan, [4]int{64, 191, 191, 64}[i%4])
+	}
+
+	for i := range m.Instruments {
+		h := data[20+i*30:]
+		loopLen := word(h[28:]) * 2
+		m.Instruments[i] = Instrument{
+			Name: cString(h[:22]),
+			Samples: []Sample{{
+				Name:      cString(h[:22]),
+				Data:      make([]int16, word(h[22:])*2),
+				Finetune:  int(int8(h[24]<<4)>>4) * 16,
+				Volume:    min(int(h[25]), 64),
+				Pan:       -1,
+				Loop:      loopLen > 2,
+				LoopStart: word(h[26:]) * 2,
+				LoopLen:   loopLen,
+			}},
+		}
+	}
+
+	songLen := int(data[950])
+	if songLen == 0 || songLen > 128 {
+		return nil, errors.New("mod: invalid song length")
+	}
+	numPatterns := 0
+	for i := 0; i < 128; i++ {
+		numPatterns = max(numPatterns, int(data[952+i])+1)
+	}
+	for i := 0; i < songLen; i++ {
+		m.Orders = append(m.Orders, int(data[952+i]))
+	}
+	if m.Restart = int(data[951]); m.Restart >= songLen {
+		m.Restart = 0
+	}
+
+	pos := headerSize
+	patternSize := numRows * channels * 4
+	if pos+numPatterns*patternSize > len(data) {
+		return nil, errors.New("mod: truncated pattern data")
+	}
+	for p := 0; p < numPatterns; p++ {
+		notes := make([]Note, numRows*channels)
+		for i := range notes {
+			b := data[pos+i*4:]
+			notes[i] = Note{
+				Period:     int(b[0]&0x0f)<<8 | int(b[1]),
+				Instrument: int(b[0]&0xf0) | int(b[2]>>4),
+				Effect:     b[2] & 0x0f,
+				Param:      b[3],
+			}
+		}
+		m.Patterns = append(m.Patterns, notes)
+		pos += patternSize
+	}
+
+	for i := range m.Instruments {
+		s := &m.Instruments[i].Samples[0]
+		n := min(len(s.Data), max(len(data)-pos, 0))
+		for j := 0; j < n; j++ {
+			s.Data[j] = int16(int8(data[pos+j])) << 8
+		}
+		s.Data = s.Data[:n]
+		pos += n
+	}
+	return m, nil
+}
+
+// rows returns the number of rows of a pattern
+func (m *Module) rows(pattern int) int {
+	if pattern >= len(m.Patterns) {
+		return numRows
+	}
+	return len(m.Patterns[pattern]) / m.Channels
+}
+
+// note returns the note of a channel at a song position and row
+func (m *Module) note(order, row, ch int) Note {
+	pattern := m.Orders[order]
+	if pattern >= len(m.Patterns) || row >= m.rows(pattern) {
+		return Note{}
+	}
+	return m.Patterns[pattern][row*m.Channels+ch]
+}
+
+// word reads a big-endian 16-bit value
+func word(b []byte) int {
+	return int(b[0])<<8 | int(b[1])
+}
+
+// le16 and le32 read little-endian values, as S3M and XM store them
+func le16(b []byte) int {
+	return int(b[0]) | int(b[1])<<8
+}
+
+func le32(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16 | int(b[3])<<24
+}
+
+// cString returns the text of a NUL padded field
+func cString(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimRight(string(b), " ")
+}
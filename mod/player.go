@@ -0,0 +1,925 @@
+package mod
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Periods are kept in quarters of Amiga periods, the units of S3M and of
+// the Amiga mode of XM, or in the linear units of XM. Either way a
+// portamento of one moves them by four.
+const (
+	paulaClock   = 3546894.6 // PAL Paula clock, in Amiga periods per second
+	amigaClock   = 14317456  // Rate of S3M and XM samples at period 1, 8363 x 1712
+	minPeriod    = 113       // ProTracker limits, in Amiga periods
+	maxPeriod    = 856
+	linearPeriod = 7680 // Linear period of C-0
+	defaultSpeed = 6    // Ticks per row
+	defaultTempo = 125  // BPM, a tick lasts 2.5/tempo seconds
+	defaultC2Spd = 8363 // Rate middle C is sampled at
+	maxDuration  = 30 * time.Minute
+
+	// gain scales four mixed channels to the 16-bit range. More channels
+	// are scaled down by the square root of their count, as they seldom
+	// peak together.
+	gain = 0.5
+)
+
+// vibratoTable is the ProTracker sine table, half a period
+var vibratoTable = [32]int{
+	0, 24, 49, 74, 97, 120, 141, 161, 180, 197, 212, 224, 235, 244, 250, 253,
+	255, 253, 250, 244, 235, 224, 212, 197, 180, 161, 141, 120, 97, 74, 49, 24,
+}
+
+// channel is the state of one voice
+type channel struct {
+	ins       *Instrument
+	sample    *Sample
+	pos       float64 // Position in the sample, in samples
+	step      float64 // Samples advanced per output sample
+	backwards bool    // Going back through a ping-pong loop
+	playing   bool
+	note      Note // Note of the current row
+	param     byte // Parameter of its effect, recalled from memory
+	period    int  // Period before vibrato and arpeggio
+	volume    int  // Volume before tremolo
+	finetune  int
+	pan       int // 0 left to 255 right
+
+	// The key is held until a key off, then the volume fades out
+	keyOn   bool
+	fadeout int // Out of 65536
+	volTick int // Envelope positions
+	panTick int
+
+	// Output of the last tick, with vibrato, arpeggio, tremolo and the
+	// envelopes
+	outPeriod int
+	outVolume float64 // 0 to 1
+	outPan    float64 // 0 left to 1 right
+
+	// Effect memories
+	memory                                 [effectFineVibrato + 1]byte
+	portaTarget, portaSpeed                int
+	vibratoSpeed, vibratoDepth, vibratoPos int
+	tremoloSpeed, tremoloDepth, tremoloPos int
+	tremorPos, retriggerTicks              int
+	tremorOff                              bool
+	offset                                 int
+	loopRow, loopCount                     int
+}
+
+// Player renders a module as 16-bit samples
+type Player struct {
+	Module *Module
+
+	rate         int
+	gain         float64
+	ch           []channel
+	speed        int
+	tempo        int
+	globalVolume int
+	order        int
+	row          int
+	tick         int
+	tickLeft     float64 // Samples left in the current tick
+
+	// Row changes requested by effects of the current row
+	nextOrder, nextRow int
+	loopTo             int
+	delay              int // Rows the current row is held for (EEx)
+	delaying           bool
+	entered            bool // A pattern was entered, until measure notes it
+
+	duration time.Duration
+	rows     []RowTime
+	scratch  []int16
+}
+
+// RowTime is a row played in one pass through the song, and when it
+// starts
+type RowTime struct {
+	Time    time.Duration
+	Order   int  // Song position
+	Pattern int  // Pattern played at the song position
+	Row     int  // Row in the pattern
+	Start   bool // The first row played of the pattern at this position
+
+	// Instruments of the notes the row starts, numbered from 1, each
+	// once. Tone portamentos glide to their note instead of starting it.
+	Instruments []int
+}
+
+// NewPlayer parses a module and prepares it to play from the start
+func NewPlayer(data []byte, sampleRate int) (*Player, error) {
+	m, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	p := &Player{Module: m, rate: sampleRate}
+	p.gain = gain * math.Sqrt(4/float64(m.Channels))
+	p.duration, p.rows = measure(m)
+	p.Reset()
+	return p, nil
+}
+
+// Reset rewinds to the start of the song
+func (p *Player) Reset() {
+	m := p.Module
+	p.ch = make([]channel, m.Channels)
+	for i := range p.ch {
+		p.ch[i].pan = m.Pan[i]
+	}
+	p.speed, p.tempo, p.globalVolume = m.Speed, m.Tempo, m.GlobalVolume
+	p.order, p.row, p.tick = 0, 0, 0
+	p.tickLeft = 0
+	p.nextOrder, p.nextRow, p.loopTo = -1, 0, -1
+	p.delay, p.delaying = 0, false
+}
+
+// Duration returns the length of one pass through the song, up to where
+// it loops
+func (p *Player) Duration() time.Duration {
+	return p.duration
+}
+
+// Position returns the song position and the row of the pattern being
+// played
+func (p *Player) Position() (order, row int) {
+	return p.order, p.row
+}
+
+// Rows returns the rows of one pass through the song, in playing order.
+// The slice is shared and must not be modified.
+func (p *Player) Rows() []RowTime {
+	return p.rows
+}
+
+// Render fills buf with interleaved stereo samples. The song loops.
+func (p *Player) Render(buf []int16) {
+	for i := 0; i+1 < len(buf); i += 2 {
+		if p.tickLeft <= 0 {
+			p.processTick()
+			p.tickLeft += float64(p.rate) * 2.5 / float64(p.tempo)
+		}
+		p.tickLeft--
+
+		l, r := p.mix()
+		buf[i], buf[i+1] = clip(l), clip(r)
+	}
+}
+
+// Compute renders n mono samples into buf, for offline analysis
+func (p *Player) Compute(buf []int16, n int) bool {
+	if len(p.scratch) < n*2 {
+		p.scratch = make([]int16, n*2)
+	}
+	p.Render(p.scratch[:n*2])
+	for i := 0; i < n; i++ {
+		buf[i] = int16((int(p.scratch[i*2]) + int(p.scratch[i*2+1])) / 2)
+	}
+	return true
+}
+
+// Skip advances playback by d without returning the samples
+func (p *Player) Skip(d time.Duration) {
+	frames := int(d.Seconds() * float64(p.rate))
+	if len(p.scratch) < 8192 {
+		p.scratch = make([]int16, 8192)
+	}
+	for frames > 0 {
+		n := min(frames, len(p.scratch)/2)
+		p.Render(p.scratch[:n*2])
+		frames -= n
+	}
+}
+
+// mix returns the next stereo sample of the voices
+func (p *Player) mix() (l, r float64) {
+	for i := range p.ch {
+		c := &p.ch[i]
+		if !c.playing || c.outPeriod <= 0 {
+			continue
+		}
+		s := c.sample
+		if c.pos < 0 || int(c.pos) >= len(s.Data) {
+			c.playing = false
+			continue
+		}
+
+		v := float64(s.Data[int(c.pos)]) * c.outVolume
+		l += v * (1 - c.outPan)
+		r += v * c.outPan
+		c.advance()
+	}
+	return l * p.gain, r * p.gain
+}
+
+// advance moves a voice through its sample by one output sample, around
+// its loop
+func (c *channel) advance() {
+	s := c.sample
+	if c.backwards {
+		c.pos -= c.step
+	} else {
+		c.pos += c.step
+	}
+	if !s.looped() {
+		return
+	}
+	start, end := float64(s.LoopStart), float64(s.LoopStart+s.LoopLen)
+	if !s.PingPong {
+		for c.pos >= end {
+			c.pos -= float64(s.LoopLen)
+		}
+		return
+	}
+	for c.pos >= end || c.backwards && c.pos < start {
+		if c.pos >= end {
+			c.pos, c.backwards = 2*end-1-c.pos, true
+		} else {
+			c.pos, c.backwards = 2*start-c.pos, false
+		}
+	}
+}
+
+// processTick runs the replay for one tick: notes on the first tick of a
+// row, continuous effects on the others
+func (p *Player) processTick() {
+	if p.tick == 0 && !p.delaying {
+		p.playRow()
+	} else {
+		for i := range p.ch {
+			p.updateEffects(&p.ch[i])
+		}
+	}
+
+	p.tick++
+	if p.tick >= p.speed {
+		p.tick = 0
+		if p.delay > 0 {
+			p.delay--
+			p.delaying = true
+			return
+		}
+		p.delaying = false
+		p.nextPosition()
+	}
+}
+
+// playRow starts the notes of the current row and its row effects
+func (p *Player) playRow() {
+	m := p.Module
+	for i := range p.ch {
+		c := &p.ch[i]
+		n := m.note(p.order, p.row, i)
+		c.note = n
+		c.param = p.recall(c)
+
+		switch {
+		case n.Key == KeyOff:
+			c.keyOff()
+		case n.Instrument > 0:
+			p.selectInstrument(c, n)
+		}
+		if n.Effect == 0xe && n.Param>>4 == 0x5 {
+			c.finetune = p.finetune(int(n.Param & 0x0f))
+		}
+		if n.hasNote() && !(n.Effect == 0xe && n.Param>>4 == 0xd) {
+			p.trigger(c)
+		}
+
+		if n.Effect != effectTremor {
+			c.tremorOff = false
+		}
+		p.volumeColumn(c, true)
+		p.rowEffect(c)
+		p.output(c, 0, 0)
+	}
+}
+
+// selectInstrument takes the instrument of a note, and the volume and
+// panning of the sample it plays the note with
+func (p *Player) selectInstrument(c *channel, n Note) {
+	if n.Instrument > len(p.Module.Instruments) {
+		return
+	}
+	c.ins = &p.Module.Instruments[n.Instrument-1]
+	s := c.ins.sample(n.Key)
+	if s == nil {
+		return
+	}
+	c.volume = s.Volume
+	c.finetune = s.Finetune
+	if s.Pan >= 0 {
+		c.pan = s.Pan
+	}
+	c.keyOn, c.fadeout = true, 65536
+	c.volTick, c.panTick = 0, 0
+}
+
+// keyOff releases the instrument: its envelopes leave their sustain and
+// the volume fades out, or without a volume envelope is cut
+func (c *channel) keyOff() {
+	c.keyOn = false
+	if c.ins == nil || !c.ins.Volume.On {
+		c.volume = 0
+	}
+}
+
+// finetune returns the finetune in 128ths of a semitone of an E5x
+// parameter, a signed nibble in MODs and 8 for none in the others
+func (p *Player) finetune(x int) int {
+	if p.Module.Format == FormatMOD {
+		return int(int8(x<<4)>>4) * 16
+	}
+	return (x - 8) * 16
+}
+
+// trigger starts the row's note, or sets it as the tone portamento target
+func (p *Player) trigger(c *channel) {
+	n := c.note
+	if c.ins != nil {
+		if s := c.ins.sample(n.Key); s != nil {
+			c.sample = s
+		}
+	}
+	if c.sample == nil {
+		return
+	}
+	period := p.notePeriod(c)
+	if n.Effect == 0x3 || n.Effect == 0x5 || n.Volume>>4 == 0xf {
+		c.portaTarget = period
+		return
+	}
+	c.period = period
+	c.retrigger()
+	c.vibratoPos, c.tremoloPos = 0, 0
+}
+
+// retrigger starts the sample over
+func (c *channel) retrigger() {
+	c.pos, c.backwards = 0, false
+	c.playing = c.sample != nil && len(c.sample.Data) > 0
+}
+
+// notePeriod returns the period of the row's note on the channel's sample
+func (p *Player) notePeriod(c *channel) int {
+	m := p.Module
+	if m.Format == FormatMOD {
+		return 4 * tunedPeriod(c.note.Period, c.finetune)
+	}
+	s := c.sample
+	key := float64(c.note.Key-1+s.RelNote) + float64(c.finetune)/128
+	if m.Linear {
+		return int(math.Round(linearPeriod - key*64))
+	}
+	c2spd := s.C2Spd
+	if c2spd <= 0 {
+		c2spd = defaultC2Spd
+	}
+	return int(math.Round(1712 * math.Pow(2, (48-key)/12) * defaultC2Spd / float64(c2spd)))
+}
+
+// periodRange returns the lowest and the highest period of the format
+func (p *Player) periodRange() (lo, hi int) {
+	switch {
+	case p.Module.Format == FormatMOD:
+		return 4 * minPeriod, 4 * maxPeriod
+	case p.Module.Linear:
+		return 1, linearPeriod
+	}
+	return 56, 65535
+}
+
+// frequency returns the rate a sample plays at for a period
+func (p *Player) frequency(period int) float64 {
+	switch {
+	case p.Module.Format == FormatMOD:
+		return 4 * paulaClock / float64(period)
+	case p.Module.Linear:
+		return defaultC2Spd * math.Pow(2, float64(4608-period)/768)
+	}
+	return amigaClock / float64(period)
+}
+
+// shift returns the period the given number of semitones higher.
+// ProTracker works in whole Amiga periods.
+func (p *Player) shift(period, semitones int) int {
+	switch {
+	case p.Module.Format == FormatMOD:
+		return 4 * shiftPeriod(period/4, semitones)
+	case p.Module.Linear:
+		return period - 64*semitones
+	}
+	return shiftPeriod(period, semitones)
+}
+
+// vibrato returns the period offset of the vibrato, a quarter as deep
+// when fine, and advances it
+func (p *Player) vibrato(c *channel, fine bool) int {
+	switch {
+	case p.Module.Format == FormatMOD:
+		return 4 * c.vibrato(128)
+	case fine:
+		return c.vibrato(128)
+	}
+	return c.vibrato(32)
+}
+
+// slide moves the period by delta within the limits of the format
+func (p *Player) slide(c *channel, delta int) {
+	lo, hi := p.periodRange()
+	c.period = min(max(c.period+delta, lo), hi)
+}
+
+// recall returns the parameter of the row's effect. S3M and XM effects
+// given a zero parameter reuse the last one of their kind.
+func (p *Player) recall(c *channel) byte {
+	n := c.note
+	slot := -1
+	switch n.Effect {
+	case 0x1, 0x2:
+		slot = int(n.Effect)
+		if p.Module.Format == FormatS3M {
+			slot = 0x1 // Both ways share it
+		}
+	case 0x5, 0x6, 0xa:
+		slot = 0xa
+	case effectGlobalVolumeSlide, effectPanSlide, effectRetrigger, effectTremor:
+		slot = int(n.Effect)
+	}
+	if slot < 0 || p.Module.Format == FormatMOD {
+		return n.Param
+	}
+	if n.Param != 0 {
+		c.memory[slot] = n.Param
+	}
+	return c.memory[slot]
+}
+
+// volumeColumn applies the volume column of XM and S3M notes, on the
+// first tick or on the others, and returns the vibrato it adds
+func (p *Player) volumeColumn(c *channel, first bool) (periodDelta int) {
+	v := c.note.Volume
+	x, y := v>>4, v&0x0f
+	if first {
+		switch {
+		case v >= 0x10 && v <= 0x50:
+			c.volume = v - 0x10
+		case x == 0x8:
+			c.volume = max(c.volume-y, 0)
+		case x == 0x9:
+			c.volume = min(c.volume+y, 64)
+		case x == 0xa && y > 0:
+			c.vibratoSpeed = y
+		case x == 0xb && y > 0:
+			c.vibratoDepth = y
+		case x == 0xc:
+			c.pan = y * 17
+		case x == 0xf && y > 0:
+			c.portaSpeed = y * 16
+		}
+		return 0
+	}
+	switch x {
+	case 0x6:
+		c.volume = max(c.volume-y, 0)
+	case 0x7:
+		c.volume = min(c.volume+y, 64)
+	case 0xb:
+		return p.vibrato(c, false)
+	case 0xd:
+		c.pan = max(c.pan-y, 0)
+	case 0xe:
+		c.pan = min(c.pan+y, 255)
+	case 0xf:
+		c.tonePortamento()
+	}
+	return 0
+}
+
+// rowEffect applies the effects taking place on the first tick of a row
+func (p *Player) rowEffect(c *channel) {
+	n := c.note
+	x, y := int(c.param>>4), int(c.param&0x0f)
+
+	switch n.Effect {
+	case 0x3: // Tone portamento
+		if n.Param != 0 {
+			c.portaSpeed = int(n.Param)
+		}
+	case 0x4, effectFineVibrato:
+		if x > 0 {
+			c.vibratoSpeed = x
+		}
+		if y > 0 {
+			c.vibratoDepth = y
+		}
+	case 0x7: // Tremolo
+		if x > 0 {
+			c.tremoloSpeed = x
+		}
+		if y > 0 {
+			c.tremoloDepth = y
+		}
+	case 0x8: // Panning
+		c.pan = int(n.Param)
+	case 0x9: // Sample offset
+		if n.Param != 0 {
+			c.offset = int(n.Param) * 256
+		}
+		if n.hasNote() {
+			c.pos = float64(c.offset)
+		}
+	case 0xb: // Position jump
+		p.nextOrder = int(n.Param)
+	case 0xc: // Set volume
+		c.volume = min(int(n.Param), 64)
+	case 0xd: // Pattern break, the row is in decimal
+		if p.nextOrder < 0 {
+			p.nextOrder = p.order + 1
+		}
+		p.nextRow = x*10 + y
+	case 0xe:
+		switch x {
+		case 0x1: // Fine portamento up
+			p.slide(c, -4*y)
+		case 0x2: // Fine portamento down
+			p.slide(c, 4*y)
+		case 0x6: // Pattern loop
+			if y == 0 {
+				c.loopRow = p.row
+				break
+			}
+			if c.loopCount == 0 {
+				c.loopCount = y
+			} else {
+				c.loopCount--
+			}
+			if c.loopCount > 0 {
+				p.loopTo = c.loopRow
+			}
+		case 0xa: // Fine volume slide up
+			c.volume = min(c.volume+y, 64)
+		case 0xb: // Fine volume slide down
+			c.volume = max(c.volume-y, 0)
+		case 0xc: // Note cut on the first tick
+			if y == 0 {
+				c.volume = 0
+			}
+		case 0xe: // Pattern delay
+			p.delay = y
+		}
+	case 0xf: // Speed below 32, tempo above
+		switch {
+		case n.Param == 0:
+		case n.Param < 32:
+			p.speed = int(n.Param)
+		default:
+			p.tempo = int(n.Param)
+		}
+	case effectSpeed:
+		if n.Param > 0 {
+			p.speed = int(n.Param)
+		}
+	case effectTempo:
+		if n.Param >= 32 {
+			p.tempo = int(n.Param)
+		}
+	case effectGlobalVolume:
+		p.globalVolume = min(int(n.Param), 64)
+	case effectKeyOff:
+		if n.Param == 0 {
+			c.keyOff()
+		}
+	case effectRetrigger:
+		c.retriggerTicks = 0
+	case effectExtraFine:
+		switch x {
+		case 0x1:
+			p.slide(c, -y)
+		case 0x2:
+			p.slide(c, y)
+		}
+	}
+}
+
+// updateEffects applies the continuous effects on the other ticks
+func (p *Player) updateEffects(c *channel) {
+	n := c.note
+	x, y := int(c.param>>4), int(c.param&0x0f)
+	periodDelta := p.volumeColumn(c, false)
+	volumeDelta := 0
+
+	switch n.Effect {
+	case 0x0: // Arpeggio
+		if n.Param != 0 {
+			switch p.tick % 3 {
+			case 1:
+				periodDelta = p.shift(c.period, x) - c.period
+			case 2:
+				periodDelta = p.shift(c.period, y) - c.period
+			}
+		}
+	case 0x1: // Portamento up
+		p.slide(c, -4*int(c.param))
+	case 0x2: // Portamento down
+		p.slide(c, 4*int(c.param))
+	case 0x3:
+		c.tonePortamento()
+	case 0x4:
+		periodDelta = p.vibrato(c, false)
+	case effectFineVibrato:
+		periodDelta = p.vibrato(c, true)
+	case 0x5:
+		c.tonePortamento()
+		c.volumeSlide(x, y)
+	case 0x6:
+		periodDelta = p.vibrato(c, false)
+		c.volumeSlide(x, y)
+	case 0x7:
+		volumeDelta = c.tremolo()
+	case 0xa:
+		c.volumeSlide(x, y)
+	case 0xe:
+		switch x {
+		case 0x9: // Retrigger every y ticks
+			if y > 0 && p.tick%y == 0 {
+				c.retrigger()
+			}
+		case 0xc: // Note cut
+			if p.tick == y {
+				c.volume = 0
+			}
+		case 0xd: // Note delay
+			if p.tick == y && n.hasNote() {
+				p.trigger(c)
+			}
+		}
+	case effectGlobalVolumeSlide:
+		if x > 0 {
+			p.globalVolume = min(p.globalVolume+x, 64)
+		} else {
+			p.globalVolume = max(p.globalVolume-y, 0)
+		}
+	case effectKeyOff:
+		if p.tick == int(n.Param) {
+			c.keyOff()
+		}
+	case effectPanSlide:
+		if x > 0 {
+			c.pan = min(c.pan+x, 255)
+		} else {
+			c.pan = max(c.pan-y, 0)
+		}
+	case effectRetrigger:
+		if c.retriggerTicks++; y > 0 && c.retriggerTicks >= y {
+			c.retriggerTicks = 0
+			c.retrigger()
+			c.volume = retriggerVolume(c.volume, x)
+		}
+	case effectTremor:
+		on, off := x+1, y+1
+		c.tremorOff = c.tremorPos%(on+off) >= on
+		c.tremorPos++
+	}
+
+	p.output(c, periodDelta, volumeDelta)
+}
+
+// output sets what a voice plays until the next tick: its period and
+// volume with the offsets of the effects, shaped by the envelopes of the
+// instrument, its fadeout and the global volume
+func (p *Player) output(c *channel, periodDelta, volumeDelta int) {
+	c.outPeriod = 0
+	if c.period > 0 {
+		lo, hi := p.periodRange()
+		c.outPeriod = min(max(c.period+periodDelta, lo), hi)
+	}
+	volume := float64(min(max(c.volume+volumeDelta, 0), 64)) / 64
+	pan := float64(c.pan)
+
+	if ins := c.ins; ins != nil {
+		if ins.Volume.On {
+			volume *= float64(ins.Volume.value(c.volTick)) / 64
+			c.volTick = ins.Volume.advance(c.volTick, c.keyOn)
+			if !c.keyOn {
+				volume *= float64(c.fadeout) / 65536
+				c.fadeout = max(c.fadeout-ins.Fadeout, 0)
+			}
+		}
+		if ins.Panning.On {
+			swing := float64(ins.Panning.value(c.panTick) - 32)
+			pan += swing * (128 - math.Abs(pan-128)) / 32
+			c.panTick = ins.Panning.advance(c.panTick, c.keyOn)
+		}
+	}
+	if c.tremorOff {
+		volume = 0
+	}
+
+	c.outVolume = volume * float64(p.globalVolume) / 64
+	c.outPan = min(max(pan/255, 0), 1)
+	if c.outPeriod > 0 && p.rate > 0 {
+		c.step = p.frequency(c.outPeriod) / float64(p.rate)
+	}
+}
+
+// value returns the envelope at a tick, interpolated between its points
+func (e *Envelope) value(tick int) int {
+	pts := e.Points
+	if len(pts) == 0 {
+		return 64
+	}
+	for i := 1; i < len(pts); i++ {
+		a, b := pts[i-1], pts[i]
+		if tick < b.Tick {
+			if tick <= a.Tick || b.Tick <= a.Tick {
+				return a.Value
+			}
+			return a.Value + (b.Value-a.Value)*(tick-a.Tick)/(b.Tick-a.Tick)
+		}
+	}
+	return pts[len(pts)-1].Value
+}
+
+// advance returns the tick following tick on the envelope: it holds at
+// the sustain point while the key is down and goes around the loop
+func (e *Envelope) advance(tick int, keyOn bool) int {
+	n := len(e.Points)
+	if e.SustainOn && keyOn && e.Sustain < n && tick == e.Points[e.Sustain].Tick {
+		return tick
+	}
+	tick++
+	if e.LoopOn && e.LoopStart <= e.LoopEnd && e.LoopEnd < n && tick >= e.Points[e.LoopEnd].Tick {
+		tick = e.Points[e.LoopStart].Tick
+	}
+	return tick
+}
+
+// retriggerVolume returns the volume changed as the x of a retrigger with
+// volume change says
+func retriggerVolume(v, x int) int {
+	switch x {
+	case 0x1, 0x2, 0x3, 0x4, 0x5:
+		v -= 1 << (x - 1)
+	case 0x6:
+		v = v * 2 / 3
+	case 0x7:
+		v /= 2
+	case 0x9, 0xa, 0xb, 0xc, 0xd:
+		v += 1 << (x - 9)
+	case 0xe:
+		v = v * 3 / 2
+	case 0xf:
+		v *= 2
+	}
+	return min(max(v, 0), 64)
+}
+
+// tonePortamento slides the period towards the target note
+func (c *channel) tonePortamento() {
+	if c.portaTarget == 0 {
+		return
+	}
+	if c.period < c.portaTarget {
+		c.period = min(c.period+4*c.portaSpeed, c.portaTarget)
+	} else {
+		c.period = max(c.period-4*c.portaSpeed, c.portaTarget)
+	}
+}
+
+// vibrato returns the vibrato table scaled by the depth over div, and
+// advances it
+func (c *channel) vibrato(div int) int {
+	d := vibratoTable[c.vibratoPos&31] * c.vibratoDepth / div
+	if c.vibratoPos&32 != 0 {
+		d = -d
+	}
+	c.vibratoPos = (c.vibratoPos + c.vibratoSpeed) & 63
+	return d
+}
+
+// tremolo returns the volume offset of the tremolo and advances it
+func (c *channel) tremolo() int {
+	d := vibratoTable[c.tremoloPos&31] * c.tremoloDepth / 64
+	if c.tremoloPos&32 != 0 {
+		d = -d
+	}
+	c.tremoloPos = (c.tremoloPos + c.tremoloSpeed) & 63
+	return d
+}
+
+// volumeSlide slides the volume up by x or, when x is 0, down by y
+func (c *channel) volumeSlide(x, y int) {
+	if x > 0 {
+		c.volume = min(c.volume+x, 64)
+	} else {
+		c.volume = max(c.volume-y, 0)
+	}
+}
+
+// nextPosition moves to the next row, following jumps, breaks and loops
+func (p *Player) nextPosition() {
+	m := p.Module
+	switch {
+	case p.loopTo >= 0:
+		p.row = p.loopTo
+	case p.nextOrder >= 0:
+		p.order, p.row = p.nextOrder, p.nextRow
+		p.entered = true
+	default:
+		p.row++
+		if p.row >= m.rows(m.Orders[p.order]) {
+			p.row = 0
+			p.order++
+			p.entered = true
+		}
+	}
+	p.nextOrder, p.nextRow, p.loopTo = -1, 0, -1
+
+	if p.order >= len(m.Orders) {
+		p.order = m.Restart
+	}
+	if p.row >= m.rows(m.Orders[p.order]) {
+		p.row = 0
+	}
+}
+
+// measure plays the song without mixing until it returns to a position
+// it has played before, and returns how long that took with the rows
+// played on the way
+func measure(m *Module) (time.Duration, []RowTime) {
+	p := &Player{Module: m}
+	p.Reset()
+	p.entered = true
+
+	var rows []RowTime
+	last := make([]int, m.Channels)
+	seen := map[[2]int]bool{}
+	seconds := 0.0
+	for seconds < maxDuration.Seconds() {
+		if p.tick == 0 && !p.delaying {
+			if p.entered {
+				pos := [2]int{p.order, p.row}
+				if seen[pos] {
+					break
+				}
+				seen[pos] = true
+			}
+			rows = append(rows, RowTime{
+				Time:    time.Duration(seconds * float64(time.Second)),
+				Order:   p.order,
+				Pattern: m.Orders[p.order],
+				Row:     p.row,
+				Start:   p.entered,
+
+				Instruments: p.started(last),
+			})
+			p.entered = false
+		}
+		p.processTick()
+		seconds += 2.5 / float64(p.tempo)
+	}
+	return time.Duration(seconds * float64(time.Second)), rows
+}
+
+// started returns the instruments of the notes the current row starts.
+// A note without an instrument plays the last one of its channel, kept
+// in last.
+func (p *Player) started(last []int) []int {
+	var ins []int
+	for i := range last {
+		n := p.Module.note(p.order, p.row, i)
+		if n.Instrument > 0 {
+			last[i] = n.Instrument
+		}
+		if !n.hasNote() || last[i] == 0 || n.Effect == 0x3 || n.Effect == 0x5 || n.Volume>>4 == 0xf {
+			continue
+		}
+		if !slices.Contains(ins, last[i]) {
+			ins = append(ins, last[i])
+		}
+	}
+	return ins
+}
+
+// tunedPeriod applies a finetune, in 128ths of a semitone, to a period
+func tunedPeriod(period, finetune int) int {
+	if finetune == 0 {
+		return period
+	}
+	return int(math.Round(float64(period) * math.Pow(2, -float64(finetune)/1536)))
+}
+
+// shiftPeriod returns the period the given number of semitones higher
+func shiftPeriod(period, semitones int) int {
+	return int(math.Round(float64(period) * math.Pow(2, -float64(semitones)/12)))
+}
+
+// clip converts a mixed value to a 16-bit sample
+func clip(v float64) int16 {
+	return int16(min(max(v, -32768), 32767))
+}
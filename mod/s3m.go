@@ -0,0 +1,289 @@
+package mod
+
+import "errors"
+
+// S3M layout: the header holds the song settings, the orders and the
+// paragraph (16 byte) offsets of the instruments and the patterns
+const (
+	s3mHeaderSize   = 0x60
+	s3mInstrument   = 0x50 // Size of an instrument header
+	s3mChannelSlots = 32
+	s3mStereo       = 0x80 // Master volume flag
+	s3mPanTable     = 252  // Default pan byte when the header holds one
+	s3mLoop         = 1    // Sample flags
+	s3m16Bit        = 4
+)
+
+// s3mChannelPan is the panning of left and right S3M channels
+var s3mChannelPan = [2]int{0x33, 0xcc}
+
+// isS3M reports whether data is a Scream Tracker 3 module
+func isS3M(data []byte) bool {
+	return len(data) >= s3mHeaderSize && string(data[0x2c:0x30]) == "SCRM"
+}
+
+// parseS3M decodes a Scream Tracker 3 module. Its AdLib channels and
+// instruments are left out, and its effects are translated to the XM
+// ones.
+func parseS3M(data []byte) (*Module, error) {
+	if !isS3M(data) {
+		return nil, ErrFormat
+	}
+	numOrders, numInstruments, numPatterns := le16(data[0x20:]), le16(data[0x22:]), le16(data[0x24:])
+	signed := le16(data[0x2a:]) == 1
+	pos := s3mHeaderSize
+	tables := pos + numOrders + 2*numInstruments + 2*numPatterns
+	if tables > len(data) {
+		return nil, errors.New("mod: truncated S3M header")
+	}
+
+	m := &Module{
+		Format:       FormatS3M,
+		Title:        cString(data[:28]),
+		Speed:        int(data[0x31]),
+		Tempo:        int(data[0x32]),
+		GlobalVolume: min(int(data[0x30]), 64),
+	}
+	if m.Speed == 0 || m.Speed == 255 {
+		m.Speed = defaultSpeed
+	}
+	if m.Tempo < 32 {
+		m.Tempo = defaultTempo
+	}
+
+	// Channels are numbered apart from the disabled and the AdLib ones
+	var channels [s3mChannelSlots]int
+	var pans [s3mChannelSlots]int
+	if data[0x35] == s3mPanTable && tables+s3mChannelSlots <= len(data) {
+		for i := range pans {
+			pans[i] = int(data[tables+i])
+		}
+	}
+	for i := range channels {
+		setting := int(data[0x40+i])
+		if setting >= 16 {
+			channels[i] = -1
+			continue
+		}
+		channels[i] = m.Channels
+		m.Channels++
+
+		pan := s3mChannelPan[setting/8]
+		switch {
+		case data[0x33]&s3mStereo == 0:
+			pan = 128
+		case pans[i]&0x20 != 0:
+			pan = int(pans[i]&0x0f) * 17
+		}
+		m.Pan = append(m.Pan, pan)
+	}
+	if m.Channels == 0 {
+		return nil, errors.New("mod: S3M without sample channels")
+	}
+
+	for _, o := range data[pos : pos+numOrders] {
+		if o == 255 { // End of the song
+			break
+		}
+		if o != 254 { // Markers are skipped over
+			m.Orders = append(m.Orders, int(o))
+		}
+	}
+	if len(m.Orders) == 0 {
+		return nil, errors.New("mod: invalid song length")
+	}
+	pos += numOrders
+
+	for i := 0; i < numInstruments; i++ {
+		ins, err := parseS3MInstrument(data, le16(data[pos+2*i:])*16, signed)
+		if err != nil {
+			return nil, err
+		}
+		m.Instruments = append(m.Instruments, ins)
+	}
+	pos += 2 * numInstruments
+
+	for i := 0; i < numPatterns; i++ {
+		m.Patterns = append(m.Patterns, parseS3MPattern(data, le16(data[pos+2*i:])*16, m.Channels, &channels))
+	}
+	return m, nil
+}
+
+// parseS3MInstrument decodes the instrument with its header at off.
+// Samples are stored signed or unsigned as the header says, the left
+// channel first when in stereo.
+func parseS3MInstrument(data []byte, off int, signed bool) (Instrument, error) {
+	if off+s3mInstrument > len(data) {
+		return Instrument{}, errors.New("mod: truncated S3M instrument")
+	}
+	h := data[off:]
+	s := Sample{
+		Name:      cString(h[0x30:0x4c]),
+		Volume:    min(int(h[0x1c]), 64),
+		Pan:       -1,
+		C2Spd:     le32(h[0x20:]),
+		Loop:      h[0x1f]&s3mLoop != 0,
+		LoopStart: le32(h[0x14:]),
+	}
+	ins := Instrument{Name: s.Name}
+	if h[0] != 1 { // Not a sample: empty or AdLib
+		ins.Samples = []Sample{s}
+		return ins, nil
+	}
+	s.LoopLen = le32(h[0x18:]) - s.LoopStart
+
+	length := le32(h[0x10:])
+	width := 1
+	if h[0x1f]&s3m16Bit != 0 {
+		width = 2
+	}
+	start := (int(h[0x0d])<<16 | le16(h[0x0e:])) * 16
+	length = min(length, max(len(data)-start, 0)/width)
+	s.Data = make([]int16, length)
+	for i := range s.Data {
+		if width == 2 {
+			v := le16(data[start+2*i:])
+			if !signed {
+				v ^= 0x8000
+			}
+			s.Data[i] = int16(v)
+			continue
+		}
+		v := data[start+i]
+		if !signed {
+			v ^= 0x80
+		}
+		s.Data[i] = int16(int8(v)) << 8
+	}
+	ins.Samples = []Sample{s}
+	return ins, nil
+}
+
+// parseS3MPattern decodes the packed pattern at off, keeping the notes of
+// the channels played. Truncated patterns end early.
+func parseS3MPattern(data []byte, off, numChannels int, channels *[s3mChannelSlots]int) []Note {
+	notes := make([]Note, numRows*numChannels)
+	if off == 0 || off+2 > len(data) {
+		return notes
+	}
+	pos := off + 2
+	for row := 0; row < numRows && pos < len(data); {
+		what := data[pos]
+		pos++
+		if what == 0 {
+			row++
+			continue
+		}
+
+		var n Note
+		size := 0
+		for _, f := range [...]struct {
+			flag byte
+			size int
+		}{{0x20, 2}, {0x40, 1}, {0x80, 2}} {
+			if what&f.flag != 0 {
+				size += f.size
+			}
+		}
+		if pos+size > len(data) {
+			break
+		}
+		if what&0x20 != 0 {
+			switch key := data[pos]; key {
+			case 255:
+			case 254:
+				n.Key = KeyOff
+			default:
+				n.Key = int(key>>4)*12 + int(key&0x0f) + 1
+			}
+			n.Instrument = int(data[pos+1])
+			pos += 2
+		}
+		if what&0x40 != 0 {
+			if v := data[pos]; v <= 64 {
+				n.Volume = 0x10 + int(v)
+			}
+			pos++
+		}
+		if what&0x80 != 0 {
+			n.Effect, n.Param = s3mEffect(data[pos], data[pos+1])
+			pos += 2
+		}
+		if ch := channels[what&0x1f]; ch >= 0 {
+			notes[row*numChannels+ch] = n
+		}
+	}
+	return notes
+}
+
+// s3mEffect translates an S3M command, A (1) to Z, to the XM effect
+// doing the same
+func s3mEffect(cmd, info byte) (effect, param byte) {
+	x, y := info>>4, info&0x0f
+	switch cmd {
+	case 'A' - '@':
+		return effectSpeed, info
+	case 'B' - '@':
+		return 0xb, info
+	case 'C' - '@':
+		return 0xd, info
+	case 'D' - '@': // Volume slide, fine when one side is F
+		switch {
+		case y == 0xf && x > 0:
+			return 0xe, 0xa0 | x
+		case x == 0xf && y > 0:
+			return 0xe, 0xb0 | y
+		}
+		return 0xa, info
+	case 'E' - '@', 'F' - '@': // Portamento, fine when F, extra fine when E
+		effect, fine := byte(0x2), byte(0x20)
+		if cmd == 'F'-'@' {
+			effect, fine = 0x1, 0x10
+		}
+		switch x {
+		case 0xf:
+			return 0xe, fine | y
+		case 0xe:
+			return effectExtraFine, fine | y
+		}
+		return effect, info
+	case 'G' - '@':
+		return 0x3, info
+	case 'H' - '@':
+		return 0x4, info
+	case 'I' - '@':
+		return effectTremor, info
+	case 'J' - '@':
+		return 0x0, info
+	case 'K' - '@':
+		return 0x6, info
+	case 'L' - '@':
+		return 0x5, info
+	case 'O' - '@':
+		return 0x9, info
+	case 'Q' - '@':
+		return effectRetrigger, info
+	case 'R' - '@':
+		return 0x7, info
+	case 'S' - '@':
+		switch x {
+		case 0x2: // Finetune
+			return 0xe, 0x50 | y
+		case 0x8: // Panning
+			return 0x8, y * 17
+		case 0xb: // Pattern loop
+			return 0xe, 0x60 | y
+		case 0xc, 0xd, 0xe: // Note cut, note delay, pattern delay
+			return 0xe, info
+		}
+	case 'T' - '@':
+		return effectTempo, info
+	case 'U' - '@':
+		return effectFineVibrato, info
+	case 'V' - '@':
+		return effectGlobalVolume, info
+	case 'X' - '@':
+		return 0x8, byte(min(int(info)*2, 255))
+	}
+	return 0, 0
+}
@@ -0,0 +1,239 @@
+package mod
+
+import "errors"
+
+// XM layout: a header, the patterns, then the instruments, each with its
+// sample headers followed by the delta coded sample data
+const (
+	xmID            = "Extended Module: "
+	xmVersion       = 0x0104
+	xmHeaderStart   = 60 // Header sizes count from here
+	xmMaxChannels   = 32
+	xmMaxRows       = 256
+	xmLinear        = 1   // Song flag
+	xmInstrument    = 243 // Size of an instrument header with samples
+	xmEnvelopePts   = 12  // Points per envelope
+	xmLoopType      = 3   // Sample type bits: none, forward or ping-pong
+	xmLoopPingPong  = 2
+	xmSampleHeader  = 40
+	xm16Bit         = 0x10
+	xmEnvelopeOn    = 1 // Envelope type flags
+	xmEnvelopeSus   = 2
+	xmEnvelopeLoop  = 4
+	xmPackedNote    = 0x80
+	xmDefaultPan    = 128
+	xmFadeoutFactor = 2 // Fadeouts are stored out of 32768
+)
+
+// isXM reports whether data is a FastTracker 2 module
+func isXM(data []byte) bool {
+	return len(data) >= xmHeaderStart+20 && string(data[:len(xmID)]) == xmID
+}
+
+// parseXM decodes a FastTracker 2 module of the last format version,
+// which all XM trackers write
+func parseXM(data []byte) (*Module, error) {
+	if !isXM(data) {
+		return nil, ErrFormat
+	}
+	if v := le16(data[58:]); v != xmVersion {
+		return nil, errors.New("mod: unsupported XM version")
+	}
+	h := data[xmHeaderStart:]
+	headerSize := le32(h)
+	songLen, restart, channels := le16(h[4:]), le16(h[6:]), le16(h[8:])
+	numPatterns, numInstruments := le16(h[10:]), le16(h[12:])
+	if len(h) < 20+256 || headerSize < 20+256 {
+		return nil, errors.New("mod: truncated XM header")
+	}
+	if channels == 0 || channels > xmMaxChannels {
+		return nil, errors.New("mod: invalid XM channel count")
+	}
+	if songLen == 0 || songLen > 256 {
+		return nil, errors.New("mod: invalid song length")
+	}
+
+	m := &Module{
+		Format:       FormatXM,
+		Title:        cString(data[17:37]),
+		Channels:     channels,
+		Linear:       le16(h[14:])&xmLinear != 0,
+		Speed:        le16(h[16:]),
+		Tempo:        le16(h[18:]),
+		GlobalVolume: 64,
+	}
+	if m.Speed == 0 {
+		m.Speed = defaultSpeed
+	}
+	if m.Tempo < 32 {
+		m.Tempo = defaultTempo
+	}
+	for range channels {
+		m.Pan = append(m.Pan, xmDefaultPan)
+	}
+	for _, o := range h[20 : 20+songLen] {
+		m.Orders = append(m.Orders, int(o))
+	}
+	if m.Restart = restart; m.Restart >= songLen {
+		m.Restart = 0
+	}
+
+	pos := xmHeaderStart + headerSize
+	for range numPatterns {
+		notes, next, err := parseXMPattern(data, pos, channels)
+		if err != nil {
+			return nil, err
+		}
+		m.Patterns = append(m.Patterns, notes)
+		pos = next
+	}
+	for range numInstruments {
+		ins, next, err := parseXMInstrument(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		m.Instruments = append(m.Instruments, ins)
+		pos = next
+	}
+	return m, nil
+}
+
+// parseXMPattern decodes the pattern at pos and returns it with the
+// position following it. Each note is packed: a first byte with the top
+// bit set says which of the five fields follow, otherwise it is the key
+// and all of them follow.
+func parseXMPattern(data []byte, pos, channels int) ([]Note, int, error) {
+	if pos+9 > len(data) {
+		return nil, 0, errors.New("mod: truncated XM pattern")
+	}
+	rows, size := le16(data[pos+5:]), le16(data[pos+7:])
+	if rows == 0 || rows > xmMaxRows {
+		rows = numRows
+	}
+	pos += le32(data[pos:])
+	end := pos + size
+	if end > len(data) {
+		return nil, 0, errors.New("mod: truncated XM pattern")
+	}
+
+	notes := make([]Note, rows*channels)
+	for i := 0; i < len(notes) && pos < end; i++ {
+		fields := byte(0x1f)
+		if data[pos]&xmPackedNote != 0 {
+			fields = data[pos] & 0x1f
+			pos++
+		}
+		var b [5]byte
+		for f := range b {
+			if fields&(1<<f) != 0 && pos < end {
+				b[f] = data[pos]
+				pos++
+			}
+		}
+		n := Note{Key: int(b[0]), Instrument: int(b[1]), Volume: int(b[2]), Effect: b[3], Param: b[4]}
+		if n.Key > KeyOff {
+			n.Key = 0
+		}
+		if n.Volume < 0x10 {
+			n.Volume = 0
+		}
+		notes[i] = n
+	}
+	return notes, end, nil
+}
+
+// parseXMInstrument decodes the instrument at pos and returns it with the
+// position following its samples
+func parseXMInstrument(data []byte, pos int) (Instrument, int, error) {
+	if pos+29 > len(data) {
+		return Instrument{}, 0, errors.New("mod: truncated XM instrument")
+	}
+	h := data[pos:]
+	size, numSamples := le32(h), le16(h[27:])
+	ins := Instrument{Name: cString(h[4:26])}
+	if numSamples == 0 {
+		return ins, pos + max(size, 29), nil
+	}
+	sampleHeaderSize := le32(h[29:])
+	if size < xmInstrument || pos+size > len(data) || sampleHeaderSize < xmSampleHeader {
+		return Instrument{}, 0, errors.New("mod: truncated XM instrument")
+	}
+
+	copy(ins.Keymap[:], h[33:129])
+	ins.Volume = xmEnvelope(h[129:], h[225], h[227:230], h[233])
+	ins.Panning = xmEnvelope(h[177:], h[226], h[230:233], h[234])
+	ins.Fadeout = le16(h[239:]) * xmFadeoutFactor
+	pos += size
+
+	headers := pos
+	pos += numSamples * sampleHeaderSize
+	if pos > len(data) {
+		return Instrument{}, 0, errors.New("mod: truncated XM instrument")
+	}
+	for i := range numSamples {
+		s, next := parseXMSample(data, headers+i*sampleHeaderSize, pos)
+		ins.Samples = append(ins.Samples, s)
+		pos = next
+	}
+	return ins, pos, nil
+}
+
+// xmEnvelope decodes an envelope from its points, their count, its
+// sustain and loop points and its type
+func xmEnvelope(points []byte, count byte, marks []byte, flags byte) Envelope {
+	e := Envelope{
+		On:        flags&xmEnvelopeOn != 0,
+		SustainOn: flags&xmEnvelopeSus != 0,
+		LoopOn:    flags&xmEnvelopeLoop != 0,
+		Sustain:   int(marks[0]),
+		LoopStart: int(marks[1]),
+		LoopEnd:   int(marks[2]),
+	}
+	for i := range min(int(count), xmEnvelopePts) {
+		e.Points = append(e.Points, EnvelopePoint{Tick: le16(points[i*4:]), Value: min(le16(points[i*4+2:]), 64)})
+	}
+	if len(e.Points) == 0 {
+		e.On = false
+	}
+	return e
+}
+
+// parseXMSample decodes the sample with its header at off and its data at
+// pos, and returns it with the position following the data. Lengths are
+// in bytes in the file, and data truncated by the end of the file is cut
+// short.
+func parseXMSample(data []byte, off, pos int) (Sample, int) {
+	h := data[off:]
+	length, loopStart, loopLen := le32(h), le32(h[4:]), le32(h[8:])
+	flags := h[14]
+	s := Sample{
+		Name:     cString(h[18:40]),
+		Volume:   min(int(h[12]), 64),
+		Finetune: int(int8(h[13])),
+		Pan:      int(h[15]),
+		RelNote:  int(int8(h[16])),
+		Loop:     flags&xmLoopType != 0,
+		PingPong: flags&xmLoopType == xmLoopPingPong,
+	}
+	next := pos + length
+	length = min(length, max(len(data)-pos, 0))
+
+	if flags&xm16Bit != 0 {
+		s.Data = make([]int16, length/2)
+		var v int16
+		for i := range s.Data {
+			v += int16(le16(data[pos+2*i:]))
+			s.Data[i] = v
+		}
+		loopStart, loopLen = loopStart/2, loopLen/2
+	} else {
+		s.Data = make([]int16, length)
+		var v int8
+		for i := range s.Data {
+			v += int8(data[pos+i])
+			s.Data[i] = int16(v) << 8
+		}
+	}
+	s.LoopStart, s.LoopLen = loopStart, loopLen
+	return s, next
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"bilizir-demo/mod"
+)
+
+// MODPlayer plays a tracker module, MOD, S3M or XM, for Ebiten audio
+type MODPlayer struct {
+	playbackState
+
+	player     *mod.Player
+	sampleRate int
+	buffer     []int16
+	position   int64 // Samples played since the start of the song
+	loop       bool
+}
+
+// NewMODPlayer loads a module and starts it from its first position
+func NewMODPlayer(data []byte, sampleRate int, loop bool) (*MODPlayer, error) {
+	player, err := mod.NewPlayer(data, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module: %w", err)
+	}
+
+	m := player.Module
+	log.Printf("%v: %q, %d channels, %d positions, %v", m.Format, m.Title, m.Channels, len(m.Orders), player.Duration().Round(time.Second))
+	return &MODPlayer{
+		player:        player,
+		sampleRate:    sampleRate,
+		buffer:        make([]int16, 8192),
+		loop:          loop,
+		playbackState: playbackState{volume: 0.5},
+	}, nil
+}
+
+// Read implements io.Reader for audio streaming
+func (m *MODPlayer) Read(p []byte) (n int, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastRead = time.Now()
+	samplesNeeded := len(p) / 4
+	n = samplesNeeded * 4
+
+	// Output silence while paused, keeping the audio stream alive
+	if m.paused {
+		clear(p[:n])
+		return n, nil
+	}
+
+	// The song loops by itself; stop after one pass otherwise
+	if !m.loop {
+		left := int64(m.player.Duration().Seconds()*float64(m.sampleRate)) - m.position
+		if left <= 0 {
+			return 0, io.EOF
+		}
+		samplesNeeded = int(min(int64(samplesNeeded), left))
+		n = samplesNeeded * 4
+	}
+
+	for done := 0; done < samplesNeeded; {
+		chunk := min(samplesNeeded-done, len(m.buffer)/2)
+		m.player.Render(m.buffer[:chunk*2])
+
+		for i, v := range m.buffer[:chunk*2] {
+			sample := int16(float64(v) * m.volume)
+			o := done*4 + i*2
+			p[o], p[o+1] = byte(sample), byte(sample>>8)
+		}
+		done += chunk
+		m.position += int64(chunk)
+	}
+	return n, nil
+}
+
+// Seek implements io.Seeker; offsets are in bytes of 16-bit stereo
+func (m *MODPlayer) Seek(offset int64, whence int) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = m.position*4 + offset
+	case io.SeekEnd:
+		pos = int64(m.player.Duration().Seconds()*float64(m.sampleRate))*4 + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	m.seek(max(pos, 0) / 4)
+	return m.position * 4, nil
+}
+
+// SeekTime moves playback to the given time in the song
+func (m *MODPlayer) SeekTime(t time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if t < 0 {
+		return
+	}
+	m.seek(int64(t.Seconds() * float64(m.sampleRate)))
+}
+
+// seek moves to a sample position, replaying the song from its start
+// when going backwards
+func (m *MODPlayer) seek(sample int64) {
+	from := m.position
+	if sample < from {
+		m.player.Reset()
+		from = 0
+	}
+	m.player.Skip(time.Duration(sample-from) * time.Second / time.Duration(m.sampleRate))
+	m.position = sample
+}
+
+// MusicPosition returns the current time in the song
+func (m *MODPlayer) MusicPosition() time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pos := time.Duration(m.position) * time.Second / time.Duration(m.sampleRate)
+	if d := m.player.Duration(); d > 0 && m.loop {
+		pos %= d
+	}
+	return pos
+}
+
+// Duration returns the length of one pass through the song
+func (m *MODPlayer) Duration() time.Duration {
+	return m.player.Duration()
+}
+
+// Info returns the song title; modules do not name their author
+func (m *MODPlayer) Info() TuneInfo {
+	return TuneInfo{Format: m.player.Module.Format.String(), Title: m.player.Module.Title}
+}
+
+// RowsBetween returns the rows starting after from and up to to, times
+// in the song. The song loops, so from after to wraps around its end.
+func (m *MODPlayer) RowsBetween(from, to time.Duration) []mod.RowTime {
+	rows := m.player.Rows()
+	d := m.player.Duration()
+	if d <= 0 || len(rows) == 0 {
+		return nil
+	}
+	from, to = from%d, to%d
+	after := func(t time.Duration) int {
+		return sort.Search(len(rows), func(i int) bool { return rows[i].Time > t })
+	}
+	i, j := after(from), after(to)
+	if from <= to {
+		return rows[i:j]
+	}
+	return append(append([]mod.RowTime(nil), rows[i:]...), rows[:j]...)
+}
+
+// Close releases resources
+func (m *MODPlayer) Close() error {
+	return nil
+}
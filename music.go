@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"bilizir-demo/ahx"
+	"bilizir-demo/effects"
+	"bilizir-demo/mod"
+	"bilizir-demo/sndh"
+)
+
+// MusicPlayer is a tune streamed to the audio device, whatever its
+// format. Samples are 16-bit stereo at the demo sample rate.
+type MusicPlayer interface {
+	io.ReadSeeker
+	io.Closer
+
+	SetVolume(volume float64)
+	GetVolume() float64
+
+	Pause()
+	Resume()
+	Paused() bool
+
+	// SeekTime moves playback to t in the tune
+	SeekTime(t time.Duration)
+
+	// MusicPosition returns the playback position in the tune
+	MusicPosition() time.Duration
+
+	// Duration returns the length of the tune, 0 when unknown
+	Duration() time.Duration
+
+	// LastRead returns when the audio device last read samples
+	LastRead() time.Time
+
+	// Info returns the metadata of the tune
+	Info() TuneInfo
+}
+
+// FloatPlayer is implemented by tunes that also stream 32-bit float
+// stereo, which the audio device plays with headroom over full scale
+// instead of clipping each tune to 16 bits
+type FloatPlayer interface {
+	// F32 returns the tune as a 32-bit float stream, its position that
+	// of the tune
+	F32() io.ReadSeeker
+}
+
+// floatStream streams a tune in 32-bit float stereo through read, its
+// offsets twice those of the 16-bit stream
+type floatStream struct {
+	tune io.Seeker
+	read func(p []byte) (int, error)
+}
+
+func (s floatStream) Read(p []byte) (int, error) {
+	return s.read(p)
+}
+
+func (s floatStream) Seek(offset int64, whence int) (int64, error) {
+	pos, err := s.tune.Seek(offset/8*4, whence)
+	return pos * 2, err
+}
+
+// floatOf returns t as a 32-bit float stereo stream: its own when it has
+// one, else its 16-bit samples converted, read through buf
+func floatOf(t MusicPlayer, buf *[]byte) io.Reader {
+	if f, ok := t.(FloatPlayer); ok {
+		return f.F32()
+	}
+	return widened{tune: t, buf: buf}
+}
+
+// widened reads a 16-bit tune as 32-bit float stereo
+type widened struct {
+	tune MusicPlayer
+	buf  *[]byte
+}
+
+func (w widened) Read(p []byte) (n int, err error) {
+	half := len(p) / 8 * 4
+	if cap(*w.buf) < half {
+		*w.buf = make([]byte, half)
+	}
+	b := (*w.buf)[:half]
+	n, err = w.tune.Read(b)
+	n = n / 2 * 2
+	for i := 0; i < n; i += 2 {
+		v := int16(binary.LittleEndian.Uint16(b[i:]))
+		binary.LittleEndian.PutUint32(p[i*2:], math.Float32bits(float32(v)/32768))
+	}
+	return n * 2, err
+}
+
+// TuneInfo is the metadata of a tune, as shown by the now-playing panel.
+// Fields the file does not declare are empty.
+type TuneInfo struct {
+	Format string // YM, SNDH, MOD, S3M, XM, AHX or HVL
+	Title  string
+	Author string
+	Year   string
+}
+
+// ymClock is the YM2149 clock on the Atari ST
+const ymClock = 2000000
+
+// ChannelState is the state of one YM2149 voice, read from the chip
+// registers
+type ChannelState struct {
+	Period   int  // Tone period, 12 bits
+	Volume   int  // Fixed volume, 0 to 15
+	Envelope bool // Volume follows the envelope generator
+	Tone     bool // Tone enabled in the mixer
+	Noise    bool // Noise enabled in the mixer
+}
+
+// Level returns the voice volume from 0 to 1; envelope voices count as
+// full volume
+func (c ChannelState) Level() float64 {
+	if c.Envelope {
+		return 1
+	}
+	return float64(c.Volume) / 15
+}
+
+// Frequency returns the tone frequency in Hz, 0 when the tone is off
+func (c ChannelState) Frequency() float64 {
+	if !c.Tone || c.Period == 0 {
+		return 0
+	}
+	return ymClock / float64(16*c.Period)
+}
+
+// ChipPlayer is implemented by players of YM2149 tunes, whose chip
+// registers can drive the visuals
+type ChipPlayer interface {
+	// ChannelState returns the state of the three voices
+	ChannelState() [3]ChannelState
+}
+
+// TrackerPlayer is implemented by players of tracker modules and AHX
+// songs, whose position is a pattern row
+type TrackerPlayer interface {
+	// RowsBetween returns the rows starting after from and up to to
+	RowsBetween(from, to time.Duration) []mod.RowTime
+}
+
+// playingTune returns the tune heard: the tune of the scene playing when
+// the demo script gives scenes their own, the track playing of a
+// playlist, else the main tune
+func (g *Game) playingTune() MusicPlayer {
+	tune := g.music
+	for {
+		switch t := tune.(type) {
+		case *SceneMusic:
+			tune = t.Playing()
+		case *Playlist:
+			tune = t.Playing()
+		default:
+			return tune
+		}
+	}
+}
+
+// chipVoices returns the voices of the playing tune for the
+// register-driven effects, nil when the tune has no YM2149
+func (g *Game) chipVoices() []effects.Voice {
+	chip, ok := g.playingTune().(ChipPlayer)
+	if !ok {
+		return nil
+	}
+
+	states := chip.ChannelState()
+	voices := make([]effects.Voice, len(states))
+	for i, c := range states {
+		voices[i] = effects.Voice{
+			Level:     c.Level(),
+			Frequency: c.Frequency(),
+			Noise:     c.Noise,
+		}
+	}
+	return voices
+}
+
+// ymChannels decodes the three voices from the YM2149 registers
+func ymChannels(reg func(int) int) [3]ChannelState {
+	var voices [3]ChannelState
+	mixer := reg(7)
+	for i := range voices {
+		vol := reg(8 + i)
+		voices[i] = ChannelState{
+			Period:   (reg(i*2+1)&0x0f)<<8 | reg(i*2)&0xff,
+			Volume:   vol & 0x0f,
+			Envelope: vol&0x10 != 0,
+			Tone:     mixer&(1<<i) == 0,
+			Noise:    mixer&(8<<i) == 0,
+		}
+	}
+	return voices
+}
+
+// stereoPan returns the panning of the voices of YM tunes for a stereo
+// layout: abc puts voice A on the left, B in the center and C on the
+// right, the "Atari stereo" of ST emulators, acb puts C in the center and
+// B on the right, and mono keeps the three in the center. width is how
+// far toward the sides the side voices go, from 0 to 1.
+func stereoPan(layout string, width float64) ([3]float64, error) {
+	if width < 0 || width > 1 {
+		return [3]float64{}, fmt.Errorf("stereo width %g is not between 0 and 1", width)
+	}
+	switch layout {
+	case "abc":
+		return [3]float64{-width, 0, width}, nil
+	case "acb":
+		return [3]float64{-width, width, 0}, nil
+	case "mono":
+		return [3]float64{}, nil
+	}
+	return [3]float64{}, fmt.Errorf("unknown stereo layout %q, expected abc, acb or mono", layout)
+}
+
+// NewMusicPlayer detects the format of a tune, YM, SNDH, a tracker
+// module or an AHX song, and creates the matching player
+func NewMusicPlayer(data []byte, sampleRate int, loop bool) (MusicPlayer, error) {
+	if mod.Is(data) {
+		p, err := NewMODPlayer(data, sampleRate, loop)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if ahx.Is(data) {
+		p, err := NewAHXPlayer(data, sampleRate, loop)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	if sndh.Is(data) {
+		p, err := NewSNDHPlayer(data, sampleRate, loop)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+
+	p, err := NewYMPlayer(data, sampleRate, loop)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+)
+
+// MusicManager streams one tune at a time and crossfades from a tune to
+// the next: while the new tune fades in, the old one plays on, fading
+// out, so a change of tune between demo parts is not a hard cut. Like the
+// tunes it holds, it streams 16-bit stereo at the demo sample rate, or
+// 32-bit float stereo through ReadF32. It is not safe for concurrent use;
+// its owner locks around it.
+type MusicManager struct {
+	sampleRate int
+	current    MusicPlayer // nil until a tune is played
+	fading     MusicPlayer // Tune fading out, nil when none
+	fade       int64       // Length of the crossfade in samples
+	faded      int64       // Samples of the crossfade played
+	buf        []byte      // Samples of the tune fading out
+	conv       []byte      // 16-bit samples of a tune read as float
+}
+
+// NewMusicManager creates a manager playing no tune
+func NewMusicManager(sampleRate int) *MusicManager {
+	return &MusicManager{sampleRate: sampleRate}
+}
+
+// Current returns the tune playing or fading in, nil before the first
+func (m *MusicManager) Current() MusicPlayer {
+	return m.current
+}
+
+// Play switches to p, seeked to at, crossfading from the tune playing
+// over d. Without a tune playing, or with d 0, it cuts to p.
+func (m *MusicManager) Play(p MusicPlayer, at, d time.Duration) {
+	p.SeekTime(at)
+	m.fading = nil
+	if m.current != nil && m.current != p && d > 0 {
+		m.fading = m.current
+		m.fade = max(int64(d.Seconds()*float64(m.sampleRate)), 1)
+		m.faded = 0
+	}
+	m.current = p
+}
+
+// Stop drops the tunes, cutting to silence; the next Play starts cold
+func (m *MusicManager) Stop() {
+	m.current, m.fading = nil, nil
+}
+
+// Read fills p with the samples of the tune playing, mixed with the tune
+// fading out during a crossfade. The samples a tune ending leaves are
+// silent, so p is always filled.
+func (m *MusicManager) Read(p []byte) (n int, err error) {
+	return m.read(p, false), nil
+}
+
+// ReadF32 streams like Read in 32-bit float stereo, the crossfade mixed
+// in float so two loud tunes do not clip
+func (m *MusicManager) ReadF32(p []byte) (n int, err error) {
+	return m.read(p, true), nil
+}
+
+// stream returns the samples of t, in float when f32 is set
+func (m *MusicManager) stream(t MusicPlayer, f32 bool) io.Reader {
+	if f32 {
+		return floatOf(t, &m.conv)
+	}
+	return t
+}
+
+// read fills p like Read, with 32-bit float samples when f32 is set
+func (m *MusicManager) read(p []byte, f32 bool) int {
+	frame := frameSize(f32)
+	n := len(p) / frame * frame
+	p = p[:n]
+	if m.current == nil {
+		clear(p)
+		return n
+	}
+	read, _ := io.ReadFull(m.stream(m.current, f32), p)
+	clear(p[read:])
+	if m.fading == nil {
+		return n
+	}
+
+	if cap(m.buf) < n {
+		m.buf = make([]byte, n)
+	}
+	out := m.buf[:n]
+	read, _ = io.ReadFull(m.stream(m.fading, f32), out)
+	clear(out[read:])
+
+	// Equal-power gains keep the loudness even through the fade
+	for i := 0; i < n; i += frame {
+		x := math.Min(float64(m.faded+int64(i/frame))/float64(m.fade), 1)
+		in, fade := math.Sin(x*math.Pi/2), math.Cos(x*math.Pi/2)
+		if f32 {
+			for c := i; c < i+8; c += 4 {
+				a := float64(math.Float32frombits(binary.LittleEndian.Uint32(p[c:])))
+				b := float64(math.Float32frombits(binary.LittleEndian.Uint32(out[c:])))
+				binary.LittleEndian.PutUint32(p[c:], math.Float32bits(float32(a*in+b*fade)))
+			}
+			continue
+		}
+		for c := i; c < i+4; c += 2 {
+			a := float64(int16(uint16(p[c]) | uint16(p[c+1])<<8))
+			b := float64(int16(uint16(out[c]) | uint16(out[c+1])<<8))
+			v := clampSample(a*in + b*fade)
+			p[c], p[c+1] = byte(v), byte(v>>8)
+		}
+	}
+	m.faded += int64(n / frame)
+	if m.faded >= m.fade {
+		m.fading = nil
+	}
+	return n
+}
+
+// frameSize returns the bytes of a stereo sample: 4 in 16 bits, 8 in
+// 32-bit float
+func frameSize(f32 bool) int {
+	if f32 {
+		return 8
+	}
+	return 4
+}
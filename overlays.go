@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"bilizir-demo/sysfont"
+)
+
+const (
+	// nowPlayingShown is how long the now-playing panel stays up, and
+	// nowPlayingFade how long it takes to fade in and out
+	nowPlayingShown = 6 * time.Second
+	nowPlayingFade  = 400 * time.Millisecond
+
+	// overlayMargin is the distance of corner panels to the screen edges
+	overlayMargin = 12
+
+	// errorWrap is the width of the error screen text, in characters
+	errorWrap = 72
+
+	// progressChars is the width of the seek bar of the progress panel,
+	// in characters
+	progressChars = 40
+
+	// progressTitle heads the progress panel, whose time and seek bar are
+	// the demo timeline's rather than the tune heard's
+	progressTitle = "DEMO TIMELINE"
+)
+
+var (
+	progressTrack  = color.RGBA{200, 210, 255, 0x40} // Seek bar, ahead of the position
+	progressPlayed = color.RGBA{200, 210, 255, 0xc0} // Seek bar, behind it
+)
+
+// helpLines are the controls listed by the help overlay (H or F1)
+var helpLines = []string{
+	"Up/Down     Volume",
+	"Space       Pause/resume",
+	"R (hold)    Rewind",
+	"+/-         Animation speed",
+	"G           CPU/GPU scroller",
+	"S           Scroller style",
+	"`           Tweak console",
+	"F3          Frame profiler",
+	"F4          Safe-area guides",
+	"F5          Timeline editor",
+	"F9          Record a GIF",
+	"Shift+F5    Reload the scrolltext",
+	"B/Shift+B   A/B comparison, compared effect",
+	"Tab         Contributed screens gallery",
+	"Shift+Tab   Demo timeline (click the bar to seek)",
+	"E           Endless mode",
+	"L           Retro modes",
+	"V/Shift+V   50Hz PAL timing, vsync",
+	"P           Palette emulation",
+	"[ ] ; ' , . Brightness, contrast, gamma",
+	"\\           Reset the display adjustments",
+	"C           Calibrate the audio latency",
+	"Ctrl+F1-F8  Show/hide copper, logo, cubes, scroller,",
+	"            chip meter, 3D objects, stars, tunnel",
+	"N           Now playing",
+	"PgUp/PgDn   Previous/next track of the playlist",
+	"M           Playlist mode: one, all, shuffle",
+	"F11         Fullscreen (or Alt+Enter)",
+	"Esc         Quit",
+	"H/F1        This help",
+}
+
+// overlays are the on-screen panels: the tune now playing, shown as the
+// music starts and with N, the progress through the tune, and the help
+// listing the controls
+type overlays struct {
+	panel       Panel
+	playing     []string        // Lines of the now-playing panel
+	playingFrom time.Time       // When the now-playing panel was last shown
+	tune        MusicPlayer     // Tune the now-playing panel last showed
+	progress    bool            // Progress panel shown
+	seekBar     image.Rectangle // Seek bar of the progress panel, as last drawn
+	help        bool
+}
+
+// showNowPlaying brings up the now-playing panel for the current tune
+func (g *Game) showNowPlaying() {
+	if g.music == nil {
+		return
+	}
+	tune := g.playingTune()
+	g.overlays.tune = tune
+	info := tune.Info()
+	title := info.Title
+	if title == "" {
+		title = "Untitled"
+	}
+	o := &g.overlays
+	o.playing = []string{title}
+	if info.Author != "" {
+		o.playing = append(o.playing, "by "+info.Author)
+	}
+	details := info.Format
+	if info.Year != "" {
+		details += ", " + info.Year
+	}
+	if d := tune.Duration(); d > 0 {
+		details += fmt.Sprintf(", %d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+	}
+	o.playing = append(o.playing, details)
+	if l := g.activePlaylist(); l != nil {
+		n, total := l.Track()
+		o.playing = append(o.playing, fmt.Sprintf("Track %d/%d, playlist mode %v", n, total, l.Mode()))
+	}
+	o.playingFrom = time.Now()
+}
+
+// updateOverlays toggles the help and shows the tune again on request
+func (g *Game) updateOverlays() {
+	o := &g.overlays
+	f1 := inpututil.IsKeyJustPressed(ebiten.KeyF1) && !ebiten.IsKeyPressed(ebiten.KeyControl)
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) || f1 {
+		o.help = !o.help
+	}
+	if o.help && inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		o.help = false
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyN) {
+		g.showNowPlaying()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) && ebiten.IsKeyPressed(ebiten.KeyShift) {
+		o.progress = !o.progress
+	}
+	g.updateSeekBar()
+	// A scene playing its own tune brings it up as it starts
+	if o.tune != nil && g.playingTune() != o.tune {
+		g.showNowPlaying()
+	}
+}
+
+// updateSeekBar seeks the tune to where the seek bar is clicked
+func (g *Game) updateSeekBar() {
+	o := &g.overlays
+	if !g.showingProgress() || o.seekBar.Empty() || !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+	x, y := ebiten.CursorPosition()
+	if !image.Pt(x, y).In(o.seekBar) {
+		return
+	}
+	f := float64(x-o.seekBar.Min.X) / float64(o.seekBar.Dx())
+	g.seekMusic(time.Duration(f * float64(g.musicLength())))
+}
+
+// showingProgress reports whether the progress panel is up: toggled on,
+// with a tune of known length, and out of the way of the timeline editor
+// drawn in its place
+func (g *Game) showingProgress() bool {
+	return g.overlays.progress && g.musicLength() > 0 && !g.editor.open
+}
+
+// progressLines returns the lines of the progress panel: the tune heard,
+// the time elapsed and the total of the demo timeline, and a blank line
+// the seek bar is drawn over. With scene tunes or a playlist the tune
+// heard is not the timeline, which is why the panel is titled after it.
+func (g *Game) progressLines() []string {
+	info := g.playingTune().Info()
+	tune := info.Title
+	if tune == "" {
+		tune = "Untitled"
+	}
+	if info.Author != "" {
+		tune += " by " + info.Author
+	}
+	times := formatDuration(g.musicPosition()) + " / " + formatDuration(g.musicLength())
+	return []string{"Playing " + tune, times, strings.Repeat(" ", progressChars)}
+}
+
+// drawProgress draws the progress panel centered at the bottom of the
+// screen, filling its seek bar up to the timeline position
+func (g *Game) drawProgress(screen *ebiten.Image) {
+	o := &g.overlays
+	if !g.showingProgress() {
+		o.seekBar = image.Rectangle{}
+		return
+	}
+	lines := g.progressLines()
+	w, h := panelSize(progressTitle, lines)
+	safe := safeRect(screen.Bounds().Size(), g.safeInset)
+	x, y := safe.Min.X+(safe.Dx()-w)/2, safe.Max.Y-h-overlayMargin
+	o.panel.Draw(screen, x, y, 1, progressTitle, lines...)
+
+	barY := y + h - panelPadding - sysfont.LineHeight
+	o.seekBar = image.Rect(x+panelPadding, barY, x+w-panelPadding, barY+sysfont.LineHeight)
+	bx, bw := float32(o.seekBar.Min.X), float32(o.seekBar.Dx())
+	by := float32(barY + sysfont.LineHeight/2)
+	played := float32(min(g.musicPosition().Seconds()/g.musicLength().Seconds(), 1))
+	vector.StrokeLine(screen, bx, by, bx+bw, by, 2, progressTrack, false)
+	vector.StrokeLine(screen, bx, by, bx+bw*played, by, 2, progressPlayed, false)
+	vector.DrawFilledCircle(screen, bx+bw*played, by, 4, progressPlayed, false)
+}
+
+// drawOverlays draws the now-playing panel in the top right corner, the
+// progress panel at the bottom and the help in the middle of the screen
+func (g *Game) drawOverlays(screen *ebiten.Image) {
+	o := &g.overlays
+	if o.playing != nil {
+		// Fade in, hold, fade out
+		t := time.Since(o.playingFrom)
+		alpha := min(t, nowPlayingShown-t).Seconds() / nowPlayingFade.Seconds()
+		w, _ := panelSize("NOW PLAYING", o.playing)
+		safe := safeRect(screen.Bounds().Size(), g.safeInset)
+		o.panel.Draw(screen, safe.Max.X-w-overlayMargin, safe.Min.Y+overlayMargin, alpha, "NOW PLAYING", o.playing...)
+	}
+	g.drawProgress(screen)
+	if o.help {
+		o.panel.DrawCentered(screen, 1, "CONTROLS", helpLines...)
+	}
+}
+
+// fail replaces the demo with the error screen, rather than closing the
+// window on the user
+func (g *Game) fail(err error) {
+	log.Printf("The demo could not start: %v", err)
+	g.failure = err
+}
+
+// updateFailure quits from the error screen on Esc
+func (g *Game) updateFailure() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		return ebiten.Termination
+	}
+	return nil
+}
+
+// drawFailure draws the error screen
+func (g *Game) drawFailure(screen *ebiten.Image) {
+	screen.Fill(color.RGBA{16, 0, 24, 255})
+	lines := wrapText(g.failure.Error(), errorWrap)
+	lines = append(lines, "", "Press Esc to quit")
+	g.overlays.panel.DrawCentered(screen, 1, "THE DEMO COULD NOT START", lines...)
+}
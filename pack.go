@@ -0,0 +1,220 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// packFile is one entry of an exported demo pack
+type packFile struct {
+	name string
+	data []byte
+	mode fs.FileMode
+}
+
+// packOptions describes what goes into a demo pack
+type packOptions struct {
+	scriptPath string   // Demo script, included when it exists
+	livePath   string   // Effect parameter script, included when set
+	include    []string // Extra files chosen by the user
+}
+
+// exportPack bundles the running binary, its configuration and launch
+// scripts so a customized cut of the intro can be shared without Go
+// tooling. A path ending in .zip produces an archive, anything else a
+// folder. The pack holds the binary for the current platform only.
+func exportPack(out string, opts packOptions) error {
+	files, err := collectPackFiles(opts)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(out), ".zip") {
+		return writePackZip(out, files)
+	}
+	return writePackDir(out, files)
+}
+
+// collectPackFiles gathers the pack contents in memory
+func collectPackFiles(opts packOptions) ([]packFile, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate the demo binary: %w", err)
+	}
+	bin, err := os.ReadFile(exe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the demo binary: %w", err)
+	}
+
+	binName := "bilizir-demo"
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	files := []packFile{{name: binName, data: bin, mode: 0o755}}
+
+	// Configuration, replayed by the launch scripts
+	var args []string
+	if data, err := os.ReadFile(opts.scriptPath); err == nil {
+		files = append(files, packFile{name: "demo.script", data: data, mode: 0o644})
+		args = append(args, "-script", "demo.script")
+	}
+	if opts.livePath != "" {
+		data, err := os.ReadFile(opts.livePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read live script: %w", err)
+		}
+		files = append(files, packFile{name: "effects.txt", data: data, mode: 0o644})
+		args = append(args, "-live", "effects.txt")
+	}
+
+	// The extra files share one folder, so two of the same name, told
+	// apart only by case on Windows and macOS, would overwrite each other.
+	// The launch scripts list them separated by commas.
+	var included []string
+	from := map[string]string{}
+	for _, path := range opts.include {
+		base := filepath.Base(path)
+		if strings.ContainsAny(base, ",\"%") {
+			return nil, fmt.Errorf("%s: the launch scripts cannot pass a file name with a comma, quote or percent sign", path)
+		}
+		if other, ok := from[strings.ToLower(base)]; ok {
+			return nil, fmt.Errorf("%s and %s would both be packed as assets/%s", other, path, base)
+		}
+		from[strings.ToLower(base)] = path
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		name := "assets/" + base
+		files = append(files, packFile{name: name, data: data, mode: 0o644})
+		included = append(included, name)
+	}
+	includeArgs, err := packIncludeArgs(included)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, includeArgs...)
+
+	return append(files, launchScripts(binName, args)...), nil
+}
+
+// packIncludeArgs returns the flags the launch scripts pass for the extra
+// files of a pack, by their extension: the first tune plays with -music
+// and the others after it with -playlist, a .txt file is the scrolltext,
+// .font descriptors the scroller fonts (with their .png images next to
+// them), TrueType and OpenType fonts the fallback fonts, and a .toml or
+// .json file the configuration. A file the demo would not use is an
+// error rather than dead weight in the pack.
+func packIncludeArgs(names []string) ([]string, error) {
+	var music, playlist, scrolltext, fonts, fallback, config []string
+	for _, name := range names {
+		switch ext := strings.ToLower(filepath.Ext(name)); {
+		case isTuneFile(name):
+			if len(music) == 0 {
+				music = append(music, name)
+			} else {
+				playlist = append(playlist, name)
+			}
+		case ext == ".txt":
+			scrolltext = append(scrolltext, name)
+		case ext == ".font":
+			fonts = append(fonts, name)
+		case ext == ".png":
+			// Font images, read through the descriptors naming them
+		case ext == ".ttf" || ext == ".otf":
+			fallback = append(fallback, name)
+		case ext == ".toml" || ext == ".json":
+			config = append(config, name)
+		default:
+			return nil, fmt.Errorf("%s: the packed demo has no use for this file; -pack-include takes tunes, a .txt scrolltext, .font fonts with their .png images, .ttf or .otf fallback fonts and a .toml or .json configuration", name)
+		}
+	}
+	if len(scrolltext) > 1 || len(config) > 1 {
+		return nil, fmt.Errorf("-pack-include takes one scrolltext and one configuration file")
+	}
+
+	var args []string
+	for _, f := range []struct {
+		flag  string
+		names []string
+	}{
+		{"-music", music},
+		{"-playlist", playlist},
+		{"-scrolltext", scrolltext},
+		{"-fonts", fonts},
+		{"-fallback-fonts", fallback},
+		{"-config", config},
+	} {
+		if len(f.names) > 0 {
+			args = append(args, f.flag, strings.Join(f.names, ","))
+		}
+	}
+	return args, nil
+}
+
+// launchScripts returns a launcher per OS running the binary from the
+// pack folder with the packed configuration, each argument quoted for
+// the shell running it
+func launchScripts(binName string, args []string) []packFile {
+	sh := make([]string, len(args))
+	bat := make([]string, len(args))
+	for i, a := range args {
+		sh[i] = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		bat[i] = `"` + strings.ReplaceAll(a, "%", "%%") + `"`
+	}
+	shScript := fmt.Sprintf("#!/bin/sh\ncd \"$(dirname \"$0\")\"\nexec ./%s %s \"$@\"\n", binName, strings.Join(sh, " "))
+	batScript := fmt.Sprintf("@echo off\r\ncd /d \"%%~dp0\"\r\n%s %s %%*\r\n", binName, strings.Join(bat, " "))
+	return []packFile{
+		{name: "run.sh", data: []byte(shScript), mode: 0o755},
+		{name: "run.command", data: []byte(shScript), mode: 0o755}, // Double-clickable in the macOS Finder
+		{name: "run.bat", data: []byte(batScript), mode: 0o644},
+	}
+}
+
+// writePackDir writes the pack as a folder
+func writePackDir(dir string, files []packFile) error {
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, f.data, f.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePackZip writes the pack as a zip archive under a top-level folder
+func writePackZip(path string, files []packFile) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	root := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	zw := zip.NewWriter(out)
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: root + "/" + f.name, Method: zip.Deflate}
+		hdr.SetMode(f.mode)
+		w, err := zw.CreateHeader(hdr)
+		if err == nil {
+			_, err = w.Write(f.data)
+		}
+		if err != nil {
+			zw.Close()
+			out.Close()
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+
+	"bilizir-demo/effects"
+)
+
+//go:embed shaders/palette.kage
+var paletteShaderSrc []byte
+
+// PaletteMode selects the hardware palette the output is rounded to
+type PaletteMode int
+
+const (
+	PaletteFull PaletteMode = iota // No rounding, full 24-bit output
+	PaletteST                      // 3 bits per channel, 512 colors
+	PaletteSTE                     // 4 bits per channel, 4096 colors
+)
+
+// String returns a human readable name for the mode
+func (m PaletteMode) String() string {
+	switch m {
+	case PaletteST:
+		return "ST 512 colors"
+	case PaletteSTE:
+		return "STE 4096 colors"
+	default:
+		return "full color"
+	}
+}
+
+// levels returns the number of levels per color channel
+func (m PaletteMode) levels() float32 {
+	switch m {
+	case PaletteST:
+		return 8
+	case PaletteSTE:
+		return 16
+	default:
+		return 256
+	}
+}
+
+// setCopperColors selects where the copper bar colors come from: "image"
+// for bars.png, or "st", "ste" or "full" for strips generated from code
+// and rounded to that palette
+func (g *Game) setCopperColors(name string) error {
+	var mode PaletteMode
+	switch name {
+	case "image":
+		return nil
+	case "st":
+		mode = PaletteST
+	case "ste":
+		mode = PaletteSTE
+	case "full":
+		mode = PaletteFull
+	default:
+		return fmt.Errorf("unknown copper colors %q, expected image, st, ste or full", name)
+	}
+	g.copper.SetGeneratedPalette(effects.CopperPalette{Levels: int(mode.levels())})
+	return nil
+}
+
+// setPaletteMode switches the palette emulation pass
+func (g *Game) setPaletteMode(mode PaletteMode) {
+	g.paletteMode = mode
+	if g.palettePass != nil {
+		g.palettePass.Enabled = mode != PaletteFull
+	}
+}
+
+// initPalettePass registers the palette emulation pass on the post chain
+func (g *Game) initPalettePass() error {
+	pass, err := g.post.Add("palette", paletteShaderSrc, func() map[string]any {
+		return map[string]any{
+			"Levels": g.paletteMode.levels(),
+		}
+	})
+	if err != nil {
+		return err
+	}
+	g.palettePass = pass
+	g.setPaletteMode(g.paletteMode)
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	_ "embed"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"bilizir-demo/sysfont"
+)
+
+//go:embed shaders/panel.kage
+var panelShaderSrc []byte
+
+// Panel metrics, in pixels: the margin around the text and the corner
+// radius
+const (
+	panelPadding = 10
+	panelRadius  = 8
+)
+
+var (
+	panelTint   = color.RGBA{16, 20, 40, 0x90}    // Darkens and cools the glass
+	panelBorder = color.RGBA{200, 210, 255, 0x50} // Edge of the glass
+	panelRule   = color.RGBA{200, 210, 255, 0x60} // Line under the title
+)
+
+// Panel draws the boxes of the on-screen UI (now playing, help, error
+// screen) alike: a pane of frosted glass, the frame behind it blurred and
+// tinted with rounded corners, holding lines of small text under an
+// optional title. Without the shader the pane is a flat tint.
+type Panel struct {
+	shader   *ebiten.Shader
+	backdrop *ebiten.Image // Frame behind the pane
+	canvas   *ebiten.Image // Pane with its text, faded onto the screen
+}
+
+// Init compiles the glass shader
+func (p *Panel) Init() error {
+	shader, err := ebiten.NewShader(panelShaderSrc)
+	if err != nil {
+		return err
+	}
+	p.shader = shader
+	return nil
+}
+
+// panelSize returns the size of a panel fitting a title and lines
+func panelSize(title string, lines []string) (w, h int) {
+	w, _ = sysfont.Measure(title, sysfont.Style{})
+	for _, l := range lines {
+		w = max(w, len([]rune(l))*sysfont.CharWidth)
+	}
+	rows := len(lines)
+	if title != "" {
+		rows++
+	}
+	w += 2 * panelPadding
+	h = rows*sysfont.LineHeight + 2*panelPadding
+	if title != "" && len(lines) > 0 {
+		h += panelPadding / 2
+	}
+	return w, h
+}
+
+// Draw draws a panel holding title and lines with its top left corner at
+// x, y, faded by alpha from 0 to 1
+func (p *Panel) Draw(screen *ebiten.Image, x, y int, alpha float64, title string, lines ...string) {
+	if alpha <= 0 {
+		return
+	}
+	w, h := panelSize(title, lines)
+	p.allocate(w, h)
+	r := image.Rect(0, 0, w, h)
+	canvas := p.canvas.SubImage(r).(*ebiten.Image)
+	canvas.Clear()
+
+	if p.shader != nil {
+		backdrop := p.backdrop.SubImage(r).(*ebiten.Image)
+		backdrop.Clear()
+		backdrop.DrawImage(screen.SubImage(r.Add(image.Pt(x, y))).(*ebiten.Image), nil)
+
+		op := &ebiten.DrawRectShaderOptions{}
+		op.Images[0] = backdrop
+		op.Uniforms = map[string]any{
+			"Radius": float32(panelRadius),
+			"Tint":   colorUniform(panelTint),
+			"Border": colorUniform(panelBorder),
+		}
+		canvas.DrawRectShader(w, h, p.shader, op)
+	} else {
+		vector.DrawFilledRect(canvas, 0, 0, float32(w), float32(h), color.RGBA{0, 0, 0, 0xc0}, false)
+	}
+
+	ty := panelPadding
+	if title != "" {
+		sysfont.Print(canvas, title, panelPadding, ty, sysfont.Style{})
+		ty += sysfont.LineHeight
+		if len(lines) > 0 {
+			ry := float32(ty + panelPadding/4)
+			vector.StrokeLine(canvas, panelPadding, ry, float32(w-panelPadding), ry, 1, panelRule, false)
+			ty += panelPadding / 2
+		}
+	}
+	for _, l := range lines {
+		sysfont.Print(canvas, l, panelPadding, ty, sysfont.Style{})
+		ty += sysfont.LineHeight
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(x), float64(y))
+	op.ColorScale.ScaleAlpha(float32(min(alpha, 1)))
+	screen.DrawImage(canvas, op)
+}
+
+// DrawCentered draws a panel in the middle of the screen
+func (p *Panel) DrawCentered(screen *ebiten.Image, alpha float64, title string, lines ...string) {
+	w, h := panelSize(title, lines)
+	b := screen.Bounds()
+	p.Draw(screen, (b.Dx()-w)/2, (b.Dy()-h)/2, alpha, title, lines...)
+}
+
+// allocate grows the backdrop and the canvas to fit a w x h panel
+func (p *Panel) allocate(w, h int) {
+	if p.canvas != nil {
+		b := p.canvas.Bounds()
+		if b.Dx() >= w && b.Dy() >= h {
+			return
+		}
+		w, h = max(w, b.Dx()), max(h, b.Dy())
+		p.canvas.Deallocate()
+		p.backdrop.Deallocate()
+	}
+	p.canvas = ebiten.NewImage(w, h)
+	p.backdrop = ebiten.NewImage(w, h)
+}
+
+// colorUniform returns a color as a shader vec4, not premultiplied
+func colorUniform(c color.RGBA) []float32 {
+	return []float32{float32(c.R) / 255, float32(c.G) / 255, float32(c.B) / 255, float32(c.A) / 255}
+}
+
+// wrapText breaks s into lines of at most width characters, at spaces
+// where it can
+func wrapText(s string, width int) []string {
+	var lines []string
+	for _, para := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(para) {
+			for len(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				lines = append(lines, word[:width])
+				word = word[width:]
+			}
+			switch {
+			case line == "":
+				line = word
+			case len(line)+1+len(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Param is a named, live-tweakable demo parameter
+type Param struct {
+	Name  string
+	Value float64
+	Min   float64
+	Max   float64
+	Step  float64 // Increment used by interactive editors
+
+	// Interpolation state, active while blend < 1
+	from, to float64
+	blend    float64
+	duration float64
+}
+
+// Params is the set of parameters driving the demo effects
+type Params struct {
+	list   []*Param
+	byName map[string]*Param
+}
+
+// NewParams creates an empty parameter set
+func NewParams() *Params {
+	return &Params{byName: map[string]*Param{}}
+}
+
+// Define adds a parameter with its default value and range
+func (ps *Params) Define(name string, value, minVal, maxVal, step float64) {
+	p := &Param{Name: name, Value: value, Min: minVal, Max: maxVal, Step: step, blend: 1}
+	ps.list = append(ps.list, p)
+	ps.byName[name] = p
+}
+
+// List returns the parameters in definition order
+func (ps *Params) List() []*Param {
+	return ps.list
+}
+
+// Names returns the parameter names sorted alphabetically
+func (ps *Params) Names() []string {
+	names := make([]string, 0, len(ps.list))
+	for _, p := range ps.list {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Value returns the current value of the named parameter and whether it
+// exists, so effects can read parameters through effects.Params
+func (ps *Params) Value(name string) (float64, bool) {
+	p, ok := ps.byName[name]
+	if !ok {
+		return 0, false
+	}
+	return p.Value, true
+}
+
+// Lookup returns the named parameter
+func (ps *Params) Lookup(name string) (*Param, error) {
+	p, ok := ps.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown parameter %q", name)
+	}
+	return p, nil
+}
+
+// Get returns the current value of a parameter, 0 if it does not exist
+func (ps *Params) Get(name string) float64 {
+	if p, ok := ps.byName[name]; ok {
+		return p.Value
+	}
+	return 0
+}
+
+// Set changes a parameter immediately, cancelling any interpolation
+func (ps *Params) Set(name string, value float64) error {
+	p, err := ps.Lookup(name)
+	if err != nil {
+		return err
+	}
+	p.Value = p.clamp(value)
+	p.blend = 1
+	return nil
+}
+
+// TweenTo moves a parameter smoothly to value over duration seconds
+func (ps *Params) TweenTo(name string, value, duration float64) error {
+	p, err := ps.Lookup(name)
+	if err != nil {
+		return err
+	}
+	if duration <= 0 {
+		return ps.Set(name, value)
+	}
+	p.from = p.Value
+	p.to = p.clamp(value)
+	p.blend = 0
+	p.duration = duration
+	return nil
+}
+
+// Update advances the running interpolations by dt seconds
+func (ps *Params) Update(dt float64) {
+	for _, p := range ps.list {
+		if p.blend >= 1 {
+			continue
+		}
+		p.blend += dt / p.duration
+		if p.blend >= 1 {
+			p.blend = 1
+			p.Value = p.to
+			continue
+		}
+		// Smoothstep easing so changes start and land gently
+		t := p.blend * p.blend * (3 - 2*p.blend)
+		p.Value = p.from + (p.to-p.from)*t
+	}
+}
+
+// clamp limits value to the parameter range
+func (p *Param) clamp(value float64) float64 {
+	return min(max(value, p.Min), p.Max)
+}
+
+// defineDemoParams registers the parameters read by the intro effects
+func (g *Game) defineDemoParams() {
+	g.params = NewParams()
+	g.params.Define("copper.speed1", 3, -16, 16, 1)
+	g.params.Define("copper.speed2", -5, -16, 16, 1)
+	g.params.Define("copper.spread1", 7, 0, 32, 1)
+	g.params.Define("copper.spread2", 10, 0, 32, 1)
+	g.params.Define("copper.cycle", 0, -10, 10, 0.5)
+	g.params.Define("copper.count", 0, 0, 2000, 10)
+	g.params.Define("copper.thickness", 2, 1, 32, 1)
+	g.params.Define("copper.amplitude", 260, 0, 600, 10)
+	g.params.Define("copper.frequency", 2, 0, 8, 1)
+	g.params.Define("logo.speed", 0.05, 0, 0.5, 0.01)
+	g.params.Define("cubes.speed", 0.04, 0, 0.5, 0.01)
+	g.params.Define("cubes.spin", 1, 0, 5, 0.1)
+	g.params.Define("cubes.count", 12, 0, 2000, 1)
+	g.params.Define("cubes.morph", 1.5, 0.1, 10, 0.1)
+	g.params.Define("scroll.speed", 4, 0, 16, 0.5)
+	g.params.Define("scroll.wave_speed", 0.1, 0, 1, 0.01)
+	g.params.Define("scroll.bounce_height", 60, 0, 200, 5)
+	g.params.Define("scroll.bounce_freq", 0.5, 0, 4, 0.05)
+	g.params.Define("scroll.bounce_spread", 0.6, 0, 3, 0.05)
+	g.params.Define("scroll.bounce_tilt", 0.2, 0, 1, 0.02)
+	g.params.Define("meter.decay", 0.03, 0, 0.2, 0.005)
+	g.params.Define("scope.gain", 1.5, 0, 8, 0.1)
+	g.params.Define("stars.count", 300, 0, 5000, 10)
+	g.params.Define("stars.speed", 1, 0, 8, 0.1)
+	g.params.Define("tunnel.speed", 1, 0, 8, 0.1)
+	g.params.Define("fire.intensity", 1, 0, 2, 0.05)
+	g.params.Define("fire.wind", 0, -2, 2, 0.1)
+	g.params.Define("fire.haze", 3, 0, 12, 0.5)
+	g.params.Define("particles.wind", 0.05, -0.5, 0.5, 0.01)
+	g.params.Define("particles.gravity", 0.03, -0.5, 0.5, 0.01)
+	g.params.Define("waterfall.cycle", 1, 0, 4, 0.1)
+	g.params.Define("balls.spin", 1, 0, 5, 0.1)
+	g.params.Define("raymarch.twist", 1.2, 0, 4, 0.05)
+	g.params.Define("raymarch.resolution", 0.5, 0.25, 1, 0.05)
+	g.params.Define("mirror.axis", 0.5, 0, 1, 0.01)
+	g.params.Define("mirror.sway", 0.05, 0, 0.5, 0.01)
+	g.params.Define("mirror.spin", 0.3, -4, 4, 0.05)
+	g.params.Define("zoomblur.follow", 1, 0, 1, 1)
+	g.params.Define("zoomblur.x", 0.5, 0, 1, 0.01)
+	g.params.Define("zoomblur.y", 0.3, 0, 1, 0.01)
+	g.params.Define("zoomblur.strength", 0, 0, 0.5, 0.01)
+	g.params.Define("zoomblur.pulse", 0.05, 0, 0.5, 0.01)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// revealPiP is the reveal of scenes entering as a picture-in-picture
+// preview: the scene plays live in a small framed window in the corner
+// while the scene before it carries on full screen, then the window grows
+// to fill the screen
+const revealPiP = "pip"
+
+// Picture-in-picture metrics: the size of the preview as a fraction of
+// the screen, its distance to the screen edges and frame width at 800x600
+const (
+	pipScale  = 0.3
+	pipMargin = 24
+	pipFrame  = 3
+)
+
+// pipFrameColor is the color of the frame around the preview
+var pipFrameColor = color.RGBA{0xe0, 0xe0, 0xff, 0xff}
+
+// drawPiP draws a scene rendered to layer as a picture-in-picture at the
+// given fade level: over the first half of its fade the preview pops up in
+// the bottom right corner, over the second half it grows to fill the
+// screen, its frame thinning away. Fading out runs the same way back.
+func (g *Game) drawPiP(screen, layer *ebiten.Image, alpha float64) {
+	b := screen.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+	sx := g.layout.ScaleX
+	pop := min(alpha/0.1, 1)
+	grow := max(2*alpha-1, 0)
+	grow = grow * grow * (3 - 2*grow)
+
+	// From the corner to the whole screen
+	k := pipScale + (1-pipScale)*grow
+	margin := pipMargin * sx * (1 - grow)
+	x := (w - margin - w*k) * (1 - grow)
+	y := (h - margin - h*k) * (1 - grow)
+
+	if border := float32(pipFrame * sx * (1 - grow)); border > 0 {
+		c := pipFrameColor
+		c.A = uint8(float64(c.A) * pop)
+		vector.DrawFilledRect(screen, float32(x)-border, float32(y)-border, float32(w*k)+2*border, float32(h*k)+2*border, c, false)
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(k, k)
+	op.GeoM.Translate(x, y)
+	op.ColorScale.ScaleAlpha(float32(pop))
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(layer, op)
+}
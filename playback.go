@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// playbackState is the volume, pause and last read time the players share.
+// Its mutex also guards the state of the player embedding it, Read holding
+// it while it renders.
+type playbackState struct {
+	mutex    sync.Mutex
+	volume   float64
+	paused   bool
+	lastRead time.Time // When the audio device last pulled samples
+}
+
+// SetVolume sets the playback volume (0.0 to 1.0)
+func (s *playbackState) SetVolume(volume float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.volume = volume
+}
+
+// GetVolume returns the current volume
+func (s *playbackState) GetVolume() float64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.volume
+}
+
+// Pause freezes playback; Read outputs silence until Resume is called
+func (s *playbackState) Pause() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paused = true
+}
+
+// Resume continues playback from where it was paused
+func (s *playbackState) Resume() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paused = false
+}
+
+// Paused reports whether playback is paused
+func (s *playbackState) Paused() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.paused
+}
+
+// LastRead returns when the audio device last read samples, or the zero
+// time if it has not started yet
+func (s *playbackState) LastRead() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastRead
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"bilizir-demo/mod"
+)
+
+const (
+	// playlistDir is the folder of the embedded assets whose tunes play
+	// after the main one. No tunes ship in it: it is there for builds
+	// that drop theirs in, and may be missing.
+	playlistDir = "assets/playlist"
+
+	// normalizeWindow is how much of a tune is rendered to measure its
+	// loudness, normalizeTarget the RMS level tunes are brought to, and
+	// normalizeMaxGain how far a quiet tune is raised at most
+	normalizeWindow  = 30 * time.Second
+	normalizeTarget  = 0.15
+	normalizeMaxGain = 4
+)
+
+// tuneExtensions are the extensions of the tunes a playlist folder is
+// searched for
+var tuneExtensions = []string{".ym", ".sndh", ".snd", ".mod", ".s3m", ".xm", ".ahx", ".hvl"}
+
+// playlistMode is what a playlist plays when a track ends
+type playlistMode int
+
+const (
+	playlistAll     playlistMode = iota // The next track, the first after the last
+	playlistOne                         // The same track again
+	playlistShuffle                     // Another track at random
+)
+
+func (m playlistMode) String() string {
+	switch m {
+	case playlistOne:
+		return "one"
+	case playlistShuffle:
+		return "shuffle"
+	}
+	return "all"
+}
+
+// parsePlaylistMode parses the -playlist-mode flag
+func parsePlaylistMode(s string) (playlistMode, error) {
+	for m := playlistAll; m <= playlistShuffle; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown playlist mode %q, expected one, all or shuffle", s)
+}
+
+// playlistEntry is a tune of the playlist before it is loaded
+type playlistEntry struct {
+	name string
+	data []byte
+}
+
+// playlistEntries lists the tunes played after the main one: those of the
+// embedded playlist folder, then those of spec, comma-separated files or
+// folders of tunes
+func playlistEntries(spec string) ([]playlistEntry, error) {
+	var entries []playlistEntry
+	embedded, err := fs.ReadDir(assetFS, playlistDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Failed to list the embedded playlist: %v", err)
+	}
+	for _, e := range embedded {
+		if e.IsDir() || !isTuneFile(e.Name()) {
+			continue
+		}
+		data, err := fs.ReadFile(assetFS, path.Join(playlistDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, playlistEntry{name: e.Name(), data: data})
+	}
+
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		files := []string{p}
+		if info, err := os.Stat(p); err == nil && info.IsDir() {
+			dir, err := os.ReadDir(p)
+			if err != nil {
+				return nil, err
+			}
+			files = files[:0]
+			for _, e := range dir {
+				if !e.IsDir() && isTuneFile(e.Name()) {
+					files = append(files, filepath.Join(p, e.Name()))
+				}
+			}
+		}
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, playlistEntry{name: filepath.Base(f), data: data})
+		}
+	}
+	return entries, nil
+}
+
+// isTuneFile reports whether a file name has the extension of a tune
+func isTuneFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range tuneExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// playlistTrack is a tune of a playlist and the gain bringing it to the
+// loudness of the others
+type playlistTrack struct {
+	name   string
+	player MusicPlayer
+	gain   float64
+}
+
+// Playlist plays tunes one after the other, switched with Next and Prev,
+// and on its own as a track ends as its mode says. Each track plays at the
+// volume set times its gain, so quiet and loud tunes sound alike. It
+// streams like any tune, its time being that of the track playing.
+type Playlist struct {
+	playbackState
+
+	tracks  []playlistTrack
+	mode    playlistMode
+	rng     *rand.Rand
+	current int
+	conv    []byte // 16-bit samples of a track read as float
+}
+
+// NewPlaylist loads the tunes of entries, measuring their loudness, and
+// starts the first. Tunes failing to load are left out; it fails when none
+// loads.
+func NewPlaylist(entries []playlistEntry, sampleRate int, mode playlistMode) (*Playlist, error) {
+	tracks := make([]playlistTrack, len(entries))
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := NewMusicPlayer(e.data, sampleRate, false)
+			if err != nil {
+				log.Printf("Playlist: %s: %v", e.name, err)
+				return
+			}
+			tracks[i] = playlistTrack{name: e.name, player: p, gain: tuneGain(e.data, sampleRate)}
+		}()
+	}
+	wg.Wait()
+
+	l := &Playlist{mode: mode, rng: rand.New(rand.NewSource(time.Now().UnixNano())), playbackState: playbackState{volume: 0.5}}
+	for _, t := range tracks {
+		if t.player != nil {
+			l.tracks = append(l.tracks, t)
+		}
+	}
+	if len(l.tracks) == 0 {
+		return nil, fmt.Errorf("no tune of the playlist could be loaded")
+	}
+	l.setVolumes()
+	return l, nil
+}
+
+// tuneGain renders the start of a tune to measure its loudness, and
+// returns the gain bringing it to normalizeTarget without clipping its
+// loudest sample. A tune that cannot be measured keeps its level.
+func tuneGain(data []byte, sampleRate int) float64 {
+	p, err := NewMusicPlayer(data, sampleRate, false)
+	if err != nil {
+		return 1
+	}
+	defer p.Close()
+	p.SetVolume(1)
+
+	buf := make([]byte, sampleRate/50*4)
+	var sum, peak float64
+	var count int64
+	for limit := int64(normalizeWindow.Seconds()) * int64(sampleRate) * 2; count < limit; {
+		n, err := p.Read(buf)
+		for i := 0; i+1 < n; i += 2 {
+			v := float64(int16(uint16(buf[i])|uint16(buf[i+1])<<8)) / 32768
+			sum += v * v
+			peak = max(peak, math.Abs(v))
+		}
+		count += int64(n / 2)
+		if err != nil || n == 0 {
+			break
+		}
+	}
+	if count == 0 || sum == 0 {
+		return 1
+	}
+	rms := math.Sqrt(sum / float64(count))
+	return min(normalizeTarget/rms, 1/peak, normalizeMaxGain)
+}
+
+// setVolumes sets the volume of every track, times its gain
+func (l *Playlist) setVolumes() {
+	for _, t := range l.tracks {
+		t.player.SetVolume(l.volume * t.gain)
+	}
+}
+
+// Read implements io.Reader for audio streaming, going on to the track
+// the mode picks as one ends
+func (l *Playlist) Read(p []byte) (n int, err error) {
+	return l.read(p, false), nil
+}
+
+// ReadF32 streams like Read in 32-bit float stereo
+func (l *Playlist) ReadF32(p []byte) (n int, err error) {
+	return l.read(p, true), nil
+}
+
+// F32 returns the playlist as a 32-bit float stream for the audio device
+func (l *Playlist) F32() io.ReadSeeker {
+	return floatStream{tune: l, read: l.ReadF32}
+}
+
+// read fills p like Read, with 32-bit float samples when f32 is set
+func (l *Playlist) read(p []byte, f32 bool) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lastRead = time.Now()
+	frame := frameSize(f32)
+	n := len(p) / frame * frame
+
+	// Output silence while paused, keeping the audio stream alive
+	if l.paused {
+		clear(p[:n])
+		return n
+	}
+
+	// A track giving nothing moves on; once every track did, the rest is
+	// silence
+	for done, ended := 0, 0; done < n; {
+		var track io.Reader = l.tracks[l.current].player
+		if f32 {
+			track = floatOf(l.tracks[l.current].player, &l.conv)
+		}
+		read, err := track.Read(p[done:n])
+		done += read / frame * frame
+		if err == nil && read > 0 {
+			ended = 0
+			continue
+		}
+		if ended++; ended > len(l.tracks) {
+			clear(p[done:n])
+			break
+		}
+		l.play(l.following())
+	}
+	return n
+}
+
+// following returns the track the mode plays after the current one
+func (l *Playlist) following() int {
+	switch {
+	case l.mode == playlistOne:
+		return l.current
+	case l.mode == playlistShuffle && len(l.tracks) > 1:
+		next := l.rng.Intn(len(l.tracks) - 1)
+		if next >= l.current {
+			next++
+		}
+		return next
+	}
+	return (l.current + 1) % len(l.tracks)
+}
+
+// play starts track i from its beginning
+func (l *Playlist) play(i int) {
+	l.current = i
+	l.tracks[i].player.SeekTime(0)
+}
+
+// Next switches to the next track, or one at random in shuffle mode
+func (l *Playlist) Next() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.mode == playlistShuffle {
+		l.play(l.following())
+		return
+	}
+	l.play((l.current + 1) % len(l.tracks))
+}
+
+// Prev switches to the track before, the last from the first
+func (l *Playlist) Prev() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.play((l.current + len(l.tracks) - 1) % len(l.tracks))
+}
+
+// Mode returns what the playlist plays as a track ends
+func (l *Playlist) Mode() playlistMode {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.mode
+}
+
+// SetMode sets what the playlist plays as a track ends
+func (l *Playlist) SetMode(m playlistMode) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.mode = m
+}
+
+// Track returns the number of the track playing from 1, and the number
+// of tracks
+func (l *Playlist) Track() (n, total int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.current + 1, len(l.tracks)
+}
+
+// Playing returns the tune of the track playing
+func (l *Playlist) Playing() MusicPlayer {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.tracks[l.current].player
+}
+
+// SetVolume sets the playback volume (0.0 to 1.0) of the playlist
+func (l *Playlist) SetVolume(volume float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.volume = volume
+	l.setVolumes()
+}
+
+// Seek implements io.Seeker within the track playing
+func (l *Playlist) Seek(offset int64, whence int) (int64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.tracks[l.current].player.Seek(offset, whence)
+}
+
+// SeekTime moves playback to t in the track playing
+func (l *Playlist) SeekTime(t time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.tracks[l.current].player.SeekTime(t)
+}
+
+// MusicPosition returns the current time in the track playing
+func (l *Playlist) MusicPosition() time.Duration {
+	return l.Playing().MusicPosition()
+}
+
+// Duration returns the length of the track playing, 0 when unknown
+func (l *Playlist) Duration() time.Duration {
+	return l.Playing().Duration()
+}
+
+// Info returns the metadata of the track playing
+func (l *Playlist) Info() TuneInfo {
+	return l.Playing().Info()
+}
+
+// RowsBetween returns the rows of the track playing when it is a tracker
+// tune
+func (l *Playlist) RowsBetween(from, to time.Duration) []mod.RowTime {
+	if tracker, ok := l.Playing().(TrackerPlayer); ok {
+		return tracker.RowsBetween(from, to)
+	}
+	return nil
+}
+
+// Close releases every track
+func (l *Playlist) Close() error {
+	var err error
+	for _, t := range l.tracks {
+		if e := t.player.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// activePlaylist returns the playlist playing, under the scene tunes of
+// the demo script if any, nil without one
+func (g *Game) activePlaylist() *Playlist {
+	tune := g.music
+	if s, ok := tune.(*SceneMusic); ok {
+		tune = s.main
+	}
+	l, _ := tune.(*Playlist)
+	return l
+}
+
+// updatePlaylist switches track with PgUp and PgDn, the visuals following
+// the new track, and cycles the playlist mode with M
+func (g *Game) updatePlaylist() {
+	l := g.activePlaylist()
+	if l == nil || g.console.open {
+		return
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+		g.playlistMode = (l.Mode() + 1) % (playlistShuffle + 1)
+		l.SetMode(g.playlistMode)
+		g.showNowPlaying()
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageDown):
+		l.Next()
+	case inpututil.IsKeyJustPressed(ebiten.KeyPageUp):
+		l.Prev()
+	default:
+		return
+	}
+	g.clock.seek(g.heardPosition())
+}
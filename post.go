@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// PostEffect is a full-screen shader pass applied to the finished frame
+type PostEffect struct {
+	Name     string
+	Enabled  bool
+	shader   *ebiten.Shader
+	uniforms func() map[string]any
+}
+
+// PostChain applies the enabled post effects in order
+type PostChain struct {
+	passes  []*PostEffect
+	buffers [2]*ebiten.Image
+}
+
+// NewPostChain creates an empty chain working on width x height frames
+func NewPostChain(width, height int) *PostChain {
+	return &PostChain{
+		buffers: [2]*ebiten.Image{
+			ebiten.NewImage(width, height),
+			ebiten.NewImage(width, height),
+		},
+	}
+}
+
+// Resize reallocates the intermediate buffers for a new frame size
+func (c *PostChain) Resize(width, height int) {
+	for i, b := range c.buffers {
+		b.Deallocate()
+		c.buffers[i] = ebiten.NewImage(width, height)
+	}
+}
+
+// Add compiles a shader and appends it to the chain, disabled
+func (c *PostChain) Add(name string, src []byte, uniforms func() map[string]any) (*PostEffect, error) {
+	shader, err := ebiten.NewShader(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile %s shader: %w", name, err)
+	}
+
+	pass := &PostEffect{
+		Name:     name,
+		shader:   shader,
+		uniforms: uniforms,
+	}
+	c.passes = append(c.passes, pass)
+	return pass, nil
+}
+
+// Active reports whether at least one pass is enabled
+func (c *PostChain) Active() bool {
+	for _, p := range c.passes {
+		if p.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs the enabled passes on src, writing the result to dst
+func (c *PostChain) Apply(dst, src *ebiten.Image) {
+	var enabled []*PostEffect
+	for _, p := range c.passes {
+		if p.Enabled {
+			enabled = append(enabled, p)
+		}
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	in := src
+	for i, p := range enabled {
+		out := dst
+		if i < len(enabled)-1 {
+			out = c.buffers[i%2]
+			out.Clear()
+		}
+
+		op := &ebiten.DrawRectShaderOptions{}
+		op.Images[0] = in
+		if p.uniforms != nil {
+			op.Uniforms = p.uniforms()
+		}
+		out.DrawRectShader(w, h, p.shader, op)
+		in = out
+	}
+}
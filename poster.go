@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// posterFPS is the rate the demo is stepped at to reach the poster
+// frames, the rate the parts tick at
+const posterFPS = 50
+
+// posterExport writes poster frames for the -poster flag: a PNG of each
+// scene of the demo script at its midpoint, at the frame size, to
+// illustrate the demo on portals. The demo is stepped from the start
+// without drawing the frames in between, so each poster shows the scene
+// exactly as it plays.
+type posterExport struct {
+	dir    string
+	names  map[int]string // File name of each frame captured
+	enc    png.Encoder
+	posted int
+}
+
+// begin picks the frame in the middle of each scene and stops the export
+// after the last one
+func (p *posterExport) begin(e *videoExport, g *Game) error {
+	p.dir = e.dir
+	p.names = map[int]string{}
+	e.only = map[int]bool{}
+	last := -1
+	for i, sc := range g.script.Scenes {
+		n := int((sc.Start + sc.End) / 2 * time.Duration(e.fps) / time.Second)
+		if _, taken := p.names[n]; taken {
+			continue
+		}
+		p.names[n] = fmt.Sprintf("%02d-%s.png", i+1, posterName(sc.Name))
+		e.only[n] = true
+		last = max(last, n)
+	}
+	if last < 0 {
+		return fmt.Errorf("the demo script has no scenes to take posters of")
+	}
+	e.frames = last + 1
+	return nil
+}
+
+// posterName makes a scene name safe for a file name
+func posterName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "scene"
+	}
+	return name
+}
+
+// audio leaves the tune out
+func (p *posterExport) audio(b []byte) error {
+	return nil
+}
+
+// frame writes a poster frame
+func (p *posterExport) frame(n int, img *image.RGBA) error {
+	name, ok := p.names[n]
+	if !ok {
+		return nil
+	}
+	path := filepath.Join(p.dir, name)
+	if err := writePNG(&p.enc, path, img); err != nil {
+		return err
+	}
+	p.posted++
+	log.Printf("Poster frame written to %s", path)
+	return nil
+}
+
+// finish reports the frames written
+func (p *posterExport) finish(e *videoExport) error {
+	log.Printf("Wrote %d poster frames in %s", p.posted, time.Since(e.start).Round(time.Second))
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	"bilizir-demo/effects"
+	"bilizir-demo/timeline"
+)
+
+// sceneWarmup is how long before a scene starts its parts are prepared
+// and drawn once offscreen, so the images, shaders and tables they create
+// on first use do not stutter the transition
+const sceneWarmup = time.Second
+
+// warmKey identifies what a scene draws: its parts, their style and its
+// reveal mask
+type warmKey struct {
+	name, style, reveal string
+}
+
+// warmUpScenes prepares the scenes of the demo script starting within
+// sceneWarmup, once each until the layout changes
+func (g *Game) warmUpScenes() {
+	if g.script == nil || g.layer == nil || g.gallery != nil {
+		return
+	}
+	now := g.sceneTime()
+	length := g.musicLength()
+	for _, sc := range g.script.Scenes {
+		until := sc.Start - now
+		if until <= 0 && length > 0 {
+			// Starting again after the music loops
+			until += length
+		}
+		if until <= 0 || until > sceneWarmup {
+			continue
+		}
+		key := warmKey{sc.Name, sc.Style, sc.Reveal}
+		if g.warmed[key] {
+			continue
+		}
+		g.warmed[key] = true
+		g.warmUp(sc)
+	}
+}
+
+// warmUp draws the parts of a scene into the fade layer, and through its
+// reveal mask into the frame, which are both redrawn before being shown
+func (g *Game) warmUp(sc timeline.Scene) {
+	parts, ok := g.scenes[sc.Name]
+	if !ok {
+		parts = g.intro
+	}
+	for _, p := range parts {
+		if pr, ok := p.(effects.Preparer); ok {
+			pr.Prepare()
+		}
+	}
+	setStyle(parts, sc.Style)
+
+	g.layer.Clear()
+	drawParts(g.layer, parts)
+	if sc.Reveal != "" && g.revealer != nil && !g.badMasks[sc.Reveal] {
+		// A mask failing to load is reported when the scene plays
+		g.revealer.Draw(g.frame, g.layer, sc.Reveal, 0.5, nil)
+	}
+	g.layer.Clear()
+}
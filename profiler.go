@@ -0,0 +1,223 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"image/color"
+	"slices"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"bilizir-demo/effects"
+	"bilizir-demo/sysfont"
+)
+
+// profileFrames is how many frames the profiler keeps, the one being
+// measured and the 239 shown
+const profileFrames = 240
+
+// Sections of the frame measured besides the parts
+const (
+	profilePost  = "post"      // Post-processing passes
+	profileRetro = "retro"     // Retro upscale
+	profileUI    = "ui"        // Dev overlays and panels
+	profileOther = "other"     // The rest of Update and Draw: scene compositing, syncs, input
+	profileWait  = "gpu/vsync" // Frame time outside Update and Draw
+)
+
+// Profiler graph metrics at full size: the height of the graph, which
+// shows two frame budgets, and the width of a frame
+const (
+	profileHeight = 120
+	profileBar    = 2
+)
+
+// profileColors are the colors of the sections, in the order they are
+// first measured; the wait is gray
+var profileColors = []color.RGBA{
+	{0xe0, 0x50, 0x50, 0xff}, {0x50, 0xc0, 0x50, 0xff}, {0x50, 0x80, 0xe0, 0xff},
+	{0xe0, 0xc0, 0x40, 0xff}, {0xc0, 0x50, 0xc0, 0xff}, {0x40, 0xc0, 0xc0, 0xff},
+	{0xe0, 0x80, 0x30, 0xff}, {0x90, 0xe0, 0x60, 0xff}, {0x80, 0x60, 0xe0, 0xff},
+	{0xe0, 0x70, 0xa0, 0xff}, {0x60, 0xa0, 0x80, 0xff}, {0xa0, 0x90, 0x60, 0xff},
+}
+
+// profiler times the parts and the stages of each frame over the last
+// profileFrames frames, for the F3 overlay: stacked bars of the CPU time
+// of each part, update and draw together, the post passes, the overlays
+// and the rest, topped by the time the frame waited on the GPU and the
+// display. Ebiten queues the GPU work, so the parts are measured on the
+// CPU; GPU-heavy parts show as a longer wait.
+type profiler struct {
+	open     bool
+	names    map[effects.Effect]string // Part names, as in the define statements
+	sections []string
+	samples  [][profileFrames]time.Duration // Per section, per frame
+	frame    int                            // Frame being measured, in the ring
+	filled   int                            // Frames measured, up to profileFrames
+	busy     time.Duration                  // Time spent in Update and Draw this frame
+	last     time.Time                      // When the last frame ended
+}
+
+// toggleProfiler opens or closes the profiler, starting afresh
+func (g *Game) toggleProfiler() {
+	p := &g.profile
+	p.open = !p.open
+	if !p.open {
+		return
+	}
+	p.names = map[effects.Effect]string{}
+	for name, part := range g.partNames() {
+		p.names[part] = name
+	}
+	p.sections, p.samples = nil, nil
+	p.frame, p.filled, p.busy = 0, 0, 0
+	p.last = time.Time{}
+}
+
+// add counts d against a section of the frame being measured
+func (p *profiler) add(section string, d time.Duration) {
+	i := slices.Index(p.sections, section)
+	if i < 0 {
+		i = len(p.sections)
+		p.sections = append(p.sections, section)
+		p.samples = append(p.samples, [profileFrames]time.Duration{})
+	}
+	p.samples[i][p.frame] += d
+}
+
+// measure counts the time since start against a section, while open
+func (p *profiler) measure(section string, start time.Time) {
+	if p.open {
+		p.add(section, time.Since(start))
+	}
+}
+
+// measurePart counts the time since start against a part
+func (p *profiler) measurePart(part effects.Effect, start time.Time) {
+	if !p.open {
+		return
+	}
+	if name, ok := p.names[part]; ok {
+		p.add(name, time.Since(start))
+	}
+}
+
+// measureBusy counts the time since start in Update or Draw
+func (p *profiler) measureBusy(start time.Time) {
+	if p.open {
+		p.busy += time.Since(start)
+	}
+}
+
+// endFrame closes the frame at the end of Draw: what Update and Draw
+// spent outside the sections is the rest, the time to the end of the
+// frame before outside them the wait, and the next frame starts
+func (p *profiler) endFrame(start time.Time) {
+	if !p.open {
+		return
+	}
+	now := time.Now()
+	p.busy += now.Sub(start)
+	var measured time.Duration
+	for _, s := range p.samples {
+		measured += s[p.frame]
+	}
+	p.add(profileOther, max(p.busy-measured, 0))
+	if !p.last.IsZero() {
+		p.add(profileWait, max(now.Sub(p.last)-p.busy, 0))
+	}
+	p.last, p.busy = now, 0
+
+	p.frame = (p.frame + 1) % profileFrames
+	p.filled = min(p.filled+1, profileFrames-1)
+	for i := range p.samples {
+		p.samples[i][p.frame] = 0
+	}
+}
+
+// color returns the color of a section
+func (p *profiler) color(i int) color.RGBA {
+	if p.sections[i] == profileWait {
+		return color.RGBA{0x60, 0x60, 0x60, 0xff}
+	}
+	return profileColors[i%len(profileColors)]
+}
+
+// drawProfiler draws the profiler overlay in the bottom left corner: the
+// stacked sections of the last frames against the frame budget, and the
+// sections by average time
+func (g *Game) drawProfiler(screen *ebiten.Image) {
+	p := &g.profile
+	if !p.open || p.filled == 0 {
+		return
+	}
+	budget := time.Duration(float64(time.Second) / g.displayRate())
+	bar := profileBar
+	if screen.Bounds().Dx() < profileFrames*profileBar+200 {
+		bar = 1
+	}
+	w, h := profileFrames*bar, profileHeight
+	x0, y0 := 8, screen.Bounds().Dy()-h-8
+	scale := float64(h) / float64(2*budget)
+
+	// The wait tops the stack, whenever the sections were first measured
+	order := make([]int, 0, len(p.sections))
+	for i, s := range p.sections {
+		if s != profileWait {
+			order = append(order, i)
+		}
+	}
+	if i := slices.Index(p.sections, profileWait); i >= 0 {
+		order = append(order, i)
+	}
+
+	vector.DrawFilledRect(screen, float32(x0-4), float32(y0-4), float32(w+8), float32(h+8), color.RGBA{0, 0, 0, 0xc0}, false)
+	for n := range p.filled {
+		// Oldest frame first, the frame being measured left out
+		f := (p.frame - p.filled + n + 2*profileFrames) % profileFrames
+		x := float32(x0 + (profileFrames-p.filled+n)*bar)
+		y := float64(y0 + h)
+		for _, i := range order {
+			d := float64(p.samples[i][f]) * scale
+			top := max(y-d, float64(y0))
+			if top < y {
+				vector.DrawFilledRect(screen, x, float32(top), float32(bar), float32(y-top), p.color(i), false)
+			}
+			y = top
+		}
+	}
+	by := float32(y0+h) - float32(float64(budget)*scale)
+	vector.StrokeLine(screen, float32(x0), by, float32(x0+w), by, 1, color.RGBA{0xff, 0xff, 0xff, 0xc0}, false)
+
+	// Sections by average over the frames shown, with their worst frame
+	type stat struct {
+		i         int
+		avg, peak time.Duration
+	}
+	stats := make([]stat, len(p.sections))
+	for i := range p.sections {
+		stats[i].i = i
+		for n := range p.filled {
+			f := (p.frame - 1 - n + profileFrames) % profileFrames
+			d := p.samples[i][f]
+			stats[i].avg += d
+			stats[i].peak = max(stats[i].peak, d)
+		}
+		stats[i].avg /= time.Duration(p.filled)
+	}
+	slices.SortStableFunc(stats, func(a, b stat) int { return cmp.Compare(b.avg, a.avg) })
+
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	lx, ly := x0+w+12, y0
+	sysfont.Print(screen, fmt.Sprintf("FRAME BUDGET %.1f MS (F3)", ms(budget)), lx, ly, sysfont.Style{})
+	for _, s := range stats {
+		ly += sysfont.LineHeight
+		if ly > y0+h {
+			break
+		}
+		line := fmt.Sprintf("%-10s %5.2f avg %5.2f max", p.sections[s.i], ms(s.avg), ms(s.peak))
+		sysfont.Print(screen, line, lx, ly, sysfont.Style{Color: p.color(s.i)})
+	}
+}
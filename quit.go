@@ -0,0 +1,70 @@
+package main
+
+import (
+	"image/color"
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// quitFadeTime is how long quitting fades the screen and the music out
+const quitFadeTime = time.Second
+
+// quitFade fades the demo out on the way out: the screen to black and the
+// music volume down, the demo playing on underneath
+type quitFade struct {
+	start  time.Time // When Esc was pressed, zero when not quitting
+	volume float64   // Volume before the fade, saved with the settings
+}
+
+// active reports whether the demo is fading out to quit
+func (q *quitFade) active() bool {
+	return !q.start.IsZero()
+}
+
+// level returns how far the fade has gone, from 0 to 1
+func (q *quitFade) level() float64 {
+	return min(float64(time.Since(q.start))/float64(quitFadeTime), 1)
+}
+
+// startQuit begins fading out to quit
+func (g *Game) startQuit() {
+	q := &g.quit
+	if q.active() {
+		return
+	}
+	q.start = time.Now()
+	if g.music != nil {
+		q.volume = g.music.GetVolume()
+	}
+}
+
+// updateQuit ramps the music down while fading out; once the fade is
+// complete it saves the settings and returns ebiten.Termination
+func (g *Game) updateQuit() error {
+	q := &g.quit
+	f := q.level()
+	if g.music != nil {
+		g.music.SetVolume(q.volume * (1 - f))
+	}
+	if f < 1 {
+		return nil
+	}
+	g.gif.finish()
+	if err := saveSettings(g.currentSettings()); err != nil {
+		log.Printf("Failed to save settings: %v", err)
+	}
+	return ebiten.Termination
+}
+
+// drawQuitFade darkens the whole screen as the demo fades out
+func (g *Game) drawQuitFade(screen *ebiten.Image) {
+	if !g.quit.active() {
+		return
+	}
+	b := screen.Bounds()
+	a := uint8(g.quit.level() * 0xff)
+	vector.DrawFilledRect(screen, 0, 0, float32(b.Dx()), float32(b.Dy()), color.RGBA{0, 0, 0, a}, false)
+}
@@ -0,0 +1,225 @@
+// Package record turns the frames and the sound of the demo into files to
+// share: animated GIFs, and the WAV track of video exports.
+package record
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"slices"
+)
+
+// maxColors is the number of colors of a frame's palette; the last index
+// of the 256 is the transparent color
+const maxColors = 255
+
+// Colors are counted in 5 bits per channel
+const (
+	bucketBits = 5
+	buckets    = 1 << (3 * bucketBits)
+)
+
+// GIF builds an animated GIF small enough to share. Each frame holds only
+// the pixels that changed since the frame before, cropped to the area
+// they cover, the others being transparent so the frames below show
+// through. Each frame has a palette of its own, chosen by median cut over
+// the colors of its changed pixels. Frames are not dithered, so the
+// unchanged areas stay unchanged.
+type GIF struct {
+	anim gif.GIF
+	prev *image.RGBA // Last frame added
+
+	// Color histogram of the frame being added, by 5-bit bucket
+	count  []int32
+	sums   [][3]int64
+	lookup []uint8 // Palette index of each bucket
+}
+
+// Len returns the number of frames added, frames that changed nothing
+// being merged into the one before
+func (g *GIF) Len() int {
+	return len(g.anim.Image)
+}
+
+// Add adds a frame shown for delay hundredths of a second. The frames
+// must all have the size of the first.
+func (g *GIF) Add(img *image.RGBA, delay int) {
+	if g.count == nil {
+		g.count = make([]int32, buckets)
+		g.sums = make([][3]int64, buckets)
+		g.lookup = make([]uint8, buckets)
+	}
+	changed := img.Bounds()
+	if g.prev != nil {
+		changed = g.changed(img)
+		if changed.Empty() {
+			g.anim.Delay[len(g.anim.Delay)-1] += delay
+			return
+		}
+	} else {
+		g.prev = image.NewRGBA(img.Bounds())
+	}
+
+	pal := g.palette(img, changed)
+	transparent := uint8(len(pal))
+	frame := image.NewPaletted(changed, append(pal, color.RGBA{}))
+	for y := changed.Min.Y; y < changed.Max.Y; y++ {
+		for x := changed.Min.X; x < changed.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			o := frame.PixOffset(x, y)
+			if g.Len() > 0 && g.same(img, i) {
+				frame.Pix[o] = transparent
+				continue
+			}
+			p := img.Pix[i : i+3 : i+3]
+			frame.Pix[o] = g.lookup[bucket(p[0], p[1], p[2])]
+		}
+	}
+	copy(g.prev.Pix, img.Pix)
+
+	g.anim.Image = append(g.anim.Image, frame)
+	g.anim.Delay = append(g.anim.Delay, delay)
+	g.anim.Disposal = append(g.anim.Disposal, gif.DisposalNone)
+}
+
+// Encode writes the animation, looping forever
+func (g *GIF) Encode(w io.Writer) error {
+	if g.prev != nil {
+		b := g.prev.Bounds()
+		g.anim.Config = image.Config{Width: b.Dx(), Height: b.Dy()}
+	}
+	return gif.EncodeAll(w, &g.anim)
+}
+
+// same reports whether the pixel at offset i is the same as in the last
+// frame
+func (g *GIF) same(img *image.RGBA, i int) bool {
+	a, b := img.Pix[i:i+3:i+3], g.prev.Pix[i:i+3:i+3]
+	return a[0] == b[0] && a[1] == b[1] && a[2] == b[2]
+}
+
+// changed returns the smallest rectangle holding the pixels of img that
+// differ from the last frame
+func (g *GIF) changed(img *image.RGBA) image.Rectangle {
+	b := img.Bounds()
+	r := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if !g.same(img, img.PixOffset(x, y)) {
+				r.Min.X, r.Max.X = min(r.Min.X, x), max(r.Max.X, x+1)
+				r.Min.Y, r.Max.Y = min(r.Min.Y, y), max(r.Max.Y, y+1)
+			}
+		}
+	}
+	if r.Empty() {
+		return image.Rectangle{}
+	}
+	return r
+}
+
+// bucket returns the histogram bucket of a color
+func bucket(r, g, b uint8) int {
+	const shift = 8 - bucketBits
+	return int(r>>shift)<<(2*bucketBits) | int(g>>shift)<<bucketBits | int(b>>shift)
+}
+
+// palette chooses the colors of the changed pixels within r by median
+// cut, and fills the lookup of their buckets
+func (g *GIF) palette(img *image.RGBA, r image.Rectangle) color.Palette {
+	var used []int
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			i := img.PixOffset(x, y)
+			if g.Len() > 0 && g.same(img, i) {
+				continue
+			}
+			p := img.Pix[i : i+3 : i+3]
+			k := bucket(p[0], p[1], p[2])
+			if g.count[k] == 0 {
+				used = append(used, k)
+			}
+			g.count[k]++
+			for c := range 3 {
+				g.sums[k][c] += int64(p[c])
+			}
+		}
+	}
+
+	boxes := [][]int{used}
+	for len(boxes) < maxColors {
+		// Split the box spanning the widest range of a channel
+		best, channel, width := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if c, w := widest(box); w > width {
+				best, channel, width = i, c, w
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a, b := g.split(boxes[best], channel)
+		boxes[best] = a
+		boxes = append(boxes, b)
+	}
+
+	pal := make(color.Palette, len(boxes))
+	for i, box := range boxes {
+		var n int64
+		var sum [3]int64
+		for _, k := range box {
+			n += int64(g.count[k])
+			for c := range 3 {
+				sum[c] += g.sums[k][c]
+			}
+			g.lookup[k] = uint8(i)
+			g.count[k], g.sums[k] = 0, [3]int64{}
+		}
+		pal[i] = color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 0xff}
+	}
+	return pal
+}
+
+// level returns a channel of a bucket
+func level(k, channel int) int {
+	return k >> ((2 - channel) * bucketBits) & (1<<bucketBits - 1)
+}
+
+// widest returns the channel a box of buckets spans the widest range of,
+// and the range
+func widest(box []int) (int, int) {
+	channel, width := 0, -1
+	for c := range 3 {
+		lo, hi := 1<<bucketBits, -1
+		for _, k := range box {
+			l := level(k, c)
+			lo, hi = min(lo, l), max(hi, l)
+		}
+		if hi-lo > width {
+			channel, width = c, hi-lo
+		}
+	}
+	return channel, width
+}
+
+// split cuts a box of buckets in two along a channel, at the median of
+// the pixels it holds
+func (g *GIF) split(box []int, channel int) ([]int, []int) {
+	slices.SortFunc(box, func(a, b int) int { return level(a, channel) - level(b, channel) })
+	var total, half int64
+	for _, k := range box {
+		total += int64(g.count[k])
+	}
+	cut := 1
+	for i, k := range box[:len(box)-1] {
+		half += int64(g.count[k])
+		if half*2 >= total {
+			cut = i + 1
+			break
+		}
+	}
+	return box[:cut], box[cut:]
+}
@@ -0,0 +1,69 @@
+package record
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// wavHeaderSize is the size of the RIFF header and the format chunk, up
+// to the samples
+const wavHeaderSize = 44
+
+// WAV writes 16-bit PCM samples to a WAV file as they come. The sizes in
+// the header are only known at the end, so they are filled in by Close,
+// which is why it writes to a seekable file.
+type WAV struct {
+	w        io.WriteSeeker
+	rate     int
+	channels int
+	size     int64 // Bytes of samples written
+}
+
+// NewWAV starts a WAV file of 16-bit samples at rate per second, with
+// interleaved channels
+func NewWAV(w io.WriteSeeker, rate, channels int) (*WAV, error) {
+	f := &WAV{w: w, rate: rate, channels: channels}
+	if err := f.writeHeader(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write adds little-endian 16-bit samples, interleaved
+func (f *WAV) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close fills in the sizes of the header. It does not close the file.
+func (f *WAV) Close() error {
+	if _, err := f.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := f.writeHeader(); err != nil {
+		return err
+	}
+	_, err := f.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// writeHeader writes the header for the samples written so far
+func (f *WAV) writeHeader() error {
+	block := 2 * f.channels
+	h := make([]byte, 0, wavHeaderSize)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(wavHeaderSize-8+f.size))
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16) // Format chunk size
+	h = binary.LittleEndian.AppendUint16(h, 1)  // PCM
+	h = binary.LittleEndian.AppendUint16(h, uint16(f.channels))
+	h = binary.LittleEndian.AppendUint32(h, uint32(f.rate))
+	h = binary.LittleEndian.AppendUint32(h, uint32(f.rate*block))
+	h = binary.LittleEndian.AppendUint16(h, uint16(block))
+	h = binary.LittleEndian.AppendUint16(h, 16) // Bits per sample
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, uint32(f.size))
+	_, err := f.w.Write(h)
+	return err
+}
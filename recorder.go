@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"bilizir-demo/record"
+	"bilizir-demo/sysfont"
+)
+
+// gifQueue is how many captured frames wait for the encoder before
+// frames are dropped
+const gifQueue = 64
+
+// gifFrame is a captured frame and how long it shows, in hundredths of a
+// second
+type gifFrame struct {
+	img   *image.RGBA
+	delay int
+}
+
+// gifRecorder captures the demo into an animated GIF: F9 starts and
+// stops it, and it stops by itself after its length. Frames are taken
+// at the capture rate, scaled down on the GPU and read back, then reduced
+// to their palettes in the background, so recording barely slows the
+// demo. The dev overlays and panels are left out of the clip.
+type gifRecorder struct {
+	dir    string        // Folder the clips are written to
+	fps    float64       // Capture rate
+	scale  float64       // Size of the clip as a fraction of the frame
+	length time.Duration // Length the recording stops at, 0 for none
+
+	active  bool
+	path    string
+	start   time.Time
+	next    time.Time     // When the next frame is due
+	pending *image.RGBA   // Last frame captured, sent once its delay is known
+	last    time.Time     // When it was captured
+	carry   time.Duration // Delay left over from rounding to hundredths
+	small   *ebiten.Image
+	frames  chan gifFrame
+	dropped int
+
+	saved     chan error // Result of the clip being written
+	status    string
+	statusEnd time.Time
+}
+
+// update starts or stops recording with F9, stops it after its length
+// and reports the clip once written
+func (r *gifRecorder) update() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyF9) {
+		if r.active {
+			r.stop()
+		} else {
+			r.begin()
+		}
+	}
+	if r.active && r.length > 0 && time.Since(r.start) >= r.length {
+		r.stop()
+	}
+	select {
+	case err := <-r.saved:
+		r.saved = nil
+		if err != nil {
+			log.Printf("GIF recording: %v", err)
+			r.note("GIF FAILED: " + err.Error())
+		} else {
+			log.Printf("GIF recording saved to %s", r.path)
+			r.note("GIF SAVED: " + r.path)
+		}
+	default:
+	}
+}
+
+// begin starts a recording, unless the last one is still being written
+func (r *gifRecorder) begin() {
+	if r.saved != nil {
+		r.note("GIF STILL SAVING")
+		return
+	}
+	// Browsers give no file to write to
+	if runtime.GOOS == "js" {
+		r.note("NO GIF RECORDING IN THE BROWSER")
+		return
+	}
+	r.active = true
+	r.path = filepath.Join(r.dir, time.Now().Format("bilizir-20060102-150405.gif"))
+	r.start, r.next = time.Now(), time.Time{}
+	r.pending, r.carry, r.dropped = nil, 0, 0
+
+	frames := make(chan gifFrame, gifQueue)
+	saved := make(chan error, 1)
+	r.frames, r.saved = frames, saved
+	path := r.path
+	go func() {
+		clip := &record.GIF{}
+		for f := range frames {
+			clip.Add(f.img, f.delay)
+		}
+		saved <- writeGIF(path, clip)
+	}()
+	log.Printf("GIF recording started (%.0f fps, %.0f%% size)", r.fps, r.scale*100)
+}
+
+// stop ends the recording; the clip is written in the background
+func (r *gifRecorder) stop() {
+	if !r.active {
+		return
+	}
+	r.active = false
+	if r.pending != nil {
+		r.send(r.pending, time.Since(r.last))
+		r.pending = nil
+	}
+	close(r.frames)
+	r.frames = nil
+	if r.dropped > 0 {
+		log.Printf("GIF recording: %d frames dropped, the encoder could not keep up", r.dropped)
+	}
+	r.note("SAVING GIF...")
+}
+
+// finish stops the recording and waits for the clip to be written, for
+// the way out
+func (r *gifRecorder) finish() {
+	r.stop()
+	if r.saved != nil {
+		if err := <-r.saved; err != nil {
+			log.Printf("GIF recording: %v", err)
+		} else {
+			log.Printf("GIF recording saved to %s", r.path)
+		}
+		r.saved = nil
+	}
+}
+
+// writeGIF encodes a clip to a file
+func writeGIF(path string, clip *record.GIF) error {
+	if clip.Len() == 0 {
+		return fmt.Errorf("no frames captured")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := clip.Encode(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// capture takes the frame on screen when one is due. Each frame shows
+// until the next one captured, so the clip keeps the pace of the demo
+// even when frames come late.
+func (r *gifRecorder) capture(screen *ebiten.Image) {
+	if !r.active {
+		return
+	}
+	now := time.Now()
+	if now.Before(r.next) {
+		return
+	}
+	period := time.Duration(float64(time.Second) / r.fps)
+	r.next = r.next.Add(period)
+	if now.Sub(r.next) > period {
+		// Too far behind to catch up
+		r.next = now.Add(period)
+	}
+
+	sb := screen.Bounds()
+	img := readScaled(screen, &r.small, max(int(float64(sb.Dx())*r.scale), 1), max(int(float64(sb.Dy())*r.scale), 1))
+
+	// The delay of a frame is known once the next one is taken
+	if r.pending != nil {
+		r.send(r.pending, now.Sub(r.last))
+	}
+	r.pending, r.last = img, now
+}
+
+// readScaled reads the screen back scaled down to w x h on the GPU, through
+// small, which is reallocated when the size changes
+func readScaled(screen *ebiten.Image, small **ebiten.Image, w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	sb := screen.Bounds()
+	if sb.Dx() == w && sb.Dy() == h {
+		screen.ReadPixels(img.Pix)
+		return img
+	}
+	if *small == nil || (*small).Bounds().Dx() != w || (*small).Bounds().Dy() != h {
+		if *small != nil {
+			(*small).Deallocate()
+		}
+		*small = ebiten.NewImage(w, h)
+	}
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+	op.GeoM.Scale(float64(w)/float64(sb.Dx()), float64(h)/float64(sb.Dy()))
+	(*small).DrawImage(screen, op)
+	(*small).ReadPixels(img.Pix)
+	return img
+}
+
+// send queues a frame for the encoder with the time it shows for,
+// dropping it when the encoder is behind. Delays are rounded to the
+// hundredths of a second of GIFs, the remainder carried to the next frame.
+func (r *gifRecorder) send(img *image.RGBA, d time.Duration) {
+	d += r.carry
+	cs := max(int(d/(10*time.Millisecond)), 1)
+	r.carry = d - time.Duration(cs)*10*time.Millisecond
+	select {
+	case r.frames <- gifFrame{img: img, delay: cs}:
+	default:
+		r.dropped++
+	}
+}
+
+// note shows a message about the recording for a moment
+func (r *gifRecorder) note(msg string) {
+	r.status = msg
+	r.statusEnd = time.Now().Add(3 * time.Second)
+}
+
+// showing reports whether the recording indicator or a message is shown
+func (r *gifRecorder) showing() bool {
+	return r.active || time.Now().Before(r.statusEnd)
+}
+
+// draw shows the recording indicator, or the state of the last clip, in
+// the top left corner
+func (r *gifRecorder) draw(screen *ebiten.Image) {
+	red := sysfont.Style{Color: color.RGBA{0xff, 0x40, 0x40, 0xff}}
+	if r.active {
+		d := time.Since(r.start)
+		sysfont.Print(screen, fmt.Sprintf("REC %d:%02d", int(d.Minutes()), int(d.Seconds())%60), 8, 8, red)
+		return
+	}
+	if r.showing() {
+		sysfont.Print(screen, r.status, 8, 8, red)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"bilizir-demo/sysfont"
+)
+
+const (
+	// refreshSamples is how many vsynced frames the refresh rate is
+	// measured over
+	refreshSamples = 120
+
+	// defaultFrameLimit paces frames with vsync off until the refresh
+	// rate is known
+	defaultFrameLimit = 60
+)
+
+// commonRefreshRates are the display rates measurements snap to
+var commonRefreshRates = []float64{50, 60, 75, 85, 90, 100, 120, 144, 165, 240}
+
+// refreshState measures the refresh rate of the monitor the window is on
+// and paces frames when vsync is off
+type refreshState struct {
+	vsync   bool
+	limit   float64 // Frames per second with vsync off, 0 for the refresh rate
+	monitor string
+
+	last      time.Time
+	intervals []time.Duration
+	rate      float64 // Detected refresh rate in Hz, 0 until measured
+
+	nextFrame time.Time
+}
+
+// setVsync turns vsync on or off; with it off the internal limiter paces
+// frames instead
+func (g *Game) setVsync(enabled bool) {
+	g.refresh.vsync = enabled
+	g.refresh.nextFrame = time.Time{}
+	ebiten.SetVsyncEnabled(enabled)
+}
+
+// frame is called once per drawn frame: it measures the refresh rate
+// while vsync is on, and waits for the next frame slot while it is off
+func (r *refreshState) frame() {
+	now := time.Now()
+
+	// Measure again when the window moves to another monitor
+	if name := ebiten.Monitor().Name(); name != r.monitor {
+		r.monitor = name
+		r.intervals = r.intervals[:0]
+		r.rate = 0
+	}
+
+	if r.vsync {
+		// Stalls (loading, window drags) are not refresh intervals
+		if d := now.Sub(r.last); !r.last.IsZero() && d < 100*time.Millisecond {
+			r.intervals = append(r.intervals, d)
+		}
+		r.last = now
+		if len(r.intervals) >= refreshSamples {
+			rate := snapRefreshRate(medianInterval(r.intervals))
+			if rate != r.rate {
+				log.Printf("Display refresh: %.0fHz on %q", rate, r.monitor)
+			}
+			r.rate = rate
+			r.intervals = r.intervals[:0]
+		}
+		return
+	}
+
+	r.last = time.Time{}
+	period := time.Duration(float64(time.Second) / r.frameLimit())
+	if r.nextFrame.IsZero() || now.Sub(r.nextFrame) > period {
+		// First limited frame, or too far behind to catch up
+		r.nextFrame = now
+	}
+	if wait := r.nextFrame.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+	r.nextFrame = r.nextFrame.Add(period)
+}
+
+// displayRate returns the rate frames are shown at: the refresh rate
+// with vsync, the limiter's without
+func (g *Game) displayRate() float64 {
+	if !g.refresh.vsync {
+		return g.refresh.frameLimit()
+	}
+	if g.refresh.rate == 0 {
+		return defaultFrameLimit
+	}
+	return g.refresh.rate
+}
+
+// frameLimit returns the frame rate of the limiter
+func (r *refreshState) frameLimit() float64 {
+	switch {
+	case r.limit > 0:
+		return r.limit
+	case r.rate > 0:
+		return r.rate
+	default:
+		return defaultFrameLimit
+	}
+}
+
+// medianInterval returns the median of frame intervals as a rate in Hz
+func medianInterval(intervals []time.Duration) float64 {
+	sorted := append([]time.Duration(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return float64(time.Second) / float64(sorted[len(sorted)/2])
+}
+
+// snapRefreshRate rounds a measured rate to a common display rate when
+// it is within 3% of one
+func snapRefreshRate(hz float64) float64 {
+	for _, r := range commonRefreshRates {
+		if math.Abs(hz-r) < r*0.03 {
+			return r
+		}
+	}
+	return math.Round(hz)
+}
+
+// judderWarning returns a warning when the demo logic rate does not
+// divide the display rate evenly, so animation steps land unevenly on
+// frames; it is empty when motion is smooth or the rate is unknown
+func (r *refreshState) judderWarning(tickRate float64) string {
+	display := r.rate
+	if !r.vsync {
+		display = r.frameLimit()
+	}
+	if display == 0 {
+		return ""
+	}
+
+	ratio := display / tickRate
+	if ratio >= 1 && math.Abs(ratio-math.Round(ratio)) < 0.02 {
+		return ""
+	}
+	return fmt.Sprintf("%.0f ticks/s on a %.0fHz display: motion will judder", tickRate, display)
+}
+
+// drawRefreshWarning shows the judder warning at the bottom of the screen
+func (g *Game) drawRefreshWarning(screen *ebiten.Image) {
+	msg := g.refresh.judderWarning(1 / g.tickSeconds())
+	if msg == "" {
+		return
+	}
+	sysfont.Print(screen, msg, 8, screen.Bounds().Dy()-64, sysfont.Style{})
+}
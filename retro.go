@@ -0,0 +1,106 @@
+package main
+
+import (
+	_ "embed"
+	"image/color"
+	"log"
+
+	"bilizir-demo/effects"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+//go:embed shaders/scanlines.kage
+var scanlinesShaderSrc []byte
+
+const (
+	retroWidth  = 320
+	retroHeight = 200
+
+	// scanlineIntensity is how much the scanline overlay darkens
+	scanlineIntensity = 0.45
+)
+
+// RetroMode selects the authentic low-resolution rendering mode
+type RetroMode int
+
+const (
+	RetroOff       RetroMode = iota // Native 800x600 rendering
+	RetroLowRes                     // 320x200, integer upscaled
+	RetroScanlines                  // 320x200 with a scanline overlay
+)
+
+// initRetroShader compiles the upscaling shader used in retro mode
+func (g *Game) initRetroShader() error {
+	shader, err := ebiten.NewShader(scanlinesShaderSrc)
+	if err != nil {
+		return err
+	}
+	g.retroShader = shader
+	return nil
+}
+
+// setRetroMode switches between native and 320x200 rendering
+func (g *Game) setRetroMode(mode RetroMode) {
+	wasRetro := g.retro != RetroOff
+	g.retro = mode
+
+	if (mode != RetroOff) == wasRetro {
+		return
+	}
+
+	if g.retroFrame != nil {
+		g.retroFrame.Deallocate()
+		g.retroFrame = nil
+	}
+	l := effects.NewLayout(screenWidth, screenHeight)
+	if mode != RetroOff {
+		g.retroFrame = ebiten.NewImage(retroWidth, retroHeight)
+		l = effects.NewLayout(retroWidth, retroHeight)
+	}
+	if err := g.setLayout(l); err != nil {
+		log.Printf("Failed to switch resolution: %v", err)
+	}
+}
+
+// presentRetro upscales the low-resolution frame by the largest integer
+// factor that fits the screen, centered, with optional scanlines
+func (g *Game) presentRetro(screen, frame *ebiten.Image) {
+	screen.Fill(color.Black)
+
+	sw, sh := screen.Bounds().Dx(), screen.Bounds().Dy()
+	fw, fh := frame.Bounds().Dx(), frame.Bounds().Dy()
+	scale := min(sw/fw, sh/fh)
+	if scale < 1 {
+		scale = 1
+	}
+
+	w, h := float32(fw*scale), float32(fh*scale)
+	x0, y0 := (float32(sw)-w)/2, (float32(sh)-h)/2
+
+	if g.retroShader == nil {
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(float64(scale), float64(scale))
+		op.GeoM.Translate(float64(x0), float64(y0))
+		screen.DrawImage(frame, op)
+		return
+	}
+
+	intensity := float32(0)
+	if g.retro == RetroScanlines && scale > 1 {
+		intensity = scanlineIntensity
+	}
+
+	vertices := []ebiten.Vertex{
+		{DstX: x0, DstY: y0, SrcX: 0, SrcY: 0, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		{DstX: x0 + w, DstY: y0, SrcX: float32(fw), SrcY: 0, ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		{DstX: x0, DstY: y0 + h, SrcX: 0, SrcY: float32(fh), ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+		{DstX: x0 + w, DstY: y0 + h, SrcX: float32(fw), SrcY: float32(fh), ColorR: 1, ColorG: 1, ColorB: 1, ColorA: 1},
+	}
+	op := &ebiten.DrawTrianglesShaderOptions{}
+	op.Images[0] = frame
+	op.Uniforms = map[string]any{
+		"Intensity": intensity,
+	}
+	screen.DrawTrianglesShader(vertices, []uint16{0, 1, 2, 1, 2, 3}, g.retroShader, op)
+}
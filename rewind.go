@@ -0,0 +1,91 @@
+package main
+
+import (
+	"time"
+
+	"bilizir-demo/effects"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// rewindSpeed is how many times faster than it plays the demo runs
+	// backwards while R is held
+	rewindSpeed = 2
+
+	// rewindLimit is how far back the timeline goes in one hold of R
+	rewindLimit = 5 * time.Second
+)
+
+// rewindState is the rewind of the demo while R is held: the timeline
+// steps backwards and the parts retrace their motion, the music muted.
+// Parts that cannot run backwards (effects.Rewinder) hold still. On
+// release the music picks up where the timeline was rewound to.
+type rewindState struct {
+	active  bool
+	rewound time.Duration // How far back this hold has gone
+}
+
+// updateRewind rewinds the demo while R is held; it returns true while
+// rewinding, when the demo does not advance
+func (g *Game) updateRewind() bool {
+	r := &g.rewind
+	held := ebiten.IsKeyPressed(ebiten.KeyR) && !g.console.open && g.gallery == nil
+	if !held {
+		if r.active {
+			g.endRewind()
+		}
+		return false
+	}
+	if !r.active {
+		r.active, r.rewound = true, 0
+		if g.music != nil {
+			g.music.Pause()
+		}
+	}
+
+	// Each update goes back as far as rewindSpeed updates go forwards
+	step := min(time.Second*rewindSpeed/time.Duration(ebiten.TPS()), rewindLimit-r.rewound)
+	if step > 0 {
+		r.rewound += step
+		t := g.clock.scene - step
+		if length := g.musicLength(); length > 0 {
+			t = wrapDuration(t, length)
+		} else {
+			t = max(t, 0)
+		}
+		g.clock.seek(t)
+		g.syncTime = t + g.syncLead()
+
+		// The parts move one VBL per logic tick, whatever the tick rate
+		dt := step.Seconds() / g.tickSeconds() * vblSeconds
+		g.setSpeeds()
+		g.applyKeys()
+		g.applyShots()
+		g.applyParams()
+		for _, p := range g.parts {
+			if rw, ok := p.(effects.Rewinder); ok {
+				rw.Rewind(dt)
+			}
+		}
+	}
+	g.clock.hold()
+	return true
+}
+
+// endRewind picks the music up where the timeline was rewound to
+func (g *Game) endRewind() {
+	g.rewind.active = false
+	if g.music == nil {
+		return
+	}
+	// The tune is heard latency behind where it is decoded
+	t := g.clock.scene + g.latency
+	if length := g.musicLength(); length > 0 {
+		t = wrapDuration(t, length)
+	}
+	g.seekMusic(t)
+	if !g.paused {
+		g.music.Resume()
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+
+	"bilizir-demo/sysfont"
+)
+
+// Broadcast safe areas: the action-safe area keeps 5% clear on each side,
+// the title-safe area 10%
+const (
+	actionSafe = 0.05
+	titleSafe  = 0.10
+)
+
+// maxSafeInset is the largest safe-area inset, a fifth of each side
+const maxSafeInset = 0.2
+
+// safeGuide is a frame drawn by the safe-area guides
+type safeGuide struct {
+	inset float64
+	label string
+	color color.RGBA
+}
+
+// safeRect returns the area of a size inset by a fraction on each side
+func safeRect(size image.Point, f float64) image.Rectangle {
+	dx, dy := int(math.Round(float64(size.X)*f)), int(math.Round(float64(size.Y)*f))
+	return image.Rect(dx, dy, size.X-dx, size.Y-dy)
+}
+
+// drawSafeGuides draws the action-safe and title-safe frames and a center
+// cross over the screen, to line a projector up at a party: what falls
+// outside the frames may be lost to overscan. The inset the parts keep
+// within, when set, is drawn too.
+func (g *Game) drawSafeGuides(screen *ebiten.Image) {
+	if !g.safeGuides {
+		return
+	}
+	size := screen.Bounds().Size()
+	guides := []safeGuide{
+		{actionSafe, "ACTION SAFE 5%", color.RGBA{0x40, 0xe0, 0x40, 0xff}},
+		{titleSafe, "TITLE SAFE 10%", color.RGBA{0xe0, 0xc0, 0x40, 0xff}},
+	}
+	if g.safeInset > 0 && g.safeInset != actionSafe && g.safeInset != titleSafe {
+		guides = append(guides, safeGuide{g.safeInset, "SAFE AREA", color.RGBA{0x40, 0xc0, 0xff, 0xff}})
+	}
+	for _, guide := range guides {
+		r := safeRect(size, guide.inset)
+		vector.StrokeRect(screen, float32(r.Min.X), float32(r.Min.Y), float32(r.Dx()), float32(r.Dy()), 1, guide.color, false)
+		sysfont.Print(screen, guide.label, r.Min.X+4, r.Min.Y+4, sysfont.Style{Color: guide.color})
+	}
+
+	cx, cy := float32(size.X)/2, float32(size.Y)/2
+	white := color.RGBA{0xff, 0xff, 0xff, 0xc0}
+	vector.StrokeLine(screen, cx-16, cy, cx+16, cy, 1, white, false)
+	vector.StrokeLine(screen, cx, cy-16, cx, cy+16, 1, white, false)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"bilizir-demo/mod"
+	"bilizir-demo/timeline"
+)
+
+// sceneTune is a tune the demo script plays instead of the main one over
+// a span of its timeline, from the start of the tune
+type sceneTune struct {
+	start, end time.Duration
+	player     MusicPlayer
+	crossfade  time.Duration // Fade in and out, 0 to cut
+}
+
+// SceneMusic plays the main tune along the demo script timeline, and the
+// tunes of the scenes having their own over those scenes, so parts of the
+// demo can have a different sound. It streams like any tune, its time
+// being the script time; the timeline loops with the main tune. Scenes
+// with a crossfade bring their tune in and out through a MusicManager.
+type SceneMusic struct {
+	playbackState
+
+	main       MusicPlayer
+	tunes      []sceneTune // In time order, not overlapping
+	sampleRate int
+	position   int64 // Samples played since the start of the timeline
+
+	// mixer plays the source streamed, none to seek the next one read
+	// instead of crossfading to it
+	mixer *MusicManager
+	last  *sceneTune // Scene tune streamed, nil for the main tune
+}
+
+// NewSceneMusic plays the tunes of the scenes of s over the main tune.
+// Scene tunes are found relative to dir, then in the embedded assets;
+// scenes whose tune fails to load play the main tune. It returns nil when
+// no scene has a tune.
+func NewSceneMusic(main MusicPlayer, s *timeline.Script, dir string, sampleRate int) *SceneMusic {
+	m := &SceneMusic{main: main, sampleRate: sampleRate, playbackState: playbackState{volume: main.GetVolume()}, mixer: NewMusicManager(sampleRate)}
+	players := map[string]MusicPlayer{}
+	scenes := append([]timeline.Scene(nil), s.Scenes...)
+	sort.SliceStable(scenes, func(i, j int) bool { return scenes[i].Start < scenes[j].Start })
+	for _, sc := range scenes {
+		if sc.Music == "" {
+			continue
+		}
+		p, ok := players[sc.Music]
+		if !ok {
+			var err error
+			if p, err = loadSceneTune(sc.Music, dir, sampleRate); err != nil {
+				log.Printf("Demo script: scene %s: %v", sc.Name, err)
+			}
+			players[sc.Music] = p
+		}
+		if p == nil {
+			continue
+		}
+		m.add(sceneTune{start: sc.Start, end: sc.End, player: p, crossfade: sc.Crossfade})
+	}
+	if len(m.tunes) == 0 {
+		return nil
+	}
+	for _, p := range players {
+		if p != nil {
+			p.SetVolume(m.volume)
+		}
+	}
+	return m
+}
+
+// loadSceneTune loads the tune of a scene, from a file relative to dir or
+// from the embedded assets
+func loadSceneTune(path, dir string, sampleRate int) (MusicPlayer, error) {
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		var embedErr error
+		if data, embedErr = fs.ReadFile(assetFS, filepath.ToSlash(path)); embedErr != nil {
+			return nil, fmt.Errorf("failed to read music: %w", err)
+		}
+	}
+	return NewMusicPlayer(data, sampleRate, true)
+}
+
+// add appends the span of a scene tune. A scene starting while the one
+// before plays takes over at its start; consecutive scenes with the same
+// tune play it on without restarting.
+func (m *SceneMusic) add(t sceneTune) {
+	if n := len(m.tunes); n > 0 {
+		last := &m.tunes[n-1]
+		if last.player == t.player && t.start <= last.end {
+			last.end = max(last.end, t.end)
+			last.crossfade = max(last.crossfade, t.crossfade)
+			return
+		}
+		last.end = min(last.end, t.start)
+		if last.end <= last.start {
+			m.tunes = m.tunes[:n-1]
+		}
+	}
+	m.tunes = append(m.tunes, t)
+}
+
+// tuneAt returns the scene tune playing at t on the timeline, nil when
+// the main tune plays, and when the next source starts
+func (m *SceneMusic) tuneAt(t time.Duration) (*sceneTune, time.Duration) {
+	next := time.Duration(-1)
+	if d := m.main.Duration(); d > 0 {
+		next = d
+	}
+	for i := range m.tunes {
+		st := &m.tunes[i]
+		if t < st.start {
+			if next < 0 || st.start < next {
+				next = st.start
+			}
+			return nil, next
+		}
+		if t < st.end {
+			return st, st.end
+		}
+	}
+	return nil, next
+}
+
+// source returns the player streaming at t, and the time it plays at
+func (m *SceneMusic) source(t time.Duration) (MusicPlayer, time.Duration) {
+	if st, _ := m.tuneAt(t); st != nil {
+		return st.player, t - st.start
+	}
+	return m.main, t
+}
+
+// Read implements io.Reader for audio streaming, switching tunes at the
+// scene boundaries, with the longer crossfade of the tunes going and
+// coming
+func (m *SceneMusic) Read(p []byte) (n int, err error) {
+	return m.read(p, false), nil
+}
+
+// ReadF32 streams like Read in 32-bit float stereo
+func (m *SceneMusic) ReadF32(p []byte) (n int, err error) {
+	return m.read(p, true), nil
+}
+
+// F32 returns the timeline as a 32-bit float stream for the audio device,
+// the tunes crossfaded in float
+func (m *SceneMusic) F32() io.ReadSeeker {
+	return floatStream{tune: m, read: m.ReadF32}
+}
+
+// read fills p like Read, with 32-bit float samples when f32 is set
+func (m *SceneMusic) read(p []byte, f32 bool) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.lastRead = time.Now()
+	frame := frameSize(f32)
+	n := len(p) / frame * frame
+
+	// Output silence while paused, keeping the audio stream alive
+	if m.paused {
+		clear(p[:n])
+		return n
+	}
+
+	for done := 0; done < n; {
+		t := m.time()
+		st, next := m.tuneAt(t)
+		chunk := n - done
+		if next >= 0 {
+			left := int64((next-t).Seconds()*float64(m.sampleRate)) * int64(frame)
+			chunk = int(min(int64(chunk), max(left, int64(frame))))
+		}
+
+		src, at := m.main, t
+		if st != nil {
+			src, at = st.player, t-st.start
+		}
+		if current := m.mixer.Current(); src != current || st != m.last {
+			var fade time.Duration
+			if current != nil {
+				fade = max(crossfadeOf(m.last), crossfadeOf(st))
+			}
+			m.mixer.Play(src, at, fade)
+			m.last = st
+		}
+		m.mixer.read(p[done:done+chunk], f32)
+		done += chunk
+		m.position += int64(chunk / frame)
+
+		// Start the timeline over with the main tune, the tune heard then
+		// seeked back in step
+		if d := m.main.Duration(); d > 0 && m.time() >= d {
+			m.position = 0
+			m.mixer.Stop()
+		}
+	}
+	return n
+}
+
+// crossfadeOf returns the crossfade of a scene tune, 0 for the main tune
+func crossfadeOf(st *sceneTune) time.Duration {
+	if st == nil {
+		return 0
+	}
+	return st.crossfade
+}
+
+// time returns the timeline position
+func (m *SceneMusic) time() time.Duration {
+	return time.Duration(m.position) * time.Second / time.Duration(m.sampleRate)
+}
+
+// SetVolume sets the playback volume (0.0 to 1.0) of every tune
+func (m *SceneMusic) SetVolume(volume float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.volume = volume
+	m.main.SetVolume(volume)
+	for _, st := range m.tunes {
+		st.player.SetVolume(volume)
+	}
+}
+
+// Seek implements io.Seeker; offsets are in bytes of 16-bit stereo on the
+// timeline
+func (m *SceneMusic) Seek(offset int64, whence int) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = m.position*4 + offset
+	case io.SeekEnd:
+		pos = int64(m.main.Duration().Seconds()*float64(m.sampleRate))*4 + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	m.position = max(pos, 0) / 4
+	m.mixer.Stop()
+	return m.position * 4, nil
+}
+
+// SeekTime moves playback to t on the timeline; the tune playing there is
+// seeked when it is next read
+func (m *SceneMusic) SeekTime(t time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if t < 0 {
+		return
+	}
+	m.position = int64(t.Seconds() * float64(m.sampleRate))
+	m.mixer.Stop()
+}
+
+// MusicPosition returns the current time on the timeline
+func (m *SceneMusic) MusicPosition() time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.time()
+}
+
+// Duration returns the length of the timeline, the main tune's
+func (m *SceneMusic) Duration() time.Duration {
+	return m.main.Duration()
+}
+
+// Info returns the metadata of the tune playing
+func (m *SceneMusic) Info() TuneInfo {
+	return m.Playing().Info()
+}
+
+// Playing returns the tune playing at the current time
+func (m *SceneMusic) Playing() MusicPlayer {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	src, _ := m.source(m.time())
+	return src
+}
+
+// RowsBetween returns the rows of the tracker tune playing at to that
+// start after from and up to to on the timeline. The row times are in
+// that tune, and a tune only reports the rows played since it took over.
+func (m *SceneMusic) RowsBetween(from, to time.Duration) []mod.RowTime {
+	st, _ := m.tuneAt(to)
+	src, start := m.main, time.Duration(0)
+	if st != nil {
+		src, start = st.player, st.start
+	}
+	tracker, ok := src.(TrackerPlayer)
+	if !ok {
+		return nil
+	}
+	if st == nil {
+		// The main tune plays on the timeline time, from the end of the
+		// scene tune before
+		for _, t := range m.tunes {
+			if t.end <= to && t.end > from && from <= to {
+				from = t.end - 1
+			}
+		}
+		return tracker.RowsBetween(from, to)
+	}
+	if from < start || from > to {
+		from = start - 1
+	}
+	return tracker.RowsBetween(from-start, to-start)
+}
+
+// Close releases every tune
+func (m *SceneMusic) Close() error {
+	closed := map[MusicPlayer]bool{m.main: true}
+	err := m.main.Close()
+	for _, st := range m.tunes {
+		if !closed[st.player] {
+			closed[st.player] = true
+			if e := st.player.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// scopeTapSize is how many samples the tap keeps, a power of two
+const scopeTapSize = 4096
+
+// sampleTap keeps the last samples streamed to the audio device, mixed
+// to mono, for the oscilloscope to draw. The audio device writes it and
+// the game reads it, each locking.
+type sampleTap struct {
+	mutex sync.Mutex
+	ring  [scopeTapSize]float32
+	pos   int // Where the next sample goes
+}
+
+// write16 appends 16-bit stereo samples
+func (t *sampleTap) write16(p []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i := 0; i+4 <= len(p); i += 4 {
+		l := int16(binary.LittleEndian.Uint16(p[i:]))
+		r := int16(binary.LittleEndian.Uint16(p[i+2:]))
+		t.ring[t.pos] = (float32(l) + float32(r)) / 65536
+		t.pos = (t.pos + 1) & (scopeTapSize - 1)
+	}
+}
+
+// writeF32 appends 32-bit float stereo samples
+func (t *sampleTap) writeF32(p []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i := 0; i+8 <= len(p); i += 8 {
+		l := math.Float32frombits(binary.LittleEndian.Uint32(p[i:]))
+		r := math.Float32frombits(binary.LittleEndian.Uint32(p[i+4:]))
+		t.ring[t.pos] = (l + r) / 2
+		t.pos = (t.pos + 1) & (scopeTapSize - 1)
+	}
+}
+
+// Samples fills dst with the latest samples, oldest first
+func (t *sampleTap) Samples(dst []float32) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	n := min(len(dst), scopeTapSize)
+	for i := range dst[:n] {
+		dst[i] = t.ring[(t.pos-n+i)&(scopeTapSize-1)]
+	}
+}
+
+// tappedStream streams a tune to the audio device, copying the samples
+// read to a tap on the way
+type tappedStream struct {
+	io.ReadSeeker
+	tap *sampleTap
+	f32 bool // 32-bit float samples, else 16-bit
+}
+
+func (s tappedStream) Read(p []byte) (int, error) {
+	n, err := s.ReadSeeker.Read(p)
+	if s.f32 {
+		s.tap.writeF32(p[:n])
+	} else {
+		s.tap.write16(p[:n])
+	}
+	return n, err
+}
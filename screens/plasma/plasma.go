@@ -0,0 +1,82 @@
+// Package plasma is an example contributed screen: a classic sine plasma.
+package plasma
+
+import (
+	"math"
+	"time"
+
+	"bilizir-demo/effects"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+func init() {
+	effects.Register(effects.Manifest{
+		Name:     "Plasma",
+		Author:   "Bilizir",
+		Duration: 8 * time.Second,
+	}, func() effects.Effect { return &Plasma{} })
+}
+
+// The plasma is computed at a quarter of the frame size and scaled up
+const downscale = 4
+
+// Plasma renders an animated sine plasma
+type Plasma struct {
+	w, h    int
+	t       float64
+	img     *ebiten.Image
+	pixels  []byte
+	palette [256][3]byte
+}
+
+// Init allocates the plasma buffer and palette
+func (p *Plasma) Init(ctx *effects.Context) error {
+	p.w, p.h = ctx.Width/downscale, ctx.Height/downscale
+	p.img = ebiten.NewImage(p.w, p.h)
+	p.pixels = make([]byte, p.w*p.h*4)
+
+	for i := range p.palette {
+		a := float64(i) / 256 * 2 * math.Pi
+		p.palette[i] = [3]byte{
+			byte(128 + 127*math.Sin(a)),
+			byte(128 + 127*math.Sin(a+2*math.Pi/3)),
+			byte(128 + 127*math.Sin(a+4*math.Pi/3)),
+		}
+	}
+	return nil
+}
+
+// Update advances the plasma animation
+func (p *Plasma) Update(dt float64) {
+	p.t += dt
+}
+
+// Draw renders the plasma scaled to fill dst
+func (p *Plasma) Draw(dst *ebiten.Image) {
+	for y := 0; y < p.h; y++ {
+		fy := float64(y)
+		for x := 0; x < p.w; x++ {
+			fx := float64(x)
+			v := math.Sin(fx/16+p.t) +
+				math.Sin(fy/8-p.t*1.3) +
+				math.Sin((fx+fy)/16+p.t*0.7) +
+				math.Sin(math.Hypot(fx-float64(p.w)/2, fy-float64(p.h)/2)/8-p.t*2)
+			c := p.palette[int((v+4)*32)&0xff]
+
+			i := (y*p.w + x) * 4
+			p.pixels[i] = c[0]
+			p.pixels[i+1] = c[1]
+			p.pixels[i+2] = c[2]
+			p.pixels[i+3] = 0xff
+		}
+	}
+	p.img.WritePixels(p.pixels)
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(
+		float64(dst.Bounds().Dx())/float64(p.w),
+		float64(dst.Bounds().Dy())/float64(p.h),
+	)
+	dst.DrawImage(p.img, op)
+}
@@ -0,0 +1,11 @@
+// Package screens links every contributed screen into the demo.
+//
+// A contribution is a package under screens/ that implements
+// effects.Effect and calls effects.Register from its init function with
+// a manifest (name, author, preferred duration, required assets). Add a
+// blank import below and the screen shows up in the gallery.
+package screens
+
+import (
+	_ "bilizir-demo/screens/plasma"
+)
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// scrolltextTimeout bounds the download of a scrolltext URL
+	scrolltextTimeout = 10 * time.Second
+
+	// scrolltextLimit is the largest scrolltext read, in bytes
+	scrolltextLimit = 1 << 20
+)
+
+// scrolltextSource is the file or http(s) URL the scroll message is read
+// from with -scrolltext. Shift+F5 reads it again in the background and
+// the new message takes over once read.
+type scrolltextSource struct {
+	path   string
+	prefix string      // Control codes put before the message, such as the color of the configuration
+	ch     chan string // Message read by the reload in flight
+}
+
+// readScrolltext reads a scroll message from a file or an http(s) URL.
+// Line breaks become spaces, the scroller showing a single line.
+func readScrolltext(src string) (string, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		data, err = fetchScrolltext(src)
+	} else {
+		data, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(text)
+	text = strings.TrimRight(text, " ")
+	if text == "" {
+		return "", fmt.Errorf("%s: empty scrolltext", src)
+	}
+	return text, nil
+}
+
+// fetchScrolltext downloads a scrolltext
+func fetchScrolltext(url string) ([]byte, error) {
+	client := http.Client{Timeout: scrolltextTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, scrolltextLimit))
+}
+
+// loadScrolltext reads the scroll message from src, a file or a URL, and
+// remembers it for reloads
+func (g *Game) loadScrolltext(src string) error {
+	text, err := readScrolltext(src)
+	if err != nil {
+		return err
+	}
+	g.scrolltext.path = src
+	return g.scroller.SetText(g.scrolltext.prefix + text)
+}
+
+// reloadScrolltext reads the scroll message again in the background
+func (g *Game) reloadScrolltext() {
+	st := &g.scrolltext
+	switch {
+	case st.path == "":
+		log.Printf("No scrolltext to reload, start the demo with -scrolltext")
+		return
+	case st.ch != nil:
+		return
+	}
+
+	ch := make(chan string, 1)
+	st.ch = ch
+	go func() {
+		text, err := readScrolltext(st.path)
+		if err != nil {
+			log.Printf("Failed to reload the scrolltext: %v", err)
+		}
+		ch <- text
+	}()
+}
+
+// pollScrolltext shows a reloaded scroll message once read
+func (g *Game) pollScrolltext() {
+	st := &g.scrolltext
+	if st.ch == nil {
+		return
+	}
+	select {
+	case text := <-st.ch:
+		st.ch = nil
+		if text == "" {
+			return
+		}
+		if err := g.scroller.SetText(st.prefix + text); err != nil {
+			log.Printf("Failed to show the reloaded scrolltext: %v", err)
+			return
+		}
+		log.Printf("Scrolltext reloaded from %s", st.path)
+	default:
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"bilizir-demo/effects"
+	"bilizir-demo/timeline"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// defaultSceneFade is the fade to and from black between default scenes
+const defaultSceneFade = time.Second
+
+// maxSyncStep is the largest scene time step sync events are fired over;
+// a larger jump is a seek, and the events it skips are dropped
+const maxSyncStep = 500 * time.Millisecond
+
+// sceneParts maps the scene names of the demo script to the effects they
+// show, back to front. Scenes with other names show the full intro.
+func (g *Game) sceneParts() map[string][]effects.Effect {
+	return map[string][]effects.Effect{
+		"copper":    {g.copper, g.logo},
+		"cubes":     {g.copper, g.cubes},
+		"greetings": {g.copper, g.logo, g.scroller},
+		"spectrum":  {g.copper, g.logo, g.meter},
+		"objects":   {g.copper, g.objects},
+		"stars":     {g.stars, g.logo, g.scroller},
+		"tunnel":    {g.tunnel, g.logo},
+		"fire":      {g.stars, g.logo, g.fire, g.scroller},
+		"dissolve":  {g.copper, g.dissolve},
+		"reveal":    {g.copper, g.reveal},
+		"balls":     {g.copper, g.balls, g.scroller},
+		"rasters":   {g.rasters, g.logo, g.scroller},
+		"waterfall": {g.rasters, g.falls},
+		"raymarch":  {g.march, g.logo},
+		"scope":     {g.copper, g.logo, g.scope},
+	}
+}
+
+// partNames maps the part names of the define statements of the demo
+// script to the parts
+func (g *Game) partNames() map[string]effects.Effect {
+	return map[string]effects.Effect{
+		"copper":    g.copper,
+		"logo":      g.logo,
+		"cubes":     g.cubes,
+		"scroller":  g.scroller,
+		"meter":     g.meter,
+		"objects":   g.objects,
+		"stars":     g.stars,
+		"tunnel":    g.tunnel,
+		"fire":      g.fire,
+		"dissolve":  g.dissolve,
+		"reveal":    g.reveal,
+		"balls":     g.balls,
+		"rasters":   g.rasters,
+		"waterfall": g.falls,
+		"raymarch":  g.march,
+		"scope":     g.scope,
+	}
+}
+
+// defineScenes composes the scenes the demo script defines from the
+// parts they name, over the built-in scenes. Unknown parts are left out.
+func (g *Game) defineScenes() {
+	g.scenes = g.sceneParts()
+	named := g.partNames()
+	for _, d := range g.script.Defines {
+		var parts []effects.Effect
+		for _, name := range d.Parts {
+			p, ok := named[name]
+			if !ok {
+				log.Printf("Demo script: scene %s: unknown part %q", d.Scene, name)
+				continue
+			}
+			parts = append(parts, p)
+		}
+		g.scenes[d.Scene] = parts
+	}
+}
+
+// sceneTime returns the position on the demo script timeline, read from
+// the demo clock: the music position heard when a tune is playing, else
+// the time the demo has been running
+func (g *Game) sceneTime() time.Duration {
+	return g.clock.scene
+}
+
+// syncLead returns how far ahead of the scene clock sync events fire. The
+// scene clock already runs the audio output latency behind the music, so
+// it is where the tune is heard; what is left is the visual side: events
+// fire at the first tick past them, half a tick late on average, and the
+// frame drawn after the tick is shown at the next display refresh. Firing
+// that much early lands the flashes on the beats heard instead of a frame
+// or two after them.
+func (g *Game) syncLead() time.Duration {
+	return time.Duration((1/g.displayRate() + g.tickSeconds()/2) * float64(time.Second))
+}
+
+// fireSyncs sends the sync events of the demo script due since the last
+// tick, syncLead ahead of the scene clock, to the parts following them
+func (g *Game) fireSyncs() {
+	now := g.sceneTime() + g.syncLead()
+	last := g.syncTime
+	g.syncTime = now
+
+	step := now - last
+	if step < 0 {
+		// The music looped back to the start of the script
+		step += g.script.Length()
+	}
+	if step <= 0 || step > maxSyncStep {
+		return
+	}
+
+	for _, e := range g.script.Events(last, now) {
+		g.sync(e.Name)
+	}
+	g.fireRowSyncs(last, now)
+}
+
+// fireRowSyncs sends the events of the rows of a tracker module starting
+// between two scene times: a "pattern" event for each pattern starting,
+// on a new song position or when the song loops, and the tracker syncs of
+// the demo script firing on the rows
+func (g *Game) fireRowSyncs(last, now time.Duration) {
+	tracker, ok := g.music.(TrackerPlayer)
+	if !ok {
+		return
+	}
+	for _, r := range tracker.RowsBetween(last, now) {
+		if r.Start {
+			g.sync("pattern")
+		}
+		row := timeline.Row{Pattern: r.Pattern, Row: r.Row, Start: r.Start, Instruments: r.Instruments}
+		for _, name := range g.script.RowEvents(row) {
+			g.sync(name)
+		}
+	}
+}
+
+// sync sends a sync event to the parts following them
+func (g *Game) sync(name string) {
+	if name == "beat" {
+		g.zoomBlurBeat = 1
+	}
+	for _, p := range g.parts {
+		if s, ok := p.(effects.Syncer); ok {
+			s.Sync(name)
+		}
+	}
+}
+
+// cues returns the scenes playing: those of the demo script at the
+// current time, or the generated ones once the endless mode took over
+func (g *Game) cues() []timeline.Cue {
+	if g.filler.Running() {
+		return g.filler.At(g.clock.elapsed)
+	}
+	return g.script.At(g.sceneTime())
+}
+
+// drawScenes draws the scenes playing at the current time, each with its
+// fade level
+func (g *Game) drawScenes(screen *ebiten.Image) {
+	for _, cue := range g.cues() {
+		parts, ok := g.scenes[cue.Scene.Name]
+		if !ok {
+			parts = g.intro
+		}
+		setStyle(parts, cue.Scene.Style)
+
+		if cue.Alpha >= 1 {
+			g.drawShown(screen, parts)
+			continue
+		}
+		if cue.Alpha <= 0 {
+			continue
+		}
+
+		// Fading scenes are composited through a layer so overlapping
+		// parts fade as a whole, or appear through their reveal mask or as
+		// a picture-in-picture
+		g.layer.Clear()
+		g.drawShown(g.layer, parts)
+		if cue.Scene.Reveal == revealPiP {
+			g.drawPiP(screen, g.layer, cue.Alpha)
+			continue
+		}
+		if mask := cue.Scene.Reveal; mask != "" && g.revealer != nil && !g.badMasks[mask] {
+			err := g.revealer.Draw(screen, g.layer, mask, cue.Alpha, nil)
+			if err == nil {
+				continue
+			}
+			// Fade instead, and report the mask once
+			log.Printf("Scene %s: %v", cue.Scene.Name, err)
+			g.badMasks[mask] = true
+		}
+		op := &ebiten.DrawImageOptions{}
+		op.ColorScale.ScaleAlpha(float32(cue.Alpha))
+		screen.DrawImage(g.layer, op)
+	}
+}
+
+// setStyle selects the visual style of a scene on the parts having
+// alternative styles
+func setStyle(parts []effects.Effect, style string) {
+	for _, p := range parts {
+		if s, ok := p.(effects.Styled); ok {
+			s.SetStyle(style)
+		}
+	}
+}
+
+// drawParts draws effects in order onto dst
+func drawParts(dst *ebiten.Image, parts []effects.Effect) {
+	for _, p := range parts {
+		p.Draw(dst)
+	}
+}
+
+// applyKeys hands the orientation keyed in the demo script for the
+// current time to the parts it choreographs, interpolated with slerp and
+// eased in and out of each key
+func (g *Game) applyKeys() {
+	tracks := []struct {
+		name string
+		part effects.Tumbler
+	}{
+		{"cubes", g.cubes},
+	}
+	now := g.sceneTime()
+	for _, tr := range tracks {
+		a, b, f, ok := g.script.KeysAt(tr.name, now)
+		if !ok {
+			tr.part.Tumble(effects.IdentityQuat, false)
+			continue
+		}
+		f = f * f * (3 - 2*f)
+		tr.part.Tumble(effects.Slerp(keyQuat(a), keyQuat(b), f), true)
+	}
+}
+
+// keyQuat converts the Euler angles of a key, in degrees, to a rotation
+func keyQuat(k timeline.Key) effects.Quat {
+	rad := math.Pi / 180
+	return effects.EulerQuat(k.Angles[0]*rad, k.Angles[1]*rad, k.Angles[2]*rad)
+}
+
+// applyShots hands the camera of the shot playing on each 3D part's
+// track to the part, its parameters eased between their keys
+func (g *Game) applyShots() {
+	tracks := []struct {
+		name string
+		part effects.Filmed
+	}{
+		{"cubes", g.cubes},
+		{"objects", g.objects},
+		{"balls", g.balls},
+	}
+	now := g.sceneTime()
+	for _, tr := range tracks {
+		shot, f, ok := g.script.ShotAt(tr.name, now)
+		if !ok {
+			tr.part.Film(effects.Camera{}, false)
+			continue
+		}
+		cam, _ := effects.ShotCamera(shot.Kind, func(name string, def ...float64) float64 {
+			return shot.Param(name, f, def...)
+		})
+		tr.part.Film(cam, true)
+	}
+}
+
+// setScriptParams sets the parameters the demo script gives when it is
+// loaded, and notes the values the parameters it changes on the timeline
+// start from
+func (g *Game) setScriptParams() {
+	for _, p := range g.script.Params {
+		if p.Timed {
+			continue
+		}
+		if err := g.params.Set(p.Name, p.Value); err != nil {
+			log.Printf("Demo script: %v", err)
+		}
+	}
+	g.paramBase = map[string]float64{}
+	for _, name := range g.script.TimedParams() {
+		p, err := g.params.Lookup(name)
+		if err != nil {
+			log.Printf("Demo script: %v", err)
+			continue
+		}
+		g.paramBase[name] = p.Value
+	}
+}
+
+// applyParams sets the parameters the demo script changes on the
+// timeline to their value at the current time
+func (g *Game) applyParams() {
+	now := g.sceneTime()
+	for name, base := range g.paramBase {
+		if v, ok := g.script.ParamAt(name, now, base); ok {
+			g.params.Set(name, v)
+		}
+	}
+}
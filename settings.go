@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Settings are the player's choices kept between runs: loaded at
+// startup, saved on exit
+type Settings struct {
+	Volume     float64     `json:"volume"`
+	Fullscreen bool        `json:"fullscreen"`
+	Palette    PaletteMode `json:"palette"`
+	Retro      RetroMode   `json:"retro"` // Low resolution, and the CRT scanlines
+	Scene      string      `json:"scene"` // Scene playing on exit, the next run starts there
+
+	// Audio output latency in milliseconds, and whether the calibration
+	// screen was run or skipped; the first run shows it
+	LatencyMS  float64 `json:"latency_ms"`
+	Calibrated bool    `json:"calibrated"`
+}
+
+// defaultSettings are used on the first run
+var defaultSettings = Settings{Volume: 0.5}
+
+// launchOptions are the settings given on the command line or in the
+// configuration file, applied over the saved settings without replacing
+// them
+type launchOptions struct {
+	fullscreen bool     // Start fullscreen
+	mute       bool     // Start with the music muted
+	volume     *float64 // Starting volume of the configuration file
+	saved      Settings // Settings loaded, kept while the options hold
+}
+
+// settingsFile is the file of the user config directory the settings are
+// saved to
+const settingsFile = "settings.json"
+
+// loadSettings reads the saved settings, the defaults when there are
+// none or they cannot be read
+func loadSettings() Settings {
+	s := defaultSettings
+	if err := loadJSON(settingsFile, &s); err != nil {
+		return defaultSettings
+	}
+	s.Volume = min(max(s.Volume, 0), 1)
+	s.Palette = min(max(s.Palette, PaletteFull), PaletteSTE)
+	s.Retro = min(max(s.Retro, RetroOff), RetroScanlines)
+	s.LatencyMS = min(max(s.LatencyMS, 0), float64(maxLatency.Milliseconds()))
+	return s
+}
+
+// saveSettings writes the settings to the user config directory
+func saveSettings(s Settings) error {
+	return saveJSON(settingsFile, s)
+}
+
+// configPath returns where a settings file is saved, or "" when the
+// platform has no user config directory
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "bilizir-demo", name)
+}
+
+// loadJSON reads the settings file name of the user config directory
+// into v
+func loadJSON(name string, v any) error {
+	path := configPath(name)
+	if path == "" {
+		return errNoConfigDir
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// saveJSON writes v to the settings file name of the user config
+// directory, creating the directory
+func saveJSON(name string, v any) error {
+	path := configPath(name)
+	if path == "" {
+		return errNoConfigDir
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// errNoConfigDir is returned for settings on platforms without a user
+// config directory
+var errNoConfigDir = errors.New("no user config directory")
+
+// applySettings restores saved settings once the music, the post passes
+// and the demo script are loaded
+func (g *Game) applySettings(s Settings) {
+	g.launch.saved = s
+	if g.music != nil {
+		g.music.SetVolume(s.Volume)
+		if g.launch.volume != nil {
+			g.music.SetVolume(*g.launch.volume)
+		}
+		if g.launch.mute {
+			g.music.SetVolume(0)
+		}
+	}
+	g.setFullscreen(s.Fullscreen || g.launch.fullscreen)
+	g.setPaletteMode(s.Palette)
+	g.setRetroMode(s.Retro)
+	g.latency = time.Duration(s.LatencyMS * float64(time.Millisecond))
+	g.calibrated = s.Calibrated
+
+	// The web build cannot save the result, so it does not ask on startup
+	if !s.Calibrated && configPath(settingsFile) != "" {
+		g.startCalibration()
+	}
+
+	if s.Scene == "" {
+		return
+	}
+	for _, sc := range g.script.Scenes {
+		if sc.Name == s.Scene {
+			g.seekMusic(sc.Start)
+			return
+		}
+	}
+}
+
+// currentSettings collects the settings to save
+func (g *Game) currentSettings() Settings {
+	// Without a tune the volume saved last time is kept
+	s := Settings{
+		Volume:     g.launch.saved.Volume,
+		Fullscreen: ebiten.IsFullscreen(),
+		Palette:    g.paletteMode,
+		Retro:      g.retro,
+		LatencyMS:  float64(g.latency) / float64(time.Millisecond),
+		Calibrated: g.calibrated,
+	}
+	if g.music != nil {
+		s.Volume = g.music.GetVolume()
+		if g.quit.active() {
+			s.Volume = g.quit.volume
+		}
+		if g.launch.mute && s.Volume == 0 || g.launch.volume != nil && s.Volume == *g.launch.volume {
+			// Still muted from the command line, or at the volume of the
+			// configuration file
+			s.Volume = g.launch.saved.Volume
+		}
+	}
+	if g.launch.fullscreen && s.Fullscreen {
+		s.Fullscreen = g.launch.saved.Fullscreen
+	}
+	if g.script != nil {
+		// The most visible scene when cross-fading
+		alpha := 0.0
+		for _, cue := range g.script.At(g.sceneTime()) {
+			if cue.Alpha > alpha {
+				s.Scene, alpha = cue.Scene.Name, cue.Alpha
+			}
+		}
+	}
+	return s
+}
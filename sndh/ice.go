@@ -0,0 +1,181 @@
+package sndh
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errCorrupt reports packed data that reads past either end of a buffer
+var errCorrupt = errors.New("sndh: corrupt ICE! packed data")
+
+// iceHeaderSize is the size of the "ICE!" header: magic, packed length
+// (header included) and unpacked length
+const iceHeaderSize = 12
+
+// isICE reports whether data is packed with Pack-Ice 2.4
+func isICE(data []byte) bool {
+	return len(data) >= iceHeaderSize && string(data[:4]) == "ICE!"
+}
+
+// unpackICE decompresses Pack-Ice 2.4 data. The packed stream is read
+// backwards from its end and the output is filled from its end too.
+func unpackICE(data []byte) (out []byte, err error) {
+	if !isICE(data) {
+		return nil, errors.New("sndh: not ICE! packed")
+	}
+	packed := int(binary.BigEndian.Uint32(data[4:]))
+	size := int(binary.BigEndian.Uint32(data[8:]))
+	if packed < iceHeaderSize || packed > len(data) || size <= 0 || size > maxTuneSize {
+		return nil, fmt.Errorf("sndh: invalid ICE! header (packed %d, unpacked %d)", packed, size)
+	}
+
+	// Out-of-range reads and writes panic; turn them into an error
+	defer func() {
+		if recover() != nil {
+			out, err = nil, errCorrupt
+		}
+	}()
+
+	d := &iceDecoder{src: data[iceHeaderSize:packed], out: make([]byte, size)}
+	d.in = len(d.src)
+	d.pos = size
+	d.bits = d.next()
+	d.decode()
+	return d.out, nil
+}
+
+// iceDecoder holds the state of the Pack-Ice bit reader
+type iceDecoder struct {
+	src  []byte
+	in   int // Next packed byte is src[in-1]
+	out  []byte
+	pos  int // Next output byte is out[pos-1]
+	bits byte
+}
+
+// next reads the previous packed byte
+func (d *iceDecoder) next() byte {
+	d.in--
+	return d.src[d.in]
+}
+
+// bit reads one bit. The bit buffer holds a marker bit below the data
+// bits; when only the marker is left, the next byte is loaded.
+func (d *iceDecoder) bit() int {
+	b := d.bits & 0x80
+	d.bits <<= 1
+	if d.bits == 0 {
+		n := d.next()
+		b = n & 0x80
+		d.bits = n<<1 | 1
+	}
+	return int(b >> 7)
+}
+
+// bitsN reads n bits, most significant first
+func (d *iceDecoder) bitsN(n int) int {
+	v := 0
+	for range n {
+		v = v<<1 | d.bit()
+	}
+	return v
+}
+
+// Literal run lengths, tried in turn after a 1 bit: bits to read, the
+// all-ones value that escapes to the next code, and base length
+var iceLiteralCodes = []struct{ bits, escape, base int }{
+	{2, 3, 2},
+	{2, 3, 5},
+	{3, 7, 8},
+	{8, 255, 15},
+	{15, 32767, 270},
+}
+
+// Match lengths, selected by the number of leading 1 bits: extra bits to
+// read and base length
+var iceLengthCodes = []struct{ bits, base int }{
+	{0, 2},
+	{0, 3},
+	{1, 4},
+	{2, 6},
+	{10, 10},
+}
+
+// Offsets of matches longer than two bytes, selected by the number of
+// leading 1 bits: bits to read and base offset
+var iceOffsetCodes = []struct{ bits, base int }{
+	{8, 31},
+	{5, -1},
+	{12, 287},
+}
+
+// decode runs the main loop: optional literal runs, each followed by a
+// back-reference, until the output is full
+func (d *iceDecoder) decode() {
+	for {
+		if d.bit() == 1 {
+			d.literals()
+		}
+		if d.pos <= 0 {
+			return
+		}
+		d.match()
+	}
+}
+
+// literals copies a run of bytes straight from the packed stream
+func (d *iceDecoder) literals() {
+	n := 1
+	if d.bit() == 1 {
+		for i, code := range iceLiteralCodes {
+			v := d.bitsN(code.bits)
+			n = v + code.base
+			if v != code.escape || i == len(iceLiteralCodes)-1 {
+				break
+			}
+		}
+	}
+	for range n {
+		d.pos--
+		d.out[d.pos] = d.next()
+	}
+}
+
+// match copies a run of bytes already unpacked, which lie after the
+// current position as the output is built backwards
+func (d *iceDecoder) match() {
+	ones := 0
+	for ones < len(iceLengthCodes)-1 && d.bit() == 1 {
+		ones++
+	}
+	lc := iceLengthCodes[ones]
+	length := lc.base + d.bitsN(lc.bits)
+
+	var offset int
+	if length == 2 {
+		if d.bit() == 1 {
+			offset = d.bitsN(9) + 63
+		} else {
+			offset = d.bitsN(6) - 1
+		}
+	} else {
+		ones = 0
+		for ones < len(iceOffsetCodes)-1 && d.bit() == 1 {
+			ones++
+		}
+		oc := iceOffsetCodes[ones]
+		offset = d.bitsN(oc.bits) + oc.base
+		if offset < 0 {
+			// Repeat the last byte written
+			offset -= length - 2
+		}
+	}
+
+	src := d.pos + length + offset
+	for range length {
+		d.pos--
+		src--
+		d.out[d.pos] = d.out[src]
+	}
+}
@@ -0,0 +1,171 @@
+package sndh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// iceWriter builds a Pack-Ice stream in the order the decoder reads it:
+// bits are packed into bit buffer bytes, the first holding 7 above its
+// marker bit and the others 8, and literal bytes come in between
+type iceWriter struct {
+	reads []byte // Bytes in the order they are read
+	cur   int    // Bit buffer byte being filled
+	used  int    // Bits of it filled
+}
+
+func (w *iceWriter) bits(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		capacity := 8
+		if w.cur == 0 {
+			capacity = 7
+		}
+		if len(w.reads) == 0 || w.used == capacity {
+			w.reads = append(w.reads, 0)
+			w.cur, w.used = len(w.reads)-1, 0
+			if w.cur == 0 {
+				w.reads[0] = 1 // Marker
+			}
+		}
+		w.reads[w.cur] |= byte(v>>i&1) << (7 - w.used)
+		w.used++
+	}
+}
+
+func (w *iceWriter) literal(b ...byte) {
+	w.reads = append(w.reads, b...)
+}
+
+// packed returns the ICE! file unpacking into size bytes
+func (w *iceWriter) packed(size int) []byte {
+	src := make([]byte, len(w.reads))
+	for i, b := range w.reads {
+		src[len(src)-1-i] = b
+	}
+	return iceFile(src, size)
+}
+
+// iceFile puts the ICE! header in front of a packed stream
+func iceFile(src []byte, size int) []byte {
+	data := make([]byte, iceHeaderSize, iceHeaderSize+len(src))
+	copy(data, "ICE!")
+	binary.BigEndian.PutUint32(data[4:], uint32(iceHeaderSize+len(src)))
+	binary.BigEndian.PutUint32(data[8:], uint32(size))
+	return append(data, src...)
+}
+
+// TestUnpackICE unpacks streams covering literal runs, matches with an
+// offset and matches repeating the last byte, built from the end of the
+// output backwards as the decoder fills it
+func TestUnpackICE(t *testing.T) {
+	// "abcabcabc!": the literals "abc!" then two 3-byte matches copying
+	// the three bytes after them
+	var abc iceWriter
+	abc.bits(1, 1)   // Literals
+	abc.bits(1, 1)   // More than one
+	abc.bits(4-2, 2) // 4 of them
+	abc.literal('!', 'c', 'b', 'a')
+	for range 2 {
+		abc.bits(0b10, 2) // Length 3
+		abc.bits(0b10, 2) // 5-bit offset
+		abc.bits(0+1, 5)  // Offset 0, right after the match
+		abc.bits(0, 1)    // No literals
+	}
+
+	// "xxxxxxxy": the literals "xy" then 6 bytes repeating the last one
+	var xy iceWriter
+	xy.bits(1, 1)
+	xy.bits(1, 1)
+	xy.bits(2-2, 2) // 2 literals
+	xy.literal('y', 'x')
+	xy.bits(0b1110, 4) // Lengths 6 to 9
+	xy.bits(0, 2)      // 6
+	xy.bits(0b10, 2)   // 5-bit offset
+	xy.bits(0, 5)      // Offset -1, the last byte
+	xy.bits(0, 1)
+
+	// "z": a single literal
+	var z iceWriter
+	z.bits(1, 1)
+	z.bits(0, 1)
+	z.literal('z')
+
+	tests := []struct {
+		name string
+		w    *iceWriter
+		want string
+	}{
+		{"matches", &abc, "abcabcabc!"},
+		{"repeat", &xy, "xxxxxxxy"},
+		{"one literal", &z, "z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.w.packed(len(tt.want))
+			if !isICE(data) {
+				t.Fatal("not recognized as ICE! packed")
+			}
+			out, err := unpackICE(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out, []byte(tt.want)) {
+				t.Errorf("unpacked %q, want %q", out, tt.want)
+			}
+		})
+	}
+}
+
+// TestUnpackICECorrupt checks that streams reading or copying past the
+// ends of the buffers give errCorrupt instead of panicking, and that bad
+// headers are refused
+func TestUnpackICECorrupt(t *testing.T) {
+	var w iceWriter
+	w.bits(1, 1)
+	w.bits(1, 1)
+	w.bits(4-2, 2)
+	w.literal('!', 'c', 'b', 'a')
+	w.bits(0b10, 2)
+	w.bits(0b10, 2)
+	w.bits(0+1, 5)
+	w.bits(0, 1)
+	full := w.packed(7)
+	src := full[iceHeaderSize:]
+
+	// A match reaching past the end of the output
+	var far iceWriter
+	far.bits(1, 1)
+	far.bits(0, 1)
+	far.literal('a')
+	far.bits(0b10, 2)
+	far.bits(0, 1)
+	far.bits(200, 8) // Offset 231
+	far.bits(0, 1)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated stream", iceFile(src[3:], 7)},
+		{"output longer than the stream", iceFile(src, 64)},
+		{"match out of range", far.packed(8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := unpackICE(tt.data); !errors.Is(err, errCorrupt) {
+				t.Errorf("got error %v, want errCorrupt", err)
+			}
+		})
+	}
+
+	bad := append([]byte(nil), full...)
+	binary.BigEndian.PutUint32(bad[4:], uint32(len(full)+1))
+	if _, err := unpackICE(bad); err == nil || errors.Is(err, errCorrupt) {
+		t.Errorf("packed length past the data: got error %v, want a header error", err)
+	}
+	if _, err := unpackICE(full[:iceHeaderSize-1]); err == nil {
+		t.Errorf("short header unpacked")
+	}
+}
@@ -0,0 +1,444 @@
+// Package m68k is a Motorola 68000 interpreter, complete enough to run
+// the replay routines of Atari ST music drivers. It always runs in
+// supervisor mode and does not model cycle timings.
+package m68k
+
+import "fmt"
+
+// Bus is the memory and hardware seen by the CPU. Addresses are 24-bit.
+type Bus interface {
+	Read8(addr uint32) uint8
+	Write8(addr uint32, v uint8)
+}
+
+// Status register bits
+const (
+	FlagC = 1 << 0
+	FlagV = 1 << 1
+	FlagZ = 1 << 2
+	FlagN = 1 << 3
+	FlagX = 1 << 4
+	FlagS = 1 << 13
+)
+
+// callReturn is the return address pushed by Call; reaching it ends the
+// call
+const callReturn = 0xfffffe
+
+// CPU is the state of a 68000
+type CPU struct {
+	D   [8]uint32
+	A   [8]uint32 // A[7] is the stack pointer
+	PC  uint32
+	SR  uint16
+	USP uint32 // User stack pointer, only reachable with MOVE USP
+
+	Bus Bus
+
+	// Trap handles TRAP #n, typically to stand in for the operating
+	// system; when nil the exception vector in memory is taken
+	Trap func(c *CPU, n int)
+
+	stopped bool
+	err     error
+}
+
+// New creates a CPU in supervisor mode on bus
+func New(bus Bus) *CPU {
+	return &CPU{Bus: bus, SR: FlagS | 0x0700}
+}
+
+// Call runs the subroutine at addr until it returns, executing at most
+// maxSteps instructions
+func (c *CPU) Call(addr uint32, maxSteps int) error {
+	c.err = nil
+	c.stopped = false
+	c.push32(callReturn)
+	c.PC = addr
+
+	for steps := 0; c.PC != callReturn; steps++ {
+		if steps >= maxSteps {
+			return fmt.Errorf("m68k: routine at %06x did not return after %d instructions", addr, maxSteps)
+		}
+		c.Step()
+		if c.err != nil {
+			return c.err
+		}
+		if c.stopped {
+			return fmt.Errorf("m68k: routine at %06x stopped the CPU", addr)
+		}
+	}
+	return nil
+}
+
+// Step executes one instruction
+func (c *CPU) Step() {
+	c.exec(c.fetch16())
+}
+
+// Err returns the error that halted the last Call, if any
+func (c *CPU) Err() error {
+	return c.err
+}
+
+// fail halts execution with an error
+func (c *CPU) fail(format string, args ...any) {
+	if c.err == nil {
+		c.err = fmt.Errorf("m68k: "+format, args...)
+	}
+}
+
+// illegal reports an instruction the interpreter cannot execute
+func (c *CPU) illegal(op uint32) {
+	c.fail("illegal instruction %04x at %06x", op, c.PC-2)
+}
+
+// exception enters the handler of an exception vector
+func (c *CPU) exception(vector int) {
+	handler := c.read32(uint32(vector) * 4)
+	if handler == 0 {
+		c.fail("unhandled exception %d at %06x", vector, c.PC)
+		return
+	}
+	sr := c.SR
+	c.SR |= FlagS
+	c.push32(c.PC)
+	c.push16(uint32(sr))
+	c.PC = handler
+}
+
+// Memory access
+
+func (c *CPU) read8(a uint32) uint32 {
+	return uint32(c.Bus.Read8(a & 0xffffff))
+}
+
+func (c *CPU) read16(a uint32) uint32 {
+	return c.read8(a)<<8 | c.read8(a+1)
+}
+
+func (c *CPU) read32(a uint32) uint32 {
+	return c.read16(a)<<16 | c.read16(a+2)
+}
+
+func (c *CPU) write8(a, v uint32) {
+	c.Bus.Write8(a&0xffffff, uint8(v))
+}
+
+func (c *CPU) write16(a, v uint32) {
+	c.write8(a, v>>8)
+	c.write8(a+1, v)
+}
+
+func (c *CPU) write32(a, v uint32) {
+	c.write16(a, v>>16)
+	c.write16(a+2, v)
+}
+
+// readSize reads a byte, word or long
+func (c *CPU) readSize(a uint32, size int) uint32 {
+	switch size {
+	case 1:
+		return c.read8(a)
+	case 2:
+		return c.read16(a)
+	}
+	return c.read32(a)
+}
+
+// writeSize writes a byte, word or long
+func (c *CPU) writeSize(a uint32, size int, v uint32) {
+	switch size {
+	case 1:
+		c.write8(a, v)
+	case 2:
+		c.write16(a, v)
+	default:
+		c.write32(a, v)
+	}
+}
+
+func (c *CPU) fetch16() uint32 {
+	v := c.read16(c.PC)
+	c.PC += 2
+	return v
+}
+
+func (c *CPU) fetch32() uint32 {
+	v := c.read32(c.PC)
+	c.PC += 4
+	return v
+}
+
+func (c *CPU) push16(v uint32) {
+	c.A[7] -= 2
+	c.write16(c.A[7], v)
+}
+
+func (c *CPU) push32(v uint32) {
+	c.A[7] -= 4
+	c.write32(c.A[7], v)
+}
+
+func (c *CPU) pop16() uint32 {
+	v := c.read16(c.A[7])
+	c.A[7] += 2
+	return v
+}
+
+func (c *CPU) pop32() uint32 {
+	v := c.read32(c.A[7])
+	c.A[7] += 4
+	return v
+}
+
+// Operand sizes
+
+// sizes maps the 2-bit size field of most instructions to a byte count
+var sizes = [4]int{1, 2, 4, 0}
+
+func mask(size int) uint32 {
+	switch size {
+	case 1:
+		return 0xff
+	case 2:
+		return 0xffff
+	}
+	return 0xffffffff
+}
+
+func msb(size int) uint32 {
+	return 1 << (size*8 - 1)
+}
+
+// signExt sign-extends a byte or word to 32 bits
+func signExt(v uint32, size int) uint32 {
+	switch size {
+	case 1:
+		return uint32(int32(int8(v)))
+	case 2:
+		return uint32(int32(int16(v)))
+	}
+	return v
+}
+
+// Effective addresses
+
+// Operand kinds
+const (
+	opData = iota // Data register
+	opAddr        // Address register
+	opMem         // Memory at addr
+	opImm         // Immediate value in addr
+)
+
+// operand is a resolved effective address. Resolving has the side
+// effects of the addressing mode (extension words, increments), so
+// read-modify-write instructions resolve once and access twice.
+type operand struct {
+	kind int
+	reg  int
+	addr uint32
+}
+
+// ea resolves the effective address given by a mode and register field
+func (c *CPU) ea(mode, reg uint32, size int) operand {
+	r := int(reg)
+	switch mode {
+	case 0:
+		return operand{kind: opData, reg: r}
+	case 1:
+		return operand{kind: opAddr, reg: r}
+	case 2:
+		return operand{kind: opMem, addr: c.A[r]}
+	case 3:
+		addr := c.A[r]
+		c.A[r] += c.step(r, size)
+		return operand{kind: opMem, addr: addr}
+	case 4:
+		c.A[r] -= c.step(r, size)
+		return operand{kind: opMem, addr: c.A[r]}
+	case 5:
+		return operand{kind: opMem, addr: c.A[r] + signExt(c.fetch16(), 2)}
+	case 6:
+		return operand{kind: opMem, addr: c.indexed(c.A[r])}
+	}
+
+	switch reg {
+	case 0:
+		return operand{kind: opMem, addr: signExt(c.fetch16(), 2)}
+	case 1:
+		return operand{kind: opMem, addr: c.fetch32()}
+	case 2:
+		base := c.PC
+		return operand{kind: opMem, addr: base + signExt(c.fetch16(), 2)}
+	case 3:
+		return operand{kind: opMem, addr: c.indexed(c.PC)}
+	case 4:
+		return operand{kind: opImm, addr: c.immediate(size)}
+	}
+	c.fail("invalid addressing mode 7.%d at %06x", reg, c.PC)
+	return operand{kind: opImm}
+}
+
+// step is the increment of (An)+ and -(An); the stack pointer stays even
+func (c *CPU) step(reg, size int) uint32 {
+	if reg == 7 && size == 1 {
+		return 2
+	}
+	return uint32(size)
+}
+
+// indexed computes d8(base,Xn) from a brief extension word
+func (c *CPU) indexed(base uint32) uint32 {
+	ext := c.fetch16()
+	r := ext >> 12 & 7
+	idx := c.D[r]
+	if ext&0x8000 != 0 {
+		idx = c.A[r]
+	}
+	if ext&0x0800 == 0 {
+		idx = signExt(idx&0xffff, 2)
+	}
+	return base + idx + signExt(ext&0xff, 1)
+}
+
+// immediate fetches an immediate value of the given size
+func (c *CPU) immediate(size int) uint32 {
+	if size == 4 {
+		return c.fetch32()
+	}
+	return c.fetch16() & mask(size)
+}
+
+// get reads an operand
+func (c *CPU) get(o operand, size int) uint32 {
+	switch o.kind {
+	case opData:
+		return c.D[o.reg] & mask(size)
+	case opAddr:
+		return c.A[o.reg] & mask(size)
+	case opImm:
+		return o.addr
+	}
+	return c.readSize(o.addr, size)
+}
+
+// set writes an operand; address registers are always written whole
+func (c *CPU) set(o operand, size int, v uint32) {
+	v &= mask(size)
+	switch o.kind {
+	case opData:
+		c.D[o.reg] = c.D[o.reg]&^mask(size) | v
+	case opAddr:
+		c.A[o.reg] = signExt(v, size)
+	case opMem:
+		c.writeSize(o.addr, size, v)
+	}
+}
+
+// reg returns register i of a MOVEM list, D0-D7 then A0-A7
+func (c *CPU) reg(i int) uint32 {
+	if i < 8 {
+		return c.D[i]
+	}
+	return c.A[i-8]
+}
+
+func (c *CPU) setReg(i int, v uint32) {
+	if i < 8 {
+		c.D[i] = v
+	} else {
+		c.A[i-8] = v
+	}
+}
+
+// Condition codes
+
+func (c *CPU) flag(f uint16) bool {
+	return c.SR&f != 0
+}
+
+func (c *CPU) setFlag(f uint16, on bool) {
+	if on {
+		c.SR |= f
+	} else {
+		c.SR &^= f
+	}
+}
+
+// setNZ sets N and Z from a result and clears V and C
+func (c *CPU) setNZ(v uint32, size int) {
+	c.SR &^= FlagN | FlagZ | FlagV | FlagC
+	if v&mask(size) == 0 {
+		c.SR |= FlagZ
+	}
+	if v&msb(size) != 0 {
+		c.SR |= FlagN
+	}
+}
+
+// addFlags sets N, Z, V and C for r = d + s and returns the carry
+func (c *CPU) addFlags(s, d, r uint32, size int) bool {
+	m := msb(size)
+	c.setNZ(r, size)
+	carry := (s&d|^r&d|s&^r)&m != 0
+	c.setFlag(FlagV, (s&d&^r|^s&^d&r)&m != 0)
+	c.setFlag(FlagC, carry)
+	return carry
+}
+
+// subFlags sets N, Z, V and C for r = d - s and returns the borrow
+func (c *CPU) subFlags(s, d, r uint32, size int) bool {
+	m := msb(size)
+	c.setNZ(r, size)
+	borrow := (s&^d|r&^d|s&r)&m != 0
+	c.setFlag(FlagV, (^s&d&^r|s&^d&r)&m != 0)
+	c.setFlag(FlagC, borrow)
+	return borrow
+}
+
+// cond evaluates a 4-bit condition code
+func (c *CPU) cond(cc uint32) bool {
+	n, z, v, cy := c.flag(FlagN), c.flag(FlagZ), c.flag(FlagV), c.flag(FlagC)
+	switch cc {
+	case 0:
+		return true
+	case 1:
+		return false
+	case 2:
+		return !cy && !z
+	case 3:
+		return cy || z
+	case 4:
+		return !cy
+	case 5:
+		return cy
+	case 6:
+		return !z
+	case 7:
+		return z
+	case 8:
+		return !v
+	case 9:
+		return v
+	case 10:
+		return !n
+	case 11:
+		return n
+	case 12:
+		return n == v
+	case 13:
+		return n != v
+	case 14:
+		return !z && n == v
+	}
+	return z || n != v
+}
+
+// JSR calls the subroutine at addr as a JSR instruction would, for trap
+// handlers standing in for operating system calls that run user code
+func (c *CPU) JSR(addr uint32) {
+	c.push32(c.PC)
+	c.PC = addr
+}
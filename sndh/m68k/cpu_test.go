@@ -0,0 +1,169 @@
+package m68k
+
+import "testing"
+
+// ram is a 64KB bus, mirrored over the address space
+type ram [1 << 16]byte
+
+func (r *ram) Read8(addr uint32) uint8     { return r[addr&0xffff] }
+func (r *ram) Write8(addr uint32, v uint8) { r[addr&0xffff] = v }
+
+const (
+	codeAddr  = 0x1000
+	stackAddr = 0x8000
+	rts       = 0x4e75
+)
+
+// run calls the code at codeAddr, followed by an RTS, after setup has
+// prepared the CPU
+func run(t *testing.T, code []uint16, setup func(c *CPU)) *CPU {
+	t.Helper()
+	bus := &ram{}
+	for i, w := range append(code, rts) {
+		bus[codeAddr+2*i] = byte(w >> 8)
+		bus[codeAddr+2*i+1] = byte(w)
+	}
+	c := New(bus)
+	c.A[7] = stackAddr
+	if setup != nil {
+		setup(c)
+	}
+	if err := c.Call(codeAddr, 1000); err != nil {
+		t.Fatalf("%04x: %v", code, err)
+	}
+	return c
+}
+
+// ccr masks the condition codes of the status register
+const ccr = FlagX | FlagN | FlagZ | FlagV | FlagC
+
+// TestFlags runs arithmetic and shift instructions on D0 and D1 and checks
+// the result in D1 and the condition codes
+func TestFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     uint16
+		d0, d1 uint32
+		sr     uint16 // Condition codes before
+		want   uint32 // D1 after
+		flags  uint16 // Condition codes after
+	}{
+		{"ADD.B overflow", 0xd200, 0x01, 0x7f, 0, 0x80, FlagN | FlagV},
+		{"ADD.B carry", 0xd200, 0x01, 0xff, 0, 0x00, FlagX | FlagZ | FlagC},
+		{"ADD.B keeps the upper bytes", 0xd200, 0x01, 0x123456ff, 0, 0x12345600, FlagX | FlagZ | FlagC},
+		{"ADD.W carry and overflow", 0xd240, 0x8000, 0x8000, 0, 0x0000, FlagX | FlagZ | FlagV | FlagC},
+		{"ADD.L clears the flags", 0xd280, 1, 2, ccr, 3, 0},
+		{"SUB.B borrow", 0x9200, 0x01, 0x00, 0, 0xff, FlagX | FlagN | FlagC},
+		{"SUB.B overflow", 0x9200, 0x01, 0x80, 0, 0x7f, FlagV},
+		{"SUB.W zero", 0x9240, 0x1234, 0x1234, ccr, 0, FlagZ},
+		{"CMP.B lower", 0xb200, 0x02, 0x01, 0, 0x01, FlagN | FlagC},
+		{"CMP.B leaves X set", 0xb200, 0x02, 0x01, FlagX, 0x01, FlagX | FlagN | FlagC},
+		{"CMP.W equal", 0xb240, 0x5678, 0x5678, 0, 0x5678, FlagZ},
+		{"CMP.B overflow", 0xb200, 0x01, 0x80, 0, 0x80, FlagV},
+		{"ADDX.B adds X", 0xd300, 0x01, 0x01, FlagX, 0x03, 0},
+		{"ADDX.B zero keeps Z", 0xd300, 0x01, 0xfe, FlagX | FlagZ, 0x00, FlagX | FlagZ | FlagC},
+		{"ADDX.B zero does not set Z", 0xd300, 0x01, 0xfe, FlagX, 0x00, FlagX | FlagC},
+		{"SUBX.B subtracts X", 0x9300, 0x01, 0x01, FlagX | FlagZ, 0xff, FlagX | FlagN | FlagC},
+		{"LSL.B carry", 0xe309, 0, 0x81, 0, 0x02, FlagX | FlagC},
+		{"LSL.B keeps the upper bytes", 0xe309, 0, 0x12345681, 0, 0x12345602, FlagX | FlagC},
+		{"LSR.B to zero", 0xe209, 0, 0x01, 0, 0x00, FlagX | FlagZ | FlagC},
+		{"ASL.B overflow", 0xe301, 0, 0x40, 0, 0x80, FlagN | FlagV},
+		{"ASR.B sign", 0xe201, 0, 0x81, 0, 0xc0, FlagX | FlagN | FlagC},
+		{"ROL.B leaves X", 0xe319, 0, 0x81, 0, 0x03, FlagC},
+		{"ROXL.B through X", 0xe311, 0, 0x80, FlagX, 0x01, FlagX | FlagC},
+		{"LSL.B by D0 of 0 leaves X", 0xe129, 0, 0x80, FlagX | FlagC, 0x80, FlagX | FlagN},
+		{"LSL.W by D0", 0xe169, 4, 0x1234, 0, 0x2340, FlagX | FlagC},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := run(t, []uint16{tt.op}, func(c *CPU) {
+				c.D[0], c.D[1] = tt.d0, tt.d1
+				c.SR |= tt.sr
+			})
+			if c.D[1] != tt.want {
+				t.Errorf("D1 = %08x, want %08x", c.D[1], tt.want)
+			}
+			if got := c.SR & ccr; got != tt.flags {
+				t.Errorf("flags = %05b, want %05b (XNZVC)", got, tt.flags)
+			}
+		})
+	}
+}
+
+// TestDBcc checks that DBcc loops until the counter runs out, only on
+// its low word, and not at all when the condition holds
+func TestDBcc(t *testing.T) {
+	// loop: ADDQ.L #1,D1; DBcc D0,loop
+	tests := []struct {
+		name       string
+		op         uint16
+		wantD0     uint32
+		wantPasses uint32
+	}{
+		{"DBF", 0x51c8, 0x0001ffff, 3},
+		{"DBT", 0x50c8, 0x00010002, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := run(t, []uint16{0x5281, tt.op, 0xfffc}, func(c *CPU) {
+				c.D[0] = 0x00010002
+			})
+			if c.D[0] != tt.wantD0 || c.D[1] != tt.wantPasses {
+				t.Errorf("D0 = %08x, D1 = %d, want %08x and %d", c.D[0], c.D[1], tt.wantD0, tt.wantPasses)
+			}
+		})
+	}
+}
+
+// TestMovem saves registers on the stack with MOVEM -(A7) and reads them
+// back into others with MOVEM (A7)+, then reads a word list, which is
+// sign-extended
+func TestMovem(t *testing.T) {
+	c := run(t, []uint16{
+		0x48e7, 0xe080, // MOVEM.L D0-D2/A0,-(A7)
+		0x4cdf, 0x0270, // MOVEM.L (A7)+,D4-D6/A1
+		0x4c99, 0x0008, // MOVEM.W (A1)+,D3
+	}, func(c *CPU) {
+		c.D[0], c.D[1], c.D[2], c.A[0] = 0x11111111, 0x22222222, 0x33333333, 0x4000
+		c.Bus.Write8(0x4000, 0x80)
+	})
+	if c.D[4] != 0x11111111 || c.D[5] != 0x22222222 || c.D[6] != 0x33333333 {
+		t.Errorf("D4-D6 = %08x %08x %08x, want D0-D2", c.D[4], c.D[5], c.D[6])
+	}
+	if c.A[1] != 0x4002 {
+		t.Errorf("A1 = %06x, want A0 moved past one word, 4002", c.A[1])
+	}
+	if c.D[3] != 0xffff8000 {
+		t.Errorf("D3 = %08x, want the word sign-extended, ffff8000", c.D[3])
+	}
+	if c.A[7] != stackAddr {
+		t.Errorf("A7 = %06x, want it back at %06x", c.A[7], stackAddr)
+	}
+}
+
+// TestCall checks that Call returns through callReturn once the routine
+// returns, nested subroutines included, and gives up on one that does not
+func TestCall(t *testing.T) {
+	c := run(t, []uint16{
+		0x6102, // BSR.S sub
+		rts,
+		0x7005, // sub: MOVEQ #5,D0
+	}, nil)
+	if c.D[0] != 5 {
+		t.Errorf("D0 = %d, want 5 from the subroutine", c.D[0])
+	}
+	if c.PC != callReturn {
+		t.Errorf("PC = %06x, want callReturn %06x", c.PC, callReturn)
+	}
+	if c.A[7] != stackAddr {
+		t.Errorf("A7 = %06x, want it back at %06x", c.A[7], stackAddr)
+	}
+
+	bus := &ram{}
+	bus[codeAddr], bus[codeAddr+1] = 0x60, 0xfe // BRA.S to itself
+	c = New(bus)
+	c.A[7] = stackAddr
+	if err := c.Call(codeAddr, 100); err == nil {
+		t.Errorf("a routine looping forever returned")
+	}
+}
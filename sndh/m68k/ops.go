@@ -0,0 +1,824 @@
+package m68k
+
+// exec decodes and executes one instruction
+func (c *CPU) exec(op uint32) {
+	switch op >> 12 {
+	case 0x0:
+		c.opImmediate(op)
+	case 0x1, 0x2, 0x3:
+		c.opMove(op)
+	case 0x4:
+		c.opMisc(op)
+	case 0x5:
+		c.opQuick(op)
+	case 0x6:
+		c.opBranch(op)
+	case 0x7:
+		c.D[op>>9&7] = signExt(op&0xff, 1)
+		c.setNZ(c.D[op>>9&7], 4)
+	case 0x8:
+		c.opOr(op)
+	case 0x9:
+		c.opAddSub(op, false)
+	case 0xb:
+		c.opCmpEor(op)
+	case 0xc:
+		c.opAnd(op)
+	case 0xd:
+		c.opAddSub(op, true)
+	case 0xe:
+		c.opShift(op)
+	default:
+		// Line A and line F emulators do not exist on the ST
+		c.illegal(op)
+	}
+}
+
+// opImmediate handles line 0: immediate arithmetic, bit operations and
+// MOVEP
+func (c *CPU) opImmediate(op uint32) {
+	mode, reg := op>>3&7, op&7
+	if op&0x0100 != 0 {
+		if mode == 1 {
+			c.opMovep(op)
+			return
+		}
+		c.opBit(op, c.D[op>>9&7], mode, reg)
+		return
+	}
+
+	kind := op >> 9 & 7
+	if kind == 4 {
+		c.opBit(op, c.fetch16()&0xff, mode, reg)
+		return
+	}
+	size := sizes[op>>6&3]
+	if size == 0 || kind == 7 {
+		c.illegal(op)
+		return
+	}
+
+	// ORI, ANDI and EORI to CCR (byte) or SR (word)
+	if mode == 7 && reg == 4 {
+		imm := c.fetch16()
+		if size == 1 {
+			imm = imm&0xff | 0xff00
+			if kind != 1 {
+				imm &= 0xff
+			}
+		}
+		switch kind {
+		case 0:
+			c.SR |= uint16(imm)
+		case 1:
+			c.SR &= uint16(imm)
+		case 5:
+			c.SR ^= uint16(imm)
+		default:
+			c.illegal(op)
+		}
+		return
+	}
+
+	imm := c.immediate(size)
+	dst := c.ea(mode, reg, size)
+	d := c.get(dst, size)
+	switch kind {
+	case 0:
+		r := d | imm
+		c.set(dst, size, r)
+		c.setNZ(r, size)
+	case 1:
+		r := d & imm
+		c.set(dst, size, r)
+		c.setNZ(r, size)
+	case 2:
+		r := d - imm
+		c.setFlag(FlagX, c.subFlags(imm, d, r, size))
+		c.set(dst, size, r)
+	case 3:
+		r := d + imm
+		c.setFlag(FlagX, c.addFlags(imm, d, r, size))
+		c.set(dst, size, r)
+	case 5:
+		r := d ^ imm
+		c.set(dst, size, r)
+		c.setNZ(r, size)
+	case 6:
+		c.subFlags(imm, d, d-imm, size)
+	}
+}
+
+// opBit handles BTST, BCHG, BCLR and BSET; bit numbers are modulo 32 on
+// data registers and modulo 8 in memory
+func (c *CPU) opBit(op, bit, mode, reg uint32) {
+	size := 1
+	if mode == 0 {
+		size = 4
+	}
+	bit &= uint32(size*8 - 1)
+
+	dst := c.ea(mode, reg, size)
+	v := c.get(dst, size)
+	m := uint32(1) << bit
+	c.setFlag(FlagZ, v&m == 0)
+	switch op >> 6 & 3 {
+	case 1:
+		v ^= m
+	case 2:
+		v &^= m
+	case 3:
+		v |= m
+	default:
+		return
+	}
+	c.set(dst, size, v)
+}
+
+// opMovep transfers a register to or from every other byte of memory,
+// the way drivers write the sound chip's select and data ports
+func (c *CPU) opMovep(op uint32) {
+	dn := op >> 9 & 7
+	addr := c.A[op&7] + signExt(c.fetch16(), 2)
+	switch op >> 6 & 7 {
+	case 4:
+		v := c.read8(addr)<<8 | c.read8(addr+2)
+		c.D[dn] = c.D[dn]&^0xffff | v
+	case 5:
+		c.D[dn] = c.read8(addr)<<24 | c.read8(addr+2)<<16 | c.read8(addr+4)<<8 | c.read8(addr+6)
+	case 6:
+		c.write8(addr, c.D[dn]>>8)
+		c.write8(addr+2, c.D[dn])
+	case 7:
+		for i := uint32(0); i < 4; i++ {
+			c.write8(addr+2*i, c.D[dn]>>(24-8*i))
+		}
+	}
+}
+
+// opMove handles MOVE and MOVEA
+func (c *CPU) opMove(op uint32) {
+	size := [4]int{0, 1, 4, 2}[op>>12&3]
+	v := c.get(c.ea(op>>3&7, op&7, size), size)
+
+	mode, reg := op>>6&7, op>>9&7
+	if mode == 1 {
+		c.A[reg] = signExt(v, size)
+		return
+	}
+	c.set(c.ea(mode, reg, size), size, v)
+	c.setNZ(v, size)
+}
+
+// opMisc handles line 4
+func (c *CPU) opMisc(op uint32) {
+	mode, reg := op>>3&7, op&7
+
+	switch {
+	case op&0x01c0 == 0x01c0:
+		c.A[op>>9&7] = c.ea(mode, reg, 4).addr // LEA
+		return
+	case op&0x01c0 == 0x0180:
+		c.opChk(op)
+		return
+	}
+
+	switch op {
+	case 0x4e70, 0x4e71: // RESET, NOP
+		return
+	case 0x4e72: // STOP
+		c.SR = uint16(c.fetch16())
+		c.stopped = true
+		return
+	case 0x4e73: // RTE
+		c.SR = uint16(c.pop16())
+		c.PC = c.pop32()
+		return
+	case 0x4e75: // RTS
+		c.PC = c.pop32()
+		return
+	case 0x4e76: // TRAPV
+		if c.flag(FlagV) {
+			c.exception(7)
+		}
+		return
+	case 0x4e77: // RTR
+		c.SR = c.SR&0xff00 | uint16(c.pop16()&0xff)
+		c.PC = c.pop32()
+		return
+	case 0x4afc: // ILLEGAL
+		c.illegal(op)
+		return
+	}
+
+	switch op & 0xfff8 {
+	case 0x4e50: // LINK
+		disp := signExt(c.fetch16(), 2)
+		c.push32(c.A[reg])
+		c.A[reg] = c.A[7]
+		c.A[7] += disp
+		return
+	case 0x4e58: // UNLK
+		c.A[7] = c.A[reg]
+		c.A[reg] = c.pop32()
+		return
+	case 0x4840: // SWAP
+		c.D[reg] = c.D[reg]<<16 | c.D[reg]>>16
+		c.setNZ(c.D[reg], 4)
+		return
+	case 0x4880: // EXT.W
+		c.D[reg] = c.D[reg]&^0xffff | signExt(c.D[reg]&0xff, 1)&0xffff
+		c.setNZ(c.D[reg], 2)
+		return
+	case 0x48c0: // EXT.L
+		c.D[reg] = signExt(c.D[reg]&0xffff, 2)
+		c.setNZ(c.D[reg], 4)
+		return
+	}
+
+	switch op & 0xfff0 {
+	case 0x4e40: // TRAP
+		if c.Trap != nil {
+			c.Trap(c, int(op&15))
+		} else {
+			c.exception(32 + int(op&15))
+		}
+		return
+	case 0x4e60: // MOVE USP
+		if op&8 != 0 {
+			c.A[reg] = c.USP
+		} else {
+			c.USP = c.A[reg]
+		}
+		return
+	}
+
+	switch op & 0xffc0 {
+	case 0x4e80: // JSR
+		target := c.ea(mode, reg, 4).addr
+		c.push32(c.PC)
+		c.PC = target
+		return
+	case 0x4ec0: // JMP
+		c.PC = c.ea(mode, reg, 4).addr
+		return
+	case 0x40c0: // MOVE from SR
+		c.set(c.ea(mode, reg, 2), 2, uint32(c.SR))
+		return
+	case 0x44c0: // MOVE to CCR
+		c.SR = c.SR&0xff00 | uint16(c.get(c.ea(mode, reg, 2), 2)&0xff)
+		return
+	case 0x46c0: // MOVE to SR
+		c.SR = uint16(c.get(c.ea(mode, reg, 2), 2))
+		return
+	case 0x4800: // NBCD
+		dst := c.ea(mode, reg, 1)
+		c.set(dst, 1, c.bcdSub(0, c.get(dst, 1)))
+		return
+	case 0x4840: // PEA
+		c.push32(c.ea(mode, reg, 4).addr)
+		return
+	case 0x4ac0: // TAS
+		dst := c.ea(mode, reg, 1)
+		v := c.get(dst, 1)
+		c.setNZ(v, 1)
+		c.set(dst, 1, v|0x80)
+		return
+	}
+
+	if op&0xfb80 == 0x4880 {
+		c.opMovem(op)
+		return
+	}
+
+	size := sizes[op>>6&3]
+	if size == 0 {
+		c.illegal(op)
+		return
+	}
+	switch op & 0xff00 {
+	case 0x4000: // NEGX
+		dst := c.ea(mode, reg, size)
+		d := c.get(dst, size)
+		r := 0 - d - c.x()
+		c.setFlag(FlagX, c.subFlagsX(d, 0, r, size))
+		c.set(dst, size, r)
+	case 0x4200: // CLR
+		c.set(c.ea(mode, reg, size), size, 0)
+		c.setNZ(0, size)
+	case 0x4400: // NEG
+		dst := c.ea(mode, reg, size)
+		d := c.get(dst, size)
+		c.setFlag(FlagX, c.subFlags(d, 0, -d, size))
+		c.set(dst, size, -d)
+	case 0x4600: // NOT
+		dst := c.ea(mode, reg, size)
+		r := ^c.get(dst, size)
+		c.set(dst, size, r)
+		c.setNZ(r, size)
+	case 0x4a00: // TST
+		c.setNZ(c.get(c.ea(mode, reg, size), size), size)
+	default:
+		c.illegal(op)
+	}
+}
+
+// opChk traps when a data register is out of bounds
+func (c *CPU) opChk(op uint32) {
+	bound := int16(c.get(c.ea(op>>3&7, op&7, 2), 2))
+	v := int16(c.D[op>>9&7])
+	switch {
+	case v < 0:
+		c.setFlag(FlagN, true)
+		c.exception(6)
+	case v > bound:
+		c.setFlag(FlagN, false)
+		c.exception(6)
+	}
+}
+
+// opMovem saves or restores a list of registers
+func (c *CPU) opMovem(op uint32) {
+	size := 2
+	if op&0x40 != 0 {
+		size = 4
+	}
+	list := c.fetch16()
+	mode, reg := op>>3&7, op&7
+
+	if op&0x0400 == 0 {
+		// Registers to memory; with -(An) the list is reversed
+		if mode == 4 {
+			addr := c.A[reg]
+			for i := 15; i >= 0; i-- {
+				if list&(1<<(15-i)) != 0 {
+					addr -= uint32(size)
+					c.writeSize(addr, size, c.reg(i))
+				}
+			}
+			c.A[reg] = addr
+			return
+		}
+		addr := c.ea(mode, reg, size).addr
+		for i := 0; i < 16; i++ {
+			if list&(1<<i) != 0 {
+				c.writeSize(addr, size, c.reg(i))
+				addr += uint32(size)
+			}
+		}
+		return
+	}
+
+	// Memory to registers; words are sign-extended
+	var addr uint32
+	if mode == 3 {
+		addr = c.A[reg]
+	} else {
+		addr = c.ea(mode, reg, size).addr
+	}
+	for i := 0; i < 16; i++ {
+		if list&(1<<i) != 0 {
+			c.setReg(i, signExt(c.readSize(addr, size), size))
+			addr += uint32(size)
+		}
+	}
+	if mode == 3 {
+		c.A[reg] = addr
+	}
+}
+
+// opQuick handles line 5: ADDQ, SUBQ, Scc and DBcc
+func (c *CPU) opQuick(op uint32) {
+	mode, reg := op>>3&7, op&7
+
+	if op>>6&3 == 3 {
+		cc := op >> 8 & 15
+		if mode == 1 { // DBcc
+			base := c.PC
+			disp := signExt(c.fetch16(), 2)
+			if !c.cond(cc) {
+				w := (c.D[reg] - 1) & 0xffff
+				c.D[reg] = c.D[reg]&^0xffff | w
+				if w != 0xffff {
+					c.PC = base + disp
+				}
+			}
+			return
+		}
+		var v uint32
+		if c.cond(cc) {
+			v = 0xff
+		}
+		c.set(c.ea(mode, reg, 1), 1, v)
+		return
+	}
+
+	data := op >> 9 & 7
+	if data == 0 {
+		data = 8
+	}
+	sub := op&0x0100 != 0
+
+	// Address registers are changed whole, without flags
+	if mode == 1 {
+		if sub {
+			c.A[reg] -= data
+		} else {
+			c.A[reg] += data
+		}
+		return
+	}
+
+	size := sizes[op>>6&3]
+	dst := c.ea(mode, reg, size)
+	d := c.get(dst, size)
+	if sub {
+		c.setFlag(FlagX, c.subFlags(data, d, d-data, size))
+		c.set(dst, size, d-data)
+	} else {
+		c.setFlag(FlagX, c.addFlags(data, d, d+data, size))
+		c.set(dst, size, d+data)
+	}
+}
+
+// opBranch handles Bcc, BRA and BSR
+func (c *CPU) opBranch(op uint32) {
+	base := c.PC
+	disp := signExt(op&0xff, 1)
+	if op&0xff == 0 {
+		disp = signExt(c.fetch16(), 2)
+	}
+
+	cc := op >> 8 & 15
+	switch {
+	case cc == 1: // BSR
+		c.push32(c.PC)
+		c.PC = base + disp
+	case c.cond(cc):
+		c.PC = base + disp
+	}
+}
+
+// opOr handles line 8: OR, DIVU, DIVS and SBCD
+func (c *CPU) opOr(op uint32) {
+	switch {
+	case op>>6&7 == 3:
+		c.opDivu(op)
+	case op>>6&7 == 7:
+		c.opDivs(op)
+	case op&0x01f0 == 0x0100:
+		c.opBcd(op, false)
+	default:
+		c.opLogical(op, func(a, b uint32) uint32 { return a | b })
+	}
+}
+
+// opAnd handles line C: AND, MULU, MULS, ABCD and EXG
+func (c *CPU) opAnd(op uint32) {
+	rx, ry := op>>9&7, op&7
+	switch {
+	case op>>6&7 == 3: // MULU
+		s := c.get(c.ea(op>>3&7, ry, 2), 2)
+		c.D[rx] = (c.D[rx] & 0xffff) * s
+		c.setNZ(c.D[rx], 4)
+	case op>>6&7 == 7: // MULS
+		s := int32(int16(c.get(c.ea(op>>3&7, ry, 2), 2)))
+		c.D[rx] = uint32(int32(int16(c.D[rx])) * s)
+		c.setNZ(c.D[rx], 4)
+	case op&0x01f0 == 0x0100:
+		c.opBcd(op, true)
+	case op&0x01f8 == 0x0140: // EXG Dx,Dy
+		c.D[rx], c.D[ry] = c.D[ry], c.D[rx]
+	case op&0x01f8 == 0x0148: // EXG Ax,Ay
+		c.A[rx], c.A[ry] = c.A[ry], c.A[rx]
+	case op&0x01f8 == 0x0188: // EXG Dx,Ay
+		c.D[rx], c.A[ry] = c.A[ry], c.D[rx]
+	default:
+		c.opLogical(op, func(a, b uint32) uint32 { return a & b })
+	}
+}
+
+// opLogical handles the register forms of AND and OR
+func (c *CPU) opLogical(op uint32, f func(a, b uint32) uint32) {
+	opmode, dn := op>>6&7, op>>9&7
+	size := sizes[opmode&3]
+	o := c.ea(op>>3&7, op&7, size)
+
+	if opmode < 4 {
+		r := f(c.D[dn], c.get(o, size)) & mask(size)
+		c.D[dn] = c.D[dn]&^mask(size) | r
+		c.setNZ(r, size)
+		return
+	}
+	r := f(c.get(o, size), c.D[dn])
+	c.set(o, size, r)
+	c.setNZ(r, size)
+}
+
+// opDivu divides a long by an unsigned word
+func (c *CPU) opDivu(op uint32) {
+	dn := op >> 9 & 7
+	s := c.get(c.ea(op>>3&7, op&7, 2), 2)
+	if s == 0 {
+		c.exception(5)
+		return
+	}
+	q, r := c.D[dn]/s, c.D[dn]%s
+	if q > 0xffff {
+		c.setFlag(FlagV, true)
+		c.setFlag(FlagC, false)
+		return
+	}
+	c.D[dn] = r<<16 | q
+	c.setNZ(q, 2)
+}
+
+// opDivs divides a long by a signed word
+func (c *CPU) opDivs(op uint32) {
+	dn := op >> 9 & 7
+	s := int64(int16(c.get(c.ea(op>>3&7, op&7, 2), 2)))
+	if s == 0 {
+		c.exception(5)
+		return
+	}
+	d := int64(int32(c.D[dn]))
+	q, r := d/s, d%s
+	if q < -0x8000 || q > 0x7fff {
+		c.setFlag(FlagV, true)
+		c.setFlag(FlagC, false)
+		return
+	}
+	c.D[dn] = uint32(uint16(r))<<16 | uint32(uint16(q))
+	c.setNZ(uint32(q), 2)
+}
+
+// opBcd handles ABCD and SBCD, between data registers or -(Ay),-(Ax)
+func (c *CPU) opBcd(op uint32, add bool) {
+	rx, ry := op>>9&7, op&7
+	var src, dst operand
+	if op&8 != 0 {
+		src = c.ea(4, ry, 1)
+		dst = c.ea(4, rx, 1)
+	} else {
+		src = c.ea(0, ry, 1)
+		dst = c.ea(0, rx, 1)
+	}
+	s := c.get(src, 1)
+	d := c.get(dst, 1)
+	if add {
+		c.set(dst, 1, c.bcdAdd(d, s))
+	} else {
+		c.set(dst, 1, c.bcdSub(d, s))
+	}
+}
+
+// bcdAdd returns d + s + X in packed decimal
+func (c *CPU) bcdAdd(d, s uint32) uint32 {
+	r := s&0x0f + d&0x0f + c.x()
+	if r > 9 {
+		r += 6
+	}
+	r += s&0xf0 + d&0xf0
+	carry := r > 0x99
+	if carry {
+		r -= 0xa0
+	}
+	c.setBcdFlags(r, carry)
+	return r
+}
+
+// bcdSub returns d - s - X in packed decimal
+func (c *CPU) bcdSub(d, s uint32) uint32 {
+	r := d&0x0f - s&0x0f - c.x()
+	if r > 9 {
+		r -= 6
+	}
+	r += d&0xf0 - s&0xf0
+	carry := r > 0x99
+	if carry {
+		r += 0xa0
+	}
+	c.setBcdFlags(r, carry)
+	return r
+}
+
+// setBcdFlags sets X and C from the decimal carry; Z is only cleared
+func (c *CPU) setBcdFlags(r uint32, carry bool) {
+	c.setFlag(FlagX, carry)
+	c.setFlag(FlagC, carry)
+	c.setFlag(FlagN, r&0x80 != 0)
+	if r&0xff != 0 {
+		c.setFlag(FlagZ, false)
+	}
+}
+
+// x returns the extend flag as 0 or 1
+func (c *CPU) x() uint32 {
+	if c.flag(FlagX) {
+		return 1
+	}
+	return 0
+}
+
+// subFlagsX is subFlags for the extended forms, where Z is only cleared
+func (c *CPU) subFlagsX(s, d, r uint32, size int) bool {
+	z := c.flag(FlagZ)
+	borrow := c.subFlags(s, d, r, size)
+	if r&mask(size) == 0 {
+		c.setFlag(FlagZ, z)
+	}
+	return borrow
+}
+
+// addFlagsX is addFlags for the extended forms, where Z is only cleared
+func (c *CPU) addFlagsX(s, d, r uint32, size int) bool {
+	z := c.flag(FlagZ)
+	carry := c.addFlags(s, d, r, size)
+	if r&mask(size) == 0 {
+		c.setFlag(FlagZ, z)
+	}
+	return carry
+}
+
+// opAddSub handles lines 9 and D: ADD, ADDA, ADDX and their SUB forms
+func (c *CPU) opAddSub(op uint32, add bool) {
+	opmode, dn := op>>6&7, op>>9&7
+	mode, reg := op>>3&7, op&7
+
+	// ADDA, SUBA: the source is sign-extended, no flags
+	if opmode == 3 || opmode == 7 {
+		size := 2
+		if opmode == 7 {
+			size = 4
+		}
+		v := signExt(c.get(c.ea(mode, reg, size), size), size)
+		if add {
+			c.A[dn] += v
+		} else {
+			c.A[dn] -= v
+		}
+		return
+	}
+
+	size := sizes[opmode&3]
+
+	// ADDX, SUBX between data registers or -(Ay),-(Ax)
+	if opmode >= 4 && mode < 2 {
+		var src, dst operand
+		if mode == 1 {
+			src = c.ea(4, reg, size)
+			dst = c.ea(4, dn, size)
+		} else {
+			src = c.ea(0, reg, size)
+			dst = c.ea(0, dn, size)
+		}
+		s, d := c.get(src, size), c.get(dst, size)
+		if add {
+			r := d + s + c.x()
+			c.setFlag(FlagX, c.addFlagsX(s, d, r, size))
+			c.set(dst, size, r)
+		} else {
+			r := d - s - c.x()
+			c.setFlag(FlagX, c.subFlagsX(s, d, r, size))
+			c.set(dst, size, r)
+		}
+		return
+	}
+
+	o := c.ea(mode, reg, size)
+	var s, d uint32
+	if opmode < 4 {
+		s, d = c.get(o, size), c.D[dn]&mask(size)
+		o = operand{kind: opData, reg: int(dn)}
+	} else {
+		s, d = c.D[dn]&mask(size), c.get(o, size)
+	}
+	var r uint32
+	if add {
+		r = d + s
+		c.setFlag(FlagX, c.addFlags(s, d, r, size))
+	} else {
+		r = d - s
+		c.setFlag(FlagX, c.subFlags(s, d, r, size))
+	}
+	c.set(o, size, r)
+}
+
+// opCmpEor handles line B: CMP, CMPA, CMPM and EOR
+func (c *CPU) opCmpEor(op uint32) {
+	opmode, dn := op>>6&7, op>>9&7
+	mode, reg := op>>3&7, op&7
+
+	switch {
+	case opmode == 3 || opmode == 7: // CMPA
+		size := 2
+		if opmode == 7 {
+			size = 4
+		}
+		s := signExt(c.get(c.ea(mode, reg, size), size), size)
+		d := c.A[dn]
+		c.subFlags(s, d, d-s, 4)
+	case opmode < 3: // CMP
+		size := sizes[opmode]
+		s := c.get(c.ea(mode, reg, size), size)
+		d := c.D[dn] & mask(size)
+		c.subFlags(s, d, d-s, size)
+	case mode == 1: // CMPM
+		size := sizes[opmode&3]
+		s := c.get(c.ea(3, reg, size), size)
+		d := c.get(c.ea(3, dn, size), size)
+		c.subFlags(s, d, d-s, size)
+	default: // EOR
+		size := sizes[opmode&3]
+		o := c.ea(mode, reg, size)
+		r := c.get(o, size) ^ c.D[dn]
+		c.set(o, size, r)
+		c.setNZ(r, size)
+	}
+}
+
+// opShift handles line E: shifts and rotates of registers and memory
+func (c *CPU) opShift(op uint32) {
+	left := op&0x0100 != 0
+
+	// Memory forms shift a word by one bit
+	if op>>6&3 == 3 {
+		o := c.ea(op>>3&7, op&7, 2)
+		c.set(o, 2, c.shift(op>>9&3, left, c.get(o, 2), 1, 2))
+		return
+	}
+
+	size := sizes[op>>6&3]
+	reg := op & 7
+	count := op >> 9 & 7
+	if op&0x20 != 0 {
+		count = c.D[count] & 63
+	} else if count == 0 {
+		count = 8
+	}
+	r := c.shift(op>>3&3, left, c.D[reg]&mask(size), count, size)
+	c.D[reg] = c.D[reg]&^mask(size) | r
+}
+
+// shift applies an AS, LS, ROX or RO shift of count bits and sets the
+// flags
+func (c *CPU) shift(kind uint32, left bool, v, count uint32, size int) uint32 {
+	m, top := mask(size), msb(size)
+	x := c.flag(FlagX)
+	carry, overflow := false, false
+
+	for i := uint32(0); i < count; i++ {
+		if left {
+			carry = v&top != 0
+			r := v << 1 & m
+			switch kind {
+			case 0:
+				overflow = overflow || (r^v)&top != 0
+			case 2:
+				if x {
+					r |= 1
+				}
+				x = carry
+			case 3:
+				if carry {
+					r |= 1
+				}
+			}
+			v = r
+			continue
+		}
+
+		carry = v&1 != 0
+		r := v >> 1
+		switch kind {
+		case 0:
+			r |= v & top
+		case 2:
+			if x {
+				r |= top
+			}
+			x = carry
+		case 3:
+			if carry {
+				r |= top
+			}
+		}
+		v = r
+	}
+
+	c.setNZ(v, size)
+	switch kind {
+	case 2:
+		c.setFlag(FlagC, x)
+		c.setFlag(FlagX, x)
+	case 3:
+		c.setFlag(FlagC, count > 0 && carry)
+	default:
+		if count > 0 {
+			c.setFlag(FlagC, carry)
+			c.setFlag(FlagX, carry)
+		}
+	}
+	c.setFlag(FlagV, overflow)
+	return v
+}
@@ -0,0 +1,226 @@
+package sndh
+
+import (
+	"fmt"
+	"time"
+
+	"bilizir-demo/sndh/m68k"
+
+	"github.com/olivierh59500/ym-player/pkg/stsound"
+)
+
+// Emulated machine layout
+const (
+	ramSize  = 4 << 20 // A 4MB ST
+	loadAddr = 0x10000 // The tune is loaded here, the stack grows below
+	ymClock  = 2000000 // YM2149 clock on the ST
+
+	// Instruction budgets before a routine is considered hung
+	initSteps = 20_000_000
+	playSteps = 2_000_000
+)
+
+// Player renders an SNDH tune by running its replay routine on an
+// emulated 68000 and feeding the sound chip writes to a YM2149 emulator.
+// Effects relying on MFP timer interrupts (SID voices, digidrums) are
+// not emulated.
+type Player struct {
+	Header *Header
+
+	tune       []byte
+	sampleRate int
+	subtune    int
+	mach       *machine
+	cpu        *m68k.CPU
+	left       int // Samples to render before the next replay call
+	acc        int // Fractional sample count carried between calls
+	scratch    []stsound.YmSample
+}
+
+// NewPlayer loads SNDH data, packed or not, and starts its first subtune
+func NewPlayer(data []byte, sampleRate int) (*Player, error) {
+	tune, err := Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tune) > maxTuneSize {
+		return nil, fmt.Errorf("sndh: tune too large (%d bytes)", len(tune))
+	}
+	h, err := ParseHeader(tune)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Player{Header: h, tune: tune, sampleRate: sampleRate}
+	if err := p.Init(1); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Init resets the machine and starts a subtune (1-based)
+func (p *Player) Init(subtune int) error {
+	if subtune < 1 || subtune > p.Header.Subtunes {
+		return fmt.Errorf("sndh: no subtune %d", subtune)
+	}
+	p.subtune = subtune
+	p.mach = newMachine(p.sampleRate)
+	copy(p.mach.ram[loadAddr:], p.tune)
+
+	p.cpu = m68k.New(p.mach)
+	p.cpu.A[7] = loadAddr
+	p.cpu.Trap = p.mach.trap
+	p.left, p.acc = 0, 0
+
+	p.cpu.D[0] = uint32(subtune)
+	if err := p.cpu.Call(loadAddr, initSteps); err != nil {
+		return fmt.Errorf("sndh: init: %w", err)
+	}
+	return nil
+}
+
+// Subtune returns the subtune playing
+func (p *Player) Subtune() int {
+	return p.subtune
+}
+
+// Duration returns the declared length of the subtune playing, or 0 when
+// the file does not declare it
+func (p *Player) Duration() time.Duration {
+	return p.Header.Duration(p.subtune)
+}
+
+// play runs the replay routine once
+func (p *Player) play() error {
+	if err := p.cpu.Call(loadAddr+8, playSteps); err != nil {
+		return fmt.Errorf("sndh: play: %w", err)
+	}
+	return nil
+}
+
+// Compute renders n mono samples into buf. It returns false, with the
+// rest of buf silent, once the replay code crashed.
+func (p *Player) Compute(buf []int16, n int) bool {
+	if cap(p.scratch) < n {
+		p.scratch = make([]stsound.YmSample, n)
+	}
+	out := p.scratch[:n]
+
+	for done := 0; done < n; {
+		if p.left == 0 {
+			if err := p.play(); err != nil {
+				clear(buf[done:n])
+				return false
+			}
+			p.acc += p.sampleRate
+			p.left = p.acc / p.Header.TimerFreq
+			p.acc %= p.Header.TimerFreq
+		}
+		k := min(n-done, p.left)
+		p.mach.ym.Update(out[done:done+k], stsound.YmInt(k))
+		done += k
+		p.left -= k
+	}
+
+	for i, s := range out {
+		buf[i] = int16(s)
+	}
+	return true
+}
+
+// Skip advances the tune by d without rendering, running the replay
+// routine as often as it would have been called
+func (p *Player) Skip(d time.Duration) error {
+	calls := int(d * time.Duration(p.Header.TimerFreq) / time.Second)
+	for range calls {
+		if err := p.play(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register returns the current value of a YM2149 register, 0 to 13
+func (p *Player) Register(reg int) int {
+	return int(p.mach.ym.ReadRegister(stsound.YmInt(reg)))
+}
+
+// Err returns the error that stopped the replay code, if any
+func (p *Player) Err() error {
+	return p.cpu.Err()
+}
+
+// machine is the memory map of the emulated ST: RAM, the YM2149 ports
+// and the MFP registers, which read back what was written
+type machine struct {
+	ram   []byte
+	ym    *stsound.CYm2149Ex
+	ymReg stsound.YmInt
+	mfp   [0x40]byte
+}
+
+func newMachine(sampleRate int) *machine {
+	return &machine{
+		ram: make([]byte, ramSize),
+		ym:  stsound.NewYm2149Ex(ymClock, 1, stsound.YmU32(sampleRate)),
+	}
+}
+
+// Read8 implements m68k.Bus
+func (m *machine) Read8(addr uint32) uint8 {
+	switch {
+	case addr < ramSize:
+		return m.ram[addr]
+	case addr >= 0xff8800 && addr < 0xff8900:
+		// The chip is mirrored every 4 bytes; reading the select port
+		// returns the selected register
+		if addr&2 == 0 {
+			return uint8(m.ym.ReadRegister(m.ymReg))
+		}
+	case addr >= 0xfffa00 && addr < 0xfffa40:
+		return m.mfp[addr-0xfffa00]
+	}
+	return 0xff
+}
+
+// Write8 implements m68k.Bus
+func (m *machine) Write8(addr uint32, v uint8) {
+	switch {
+	case addr < ramSize:
+		m.ram[addr] = v
+	case addr >= 0xff8800 && addr < 0xff8900:
+		if addr&2 == 0 {
+			m.ymReg = stsound.YmInt(v & 15)
+		} else {
+			m.ym.WriteRegister(m.ymReg, stsound.YmInt(v))
+		}
+	case addr >= 0xfffa00 && addr < 0xfffa40:
+		m.mfp[addr-0xfffa00] = v
+	}
+}
+
+// Operating system calls made by some drivers
+const (
+	trapXbios = 14
+
+	xbiosSupexec = 38
+)
+
+// trap stands in for TOS: Supexec runs the given routine, every other
+// call does nothing and returns 0
+func (m *machine) trap(c *m68k.CPU, n int) {
+	sp := c.A[7]
+	if n == trapXbios && m.read16(sp) == xbiosSupexec {
+		c.JSR(m.read32(sp + 2))
+		return
+	}
+	c.D[0] = 0
+}
+
+func (m *machine) read16(addr uint32) uint32 {
+	return uint32(m.Read8(addr&0xffffff))<<8 | uint32(m.Read8((addr+1)&0xffffff))
+}
+
+func (m *machine) read32(addr uint32) uint32 {
+	return m.read16(addr)<<16 | m.read16(addr+2)
+}
@@ -0,0 +1,127 @@
+// Package sndh plays SNDH files, the Atari ST native music format: a tune
+// is the original 68000 replay code driving the YM2149 sound chip, so
+// playing it means running that code on an emulated CPU.
+package sndh
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// maxTuneSize bounds the unpacked size of a tune
+const maxTuneSize = 1 << 20
+
+// headerLimit bounds how far into the file header tags are searched
+const headerLimit = 2048
+
+// DefaultTimerFreq is the replay rate of tunes not declaring one, the
+// PAL vertical blank rate
+const DefaultTimerFreq = 50
+
+// Header is the metadata at the start of an SNDH file
+type Header struct {
+	Title     string
+	Composer  string
+	Ripper    string
+	Converter string
+	Year      string
+	Subtunes  int             // Number of tunes in the file, at least 1
+	TimerFreq int             // Replay calls per second
+	Durations []time.Duration // Length of each subtune, when declared
+}
+
+// Is reports whether data looks like an SNDH file, packed or not
+func Is(data []byte) bool {
+	return isICE(data) || len(data) >= 16 && string(data[12:16]) == "SNDH"
+}
+
+// Unpack returns the plain SNDH data, unpacking ICE! packed files
+func Unpack(data []byte) ([]byte, error) {
+	if isICE(data) {
+		return unpackICE(data)
+	}
+	return data, nil
+}
+
+// ParseHeader reads the tags of unpacked SNDH data
+func ParseHeader(data []byte) (*Header, error) {
+	if len(data) < 16 || string(data[12:16]) != "SNDH" {
+		return nil, errors.New("sndh: missing SNDH header")
+	}
+
+	h := &Header{Subtunes: 1, TimerFreq: DefaultTimerFreq}
+	end := min(len(data), headerLimit)
+	for i := 16; i+4 <= end; {
+		tag := string(data[i : i+4])
+		switch {
+		case tag == "HDNS":
+			return h, nil
+
+		case tag == "TITL", tag == "COMM", tag == "RIPP", tag == "CONV", tag == "YEAR":
+			s, next := cString(data, i+4, end)
+			switch tag {
+			case "TITL":
+				h.Title = s
+			case "COMM":
+				h.Composer = s
+			case "RIPP":
+				h.Ripper = s
+			case "CONV":
+				h.Converter = s
+			case "YEAR":
+				h.Year = s
+			}
+			i = next
+
+		case tag[:2] == "##":
+			if n, err := strconv.Atoi(tag[2:]); err == nil && n > 0 {
+				h.Subtunes = n
+			}
+			i += 4
+
+		case tag == "TIME":
+			i += 4
+			for range h.Subtunes {
+				if i+2 > end {
+					break
+				}
+				secs := int(data[i])<<8 | int(data[i+1])
+				h.Durations = append(h.Durations, time.Duration(secs)*time.Second)
+				i += 2
+			}
+
+		case tag[:2] == "!V", tag[0] == 'T' && tag[1] >= 'A' && tag[1] <= 'D':
+			s, next := cString(data, i+2, end)
+			if f, err := strconv.Atoi(s); err == nil && f > 0 {
+				h.TimerFreq = f
+				i = next
+			} else {
+				i++
+			}
+
+		default:
+			i++
+		}
+	}
+	return h, nil
+}
+
+// Duration returns the declared length of a subtune (1-based), or 0
+func (h *Header) Duration(subtune int) time.Duration {
+	if subtune < 1 || subtune > len(h.Durations) {
+		return 0
+	}
+	return h.Durations[subtune-1]
+}
+
+// cString reads a NUL-terminated string starting at i, returning it and
+// the offset after the terminator
+func cString(data []byte, i, end int) (string, int) {
+	n := bytes.IndexByte(data[i:end], 0)
+	if n < 0 {
+		return string(data[i:end]), end
+	}
+	return string(data[i : i+n]), i + n + 1
+}
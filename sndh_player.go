@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"bilizir-demo/sndh"
+)
+
+// SNDHPlayer plays an SNDH tune for Ebiten audio. The replay code runs
+// on an emulated 68000 inside Read.
+type SNDHPlayer struct {
+	playbackState
+
+	player     *sndh.Player
+	sampleRate int
+	buffer     []int16
+	position   int64 // Samples played since the start of the subtune
+	loop       bool
+	crashed    bool
+}
+
+// NewSNDHPlayer loads an SNDH tune, packed or not, and starts its first
+// subtune
+func NewSNDHPlayer(data []byte, sampleRate int, loop bool) (*SNDHPlayer, error) {
+	player, err := sndh.NewPlayer(data, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SNDH data: %w", err)
+	}
+
+	h := player.Header
+	log.Printf("SNDH: %q by %s, %d subtune(s), %dHz replay", h.Title, h.Composer, h.Subtunes, h.TimerFreq)
+	return &SNDHPlayer{
+		player:        player,
+		sampleRate:    sampleRate,
+		buffer:        make([]int16, 4096),
+		loop:          loop,
+		playbackState: playbackState{volume: 0.5},
+	}, nil
+}
+
+// Read implements io.Reader for audio streaming
+func (s *SNDHPlayer) Read(p []byte) (n int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastRead = time.Now()
+	samplesNeeded := len(p) / 4
+	n = samplesNeeded * 4
+
+	// Silence while paused, and once the replay code has crashed
+	if s.paused || s.crashed {
+		clear(p[:n])
+		return n, nil
+	}
+
+	// Tunes loop by themselves; stop at the declared length otherwise
+	if !s.loop {
+		if d := s.player.Duration(); d > 0 {
+			left := int64(d.Seconds()*float64(s.sampleRate)) - s.position
+			if left <= 0 {
+				return 0, io.EOF
+			}
+			samplesNeeded = int(min(int64(samplesNeeded), left))
+			n = samplesNeeded * 4
+		}
+	}
+
+	for done := 0; done < samplesNeeded; {
+		chunk := min(samplesNeeded-done, len(s.buffer))
+		if !s.player.Compute(s.buffer[:chunk], chunk) && !s.crashed {
+			s.crashed = true
+			log.Printf("SNDH replay stopped: %v", s.player.Err())
+		}
+
+		for i, v := range s.buffer[:chunk] {
+			sample := int16(float64(v) * s.volume)
+			o := (done + i) * 4
+			p[o], p[o+1] = byte(sample), byte(sample>>8)
+			p[o+2], p[o+3] = byte(sample), byte(sample>>8)
+		}
+		done += chunk
+		s.position += int64(chunk)
+	}
+	return n, nil
+}
+
+// ChannelState returns the YM2149 voices as last set by the replay code
+func (s *SNDHPlayer) ChannelState() [3]ChannelState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return ymChannels(s.player.Register)
+}
+
+// Seek implements io.Seeker; offsets are in bytes of 16-bit stereo
+func (s *SNDHPlayer) Seek(offset int64, whence int) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = s.position*4 + offset
+	case io.SeekEnd:
+		pos = int64(s.player.Duration().Seconds()*float64(s.sampleRate))*4 + offset
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	pos = max(pos, 0) / 4 * 4
+
+	s.seek(pos / 4)
+	return s.position * 4, nil
+}
+
+// SeekTime moves playback to the given time in the tune
+func (s *SNDHPlayer) SeekTime(t time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if t < 0 {
+		return
+	}
+	s.seek(int64(t.Seconds() * float64(s.sampleRate)))
+}
+
+// seek moves to a sample position. The replay code can only run
+// forward, so seeking back restarts the subtune and fast-forwards.
+func (s *SNDHPlayer) seek(sample int64) {
+	from := s.position
+	if sample < from {
+		if err := s.player.Init(s.player.Subtune()); err != nil {
+			log.Printf("SNDH seek failed: %v", err)
+			return
+		}
+		s.crashed = false
+		from = 0
+	}
+
+	d := time.Duration(sample-from) * time.Second / time.Duration(s.sampleRate)
+	if err := s.player.Skip(d); err != nil && !s.crashed {
+		s.crashed = true
+		log.Printf("SNDH replay stopped: %v", err)
+	}
+	s.position = sample
+}
+
+// MusicPosition returns the current time in the tune
+func (s *SNDHPlayer) MusicPosition() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pos := time.Duration(s.position) * time.Second / time.Duration(s.sampleRate)
+	if d := s.player.Duration(); d > 0 && s.loop {
+		pos %= d
+	}
+	return pos
+}
+
+// Duration returns the declared length of the tune, 0 when the file
+// does not declare it
+func (s *SNDHPlayer) Duration() time.Duration {
+	return s.player.Duration()
+}
+
+// Info returns the title, composer and year tags of the tune
+func (s *SNDHPlayer) Info() TuneInfo {
+	h := s.player.Header
+	return TuneInfo{Format: "SNDH", Title: h.Title, Author: h.Composer, Year: h.Year}
+}
+
+// Close releases resources
+func (s *SNDHPlayer) Close() error {
+	return nil
+}
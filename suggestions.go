@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"bilizir-demo/analysis"
+	"bilizir-demo/timeline"
+)
+
+// suggestedScript builds a starting demo script with one scene between
+// each pair of suggested boundaries
+func suggestedScript(bounds []time.Duration, length time.Duration) *timeline.Script {
+	s := &timeline.Script{}
+	ends := append(append([]time.Duration(nil), bounds...), length)
+	start := time.Duration(0)
+	for i, b := range ends {
+		b = b.Round(10 * time.Millisecond)
+		if b <= start {
+			continue
+		}
+		s.Scenes = append(s.Scenes, timeline.Scene{
+			Name:  fmt.Sprintf("part%d", i+1),
+			Start: start,
+			End:   b,
+		})
+		start = b
+	}
+	return s
+}
+
+// writeSuggestedScript analyzes the tune and writes a starting demo
+// script to path, for the -suggest command
+func writeSuggestedScript(path string) error {
+	w, err := analysis.AnalyzeTune(musicData, sampleRate, analysis.DefaultWindow)
+	if err != nil {
+		return err
+	}
+	bounds := analysis.Sections(w, analysis.DefaultSectionOptions)
+	return suggestedScript(bounds, w.Duration()).Save(path)
+}
+
+// replaceScriptCommand swaps the whole demo script, so applying the
+// suggestions in the timeline editor can be undone
+type replaceScriptCommand struct {
+	g        *Game
+	from, to *timeline.Script
+}
+
+func (c *replaceScriptCommand) Do() {
+	c.g.script = c.to
+	c.g.saveScript()
+}
+
+func (c *replaceScriptCommand) Undo() {
+	c.g.script = c.from
+	c.g.saveScript()
+}
+
+func (c *replaceScriptCommand) Describe() string {
+	return "apply suggested scenes"
+}
+
+// applySuggestions replaces the demo script with the suggested scenes
+func (g *Game) applySuggestions() {
+	if len(g.suggestions) == 0 {
+		g.editor.status = "no suggestions yet"
+		return
+	}
+	length := g.musicLength()
+	if g.waveform != nil {
+		length = g.waveform.Duration()
+	}
+	// Only the scenes are suggested, the rest of the script is kept, its
+	// comments included
+	g.history.Run(&replaceScriptCommand{
+		g:    g,
+		from: g.script,
+		to:   g.script.WithScenes(suggestedScript(g.suggestions, length).Scenes),
+	})
+}
@@ -0,0 +1,163 @@
+// Package sysfont draws HUD, console and debug text in a compact 8x8
+// bitmap font, apart from the scroller fonts of the demo. Characters
+// outside printable ASCII are drawn by the fallback set with SetFallback,
+// or as '?'.
+package sysfont
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// Font metrics at scale 1, in pixels. Lines are spaced two pixels apart.
+const (
+	CharWidth  = 8
+	CharHeight = 8
+	LineHeight = 10
+)
+
+// Align is the horizontal alignment of text on its x position
+type Align int
+
+const (
+	Left   Align = iota // Lines start at x
+	Center              // Lines are centered on x
+	Right               // Lines end at x
+)
+
+// tabWidth is the number of spaces a tab stands for
+const tabWidth = 4
+
+// atlasColumns is the number of glyphs per row of the atlas
+const atlasColumns = 16
+
+// shadowColor is the drop shadow keeping text legible over the demo
+var shadowColor = color.RGBA{0, 0, 0, 0xc0}
+
+// Style is how text is drawn. The zero Style draws white, left-aligned
+// text at scale 1 with a drop shadow.
+type Style struct {
+	Color color.Color // White when nil
+	Align Align
+	Scale int  // Pixel size of the font, 1 when zero
+	Flat  bool // No drop shadow
+}
+
+// scale returns the pixel size of the style
+func (st Style) scale() int {
+	return max(st.Scale, 1)
+}
+
+var (
+	atlasOnce sync.Once
+	atlas     *ebiten.Image
+	fallback  func(r rune) (*ebiten.Image, bool)
+)
+
+// SetFallback sets what draws the characters outside printable ASCII: it
+// returns a white glyph of a character in a CharWidth x CharHeight cell,
+// false for characters it lacks, which are drawn as '?'
+func SetFallback(f func(r rune) (*ebiten.Image, bool)) {
+	fallback = f
+}
+
+// glyphAtlas returns the image holding every glyph, white on transparent,
+// built on first use
+func glyphAtlas() *ebiten.Image {
+	atlasOnce.Do(func() {
+		rows := (len(glyphs) + atlasColumns - 1) / atlasColumns
+		img := image.NewRGBA(image.Rect(0, 0, atlasColumns*CharWidth, rows*CharHeight))
+		for i, g := range glyphs {
+			ox, oy := i%atlasColumns*CharWidth, i/atlasColumns*CharHeight
+			for y, bits := range g {
+				for x := range CharWidth {
+					if bits>>x&1 != 0 {
+						img.Set(ox+x, oy+y, color.White)
+					}
+				}
+			}
+		}
+		atlas = ebiten.NewImageFromImage(img)
+	})
+	return atlas
+}
+
+// glyphIndex returns the index of the glyph of a character, '?' for
+// characters the font lacks
+func glyphIndex(r rune) int {
+	if r < ' ' || r > '~' {
+		r = '?'
+	}
+	return int(r - ' ')
+}
+
+// expand replaces the tabs of a line with spaces
+func expand(line string) string {
+	return strings.ReplaceAll(line, "\t", strings.Repeat(" ", tabWidth))
+}
+
+// Measure returns the size of text drawn in a style, lines being split
+// at newlines
+func Measure(text string, st Style) (w, h int) {
+	lines := strings.Split(text, "\n")
+	for _, l := range lines {
+		w = max(w, len([]rune(expand(l))))
+	}
+	k := st.scale()
+	return w * CharWidth * k, ((len(lines)-1)*LineHeight + CharHeight) * k
+}
+
+// Print draws text on dst at x, y, the top of its first line, with lines
+// split at newlines and aligned on x
+func Print(dst *ebiten.Image, text string, x, y int, st Style) {
+	if !st.Flat {
+		shadow := st
+		shadow.Color, shadow.Flat = shadowColor, true
+		Print(dst, text, x+st.scale(), y+st.scale(), shadow)
+	}
+
+	src := glyphAtlas()
+	k := st.scale()
+	op := &ebiten.DrawImageOptions{}
+	if st.Color != nil {
+		op.ColorScale.ScaleWithColor(st.Color)
+	}
+	for i, line := range strings.Split(text, "\n") {
+		runes := []rune(expand(line))
+		lx := x
+		switch st.Align {
+		case Center:
+			lx -= len(runes) * CharWidth * k / 2
+		case Right:
+			lx -= len(runes) * CharWidth * k
+		}
+		ly := y + i*LineHeight*k
+		for j, r := range runes {
+			if r == ' ' {
+				continue
+			}
+			op.GeoM.Reset()
+			op.GeoM.Scale(float64(k), float64(k))
+			op.GeoM.Translate(float64(lx+j*CharWidth*k), float64(ly))
+			if r > '~' && fallback != nil {
+				if img, ok := fallback(r); ok {
+					dst.DrawImage(img, op)
+					continue
+				}
+			}
+			g := glyphIndex(r)
+			sx, sy := g%atlasColumns*CharWidth, g/atlasColumns*CharHeight
+			dst.DrawImage(src.SubImage(image.Rect(sx, sy, sx+CharWidth, sy+CharHeight)).(*ebiten.Image), op)
+		}
+	}
+}
+
+// Printf formats text like fmt.Sprintf and draws it like Print
+func Printf(dst *ebiten.Image, x, y int, st Style, format string, args ...any) {
+	Print(dst, fmt.Sprintf(format, args...), x, y, st)
+}
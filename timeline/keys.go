@@ -0,0 +1,66 @@
+package timeline
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Key is an orientation keyframe of a named track, such as "cubes": Euler
+// angles in degrees, applied around X, then Y, then Z. Effects turn
+// smoothly from one key to the next.
+type Key struct {
+	Track  string
+	Time   time.Duration
+	Angles [3]float64
+}
+
+// KeysAt returns the keys of track around t, which wraps with the script
+// length like At, and how far t is from a to b, 0 to 1. Before the first
+// key and after the last one, a and b are that key. ok is false when the
+// track has no keys.
+func (s *Script) KeysAt(track string, t time.Duration) (a, b Key, frac float64, ok bool) {
+	var keys []Key
+	for _, k := range s.Keys {
+		if k.Track == track {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return Key{}, Key{}, 0, false
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].Time < keys[j].Time })
+	if length := s.Length(); length > 0 {
+		t = wrap(t, length)
+	}
+
+	i := sort.Search(len(keys), func(i int) bool { return keys[i].Time > t })
+	switch {
+	case i == 0:
+		return keys[0], keys[0], 0, true
+	case i == len(keys):
+		return keys[i-1], keys[i-1], 0, true
+	}
+	a, b = keys[i-1], keys[i]
+	return a, b, float64(t-a.Time) / float64(b.Time-a.Time), true
+}
+
+// parseKey reads "key <track> <time> <x> <y> <z>"
+func (s *Script) parseKey(fields []string) error {
+	if len(fields) != 6 {
+		return fmt.Errorf("expected \"key <track> <time> <x> <y> <z>\"")
+	}
+	t, err := parseTime(fields[2])
+	if err != nil {
+		return err
+	}
+	k := Key{Track: fields[1], Time: t}
+	for i, f := range fields[3:] {
+		if k.Angles[i], err = strconv.ParseFloat(f, 64); err != nil {
+			return fmt.Errorf("invalid angle %q", f)
+		}
+	}
+	s.Keys = append(s.Keys, k)
+	return nil
+}
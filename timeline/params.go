@@ -0,0 +1,117 @@
+package timeline
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamChange sets an effect parameter from the script, when the script
+// is loaded or, when Timed, at Time on the timeline, gliding from the
+// value it had to Value over Glide
+type ParamChange struct {
+	Name  string
+	Value float64
+	Timed bool
+	Time  time.Duration
+	Glide time.Duration
+}
+
+// TimedParams returns the names of the parameters the script changes on
+// the timeline, sorted
+func (s *Script) TimedParams() []string {
+	var names []string
+	for _, p := range s.Params {
+		if p.Timed && !slices.Contains(names, p.Name) {
+			names = append(names, p.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParamAt returns the value the timed changes of the named parameter
+// give it at t, which wraps with the script length like At. Before the
+// first change the parameter holds base, and each change eases from the
+// value before it. ok is false when the script does not change the
+// parameter on the timeline.
+func (s *Script) ParamAt(name string, t time.Duration, base float64) (value float64, ok bool) {
+	var changes []ParamChange
+	for _, p := range s.Params {
+		if p.Timed && p.Name == name {
+			changes = append(changes, p)
+		}
+	}
+	if len(changes) == 0 {
+		return 0, false
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Time < changes[j].Time })
+	if length := s.Length(); length > 0 {
+		t = wrap(t, length)
+	}
+
+	value = base
+	for _, c := range changes {
+		if c.Time > t {
+			break
+		}
+		if t >= c.Time+c.Glide {
+			value = c.Value
+			continue
+		}
+		f := float64(t-c.Time) / float64(c.Glide)
+		f = f * f * (3 - 2*f)
+		value += (c.Value - value) * f
+	}
+	return value, true
+}
+
+// parseParam reads "param <name> <value> [at <time>] [glide <duration>]"
+func (s *Script) parseParam(fields []string) error {
+	const usage = "expected \"param <name> <value> [at <time>] [glide <duration>]\""
+	if len(fields) < 3 || len(fields)%2 == 0 {
+		return errors.New(usage)
+	}
+	v, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return fmt.Errorf("invalid value %q for parameter %s", fields[2], fields[1])
+	}
+	p := ParamChange{Name: fields[1], Value: v}
+	for i := 3; i < len(fields); i += 2 {
+		switch fields[i] {
+		case "at":
+			if p.Time, err = parseTime(fields[i+1]); err != nil {
+				return err
+			}
+			p.Timed = true
+		case "glide":
+			if p.Glide, err = parseTime(fields[i+1]); err != nil {
+				return err
+			}
+		default:
+			return errors.New(usage)
+		}
+	}
+	if p.Glide > 0 && !p.Timed {
+		return fmt.Errorf("parameter %s glides but has no time, add \"at <time>\"", p.Name)
+	}
+	s.Params = append(s.Params, p)
+	return nil
+}
+
+// formatParam returns a parameter change in the demo script syntax
+func formatParam(p ParamChange) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "param %s %s", p.Name, strconv.FormatFloat(p.Value, 'g', -1, 64))
+	if p.Timed {
+		fmt.Fprintf(&b, " at %s", formatDuration(p.Time))
+	}
+	if p.Glide > 0 {
+		fmt.Fprintf(&b, " glide %s", formatDuration(p.Glide))
+	}
+	return b.String()
+}
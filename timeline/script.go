@@ -0,0 +1,569 @@
+// Package timeline holds the scene list of the intro, the demo script
+// file it is authored in, and the sequencer scheduling the scenes.
+package timeline
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Scene is a named block of the intro on the music timeline
+type Scene struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+	Fade  time.Duration // Fade in after Start and out before End
+	Style string        // Visual style of the parts shown, such as "toon"
+
+	// Reveal names a mask the fades go through instead of fading from
+	// black, such as "iris", or "pip" for a picture-in-picture preview
+	Reveal string
+
+	// Mirror folds the frame: 1 mirrors it around a vertical axis, more
+	// makes a kaleidoscope of that many wedges, 0 leaves it alone
+	Mirror int
+
+	// Music is a tune played instead of the main one while the scene
+	// shows, a path relative to the demo script
+	Music string
+
+	// Crossfade is how long the tune of the scene fades in over the one
+	// before it and out under the one after, 0 to cut between them
+	Crossfade time.Duration
+
+	line int // Line of the scene in the source of the script, 0 if none
+}
+
+// Definition names the parts a scene shows, back to front, adding a
+// scene to the built-in ones or recomposing one of them
+type Definition struct {
+	Scene string
+	Parts []string
+}
+
+// Script is the ordered list of scenes making up the intro, the parts
+// they show, the sync events effects follow, the orientation keys they
+// are choreographed with, the camera shots directing the 3D parts and
+// the effect parameters set along the way
+type Script struct {
+	Scenes  []Scene
+	Defines []Definition
+	Syncs   []Sync
+	Keys    []Key
+	Shots   []Shot
+	Params  []ParamChange
+
+	// source is the text the script was parsed from, which Format edits
+	// so the comments and the spelling of the times survive a save
+	source []byte
+}
+
+// FrameRate is the rate of frame-based times in demo scripts, the PAL
+// vertical blank rate of the Atari ST
+const FrameRate = 50
+
+// Parse reads a demo script. Each non-empty line declares a scene, with
+// an optional fade duration, reveal mask, visual style, mirror fold and
+// tune with its crossfade, the parts a scene shows, a sync, either periodic, at given times or on
+// tracker rows, an orientation key in degrees, a camera shot with keyframed parameters,
+// or an effect parameter set on loading or at a time:
+//
+//	# scene part...
+//	define finale stars cubes logo scroller
+//
+//	# name  start  end  [fade duration] [reveal mask] [style name] [mirror n] [music path] [crossfade duration]
+//	scene intro 0s 12s
+//	scene cubes 12s 30.5s fade 500ms reveal iris style toon
+//	scene greetings 1525f 3000f fade 25f
+//	scene breakdown 1m 1m20s mirror 6
+//	scene chiptune 1m20s 2m music tunes/breeze.ahx crossfade 2s
+//
+//	# name every interval [from start], name at time..., or
+//	# name on pattern|row|instrument [n...] with a tracker module
+//	sync beat every 24f from 12f
+//	sync drop at 30s 1m2.5s
+//	sync kick on instrument 1
+//
+//	# track time x y z
+//	key cubes 12s 0 0 0
+//	key cubes 14s 90 45 0
+//
+//	# track kind start end [param value[,value...]]...
+//	shot objects orbit 20s 30s angle 0,360 height 0.3
+//	shot cubes dolly-in 40s 44s distance 3,0.8
+//
+//	# name value [at time] [glide duration]
+//	param copper.speed1 2
+//	param raymarch.twist 3 at 30s glide 4s
+//
+// Times are Go durations, or frame counts at FrameRate with an 'f'
+// suffix. '#' starts a comment.
+func Parse(data []byte) (*Script, error) {
+	s := &Script{source: data}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		text, _, _ := strings.Cut(sc.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var err error
+		switch fields[0] {
+		case "scene":
+			if err = s.parseScene(fields); err == nil {
+				s.Scenes[len(s.Scenes)-1].line = line
+			}
+		case "define":
+			err = s.parseDefine(fields)
+		case "sync":
+			err = s.parseSync(fields)
+		case "key":
+			err = s.parseKey(fields)
+		case "shot":
+			err = s.parseShot(fields)
+		case "param":
+			err = s.parseParam(fields)
+		default:
+			err = fmt.Errorf("unknown statement %q", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return s, sc.Err()
+}
+
+// parseScene reads "scene <name> <start> <end> [fade <duration>]
+// [reveal <mask>] [style <name>] [mirror <n>] [music <path>]
+// [crossfade <duration>]"
+func (s *Script) parseScene(fields []string) error {
+	const usage = "expected \"scene <name> <start> <end> [fade <duration>] [reveal <mask>] [style <name>] [mirror <n>] [music <path>] [crossfade <duration>]\""
+	if len(fields) < 4 || len(fields)%2 != 0 {
+		return errors.New(usage)
+	}
+	start, err := parseTime(fields[2])
+	if err != nil {
+		return err
+	}
+	end, err := parseTime(fields[3])
+	if err != nil {
+		return err
+	}
+	if end <= start {
+		return fmt.Errorf("scene %s ends before it starts", fields[1])
+	}
+	sc := Scene{Name: fields[1], Start: start, End: end}
+	for i := 4; i < len(fields); i += 2 {
+		switch fields[i] {
+		case "fade":
+			if sc.Fade, err = parseTime(fields[i+1]); err != nil {
+				return err
+			}
+		case "reveal":
+			sc.Reveal = fields[i+1]
+		case "style":
+			sc.Style = fields[i+1]
+		case "mirror":
+			n, err := strconv.Atoi(fields[i+1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid mirror %q, expected a count of 1 or more", fields[i+1])
+			}
+			sc.Mirror = n
+		case "music":
+			sc.Music = fields[i+1]
+		case "crossfade":
+			if sc.Crossfade, err = parseTime(fields[i+1]); err != nil {
+				return err
+			}
+		default:
+			return errors.New(usage)
+		}
+	}
+	s.Scenes = append(s.Scenes, sc)
+	return nil
+}
+
+// parseDefine reads "define <scene> <part>..."
+func (s *Script) parseDefine(fields []string) error {
+	if len(fields) < 3 {
+		return errors.New("expected \"define <scene> <part>...\"")
+	}
+	s.Defines = append(s.Defines, Definition{Scene: fields[1], Parts: fields[2:]})
+	return nil
+}
+
+// PartsOf returns the parts the script defines a scene to show. When a
+// scene is defined twice the last definition wins; ok is false when the
+// script does not define it.
+func (s *Script) PartsOf(scene string) (parts []string, ok bool) {
+	for _, d := range s.Defines {
+		if d.Scene == scene {
+			parts, ok = d.Parts, true
+		}
+	}
+	return parts, ok
+}
+
+// parseSync reads "sync <name> every <interval> [from <start>]",
+// "sync <name> at <time>..." or "sync <name> on <source> [<n>...]"
+func (s *Script) parseSync(fields []string) error {
+	const usage = "expected \"sync <name> every <interval> [from <start>]\", \"sync <name> at <time>...\" or \"sync <name> on <source> [<n>...]\""
+	if len(fields) >= 3 && fields[2] == "on" {
+		return s.parseTrackerSync(fields)
+	}
+	if len(fields) < 4 {
+		return errors.New(usage)
+	}
+
+	sy := Sync{Name: fields[1]}
+	switch fields[2] {
+	case "every":
+		if len(fields) != 4 && (len(fields) != 6 || fields[4] != "from") {
+			return errors.New(usage)
+		}
+		every, err := parseTime(fields[3])
+		if err != nil {
+			return err
+		}
+		if every <= 0 {
+			return fmt.Errorf("sync %s has no interval", sy.Name)
+		}
+		sy.Every = every
+		if len(fields) == 6 {
+			if sy.From, err = parseTime(fields[5]); err != nil {
+				return err
+			}
+		}
+	case "at":
+		for _, f := range fields[3:] {
+			t, err := parseTime(f)
+			if err != nil {
+				return err
+			}
+			sy.Markers = append(sy.Markers, t)
+		}
+	default:
+		return errors.New(usage)
+	}
+	s.Syncs = append(s.Syncs, sy)
+	return nil
+}
+
+// parseTrackerSync reads "sync <name> on pattern [<pattern>...]",
+// "sync <name> on row <row>..." or "sync <name> on instrument <n>..."
+func (s *Script) parseTrackerSync(fields []string) error {
+	if len(fields) < 4 {
+		return errors.New("expected \"sync <name> on pattern|row|instrument [<n>...]\"")
+	}
+	sy := Sync{Name: fields[1], On: fields[3]}
+	switch sy.On {
+	case OnPattern, OnRow, OnInstrument:
+	default:
+		return fmt.Errorf("unknown sync source %q", sy.On)
+	}
+	for _, f := range fields[4:] {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s %q", sy.On, f)
+		}
+		sy.Values = append(sy.Values, n)
+	}
+	if len(sy.Values) == 0 && sy.On != OnPattern {
+		return fmt.Errorf("sync %s: no %s given", sy.Name, sy.On)
+	}
+	s.Syncs = append(s.Syncs, sy)
+	return nil
+}
+
+// Load reads the demo script at path
+func Load(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Format returns the script in the demo script syntax. A script parsed
+// from a file keeps its text: comments, spacing and every statement but
+// the scenes stay as written, scenes only get the times that moved
+// rewritten, in frames where they were written in frames, and scenes
+// added go after the last one kept. Other scripts are written from
+// scratch.
+func (s *Script) Format() []byte {
+	if s.source == nil {
+		return s.format()
+	}
+
+	kept := map[int]Scene{}
+	var added []Scene
+	for _, sc := range s.Scenes {
+		if sc.line > 0 {
+			kept[sc.line] = sc
+		} else {
+			added = append(added, sc)
+		}
+	}
+	lines := strings.SplitAfter(string(s.source), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	// The added scenes go after the last scene kept, else in place of
+	// the first scene, else at the end
+	anchor := -1
+	for i, l := range lines {
+		if isScene(l) {
+			if _, ok := kept[i+1]; ok || anchor < 0 {
+				anchor = i
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	for i, l := range lines {
+		if isScene(l) {
+			if sc, ok := kept[i+1]; ok {
+				b.WriteString(patchScene(l, sc))
+			}
+		} else {
+			b.WriteString(l)
+		}
+		if i == anchor {
+			writeScenes(&b, added)
+			added = nil
+		}
+	}
+	if len(added) > 0 {
+		if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+			b.WriteByte('\n')
+		}
+		writeScenes(&b, added)
+	}
+	return b.Bytes()
+}
+
+// WithScenes returns a copy of the script with other scenes, the rest of
+// it and the text it was parsed from kept
+func (s *Script) WithScenes(scenes []Scene) *Script {
+	c := *s
+	c.Scenes = scenes
+	return &c
+}
+
+// isScene reports whether a line of a script declares a scene
+func isScene(line string) bool {
+	code, _, _ := strings.Cut(line, "#")
+	fields := strings.Fields(code)
+	return len(fields) > 0 && fields[0] == "scene"
+}
+
+// writeScenes writes scene statements, one a line
+func writeScenes(b *bytes.Buffer, scenes []Scene) {
+	for _, sc := range scenes {
+		b.WriteString(formatScene(sc))
+		b.WriteByte('\n')
+	}
+}
+
+// formatScene returns the statement declaring a scene
+func formatScene(sc Scene) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "scene %s %s %s", sc.Name, formatDuration(sc.Start), formatDuration(sc.End))
+	if sc.Fade > 0 {
+		fmt.Fprintf(&b, " fade %s", formatDuration(sc.Fade))
+	}
+	if sc.Reveal != "" {
+		fmt.Fprintf(&b, " reveal %s", sc.Reveal)
+	}
+	if sc.Style != "" {
+		fmt.Fprintf(&b, " style %s", sc.Style)
+	}
+	if sc.Mirror > 0 {
+		fmt.Fprintf(&b, " mirror %d", sc.Mirror)
+	}
+	if sc.Music != "" {
+		fmt.Fprintf(&b, " music %s", sc.Music)
+	}
+	if sc.Crossfade > 0 {
+		fmt.Fprintf(&b, " crossfade %s", formatDuration(sc.Crossfade))
+	}
+	return b.String()
+}
+
+// patchScene rewrites the scene statement on line for sc, replacing the
+// start and end where they moved, spelled the way they were, and keeping
+// the spacing, the comment and the line ending. A scene changed in other
+// ways is written anew, its comment kept.
+func patchScene(line string, sc Scene) string {
+	body := strings.TrimRight(line, "\r\n")
+	eol := line[len(body):]
+	code, comment, commented := strings.Cut(body, "#")
+
+	spans := fieldSpans(code)
+	for _, f := range []struct {
+		index int
+		t     time.Duration
+	}{{3, sc.End}, {2, sc.Start}} {
+		if f.index >= len(spans) {
+			break
+		}
+		from, to := spans[f.index][0], spans[f.index][1]
+		if t, err := parseTime(code[from:to]); err != nil || t != f.t {
+			code = code[:from] + formatTimeLike(f.t, code[from:to]) + code[to:]
+		}
+	}
+
+	var check Script
+	if err := check.parseScene(strings.Fields(code)); err != nil || !sameScene(check.Scenes[0], sc) {
+		code = formatScene(sc)
+		if commented {
+			code += " "
+		}
+	}
+	if commented {
+		return code + "#" + comment + eol
+	}
+	return code + eol
+}
+
+// sameScene reports whether two scenes are the same, wherever they were
+// read from
+func sameScene(a, b Scene) bool {
+	a.line, b.line = 0, 0
+	return a == b
+}
+
+// fieldSpans returns the byte offsets of the space-separated fields of s
+func fieldSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if !space && start < 0 {
+			start = i
+		} else if space && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// formatTimeLike prints a time the way like, the time it replaces, was
+// written: as a frame count if like was one and the time is a whole
+// number of frames, else in seconds
+func formatTimeLike(d time.Duration, like string) string {
+	frame := time.Second / FrameRate
+	if strings.HasSuffix(like, "f") && d%frame == 0 {
+		return fmt.Sprintf("%df", d/frame)
+	}
+	return formatDuration(d)
+}
+
+// format writes the script from scratch, with a header comment giving
+// the syntax of the statements it has
+func (s *Script) format() []byte {
+	var b bytes.Buffer
+	b.WriteString("# bilizir demo script: scene <name> <start> <end> [fade <duration>] [reveal <mask>] [style <name>] [mirror <n>] [music <path>] [crossfade <duration>]\n")
+	if len(s.Defines) > 0 {
+		b.WriteString("# define <scene> <part>...\n")
+	}
+	if len(s.Syncs) > 0 {
+		b.WriteString("# sync <name> every <interval> [from <start>], sync <name> at <time>..., or sync <name> on pattern|row|instrument [<n>...]\n")
+	}
+	if len(s.Keys) > 0 {
+		b.WriteString("# key <track> <time> <x> <y> <z>, angles in degrees\n")
+	}
+	if len(s.Shots) > 0 {
+		b.WriteString("# shot <track> <kind> <start> <end> [<param> <value>[,<value>...]]...\n")
+	}
+	if len(s.Params) > 0 {
+		b.WriteString("# param <name> <value> [at <time>] [glide <duration>]\n")
+	}
+	for _, d := range s.Defines {
+		fmt.Fprintf(&b, "define %s %s\n", d.Scene, strings.Join(d.Parts, " "))
+	}
+	for _, sc := range s.Scenes {
+		b.WriteString(formatScene(sc))
+		b.WriteByte('\n')
+	}
+	for _, sy := range s.Syncs {
+		fmt.Fprintf(&b, "sync %s", sy.Name)
+		if sy.On != "" {
+			fmt.Fprintf(&b, " on %s", sy.On)
+			for _, v := range sy.Values {
+				fmt.Fprintf(&b, " %d", v)
+			}
+		} else if sy.Every > 0 {
+			fmt.Fprintf(&b, " every %s", formatDuration(sy.Every))
+			if sy.From > 0 {
+				fmt.Fprintf(&b, " from %s", formatDuration(sy.From))
+			}
+		} else {
+			b.WriteString(" at")
+			for _, t := range sy.Markers {
+				fmt.Fprintf(&b, " %s", formatDuration(t))
+			}
+		}
+		b.WriteByte('\n')
+	}
+	for _, k := range s.Keys {
+		fmt.Fprintf(&b, "key %s %s %g %g %g\n", k.Track, formatDuration(k.Time), k.Angles[0], k.Angles[1], k.Angles[2])
+	}
+	for _, sh := range s.Shots {
+		b.WriteString(formatShot(sh))
+		b.WriteByte('\n')
+	}
+	for _, p := range s.Params {
+		b.WriteString(formatParam(p))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Save writes the script to path
+func (s *Script) Save(path string) error {
+	return os.WriteFile(path, s.Format(), 0o644)
+}
+
+// Length returns the end of the last scene
+func (s *Script) Length() time.Duration {
+	var end time.Duration
+	for _, sc := range s.Scenes {
+		end = max(end, sc.End)
+	}
+	return end
+}
+
+// parseTime reads a script time, either a Go duration or a frame count
+// such as "250f"
+func parseTime(s string) (time.Duration, error) {
+	if n, ok := strings.CutSuffix(s, "f"); ok {
+		frames, err := strconv.Atoi(n)
+		if err != nil || frames < 0 {
+			return 0, fmt.Errorf("invalid frame count %q", s)
+		}
+		return time.Duration(frames) * time.Second / FrameRate, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// formatDuration prints a duration in seconds with millisecond precision
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%gs", float64(d.Milliseconds())/1000)
+}
@@ -0,0 +1,122 @@
+package timeline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testScript = `# Opening
+define finale stars cubes logo scroller
+
+scene intro 0s 12s   # the logo drops in
+scene cubes 12s 30.5s fade 500ms reveal iris style toon
+scene greetings 1525f 3000f fade 25f
+sync beat every 24f from 12f
+param raymarch.twist 3 at 30s glide 4s
+`
+
+// reparse parses the formatted script, failing the test on an error
+func reparse(t *testing.T, s *Script) *Script {
+	t.Helper()
+	again, err := Parse(s.Format())
+	if err != nil {
+		t.Fatalf("formatted script does not parse: %v\n%s", err, s.Format())
+	}
+	return again
+}
+
+// sameStatements reports whether two scripts declare the same things
+func sameStatements(a, b *Script) bool {
+	if len(a.Scenes) != len(b.Scenes) {
+		return false
+	}
+	for i := range a.Scenes {
+		if !sameScene(a.Scenes[i], b.Scenes[i]) {
+			return false
+		}
+	}
+	return reflect.DeepEqual(a.Defines, b.Defines) && reflect.DeepEqual(a.Syncs, b.Syncs) &&
+		reflect.DeepEqual(a.Keys, b.Keys) && reflect.DeepEqual(a.Shots, b.Shots) &&
+		reflect.DeepEqual(a.Params, b.Params)
+}
+
+// TestFormatRoundTrip checks that a script saved unchanged is written
+// back as it was, comments and frame times included
+func TestFormatRoundTrip(t *testing.T) {
+	s, err := Parse([]byte(testScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(s.Format()); got != testScript {
+		t.Errorf("unchanged script formatted as\n%s\nwant\n%s", got, testScript)
+	}
+	if again := reparse(t, s); !sameStatements(s, again) {
+		t.Errorf("script changed through a round trip")
+	}
+}
+
+// TestFormatMovedBoundary checks that moving a scene boundary rewrites
+// only the times that moved, frames staying frames where they can
+func TestFormatMovedBoundary(t *testing.T) {
+	s, err := Parse([]byte(testScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Scenes[0].End = 12500 * time.Millisecond
+	s.Scenes[1].Start = 12500 * time.Millisecond
+	s.Scenes[2].End = 62 * time.Second           // 3100 frames
+	s.Scenes[2].Start = 30510 * time.Millisecond // Between two frames
+
+	want := strings.NewReplacer(
+		"scene intro 0s 12s   #", "scene intro 0s 12.5s   #",
+		"scene cubes 12s 30.5s", "scene cubes 12.5s 30.5s",
+		"scene greetings 1525f 3000f", "scene greetings 30.51s 3100f",
+	).Replace(testScript)
+	if got := string(s.Format()); got != want {
+		t.Errorf("edited script formatted as\n%s\nwant\n%s", got, want)
+	}
+	if again := reparse(t, s); !sameStatements(s, again) {
+		t.Errorf("edited script changed through a round trip")
+	}
+}
+
+// TestFormatReplacedScenes checks that scenes replacing those of a
+// script take their place, the rest of the text kept
+func TestFormatReplacedScenes(t *testing.T) {
+	s, err := Parse([]byte(testScript))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = s.WithScenes([]Scene{
+		{Name: "part1", Start: 0, End: 20 * time.Second},
+		{Name: "part2", Start: 20 * time.Second, End: time.Minute},
+	})
+	want := `# Opening
+define finale stars cubes logo scroller
+
+scene part1 0s 20s
+scene part2 20s 60s
+sync beat every 24f from 12f
+param raymarch.twist 3 at 30s glide 4s
+`
+	if got := string(s.Format()); got != want {
+		t.Errorf("script with new scenes formatted as\n%s\nwant\n%s", got, want)
+	}
+	if again := reparse(t, s); !sameStatements(s, again) {
+		t.Errorf("script with new scenes changed through a round trip")
+	}
+}
+
+// TestFormatNewScript checks that a script built in code formats into
+// one parsing back the same
+func TestFormatNewScript(t *testing.T) {
+	s := &Script{
+		Scenes:  []Scene{{Name: "intro", Start: 0, End: 12 * time.Second, Fade: 500 * time.Millisecond, Mirror: 6}},
+		Defines: []Definition{{Scene: "intro", Parts: []string{"stars", "logo"}}},
+	}
+	if again := reparse(t, s); !sameStatements(s, again) {
+		t.Errorf("new script changed through a round trip:\n%s", s.Format())
+	}
+}
@@ -0,0 +1,41 @@
+package timeline
+
+import "time"
+
+// Cue is a scene playing at a given time, with its fade level
+type Cue struct {
+	Scene *Scene
+	Alpha float64 // 0 fully faded out, 1 fully visible
+}
+
+// At returns the scenes playing at t, in script order, so later scenes
+// draw on top of earlier ones where they overlap. The script loops: past
+// its end, t wraps back to the first scene along with the music.
+func (s *Script) At(t time.Duration) []Cue {
+	length := s.Length()
+	if length <= 0 {
+		return nil
+	}
+	t = wrap(t, length)
+
+	var cues []Cue
+	for i := range s.Scenes {
+		sc := &s.Scenes[i]
+		if t < sc.Start || t >= sc.End {
+			continue
+		}
+		cues = append(cues, Cue{Scene: sc, Alpha: sc.fadeLevel(t)})
+	}
+	return cues
+}
+
+// fadeLevel returns how visible the scene is at t: it fades in from
+// black over its first Fade and out to black over its last Fade
+func (sc *Scene) fadeLevel(t time.Duration) float64 {
+	if sc.Fade <= 0 {
+		return 1
+	}
+	in := float64(t-sc.Start) / float64(sc.Fade)
+	out := float64(sc.End-t) / float64(sc.Fade)
+	return min(in, out, 1)
+}
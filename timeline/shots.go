@@ -0,0 +1,125 @@
+package timeline
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shot is a camera move of a named track, such as "objects", from Start
+// to End. Kind names the move, and each parameter holds keys spread
+// evenly over the shot, the camera easing from one to the next.
+type Shot struct {
+	Track  string
+	Kind   string
+	Start  time.Duration
+	End    time.Duration
+	Params []ShotParam
+}
+
+// ShotParam is a keyframed parameter of a shot
+type ShotParam struct {
+	Name string
+	Keys []float64
+}
+
+// ShotKinds are the camera moves shots can make
+var ShotKinds = []string{"orbit", "dolly-in", "flyby"}
+
+// shotParams are the parameters shots take
+var shotParams = []string{"angle", "distance", "height", "x", "y", "z", "tx", "ty", "tz", "roll", "zoom"}
+
+// ShotAt returns the shot of track playing at t, which wraps with the
+// script length like At, and how far into it t is, 0 to 1. When shots
+// overlap, the one declared last wins. ok is false between shots.
+func (s *Script) ShotAt(track string, t time.Duration) (shot Shot, frac float64, ok bool) {
+	if length := s.Length(); length > 0 {
+		t = wrap(t, length)
+	}
+	for _, sh := range s.Shots {
+		if sh.Track == track && t >= sh.Start && t < sh.End {
+			shot, frac, ok = sh, float64(t-sh.Start)/float64(sh.End-sh.Start), true
+		}
+	}
+	return shot, frac, ok
+}
+
+// Param returns the value of the named parameter frac of the way through
+// the shot, eased between its keys. Parameters the shot does not set take
+// the default keys def, and 0 without them.
+func (sh *Shot) Param(name string, frac float64, def ...float64) float64 {
+	keys := def
+	for _, p := range sh.Params {
+		if p.Name == name {
+			keys = p.Keys
+		}
+	}
+	switch len(keys) {
+	case 0:
+		return 0
+	case 1:
+		return keys[0]
+	}
+	pos := min(max(frac, 0), 1) * float64(len(keys)-1)
+	i := min(int(pos), len(keys)-2)
+	f := pos - float64(i)
+	f = f * f * (3 - 2*f)
+	return keys[i] + (keys[i+1]-keys[i])*f
+}
+
+// parseShot reads "shot <track> <kind> <start> <end> [<param> <keys>]...",
+// the keys of a parameter separated by commas
+func (s *Script) parseShot(fields []string) error {
+	const usage = "expected \"shot <track> <kind> <start> <end> [<param> <value>[,<value>...]]...\""
+	if len(fields) < 5 || len(fields)%2 == 0 {
+		return errors.New(usage)
+	}
+	sh := Shot{Track: fields[1], Kind: fields[2]}
+	if !slices.Contains(ShotKinds, sh.Kind) {
+		return fmt.Errorf("unknown shot %q, expected one of %s", sh.Kind, strings.Join(ShotKinds, ", "))
+	}
+	var err error
+	if sh.Start, err = parseTime(fields[3]); err != nil {
+		return err
+	}
+	if sh.End, err = parseTime(fields[4]); err != nil {
+		return err
+	}
+	if sh.End <= sh.Start {
+		return fmt.Errorf("shot %s ends before it starts", sh.Track)
+	}
+	for i := 5; i < len(fields); i += 2 {
+		name := fields[i]
+		if !slices.Contains(shotParams, name) {
+			return fmt.Errorf("unknown shot parameter %q, expected one of %s", name, strings.Join(shotParams, ", "))
+		}
+		p := ShotParam{Name: name}
+		for _, v := range strings.Split(fields[i+1], ",") {
+			k, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s key %q", name, v)
+			}
+			p.Keys = append(p.Keys, k)
+		}
+		sh.Params = append(sh.Params, p)
+	}
+	s.Shots = append(s.Shots, sh)
+	return nil
+}
+
+// formatShot returns a shot in the demo script syntax
+func formatShot(sh Shot) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "shot %s %s %s %s", sh.Track, sh.Kind, formatDuration(sh.Start), formatDuration(sh.End))
+	for _, p := range sh.Params {
+		keys := make([]string, len(p.Keys))
+		for i, k := range p.Keys {
+			keys[i] = strconv.FormatFloat(k, 'g', -1, 64)
+		}
+		fmt.Fprintf(&b, " %s %s", p.Name, strings.Join(keys, ","))
+	}
+	return b.String()
+}
@@ -0,0 +1,125 @@
+package timeline
+
+import (
+	"slices"
+	"time"
+)
+
+// Sync is a named series of events on the music timeline, which effects
+// use to snap to the beat instead of free-running
+type Sync struct {
+	Name    string
+	Every   time.Duration   // Interval of periodic events, 0 for none
+	From    time.Duration   // Time of the first periodic event
+	Markers []time.Duration // Explicit event times
+
+	// On makes a tracker sync, firing on the rows of the tracker module
+	// playing instead of at times: OnPattern, OnRow or OnInstrument, with
+	// the patterns, rows or instruments it fires on in Values
+	On     string
+	Values []int
+}
+
+// Sources of tracker syncs
+const (
+	OnPattern    = "pattern"    // The start of a pattern, of any when Values is empty
+	OnRow        = "row"        // Rows of every pattern
+	OnInstrument = "instrument" // Notes started with an instrument
+)
+
+// Row is a row of a tracker module, as tracker syncs see it
+type Row struct {
+	Pattern     int
+	Row         int
+	Start       bool  // The first row played of the pattern at its song position
+	Instruments []int // Instruments of the notes the row starts
+}
+
+// Event is a sync firing at a point of the script
+type Event struct {
+	Name  string
+	Time  time.Duration
+	Count int // Periodic events are numbered from 0 at From
+}
+
+// Events returns the sync events in the window (from, to], ordered by
+// sync then time. Both times wrap with the script length like At; when
+// to wraps before from, the window runs to the end of the script and on
+// from its start, as when the music loops.
+func (s *Script) Events(from, to time.Duration) []Event {
+	length := s.Length()
+	if length <= 0 {
+		return nil
+	}
+	from, to = wrap(from, length), wrap(to, length)
+
+	var events []Event
+	for i := range s.Syncs {
+		sy := &s.Syncs[i]
+		if from <= to {
+			events = sy.appendEvents(events, from, to)
+			continue
+		}
+		events = sy.appendEvents(events, from, length)
+		events = sy.appendEvents(events, -1, to)
+	}
+	return events
+}
+
+// RowEvents returns the names of the tracker syncs firing on a row, each
+// once, in script order
+func (s *Script) RowEvents(r Row) []string {
+	var names []string
+	for _, sy := range s.Syncs {
+		if sy.firesOn(r) && !slices.Contains(names, sy.Name) {
+			names = append(names, sy.Name)
+		}
+	}
+	return names
+}
+
+// firesOn reports whether a tracker sync fires on a row
+func (sy *Sync) firesOn(r Row) bool {
+	switch sy.On {
+	case OnPattern:
+		return r.Start && (len(sy.Values) == 0 || slices.Contains(sy.Values, r.Pattern))
+	case OnRow:
+		return slices.Contains(sy.Values, r.Row)
+	case OnInstrument:
+		for _, ins := range r.Instruments {
+			if slices.Contains(sy.Values, ins) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendEvents appends the events of the sync in (from, to]
+func (sy *Sync) appendEvents(events []Event, from, to time.Duration) []Event {
+	if sy.Every > 0 {
+		k := int64(0)
+		if from >= sy.From {
+			k = int64((from-sy.From)/sy.Every) + 1
+		}
+		for t := sy.From + time.Duration(k)*sy.Every; t <= to; t += sy.Every {
+			events = append(events, Event{Name: sy.Name, Time: t, Count: int(k)})
+			k++
+		}
+	}
+	for _, t := range sy.Markers {
+		if t > from && t <= to {
+			events = append(events, Event{Name: sy.Name, Time: t})
+		}
+	}
+	return events
+}
+
+// wrap brings t into [0, length)
+func wrap(t, length time.Duration) time.Duration {
+	t %= length
+	if t < 0 {
+		t += length
+	}
+	return t
+}
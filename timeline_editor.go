@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bilizir-demo/buildinfo"
+	"bilizir-demo/sysfont"
+	"bilizir-demo/timeline"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+const (
+	editorMargin   = 20
+	editorHeight   = 60
+	editorGrab     = 4                      // Pixels around a boundary that grab it
+	editorMinScene = 500 * time.Millisecond // Shortest scene a drag can leave
+)
+
+// Scene block colors, alternated along the timeline
+var editorSceneColors = []color.RGBA{
+	{0x40, 0x60, 0xc0, 0x90},
+	{0xc0, 0x40, 0x90, 0x90},
+}
+
+// editorLoopColor marks the loop region on the timeline
+var editorLoopColor = color.RGBA{0x40, 0xff, 0x80, 0xff}
+
+// TimelineEditor is the dev overlay showing the scenes of the demo script
+// against the music. Scene boundaries can be dragged, and clicking
+// anywhere else on the bar seeks the music. Boundaries suggested by the
+// music analysis are marked in yellow; A replaces the scenes with them.
+// I and O set the in and out points of a loop at the playhead, and K
+// loops the scene under it or ends the loop.
+type TimelineEditor struct {
+	open   bool
+	bar    image.Rectangle // Last drawn bar, in screen pixels
+	peaks  []float32       // Music waveform, one peak per analysis window
+	status string
+
+	dragging  bool
+	dragIndex int // Scene whose end is being dragged
+	dragFrom  time.Duration
+	dragLink  bool // The next scene starts where the dragged one ends
+}
+
+// moveBoundaryCommand moves the end of a scene, and the start of the
+// following scene when the two are adjacent
+type moveBoundaryCommand struct {
+	g        *Game
+	index    int
+	link     bool
+	from, to time.Duration
+}
+
+func (c *moveBoundaryCommand) apply(t time.Duration) {
+	scenes := c.g.script.Scenes
+	scenes[c.index].End = t
+	if c.link {
+		scenes[c.index+1].Start = t
+	}
+	c.g.saveScript()
+}
+
+func (c *moveBoundaryCommand) Do() {
+	c.apply(c.to)
+}
+
+func (c *moveBoundaryCommand) Undo() {
+	c.apply(c.from)
+}
+
+func (c *moveBoundaryCommand) Describe() string {
+	return "move end of " + c.g.script.Scenes[c.index].Name
+}
+
+// defaultScript splits the tune into the parts of the intro
+func defaultScript(length time.Duration) *timeline.Script {
+	if length <= 0 {
+		length = time.Minute
+	}
+	third := (length / 3).Round(time.Second)
+	return &timeline.Script{Scenes: []timeline.Scene{
+		{Name: "copper", Start: 0, End: third, Fade: defaultSceneFade},
+		{Name: "cubes", Start: third, End: 2 * third, Fade: defaultSceneFade},
+		{Name: "greetings", Start: 2 * third, End: length, Fade: defaultSceneFade},
+	}}
+}
+
+// loadScript reads the demo script, falling back to the default one
+func (g *Game) loadScript() {
+	s, err := timeline.Load(g.scriptPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Demo script: %v", err)
+		}
+		s = defaultScript(g.musicLength())
+	}
+	g.script = s
+	g.defineScenes()
+	g.setScriptParams()
+	g.playSceneMusic()
+}
+
+// playSceneMusic streams the tunes the scenes of the demo script have
+// over the main tune, once the script is loaded
+func (g *Game) playSceneMusic() {
+	if g.music == nil || g.audioPlayer == nil {
+		return
+	}
+	m := NewSceneMusic(g.music, g.script, filepath.Dir(g.scriptPath), sampleRate)
+	if m == nil {
+		return
+	}
+	main := g.music
+	g.music = m
+	if err := g.recreateAudioPlayer(); err != nil {
+		log.Printf("Failed to play the scene music: %v", err)
+		g.music = main
+	}
+}
+
+// saveScript persists timeline edits to the demo script file
+func (g *Game) saveScript() {
+	if err := g.script.Save(g.scriptPath); err != nil {
+		log.Printf("Failed to save demo script: %v", err)
+		g.editor.status = "save failed"
+		return
+	}
+	g.editor.status = "saved " + g.scriptPath
+}
+
+// musicLength returns the length of the tune, 0 without music
+func (g *Game) musicLength() time.Duration {
+	if g.music == nil {
+		return 0
+	}
+	return g.music.Duration()
+}
+
+// musicPosition returns the playback position in the tune
+func (g *Game) musicPosition() time.Duration {
+	if g.music == nil {
+		return 0
+	}
+	return g.music.MusicPosition()
+}
+
+// seekMusic jumps playback and the demo clock to t
+func (g *Game) seekMusic(t time.Duration) {
+	g.stopEndless()
+	if g.music == nil {
+		g.clock.seek(t)
+		return
+	}
+	g.music.SeekTime(t)
+	g.clock.seek(g.heardPosition())
+}
+
+// skipStep is how far Left and Right skip in the tune
+const skipStep = 10 * time.Second
+
+// skipMusic jumps playback and the demo clock by d from the position
+// seen, stopping at the start and wrapping around at the end as the tune
+// loops
+func (g *Game) skipMusic(d time.Duration) {
+	t := max(g.clock.scene+d, 0)
+	if length := g.musicLength(); length > 0 {
+		t = wrapDuration(t, length)
+	}
+	g.seekMusic(t)
+}
+
+// timelineLength is the time span shown by the editor
+func (g *Game) timelineLength() time.Duration {
+	return max(g.musicLength(), g.script.Length(), time.Second)
+}
+
+// timeToX converts a time on the timeline to a screen x coordinate
+func (e *TimelineEditor) timeToX(t, length time.Duration) float32 {
+	return float32(e.bar.Min.X) + float32(e.bar.Dx())*float32(t)/float32(length)
+}
+
+// xToTime converts a screen x coordinate to a time on the timeline
+func (e *TimelineEditor) xToTime(x int, length time.Duration) time.Duration {
+	f := float64(x-e.bar.Min.X) / float64(e.bar.Dx())
+	f = min(max(f, 0), 1)
+	return time.Duration(f * float64(length))
+}
+
+// Update handles dragging and seeking while the editor is open
+func (e *TimelineEditor) Update(g *Game) {
+	if !e.open || e.bar.Empty() {
+		return
+	}
+
+	if !e.dragging && inpututil.IsKeyJustPressed(ebiten.KeyA) {
+		g.applySuggestions()
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyI) {
+		g.setLoopPoint(g.clock.scene, false)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyO) {
+		g.setLoopPoint(g.clock.scene, true)
+	}
+	if inpututil.IsKeyJustPressed(ebiten.KeyK) {
+		g.toggleSceneLoop()
+	}
+
+	length := g.timelineLength()
+	scenes := g.script.Scenes
+	mx, my := ebiten.CursorPosition()
+
+	if e.dragging {
+		// Preview the drag live, then record it as one undoable command.
+		// The time is rounded before it is clamped so it stays in bounds;
+		// with no room between the scenes around the boundary, as a
+		// script may have them shorter than editorMinScene, it stays put.
+		lo := scenes[e.dragIndex].Start + editorMinScene
+		hi := length
+		if e.dragIndex+1 < len(scenes) {
+			hi = scenes[e.dragIndex+1].End - editorMinScene
+		}
+		t := e.dragFrom
+		if hi >= lo {
+			t = min(max(e.xToTime(mx, length).Round(10*time.Millisecond), lo), hi)
+		}
+		scenes[e.dragIndex].End = t
+		if e.dragLink {
+			scenes[e.dragIndex+1].Start = t
+		}
+
+		if inpututil.IsMouseButtonJustReleased(ebiten.MouseButtonLeft) {
+			e.dragging = false
+			scenes[e.dragIndex].End = e.dragFrom
+			if e.dragLink {
+				scenes[e.dragIndex+1].Start = e.dragFrom
+			}
+			if t != e.dragFrom {
+				g.history.Run(&moveBoundaryCommand{g: g, index: e.dragIndex, link: e.dragLink, from: e.dragFrom, to: t})
+			}
+		}
+		return
+	}
+
+	if !inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) || !image.Pt(mx, my).In(e.bar) {
+		return
+	}
+
+	// Grab a boundary if the click is close enough to one
+	for i, sc := range scenes {
+		bx := e.timeToX(sc.End, length)
+		if abs32(float32(mx)-bx) <= editorGrab {
+			e.dragging = true
+			e.dragIndex = i
+			e.dragFrom = sc.End
+			e.dragLink = i+1 < len(scenes) && scenes[i+1].Start == sc.End
+			return
+		}
+	}
+
+	// Otherwise seek the music
+	g.seekMusic(e.xToTime(mx, length))
+}
+
+// abs32 returns the absolute value of v
+func abs32(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Draw renders the timeline bar at the bottom of the screen
+func (e *TimelineEditor) Draw(screen *ebiten.Image, g *Game) {
+	if !e.open {
+		return
+	}
+
+	sw, sh := screen.Bounds().Dx(), screen.Bounds().Dy()
+	e.bar = image.Rect(editorMargin, sh-editorMargin-editorHeight, sw-editorMargin, sh-editorMargin)
+	x0, y0 := float32(e.bar.Min.X), float32(e.bar.Min.Y)
+	w, h := float32(e.bar.Dx()), float32(e.bar.Dy())
+	length := g.timelineLength()
+
+	vector.DrawFilledRect(screen, x0-2, y0-18, w+4, h+20, color.RGBA{0, 0, 0, 0xc0}, false)
+
+	// Music waveform behind the scene blocks
+	if len(e.peaks) > 0 {
+		peaksLength := g.musicLength()
+		if peaksLength <= 0 {
+			peaksLength = length
+		}
+		for x := 0; x < e.bar.Dx(); x++ {
+			t := e.xToTime(e.bar.Min.X+x, length)
+			if t >= peaksLength {
+				break
+			}
+			p := e.peaks[int(int64(t)*int64(len(e.peaks))/int64(peaksLength))]
+			ph := p * h
+			vector.StrokeLine(screen, x0+float32(x), y0+(h-ph)/2, x0+float32(x), y0+(h+ph)/2, 1, color.RGBA{0x60, 0xa0, 0x60, 0xff}, false)
+		}
+	}
+
+	// Scene blocks with their names
+	for i, sc := range g.script.Scenes {
+		sx0 := e.timeToX(sc.Start, length)
+		sx1 := e.timeToX(sc.End, length)
+		vector.DrawFilledRect(screen, sx0, y0, sx1-sx0, h, editorSceneColors[i%len(editorSceneColors)], false)
+		vector.StrokeLine(screen, sx1, y0, sx1, y0+h, 2, color.White, false)
+		sysfont.Print(screen, sc.Name, int(sx0)+4, int(y0)+4, sysfont.Style{})
+	}
+
+	// Suggested scene boundaries
+	for _, t := range g.suggestions {
+		mx := e.timeToX(t, length)
+		vector.StrokeLine(screen, mx, y0-6, mx, y0+6, 2, color.RGBA{0xff, 0xe0, 0x40, 0xff}, false)
+	}
+
+	// Loop region, or the in point waiting for its out point
+	if l := &g.loop; l.on {
+		lx0, lx1 := e.timeToX(l.in, length), e.timeToX(min(l.out, length), length)
+		vector.DrawFilledRect(screen, lx0, y0+h-4, lx1-lx0, 4, editorLoopColor, false)
+		vector.StrokeLine(screen, lx0, y0, lx0, y0+h, 2, editorLoopColor, false)
+		vector.StrokeLine(screen, lx1, y0, lx1, y0+h, 2, editorLoopColor, false)
+	} else if l.out == 0 && l.in > 0 {
+		lx := e.timeToX(l.in, length)
+		vector.StrokeLine(screen, lx, y0, lx, y0+h, 1, editorLoopColor, false)
+	}
+
+	// Playhead
+	px := e.timeToX(g.musicPosition(), length)
+	vector.StrokeLine(screen, px, y0-4, px, y0+h+4, 2, color.RGBA{0xff, 0x30, 0x30, 0xff}, false)
+
+	info := fmt.Sprintf("TIMELINE  %.1fs / %.1fs  [%s]", g.musicPosition().Seconds(), length.Seconds(), buildinfo.Get().Short())
+	if g.loop.on {
+		info += "  LOOP " + g.loop.String()
+	}
+	if e.status != "" {
+		info += "  " + e.status
+	}
+	sysfont.Print(screen, info, int(x0), int(y0)-13, sysfont.Style{})
+}
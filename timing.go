@@ -0,0 +1,68 @@
+package main
+
+import (
+	"time"
+
+	"bilizir-demo/effects"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	// palTickRate is the vertical blank rate of a PAL Atari ST
+	palTickRate = 50
+
+	// maxTicksPerUpdate bounds catch-up after a stall so the demo skips
+	// ahead instead of spiralling
+	maxTicksPerUpdate = 4
+
+	// vblSeconds is how far the intro parts advance per logic tick: one
+	// frame at the rate their constants were tuned for, so each PAL tick
+	// moves them exactly as one ST vertical blank did
+	vblSeconds = 1.0 / effects.FrameRate
+)
+
+// palTiming locks demo logic to 50 ticks per second, counted on the demo
+// clock. While music is playing the clock follows the audio position, so
+// visuals stay in step with the tune exactly as they did on the original
+// VBL.
+type palTiming struct {
+	enabled bool
+	ticks   int64 // Ticks run, counted from the start of the demo clock
+}
+
+// setPALTiming switches between 50Hz PAL timing and one tick per update
+func (g *Game) setPALTiming(enabled bool) {
+	g.pal = palTiming{enabled: enabled}
+	if enabled {
+		// Only the ticks due from now on are run
+		g.pal.ticks = int64(g.clock.elapsed * palTickRate / time.Second)
+	}
+}
+
+// tickSeconds returns the duration of one logic tick
+func (g *Game) tickSeconds() float64 {
+	if g.pal.enabled {
+		return 1.0 / palTickRate
+	}
+	if g.export != nil {
+		// Offline the parts tick at the rate they were tuned for
+		return vblSeconds
+	}
+	return 1.0 / float64(ebiten.TPS())
+}
+
+// ticksDue returns how many logic ticks to run during this update
+func (g *Game) ticksDue() int {
+	if !g.pal.enabled {
+		return 1
+	}
+
+	due := int64(g.clock.elapsed * palTickRate / time.Second)
+	n := due - g.pal.ticks
+	g.pal.ticks = due
+	if n > maxTicksPerUpdate {
+		n = maxTicksPerUpdate
+	}
+	return int(max(n, 0))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"strings"
+
+	"bilizir-demo/effects"
+)
+
+// verifyTolerance is the largest difference between a traced value and
+// its reference that is not a regression
+const verifyTolerance = 1e-6
+
+// verifyScroller traces the scroller math for the given number of frames
+// at the reference resolution and compares it against the reference
+// trace at refPath. The current trace is written next to the reference
+// for inspection; a missing reference is created from it.
+func verifyScroller(refPath string, frames int) error {
+	trace := effects.TraceScroller("", effects.NewLayout(screenWidth, screenHeight), nil, frames)
+	data, err := json.MarshalIndent(trace, "", " ")
+	if err != nil {
+		return err
+	}
+
+	ref, err := os.ReadFile(refPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.WriteFile(refPath, data, 0o644); err != nil {
+			return err
+		}
+		fmt.Printf("Scroller reference written to %s (%d frames)\n", refPath, frames)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	currentPath := strings.TrimSuffix(refPath, ".json") + ".current.json"
+	if err := os.WriteFile(currentPath, data, 0o644); err != nil {
+		return err
+	}
+
+	var want []effects.ScrollerFrame
+	if err := json.Unmarshal(ref, &want); err != nil {
+		return fmt.Errorf("%s: %w", refPath, err)
+	}
+	if err := compareScrollerTraces(want, trace); err != nil {
+		return fmt.Errorf("scroller differs from %s (current trace in %s): %w", refPath, currentPath, err)
+	}
+	fmt.Printf("Scroller matches %s (%d frames)\n", refPath, min(len(want), len(trace)))
+	return nil
+}
+
+// compareScrollerTraces returns the first difference between two traces
+// over the frames they both cover
+func compareScrollerTraces(want, got []effects.ScrollerFrame) error {
+	for i := 0; i < min(len(want), len(got)); i++ {
+		w, g := want[i], got[i]
+		if !near(w.X, g.X) {
+			return fmt.Errorf("frame %d: scroll x is %g, want %g", i, g.X, w.X)
+		}
+		if err := compareValues("line offset", w.LineOffsets, g.LineOffsets); err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		if err := compareValues("column offset", w.ColumnOffsets, g.ColumnOffsets); err != nil {
+			return fmt.Errorf("frame %d: %w", i, err)
+		}
+		if len(w.Glyphs) != len(g.Glyphs) {
+			return fmt.Errorf("frame %d: %d glyphs placed, want %d", i, len(g.Glyphs), len(w.Glyphs))
+		}
+		for j := range w.Glyphs {
+			if w.Glyphs[j].Char != g.Glyphs[j].Char || w.Glyphs[j].Index != g.Glyphs[j].Index || !near(w.Glyphs[j].X, g.Glyphs[j].X) {
+				return fmt.Errorf("frame %d: glyph %d is %+v, want %+v", i, j, g.Glyphs[j], w.Glyphs[j])
+			}
+		}
+	}
+	return nil
+}
+
+// compareValues returns the first difference between two value lists
+func compareValues(what string, want, got []float64) error {
+	if len(want) != len(got) {
+		return fmt.Errorf("%d %ss, want %d", len(got), what, len(want))
+	}
+	for i := range want {
+		if !near(want[i], got[i]) {
+			return fmt.Errorf("%s %d is %g, want %g", what, i, got[i], want[i])
+		}
+	}
+	return nil
+}
+
+// near reports whether two traced values match within verifyTolerance
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= verifyTolerance
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// pageVisibility tracks whether the browser tab showing the demo is
+// hidden. Browsers throttle or stop frame updates in background tabs, so
+// the demo pauses while hidden and resyncs on the audio clock when shown
+// again instead of fast-forwarding or drifting from the music.
+type pageVisibility struct {
+	hidden       atomic.Bool // Set from the browser event handler
+	pausedByHide atomic.Bool // The music was paused for the page hiding
+	wasHidden    bool        // State last handled by Update
+}
+
+// handleVisibility pauses the demo when the page is hidden and resumes it
+// when shown again, and reports whether the page is hidden. The browser
+// event handler may pause the music itself and the page show again before
+// Update runs, so the music is resumed on the pause recorded, not on a
+// change of state seen here.
+func (g *Game) handleVisibility() bool {
+	v := &g.visibility
+	hidden := v.hidden.Load()
+	changed := hidden != v.wasHidden
+	v.wasHidden = hidden
+
+	if hidden {
+		// A user pause stays in effect across visibility changes
+		if changed && !g.paused && g.music != nil && !g.music.Paused() {
+			g.music.Pause()
+			v.pausedByHide.Store(true)
+		}
+		return true
+	}
+
+	if !v.pausedByHide.Swap(false) || g.paused || g.music == nil {
+		return false
+	}
+	g.music.Resume()
+	// The device did not read while hidden; do not mistake it for a stall
+	g.watchdog.lastAttempt = time.Now()
+	return false
+}
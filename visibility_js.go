@@ -0,0 +1,24 @@
+//go:build js
+
+package main
+
+import "syscall/js"
+
+// watchVisibility follows the page visibility through the browser's
+// visibilitychange event
+func (g *Game) watchVisibility() {
+	doc := js.Global().Get("document")
+	onChange := js.FuncOf(func(this js.Value, args []js.Value) any {
+		hidden := doc.Get("hidden").Bool()
+		g.visibility.hidden.Store(hidden)
+
+		// Update may not run again until the tab is shown, so silence the
+		// music right away
+		if hidden && !g.paused && g.music != nil && !g.music.Paused() {
+			g.music.Pause()
+			g.visibility.pausedByHide.Store(true)
+		}
+		return nil
+	})
+	doc.Call("addEventListener", "visibilitychange", onChange)
+}
@@ -0,0 +1,7 @@
+//go:build !js
+
+package main
+
+// watchVisibility does nothing outside the browser, where the window
+// keeps running when hidden
+func (g *Game) watchVisibility() {}
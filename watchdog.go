@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/audio"
+
+	"bilizir-demo/sysfont"
+)
+
+const (
+	// audioStallTimeout is how long the audio device may go without
+	// reading samples before the player is considered stalled
+	audioStallTimeout = 500 * time.Millisecond
+
+	// audioRecoveredNotice is how long the recovery notice stays visible
+	audioRecoveredNotice = 3 * time.Second
+)
+
+// audioWatchdog notices when the audio device stops pulling samples
+// (device lost, audio context suspended by the browser) and recreates
+// the player instead of leaving the music silently frozen
+type audioWatchdog struct {
+	stalled     bool
+	lastAttempt time.Time
+	attempts    int
+	warning     string
+	warnUntil   time.Time // Notice expiry once no longer stalled
+}
+
+// checkAudio runs the watchdog; it is called once per update
+func (g *Game) checkAudio() {
+	w := &g.watchdog
+	if g.music == nil || g.audioPlayer == nil || g.paused || !g.audioContext.IsReady() {
+		return
+	}
+
+	// Browsers only start audio after a user gesture; nothing to watch
+	// until the first read
+	last := g.music.LastRead()
+	if last.IsZero() {
+		return
+	}
+
+	stall := time.Since(last)
+	if stall < audioStallTimeout {
+		if w.stalled {
+			w.stalled = false
+			w.attempts = 0
+			w.warning = "AUDIO RECOVERED"
+			w.warnUntil = time.Now().Add(audioRecoveredNotice)
+		}
+		return
+	}
+
+	// Give each new player a full timeout to start reading
+	if time.Since(w.lastAttempt) < audioStallTimeout {
+		return
+	}
+	w.stalled = true
+	w.lastAttempt = time.Now()
+	w.attempts++
+
+	log.Printf("Audio stalled for %v, recreating the player (attempt %d)", stall.Round(time.Millisecond), w.attempts)
+	if err := g.recreateAudioPlayer(); err != nil {
+		log.Printf("Failed to recreate audio player: %v", err)
+		w.warning = fmt.Sprintf("AUDIO STALLED: %v", err)
+		return
+	}
+	w.warning = fmt.Sprintf("AUDIO STALLED %v, RESTARTING PLAYER (ATTEMPT %d)", stall.Round(100*time.Millisecond), w.attempts)
+}
+
+// recreateAudioPlayer replaces the audio player with a new one streaming
+// from the same YM player, so playback carries on where it stopped
+func (g *Game) recreateAudioPlayer() error {
+	p, err := g.newAudioPlayer()
+	if err != nil {
+		return err
+	}
+	g.audioPlayer.Close()
+	g.audioPlayer = p
+	p.Play()
+	return nil
+}
+
+// newAudioPlayer creates an audio player streaming the tune, in 32-bit
+// float for the tunes rendering it, through the tap of the oscilloscope
+func (g *Game) newAudioPlayer() (*audio.Player, error) {
+	if f, ok := g.music.(FloatPlayer); ok {
+		return g.audioContext.NewPlayerF32(tappedStream{ReadSeeker: f.F32(), tap: &g.tap, f32: true})
+	}
+	return g.audioContext.NewPlayer(tappedStream{ReadSeeker: g.music, tap: &g.tap})
+}
+
+// showing reports whether the warning is on screen at now
+func (w *audioWatchdog) showing(now time.Time) bool {
+	return w.warning != "" && (w.stalled || !now.After(w.warnUntil))
+}
+
+// Draw shows the watchdog warning at the bottom of the screen
+func (w *audioWatchdog) Draw(screen *ebiten.Image) {
+	if !w.showing(time.Now()) {
+		return
+	}
+	sysfont.Print(screen, w.warning, 8, screen.Bounds().Dy()-32, sysfont.Style{Color: color.RGBA{0xff, 0xc0, 0x40, 0xff}})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"bilizir-demo/analysis"
+)
+
+// startMusicAnalysis decodes the tune in the background; the result is
+// picked up by pollMusicAnalysis once it is ready
+func (g *Game) startMusicAnalysis(data []byte) {
+	cacheDir := ""
+	if dir, err := os.UserCacheDir(); err == nil {
+		cacheDir = filepath.Join(dir, "bilizir-demo")
+	}
+
+	ch := make(chan *analysis.Waveform, 1)
+	g.waveformCh = ch
+	go func() {
+		w, err := analysis.LoadOrAnalyze(data, sampleRate, analysis.DefaultWindow, cacheDir)
+		if err != nil {
+			log.Printf("Music analysis failed: %v", err)
+		}
+		ch <- w
+	}()
+}
+
+// pollMusicAnalysis hands a finished analysis to the tools using it
+func (g *Game) pollMusicAnalysis() {
+	if g.waveformCh == nil {
+		return
+	}
+	select {
+	case w := <-g.waveformCh:
+		g.waveformCh = nil
+		g.waveform = w
+		if w != nil {
+			g.editor.peaks = w.Peaks
+			g.suggestions = analysis.Sections(w, analysis.DefaultSectionOptions)
+		}
+	default:
+	}
+}
@@ -0,0 +1,246 @@
+package ym
+
+import (
+	"time"
+
+	"github.com/olivierh59500/ym-player/pkg/stsound"
+)
+
+// mfpPrediv are the predividers of the MFP timers the effects run on
+var mfpPrediv = [8]int{0, 4, 10, 16, 50, 64, 100, 200}
+
+// mfpClock is the clock of the MFP timers on the ST
+const mfpClock = 2457600
+
+// Player renders a song in stereo. Each voice plays on a chip of its own,
+// fed the registers of the song with the other two voices silenced, and
+// is panned on its own before the voices are mixed. The effects of YM5
+// and YM6 songs (SID voices, digidrums and the sync buzzer) are replayed
+// like the StSound player does.
+type Player struct {
+	song       *Song
+	sampleRate int
+	chips      [3]*stsound.CYm2149Ex
+	voice      [3][]stsound.YmSample
+	gains      [3][2]float64 // Left and right gain of each voice
+
+	vbl   int // Samples per frame
+	left  int // Samples to render before the next frame
+	frame int // Next frame to play
+	loop  bool
+	regs  [14]byte // Registers as the song wrote them
+}
+
+// NewPlayer creates a player rendering a song at sampleRate, with its
+// voices in the center
+func NewPlayer(song *Song, sampleRate int) *Player {
+	p := &Player{song: song, sampleRate: sampleRate, vbl: max(sampleRate/song.Rate, 1)}
+	for i := range p.chips {
+		p.chips[i] = stsound.NewYm2149Ex(stsound.YmU32(song.Clock), 1, stsound.YmU32(sampleRate))
+	}
+	p.SetPan([3]float64{})
+	return p
+}
+
+// SetLoop makes the song start again from its loop frame at its end
+// instead of falling silent
+func (p *Player) SetLoop(loop bool) {
+	p.loop = loop
+}
+
+// SetPan places each voice in the stereo field, from -1 for the left to
+// 1 for the right. A voice in the center plays at full level on both
+// sides, like the mono mix; panning it fades the other side out.
+func (p *Player) SetPan(pan [3]float64) {
+	for i, v := range pan {
+		v = min(max(v, -1), 1)
+		p.gains[i] = [2]float64{min(1-v, 1), min(1+v, 1)}
+	}
+}
+
+// Render fills out with interleaved stereo samples. It returns false,
+// with the rest of out silent, once the song is over.
+func (p *Player) Render(out []int16) bool {
+	n := len(out) / 2
+	for i := range p.voice {
+		if cap(p.voice[i]) < n {
+			p.voice[i] = make([]stsound.YmSample, n)
+		}
+		p.voice[i] = p.voice[i][:n]
+	}
+
+	for done := 0; done < n; {
+		if p.left == 0 {
+			if !p.play() {
+				clear(out[done*2:])
+				return false
+			}
+			p.left = p.vbl
+		}
+		k := min(n-done, p.left)
+		for i, chip := range p.chips {
+			chip.Update(p.voice[i][done:done+k], stsound.YmInt(k))
+		}
+		done += k
+		p.left -= k
+	}
+
+	for s := range n {
+		var l, r float64
+		for i := range p.voice {
+			v := float64(p.voice[i][s])
+			l += v * p.gains[i][0]
+			r += v * p.gains[i][1]
+		}
+		out[s*2] = clamp16(l)
+		out[s*2+1] = clamp16(r)
+	}
+	return true
+}
+
+// clamp16 rounds a sample to 16 bits, clipping it
+func clamp16(v float64) int16 {
+	return int16(min(max(v, -32768), 32767))
+}
+
+// play writes the registers of the next frame to the chips, false once
+// the song is over
+func (p *Player) play() bool {
+	if p.frame >= len(p.song.Frames) {
+		if !p.loop {
+			return false
+		}
+		p.frame = p.song.Loop
+	}
+	data := &p.song.Frames[p.frame]
+	p.frame++
+
+	copy(p.regs[:13], data[:13])
+	if data[13] != 0xff {
+		p.regs[13] = data[13]
+	}
+	for v, chip := range p.chips {
+		for reg := range 11 {
+			chip.WriteRegister(stsound.YmInt(reg), stsound.YmInt(voiceRegister(v, reg, data)))
+		}
+		chip.WriteRegister(11, stsound.YmInt(data[11]))
+		chip.WriteRegister(12, stsound.YmInt(data[12]))
+		if data[13] != 0xff {
+			chip.WriteRegister(13, stsound.YmInt(data[13]))
+		}
+		chip.SidStop(0)
+		chip.SidStop(1)
+		chip.SidStop(2)
+		chip.SyncBuzzerStop()
+	}
+
+	switch p.song.Version {
+	case 5:
+		p.ym5Effects(data)
+	case 6:
+		p.ym6Effect(data, 1, 6, 14)
+		p.ym6Effect(data, 3, 8, 15)
+	}
+	return true
+}
+
+// voiceRegister returns the value of a register for the chip of voice v:
+// the other voices have their tone and noise off and no volume
+func voiceRegister(v, reg int, data *[16]byte) byte {
+	switch {
+	case reg == 7:
+		other := byte(0b111) &^ (1 << v)
+		return data[7] | other | other<<3
+	case reg >= 8 && reg <= 10 && reg-8 != v:
+		return 0
+	}
+	return data[reg]
+}
+
+// ym5Effects starts the SID voice and the digidrum of a YM5 frame
+func (p *Player) ym5Effects(data *[16]byte) {
+	if code := int(data[1]>>4) & 3; code != 0 {
+		v := code - 1
+		if prediv := mfpPrediv[data[6]>>5&7] * int(data[14]); prediv != 0 {
+			p.chips[v].SidStart(stsound.YmInt(v), stsound.YmInt(mfpClock/prediv), stsound.YmInt(data[8+v]&15))
+		}
+	}
+	if code := int(data[3]>>4) & 3; code != 0 {
+		v := code - 1
+		if prediv := mfpPrediv[data[8]>>5&7] * int(data[15]); prediv != 0 {
+			p.drum(v, int(data[8+v]&31), mfpClock/prediv)
+		}
+	}
+}
+
+// ym6Effect starts the effect coded in a register of a YM6 frame: a SID
+// voice, a digidrum or the sync buzzer
+func (p *Player) ym6Effect(data *[16]byte, code, prediv, count int) {
+	effect := data[code] & 0xf0
+	if effect&0x30 == 0 {
+		return
+	}
+	v := int(effect&0x30>>4) - 1
+	div := mfpPrediv[data[prediv]>>5&7] * int(data[count])
+	if div == 0 {
+		return
+	}
+	freq := stsound.YmInt(mfpClock / div)
+	switch effect & 0xc0 {
+	case 0x00:
+		p.chips[v].SidStart(stsound.YmInt(v), freq, stsound.YmInt(data[8+v]&15))
+	case 0x40:
+		p.drum(v, int(data[8+v]&31), int(freq))
+	case 0xc0:
+		// The buzzer drives the envelope every voice may use
+		for _, chip := range p.chips {
+			chip.SyncBuzzerStart(freq, stsound.YmInt(data[8+v]&15))
+		}
+	}
+}
+
+// drum starts a digidrum on the chip of voice v
+func (p *Player) drum(v, n, freq int) {
+	if n >= len(p.song.Drums) {
+		return
+	}
+	d := p.song.Drums[n]
+	p.chips[v].DrumStart(stsound.YmInt(v), d, stsound.YmU32(len(d)), stsound.YmInt(freq))
+}
+
+// Seek moves playback to a frame, stopping the effects under way. The
+// envelope shape last written before the frame is written again, so the
+// envelope voices sound as they would have there.
+func (p *Player) Seek(frame int) {
+	p.frame = min(max(frame, 0), len(p.song.Frames))
+	p.left = 0
+	for _, chip := range p.chips {
+		for v := range 3 {
+			chip.DrumStop(stsound.YmInt(v))
+		}
+	}
+	for f := p.frame - 1; f >= 0; f-- {
+		if shape := p.song.Frames[f][13]; shape != 0xff {
+			p.regs[13] = shape
+			for _, chip := range p.chips {
+				chip.WriteRegister(13, stsound.YmInt(shape))
+			}
+			break
+		}
+	}
+}
+
+// Position returns the time into the song of the next sample rendered
+func (p *Player) Position() time.Duration {
+	t := time.Duration(p.frame) * time.Second / time.Duration(p.song.Rate)
+	return max(t-time.Duration(p.left)*time.Second/time.Duration(p.sampleRate), 0)
+}
+
+// Register returns the value the song last wrote to a YM2149 register,
+// 0 to 13
+func (p *Player) Register(reg int) int {
+	if reg < 0 || reg >= len(p.regs) {
+		return 0
+	}
+	return int(p.regs[reg])
+}
@@ -0,0 +1,201 @@
+// Package ym reads YM files, the YM2149 register dumps of Atari ST tunes,
+// and plays them on three emulated chips, one per voice, so the voices
+// can be panned across the stereo field instead of mixed down to mono.
+package ym
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/olivierh59500/ym-player/pkg/lzh"
+	"github.com/olivierh59500/ym-player/pkg/stsound"
+)
+
+// Attributes of YM5 and YM6 files
+const (
+	attrInterleaved = 1 << 0 // Registers stored register by register
+	attrDrum4Bits   = 1 << 2 // Digidrums stored as 4-bit volumes
+)
+
+// atariClock is the YM2149 clock on the Atari ST
+const atariClock = 2000000
+
+// Song is a YM file: the register values written each frame, and the
+// digidrum samples the frames trigger
+type Song struct {
+	Title   string
+	Author  string
+	Comment string
+
+	Version int    // 3, 5 or 6
+	Clock   uint32 // YM2149 clock in Hz
+	Rate    int    // Frames per second
+	Loop    int    // Frame the song loops back to
+
+	// Frames holds the registers of each frame: the 14 of the chip, then
+	// two bytes of effect timer counts in YM5 and YM6 songs. A value of
+	// 0xff for register 13 leaves the envelope running.
+	Frames [][16]byte
+	Drums  [][]stsound.YmU8
+}
+
+// Is reports whether data looks like a YM file this package reads, packed
+// or not. YM2 and YM4 songs, mixed digital songs and YM tracker songs are
+// left to the StSound player.
+func Is(data []byte) bool {
+	if lzh.IsLZHCompressed(data) {
+		return true
+	}
+	if len(data) < 4 {
+		return false
+	}
+	switch string(data[:4]) {
+	case "YM3!", "YM3b", "YM5!", "YM6!":
+		return true
+	}
+	return false
+}
+
+// Parse reads a YM3, YM3b, YM5 or YM6 file, LHA packed or not
+func Parse(data []byte) (*Song, error) {
+	if lzh.IsLZHCompressed(data) {
+		var err error
+		if data, err = lzh.Decompress(data); err != nil {
+			return nil, fmt.Errorf("ym: unpacking: %w", err)
+		}
+	}
+	if len(data) < 4 {
+		return nil, errors.New("ym: file too short")
+	}
+	switch id := string(data[:4]); id {
+	case "YM3!", "YM3b":
+		return parseYM3(data, id == "YM3b")
+	case "YM5!", "YM6!":
+		return parseYM5(data, int(id[2]-'0'))
+	default:
+		return nil, fmt.Errorf("ym: unsupported format %q", id)
+	}
+}
+
+// parseYM3 reads the 14 registers of each frame, stored register by
+// register, then in YM3b files the frame the song loops to
+func parseYM3(data []byte, loop bool) (*Song, error) {
+	s := &Song{Version: 3, Clock: atariClock, Rate: 50}
+	body := data[4:]
+	if loop {
+		if len(body) < 4 {
+			return nil, errors.New("ym: truncated YM3b file")
+		}
+		s.Loop = int(binary.LittleEndian.Uint32(body[len(body)-4:]))
+		body = body[:len(body)-4]
+	}
+	n := len(body) / 14
+	if n == 0 {
+		return nil, errors.New("ym: song has no frames")
+	}
+	s.Frames = make([][16]byte, n)
+	for reg := range 14 {
+		for f := range n {
+			s.Frames[f][reg] = body[reg*n+f]
+		}
+	}
+	if s.Loop >= n {
+		s.Loop = 0
+	}
+	return s, nil
+}
+
+// parseYM5 reads the header, the digidrums, the names and the 16 bytes
+// of each frame of YM5 and YM6 files
+func parseYM5(data []byte, version int) (*Song, error) {
+	if len(data) < 34 || string(data[4:12]) != "LeOnArD!" {
+		return nil, errors.New("ym: bad YM5 or YM6 header")
+	}
+	r := bytes.NewReader(data[12:])
+	var h struct {
+		Frames uint32
+		Attrib uint32
+		Drums  uint16
+		Clock  uint32
+		Rate   uint16
+		Loop   uint32
+		Extra  uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		return nil, fmt.Errorf("ym: header: %w", err)
+	}
+	if h.Rate == 0 || h.Frames == 0 {
+		return nil, errors.New("ym: song has no frames")
+	}
+	if _, err := r.Seek(int64(h.Extra), 1); err != nil {
+		return nil, err
+	}
+
+	s := &Song{Version: version, Clock: h.Clock, Rate: int(h.Rate), Loop: int(h.Loop)}
+	for range h.Drums {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return nil, fmt.Errorf("ym: digidrums: %w", err)
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, errors.New("ym: truncated digidrum")
+		}
+		drum := make([]stsound.YmU8, size)
+		for i := range drum {
+			b, _ := r.ReadByte()
+			if h.Attrib&attrDrum4Bits != 0 {
+				b = drum4Bits[b&15]
+			}
+			drum[i] = stsound.YmU8(b)
+		}
+		s.Drums = append(s.Drums, drum)
+	}
+	s.Title = readString(r)
+	s.Author = readString(r)
+	s.Comment = readString(r)
+
+	n := int(h.Frames)
+	if r.Len() < n*16 {
+		return nil, errors.New("ym: truncated frames")
+	}
+	body := make([]byte, n*16)
+	r.Read(body)
+	s.Frames = make([][16]byte, n)
+	for f := range n {
+		for reg := range 16 {
+			if h.Attrib&attrInterleaved != 0 {
+				s.Frames[f][reg] = body[reg*n+f]
+			} else {
+				s.Frames[f][reg] = body[f*16+reg]
+			}
+		}
+	}
+	if s.Loop >= n {
+		s.Loop = 0
+	}
+	return s, nil
+}
+
+// drum4Bits maps the 4-bit digidrum samples to the 8-bit ones of the
+// chip, through its volume levels
+var drum4Bits = [16]byte{0, 0, 0, 0, 1, 2, 3, 4, 5, 8, 11, 16, 24, 34, 55, 85}
+
+// readString reads a NUL-terminated string
+func readString(r *bytes.Reader) string {
+	var b []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil || c == 0 {
+			return string(b)
+		}
+		b = append(b, c)
+	}
+}
+
+// Duration returns the length of the song, to its last frame
+func (s *Song) Duration() time.Duration {
+	return time.Duration(len(s.Frames)) * time.Second / time.Duration(s.Rate)
+}
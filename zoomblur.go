@@ -0,0 +1,46 @@
+package main
+
+import (
+	_ "embed"
+	"math"
+)
+
+//go:embed shaders/zoomblur.kage
+var zoomBlurShaderSrc []byte
+
+// zoomBlurDecay is how fast the beat pulse of the zoom blur fades, per
+// second
+const zoomBlurDecay = 4
+
+// initZoomBlurPass registers the radial blur pass, after the mirror pass
+func (g *Game) initZoomBlurPass() error {
+	pass, err := g.post.Add("zoomblur", zoomBlurShaderSrc, func() map[string]any {
+		// The blur is centered on the logo, or where the parameters put it
+		x, y := g.params.Get("zoomblur.x"), g.params.Get("zoomblur.y")
+		if g.params.Get("zoomblur.follow") > 0 {
+			x, y = g.logo.Center()
+		}
+		return map[string]any{
+			"Center":   []float32{float32(x), float32(y)},
+			"Strength": float32(g.zoomBlurStrength()),
+		}
+	})
+	if err != nil {
+		return err
+	}
+	g.zoomBlurPass = pass
+	return nil
+}
+
+// zoomBlurStrength is the steady blur plus the pulse of the last beat
+func (g *Game) zoomBlurStrength() float64 {
+	return g.params.Get("zoomblur.strength") + g.params.Get("zoomblur.pulse")*g.zoomBlurBeat
+}
+
+// updateZoomBlur fades the beat pulse and runs the pass while it blurs
+func (g *Game) updateZoomBlur() {
+	g.zoomBlurBeat = math.Max(g.zoomBlurBeat-zoomBlurDecay*g.tickSeconds(), 0)
+	if g.zoomBlurPass != nil {
+		g.zoomBlurPass.Enabled = g.gallery == nil && g.zoomBlurStrength() > 0
+	}
+}